@@ -0,0 +1,198 @@
+package photon
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	// AccountingFormatCSV 导出为csv,第一行是列名
+	AccountingFormatCSV = "csv"
+	// AccountingFormatJSONL 导出为JSON Lines,每行一条记录
+	AccountingFormatJSONL = "jsonl"
+)
+
+const (
+	// AccountingTypeSent 发出的交易
+	AccountingTypeSent = "sent"
+	// AccountingTypeReceived 收到的交易
+	AccountingTypeReceived = "received"
+	// AccountingTypeMediationFee 中转交易收取的手续费
+	AccountingTypeMediationFee = "mediation_fee"
+)
+
+// csv每写入多少行flush一次
+const accountingFlushRows = 100
+
+/*
+AccountingRecord one row of accounting export.
+Counterparty is the target of sent transfers, the initiator of received transfers and the payer of mediated transfers.
+TokenTotal is the running total of this token after this row, received amount and fee are added, sent amount is subtracted.
+*/
+type AccountingRecord struct {
+	Type              string         `json:"type"`
+	TokenAddress      common.Address `json:"token_address"`
+	Counterparty      common.Address `json:"counterparty"`
+	ChannelIdentifier common.Hash    `json:"channel_identifier"`
+	Amount            *big.Int       `json:"amount"`
+	Fee               *big.Int       `json:"fee"`
+	LockSecretHash    common.Hash    `json:"lock_secret_hash"`
+	BlockNumber       int64          `json:"block_number"`
+	TimeStamp         string         `json:"time_stamp"`
+	Data              string         `json:"data"`
+	TokenTotal        *big.Int       `json:"token_total"`
+}
+
+var accountingCSVHeader = []string{
+	"type", "token_address", "counterparty", "channel_identifier", "amount", "fee",
+	"lock_secret_hash", "block_number", "time_stamp", "data", "token_total",
+}
+
+func (r *AccountingRecord) csvRow() []string {
+	return []string{
+		r.Type, r.TokenAddress.String(), r.Counterparty.String(), r.ChannelIdentifier.String(),
+		r.Amount.String(), r.Fee.String(), r.LockSecretHash.String(),
+		strconv.FormatInt(r.BlockNumber, 10), r.TimeStamp, r.Data, r.TokenTotal.String(),
+	}
+}
+
+func bigOrZero(n *big.Int) *big.Int {
+	if n == nil {
+		return big.NewInt(0)
+	}
+	return n
+}
+
+type accountingWriter struct {
+	csv    *csv.Writer
+	json   *json.Encoder
+	rows   int
+	totals map[common.Address]*big.Int
+}
+
+func newAccountingWriter(w io.Writer, format string) (aw *accountingWriter, err error) {
+	aw = &accountingWriter{
+		totals: make(map[common.Address]*big.Int),
+	}
+	switch format {
+	case AccountingFormatCSV:
+		aw.csv = csv.NewWriter(w)
+		err = aw.csv.Write(accountingCSVHeader)
+	case AccountingFormatJSONL:
+		aw.json = json.NewEncoder(w)
+	default:
+		err = fmt.Errorf("unknown format %s", format)
+	}
+	return
+}
+
+// write update running total of token by delta and write r
+func (aw *accountingWriter) write(r *AccountingRecord, delta *big.Int) error {
+	total, ok := aw.totals[r.TokenAddress]
+	if !ok {
+		total = big.NewInt(0)
+		aw.totals[r.TokenAddress] = total
+	}
+	total.Add(total, delta)
+	r.TokenTotal = new(big.Int).Set(total)
+	if aw.json != nil {
+		return aw.json.Encode(r)
+	}
+	err := aw.csv.Write(r.csvRow())
+	if err != nil {
+		return err
+	}
+	aw.rows++
+	if aw.rows%accountingFlushRows == 0 {
+		aw.csv.Flush()
+		return aw.csv.Error()
+	}
+	return nil
+}
+
+func (aw *accountingWriter) flush() error {
+	if aw.csv == nil {
+		return nil
+	}
+	aw.csv.Flush()
+	return aw.csv.Error()
+}
+
+/*
+ExportAccounting write sent transfers, received transfers and mediation fees match q to w in format,
+rows are grouped by type and in the order of time in each group, SortBy, Offset and Limit of q are ignored.
+records are read from dao and written one by one, so the whole result is never kept in memory.
+*/
+func ExportAccounting(dao models.Dao, w io.Writer, format string, q *models.TransferQuery) (err error) {
+	aw, err := newAccountingWriter(w, format)
+	if err != nil {
+		return
+	}
+	err = dao.IterateSentTransfers(q, func(st *models.SentTransfer) error {
+		amount := bigOrZero(st.Amount)
+		return aw.write(&AccountingRecord{
+			Type:              AccountingTypeSent,
+			TokenAddress:      st.TokenAddress,
+			Counterparty:      st.ToAddress,
+			ChannelIdentifier: st.ChannelIdentifier,
+			Amount:            amount,
+			Fee:               big.NewInt(0),
+			LockSecretHash:    st.LockSecretHash,
+			BlockNumber:       st.BlockNumber,
+			TimeStamp:         st.TimeStamp,
+			Data:              st.Data,
+		}, new(big.Int).Neg(amount))
+	})
+	if err != nil {
+		return fmt.Errorf("export sent transfers err %s", err)
+	}
+	err = dao.IterateReceivedTransfers(q, func(rt *models.ReceivedTransfer) error {
+		amount := bigOrZero(rt.Amount)
+		return aw.write(&AccountingRecord{
+			Type:              AccountingTypeReceived,
+			TokenAddress:      rt.TokenAddress,
+			Counterparty:      rt.FromAddress,
+			ChannelIdentifier: rt.ChannelIdentifier,
+			Amount:            amount,
+			Fee:               big.NewInt(0),
+			LockSecretHash:    rt.LockSecretHash,
+			BlockNumber:       rt.BlockNumber,
+			TimeStamp:         rt.TimeStamp,
+			Data:              rt.Data,
+		}, amount)
+	})
+	if err != nil {
+		return fmt.Errorf("export received transfers err %s", err)
+	}
+	err = dao.IterateFeeChargeRecords(q, func(r *models.FeeChargeRecord) error {
+		fee := bigOrZero(r.Fee)
+		return aw.write(&AccountingRecord{
+			Type:              AccountingTypeMediationFee,
+			TokenAddress:      r.TokenAddress,
+			Counterparty:      r.TransferFrom,
+			ChannelIdentifier: r.InChannel,
+			Amount:            bigOrZero(r.TransferAmount),
+			Fee:               fee,
+			LockSecretHash:    r.LockSecretHash,
+			BlockNumber:       r.BlockNumber,
+			TimeStamp:         time.Unix(r.Timestamp, 0).Format(time.RFC3339),
+		}, fee)
+	})
+	if err != nil {
+		return fmt.Errorf("export fee charge records err %s", err)
+	}
+	return aw.flush()
+}
+
+// ExportAccounting write records of accounting to w, see ExportAccounting
+func (r *API) ExportAccounting(w io.Writer, format string, q *models.TransferQuery) error {
+	return ExportAccounting(r.Photon.dao, w, format, q)
+}
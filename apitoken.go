@@ -0,0 +1,84 @@
+package photon
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// api token 的前缀,方便用户识别
+const apiTokenSecretPrefix = "photon_"
+
+var errInvalidAPIToken = errors.New("invalid api token")
+
+/*
+NewAPIToken create an api token with scopes and spending caps,
+the secret is returned only once and cannot be recovered.
+*/
+func (r *API) NewAPIToken(name string, scopes models.APITokenScope, caps map[common.Address]*big.Int) (t *models.APIToken, secret string, err error) {
+	if !scopes.IsValid() {
+		err = fmt.Errorf("invalid scopes %d", scopes)
+		return
+	}
+	for token, limit := range caps {
+		if limit == nil || limit.Sign() < 0 {
+			err = fmt.Errorf("invalid spending cap of token %s", token.String())
+			return
+		}
+	}
+	secret = apiTokenSecretPrefix + hex.EncodeToString(utils.Random(32))
+	t = &models.APIToken{
+		ID:           models.APITokenID(secret),
+		Name:         name,
+		Scopes:       scopes,
+		SecretHash:   models.APITokenSecretHash(secret),
+		SpendingCaps: caps,
+		CreateTime:   time.Now().Unix(),
+	}
+	err = r.Photon.dao.NewAPIToken(t)
+	return
+}
+
+// GetAPITokens all api tokens without secret
+func (r *API) GetAPITokens() ([]*models.APIToken, error) {
+	return r.Photon.dao.GetAllAPITokens()
+}
+
+// RemoveAPIToken :
+func (r *API) RemoveAPIToken(id string) error {
+	return r.Photon.dao.RemoveAPIToken(id)
+}
+
+// HasAPIToken api is open to everyone if there is no api token and no username/password
+func (r *API) HasAPIToken() bool {
+	return r.Photon.dao.HasAPIToken()
+}
+
+// AuthAPIToken returns the api token of secret
+func (r *API) AuthAPIToken(secret string) (*models.APIToken, error) {
+	if !strings.HasPrefix(secret, apiTokenSecretPrefix) {
+		return nil, errInvalidAPIToken
+	}
+	t, err := r.Photon.dao.GetAPIToken(models.APITokenID(secret))
+	if err != nil || !t.MatchSecret(secret) {
+		return nil, errInvalidAPIToken
+	}
+	return t, nil
+}
+
+// SpendAPIToken check and record amount of transfer sent by api token
+func (r *API) SpendAPIToken(t *models.APIToken, token common.Address, amount *big.Int) error {
+	return r.Photon.dao.SpendAPIToken(t.ID, token, amount)
+}
+
+// RefundAPIToken give back amount recorded by SpendAPIToken when the transfer is not sent or failed
+func (r *API) RefundAPIToken(t *models.APIToken, token common.Address, amount *big.Int) error {
+	return r.Photon.dao.RefundAPIToken(t.ID, token, amount)
+}
@@ -0,0 +1,262 @@
+package photon
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+
+	"github.com/SmartMeshFoundation/Photon/channel"
+	"github.com/SmartMeshFoundation/Photon/channel/channeltype"
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	autoActionUnlock = "unlock"
+	autoActionSettle = "settle"
+)
+
+const (
+	autoStatusWaiting = "waiting"
+	autoStatusRunning = "running"
+	autoStatusFailed  = "failed"
+	// 对方的 balance proof 还没有提交到链上, 无法 unlock
+	autoStatusWaitingBalanceProof = "waiting_balance_proof"
+)
+
+// AutoSettleAction : an automatic action will be taken on a closed channel
+type AutoSettleAction struct {
+	ChannelIdentifier common.Hash    `json:"channel_identifier"`
+	TokenAddress      common.Address `json:"token_address"`
+	PartnerAddress    common.Address `json:"partner_address"`
+	Action            string         `json:"action"`       // unlock or settle
+	BlockNumber       int64          `json:"block_number"` // action will be taken at this block
+	Status            string         `json:"status"`       // waiting,running,failed or waiting_balance_proof
+}
+
+// AutoSettleSchedule : all upcoming automatic actions
+type AutoSettleSchedule struct {
+	Enabled     bool                `json:"enabled"`
+	BlockNumber int64               `json:"block_number"`
+	Actions     []*AutoSettleAction `json:"actions"`
+}
+
+/*
+autoSettler 在每个新块检查所有已关闭的通道,settle 期过了以后自动 settle.
+ 1. 合约只允许在 settle_block_number 之前(含)unlock, 所以通道关闭并且链上注册了密码以后立即 unlock 对方的锁,
+    失败以后间隔 params.AutoSettleRetryBlocks 块重试, 最后一次在 settle_block_number 尝试.
+    Channel.HandleClosed 等已经在 unlock 的时候不会重复提交, ExternalState 记录了正在 unlock 的锁
+ 2. 合约只允许在 settle_block_number+params.PunishBlockNumber 之后 settle,
+    并且要等所有的 unlock 结束: 成功(UnlockThisLock 已经记录), 或者已经过了 unlock 期无法再 unlock
+ 3. settle 失败以后间隔 params.AutoSettleRetryBlocks 块重试, 成功以后等待链上的 settle 事件删除通道
+
+onBlock 在 Photon 主线程中调用, unlock/settle 的结果在其他 goroutine 中返回,所以需要加锁.
+*/
+type autoSettler struct {
+	rs               *Service
+	lock             sync.Mutex
+	running          map[common.Hash]string // 正在进行的动作
+	unlockRetryBlock map[common.Hash]int64  // unlock 失败以后,下次尝试的块
+	settleRetryBlock map[common.Hash]int64  // settle 失败以后,下次尝试的块
+	schedule         *AutoSettleSchedule
+}
+
+func newAutoSettler(rs *Service) *autoSettler {
+	return &autoSettler{
+		rs:               rs,
+		running:          make(map[common.Hash]string),
+		unlockRetryBlock: make(map[common.Hash]int64),
+		settleRetryBlock: make(map[common.Hash]int64),
+		schedule:         &AutoSettleSchedule{Enabled: rs.Config.AutoSettle},
+	}
+}
+
+// unlockProofs locks of partner whose secret registered on chain and not unlocked yet
+func (as *autoSettler) unlockProofs(c *channel.Channel) (proofs []*channeltype.UnlockProof) {
+	for _, p := range c.PartnerState.GetCanUnlockOnChainLocks() {
+		if as.rs.dao.IsThisLockHasUnlocked(c.ChannelIdentifier.ChannelIdentifier, p.Lock.LockSecretHash) {
+			continue
+		}
+		proofs = append(proofs, p)
+	}
+	return
+}
+
+// partnerBalanceProofOnChain 合约只能 unlock 链上 balance proof 中的锁, 关闭方提交的是对方的 balance proof, 非关闭方要等 updateBalanceProof
+func partnerBalanceProofOnChain(c *channel.Channel) bool {
+	bp := c.PartnerState.BalanceProofState
+	return bp != nil && bp.ContractLocksRoot == bp.LocksRoot
+}
+
+/*
+nextAction decides what to do next on closed channel id.
+settleBlockNumber is settle_block_number of contract,
+pendingUnlocks is number of locks which can be unlocked,
+balanceProofOnChain is whether they can be unlocked on chain now.
+*/
+func (as *autoSettler) nextAction(id common.Hash, blockNumber, settleBlockNumber int64, pendingUnlocks int, balanceProofOnChain bool) (action, status string, actionBlock int64) {
+	if pendingUnlocks > 0 && blockNumber <= settleBlockNumber {
+		action = autoActionUnlock
+		actionBlock = blockNumber
+		status = autoStatusWaiting
+		if !balanceProofOnChain {
+			status = autoStatusWaitingBalanceProof
+		} else if retry := as.unlockRetryBlock[id]; retry > 0 {
+			status = autoStatusFailed
+			if retry > actionBlock {
+				actionBlock = retry
+			}
+			//最后一次机会
+			if actionBlock > settleBlockNumber {
+				actionBlock = settleBlockNumber
+			}
+		}
+	} else {
+		action = autoActionSettle
+		status = autoStatusWaiting
+		//合约要求块数大于 settle_block_number+punish_block_number
+		actionBlock = settleBlockNumber + params.PunishBlockNumber + 1
+		if retry := as.settleRetryBlock[id]; retry > 0 {
+			status = autoStatusFailed
+			if retry > actionBlock {
+				actionBlock = retry
+			}
+		}
+	}
+	//unlock 和 settle 都要等之前的动作结束
+	if as.running[id] != "" {
+		action = as.running[id]
+		status = autoStatusRunning
+	}
+	return
+}
+
+func (as *autoSettler) onBlock(blockNumber int64) {
+	enabled := as.rs.Config.AutoSettle
+	schedule := &AutoSettleSchedule{
+		Enabled:     enabled,
+		BlockNumber: blockNumber,
+	}
+	//通过 connection manager 退出的 token 网络,即使没有打开 auto settle 也要 settle
+	leaving := as.rs.ConnectionManager.leavingTokens()
+	as.lock.Lock()
+	defer as.lock.Unlock()
+	closed := make(map[common.Hash]bool)
+	for _, g := range as.rs.Token2ChannelGraph {
+		for _, c := range g.ChannelIdentifier2Channel {
+			if c.State != channeltype.StateClosed {
+				continue
+			}
+			id := c.ChannelIdentifier.ChannelIdentifier
+			closed[id] = true
+			proofs := as.unlockProofs(c)
+			action, status, actionBlock := as.nextAction(id, blockNumber, c.GetSettleExpiration(blockNumber), len(proofs), partnerBalanceProofOnChain(c))
+			if action == autoActionUnlock && c.ExternState.IsUnlocking() {
+				//关闭通道或者 updateBalanceProof 以后已经开始 unlock 了, 等它结束, 失败的锁由我重试
+				status = autoStatusRunning
+			}
+			schedule.Actions = append(schedule.Actions, &AutoSettleAction{
+				ChannelIdentifier: id,
+				TokenAddress:      c.TokenAddress,
+				PartnerAddress:    c.PartnerState.Address,
+				Action:            action,
+				BlockNumber:       actionBlock,
+				Status:            status,
+			})
+			if !(enabled || leaving[c.TokenAddress]) || status == autoStatusRunning || status == autoStatusWaitingBalanceProof || blockNumber < actionBlock {
+				continue
+			}
+			if action == autoActionUnlock {
+				as.startUnlock(c, proofs, blockNumber)
+			} else {
+				if len(proofs) > 0 {
+					log.Error(fmt.Sprintf("auto settle: %d locks on channel %s cannot be unlocked after settle_block_number", len(proofs), id.String()))
+				}
+				as.startSettle(c, blockNumber)
+			}
+			schedule.Actions[len(schedule.Actions)-1].Status = autoStatusRunning
+		}
+	}
+	//通道已经 settle 并且删除了
+	for id := range as.running {
+		if !closed[id] {
+			delete(as.running, id)
+		}
+	}
+	for id := range as.unlockRetryBlock {
+		if !closed[id] {
+			delete(as.unlockRetryBlock, id)
+		}
+	}
+	for id := range as.settleRetryBlock {
+		if !closed[id] {
+			delete(as.settleRetryBlock, id)
+		}
+	}
+	sort.Slice(schedule.Actions, func(i, j int) bool {
+		return schedule.Actions[i].BlockNumber < schedule.Actions[j].BlockNumber
+	})
+	as.schedule = schedule
+}
+
+func (as *autoSettler) startUnlock(c *channel.Channel, proofs []*channeltype.UnlockProof, blockNumber int64) {
+	id := c.ChannelIdentifier.ChannelIdentifier
+	log.Info(fmt.Sprintf("auto settle: unlock %d locks on channel %s at block %d", len(proofs), id.String(), blockNumber))
+	as.running[id] = autoActionUnlock
+	transferAmount := big.NewInt(0)
+	if c.PartnerState.BalanceProofState.ContractTransferAmount != nil {
+		transferAmount.Set(c.PartnerState.BalanceProofState.ContractTransferAmount)
+	}
+	result := c.ExternState.Unlock(proofs, transferAmount)
+	go func() {
+		as.unlockDone(id, blockNumber, <-result.Result)
+	}()
+}
+
+// unlockDone 成功 unlock 的锁已经由 ExternalState.Unlock 记录, 剩下的锁稍后重试
+func (as *autoSettler) unlockDone(id common.Hash, blockNumber int64, err error) {
+	as.lock.Lock()
+	defer as.lock.Unlock()
+	delete(as.running, id)
+	if err != nil {
+		log.Error(fmt.Sprintf("auto settle: unlock on channel %s err %s", id.String(), err))
+		as.unlockRetryBlock[id] = blockNumber + params.AutoSettleRetryBlocks
+		return
+	}
+	delete(as.unlockRetryBlock, id)
+}
+
+func (as *autoSettler) startSettle(c *channel.Channel, blockNumber int64) {
+	id := c.ChannelIdentifier.ChannelIdentifier
+	log.Info(fmt.Sprintf("auto settle: settle channel %s at block %d", id.String(), blockNumber))
+	as.running[id] = autoActionSettle
+	result := c.Settle()
+	go func() {
+		as.settleDone(id, blockNumber, <-result.Result)
+	}()
+}
+
+// settleDone 成功以后等待 settle 事件删除通道, 失败以后稍后重试
+func (as *autoSettler) settleDone(id common.Hash, blockNumber int64, err error) {
+	if err == nil {
+		return
+	}
+	log.Error(fmt.Sprintf("auto settle: settle channel %s err %s", id.String(), err))
+	as.lock.Lock()
+	defer as.lock.Unlock()
+	delete(as.running, id)
+	as.settleRetryBlock[id] = blockNumber + params.AutoSettleRetryBlocks
+}
+
+func (as *autoSettler) getSchedule() *AutoSettleSchedule {
+	as.lock.Lock()
+	defer as.lock.Unlock()
+	return as.schedule
+}
+
+// GetAutoSettleSchedule upcoming automatic unlock and settle of closed channels
+func (r *API) GetAutoSettleSchedule() *AutoSettleSchedule {
+	return r.Photon.AutoSettler.getSchedule()
+}
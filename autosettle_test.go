@@ -0,0 +1,96 @@
+package photon
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAutoSettleSchedule(t *testing.T) {
+	as := newAutoSettler(&Service{Config: &params.Config{AutoSettle: true}})
+	id := utils.NewRandomHash()
+	//第 100 块关闭, settle_timeout 50
+	settleBlockNumber := int64(150)
+	settleBlock := settleBlockNumber + params.PunishBlockNumber + 1
+
+	//没有需要 unlock 的锁
+	action, status, block := as.nextAction(id, 101, settleBlockNumber, 0, true)
+	assert.EqualValues(t, autoActionSettle, action)
+	assert.EqualValues(t, autoStatusWaiting, status)
+	assert.EqualValues(t, settleBlock, block)
+
+	//密码已经注册,在 settle_block_number 之前立即 unlock
+	action, status, block = as.nextAction(id, 101, settleBlockNumber, 1, true)
+	assert.EqualValues(t, autoActionUnlock, action)
+	assert.EqualValues(t, autoStatusWaiting, status)
+	assert.EqualValues(t, 101, block)
+	action, _, block = as.nextAction(id, settleBlockNumber, settleBlockNumber, 1, true)
+	assert.EqualValues(t, autoActionUnlock, action)
+	assert.EqualValues(t, settleBlockNumber, block)
+
+	//对方的 balance proof 还没有上链,不能 unlock
+	action, status, _ = as.nextAction(id, 101, settleBlockNumber, 1, false)
+	assert.EqualValues(t, autoActionUnlock, action)
+	assert.EqualValues(t, autoStatusWaitingBalanceProof, status)
+
+	//过了 unlock 期只能 settle
+	action, _, block = as.nextAction(id, settleBlockNumber+1, settleBlockNumber, 1, true)
+	assert.EqualValues(t, autoActionSettle, action)
+	assert.EqualValues(t, settleBlock, block)
+}
+
+func TestAutoSettleUnlockBeforeSettle(t *testing.T) {
+	as := newAutoSettler(&Service{Config: &params.Config{AutoSettle: true}})
+	id := utils.NewRandomHash()
+	settleBlockNumber := int64(150)
+	settleBlock := settleBlockNumber + params.PunishBlockNumber + 1
+
+	//unlock 失败以后重试,但是不能晚于 settle_block_number
+	as.running[id] = autoActionUnlock
+	as.unlockDone(id, 101, errors.New("unlock failed"))
+	action, status, block := as.nextAction(id, 102, settleBlockNumber, 1, true)
+	assert.EqualValues(t, autoActionUnlock, action)
+	assert.EqualValues(t, autoStatusFailed, status)
+	assert.EqualValues(t, 101+params.AutoSettleRetryBlocks, block)
+	as.running[id] = autoActionUnlock
+	as.unlockDone(id, settleBlockNumber-1, errors.New("unlock failed"))
+	_, _, block = as.nextAction(id, settleBlockNumber-1, settleBlockNumber, 1, true)
+	assert.EqualValues(t, settleBlockNumber, block)
+
+	//unlock 还在进行,即使到了 settle 的块也要等待
+	as.running[id] = autoActionUnlock
+	action, status, _ = as.nextAction(id, settleBlock, settleBlockNumber, 0, true)
+	assert.EqualValues(t, autoActionUnlock, action)
+	assert.EqualValues(t, autoStatusRunning, status)
+
+	//unlock 成功以后才 settle
+	as.unlockDone(id, settleBlockNumber, nil)
+	assert.Empty(t, as.unlockRetryBlock[id])
+	action, status, block = as.nextAction(id, settleBlock, settleBlockNumber, 0, true)
+	assert.EqualValues(t, autoActionSettle, action)
+	assert.EqualValues(t, autoStatusWaiting, status)
+	assert.EqualValues(t, settleBlock, block)
+}
+
+func TestAutoSettleRetrySettle(t *testing.T) {
+	as := newAutoSettler(&Service{Config: &params.Config{AutoSettle: true}})
+	id := utils.NewRandomHash()
+	settleBlockNumber := int64(150)
+	settleBlock := settleBlockNumber + params.PunishBlockNumber + 1
+
+	as.running[id] = autoActionSettle
+	as.settleDone(id, settleBlock, errors.New("settle failed"))
+	action, status, block := as.nextAction(id, settleBlock+1, settleBlockNumber, 0, true)
+	assert.EqualValues(t, autoActionSettle, action)
+	assert.EqualValues(t, autoStatusFailed, status)
+	assert.EqualValues(t, settleBlock+params.AutoSettleRetryBlocks, block)
+
+	//成功以后等待 settle 事件删除通道,不再重试
+	as.running[id] = autoActionSettle
+	as.settleDone(id, settleBlock+params.AutoSettleRetryBlocks, nil)
+	_, status, _ = as.nextAction(id, settleBlock+2*params.AutoSettleRetryBlocks, settleBlockNumber, 0, true)
+	assert.EqualValues(t, autoStatusRunning, status)
+}
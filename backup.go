@@ -0,0 +1,410 @@
+package photon
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/channel"
+	"github.com/SmartMeshFoundation/Photon/channel/channeltype"
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/network/rpc"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/transfer/mtree"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// ChannelBackupFileName name of backup file in the directory of db
+const ChannelBackupFileName = "channel.backup"
+
+const channelBackupVersion = 1
+
+/*
+ChannelBackup :
+everything needed to close or settle channels on chain after db is lost,
+includes balance proofs, locks and known secrets of every channel.
+*/
+type ChannelBackup struct {
+	Version         int
+	NodeAddress     common.Address
+	RegistryAddress common.Address
+	ChainID         int64
+	CreateTime      int64
+	Tokens          models.AddressMap
+	Channels        []*channeltype.Serialization
+}
+
+// channelBackupKey 备份文件的加密密钥由私钥导出,只有节点自己能解密
+func channelBackupKey(key *ecdsa.PrivateKey) []byte {
+	h := utils.Sha3(crypto.FromECDSA(key), []byte("photon channel backup"))
+	return h[:]
+}
+
+// EncryptChannelBackup encrypt backup with AES-GCM, key is derived from private key of node
+func EncryptChannelBackup(b *ChannelBackup, key *ecdsa.PrivateKey) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	err := gob.NewEncoder(buf).Encode(b)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(channelBackupKey(key))
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, buf.Bytes(), nil), nil
+}
+
+// DecryptChannelBackup decrypt backup created by EncryptChannelBackup with the same private key
+func DecryptChannelBackup(data []byte, key *ecdsa.PrivateKey) (*ChannelBackup, error) {
+	block, err := aes.NewCipher(channelBackupKey(key))
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("invalid channel backup")
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt channel backup err %s, is it created by this account?", err)
+	}
+	b := new(ChannelBackup)
+	err = gob.NewDecoder(bytes.NewReader(plain)).Decode(b)
+	if err != nil {
+		return nil, err
+	}
+	if b.Version != channelBackupVersion {
+		return nil, fmt.Errorf("unsupported channel backup version %d", b.Version)
+	}
+	return b, nil
+}
+
+/*
+channelBackupManager 通道的 BalanceProof,锁,密码有任何变化,都重写备份文件,
+然后复制到 Config.BackupDir, 上传到 Config.BackupURL.
+数据库的回调不能阻塞,所以只记录下最新的通道,由 loop 合并多次变化以后写文件.
+*/
+type channelBackupManager struct {
+	rs       *Service
+	path     string
+	lock     sync.Mutex
+	channels map[string]*channeltype.Serialization
+	dirty    chan struct{}
+}
+
+func newChannelBackupManager(rs *Service) *channelBackupManager {
+	return &channelBackupManager{
+		rs:       rs,
+		path:     filepath.Join(filepath.Dir(rs.Config.DataBasePath), ChannelBackupFileName),
+		channels: make(map[string]*channeltype.Serialization),
+		dirty:    make(chan struct{}, 1),
+	}
+}
+
+func (bm *channelBackupManager) start() error {
+	chs, err := bm.rs.dao.GetChannelList(utils.EmptyAddress, utils.EmptyAddress)
+	if err != nil {
+		return err
+	}
+	bm.lock.Lock()
+	for _, c := range chs {
+		bm.channels[string(c.Key)] = c
+	}
+	bm.lock.Unlock()
+	bm.rs.dao.RegisterNewChannelCallback(bm.onChannelUpdated)
+	bm.rs.dao.RegisterChannelUpdateCallback(bm.onChannelUpdated)
+	bm.rs.dao.RegisterChannelSettleCallback(func(c *channeltype.Serialization) (remove bool) {
+		bm.lock.Lock()
+		delete(bm.channels, string(c.Key))
+		bm.lock.Unlock()
+		bm.notify()
+		return false
+	})
+	bm.notify()
+	go bm.loop()
+	return nil
+}
+
+func (bm *channelBackupManager) onChannelUpdated(c *channeltype.Serialization) (remove bool) {
+	bm.lock.Lock()
+	bm.channels[string(c.Key)] = c
+	bm.lock.Unlock()
+	bm.notify()
+	return false
+}
+
+func (bm *channelBackupManager) notify() {
+	select {
+	case bm.dirty <- struct{}{}:
+	default:
+	}
+}
+
+func (bm *channelBackupManager) loop() {
+	for {
+		select {
+		case <-bm.dirty:
+			err := bm.write()
+			if err != nil {
+				log.Error(fmt.Sprintf("write channel backup err %s", err))
+			}
+		case <-bm.rs.quitChan:
+			return
+		}
+	}
+}
+
+func (bm *channelBackupManager) snapshot() *ChannelBackup {
+	b := &ChannelBackup{
+		Version:         channelBackupVersion,
+		NodeAddress:     bm.rs.NodeAddress,
+		RegistryAddress: bm.rs.Config.RegistryAddress,
+		ChainID:         params.ChainID.Int64(),
+		CreateTime:      time.Now().Unix(),
+	}
+	tokens, err := bm.rs.dao.GetAllTokens()
+	if err != nil {
+		log.Error(fmt.Sprintf("GetAllTokens err %s", err))
+	}
+	b.Tokens = tokens
+	bm.lock.Lock()
+	for _, c := range bm.channels {
+		b.Channels = append(b.Channels, c)
+	}
+	bm.lock.Unlock()
+	sort.Slice(b.Channels, func(i, j int) bool {
+		return bytes.Compare(b.Channels[i].Key, b.Channels[j].Key) < 0
+	})
+	return b
+}
+
+func (bm *channelBackupManager) write() error {
+	data, err := EncryptChannelBackup(bm.snapshot(), bm.rs.PrivateKey)
+	if err != nil {
+		return err
+	}
+	err = writeFileAtomic(bm.path, data)
+	if err != nil {
+		return err
+	}
+	if bm.rs.Config.BackupDir != "" {
+		name := fmt.Sprintf("%s.%s", bm.rs.NodeAddress.String(), ChannelBackupFileName)
+		err = writeFileAtomic(filepath.Join(bm.rs.Config.BackupDir, name), data)
+		if err != nil {
+			log.Error(fmt.Sprintf("copy channel backup to %s err %s", bm.rs.Config.BackupDir, err))
+		}
+	}
+	if bm.rs.Config.BackupURL != "" {
+		err = pushChannelBackup(bm.rs.Config.BackupURL, bm.rs.NodeAddress, data)
+		if err != nil {
+			log.Error(fmt.Sprintf("push channel backup to %s err %s", bm.rs.Config.BackupURL, err))
+		}
+	}
+	return nil
+}
+
+// writeFileAtomic 先写临时文件再改名,避免写到一半时崩溃损坏备份
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	err := ioutil.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func pushChannelBackup(url string, node common.Address, data []byte) error {
+	req, err := http.NewRequest(http.MethodPut, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("X-Photon-Address", node.String())
+	client := &http.Client{Timeout: params.BackupPushTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("status %s", resp.Status)
+	}
+	return nil
+}
+
+const (
+	// RestoreActionClosed channel was open, closed with the newest balance proof of partner
+	RestoreActionClosed = "closed"
+	// RestoreActionUpdated channel was closed by partner with an old balance proof, updated with the newest one
+	RestoreActionUpdated = "updated"
+	// RestoreActionNone channel was closed and balance proof on chain is the newest
+	RestoreActionNone = "none"
+	// RestoreActionGone channel doesn't exist on chain any more
+	RestoreActionGone = "gone"
+)
+
+// ChannelRestoreResult what has been done on chain for a channel in backup
+type ChannelRestoreResult struct {
+	ChannelIdentifier common.Hash
+	TokenAddress      common.Address
+	PartnerAddress    common.Address
+	Action            string
+	Unlocked          int
+	Err               error
+}
+
+/*
+RestoreChannels closes or updates balance proof of every channel in backup on chain,
+then unlocks locks of partner whose secret is known, registers the secret first if the lock is not expired.
+Channels still on chain are saved to dao, so photon started with this dao can settle them after settle timeout.
+*/
+func RestoreChannels(bcs *rpc.BlockChainService, dao models.Dao, b *ChannelBackup) (results []*ChannelRestoreResult, err error) {
+	if b.NodeAddress != bcs.NodeAddress {
+		return nil, fmt.Errorf("backup is of %s, not %s", b.NodeAddress.String(), bcs.NodeAddress.String())
+	}
+	for token, tokenNetwork := range b.Tokens {
+		err = dao.AddToken(token, tokenNetwork)
+		if err != nil {
+			return
+		}
+	}
+	for _, c := range b.Channels {
+		r := restoreChannel(bcs, dao, c)
+		results = append(results, r)
+		if r.Action == RestoreActionGone {
+			continue
+		}
+		err = dao.NewChannel(c)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func restoreChannel(bcs *rpc.BlockChainService, dao models.Dao, c *channeltype.Serialization) (r *ChannelRestoreResult) {
+	r = &ChannelRestoreResult{
+		ChannelIdentifier: c.ChannelIdentifier.ChannelIdentifier,
+		TokenAddress:      c.TokenAddress(),
+		PartnerAddress:    c.PartnerAddress(),
+	}
+	partner := c.PartnerAddress()
+	tn, err := bcs.TokenNetwork(c.TokenAddress())
+	if err != nil {
+		r.Err = err
+		return
+	}
+	id, _, openBlockNumber, state, _, err := tn.GetChannelInfo(bcs.NodeAddress, partner)
+	if err != nil {
+		r.Err = err
+		return
+	}
+	if id != c.ChannelIdentifier.ChannelIdentifier || int64(openBlockNumber) != c.ChannelIdentifier.OpenBlockNumber ||
+		(state != uint8(channeltype.StateOpened) && state != uint8(channeltype.StateClosed)) {
+		r.Action = RestoreActionGone
+		return
+	}
+	bp := c.PartnerBalanceProof
+	var nonce uint64
+	transferAmount, locksRoot, extraHash := utils.BigInt0, utils.EmptyHash, utils.EmptyHash
+	var signature []byte
+	if bp != nil && bp.Nonce > 0 {
+		nonce, transferAmount, locksRoot, extraHash, signature = bp.Nonce, bp.TransferAmount, bp.LocksRoot, bp.MessageHash, bp.Signature
+	}
+	if state == uint8(channeltype.StateOpened) {
+		r.Action = RestoreActionClosed
+		err = tn.CloseChannel(partner, transferAmount, locksRoot, nonce, extraHash, signature)
+	} else {
+		r.Action = RestoreActionNone
+		_, _, onChainNonce, err2 := tn.GetChannelParticipantInfo(partner, bcs.NodeAddress)
+		if err2 != nil {
+			r.Err = err2
+			return
+		}
+		if onChainNonce < nonce {
+			r.Action = RestoreActionUpdated
+			err = tn.UpdateBalanceProof(partner, transferAmount, locksRoot, nonce, extraHash, signature)
+		} else if onChainNonce > nonce {
+			err = fmt.Errorf("nonce %d on chain is newer than backup %d", onChainNonce, nonce)
+		}
+	}
+	if err != nil {
+		r.Err = err
+		return
+	}
+	r.Unlocked, r.Err = restoreUnlock(bcs, dao, tn, c, transferAmount)
+	return
+}
+
+func restoreUnlock(bcs *rpc.BlockChainService, dao models.Dao, tn *rpc.TokenNetworkProxy, c *channeltype.Serialization, transferAmount *big.Int) (unlocked int, err error) {
+	locks := c.PartnerLock2UnclaimedLocks()
+	if len(locks) == 0 {
+		return
+	}
+	header, err := bcs.Client.HeaderByNumber(context.Background(), nil)
+	if err != nil {
+		return
+	}
+	blockNumber := header.Number.Int64()
+	tree := mtree.NewMerkleTree(c.PartnerLeaves)
+	transferAmount = new(big.Int).Set(transferAmount)
+	for _, l := range locks {
+		registered, err2 := bcs.SecretRegistryProxy.IsSecretRegistered(l.Secret)
+		if err2 != nil {
+			err = err2
+			continue
+		}
+		if !registered {
+			//锁过期以后注册密码也没有用了
+			if l.Lock.Expiration <= blockNumber {
+				continue
+			}
+			err2 = bcs.SecretRegistryProxy.RegisterSecret(l.Secret)
+			if err2 != nil {
+				err = err2
+				continue
+			}
+		}
+		proof := channel.ComputeProofForLock(l.Lock, tree)
+		err2 = tn.Unlock(c.PartnerAddress(), transferAmount, l.Lock, mtree.Proof2Bytes(proof.MerkleProof))
+		if err2 != nil {
+			err = err2
+			continue
+		}
+		//避免启动以后处理关闭事件时再次 unlock
+		dao.UnlockThisLock(c.ChannelIdentifier.ChannelIdentifier, l.Lock.LockSecretHash)
+		unlocked++
+		transferAmount.Add(transferAmount, l.Lock.Amount)
+	}
+	return
+}
@@ -0,0 +1,47 @@
+package photon
+
+import (
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/channel/channeltype"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/network/rpc/contracts"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChannelBackupEncrypt(t *testing.T) {
+	key, addr := utils.MakePrivateKeyAddress()
+	token := utils.NewRandomAddress()
+	c := &channeltype.Serialization{
+		Key:               utils.NewRandomHash().Bytes(),
+		ChannelIdentifier: &contracts.ChannelUniqueID{ChannelIdentifier: utils.NewRandomHash(), OpenBlockNumber: 3},
+		SettleTimeout:     100,
+	}
+	b := &ChannelBackup{
+		Version:         channelBackupVersion,
+		NodeAddress:     addr,
+		RegistryAddress: utils.NewRandomAddress(),
+		ChainID:         8888,
+		Tokens:          models.AddressMap{token: utils.NewRandomAddress()},
+		Channels:        []*channeltype.Serialization{c},
+	}
+	data, err := EncryptChannelBackup(b, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b2, err := DecryptChannelBackup(data, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.EqualValues(t, b.NodeAddress, b2.NodeAddress)
+	assert.EqualValues(t, b.Tokens, b2.Tokens)
+	assert.EqualValues(t, 1, len(b2.Channels))
+	assert.EqualValues(t, c.ChannelIdentifier, b2.Channels[0].ChannelIdentifier)
+	//其他账户不能解密
+	key2, _ := utils.MakePrivateKeyAddress()
+	_, err = DecryptChannelBackup(data, key2)
+	assert.NotEmpty(t, err)
+	_, err = DecryptChannelBackup(data[:5], key)
+	assert.NotEmpty(t, err)
+}
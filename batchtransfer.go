@@ -0,0 +1,263 @@
+package photon
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/utils"
+)
+
+const (
+	// DefaultBatchTransferConcurrency 批量交易默认同时进行的交易数
+	DefaultBatchTransferConcurrency = 5
+	// MaxBatchTransferConcurrency 批量交易最多同时进行的交易数
+	MaxBatchTransferConcurrency = 50
+	// MaxBatchTransferItems 一个批量交易最多包含的交易数
+	MaxBatchTransferItems = 10000
+)
+
+/*
+batchTransferRunner runs transfers of a batch, all changes of batch are saved to db immediately.
+*/
+type batchTransferRunner struct {
+	rs      *Service
+	b       *models.BatchTransfer
+	lock    sync.Mutex
+	stopped bool
+}
+
+// update change b and save it
+func (br *batchTransferRunner) update(fn func(b *models.BatchTransfer)) {
+	br.lock.Lock()
+	defer br.lock.Unlock()
+	fn(br.b)
+	err := br.rs.dao.SaveBatchTransfer(br.b)
+	if err != nil {
+		log.Error(fmt.Sprintf("SaveBatchTransfer %s err %s", br.b.ID, err))
+	}
+}
+
+func (br *batchTransferRunner) isStopped() bool {
+	br.lock.Lock()
+	defer br.lock.Unlock()
+	return br.stopped
+}
+
+func (br *batchTransferRunner) isQuit() bool {
+	select {
+	case <-br.rs.quitChan:
+		return true
+	default:
+		return false
+	}
+}
+
+// transfer start transfer of item through UserReqChan and wait its result
+func (br *batchTransferRunner) transfer(item *models.BatchTransferItem) {
+	if br.rs.StopCreateNewTransfers {
+		br.fail(item, errors.New("Stop create new transfers, please restart photon"))
+		return
+	}
+	result := br.rs.transferAsyncClient(item.TokenAddress, item.Amount, item.Fee, item.TargetAddress, utils.EmptyHash, false, item.Data)
+	br.update(func(b *models.BatchTransfer) {
+		item.Status = models.BatchTransferItemProcessing
+		item.LockSecretHash = result.LockSecretHash
+	})
+	var err error
+	select {
+	case err = <-result.Result:
+	case <-br.rs.quitChan:
+		return
+	}
+	if err != nil {
+		br.fail(item, err)
+		return
+	}
+	br.update(func(b *models.BatchTransfer) {
+		item.Status = models.BatchTransferItemSuccess
+	})
+}
+
+func (br *batchTransferRunner) fail(item *models.BatchTransferItem, err error) {
+	br.update(func(b *models.BatchTransfer) {
+		item.Status = models.BatchTransferItemFailed
+		item.Error = err.Error()
+		if b.StopOnFailure {
+			br.stopped = true
+		}
+	})
+}
+
+func (br *batchTransferRunner) run() {
+	sem := make(chan struct{}, br.b.Concurrency)
+	wg := sync.WaitGroup{}
+	for _, item := range br.b.Items {
+		select {
+		case sem <- struct{}{}:
+		case <-br.rs.quitChan:
+			return
+		}
+		if br.isStopped() {
+			break
+		}
+		wg.Add(1)
+		go func(item *models.BatchTransferItem) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			br.transfer(item)
+		}(item)
+	}
+	wg.Wait()
+	if br.isQuit() {
+		// photon is stopping, the batch will be marked interrupted after restart
+		return
+	}
+	br.update(func(b *models.BatchTransfer) {
+		b.Status = models.BatchTransferFinished
+		if br.stopped {
+			b.Status = models.BatchTransferStopped
+			for _, item := range b.Items {
+				if item.Status == models.BatchTransferItemPending {
+					item.Status = models.BatchTransferItemSkipped
+				}
+			}
+		}
+		b.FinishTime = time.Now().Unix()
+	})
+	br.rs.refundBatchTransfer(br.b)
+	log.Info(fmt.Sprintf("batch transfer %s %s", br.b.ID, br.b.Status))
+}
+
+/*
+interruptBatchTransfers marks batches running when photon stopped last time as interrupted,
+items processing may have finished, check them by lock secret hash.
+*/
+func (rs *Service) interruptBatchTransfers() error {
+	bs, err := rs.dao.GetAllBatchTransfers()
+	if err != nil {
+		return err
+	}
+	for _, b := range bs {
+		if b.Status != models.BatchTransferRunning {
+			continue
+		}
+		for _, item := range b.Items {
+			switch item.Status {
+			case models.BatchTransferItemPending:
+				item.Status = models.BatchTransferItemSkipped
+			case models.BatchTransferItemProcessing:
+				item.Status = models.BatchTransferItemUnknown
+			}
+		}
+		b.Status = models.BatchTransferInterrupted
+		b.FinishTime = time.Now().Unix()
+		err = rs.dao.SaveBatchTransfer(b)
+		if err != nil {
+			return err
+		}
+		rs.refundBatchTransfer(b)
+	}
+	return nil
+}
+
+/*
+refundBatchTransfer gives back amounts of items failed or skipped to the api token which started the batch,
+items unknown may have been sent, they are kept as spent.
+*/
+func (rs *Service) refundBatchTransfer(b *models.BatchTransfer) {
+	if b.APITokenID == "" {
+		return
+	}
+	for _, item := range b.Items {
+		if item.Status != models.BatchTransferItemFailed && item.Status != models.BatchTransferItemSkipped {
+			continue
+		}
+		amount := new(big.Int).Add(item.Amount, item.Fee)
+		err := rs.dao.RefundAPIToken(b.APITokenID, item.TokenAddress, amount)
+		if err != nil {
+			log.Error(fmt.Sprintf("batch transfer %s RefundAPIToken err %s", b.ID, err))
+		}
+	}
+}
+
+/*
+BatchTransfer starts transfers of items in background and returns id of the batch immediately,
+at most concurrency transfers are processing at the same time,
+if stopOnFailure, items not started are skipped after the first failure.
+apiTokenID is the api token which has spent amounts of all items, empty if not started by api token.
+*/
+func (r *API) BatchTransfer(items []*models.BatchTransferItem, concurrency int, stopOnFailure bool, apiTokenID string) (id string, err error) {
+	if r.Photon.StopCreateNewTransfers {
+		err = errors.New("Stop create new transfers, please restart photon")
+		return
+	}
+	if len(items) == 0 || len(items) > MaxBatchTransferItems {
+		err = fmt.Errorf("number of transfers must between 1 and %d", MaxBatchTransferItems)
+		return
+	}
+	if concurrency == 0 {
+		concurrency = DefaultBatchTransferConcurrency
+	}
+	if concurrency < 0 || concurrency > MaxBatchTransferConcurrency {
+		err = fmt.Errorf("concurrency must between 1 and %d", MaxBatchTransferConcurrency)
+		return
+	}
+	for i, item := range items {
+		if item.Amount == nil || item.Amount.Cmp(utils.BigInt0) <= 0 {
+			err = fmt.Errorf("invalid amount of transfer %d", i)
+			return
+		}
+		if item.Fee == nil {
+			item.Fee = big.NewInt(0)
+		}
+		if item.Fee.Cmp(utils.BigInt0) < 0 {
+			err = fmt.Errorf("invalid fee of transfer %d", i)
+			return
+		}
+		if len(item.Data) > params.MaxTransferDataLen {
+			err = fmt.Errorf("invalid data of transfer %d, length must < %d", i, params.MaxTransferDataLen)
+			return
+		}
+		item.Status = models.BatchTransferItemPending
+		item.LockSecretHash = utils.EmptyHash
+		item.Error = ""
+	}
+	b := &models.BatchTransfer{
+		ID:            hex.EncodeToString(utils.Random(8)),
+		Concurrency:   concurrency,
+		StopOnFailure: stopOnFailure,
+		Status:        models.BatchTransferRunning,
+		Items:         items,
+		CreateTime:    time.Now().Unix(),
+		APITokenID:    apiTokenID,
+	}
+	err = r.Photon.dao.SaveBatchTransfer(b)
+	if err != nil {
+		return
+	}
+	br := &batchTransferRunner{
+		rs: r.Photon,
+		b:  b,
+	}
+	go br.run()
+	return b.ID, nil
+}
+
+// GetBatchTransfer batch with status of all items
+func (r *API) GetBatchTransfer(id string) (*models.BatchTransfer, error) {
+	return r.Photon.dao.GetBatchTransfer(id)
+}
+
+// GetBatchTransfers all batches
+func (r *API) GetBatchTransfers() ([]*models.BatchTransfer, error) {
+	return r.Photon.dao.GetAllBatchTransfers()
+}
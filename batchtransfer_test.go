@@ -0,0 +1,73 @@
+package photon
+
+import (
+	"math/big"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/codefortest"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInterruptBatchTransfersRefund(t *testing.T) {
+	dbPath := path.Join(os.TempDir(), "batchtransfer_test.db")
+	err := os.RemoveAll(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dao := codefortest.NewTestDB(dbPath)
+	defer dao.CloseDB()
+	token := utils.NewRandomAddress()
+	at := &models.APIToken{
+		ID:           "test",
+		Scopes:       models.APITokenScopeTransfer,
+		SpendingCaps: map[common.Address]*big.Int{token: big.NewInt(100)},
+	}
+	err = dao.NewAPIToken(at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 四笔交易的额度在开始之前已经扣除
+	err = dao.SpendAPIToken(at.ID, token, big.NewInt(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newItem := func(amount int64, status models.BatchTransferItemStatus) *models.BatchTransferItem {
+		return &models.BatchTransferItem{
+			TokenAddress: token,
+			Amount:       big.NewInt(amount),
+			Fee:          big.NewInt(1),
+			Status:       status,
+		}
+	}
+	b := &models.BatchTransfer{
+		ID:     "batch",
+		Status: models.BatchTransferRunning,
+		Items: []*models.BatchTransferItem{
+			newItem(9, models.BatchTransferItemSuccess),
+			newItem(19, models.BatchTransferItemFailed),
+			newItem(29, models.BatchTransferItemProcessing),
+			newItem(39, models.BatchTransferItemPending),
+		},
+		APITokenID: at.ID,
+	}
+	err = dao.SaveBatchTransfer(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs := &Service{dao: dao}
+	err = rs.interruptBatchTransfers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	//失败和跳过的退还, 状态未知的可能已经发出, 不退还
+	at2, err := dao.GetAPIToken(at.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.EqualValues(t, 40, at2.Spent[token].Int64())
+}
@@ -0,0 +1,204 @@
+package blockchain
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/network/rpc/contracts"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func newContractEvent(eventName string, l *types.Log) *models.ContractEvent {
+	return &models.ContractEvent{
+		Key:         models.ContractEventKey(l.TxHash, l.Index),
+		EventName:   eventName,
+		BlockNumber: int64(l.BlockNumber),
+		TxHash:      l.TxHash,
+		LogIndex:    l.Index,
+	}
+}
+
+/*
+toContractEvent convert contract event to the record saved in local cache,
+token and participants missing in the event are filled by dao according to ChannelOpenedAndDeposit.
+*/
+func toContractEvent(ev interface{}) (e *models.ContractEvent) {
+	switch ev2 := ev.(type) {
+	case *contracts.TokensNetworkTokenNetworkCreated:
+		e = newContractEvent(params.NameTokenNetworkCreated, &ev2.Raw)
+		e.TokenAddress = ev2.TokenAddress
+	case *contracts.SecretRegistrySecretRevealed:
+		e = newContractEvent(params.NameSecretRevealed, &ev2.Raw)
+		e.Secret = ev2.Secret
+		e.LockSecretHash = utils.ShaSecret(ev2.Secret[:])
+	case *contracts.TokensNetworkChannelOpenedAndDeposit:
+		e = newContractEvent(params.NameChannelOpenedAndDeposit, &ev2.Raw)
+		e.TokenAddress = ev2.Token
+		e.ChannelIdentifier = calcChannelID(ev2.Token, ev2.Raw.Address, ev2.Participant, ev2.Partner)
+		e.Participant1 = ev2.Participant
+		e.Participant2 = ev2.Partner
+		e.Participant = ev2.Participant
+		e.Amount = ev2.Participant1Deposit
+		e.SettleTimeout = int(ev2.SettleTimeout)
+	case *contracts.TokensNetworkChannelNewDeposit:
+		e = newContractEvent(params.NameChannelNewDeposit, &ev2.Raw)
+		e.ChannelIdentifier = ev2.ChannelIdentifier
+		e.Participant = ev2.Participant
+		e.Amount = ev2.TotalDeposit
+	case *contracts.TokensNetworkChannelClosed:
+		e = newContractEvent(params.NameChannelClosed, &ev2.Raw)
+		e.ChannelIdentifier = ev2.ChannelIdentifier
+		e.Participant = ev2.ClosingParticipant
+		e.Locksroot = ev2.Locksroot
+		e.Amount = ev2.TransferredAmount
+	case *contracts.TokensNetworkChannelUnlocked:
+		e = newContractEvent(params.NameChannelUnlocked, &ev2.Raw)
+		e.ChannelIdentifier = ev2.ChannelIdentifier
+		e.Participant = ev2.PayerParticipant
+		e.LockHash = ev2.Lockhash
+		e.Amount = ev2.TransferredAmount
+	case *contracts.TokensNetworkBalanceProofUpdated:
+		e = newContractEvent(params.NameBalanceProofUpdated, &ev2.Raw)
+		e.ChannelIdentifier = ev2.ChannelIdentifier
+		e.Participant = ev2.Participant
+		e.Locksroot = ev2.Locksroot
+		e.Amount = ev2.TransferredAmount
+	case *contracts.TokensNetworkChannelPunished:
+		e = newContractEvent(params.NameChannelPunished, &ev2.Raw)
+		e.ChannelIdentifier = ev2.ChannelIdentifier
+		e.Participant = ev2.Beneficiary
+	case *contracts.TokensNetworkChannelSettled:
+		e = newContractEvent(params.NameChannelSettled, &ev2.Raw)
+		e.ChannelIdentifier = ev2.ChannelIdentifier
+		e.Participant1Amount = ev2.Participant1Amount
+		e.Participant2Amount = ev2.Participant2Amount
+	case *contracts.TokensNetworkChannelCooperativeSettled:
+		e = newContractEvent(params.NameChannelCooperativeSettled, &ev2.Raw)
+		e.ChannelIdentifier = ev2.ChannelIdentifier
+		e.Participant1Amount = ev2.Participant1Amount
+		e.Participant2Amount = ev2.Participant2Amount
+	case *contracts.TokensNetworkChannelWithdraw:
+		e = newContractEvent(params.NameChannelWithdraw, &ev2.Raw)
+		e.ChannelIdentifier = ev2.ChannelIdentifier
+		e.Participant1 = ev2.Participant1
+		e.Participant2 = ev2.Participant2
+		e.Participant1Amount = ev2.Participant1Balance
+		e.Participant2Amount = ev2.Participant2Balance
+	}
+	return
+}
+
+/*
+parseContractEvents convert logs to records saved in local cache,
+different from parseLogsToEvents, nothing is sent to photon and txDone is not touched,
+so it can be used for logs of history blocks.
+*/
+func parseContractEvents(logs []types.Log) (es []*models.ContractEvent, err error) {
+	for i := range logs {
+		l := &logs[i]
+		var ev interface{}
+		switch topicToEventName[l.Topics[0]] {
+		case params.NameTokenNetworkCreated:
+			ev, err = newEventTokenNetworkCreated(l)
+		case params.NameSecretRevealed:
+			ev, err = newEventSecretRevealed(l)
+		case params.NameChannelOpenedAndDeposit:
+			ev, err = newEventChannelOpenAndDeposit(l)
+		case params.NameChannelNewDeposit:
+			ev, err = newEventChannelNewDeposit(l)
+		case params.NameChannelClosed:
+			ev, err = newEventChannelClosed(l)
+		case params.NameChannelUnlocked:
+			ev, err = newEventChannelUnlocked(l)
+		case params.NameBalanceProofUpdated:
+			ev, err = newEventBalanceProofUpdated(l)
+		case params.NameChannelPunished:
+			ev, err = newEventChannelPunished(l)
+		case params.NameChannelSettled:
+			ev, err = newEventChannelSettled(l)
+		case params.NameChannelCooperativeSettled:
+			ev, err = newEventChannelCooperativeSettled(l)
+		case params.NameChannelWithdraw:
+			ev, err = newEventChannelWithdraw(l)
+		default:
+			continue
+		}
+		if err != nil {
+			return
+		}
+		if e := toContractEvent(ev); e != nil {
+			es = append(es, e)
+		}
+	}
+	return
+}
+
+// saveContractEvents alarm task and backfill both save events, SaveContractEvents of gkvdb is not safe for concurrent use
+func (be *Events) saveContractEvents(es []*models.ContractEvent) error {
+	be.contractEventLock.Lock()
+	defer be.contractEventLock.Unlock()
+	return be.contractEventDao.SaveContractEvents(es)
+}
+
+/*
+backfillContractEvents fetches events before the block alarm task starts from,
+so that events of history, such as those before upgrading, are also available in cache.
+progress is saved after each step and continues after restart.
+events fetched here have greater ID than events received by alarm task, ID is not the order on chain.
+*/
+func (be *Events) backfillContractEvents(lastBlockNumber int64) {
+	b := be.contractEventDao.GetContractEventBackfill()
+	if b == nil {
+		// 与 startAlarmTask 第一次查询的起始块一致
+		to := lastBlockNumber - 2*params.ForkConfirmNumber
+		if to < 0 {
+			to = 0
+		}
+		b = &models.ContractEventBackfill{To: to}
+		err := be.contractEventDao.SaveContractEventBackfill(b)
+		if err != nil {
+			log.Error(err.Error())
+			return
+		}
+	}
+	if !b.Done() {
+		log.Info(fmt.Sprintf("backfill contract events between block %d - %d", b.From, b.To-1))
+	}
+	for !b.Done() {
+		to := b.From + params.ContractEventsBackfillStep - 1
+		if to >= b.To {
+			to = b.To - 1
+		}
+		logs, err := be.getLogsFromChain(b.From, to)
+		var es []*models.ContractEvent
+		if err == nil {
+			es, err = parseContractEvents(logs)
+		}
+		if err == nil && len(es) > 0 {
+			err = be.saveContractEvents(es)
+		}
+		if err != nil {
+			log.Error(fmt.Sprintf("backfill contract events between block %d - %d err %s", b.From, to, err))
+			select {
+			case <-time.After(params.ContractEventsBackfillRetryInterval):
+				continue
+			case <-be.backfillStopChan:
+				return
+			}
+		}
+		b.From = to + 1
+		err = be.contractEventDao.SaveContractEventBackfill(b)
+		if err != nil {
+			log.Error(err.Error())
+		}
+		select {
+		case <-be.backfillStopChan:
+			return
+		default:
+		}
+	}
+}
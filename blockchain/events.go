@@ -10,8 +10,10 @@ import (
 	"math/big"
 
 	"strings"
+	"sync"
 
 	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
 	"github.com/SmartMeshFoundation/Photon/network/helper"
 	"github.com/SmartMeshFoundation/Photon/network/rpc"
 	"github.com/SmartMeshFoundation/Photon/network/rpc/contracts"
@@ -70,10 +72,13 @@ type Events struct {
 	lastBlockNumber     int64
 	rpcModuleDependency RPCModuleDependency
 	client              *helper.SafeEthClient
-	pollPeriod          time.Duration      // 轮询周期,必须与公链出块间隔一致
-	stopChan            chan int           // has stopped?
-	txDone              map[eventID]uint64 // 该map记录最近30块内处理的events流水,用于事件去重
-	firstStart          bool               //保证ContractHistoryEventCompleteStateChange 只会发送一次
+	pollPeriod          time.Duration           // 轮询周期,必须与公链出块间隔一致
+	stopChan            chan int                // has stopped?
+	txDone              map[eventID]uint64      // 该map记录最近30块内处理的events流水,用于事件去重
+	firstStart          bool                    //保证ContractHistoryEventCompleteStateChange 只会发送一次
+	contractEventDao    models.ContractEventDao // 合约事件本地缓存
+	contractEventLock   sync.Mutex
+	backfillStopChan    chan struct{}
 }
 
 //NewBlockChainEvents create BlockChainEvents
@@ -84,16 +89,23 @@ func NewBlockChainEvents(client *helper.SafeEthClient, rpcModuleDependency RPCMo
 		client:              client,
 		txDone:              make(map[eventID]uint64),
 		firstStart:          true,
+		backfillStopChan:    make(chan struct{}),
 	}
 	return be
 }
 
+//SetContractEventDao events received from chain will be saved to dao, must be called before Start
+func (be *Events) SetContractEventDao(dao models.ContractEventDao) {
+	be.contractEventDao = dao
+}
+
 //Stop event listenging
 func (be *Events) Stop() {
 	be.pollPeriod = 0
 	if be.stopChan != nil {
 		close(be.stopChan)
 	}
+	close(be.backfillStopChan)
 	log.Info("Events stop ok...")
 }
 
@@ -124,6 +136,12 @@ func (be *Events) Start(LastBlockNumber int64) {
 		1. start alarm task
 	*/
 	go be.startAlarmTask()
+	/*
+		2. fetch history events missing in cache
+	*/
+	if be.contractEventDao != nil {
+		go be.backfillContractEvents(LastBlockNumber)
+	}
 }
 
 func (be *Events) startAlarmTask() {
@@ -189,13 +207,20 @@ func (be *Events) startAlarmTask() {
 			fromBlockNumber = 0
 		}
 		// get all state change between currentBlock and lastedBlock
-		stateChanges, err := be.queryAllStateChange(fromBlockNumber, lastedBlock)
+		stateChanges, contractEvents, err := be.queryAllStateChange(fromBlockNumber, lastedBlock)
 		if err != nil {
 			log.Error(fmt.Sprintf("queryAllStateChange err=%s", err))
 			// 如果这里出现err,不能继续处理该blocknumber,否则会丢事件,直接从该块重新处理即可
 			time.Sleep(be.pollPeriod / 2)
 			continue
 		}
+		// 缓存合约事件,供查询历史事件使用,失败不影响事件处理
+		if be.contractEventDao != nil && len(contractEvents) > 0 {
+			err = be.saveContractEvents(contractEvents)
+			if err != nil {
+				log.Error(fmt.Sprintf("SaveContractEvents err=%s", err))
+			}
+		}
 		if len(stateChanges) > 0 {
 			log.Trace(fmt.Sprintf("receive %d events between block %d - %d", len(stateChanges), currentBlock+1, lastedBlock))
 		}
@@ -246,7 +271,7 @@ func (be *Events) startAlarmTask() {
 	}
 }
 
-func (be *Events) queryAllStateChange(fromBlock int64, toBlock int64) (stateChanges []mediatedtransfer.ContractStateChange, err error) {
+func (be *Events) queryAllStateChange(fromBlock int64, toBlock int64) (stateChanges []mediatedtransfer.ContractStateChange, contractEvents []*models.ContractEvent, err error) {
 	/*
 		get all event of contract TokenNetworkRegistry, SecretRegistry , TokenNetwork
 	*/
@@ -254,7 +279,7 @@ func (be *Events) queryAllStateChange(fromBlock int64, toBlock int64) (stateChan
 	if err != nil {
 		return
 	}
-	stateChanges, err = be.parseLogsToEvents(logs)
+	stateChanges, contractEvents, err = be.parseLogsToEvents(logs)
 	if err != nil {
 		return
 	}
@@ -279,9 +304,10 @@ func (be *Events) getLogsFromChain(fromBlock int64, toBlock int64) (logs []types
 	return
 }
 
-func (be *Events) parseLogsToEvents(logs []types.Log) (stateChanges []mediatedtransfer.ContractStateChange, err error) {
+func (be *Events) parseLogsToEvents(logs []types.Log) (stateChanges []mediatedtransfer.ContractStateChange, contractEvents []*models.ContractEvent, err error) {
 	for _, l := range logs {
 		eventName := topicToEventName[l.Topics[0]]
+		var ev interface{}
 
 		// 根据已处理流水去重
 		if doneBlockNumber, ok := be.txDone[makeEventID(&l)]; ok {
@@ -313,18 +339,21 @@ func (be *Events) parseLogsToEvents(logs []types.Log) (stateChanges []mediatedtr
 			if err = err2; err != nil {
 				return
 			}
+			ev = e
 			stateChanges = append(stateChanges, eventTokenNetworkCreated2StateChange(e))
 		case params.NameSecretRevealed:
 			e, err2 := newEventSecretRevealed(&l)
 			if err = err2; err != nil {
 				return
 			}
+			ev = e
 			stateChanges = append(stateChanges, eventSecretRevealed2StateChange(e))
 		case params.NameChannelOpenedAndDeposit:
 			e, err2 := newEventChannelOpenAndDeposit(&l)
 			if err = err2; err != nil {
 				return
 			}
+			ev = e
 			oev, dev := eventChannelOpenAndDeposit2StateChange(e)
 			stateChanges = append(stateChanges, oev)
 			stateChanges = append(stateChanges, dev)
@@ -333,52 +362,63 @@ func (be *Events) parseLogsToEvents(logs []types.Log) (stateChanges []mediatedtr
 			if err = err2; err != nil {
 				return
 			}
+			ev = e
 			stateChanges = append(stateChanges, eventChannelNewDeposit2StateChange(e))
 		case params.NameChannelClosed:
 			e, err2 := newEventChannelClosed(&l)
 			if err = err2; err != nil {
 				return
 			}
+			ev = e
 			stateChanges = append(stateChanges, eventChannelClosed2StateChange(e))
 		case params.NameChannelUnlocked:
 			e, err2 := newEventChannelUnlocked(&l)
 			if err = err2; err != nil {
 				return
 			}
+			ev = e
 			stateChanges = append(stateChanges, eventChannelUnlocked2StateChange(e))
 		case params.NameBalanceProofUpdated:
 			e, err2 := newEventBalanceProofUpdated(&l)
 			if err = err2; err != nil {
 				return
 			}
+			ev = e
 			stateChanges = append(stateChanges, eventBalanceProofUpdated2StateChange(e))
 		case params.NameChannelPunished:
 			e, err2 := newEventChannelPunished(&l)
 			if err = err2; err != nil {
 				return
 			}
+			ev = e
 			stateChanges = append(stateChanges, eventChannelPunished2StateChange(e))
 		case params.NameChannelSettled:
 			e, err2 := newEventChannelSettled(&l)
 			if err = err2; err != nil {
 				return
 			}
+			ev = e
 			stateChanges = append(stateChanges, eventChannelSettled2StateChange(e))
 		case params.NameChannelCooperativeSettled:
 			e, err2 := newEventChannelCooperativeSettled(&l)
 			if err = err2; err != nil {
 				return
 			}
+			ev = e
 			stateChanges = append(stateChanges, eventChannelCooperativeSettled2StateChange(e))
 		case params.NameChannelWithdraw:
 			e, err2 := newEventChannelWithdraw(&l)
 			if err = err2; err != nil {
 				return
 			}
+			ev = e
 			stateChanges = append(stateChanges, eventChannelWithdraw2StateChange(e))
 		default:
 			log.Warn(fmt.Sprintf("receive unkonwn type event from chain : \n%s\n", utils.StringInterface(l, 3)))
 		}
+		if ce := toContractEvent(ev); ce != nil {
+			contractEvents = append(contractEvents, ce)
+		}
 		// 记录处理流水
 		be.txDone[makeEventID(&l)] = l.BlockNumber
 	}
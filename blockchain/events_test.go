@@ -117,7 +117,7 @@ func TestEvents_Start2(t *testing.T) {
 		t.Error("NewBlockChainEvents failed")
 	}
 	params.ChainID = big.NewInt(8888)
-	chs, err := be.queryAllStateChange(13362234, 13362238)
+	chs, _, err := be.queryAllStateChange(13362234, 13362238)
 	if err != nil {
 		t.Error(err)
 		return
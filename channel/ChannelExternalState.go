@@ -3,6 +3,7 @@ package channel
 import (
 	"fmt"
 	"math/big"
+	"sync"
 
 	"errors"
 
@@ -38,6 +39,8 @@ type ExternalState struct {
 	MyAddress                      common.Address
 	PartnerAddress                 common.Address
 	db                             channeltype.Db
+	unlockLock                     sync.Mutex
+	unlocking                      map[common.Hash]bool //正在链上 unlock 的锁,关闭通道,updateBalanceProof,密码注册以及自动 settle 都会 unlock
 }
 
 //NewChannelExternalState create a new channel external state
@@ -55,6 +58,7 @@ func NewChannelExternalState(fun FuncRegisterChannelForHashlock,
 		SettledBlock:                   0,
 		MyAddress:                      MyAddress,
 		PartnerAddress:                 PartnerAddress,
+		unlocking:                      make(map[common.Hash]bool),
 	}
 	return cs
 }
@@ -128,7 +132,9 @@ Unlock call withdraw function of contract
 func (e *ExternalState) Unlock(unlockproofs []*channeltype.UnlockProof, argTransferdAmount *big.Int) (result *utils.AsyncResult) {
 	result = utils.NewAsyncResult()
 	transferAmount := new(big.Int).Set(argTransferdAmount)
+	unlockproofs = e.startUnlocking(unlockproofs)
 	go func() {
+		defer e.stopUnlocking(unlockproofs)
 		log.Info(fmt.Sprintf("Unlock called %s", utils.HPex(e.ChannelIdentifier.ChannelIdentifier)))
 		failed := false
 		for _, proof := range unlockproofs {
@@ -162,6 +168,36 @@ func (e *ExternalState) Unlock(unlockproofs []*channeltype.UnlockProof, argTrans
 	return
 }
 
+//startUnlocking 记录要 unlock 的锁,返回其中没有正在 unlock 的,同一个锁不会同时提交两次
+func (e *ExternalState) startUnlocking(unlockproofs []*channeltype.UnlockProof) (proofs []*channeltype.UnlockProof) {
+	e.unlockLock.Lock()
+	defer e.unlockLock.Unlock()
+	for _, proof := range unlockproofs {
+		if e.unlocking[proof.Lock.LockSecretHash] {
+			log.Info(fmt.Sprintf("Unlock is in progress %s  %s", e.ChannelIdentifier.String(), utils.HPex(proof.Lock.LockSecretHash)))
+			continue
+		}
+		e.unlocking[proof.Lock.LockSecretHash] = true
+		proofs = append(proofs, proof)
+	}
+	return
+}
+
+func (e *ExternalState) stopUnlocking(unlockproofs []*channeltype.UnlockProof) {
+	e.unlockLock.Lock()
+	defer e.unlockLock.Unlock()
+	for _, proof := range unlockproofs {
+		delete(e.unlocking, proof.Lock.LockSecretHash)
+	}
+}
+
+//IsUnlocking returns true if some locks of this channel are being unlocked on chain
+func (e *ExternalState) IsUnlocking() bool {
+	e.unlockLock.Lock()
+	defer e.unlockLock.Unlock()
+	return len(e.unlocking) > 0
+}
+
 //Settle call settle function of contract
 func (e *ExternalState) Settle(MyTransferAmount, PartnerTransferAmount *big.Int, MyLocksroot, PartnerLocksroot common.Hash) (result *utils.AsyncResult) {
 	if e.SettledBlock != 0 {
@@ -1085,3 +1085,19 @@ func TestChannel_RegisterCooperativeSettleRequest(t *testing.T) {
 		return
 	}
 }
+
+//a lock being unlocked on chain must not be unlocked again at the same time
+func TestExternalStateUnlocking(t *testing.T) {
+	e := &ExternalState{unlocking: make(map[common.Hash]bool)}
+	p1 := &channeltype.UnlockProof{Lock: &mtree.Lock{LockSecretHash: utils.NewRandomHash()}}
+	p2 := &channeltype.UnlockProof{Lock: &mtree.Lock{LockSecretHash: utils.NewRandomHash()}}
+	assert.Equal(t, e.IsUnlocking(), false)
+	started := e.startUnlocking([]*channeltype.UnlockProof{p1})
+	assert.Equal(t, len(started), 1)
+	assert.Equal(t, e.IsUnlocking(), true)
+	started = e.startUnlocking([]*channeltype.UnlockProof{p1, p2})
+	assert.Equal(t, len(started), 1)
+	assert.Equal(t, started[0], p2)
+	e.stopUnlocking([]*channeltype.UnlockProof{p1, p2})
+	assert.Equal(t, e.IsUnlocking(), false)
+}
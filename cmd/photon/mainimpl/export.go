@@ -0,0 +1,142 @@
+package mainimpl
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/models/gkvdb"
+	"github.com/SmartMeshFoundation/Photon/models/stormdb"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var exportCommand = cli.Command{
+	Name:  "export",
+	Usage: "export sent transfers, received transfers and mediation fees for accounting, photon of this account must be stopped",
+	Description: `read records from db of --address in --datadir and write them as csv or jsonl,
+   use /api/1/export/accounting instead when photon is running.`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "format",
+			Usage: "csv or jsonl",
+			Value: photon.AccountingFormatCSV,
+		},
+		cli.StringFlag{
+			Name:  "output",
+			Usage: "file to write, - means stdout",
+		},
+		cli.StringFlag{
+			Name:  "from-time",
+			Usage: "records at or after this time, RFC3339 like 2018-10-01T00:00:00+08:00",
+		},
+		cli.StringFlag{
+			Name:  "to-time",
+			Usage: "records at or before this time, RFC3339",
+		},
+		cli.Int64Flag{
+			Name:  "from-block",
+			Usage: "records at or after this block",
+			Value: -1,
+		},
+		cli.Int64Flag{
+			Name:  "to-block",
+			Usage: "records at or before this block",
+			Value: -1,
+		},
+		cli.StringFlag{
+			Name:  "token",
+			Usage: "only records of this token",
+		},
+	},
+	Action: exportCtx,
+}
+
+func exportQuery(ctx *cli.Context) (q *models.TransferQuery, err error) {
+	q = models.NewTransferQuery()
+	q.FromBlock = ctx.Int64("from-block")
+	q.ToBlock = ctx.Int64("to-block")
+	if s := ctx.String("from-time"); s != "" {
+		q.FromTime, err = time.Parse(time.RFC3339, s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid from-time %s", s)
+		}
+	}
+	if s := ctx.String("to-time"); s != "" {
+		q.ToTime, err = time.Parse(time.RFC3339, s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid to-time %s", s)
+		}
+	}
+	if s := ctx.String("token"); s != "" {
+		if !common.IsHexAddress(s) {
+			return nil, fmt.Errorf("invalid token %s", s)
+		}
+		q.TokenAddress = common.HexToAddress(s)
+	}
+	return
+}
+
+// openExistingDb open db of address created by photon, type of db is read from its info file
+func openExistingDb(dataDir string, address common.Address) (dao models.Dao, err error) {
+	dbPath := userDatabasePath(dataDir, address)
+	if !utils.Exists(dbPath) {
+		return nil, fmt.Errorf("db %s doesn't exist", dbPath)
+	}
+	//#nosec#
+	info, err := ioutil.ReadFile(fmt.Sprintf("%s.%s", dbPath, "info"))
+	if err == nil && string(info) == "gkv" {
+		dao, err = gkvdb.OpenDb(dbPath)
+	} else {
+		dao, err = stormdb.OpenDb(dbPath)
+	}
+	if err != nil {
+		err = fmt.Errorf("open db %s err %s, is photon running?", dbPath, err)
+		return
+	}
+	// CloseDB marks db closed normally, which would hide the crash from photon
+	if dao.IsDbCrashedLastTime() {
+		err = fmt.Errorf("photon of %s was not stopped normally, start photon to restore it first", address.String())
+		// dao is not closed to keep the mark
+		return nil, err
+	}
+	return
+}
+
+func exportCtx(ctx *cli.Context) (err error) {
+	address := ctx.GlobalString("address")
+	if !common.IsHexAddress(address) {
+		return fmt.Errorf("--address is required")
+	}
+	output := ctx.String("output")
+	if output == "" {
+		return fmt.Errorf("--output is required")
+	}
+	q, err := exportQuery(ctx)
+	if err != nil {
+		return
+	}
+	dataDir := ctx.GlobalString("datadir")
+	if len(dataDir) == 0 {
+		dataDir = path.Join(utils.GetHomePath(), ".photon")
+	}
+	dao, err := openExistingDb(dataDir, common.HexToAddress(address))
+	if err != nil {
+		return
+	}
+	defer dao.CloseDB()
+	w := os.Stdout
+	if output != "-" {
+		w, err = os.Create(output)
+		if err != nil {
+			return
+		}
+		defer w.Close()
+	}
+	return photon.ExportAccounting(dao, w, ctx.String("format"), q)
+}
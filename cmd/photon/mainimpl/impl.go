@@ -169,6 +169,30 @@ func StartMain() (*photon.API, error) {
 			Name:  "pfs",
 			Usage: "pathfinder service host,example http://transport01.smartmesh.cn:7000,default ",
 		},
+		cli.BoolFlag{
+			Name:  "auto-settle",
+			Usage: "settle closed channels automatically after settle timeout, unlock known locks on chain before settle",
+		},
+		cli.BoolFlag{
+			Name:  "watchtower",
+			Usage: "work as a watchtower, accept delegations of other nodes and update balance proof for them when their partner closes channel",
+		},
+		cli.StringFlag{
+			Name:  "backup-dir",
+			Usage: "copy encrypted channel backup to this directory every time it's changed, it's always written to the directory of db",
+		},
+		cli.StringFlag{
+			Name:  "backup-url",
+			Usage: "PUT encrypted channel backup to this http url every time it's changed",
+		},
+		cli.BoolFlag{
+			Name:  "hold-incoming-transfers",
+			Usage: "hold every transfer received as target until it's accepted or canceled by api, it's canceled automatically when reveal timeout is reached",
+		},
+		cli.BoolFlag{
+			Name:  "encrypt-transfer-data",
+			Usage: "encrypt data of transfers sent with public key of target, nodes of old version cannot read it",
+		},
 		cli.BoolFlag{
 			Name:  "enable-fork-confirm",
 			Usage: "enable fork confirm when receive events from chain,default is false,default is disabled",
@@ -181,6 +205,18 @@ func StartMain() (*photon.API, error) {
 			Name:  "http-password",
 			Usage: "the password needed when call http api,only work with http-username",
 		},
+		cli.StringFlag{
+			Name:  "api-tls-cert",
+			Usage: "certificate file to serve http api over https,only work with api-tls-key",
+		},
+		cli.StringFlag{
+			Name:  "api-tls-key",
+			Usage: "private key file to serve http api over https,only work with api-tls-cert",
+		},
+		cli.StringFlag{
+			Name:  "rpc-socket",
+			Usage: "unix socket path to serve JSON-RPC for local tools, JSON-RPC is always served at /api/1/rpc",
+		},
 		cli.StringFlag{
 			Name:  "db",
 			Usage: "use --db=gkv when need photon run with gkvdb,default db is boltdb,photon doesn't support change db type once db is created.",
@@ -188,6 +224,7 @@ func StartMain() (*photon.API, error) {
 	}
 	app.Flags = append(app.Flags, debug.Flags...)
 	app.Action = mainCtx
+	app.Commands = []cli.Command{exportCommand, restoreCommand, registerTokenCommand}
 	app.Name = "photon"
 	app.Version = Version
 	app.Before = func(ctx *cli.Context) error {
@@ -415,9 +452,8 @@ func config(ctx *cli.Context) (config *params.Config, err error) {
 			return
 		}
 	}
-	userDbPath := hex.EncodeToString(config.MyAddress[:])
-	userDbPath = userDbPath[:8]
-	userDbPath = filepath.Join(config.DataDir, userDbPath)
+	databasePath := userDatabasePath(config.DataDir, config.MyAddress)
+	userDbPath := filepath.Dir(databasePath)
 	if !utils.Exists(userDbPath) {
 		err = os.MkdirAll(userDbPath, os.ModePerm)
 		if err != nil {
@@ -425,7 +461,6 @@ func config(ctx *cli.Context) (config *params.Config, err error) {
 			return
 		}
 	}
-	databasePath := filepath.Join(userDbPath, "log.db")
 	config.Debug = ctx.Bool("debug")
 	config.DataBasePath = databasePath
 	if ctx.Bool("debugcrash") {
@@ -439,6 +474,12 @@ func config(ctx *cli.Context) (config *params.Config, err error) {
 		log.Info(fmt.Sprintf("condition quit=%#v", config.ConditionQuit))
 	}
 	config.IgnoreMediatedNodeRequest = ctx.Bool("ignore-mediatednode-request")
+	config.AutoSettle = ctx.Bool("auto-settle")
+	config.WatchTower = ctx.Bool("watchtower")
+	config.BackupDir = ctx.String("backup-dir")
+	config.BackupURL = ctx.String("backup-url")
+	config.HoldIncomingTransfers = ctx.Bool("hold-incoming-transfers")
+	config.EncryptTransferData = ctx.Bool("encrypt-transfer-data")
 	if ctx.Bool("nonetwork") {
 		config.NetworkMode = params.NoNetwork
 	} else if ctx.Bool("matrix") {
@@ -482,6 +523,13 @@ func config(ctx *cli.Context) (config *params.Config, err error) {
 		config.HTTPUsername = ctx.String("http-username")
 		config.HTTPPassword = ctx.String("http-password")
 	}
+	config.APITLSCert = ctx.String("api-tls-cert")
+	config.APITLSKey = ctx.String("api-tls-key")
+	config.RPCSocket = ctx.String("rpc-socket")
+	if (config.APITLSCert == "") != (config.APITLSKey == "") {
+		err = errors.New("api-tls-cert and api-tls-key must be set together")
+		return
+	}
 	return
 }
 
@@ -580,6 +628,13 @@ func verifyContractCode(bcs *rpc.BlockChainService) (err error) {
 	}
 	return
 }
+// userDatabasePath db of this account in dataDir
+func userDatabasePath(dataDir string, address common.Address) string {
+	userDbPath := hex.EncodeToString(address[:])
+	userDbPath = userDbPath[:8]
+	return filepath.Join(dataDir, userDbPath, "log.db")
+}
+
 func checkDbMeta(dbPath, dbType string) (err error) {
 	//make sure db type not change since first start .
 	dbInfo := fmt.Sprintf("%s.%s", dbPath, "info")
@@ -0,0 +1,116 @@
+package mainimpl
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/SmartMeshFoundation/Photon"
+	"github.com/SmartMeshFoundation/Photon/network/helper"
+	"github.com/SmartMeshFoundation/Photon/network/netshare"
+	"github.com/SmartMeshFoundation/Photon/network/rpc"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var registerTokenCommand = cli.Command{
+	Name:  "register-token",
+	Usage: "create token network of a new ERC20 token by opening the first channel of it",
+	Description: `TokensNetwork has no separate register function, a token is registered when the first channel of it is opened,
+   so --partner and --deposit of this channel are required. --deposit is an integer, or a decimal like 1.25 in decimals of token.
+   use PUT /api/1/tokens/:token instead when photon of this account is running.`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "token",
+			Usage: "address of ERC20 token",
+		},
+		cli.StringFlag{
+			Name:  "partner",
+			Usage: "partner of the first channel",
+		},
+		cli.StringFlag{
+			Name:  "deposit",
+			Usage: "deposit of the first channel",
+		},
+		cli.IntFlag{
+			Name:  "settle-timeout",
+			Usage: "settle timeout of the first channel",
+			Value: params.DefaultSettleTimeout,
+		},
+	},
+	Action: registerTokenCtx,
+}
+
+func registerTokenCtx(ctx *cli.Context) (err error) {
+	if !common.IsHexAddress(ctx.String("token")) {
+		return fmt.Errorf("invalid token %s", ctx.String("token"))
+	}
+	if !common.IsHexAddress(ctx.String("partner")) {
+		return fmt.Errorf("invalid partner %s", ctx.String("partner"))
+	}
+	token := common.HexToAddress(ctx.String("token"))
+	partner := common.HexToAddress(ctx.String("partner"))
+	// address, keystore-path and password-file are global flags
+	privateKey, err := getPrivateKey(ctx.Parent())
+	if err != nil {
+		return
+	}
+	endpoint := ctx.GlobalString("eth-rpc-endpoint")
+	client, err := helper.NewSafeClient(endpoint)
+	if err != nil || client.Status != netshare.Connected {
+		return fmt.Errorf("cannot connect to geth :%s err=%v", endpoint, err)
+	}
+	defer client.Close()
+	params.ChainID, err = client.NetworkID(context.Background())
+	if err != nil {
+		return
+	}
+	registryAddress := common.HexToAddress(ctx.GlobalString("registry-contract-address"))
+	if registryAddress == utils.EmptyAddress {
+		registryAddress, err = getDefaultRegistryByEthClient(client)
+		if err != nil {
+			return
+		}
+		if registryAddress == utils.EmptyAddress {
+			return fmt.Errorf("no default registry on this chain, --registry-contract-address is required")
+		}
+	}
+	bcs, err := rpc.NewBlockChainService(privateKey, registryAddress, client)
+	if err != nil {
+		return
+	}
+	m, err := photon.FetchTokenMetadata(bcs, token)
+	if err != nil {
+		return
+	}
+	var deposit *big.Int
+	s := ctx.String("deposit")
+	if strings.Contains(s, ".") {
+		deposit, err = m.ParseAmount(s)
+		if err != nil {
+			return
+		}
+	} else {
+		var ok bool
+		deposit, ok = new(big.Int).SetString(s, 0)
+		if !ok || deposit.Sign() <= 0 {
+			return fmt.Errorf("invalid deposit %s", s)
+		}
+	}
+	tn, err := bcs.TokenNetwork(token)
+	if err != nil {
+		return
+	}
+	address := crypto.PubkeyToAddress(privateKey.PublicKey)
+	err = tn.RegisterToken(address, partner, ctx.Int("settle-timeout"), deposit)
+	if err != nil {
+		return
+	}
+	fmt.Printf("token %s registered, symbol=%s name=%s decimals=%d, channel with %s opened with deposit %s\n",
+		token.String(), m.Symbol, m.Name, m.Decimals, partner.String(), m.FormatAmount(deposit))
+	return
+}
@@ -0,0 +1,123 @@
+package mainimpl
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/SmartMeshFoundation/Photon"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/models/gkvdb"
+	"github.com/SmartMeshFoundation/Photon/models/stormdb"
+	"github.com/SmartMeshFoundation/Photon/network/helper"
+	"github.com/SmartMeshFoundation/Photon/network/netshare"
+	"github.com/SmartMeshFoundation/Photon/network/rpc"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/crypto"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var restoreCommand = cli.Command{
+	Name:  "restore",
+	Usage: "close or settle channels from an encrypted channel backup after db is lost",
+	Description: `decrypt --backup with key of --address, then close every channel still open on chain with the newest
+   balance proof of partner, or update it if partner closed with an older one, and unlock locks whose secret is known.
+   A new db is created in --datadir, start photon with --auto-settle to settle these channels after settle timeout.`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "backup",
+			Usage: "channel backup file, it's channel.backup in the directory of db, or a copy of it",
+		},
+	},
+	Action: restoreCtx,
+}
+
+func restoreCtx(ctx *cli.Context) (err error) {
+	backupFile := ctx.String("backup")
+	if backupFile == "" {
+		return fmt.Errorf("--backup is required")
+	}
+	//#nosec#
+	data, err := ioutil.ReadFile(backupFile)
+	if err != nil {
+		return
+	}
+	// address, keystore-path and password-file are global flags
+	privateKey, err := getPrivateKey(ctx.Parent())
+	if err != nil {
+		return
+	}
+	b, err := photon.DecryptChannelBackup(data, privateKey)
+	if err != nil {
+		return
+	}
+	address := crypto.PubkeyToAddress(privateKey.PublicKey)
+	dataDir := ctx.GlobalString("datadir")
+	if len(dataDir) == 0 {
+		dataDir = path.Join(utils.GetHomePath(), ".photon")
+	}
+	dbPath := userDatabasePath(dataDir, address)
+	if utils.Exists(dbPath) {
+		return fmt.Errorf("db %s already exists, restore only works with a new db", dbPath)
+	}
+	endpoint := ctx.GlobalString("eth-rpc-endpoint")
+	client, err := helper.NewSafeClient(endpoint)
+	if err != nil || client.Status != netshare.Connected {
+		return fmt.Errorf("cannot connect to geth :%s err=%v", endpoint, err)
+	}
+	defer client.Close()
+	chainID, err := client.NetworkID(context.Background())
+	if err != nil {
+		return
+	}
+	if chainID.Int64() != b.ChainID {
+		return fmt.Errorf("backup is of chain %d, but chain of %s is %d", b.ChainID, endpoint, chainID.Int64())
+	}
+	params.ChainID = chainID
+	bcs, err := rpc.NewBlockChainService(privateKey, b.RegistryAddress, client)
+	if err != nil {
+		return
+	}
+	err = os.MkdirAll(filepath.Dir(dbPath), os.ModePerm)
+	if err != nil {
+		return
+	}
+	var dao models.Dao
+	if ctx.GlobalIsSet("db") && ctx.GlobalString("db") == "gkv" {
+		err = checkDbMeta(dbPath, "gkv")
+		if err != nil {
+			return
+		}
+		dao, err = gkvdb.OpenDb(dbPath)
+	} else {
+		err = checkDbMeta(dbPath, "boltdb")
+		if err != nil {
+			return
+		}
+		dao, err = stormdb.OpenDb(dbPath)
+	}
+	if err != nil {
+		return fmt.Errorf("open db error %s", err)
+	}
+	defer dao.CloseDB()
+	dao.SaveRegistryAddress(b.RegistryAddress)
+	dao.SaveChainID(b.ChainID)
+	results, err := photon.RestoreChannels(bcs, dao, b)
+	for _, r := range results {
+		errMsg := ""
+		if r.Err != nil {
+			errMsg = r.Err.Error()
+		}
+		fmt.Printf("channel=%s token=%s partner=%s action=%s unlocked=%d err=%s\n",
+			r.ChannelIdentifier.String(), r.TokenAddress.String(), r.PartnerAddress.String(), r.Action, r.Unlocked, errMsg)
+	}
+	if err != nil {
+		return
+	}
+	fmt.Printf("%d channels restored to %s, start photon with --auto-settle to settle them\n", len(results), dbPath)
+	return
+}
@@ -0,0 +1,485 @@
+package photon
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/channel/channeltype"
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+connectionManager 管理通过 JoinTokenNetwork 加入的 token 网络:
+1. 选择连接多且在线的节点打开 ChannelTarget 个通道
+2. 对方新建的通道,从预留的资金中存款
+3. 通道被关闭后,打开新的通道代替
+4. 退出以后不能合作 settle 的通道被关闭, 由 autoSettler settle, 所有通道都 settle 以后才删除 TokenNetworkConnection
+*/
+type connectionManager struct {
+	rs   *Service
+	api  *API
+	lock sync.Mutex // 同时只调整一个 token 网络的通道
+	/*
+		正在由我们打开的通道的对方,对方在这些通道上的存款不需要我们跟进
+	*/
+	opening     map[common.Address]map[common.Address]bool
+	openingLock sync.Mutex
+}
+
+func newConnectionManager(rs *Service) *connectionManager {
+	return &connectionManager{
+		rs:      rs,
+		api:     NewPhotonAPI(rs),
+		opening: make(map[common.Address]map[common.Address]bool),
+	}
+}
+
+func (cm *connectionManager) setOpening(token, partner common.Address, opening bool) {
+	cm.openingLock.Lock()
+	defer cm.openingLock.Unlock()
+	m := cm.opening[token]
+	if m == nil {
+		m = make(map[common.Address]bool)
+		cm.opening[token] = m
+	}
+	if opening {
+		m[partner] = true
+	} else {
+		delete(m, partner)
+	}
+}
+
+func (cm *connectionManager) isOpening(token, partner common.Address) bool {
+	cm.openingLock.Lock()
+	defer cm.openingLock.Unlock()
+	return cm.opening[token][partner]
+}
+
+func (cm *connectionManager) isQuit() bool {
+	select {
+	case <-cm.rs.quitChan:
+		return true
+	default:
+		return false
+	}
+}
+
+/*
+start watches channels of joined token networks,
+and opens channels for networks whose channels are closed when photon is offline.
+*/
+func (cm *connectionManager) start() error {
+	cm.rs.dao.RegisterChannelDepositCallback(func(c *channeltype.Serialization) (remove bool) {
+		if cm.isJoined(c.TokenAddress()) {
+			go cm.joinChannel(c)
+		}
+		return false
+	})
+	cm.rs.dao.RegisterChannelStateCallback(func(c *channeltype.Serialization) (remove bool) {
+		if c.State == channeltype.StateClosed && cm.isJoined(c.TokenAddress()) {
+			go cm.retryConnect(c.TokenAddress())
+		}
+		return false
+	})
+	cm.rs.dao.RegisterChannelSettleCallback(func(c *channeltype.Serialization) (remove bool) {
+		if cm.isJoined(c.TokenAddress()) {
+			go cm.retryConnect(c.TokenAddress())
+		} else if cm.leavingTokens()[c.TokenAddress()] {
+			go cm.finishLeaving(c.TokenAddress())
+		}
+		return false
+	})
+	cs, err := cm.rs.dao.GetAllTokenNetworkConnections()
+	if err != nil {
+		return err
+	}
+	for _, c := range cs {
+		if c.Leaving {
+			go cm.finishLeaving(c.TokenAddress)
+			continue
+		}
+		go cm.retryConnect(c.TokenAddress)
+	}
+	return nil
+}
+
+func (cm *connectionManager) isJoined(token common.Address) bool {
+	c, err := cm.rs.dao.GetTokenNetworkConnection(token)
+	return err == nil && !c.Leaving
+}
+
+// leavingTokens token networks being left, whose closed channels are settled by autoSettler
+func (cm *connectionManager) leavingTokens() map[common.Address]bool {
+	leaving := make(map[common.Address]bool)
+	cs, err := cm.rs.dao.GetAllTokenNetworkConnections()
+	if err != nil {
+		log.Error(fmt.Sprintf("GetAllTokenNetworkConnections err %s", err))
+		return leaving
+	}
+	for _, c := range cs {
+		if c.Leaving {
+			leaving[c.TokenAddress] = true
+		}
+	}
+	return leaving
+}
+
+// isActiveChannel 可以继续交易,不是正在关闭或者结算的通道
+func isActiveChannel(c *channeltype.Serialization) bool {
+	switch c.State {
+	case channeltype.StateOpened, channeltype.StateWithdraw, channeltype.StatePrepareForWithdraw:
+		return true
+	}
+	return false
+}
+
+// activeChannels returns active channels of token and our deposits in them
+func (cm *connectionManager) activeChannels(token common.Address) (chs []*channeltype.Serialization, deposit *big.Int, err error) {
+	all, err := cm.rs.dao.GetChannelList(token, utils.EmptyAddress)
+	if err != nil {
+		return
+	}
+	deposit = big.NewInt(0)
+	for _, c := range all {
+		if !isActiveChannel(c) {
+			continue
+		}
+		chs = append(chs, c)
+		if c.OurContractBalance != nil {
+			deposit.Add(deposit, c.OurContractBalance)
+		}
+	}
+	return
+}
+
+// fundsRemaining funds of c not deposited into active channels
+func (cm *connectionManager) fundsRemaining(c *models.TokenNetworkConnection) (remaining *big.Int, activeChannels int, err error) {
+	chs, deposit, err := cm.activeChannels(c.TokenAddress)
+	if err != nil {
+		return
+	}
+	remaining = new(big.Int).Sub(c.Funds, deposit)
+	if remaining.Sign() < 0 {
+		remaining = big.NewInt(0)
+	}
+	return remaining, len(chs), nil
+}
+
+/*
+findPartners returns at most n nodes to open channels with,
+online nodes with more channels in token network are preferred,
+nodes which we already have channel with are excluded.
+*/
+func (cm *connectionManager) findPartners(token common.Address, n int) (partners []common.Address, err error) {
+	edges, err := cm.rs.dao.GetAllNonParticipantChannelByToken(token)
+	if err != nil {
+		return
+	}
+	degree := make(map[common.Address]int)
+	for _, addr := range edges {
+		degree[addr]++
+	}
+	chs, err := cm.rs.dao.GetChannelList(token, utils.EmptyAddress)
+	if err != nil {
+		return
+	}
+	exclude := map[common.Address]bool{cm.rs.NodeAddress: true}
+	for _, c := range chs {
+		exclude[c.PartnerAddress()] = true
+		degree[c.PartnerAddress()]++
+	}
+	var candidates []common.Address
+	for addr := range degree {
+		if exclude[addr] || cm.isOpening(token, addr) {
+			continue
+		}
+		candidates = append(candidates, addr)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if degree[candidates[i]] != degree[candidates[j]] {
+			return degree[candidates[i]] > degree[candidates[j]]
+		}
+		return bytes.Compare(candidates[i][:], candidates[j][:]) < 0
+	})
+	for _, addr := range candidates {
+		if len(partners) >= n {
+			break
+		}
+		if _, isOnline := cm.rs.Transport.NodeStatus(addr); !isOnline {
+			continue
+		}
+		partners = append(partners, addr)
+	}
+	return
+}
+
+/*
+retryConnect opens channels until there are ChannelTarget active channels or funds are used up,
+every new channel is funded with InitialFundingPerPartner.
+*/
+func (cm *connectionManager) retryConnect(token common.Address) (chs []*channeltype.Serialization, err error) {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+	c, err := cm.rs.dao.GetTokenNetworkConnection(token)
+	if err != nil || c.Leaving {
+		// left already
+		return nil, nil
+	}
+	remaining, active, err := cm.fundsRemaining(c)
+	if err != nil {
+		return
+	}
+	need := c.ChannelTarget - active
+	funding := c.InitialFundingPerPartner()
+	if need <= 0 || remaining.Sign() <= 0 || funding.Sign() <= 0 {
+		return
+	}
+	partners, err := cm.findPartners(token, need)
+	if err != nil {
+		return
+	}
+	if len(partners) == 0 {
+		err = errors.New("no online node to open channel with")
+		log.Warn(fmt.Sprintf("connection manager token %s err %s", utils.APex2(token), err))
+		return
+	}
+	for _, partner := range partners {
+		if cm.isQuit() {
+			return
+		}
+		amount := funding
+		if amount.Cmp(remaining) > 0 {
+			amount = remaining
+		}
+		if amount.Sign() <= 0 {
+			break
+		}
+		cm.setOpening(token, partner, true)
+		ch, err2 := cm.api.DepositAndOpenChannel(token, partner, 0, 0, amount, true)
+		cm.setOpening(token, partner, false)
+		if err2 != nil {
+			log.Error(fmt.Sprintf("connection manager open channel token=%s,partner=%s err %s",
+				utils.APex2(token), utils.APex2(partner), err2))
+			continue
+		}
+		log.Info(fmt.Sprintf("connection manager opened channel %s with %s, deposit %s",
+			ch.ChannelIdentifier, utils.APex2(partner), amount))
+		chs = append(chs, ch)
+		remaining = new(big.Int).Sub(remaining, amount)
+	}
+	if len(chs) == 0 {
+		err = errors.New("open channel failed with all nodes found")
+	}
+	return
+}
+
+/*
+joinChannel deposits into channel opened by partner,
+amount is the least of partner's deposit, InitialFundingPerPartner and funds remaining.
+*/
+func (cm *connectionManager) joinChannel(ch *channeltype.Serialization) {
+	token, partner := ch.TokenAddress(), ch.PartnerAddress()
+	if ch.State != channeltype.StateOpened || cm.isOpening(token, partner) ||
+		(ch.OurContractBalance != nil && ch.OurContractBalance.Sign() > 0) ||
+		ch.PartnerContractBalance == nil || ch.PartnerContractBalance.Sign() <= 0 {
+		return
+	}
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+	c, err := cm.rs.dao.GetTokenNetworkConnection(token)
+	if err != nil || c.Leaving {
+		return
+	}
+	remaining, _, err := cm.fundsRemaining(c)
+	if err != nil {
+		log.Error(fmt.Sprintf("connection manager fundsRemaining err %s", err))
+		return
+	}
+	amount := ch.PartnerContractBalance
+	for _, a := range []*big.Int{c.InitialFundingPerPartner(), remaining} {
+		if amount.Cmp(a) > 0 {
+			amount = a
+		}
+	}
+	if amount.Sign() <= 0 {
+		return
+	}
+	_, err = cm.api.DepositAndOpenChannel(token, partner, 0, 0, amount, false)
+	if err != nil {
+		log.Error(fmt.Sprintf("connection manager deposit to channel %s err %s", ch.ChannelIdentifier, err))
+		return
+	}
+	log.Info(fmt.Sprintf("connection manager joined channel %s opened by %s, deposit %s",
+		ch.ChannelIdentifier, utils.APex2(partner), amount))
+}
+
+/*
+leave settles all channels of token,
+channels cannot be cooperatively settled are closed, and settled by autoSettler after settle timeout.
+*/
+func (cm *connectionManager) leave(token common.Address) (chs []*channeltype.Serialization, err error) {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+	conn, err := cm.rs.dao.GetTokenNetworkConnection(token)
+	if err != nil {
+		return
+	}
+	conn.Leaving = true
+	err = cm.rs.dao.SaveTokenNetworkConnection(conn)
+	if err != nil {
+		return
+	}
+	all, err := cm.rs.dao.GetChannelList(token, utils.EmptyAddress)
+	if err != nil {
+		return
+	}
+	for _, c := range all {
+		partner := c.PartnerAddress()
+		switch c.State {
+		case channeltype.StateClosed:
+			chs = append(chs, c)
+			continue
+		case channeltype.StateSettled, channeltype.StateSettling, channeltype.StateCooprativeSettle:
+			continue
+		}
+		c2, err2 := cm.api.CooperativeSettle(token, partner)
+		if err2 == nil {
+			chs = append(chs, c2)
+			continue
+		}
+		log.Warn(fmt.Sprintf("connection manager CooperativeSettle %s err %s, close it", c.ChannelIdentifier, err2))
+		c2, err2 = cm.api.Close(token, partner)
+		if err2 != nil {
+			log.Error(fmt.Sprintf("connection manager close %s err %s", c.ChannelIdentifier, err2))
+			continue
+		}
+		chs = append(chs, c2)
+	}
+	cm.removeIfLeft(token)
+	return
+}
+
+// finishLeaving removes the connection of token being left when all channels of it are settled
+func (cm *connectionManager) finishLeaving(token common.Address) {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+	cm.removeIfLeft(token)
+}
+
+func (cm *connectionManager) removeIfLeft(token common.Address) {
+	all, err := cm.rs.dao.GetChannelList(token, utils.EmptyAddress)
+	if err != nil {
+		return
+	}
+	for _, c := range all {
+		//合作 settle 或者 settle 以后通道会被删除, 关闭等待 settle 以及打开失败的通道都要等
+		if c.State != channeltype.StateSettled && c.State != channeltype.StateCooprativeSettle {
+			return
+		}
+	}
+	err = cm.rs.dao.RemoveTokenNetworkConnection(token)
+	if err != nil {
+		log.Error(fmt.Sprintf("connection manager RemoveTokenNetworkConnection %s err %s", token.String(), err))
+		return
+	}
+	log.Info(fmt.Sprintf("connection manager left token network %s", token.String()))
+}
+
+// TokenNetworkConnectionStatus : status of token network joined by connection manager
+type TokenNetworkConnectionStatus struct {
+	*models.TokenNetworkConnection
+	FundsRemaining *big.Int `json:"funds_remaining"`
+	Channels       int      `json:"channels"`
+	Deposit        *big.Int `json:"deposit"`
+}
+
+func (r *API) tokenNetworkConnectionStatus(c *models.TokenNetworkConnection) (s *TokenNetworkConnectionStatus, err error) {
+	chs, deposit, err := r.Photon.ConnectionManager.activeChannels(c.TokenAddress)
+	if err != nil {
+		return
+	}
+	remaining := new(big.Int).Sub(c.Funds, deposit)
+	if remaining.Sign() < 0 {
+		remaining = big.NewInt(0)
+	}
+	return &TokenNetworkConnectionStatus{
+		TokenNetworkConnection: c,
+		FundsRemaining:         remaining,
+		Channels:               len(chs),
+		Deposit:                deposit,
+	}, nil
+}
+
+/*
+JoinTokenNetwork joins token network with funds,
+params.DefaultInitialChannelTarget channels are opened with online nodes having most channels,
+and params.DefaultJoinableFundsTarget of funds is reserved for nodes opening channels with us later.
+Channels closed are replaced by new channels until LeaveTokenNetwork.
+Join again changes funds of the token network.
+*/
+func (r *API) JoinTokenNetwork(token common.Address, funds *big.Int) (chs []*channeltype.Serialization, err error) {
+	if funds == nil || funds.Sign() <= 0 {
+		err = rerr.ErrInvalidAmount
+		return
+	}
+	if err = r.checkSmcStatus(); err != nil {
+		return
+	}
+	tokens, err := r.Photon.dao.GetAllTokens()
+	if err != nil {
+		return
+	}
+	if _, ok := tokens[token]; !ok {
+		err = rerr.UnknownTokenAddress(token.String())
+		return
+	}
+	c, err := r.Photon.dao.GetTokenNetworkConnection(token)
+	if err != nil {
+		c = models.NewTokenNetworkConnection(token, funds, params.DefaultInitialChannelTarget, params.DefaultJoinableFundsTarget)
+		c.CreateTime = time.Now().Unix()
+	}
+	c.Funds = funds
+	c.Leaving = false
+	err = r.Photon.dao.SaveTokenNetworkConnection(c)
+	if err != nil {
+		return
+	}
+	return r.Photon.ConnectionManager.retryConnect(token)
+}
+
+/*
+LeaveTokenNetwork cooperatively settles all channels of token network joined,
+channels cannot be cooperatively settled are closed, and settled after settle timeout even if auto settle is disabled.
+*/
+func (r *API) LeaveTokenNetwork(token common.Address) (chs []*channeltype.Serialization, err error) {
+	if err = r.checkSmcStatus(); err != nil {
+		return
+	}
+	return r.Photon.ConnectionManager.leave(token)
+}
+
+// GetTokenNetworkConnections status of all token networks joined
+func (r *API) GetTokenNetworkConnections() (ss []*TokenNetworkConnectionStatus, err error) {
+	cs, err := r.Photon.dao.GetAllTokenNetworkConnections()
+	if err != nil {
+		return
+	}
+	for _, c := range cs {
+		s, err2 := r.tokenNetworkConnectionStatus(c)
+		if err2 != nil {
+			return nil, err2
+		}
+		ss = append(ss, s)
+	}
+	return
+}
@@ -0,0 +1,218 @@
+package photon
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/channel/channeltype"
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	// DrainActionNone keep running after drained, channels are untouched
+	DrainActionNone = "none"
+	// DrainActionShutdown stop photon after drained
+	DrainActionShutdown = "shutdown"
+	// DrainActionClose close all open channels after drained
+	DrainActionClose = "close"
+	// DrainActionCooperativeSettle cooperatively settle all open channels after drained
+	DrainActionCooperativeSettle = "cooperative-settle"
+)
+
+const (
+	drainStatusWaiting = "waiting"
+	drainStatusRunning = "running"
+	drainStatusDone    = "done"
+)
+
+// DrainChannelResult : result of closing or cooperatively settling a channel after drained
+type DrainChannelResult struct {
+	ChannelIdentifier common.Hash    `json:"channel_identifier"`
+	TokenAddress      common.Address `json:"token_address"`
+	PartnerAddress    common.Address `json:"partner_address"`
+	Error             string         `json:"error,omitempty"`
+}
+
+// DrainStatus : progress of drain
+type DrainStatus struct {
+	Draining         bool                  `json:"draining"`
+	Action           string                `json:"action"`
+	StartTime        int64                 `json:"start_time,omitempty"`
+	BlockNumber      int64                 `json:"block_number"`      // pending transfers and locks are counted at this block
+	PendingTransfers int                   `json:"pending_transfers"` // transfers in Transfer2StateManager
+	PendingLocks     int                   `json:"pending_locks"`     // locks of both sides on open channels
+	Drained          bool                  `json:"drained"`
+	ActionStatus     string                `json:"action_status,omitempty"` // waiting,running or done
+	Channels         []*DrainChannelResult `json:"channels,omitempty"`
+}
+
+/*
+drainManager 维护/升级之前的退出过程:
+ 1. 不再发起新交易(StopCreateNewTransfers),不再做中间节点,也不再做接收方,收到的 MediatedTransfer 都 AnnounceDisposed
+ 2. 正在进行的交易照常进行,直到 Transfer2StateManager 为空,并且打开的通道上没有任何锁
+ 3. 然后根据 Action 关闭/合作关闭所有通道,或者退出 Photon
+
+onBlock 在 Photon 主线程中调用,统计结果供 API 查询,所以需要加锁.
+*/
+type drainManager struct {
+	rs     *Service
+	api    *API
+	lock   sync.Mutex
+	status *DrainStatus
+}
+
+func newDrainManager(rs *Service) *drainManager {
+	return &drainManager{
+		rs:     rs,
+		api:    NewPhotonAPI(rs),
+		status: &DrainStatus{Action: DrainActionNone},
+	}
+}
+
+func (dm *drainManager) isDraining() bool {
+	dm.lock.Lock()
+	defer dm.lock.Unlock()
+	return dm.status.Draining
+}
+
+func (dm *drainManager) onBlock(blockNumber int64) {
+	dm.lock.Lock()
+	defer dm.lock.Unlock()
+	s := dm.status
+	if !s.Draining {
+		return
+	}
+	s.BlockNumber = blockNumber
+	s.PendingTransfers = len(dm.rs.Transfer2StateManager)
+	s.PendingLocks = 0
+	//已经关闭的通道上的锁只能在链上 unlock,不影响退出
+	var channels []*DrainChannelResult
+	for _, g := range dm.rs.Token2ChannelGraph {
+		for _, c := range g.ChannelIdentifier2Channel {
+			if c.State == channeltype.StateClosed || c.State == channeltype.StateSettled {
+				continue
+			}
+			s.PendingLocks += len(c.OurState.Lock2PendingLocks) + len(c.OurState.Lock2UnclaimedLocks) +
+				len(c.PartnerState.Lock2PendingLocks) + len(c.PartnerState.Lock2UnclaimedLocks)
+			channels = append(channels, &DrainChannelResult{
+				ChannelIdentifier: c.ChannelIdentifier.ChannelIdentifier,
+				TokenAddress:      c.TokenAddress,
+				PartnerAddress:    c.PartnerState.Address,
+			})
+		}
+	}
+	s.Drained = s.PendingTransfers == 0 && s.PendingLocks == 0
+	if !s.Drained || s.ActionStatus != drainStatusWaiting {
+		return
+	}
+	log.Info(fmt.Sprintf("drain: nothing pending at block %d, action=%s", blockNumber, s.Action))
+	switch s.Action {
+	case DrainActionShutdown:
+		s.ActionStatus = drainStatusRunning
+		go func() {
+			dm.rs.Stop()
+			utils.SystemExit(0)
+		}()
+	case DrainActionClose, DrainActionCooperativeSettle:
+		s.ActionStatus = drainStatusRunning
+		s.Channels = channels
+		go dm.settleChannels(s.Action, channels)
+	default:
+		s.ActionStatus = drainStatusDone
+	}
+}
+
+// settleChannels 逐个关闭通道, 结果记录在 DrainChannelResult 中
+func (dm *drainManager) settleChannels(action string, channels []*DrainChannelResult) {
+	for _, r := range channels {
+		var err error
+		if action == DrainActionClose {
+			_, err = dm.api.Close(r.TokenAddress, r.PartnerAddress)
+		} else {
+			_, err = dm.api.CooperativeSettle(r.TokenAddress, r.PartnerAddress)
+		}
+		if err != nil {
+			log.Error(fmt.Sprintf("drain: %s channel %s err %s", action, r.ChannelIdentifier.String(), err))
+		}
+		dm.lock.Lock()
+		if err != nil {
+			r.Error = err.Error()
+		}
+		dm.lock.Unlock()
+	}
+	dm.lock.Lock()
+	dm.status.ActionStatus = drainStatusDone
+	dm.lock.Unlock()
+}
+
+func (dm *drainManager) getStatus() *DrainStatus {
+	dm.lock.Lock()
+	defer dm.lock.Unlock()
+	s := *dm.status
+	s.Channels = nil
+	for _, r := range dm.status.Channels {
+		r2 := *r
+		s.Channels = append(s.Channels, &r2)
+	}
+	return &s
+}
+
+/*
+StartDrain stops initiating and mediating transfers, waits for all pending transfers and locks to finish,
+then takes action, which is one of DrainActionNone,DrainActionShutdown,DrainActionClose and DrainActionCooperativeSettle.
+Action can be changed by calling StartDrain again before it's taken.
+*/
+func (r *API) StartDrain(action string) (s *DrainStatus, err error) {
+	switch action {
+	case "":
+		action = DrainActionNone
+	case DrainActionNone, DrainActionShutdown, DrainActionClose, DrainActionCooperativeSettle:
+	default:
+		return nil, fmt.Errorf("unknown drain action %s", action)
+	}
+	dm := r.Photon.Drain
+	dm.lock.Lock()
+	if dm.status.Draining && dm.status.ActionStatus != drainStatusWaiting {
+		dm.lock.Unlock()
+		return nil, rerr.InvalidState(fmt.Sprintf("drain action %s is %s", dm.status.Action, dm.status.ActionStatus))
+	}
+	if !dm.status.Draining {
+		log.Info(fmt.Sprintf("drain: start draining, action=%s", action))
+		dm.status = &DrainStatus{
+			Draining:     true,
+			StartTime:    time.Now().Unix(),
+			ActionStatus: drainStatusWaiting,
+		}
+	}
+	dm.status.Action = action
+	//与 prepare-update 一样,直接设置即可
+	r.Photon.StopCreateNewTransfers = true
+	dm.lock.Unlock()
+	return dm.getStatus(), nil
+}
+
+// GetDrainStatus progress of drain
+func (r *API) GetDrainStatus() *DrainStatus {
+	return r.Photon.Drain.getStatus()
+}
+
+// CancelDrain accepts new transfers again, only before action is taken
+func (r *API) CancelDrain() error {
+	dm := r.Photon.Drain
+	dm.lock.Lock()
+	defer dm.lock.Unlock()
+	if !dm.status.Draining {
+		return nil
+	}
+	if dm.status.ActionStatus != drainStatusWaiting {
+		return rerr.InvalidState(fmt.Sprintf("drain action %s is %s", dm.status.Action, dm.status.ActionStatus))
+	}
+	log.Info("drain: cancelled")
+	dm.status = &DrainStatus{Action: DrainActionNone}
+	r.Photon.StopCreateNewTransfers = false
+	return nil
+}
@@ -0,0 +1,45 @@
+package photon
+
+import (
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/transfer"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDrain(t *testing.T) {
+	rs := &Service{
+		Transfer2StateManager: make(map[common.Hash]*transfer.StateManager),
+	}
+	rs.Drain = newDrainManager(rs)
+	api := NewPhotonAPI(rs)
+	_, err := api.StartDrain("unknown")
+	assert.NotEmpty(t, err)
+	s, err := api.StartDrain("")
+	assert.Empty(t, err)
+	assert.EqualValues(t, DrainActionNone, s.Action)
+	assert.EqualValues(t, true, rs.StopCreateNewTransfers)
+	assert.EqualValues(t, true, rs.Drain.isDraining())
+	//还有交易没有完成
+	rs.Transfer2StateManager[common.Hash{1}] = &transfer.StateManager{}
+	rs.Drain.onBlock(10)
+	s = api.GetDrainStatus()
+	assert.EqualValues(t, 1, s.PendingTransfers)
+	assert.EqualValues(t, false, s.Drained)
+	assert.EqualValues(t, drainStatusWaiting, s.ActionStatus)
+	//可以取消
+	assert.Empty(t, api.CancelDrain())
+	assert.EqualValues(t, false, rs.StopCreateNewTransfers)
+	_, err = api.StartDrain(DrainActionNone)
+	assert.Empty(t, err)
+	delete(rs.Transfer2StateManager, common.Hash{1})
+	rs.Drain.onBlock(11)
+	s = api.GetDrainStatus()
+	assert.EqualValues(t, true, s.Drained)
+	assert.EqualValues(t, drainStatusDone, s.ActionStatus)
+	//已经执行过了,不能再修改
+	_, err = api.StartDrain(DrainActionClose)
+	assert.NotEmpty(t, err)
+	assert.NotEmpty(t, api.CancelDrain())
+}
@@ -72,6 +72,19 @@ const (
 	*/
 	// Respond Refund
 	AnnounceDisposedTransferResponseCmdID
+	/*
+		带有 TotalAmount 或者 EncryptedSecret 的 MediatedTransfer(多路径支付,keysend),
+		普通的 MediatedTransfer 仍然使用 MediatedTransferCmdID, 不支持的节点会把它当做未知消息丢弃.
+		解析以后 CmdID 仍然是 MediatedTransferCmdID.
+	*/
+	// MediatedTransfer with TotalAmount or EncryptedSecret, normal ones still use MediatedTransferCmdID
+	MediatedTransferExtCmdID
+	/*
+		接收方拒绝交易时发送的 AnnounceDisposed, 中间节点原样往上传递, 收到的节点不再尝试其他路径,
+		格式和 AnnounceDisposed 完全相同, 不支持的节点会把它当做未知消息丢弃.
+	*/
+	// AnnounceDisposed refused by target, no other route should be tried
+	AnnounceDisposedRefusedCmdID
 )
 
 const signatureLength = 65
@@ -171,8 +184,12 @@ func (t MessageType) String() string {
 		return "DirectTransfer"
 	case MediatedTransferCmdID:
 		return "MediatedTransfer"
+	case MediatedTransferExtCmdID:
+		return "MediatedTransferExt"
 	case AnnounceDisposedTransferCmdID:
 		return "AnnounceDisposed"
+	case AnnounceDisposedRefusedCmdID:
+		return "AnnounceDisposedRefused"
 	case AnnounceDisposedTransferResponseCmdID:
 		return "AnnounceDisposedResponse"
 	case RevealSecretCmdID:
@@ -305,12 +322,7 @@ func HashMessageWithoutSignature(pack MessagePacker) common.Hash {
 
 //VerifyMessage returns the sender of message if data is a valid SignedMessage
 func VerifyMessage(data []byte) (sender common.Address, err error) {
-	messageData := data[:len(data)-signatureLength]
-	signature := make([]byte, signatureLength)
-	copy(signature, data[len(data)-signatureLength:])
-	hash := utils.Sha3(messageData)
-	signature[len(signature)-1] -= 27 //why?
-	pubkey, err := crypto.Ecrecover(hash[:], signature)
+	pubkey, err := RecoverPubkey(data)
 	if err != nil {
 		return
 	}
@@ -318,6 +330,19 @@ func VerifyMessage(data []byte) (sender common.Address, err error) {
 	return
 }
 
+//RecoverPubkey returns the uncompressed public key of sender if data is a valid SignedMessage
+func RecoverPubkey(data []byte) (pubkey []byte, err error) {
+	if len(data) < signatureLength {
+		return nil, errors.New("packet length error")
+	}
+	messageData := data[:len(data)-signatureLength]
+	signature := make([]byte, signatureLength)
+	copy(signature, data[len(data)-signatureLength:])
+	hash := utils.Sha3(messageData)
+	signature[len(signature)-1] -= 27 //why?
+	return crypto.Ecrecover(hash[:], signature)
+}
+
 //Ping message
 type Ping struct {
 	SignedMessage
@@ -928,13 +953,19 @@ type MediatedTransfer struct {
 	Target         common.Address
 	Initiator      common.Address
 	Fee            *big.Int
+	TotalAmount    *big.Int //多路径支付中接收方应收到的总金额,普通交易为nil	// amount target should receive in all parts of a multi-path transfer
+	/*
+		keysend 交易中使用接收方公钥加密(ECIES)的密码,接收方解密以后不需要向发起方请求密码,普通交易为空
+		secret encrypted with public key of target for keysend transfers, target doesn't need to send SecretRequest.
+	*/
+	EncryptedSecret []byte
 }
 
 //String is fmt.Stringer
 func (m *MediatedTransfer) String() string {
-	return fmt.Sprintf("Message{type=MediatedTransfer expiration=%d,target=%s,initiator=%s,hashlock=%s,amount=%s,fee=%s,%s}",
+	return fmt.Sprintf("Message{type=MediatedTransfer expiration=%d,target=%s,initiator=%s,hashlock=%s,amount=%s,fee=%s,total=%s,keysend=%v,%s}",
 		m.Expiration, utils.APex2(m.Target), utils.APex2(m.Initiator),
-		utils.HPex(m.LockSecretHash), m.PaymentAmount, m.Fee, m.EnvelopMessage.String())
+		utils.HPex(m.LockSecretHash), m.PaymentAmount, m.Fee, m.TotalAmount, len(m.EncryptedSecret) > 0, m.EnvelopMessage.String())
 }
 
 //NewMediatedTransfer create MediatedTransfer
@@ -962,11 +993,20 @@ func (m *MediatedTransfer) GetLock() *mtree.Lock {
 	}
 }
 
+// isExt 只有多路径支付和 keysend 才使用新格式, 保证普通交易和旧版本节点兼容
+func (m *MediatedTransfer) isExt() bool {
+	return m.TotalAmount != nil || len(m.EncryptedSecret) > 0
+}
+
 //Pack is MessagePacker
 func (m *MediatedTransfer) Pack() []byte {
 	var err error
 	buf := new(bytes.Buffer)
-	err = binary.Write(buf, binary.LittleEndian, m.CmdID) //one byte
+	cmdID := m.CmdID
+	if cmdID == MediatedTransferCmdID && m.isExt() {
+		cmdID = MediatedTransferExtCmdID
+	}
+	err = binary.Write(buf, binary.LittleEndian, cmdID) //one byte
 	//HTLC
 	err = binary.Write(buf, binary.BigEndian, m.Expiration)
 	_, err = buf.Write(m.LockSecretHash[:])
@@ -975,6 +1015,15 @@ func (m *MediatedTransfer) Pack() []byte {
 	_, err = buf.Write(m.Target[:])
 	_, err = buf.Write(m.Initiator[:])
 	_, err = buf.Write(utils.BigIntTo32Bytes(m.Fee))
+	if cmdID == MediatedTransferExtCmdID {
+		totalAmount := m.TotalAmount
+		if totalAmount == nil {
+			totalAmount = utils.BigInt0
+		}
+		_, err = buf.Write(utils.BigIntTo32Bytes(totalAmount))
+		err = binary.Write(buf, binary.BigEndian, uint16(len(m.EncryptedSecret)))
+		_, err = buf.Write(m.EncryptedSecret)
+	}
 	m.EnvelopMessage.pack(buf)
 	if err != nil {
 		log.Crit(fmt.Sprintf("MediatedTransfer Pack err %s", err))
@@ -989,6 +1038,9 @@ func (m *MediatedTransfer) UnPack(data []byte) error {
 	buf := bytes.NewBuffer(data)
 	err = binary.Read(buf, binary.LittleEndian, &t)
 	m.CmdID = t
+	if t == MediatedTransferExtCmdID {
+		m.CmdID = MediatedTransferCmdID
+	}
 	if m.CmdID != MediatedTransferCmdID && m.CmdID != AnnounceDisposedTransferCmdID {
 		return errors.New("MediatedTransfer unpack cmd error")
 	}
@@ -1000,6 +1052,21 @@ func (m *MediatedTransfer) UnPack(data []byte) error {
 	_, err = buf.Read(m.Target[:])
 	_, err = buf.Read(m.Initiator[:])
 	m.Fee = utils.ReadBigInt(buf)
+	if t == MediatedTransferExtCmdID {
+		m.TotalAmount = utils.ReadBigInt(buf)
+		if m.TotalAmount.Sign() == 0 {
+			m.TotalAmount = nil
+		}
+		var encryptedSecretLen uint16
+		err = binary.Read(buf, binary.BigEndian, &encryptedSecretLen)
+		if err != nil || int(encryptedSecretLen) > buf.Len() {
+			return errors.New("MediatedTransfer unpack encrypted secret error")
+		}
+		if encryptedSecretLen > 0 {
+			m.EncryptedSecret = make([]byte, encryptedSecretLen)
+			_, err = buf.Read(m.EncryptedSecret)
+		}
+	}
 	err = m.EnvelopMessage.unpack(buf)
 	if err != nil {
 		return err
@@ -1037,15 +1104,17 @@ type AnnounceDisposedProof struct {
 type AnnounceDisposed struct {
 	SignedMessage
 	AnnounceDisposedProof
+	Refused bool // the target refuses this transfer, packed as AnnounceDisposedRefusedCmdID
 }
 
 //String is fmt.Stringer
 func (m *AnnounceDisposed) String() string {
 	return fmt.Sprintf("Message{type=AnnounceDisposed Lock=%s,"+
-		"ChannelIdentifier=%s-%d}",
+		"ChannelIdentifier=%s-%d,refused=%v}",
 		m.Lock,
 		utils.HPex(m.ChannelIdentifier),
 		m.OpenBlockNumber,
+		m.Refused,
 	)
 }
 
@@ -1062,7 +1131,11 @@ func NewAnnounceDisposed(rp *AnnounceDisposedProof) *AnnounceDisposed {
 func (m *AnnounceDisposed) Pack() []byte {
 	var err error
 	buf := new(bytes.Buffer)
-	err = binary.Write(buf, binary.LittleEndian, m.CmdID)
+	cmdID := m.CmdID
+	if m.Refused {
+		cmdID = AnnounceDisposedRefusedCmdID
+	}
+	err = binary.Write(buf, binary.LittleEndian, cmdID)
 	_, err = buf.Write(m.Lock.AsBytes())
 	_, err = buf.Write(m.ChannelIdentifier[:])
 	err = binary.Write(buf, binary.BigEndian, m.OpenBlockNumber)
@@ -1079,10 +1152,11 @@ func (m *AnnounceDisposed) UnPack(data []byte) error {
 	var err error
 	buf := bytes.NewBuffer(data)
 	err = binary.Read(buf, binary.LittleEndian, &t)
-	if t != AnnounceDisposedTransferCmdID {
+	if t != AnnounceDisposedTransferCmdID && t != AnnounceDisposedRefusedCmdID {
 		return fmt.Errorf("AnnounceDisposed UnPack cmd error,expect=%d,got=%d", AnnounceDisposedTransferCmdID, t)
 	}
-	m.CmdID = t
+	m.CmdID = AnnounceDisposedTransferCmdID
+	m.Refused = t == AnnounceDisposedRefusedCmdID
 	m.Lock = new(mtree.Lock)
 	err = m.Lock.FromReader(buf)
 	_, err = buf.Read(m.ChannelIdentifier[:])
@@ -1776,7 +1850,9 @@ var MessageMap = map[int]Messager{
 	DirectTransferCmdID:                   new(DirectTransfer),
 	RevealSecretCmdID:                     new(RevealSecret),
 	MediatedTransferCmdID:                 new(MediatedTransfer),
+	MediatedTransferExtCmdID:              new(MediatedTransfer),
 	AnnounceDisposedTransferCmdID:         new(AnnounceDisposed),
+	AnnounceDisposedRefusedCmdID:          new(AnnounceDisposed),
 	RemoveExpiredLockCmdID:                new(RemoveExpiredHashlockTransfer),
 	AnnounceDisposedTransferResponseCmdID: new(AnnounceDisposedResponse),
 	WithdrawRequestCmdID:                  new(WithdrawRequest),
@@ -180,6 +180,10 @@ func TestMediatedTransfer(t *testing.T) {
 	m1 := NewMediatedTransfer(bp, lock, utils.NewRandomAddress(), utils.NewRandomAddress(), big.NewInt(33))
 	m1.Sign(GetTestPrivKey(), m1)
 	data := m1.Pack()
+	//普通交易保持旧格式,旧版本节点可以解析
+	if data[0] != MediatedTransferCmdID {
+		t.Errorf("cmd=%d", data[0])
+	}
 	m2 := new(MediatedTransfer)
 	m2.UnPack(data)
 	spew.Dump("m1", m1)
@@ -189,6 +193,80 @@ func TestMediatedTransfer(t *testing.T) {
 	}
 }
 
+func TestMediatedTransferEncryptedSecret(t *testing.T) {
+	bp := &BalanceProof{
+		Nonce:             11,
+		ChannelIdentifier: utils.Sha3([]byte("123")),
+		TransferAmount:    big.NewInt(12),
+		OpenBlockNumber:   3,
+		Locksroot:         utils.EmptyHash,
+	}
+	lock := &mtree.Lock{
+		Amount:         big.NewInt(34),
+		Expiration:     4589895, //expiration block number
+		LockSecretHash: utils.ShaSecret([]byte("hashlock")),
+	}
+	m1 := NewMediatedTransfer(bp, lock, utils.NewRandomAddress(), utils.NewRandomAddress(), big.NewInt(33))
+	m1.EncryptedSecret = []byte("encrypted secret")
+	m1.Sign(GetTestPrivKey(), m1)
+	data := m1.Pack()
+	if data[0] != MediatedTransferExtCmdID {
+		t.Errorf("cmd=%d", data[0])
+	}
+	m2 := new(MediatedTransfer)
+	err := m2.UnPack(data)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !reflect.DeepEqual(m1, m2) {
+		t.Error("not equal")
+	}
+}
+
+func TestMediatedTransferTotalAmount(t *testing.T) {
+	bp := &BalanceProof{
+		Nonce:             11,
+		ChannelIdentifier: utils.Sha3([]byte("123")),
+		TransferAmount:    big.NewInt(12),
+		OpenBlockNumber:   3,
+		Locksroot:         utils.EmptyHash,
+	}
+	lock := &mtree.Lock{
+		Amount:         big.NewInt(34),
+		Expiration:     4589895, //expiration block number
+		LockSecretHash: utils.ShaSecret([]byte("hashlock")),
+	}
+	m1 := NewMediatedTransfer(bp, lock, utils.NewRandomAddress(), utils.NewRandomAddress(), big.NewInt(33))
+	oldLen := len(m1.Pack())
+	m1.TotalAmount = big.NewInt(100)
+	if len(m1.Pack()) != oldLen+32+2 {
+		t.Errorf("len=%d, old len=%d", len(m1.Pack()), oldLen)
+	}
+	m1.Sign(GetTestPrivKey(), m1)
+	data := m1.Pack()
+	if data[0] != MediatedTransferExtCmdID {
+		t.Errorf("cmd=%d", data[0])
+	}
+	m2, ok := MessageMap[int(data[0])].(*MediatedTransfer)
+	if !ok {
+		t.Error("unknown message")
+		return
+	}
+	m2 = new(MediatedTransfer)
+	err := m2.UnPack(data)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if m2.TotalAmount == nil || m2.TotalAmount.Cmp(m1.TotalAmount) != 0 {
+		t.Errorf("total amount=%s", m2.TotalAmount)
+	}
+	if m2.Sender != m1.Sender || !bytes.Equal(m2.Pack(), data) {
+		t.Error("not equal")
+	}
+}
+
 func TestNewAnnounceDisposedTransfer(t *testing.T) {
 	bp := &AnnounceDisposedProof{
 		ChannelIDInMessage: ChannelIDInMessage{
@@ -309,6 +387,40 @@ func TestLock_AsBytes(t *testing.T) {
 	//T.Log(lock.AsBytes())
 }
 
+func TestAnnounceDisposedRefused(t *testing.T) {
+	bp := &AnnounceDisposedProof{
+		ChannelIDInMessage: ChannelIDInMessage{
+			ChannelIdentifier: utils.Sha3([]byte("123")),
+			OpenBlockNumber:   3,
+		},
+		Lock: &mtree.Lock{
+			Amount:         big.NewInt(34),
+			Expiration:     4589895, //expiration block number
+			LockSecretHash: utils.ShaSecret([]byte("hashlock")),
+		},
+	}
+	m1 := NewAnnounceDisposed(bp)
+	m1.Refused = true
+	err := m1.Sign(GetTestPrivKey(), m1)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	data := m1.Pack()
+	if data[0] != AnnounceDisposedRefusedCmdID {
+		t.Errorf("cmd=%d", data[0])
+	}
+	m2 := new(AnnounceDisposed)
+	err = m2.UnPack(data)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !reflect.DeepEqual(m1, m2) {
+		t.Error("not equal")
+	}
+}
+
 func TestNewAnnounceDisposedTransferResponse(t *testing.T) {
 	bp := &BalanceProof{
 		Nonce:             11,
@@ -5,12 +5,15 @@ import (
 
 	"errors"
 
+	"math/big"
+
 	"github.com/SmartMeshFoundation/Photon/channel"
 	"github.com/SmartMeshFoundation/Photon/channel/channeltype"
 	"github.com/SmartMeshFoundation/Photon/encoding"
 	"github.com/SmartMeshFoundation/Photon/log"
 	"github.com/SmartMeshFoundation/Photon/models"
 	"github.com/SmartMeshFoundation/Photon/network/graph"
+	"github.com/SmartMeshFoundation/Photon/notify"
 	"github.com/SmartMeshFoundation/Photon/transfer"
 	"github.com/SmartMeshFoundation/Photon/transfer/mediatedtransfer"
 	"github.com/SmartMeshFoundation/Photon/transfer/mediatedtransfer/initiator"
@@ -104,7 +107,13 @@ func (eh *stateMachineEventHandler) eventSendRevealSecret(event *mediatedtransfe
 
 	revealMessage := encoding.NewRevealSecret(event.Secret)
 	// 带上交易附加信息
-	revealMessage.Data = []byte(event.Data)
+	data, err := eh.photon.encryptTransferData(event.Receiver, event.Data)
+	if err != nil {
+		//收款方的 SecretRequest 带有他的公钥,不应该发生,不能以明文发送附加信息,只好不带附加信息
+		log.Error(fmt.Sprintf("RevealSecret to %s without transfer data, err %s", utils.APex2(event.Receiver), err))
+		eh.photon.dao.UpdateTransferStatusMessage(event.Token, event.LockSecretHash, fmt.Sprintf("附加信息无法加密,没有发送 err=%s", err))
+	}
+	revealMessage.Data = []byte(data)
 	err = revealMessage.Sign(eh.photon.PrivateKey, revealMessage)
 	err = eh.photon.sendAsync(event.Receiver, revealMessage) //单独处理 reaveal secret
 	if err == nil {
@@ -148,6 +157,10 @@ func (eh *stateMachineEventHandler) eventSendMediatedTransfer(event *mediatedtra
 		return
 	}
 	//log.Trace(fmt.Sprintf("mtr=%s", utils.StringInterface(mtr, 5)))
+	if event.TotalAmount != nil {
+		mtr.TotalAmount = new(big.Int).Set(event.TotalAmount)
+	}
+	mtr.EncryptedSecret = event.EncryptedSecret
 	err = mtr.Sign(eh.photon.PrivateKey, mtr)
 	err = ch.RegisterTransfer(eh.photon.GetBlockNumber(), mtr)
 	if err != nil {
@@ -238,6 +251,7 @@ func (eh *stateMachineEventHandler) eventSendAnnouncedDisposed(event *mediatedtr
 	if err != nil {
 		return
 	}
+	mtr.Refused = event.Refused
 	err = mtr.Sign(eh.photon.PrivateKey, mtr)
 	err = ch.RegisterAnnouceDisposed(mtr)
 	if err != nil {
@@ -393,6 +407,7 @@ func (eh *stateMachineEventHandler) eventSaveFeeChargeRecord(e *mediatedtransfer
 		OutChannel:     e.OutChannel,
 		Fee:            e.Fee,
 		Timestamp:      e.Timestamp,
+		BlockNumber:    eh.photon.GetBlockNumber(),
 	}
 	return eh.photon.dao.SaveFeeChargeRecord(r)
 }
@@ -431,9 +446,12 @@ func (eh *stateMachineEventHandler) OnEvent(event transfer.Event, stateManager *
 		}
 		st := eh.photon.dao.NewSentTransfer(eh.photon.GetBlockNumber(), e2.ChannelIdentifier, ch.ChannelIdentifier.OpenBlockNumber, ch.TokenAddress, e2.Target, ch.GetNextNonce(), e2.Amount, e2.LockSecretHash, e2.Data)
 		eh.photon.NotifyHandler.NotifySentTransfer(st)
-		eh.finishOneTransfer(event)
+		if !e2.Unfinished {
+			eh.finishOneTransfer(event)
+		}
 	case *transfer.EventTransferSentFailed:
 		eh.photon.dao.UpdateTransferStatus(e2.Token, e2.LockSecretHash, models.TransferStatusFailed, fmt.Sprintf("交易失败 err=%s", e2.Reason))
+		eh.photon.NotifyHandler.NotifyTransferFailed(e2.Token, e2.Target, e2.LockSecretHash, e2.Reason)
 		eh.finishOneTransfer(event)
 	case *transfer.EventTransferReceivedSuccess:
 		ch, err = eh.photon.findChannelByIdentifier(e2.ChannelIdentifier)
@@ -445,8 +463,9 @@ func (eh *stateMachineEventHandler) OnEvent(event transfer.Event, stateManager *
 		if err != nil {
 			log.Error(fmt.Sprintf("UpdateChannelNoTx err %s", err))
 		}
-		rt := eh.photon.dao.NewReceivedTransfer(eh.photon.GetBlockNumber(), e2.ChannelIdentifier, ch.ChannelIdentifier.OpenBlockNumber, ch.TokenAddress, e2.Initiator, ch.PartnerState.BalanceProofState.Nonce, e2.Amount, e2.LockSecretHash, e2.Data)
+		rt := eh.photon.dao.NewReceivedTransfer(eh.photon.GetBlockNumber(), e2.ChannelIdentifier, ch.ChannelIdentifier.OpenBlockNumber, ch.TokenAddress, e2.Initiator, ch.PartnerState.BalanceProofState.Nonce, e2.Amount, e2.LockSecretHash, eh.photon.decryptTransferData(e2.Data))
 		eh.photon.NotifyHandler.NotifyReceiveTransfer(rt)
+		eh.photon.invoicePaid(e2.LockSecretHash, e2.Initiator)
 	case *mediatedtransfer.EventUnlockSuccess:
 	case *mediatedtransfer.EventWithdrawFailed:
 		log.Error(fmt.Sprintf("EventWithdrawFailed hashlock=%s,reason=%s", utils.HPex(e2.LockSecretHash), e2.Reason))
@@ -469,6 +488,20 @@ func (eh *stateMachineEventHandler) OnEvent(event transfer.Event, stateManager *
 		delete(eh.photon.Transfer2StateManager, e2.Key)
 	case *mediatedtransfer.EventSaveFeeChargeRecord:
 		err = eh.eventSaveFeeChargeRecord(e2)
+	case *mediatedtransfer.EventMultiPathProgress:
+		eh.eventMultiPathProgress(e2)
+	case *mediatedtransfer.EventTransferHeld:
+		eh.eventTransferHeld(e2, stateManager)
+	case *mediatedtransfer.EventHeldTransferCanceled:
+		eh.photon.unholdLockSecretHash(e2.LockSecretHash)
+		eh.photon.NotifyHandler.NotifyHeldTransferCanceled(&notify.HeldTransfer{
+			TokenAddress:      e2.Token,
+			LockSecretHash:    e2.LockSecretHash,
+			Initiator:         e2.Initiator,
+			Amount:            e2.Amount,
+			ChannelIdentifier: e2.ChannelIdentifier,
+			Reason:            e2.Reason,
+		})
 	default:
 		err = fmt.Errorf("unkown event :%s", utils.StringInterface1(event))
 		log.Error(err.Error())
@@ -476,6 +509,52 @@ func (eh *stateMachineEventHandler) OnEvent(event transfer.Event, stateManager *
 	return
 }
 
+//eventMultiPathProgress 保存多路径支付每个部分的进度
+func (eh *stateMachineEventHandler) eventMultiPathProgress(e *mediatedtransfer.EventMultiPathProgress) {
+	var parts []*models.TransferPartStatus
+	for _, p := range e.Parts {
+		parts = append(parts, &models.TransferPartStatus{
+			ChannelIdentifier: p.ChannelIdentifier,
+			Partner:           p.Partner,
+			Amount:            p.Amount,
+			Fee:               p.Fee,
+			Status:            p.Status,
+		})
+	}
+	eh.photon.dao.UpdateTransferStatusParts(e.Token, e.LockSecretHash, parts)
+}
+
+/*
+eventTransferHeld 暂停处理的交易不会发送 SecretRequest, 在这里确认收到 MediatedTransfer,
+LastReceivedMessage 保留, 用户接受或者取消的时候还会再用到
+*/
+func (eh *stateMachineEventHandler) eventTransferHeld(e *mediatedtransfer.EventTransferHeld, stateManager *transfer.StateManager) {
+	ch := eh.photon.getChannelWithAddr(e.ChannelIdentifier)
+	if ch == nil {
+		log.Error(fmt.Sprintf("EventTransferHeld %s, but cannot found channel", utils.StringInterface(e, 3)))
+		return
+	}
+	if stateManager.LastReceivedMessage == nil {
+		log.Warn(fmt.Sprintf("EventTransferHeld %s,but has no lastReceviedMessage", utils.StringInterface(e, 3)))
+		err := eh.photon.dao.UpdateChannelNoTx(channel.NewChannelSerialization(ch))
+		if err != nil {
+			log.Error(fmt.Sprintf("UpdateChannelNoTx err %s", err))
+		}
+	} else {
+		eh.photon.updateChannelAndSaveAck(ch, stateManager.LastReceivedMessage.Tag())
+	}
+	eh.photon.NotifyHandler.NotifyTransferHeld(&notify.HeldTransfer{
+		TokenAddress:      e.Token,
+		LockSecretHash:    e.LockSecretHash,
+		Initiator:         e.Initiator,
+		Amount:            e.Amount,
+		ChannelIdentifier: e.ChannelIdentifier,
+		Expiration:        e.Expiration,
+		HoldDeadline:      e.HoldDeadline,
+		SecretKnown:       e.SecretKnown,
+	})
+}
+
 //remove the successful transfer's state manager
 func (eh *stateMachineEventHandler) finishOneTransfer(ev transfer.Event) {
 	var err error
@@ -587,6 +666,7 @@ func (eh *stateMachineEventHandler) handleBalance(st *mediatedtransfer.ContractB
 //1. 必须能够正确处理重复的ContractClosedStateChange
 func (eh *stateMachineEventHandler) handleClosed(st *mediatedtransfer.ContractClosedStateChange) error {
 	channelIdentifier := st.ChannelIdentifier
+	eh.photon.WatchTower.onChannelClosed(st)
 	ch, err := eh.photon.findChannelByIdentifier(channelIdentifier)
 	if err != nil {
 		//i'm not a participant
@@ -653,6 +733,7 @@ func (eh *stateMachineEventHandler) removeSettledChannel(ch *channel.Channel) er
 }
 func (eh *stateMachineEventHandler) handleSettled(st *mediatedtransfer.ContractSettledStateChange) error {
 	log.Trace(fmt.Sprintf("%s settled event handle", utils.HPex(st.ChannelIdentifier)))
+	eh.photon.WatchTower.onChannelSettled(st.ChannelIdentifier)
 	ch, err := eh.photon.findChannelByIdentifier(st.ChannelIdentifier)
 	if err != nil {
 		return nil
@@ -671,6 +752,7 @@ func (eh *stateMachineEventHandler) handleSettled(st *mediatedtransfer.ContractS
 //1. 必须能够正确处理重复的事件
 func (eh *stateMachineEventHandler) handleCooperativeSettled(st *mediatedtransfer.ContractCooperativeSettledStateChange) error {
 	log.Trace(fmt.Sprintf("%s cooperative settled event handle", utils.HPex(st.ChannelIdentifier)))
+	eh.photon.WatchTower.onChannelSettled(st.ChannelIdentifier)
 	ch, err := eh.photon.findChannelByIdentifier(st.ChannelIdentifier)
 	if err != nil {
 		//i'm not a participant
@@ -724,7 +806,9 @@ func (eh *stateMachineEventHandler) handleWithdraw(st *mediatedtransfer.Contract
 		log.Error(fmt.Sprintf("handleBalance ChannelStateTransition err=%s", err))
 		return err
 	}
-	err = eh.photon.dao.UpdateChannelState(channel.NewChannelSerialization(ch))
+	cs := channel.NewChannelSerialization(ch)
+	err = eh.photon.dao.UpdateChannelState(cs)
+	eh.photon.NotifyHandler.NotifyWithdrawResult(cs, nil)
 	// 通知该通道下所有存在pending lock的state manager,可以放心的announce disposed或者尝试新路由了
 	// nofity all statemanager with pending locks, and send announce disposed or try new route.
 	eh.dispatchByPendingLocksInChannel(ch, st)
@@ -816,6 +900,9 @@ func (eh *stateMachineEventHandler) handleSecretRegisteredOnChain(st *mediatedtr
 
 func (eh *stateMachineEventHandler) handleBlockStateChange(st *transfer.BlockStateChange) error {
 	eh.dispatchToAllTasks(st)
+	eh.photon.AutoSettler.onBlock(st.BlockNumber)
+	eh.photon.WatchTower.onBlock(st.BlockNumber)
+	eh.photon.Drain.onBlock(st.BlockNumber)
 	//for _, cg := range eh.photon.Token2ChannelGraph {
 	//	for _, c := range cg.ChannelIdentifier2Channel {
 	//		err := eh.ChannelStateTransition(c, st)
@@ -0,0 +1,162 @@
+package photon
+
+import (
+	"fmt"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/notify"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/transfer"
+	"github.com/SmartMeshFoundation/Photon/transfer/mediatedtransfer"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+接收方可以暂停处理收到的交易(hold), 比如托管服务需要先检查交易再决定是否接收:
+ 1. 通过启动参数 --hold-incoming-transfers 暂停所有交易, 或者通过 HoldTransfer 暂停指定 LockSecretHash 的交易
+ 2. 收到交易以后既不发送 SecretRequest 也不披露密码, 通知用户 transfer_held
+ 3. 用户接受以后和普通交易一样继续, 如果密码是我的(收款请求,keysend)就直接告诉上家
+ 4. 用户取消以后给上家发送 AnnounceDisposed, 上家不再尝试其他路径, 不用等到锁过期
+ 5. 用户迟迟不处理, 到了 Expiration-RevealTimeout 就自动取消, 因为再接受已经不安全了
+
+多路径支付的部分不支持暂停.
+通过 HoldTransfer 指定的 LockSecretHash 保存在数据库中, 重启以后仍然有效, 交易被接受或者取消以后删除.
+*/
+
+// loadHoldLockSecretHashes 重启以后继续暂停之前指定的交易
+func (rs *Service) loadHoldLockSecretHashes() error {
+	hs, err := rs.dao.GetHoldLockSecretHashList()
+	if err != nil {
+		return err
+	}
+	for _, h := range hs {
+		rs.HoldLockSecretHashMap[h] = true
+	}
+	return nil
+}
+
+func (rs *Service) holdTransfer(req *holdTransferReq) (result *utils.AsyncResult) {
+	result = utils.NewAsyncResult()
+	var err error
+	if req.Hold {
+		err = rs.dao.AddHoldLockSecretHash(req.LockSecretHash)
+		if err == nil {
+			rs.HoldLockSecretHashMap[req.LockSecretHash] = true
+		}
+	} else {
+		err = rs.dao.RemoveHoldLockSecretHash(req.LockSecretHash)
+		if err == nil {
+			delete(rs.HoldLockSecretHashMap, req.LockSecretHash)
+		}
+	}
+	result.Result <- err
+	return
+}
+
+// unholdLockSecretHash 暂停的交易已经处理完了,不用再暂停
+func (rs *Service) unholdLockSecretHash(lockSecretHash common.Hash) {
+	if !rs.HoldLockSecretHashMap[lockSecretHash] {
+		return
+	}
+	delete(rs.HoldLockSecretHashMap, lockSecretHash)
+	err := rs.dao.RemoveHoldLockSecretHash(lockSecretHash)
+	if err != nil {
+		log.Error(fmt.Sprintf("RemoveHoldLockSecretHash %s err %s", utils.HPex(lockSecretHash), err))
+	}
+}
+
+func newHeldTransfer(state *mediatedtransfer.TargetState) *notify.HeldTransfer {
+	return &notify.HeldTransfer{
+		TokenAddress:      state.FromTransfer.Token,
+		LockSecretHash:    state.FromTransfer.LockSecretHash,
+		Initiator:         state.FromTransfer.Initiator,
+		Amount:            state.FromTransfer.Amount,
+		ChannelIdentifier: state.FromRoute.ChannelIdentifier,
+		Expiration:        state.FromTransfer.Expiration,
+		HoldDeadline:      state.HoldDeadline,
+		SecretKnown:       state.HeldSecret != utils.EmptyHash,
+	}
+}
+
+func (rs *Service) getHeldTransfers() (result *utils.AsyncResult) {
+	result = utils.NewAsyncResult()
+	var ts []*notify.HeldTransfer
+	for _, manager := range rs.Transfer2StateManager {
+		state, ok := manager.CurrentState.(*mediatedtransfer.TargetState)
+		if ok && state.State == mediatedtransfer.StateHeld {
+			ts = append(ts, newHeldTransfer(state))
+		}
+	}
+	result.Tag = ts
+	result.Result <- nil
+	return
+}
+
+// acceptOrCancelHeldTransfer 用户决定如何处理暂停的交易
+func (rs *Service) acceptOrCancelHeldTransfer(req *heldTransferReq, reqName string) (result *utils.AsyncResult) {
+	result = utils.NewAsyncResult()
+	key := utils.Sha3(req.LockSecretHash[:], req.TokenAddress[:])
+	manager := rs.Transfer2StateManager[key]
+	if manager == nil {
+		result.Result <- rerr.InvalidState("can not find transfer by lock_secret_hash and token_address")
+		return
+	}
+	state, ok := manager.CurrentState.(*mediatedtransfer.TargetState)
+	if !ok || state.State != mediatedtransfer.StateHeld {
+		result.Result <- rerr.InvalidState("transfer is not held")
+		return
+	}
+	rs.unholdLockSecretHash(req.LockSecretHash)
+	var err error
+	var stateChange transfer.StateChange
+	if reqName == acceptHeldTransferReqName {
+		if state.BlockNumber >= state.HoldDeadline {
+			//再接受已经不安全了,只能取消
+			err = rerr.InvalidState("hold deadline passed, transfer is canceled")
+		}
+		stateChange = &mediatedtransfer.ActionAcceptHeldTransferStateChange{
+			LockSecretHash: req.LockSecretHash,
+		}
+	} else {
+		stateChange = &mediatedtransfer.ActionCancelHeldTransferStateChange{
+			LockSecretHash: req.LockSecretHash,
+		}
+	}
+	log.Info(fmt.Sprintf("%s token=%s lockSecretHash=%s", reqName, utils.APex2(req.TokenAddress), utils.HPex(req.LockSecretHash)))
+	rs.StateMachineEventHandler.dispatch(manager, stateChange)
+	result.Result <- err
+	return
+}
+
+/*
+HoldTransfer holds or stops holding the transfer with lockSecretHash that will be received,
+it's useless if node is started with --hold-incoming-transfers, which holds all of them.
+*/
+func (r *API) HoldTransfer(lockSecretHash common.Hash, hold bool) error {
+	result := r.Photon.holdTransferClient(lockSecretHash, hold)
+	return <-result.Result
+}
+
+// GetHeldTransfers transfers received and waiting for accept or cancel
+func (r *API) GetHeldTransfers() (ts []*notify.HeldTransfer, err error) {
+	result := r.Photon.getHeldTransfersClient()
+	err = <-result.Result
+	if err != nil {
+		return
+	}
+	ts, _ = result.Tag.([]*notify.HeldTransfer)
+	return
+}
+
+// AcceptHeldTransfer continues a held transfer as a normal one
+func (r *API) AcceptHeldTransfer(token common.Address, lockSecretHash common.Hash) error {
+	result := r.Photon.acceptOrCancelHeldTransferClient(acceptHeldTransferReqName, token, lockSecretHash)
+	return <-result.Result
+}
+
+// CancelHeldTransfer gives back the lock of a held transfer by AnnounceDisposed
+func (r *API) CancelHeldTransfer(token common.Address, lockSecretHash common.Hash) error {
+	result := r.Photon.acceptOrCancelHeldTransferClient(cancelHeldTransferReqName, token, lockSecretHash)
+	return <-result.Result
+}
@@ -0,0 +1,356 @@
+package photon
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/encoding"
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/network/graph"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/transfer"
+	"github.com/SmartMeshFoundation/Photon/transfer/mediatedtransfer"
+	"github.com/SmartMeshFoundation/Photon/transfer/route"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+收款请求(invoice)由收款方创建, 密码只有收款方知道:
+ 1. 付款方只知道 LockSecretHash, 用它发起交易, 忽略收款方的 SecretRequest
+ 2. 收款方收到 token, 金额都一致并且没有过期的交易, 直接把密码告诉上家换取 unlock
+ 3. 付款方从下家收到 RevealSecret 以后才知道密码, 然后 unlock
+
+编码以后的格式是 InvoicePrefix + base32(payload | signature | checksum),
+只包含大写字母,数字和冒号, 可以使用二维码的字母数字模式.
+收款方的地址从签名中恢复, checksum 用于发现抄写错误, 否则错误的字符串会恢复出另一个地址.
+*/
+
+// InvoicePrefix : prefix of encoded invoice
+const InvoicePrefix = "PHOTON:"
+
+const (
+	invoiceVersion      = 1
+	invoiceChecksumLen  = 4
+	invoiceSignatureLen = 65
+)
+
+var invoiceEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func invoicePayload(i *models.Invoice) []byte {
+	buf := new(bytes.Buffer)
+	buf.WriteByte(invoiceVersion)
+	binary.Write(buf, binary.BigEndian, params.ChainID.Uint64()) //#nosec
+	buf.Write(i.TokenAddress[:])
+	buf.Write(i.LockSecretHash[:])
+	buf.Write(utils.BigIntTo32Bytes(i.Amount))
+	binary.Write(buf, binary.BigEndian, i.Expiry)                   //#nosec
+	binary.Write(buf, binary.BigEndian, uint16(len(i.Description))) //#nosec
+	buf.WriteString(i.Description)
+	buf.WriteByte(byte(len(i.RouteHints)))
+	for _, h := range i.RouteHints {
+		buf.Write(h[:])
+	}
+	return buf.Bytes()
+}
+
+// EncodeInvoice signs invoice with private key of receiver, returns string given to payer
+func EncodeInvoice(i *models.Invoice, privateKey *ecdsa.PrivateKey) (s string, err error) {
+	if len(i.Description) > params.MaxTransferDataLen {
+		return "", fmt.Errorf("description too long, length must < %d", params.MaxTransferDataLen)
+	}
+	if len(i.RouteHints) > params.MaxInvoiceRouteHints {
+		return "", fmt.Errorf("at most %d route hints", params.MaxInvoiceRouteHints)
+	}
+	return signInvoicePayload(invoicePayload(i), privateKey)
+}
+
+func signInvoicePayload(data []byte, privateKey *ecdsa.PrivateKey) (s string, err error) {
+	sig, err := utils.SignData(privateKey, data)
+	if err != nil {
+		return
+	}
+	data = append(data, sig...)
+	checksum := utils.Sha3(data)
+	data = append(data, checksum[:invoiceChecksumLen]...)
+	return InvoicePrefix + invoiceEncoding.EncodeToString(data), nil
+}
+
+// DecodeInvoice verifies checksum, chain and signature of encoded invoice, Receiver is recovered from signature
+func DecodeInvoice(s string) (i *models.Invoice, err error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if !strings.HasPrefix(s, InvoicePrefix) {
+		return nil, errors.New("not an invoice")
+	}
+	data, err := invoiceEncoding.DecodeString(s[len(InvoicePrefix):])
+	if err != nil {
+		return nil, fmt.Errorf("invalid invoice %s", err)
+	}
+	if len(data) < invoiceSignatureLen+invoiceChecksumLen {
+		return nil, errors.New("invoice too short")
+	}
+	checksum := utils.Sha3(data[:len(data)-invoiceChecksumLen])
+	if !bytes.Equal(checksum[:invoiceChecksumLen], data[len(data)-invoiceChecksumLen:]) {
+		return nil, errors.New("invoice checksum mismatch")
+	}
+	data = data[:len(data)-invoiceChecksumLen]
+	payload, sig := data[:len(data)-invoiceSignatureLen], data[len(data)-invoiceSignatureLen:]
+	i = &models.Invoice{}
+	r := bytes.NewReader(payload)
+	version, err := r.ReadByte()
+	if err != nil || version != invoiceVersion {
+		return nil, fmt.Errorf("unknown invoice version %d", version)
+	}
+	var chainID uint64
+	var descLen uint16
+	var hintsLen byte
+	amount := make([]byte, 32)
+	errInvalid := errors.New("invalid invoice")
+	if binary.Read(r, binary.BigEndian, &chainID) != nil {
+		return nil, errInvalid
+	}
+	if _, err = io.ReadFull(r, i.TokenAddress[:]); err != nil {
+		return nil, errInvalid
+	}
+	if _, err = io.ReadFull(r, i.LockSecretHash[:]); err != nil {
+		return nil, errInvalid
+	}
+	if _, err = io.ReadFull(r, amount); err != nil {
+		return nil, errInvalid
+	}
+	i.Amount = new(big.Int).SetBytes(amount)
+	if binary.Read(r, binary.BigEndian, &i.Expiry) != nil {
+		return nil, errInvalid
+	}
+	err = binary.Read(r, binary.BigEndian, &descLen)
+	if err != nil || int(descLen) > r.Len() {
+		return nil, errInvalid
+	}
+	desc := make([]byte, descLen)
+	if _, err = io.ReadFull(r, desc); err != nil {
+		return nil, errInvalid
+	}
+	i.Description = string(desc)
+	hintsLen, err = r.ReadByte()
+	if err != nil || r.Len() != int(hintsLen)*len(common.Address{}) {
+		return nil, errInvalid
+	}
+	for n := 0; n < int(hintsLen); n++ {
+		var h common.Address
+		if _, err = io.ReadFull(r, h[:]); err != nil {
+			return nil, errInvalid
+		}
+		i.RouteHints = append(i.RouteHints, h)
+	}
+	if chainID != params.ChainID.Uint64() {
+		return nil, fmt.Errorf("invoice is for chain %d, but we are on chain %s", chainID, params.ChainID)
+	}
+	i.Receiver, err = utils.Ecrecover(utils.Sha3(payload), sig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid invoice signature %s", err)
+	}
+	i.Encoded = s
+	return
+}
+
+/*
+invoiceSecret 收到的交易是不是在支付我创建的收款请求,
+只有 token, 金额都一致并且还没有过期, 才返回密码
+*/
+func (rs *Service) invoiceSecret(msg *encoding.MediatedTransfer, token common.Address) common.Hash {
+	inv, err := rs.dao.GetInvoice(msg.LockSecretHash)
+	if err != nil {
+		return utils.EmptyHash
+	}
+	var reason string
+	switch {
+	case inv.Status != models.InvoiceStatusUnpaid:
+		reason = "already paid"
+	case inv.TokenAddress != token:
+		reason = fmt.Sprintf("token mismatch, want %s", inv.TokenAddress.String())
+	case msg.PaymentAmount.Cmp(inv.Amount) != 0:
+		reason = fmt.Sprintf("amount mismatch, want %s", inv.Amount)
+	case inv.IsExpired(time.Now().Unix()):
+		reason = "invoice expired"
+	default:
+		return inv.Secret
+	}
+	log.Warn(fmt.Sprintf("receive transfer %s for invoice from %s, but %s", msg, utils.APex2(msg.Initiator), reason))
+	return utils.EmptyHash
+}
+
+// invoicePaid a transfer for our invoice has been unlocked
+func (rs *Service) invoicePaid(lockSecretHash common.Hash, payer common.Address) {
+	if lockSecretHash == utils.EmptyHash {
+		return
+	}
+	inv, err := rs.dao.GetInvoice(lockSecretHash)
+	if err != nil || inv.Status == models.InvoiceStatusPaid {
+		return
+	}
+	inv.Status = models.InvoiceStatusPaid
+	inv.PaidTime = time.Now().Unix()
+	inv.Payer = payer
+	err = rs.dao.SaveInvoice(inv)
+	if err != nil {
+		log.Error(fmt.Sprintf("SaveInvoice %s err %s", lockSecretHash.String(), err))
+	}
+}
+
+/*
+payInvoice 和 token swap 的 taker 一样, 发起交易的时候不知道密码,
+忽略所有的 SecretRequest, 收到 RevealSecret 以后才知道密码.
+*/
+func (rs *Service) payInvoice(req *payInvoiceReq) (result *utils.AsyncResult) {
+	inv := req.Invoice
+	lockSecretHash := inv.LockSecretHash
+	smkey := utils.Sha3(lockSecretHash[:], inv.TokenAddress[:])
+	if rs.Transfer2StateManager[smkey] != nil {
+		result = utils.NewAsyncResult()
+		result.Result <- errors.New("invoice is being paid")
+		return
+	}
+	var stateManager *transfer.StateManager
+	var secretRequestHook SecretRequestPredictor = func(msg *encoding.SecretRequest) (ignore bool) {
+		return true
+	}
+	var receiveRevealSecretHook RevealSecretListener = func(msg *encoding.RevealSecret) (remove bool) {
+		if msg.LockSecretHash() != lockSecretHash {
+			return false
+		}
+		initState, ok := stateManager.CurrentState.(*mediatedtransfer.InitiatorState)
+		if ok {
+			initState.Transfer.Secret = msg.LockSecret
+			initState.Secret = msg.LockSecret
+		}
+		delete(rs.SecretRequestPredictorMap, lockSecretHash)
+		return true
+	}
+	rs.dao.NewTransferStatus(inv.TokenAddress, lockSecretHash)
+	result, stateManager = rs.startMediatedTransferInternal(inv.TokenAddress, inv.Receiver, inv.Amount, utils.BigInt0, lockSecretHash, 0, utils.EmptyHash, "", nil, inv.RouteHints)
+	result.LockSecretHash = lockSecretHash
+	if stateManager == nil {
+		return
+	}
+	rs.SecretRequestPredictorMap[lockSecretHash] = secretRequestHook
+	rs.RevealSecretListenerMap[lockSecretHash] = receiveRevealSecretHook
+	return
+}
+
+/*
+routesFromHints 找不到到收款方的路由时使用收款请求中的路由提示,
+提示的节点和收款方有通道, 其中和我有通道的可以作为第一跳, 手续费只有这一个中间节点的.
+*/
+func (rs *Service) routesFromHints(g *graph.ChannelGraph, amount, targetAmount *big.Int, routeHints []common.Address) (routes []*route.State) {
+	for _, hint := range routeHints {
+		c := g.GetPartenerAddress2Channel(hint)
+		if c == nil || !c.CanTransfer() || amount.Cmp(c.Distributable()) > 0 {
+			continue
+		}
+		if _, isOnline := rs.Protocol.GetNetworkStatus(hint); !isOnline {
+			continue
+		}
+		r := graph.Channel2RouteState(c, hint, targetAmount, rs)
+		r.TotalFee = r.Fee
+		routes = append(routes, r)
+	}
+	if len(routes) > 0 {
+		log.Info(fmt.Sprintf("no route found, use %d route hints of invoice", len(routes)))
+	}
+	return
+}
+
+/*
+CreateInvoice creates a payment request of amount token, the secret is random and known only by us.
+expiry is in seconds, params.DefaultInvoiceExpiry if it's 0.
+*/
+func (r *API) CreateInvoice(token common.Address, amount *big.Int, expiry int64, description string, routeHints []common.Address) (inv *models.Invoice, err error) {
+	if amount == nil || amount.Cmp(utils.BigInt0) <= 0 {
+		return nil, rerr.ErrInvalidAmount
+	}
+	if expiry < 0 {
+		return nil, errors.New("invalid expiry")
+	}
+	if expiry == 0 {
+		expiry = int64(params.DefaultInvoiceExpiry / time.Second)
+	}
+	tokens, err := r.Photon.dao.GetAllTokens()
+	if err != nil {
+		return
+	}
+	if _, ok := tokens[token]; !ok {
+		return nil, errors.New("token not exist")
+	}
+	secret := utils.NewRandomHash()
+	now := time.Now().Unix()
+	inv = &models.Invoice{
+		LockSecretHash: utils.ShaSecret(secret[:]),
+		Secret:         secret,
+		TokenAddress:   token,
+		Receiver:       r.Photon.NodeAddress,
+		Amount:         new(big.Int).Set(amount),
+		Expiry:         now + expiry,
+		Description:    description,
+		RouteHints:     routeHints,
+		Status:         models.InvoiceStatusUnpaid,
+		CreateTime:     now,
+	}
+	inv.Encoded, err = EncodeInvoice(inv, r.Photon.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	err = r.Photon.dao.SaveInvoice(inv)
+	return
+}
+
+// GetInvoice invoice created by us
+func (r *API) GetInvoice(lockSecretHash common.Hash) (*models.Invoice, error) {
+	return r.Photon.dao.GetInvoice(lockSecretHash)
+}
+
+// GetInvoiceList all invoices created by us
+func (r *API) GetInvoiceList() ([]*models.Invoice, error) {
+	return r.Photon.dao.GetInvoiceList()
+}
+
+// DecodeInvoice decodes and verifies an invoice without paying it
+func (r *API) DecodeInvoice(encoded string) (*models.Invoice, error) {
+	return DecodeInvoice(encoded)
+}
+
+/*
+PayInvoice pays amount of token to receiver of invoice with the lock secret hash of it,
+receiver reveals the secret only if token, amount and expiry match.
+*/
+func (r *API) PayInvoice(encoded string) (result *utils.AsyncResult, err error) {
+	if r.Photon.StopCreateNewTransfers {
+		return nil, rerr.ErrStopCreateNewTransfer
+	}
+	inv, err := DecodeInvoice(encoded)
+	if err != nil {
+		return
+	}
+	if inv.Receiver == r.Photon.NodeAddress {
+		return nil, rerr.ErrSamePeerAddress
+	}
+	if inv.Amount.Cmp(utils.BigInt0) <= 0 {
+		return nil, rerr.ErrInvalidAmount
+	}
+	if inv.IsExpired(time.Now().Unix()) {
+		return nil, errors.New("invoice expired")
+	}
+	log.Debug(fmt.Sprintf("pay invoice %s receiver=%s token=%s amount=%s",
+		inv.LockSecretHash.String(), inv.Receiver.String(), inv.TokenAddress.String(), inv.Amount))
+	result = r.Photon.payInvoiceClient(inv)
+	return
+}
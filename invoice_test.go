@@ -0,0 +1,76 @@
+package photon
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeInvoice(t *testing.T) {
+	key, addr := utils.MakePrivateKeyAddress()
+	secret := utils.NewRandomHash()
+	inv := &models.Invoice{
+		LockSecretHash: utils.ShaSecret(secret[:]),
+		Secret:         secret,
+		TokenAddress:   utils.NewRandomAddress(),
+		Amount:         big.NewInt(12345),
+		Expiry:         time.Now().Unix() + 60,
+		Description:    "two coffee",
+		RouteHints:     []common.Address{utils.NewRandomAddress(), utils.NewRandomAddress()},
+	}
+	s, err := EncodeInvoice(inv, key)
+	assert.Empty(t, err)
+	assert.True(t, strings.HasPrefix(s, InvoicePrefix))
+	//二维码字母数字模式只有大写字母
+	assert.Equal(t, strings.ToUpper(s), s)
+
+	inv2, err := DecodeInvoice(strings.ToLower(s))
+	assert.Empty(t, err)
+	assert.Equal(t, addr, inv2.Receiver)
+	assert.Equal(t, inv.LockSecretHash, inv2.LockSecretHash)
+	assert.Equal(t, inv.TokenAddress, inv2.TokenAddress)
+	assert.Equal(t, inv.Amount, inv2.Amount)
+	assert.Equal(t, inv.Expiry, inv2.Expiry)
+	assert.Equal(t, inv.Description, inv2.Description)
+	assert.Equal(t, inv.RouteHints, inv2.RouteHints)
+	assert.Equal(t, utils.EmptyHash, inv2.Secret)
+
+	//a typo must be detected by checksum
+	b := []byte(s)
+	if b[20] == 'A' {
+		b[20] = 'B'
+	} else {
+		b[20] = 'A'
+	}
+	_, err = DecodeInvoice(string(b))
+	assert.NotEmpty(t, err)
+	_, err = DecodeInvoice("PHOTON:")
+	assert.NotEmpty(t, err)
+	_, err = DecodeInvoice(s[len(InvoicePrefix):])
+	assert.NotEmpty(t, err)
+}
+
+//a signed invoice cut short must not be decoded with zero values
+func TestDecodeInvoiceTruncated(t *testing.T) {
+	key, _ := utils.MakePrivateKeyAddress()
+	inv := &models.Invoice{
+		LockSecretHash: utils.NewRandomHash(),
+		TokenAddress:   utils.NewRandomAddress(),
+		Amount:         big.NewInt(12345),
+		Expiry:         time.Now().Unix() + 60,
+		Description:    "two coffee",
+	}
+	payload := invoicePayload(inv)
+	for _, n := range []int{1, 5, 30, 60, 90, len(payload) - 1} {
+		s, err := signInvoicePayload(payload[:n], key)
+		assert.Empty(t, err)
+		_, err = DecodeInvoice(s)
+		assert.NotEmpty(t, err, "payload of %d bytes", n)
+	}
+}
@@ -0,0 +1,455 @@
+package jsonrpc
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/SmartMeshFoundation/Photon"
+	"github.com/SmartMeshFoundation/Photon/channel/channeltype"
+	"github.com/SmartMeshFoundation/Photon/dto"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/pfsproxy"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// PhotonService methods of photon.API for JSON-RPC
+type PhotonService struct {
+	api *photon.API
+}
+
+/*
+NewPhotonServer create a server with all methods of PhotonService,
+method names are `photon_` followed by the name in lower camel case.
+*/
+func NewPhotonServer(api *photon.API) *Server {
+	s := NewServer()
+	ps := &PhotonService{api: api}
+	read := models.APITokenScopeRead
+	transfer := models.APITokenScopeTransfer
+	channel := models.APITokenScopeChannel
+	debug := models.APITokenScopeDebug
+	// accounts
+	s.Register("photon_address", read, ps.Address)
+	s.Register("photon_tokens", read, ps.Tokens)
+	s.Register("photon_getBalance", read, ps.GetBalance)
+	// channels
+	s.Register("photon_getChannelList", read, ps.GetChannelList)
+	s.Register("photon_getChannel", read, ps.GetChannel)
+	s.Register("photon_openChannel", channel, ps.OpenChannel)
+	s.Register("photon_deposit", channel, ps.Deposit)
+	s.Register("photon_closeChannel", channel, ps.CloseChannel)
+	s.Register("photon_settleChannel", channel, ps.SettleChannel)
+	s.Register("photon_withdraw", channel, ps.Withdraw)
+	// transfers
+	s.Register("photon_transfer", transfer, ps.Transfer)
+	s.Register("photon_getTransferStatus", read, ps.GetTransferStatus)
+	s.Register("photon_cancelTransfer", transfer, ps.CancelTransfer)
+	s.Register("photon_allowRevealSecret", transfer, ps.AllowRevealSecret)
+	s.Register("photon_registerSecret", transfer, ps.RegisterSecret)
+	s.Register("photon_tokenSwap", transfer, ps.TokenSwap)
+	// utils
+	s.Register("photon_getFeePolicy", read, ps.GetFeePolicy)
+	s.Register("photon_setFeePolicy", channel, ps.SetFeePolicy)
+	s.Register("photon_findPath", read, ps.FindPath)
+	s.Register("photon_systemStatus", debug, ps.SystemStatus)
+	return s
+}
+
+// ChannelResult same as channel of restful api
+type ChannelResult struct {
+	ChannelIdentifier   common.Hash       `json:"channel_identifier"`
+	OpenBlockNumber     int64             `json:"open_block_number"`
+	PartnerAddress      common.Address    `json:"partner_address"`
+	Balance             *big.Int          `json:"balance"`
+	PartnerBalance      *big.Int          `json:"partner_balance"`
+	LockedAmount        *big.Int          `json:"locked_amount"`
+	PartnerLockedAmount *big.Int          `json:"partner_locked_amount"`
+	TokenAddress        common.Address    `json:"token_address"`
+	State               channeltype.State `json:"state"`
+	StateString         string            `json:"state_string"`
+	SettleTimeout       int               `json:"settle_timeout"`
+	RevealTimeout       int               `json:"reveal_timeout"`
+}
+
+func newChannelResult(c *channeltype.Serialization) *ChannelResult {
+	return &ChannelResult{
+		ChannelIdentifier:   c.ChannelIdentifier.ChannelIdentifier,
+		OpenBlockNumber:     c.ChannelIdentifier.OpenBlockNumber,
+		PartnerAddress:      c.PartnerAddress(),
+		Balance:             c.OurBalance(),
+		PartnerBalance:      c.PartnerBalance(),
+		LockedAmount:        c.OurAmountLocked(),
+		PartnerLockedAmount: c.PartnerAmountLocked(),
+		TokenAddress:        c.TokenAddress(),
+		State:               c.State,
+		StateString:         c.State.String(),
+		SettleTimeout:       c.SettleTimeout,
+		RevealTimeout:       c.RevealTimeout,
+	}
+}
+
+func invalidParams(format string, a ...interface{}) error {
+	return &Error{Code: CodeInvalidParams, Message: fmt.Sprintf(format, a...)}
+}
+
+// Address of this node
+func (ps *PhotonService) Address(ctx *Context) (common.Address, error) {
+	return ps.api.Address(), nil
+}
+
+// Tokens registered
+func (ps *PhotonService) Tokens(ctx *Context) ([]common.Address, error) {
+	return ps.api.Tokens(), nil
+}
+
+// TokenParams :
+type TokenParams struct {
+	TokenAddress common.Address `json:"token_address"`
+}
+
+// GetBalance balance of token on chain and in channels, all tokens if token_address is empty
+func (ps *PhotonService) GetBalance(ctx *Context, p *TokenParams) ([]*photon.AccountTokenBalanceVo, error) {
+	return ps.api.GetBalanceByTokenAddress(p.TokenAddress)
+}
+
+// ChannelListParams empty address means no filter
+type ChannelListParams struct {
+	TokenAddress   common.Address `json:"token_address"`
+	PartnerAddress common.Address `json:"partner_address"`
+}
+
+// GetChannelList :
+func (ps *PhotonService) GetChannelList(ctx *Context, p *ChannelListParams) ([]*ChannelResult, error) {
+	cs, err := ps.api.GetChannelList(p.TokenAddress, p.PartnerAddress)
+	if err != nil {
+		return nil, err
+	}
+	rs := []*ChannelResult{}
+	for _, c := range cs {
+		rs = append(rs, newChannelResult(c))
+	}
+	return rs, nil
+}
+
+// ChannelParams :
+type ChannelParams struct {
+	ChannelIdentifier common.Hash `json:"channel_identifier"`
+}
+
+func (ps *PhotonService) getChannel(channelIdentifier common.Hash) (*channeltype.Serialization, error) {
+	if channelIdentifier == utils.EmptyHash {
+		return nil, invalidParams("channel_identifier required")
+	}
+	return ps.api.GetChannel(channelIdentifier)
+}
+
+// GetChannel :
+func (ps *PhotonService) GetChannel(ctx *Context, p *ChannelParams) (*ChannelResult, error) {
+	c, err := ps.getChannel(p.ChannelIdentifier)
+	if err != nil {
+		return nil, err
+	}
+	return newChannelResult(c), nil
+}
+
+// DepositParams settle_timeout is used only when open channel, 0 means the default one
+type DepositParams struct {
+	TokenAddress   common.Address `json:"token_address"`
+	PartnerAddress common.Address `json:"partner_address"`
+	Balance        *big.Int       `json:"balance"`
+	SettleTimeout  int            `json:"settle_timeout"`
+}
+
+func (ps *PhotonService) deposit(p *DepositParams, newChannel bool) (*ChannelResult, error) {
+	if p.Balance == nil {
+		return nil, invalidParams("balance required")
+	}
+	if !newChannel {
+		p.SettleTimeout = 0
+	}
+	c, err := ps.api.DepositAndOpenChannel(p.TokenAddress, p.PartnerAddress, p.SettleTimeout, 0, p.Balance, newChannel)
+	if err != nil {
+		return nil, err
+	}
+	return newChannelResult(c), nil
+}
+
+// OpenChannel open a channel with deposit
+func (ps *PhotonService) OpenChannel(ctx *Context, p *DepositParams) (*ChannelResult, error) {
+	return ps.deposit(p, true)
+}
+
+// Deposit to a channel opened
+func (ps *PhotonService) Deposit(ctx *Context, p *DepositParams) (*ChannelResult, error) {
+	return ps.deposit(p, false)
+}
+
+// CloseChannelParams cooperative settle the channel if not force
+type CloseChannelParams struct {
+	ChannelIdentifier common.Hash `json:"channel_identifier"`
+	Force             bool        `json:"force"`
+}
+
+// CloseChannel :
+func (ps *PhotonService) CloseChannel(ctx *Context, p *CloseChannelParams) (*ChannelResult, error) {
+	c, err := ps.getChannel(p.ChannelIdentifier)
+	if err != nil {
+		return nil, err
+	}
+	if p.Force {
+		c, err = ps.api.Close(c.TokenAddress(), c.PartnerAddress())
+	} else {
+		c, err = ps.api.CooperativeSettle(c.TokenAddress(), c.PartnerAddress())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newChannelResult(c), nil
+}
+
+// SettleChannel settle a closed channel
+func (ps *PhotonService) SettleChannel(ctx *Context, p *ChannelParams) (*ChannelResult, error) {
+	c, err := ps.getChannel(p.ChannelIdentifier)
+	if err != nil {
+		return nil, err
+	}
+	c, err = ps.api.Settle(c.TokenAddress(), c.PartnerAddress())
+	if err != nil {
+		return nil, err
+	}
+	return newChannelResult(c), nil
+}
+
+// WithdrawParams withdraw amount if it's positive, otherwise do op: preparewithdraw or cancelprepare
+type WithdrawParams struct {
+	ChannelIdentifier common.Hash `json:"channel_identifier"`
+	Amount            *big.Int    `json:"amount"`
+	Op                string      `json:"op"`
+}
+
+// Withdraw :
+func (ps *PhotonService) Withdraw(ctx *Context, p *WithdrawParams) (*ChannelResult, error) {
+	c, err := ps.getChannel(p.ChannelIdentifier)
+	if err != nil {
+		return nil, err
+	}
+	if p.Amount != nil && p.Amount.Cmp(utils.BigInt0) > 0 {
+		c, err = ps.api.Withdraw(c.TokenAddress(), c.PartnerAddress(), p.Amount)
+	} else if p.Op == "preparewithdraw" {
+		c, err = ps.api.PrepareForWithdraw(c.TokenAddress(), c.PartnerAddress())
+	} else if p.Op == "cancelprepare" {
+		c, err = ps.api.CancelPrepareForWithdraw(c.TokenAddress(), c.PartnerAddress())
+	} else {
+		err = invalidParams("unkown operation %s", p.Op)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newChannelResult(c), nil
+}
+
+// TransferParams same as restful api, secret is random if it's empty
+type TransferParams struct {
+	TokenAddress  common.Address `json:"token_address"`
+	TargetAddress common.Address `json:"target_address"`
+	Amount        *big.Int       `json:"amount"`
+	Fee           *big.Int       `json:"fee"`
+	Secret        common.Hash    `json:"secret"`
+	IsDirect      bool           `json:"is_direct"`
+	Sync          bool           `json:"sync"`
+	Data          string         `json:"data"`
+	MultiPath     bool           `json:"multi_path"`
+	MaxParts      int            `json:"max_parts"`
+	Keysend       bool           `json:"keysend"`
+	// optional if public key of target has been learned
+	TargetPublicKey hexutil.Bytes `json:"target_public_key"`
+}
+
+// TransferResult :
+type TransferResult struct {
+	LockSecretHash common.Hash `json:"lock_secret_hash"`
+}
+
+/*
+Transfer start a transfer,
+wait until it finished if sync, otherwise returns as soon as it started.
+*/
+func (ps *PhotonService) Transfer(ctx *Context, p *TransferParams) (*TransferResult, error) {
+	if ps.api.Photon.StopCreateNewTransfers {
+		return nil, rerr.ErrStopCreateNewTransfer
+	}
+	if p.Amount == nil || p.Amount.Cmp(utils.BigInt0) <= 0 {
+		return nil, rerr.ErrInvalidAmount
+	}
+	if p.Fee == nil {
+		p.Fee = big.NewInt(0)
+	}
+	if p.Fee.Cmp(utils.BigInt0) < 0 {
+		return nil, invalidParams("invalid fee")
+	}
+	maxDataLen := params.MaxTransferDataLen
+	if p.IsDirect {
+		maxDataLen = params.MaxDirectTransferDataLen
+	}
+	if len(p.Data) > maxDataLen {
+		return nil, invalidParams("invalid data, length must < %d", maxDataLen)
+	}
+	if p.MultiPath && (p.IsDirect || p.Secret != utils.EmptyHash || p.Fee.Cmp(utils.BigInt0) > 0) {
+		return nil, invalidParams("multi_path cannot be used with is_direct, secret or fee")
+	}
+	if p.Keysend && (p.IsDirect || p.MultiPath || p.Secret != utils.EmptyHash || p.Fee.Cmp(utils.BigInt0) > 0) {
+		return nil, invalidParams("keysend cannot be used with is_direct, multi_path, secret or fee")
+	}
+	spent := new(big.Int).Add(p.Amount, p.Fee)
+	err := ctx.spend(p.TokenAddress, spent)
+	if err != nil {
+		return nil, err
+	}
+	var result *utils.AsyncResult
+	if p.MultiPath {
+		result, err = ps.api.MultiPathTransfer(p.TokenAddress, p.Amount, p.TargetAddress, p.MaxParts, p.Data)
+	} else if p.Keysend {
+		result, err = ps.api.KeysendTransfer(p.TokenAddress, p.Amount, p.TargetAddress, p.TargetPublicKey, p.Data)
+	} else {
+		result, err = ps.api.TransferInternal(p.TokenAddress, p.Amount, p.Fee, p.TargetAddress, p.Secret, p.IsDirect, p.Data)
+	}
+	if err != nil {
+		ctx.refund(p.TokenAddress, spent)
+		return nil, err
+	}
+	if p.Sync {
+		err = ps.api.WaitTransfer(result, params.MaxRequestTimeout)
+	} else {
+		err = ps.api.WaitTransferStarted(result)
+	}
+	if err != nil {
+		// 超时的交易仍然可能成功
+		if err != rerr.ErrTransferTimeout {
+			ctx.refund(p.TokenAddress, spent)
+		}
+		return nil, err
+	}
+	return &TransferResult{LockSecretHash: result.LockSecretHash}, nil
+}
+
+// LockSecretHashParams :
+type LockSecretHashParams struct {
+	TokenAddress   common.Address `json:"token_address"`
+	LockSecretHash common.Hash    `json:"lock_secret_hash"`
+}
+
+// GetTransferStatus status of transfer sent
+func (ps *PhotonService) GetTransferStatus(ctx *Context, p *LockSecretHashParams) (*models.TransferStatus, error) {
+	return ps.api.Photon.GetDao().GetTransferStatus(p.TokenAddress, p.LockSecretHash)
+}
+
+// CancelTransfer cancel a transfer whose secret is not revealed
+func (ps *PhotonService) CancelTransfer(ctx *Context, p *LockSecretHashParams) (interface{}, error) {
+	return nil, ps.api.CancelTransfer(p.LockSecretHash, p.TokenAddress)
+}
+
+// AllowRevealSecret allow revealing secret of transfer with secret specified
+func (ps *PhotonService) AllowRevealSecret(ctx *Context, p *LockSecretHashParams) (interface{}, error) {
+	return nil, ps.api.AllowRevealSecret(p.LockSecretHash, p.TokenAddress)
+}
+
+// SecretParams :
+type SecretParams struct {
+	TokenAddress common.Address `json:"token_address"`
+	Secret       common.Hash    `json:"secret"`
+}
+
+// RegisterSecret :
+func (ps *PhotonService) RegisterSecret(ctx *Context, p *SecretParams) (interface{}, error) {
+	return nil, ps.api.RegisterSecret(p.Secret, p.TokenAddress)
+}
+
+// TokenSwapParams same as restful api, role is maker or taker
+type TokenSwapParams struct {
+	Role            string         `json:"role"`
+	TargetAddress   common.Address `json:"target_address"`
+	LockSecretHash  common.Hash    `json:"lock_secret_hash"`
+	SendingToken    common.Address `json:"sending_token"`
+	SendingAmount   *big.Int       `json:"sending_amount"`
+	ReceivingToken  common.Address `json:"receiving_token"`
+	ReceivingAmount *big.Int       `json:"receiving_amount"`
+	Secret          common.Hash    `json:"secret"`
+}
+
+// TokenSwap :
+func (ps *PhotonService) TokenSwap(ctx *Context, p *TokenSwapParams) (interface{}, error) {
+	if ps.api.Photon.StopCreateNewTransfers {
+		return nil, rerr.ErrStopCreateNewTransfer
+	}
+	if p.LockSecretHash == utils.EmptyHash || p.SendingAmount == nil || p.ReceivingAmount == nil {
+		return nil, invalidParams("lock_secret_hash, sending_amount and receiving_amount required")
+	}
+	var err error
+	switch p.Role {
+	case "maker":
+		if utils.ShaSecret(p.Secret.Bytes()) != p.LockSecretHash {
+			return nil, invalidParams("must provide a matching pair of secret and lockSecretHash")
+		}
+		err = ctx.spend(p.SendingToken, p.SendingAmount)
+		if err != nil {
+			return nil, err
+		}
+		err = ps.api.TokenSwapAndWait(p.LockSecretHash.String(), p.SendingToken, p.ReceivingToken,
+			ps.api.Photon.NodeAddress, p.TargetAddress, p.SendingAmount, p.ReceivingAmount, p.Secret.String())
+		if err != nil {
+			ctx.refund(p.SendingToken, p.SendingAmount)
+		}
+	case "taker":
+		err = ctx.spend(p.ReceivingToken, p.ReceivingAmount)
+		if err != nil {
+			return nil, err
+		}
+		err = ps.api.ExpectTokenSwap(p.LockSecretHash.String(), p.ReceivingToken, p.SendingToken,
+			p.TargetAddress, ps.api.Photon.NodeAddress, p.ReceivingAmount, p.SendingAmount)
+		if err != nil {
+			ctx.refund(p.ReceivingToken, p.ReceivingAmount)
+		}
+	default:
+		err = invalidParams("invalid token swap role %s", p.Role)
+	}
+	return nil, err
+}
+
+// GetFeePolicy :
+func (ps *PhotonService) GetFeePolicy(ctx *Context) (*models.FeePolicy, error) {
+	return ps.api.GetFeePolicy()
+}
+
+// SetFeePolicy :
+func (ps *PhotonService) SetFeePolicy(ctx *Context, p *models.FeePolicy) (interface{}, error) {
+	return nil, ps.api.SetFeePolicy(p)
+}
+
+// FindPathParams :
+type FindPathParams struct {
+	TargetAddress common.Address `json:"target_address"`
+	TokenAddress  common.Address `json:"token_address"`
+	Amount        *big.Int       `json:"amount"`
+}
+
+// FindPath find path by pathfinder
+func (ps *PhotonService) FindPath(ctx *Context, p *FindPathParams) ([]pfsproxy.FindPathResponse, error) {
+	if p.Amount == nil {
+		return nil, rerr.ErrInvalidAmount
+	}
+	return ps.api.FindPath(p.TargetAddress, p.TokenAddress, p.Amount)
+}
+
+// SystemStatus :
+func (ps *PhotonService) SystemStatus(ctx *Context) (interface{}, error) {
+	resp := ps.api.SystemStatus()
+	if resp.ErrorCode != dto.SUCCESS {
+		return nil, errors.New(resp.ErrorMsg)
+	}
+	return resp.Data, nil
+}
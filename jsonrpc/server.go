@@ -0,0 +1,351 @@
+package jsonrpc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"reflect"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const jsonrpcVersion = "2.0"
+
+// error codes defined by JSON-RPC 2.0
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+// Error of JSON-RPC 2.0 response
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s", e.Code, e.Message)
+}
+
+// request of JSON-RPC 2.0, request without id is a notification
+type request struct {
+	Version string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type response struct {
+	Version string
+	Result  interface{}
+	Error   *Error
+	ID      json.RawMessage
+}
+
+// MarshalJSON response has either result, which may be null, or error
+func (r *response) MarshalJSON() ([]byte, error) {
+	if r.Error != nil {
+		return json.Marshal(&struct {
+			Version string          `json:"jsonrpc"`
+			Error   *Error          `json:"error"`
+			ID      json.RawMessage `json:"id"`
+		}{r.Version, r.Error, r.ID})
+	}
+	return json.Marshal(&struct {
+		Version string          `json:"jsonrpc"`
+		Result  interface{}     `json:"result"`
+		ID      json.RawMessage `json:"id"`
+	}{r.Version, r.Result, r.ID})
+}
+
+/*
+Context of a call.
+Scope is the set of scopes granted to the caller,
+Spend checks and records amount sent by the caller, nil means no limit,
+Refund gives back amount recorded by Spend when the transfer is not sent or failed.
+*/
+type Context struct {
+	Scope  models.APITokenScope
+	Spend  func(token common.Address, amount *big.Int) error
+	Refund func(token common.Address, amount *big.Int)
+}
+
+func (ctx *Context) spend(token common.Address, amount *big.Int) error {
+	if ctx.Spend == nil {
+		return nil
+	}
+	return ctx.Spend(token, amount)
+}
+
+func (ctx *Context) refund(token common.Address, amount *big.Int) {
+	if ctx.Refund == nil {
+		return
+	}
+	ctx.Refund(token, amount)
+}
+
+type method struct {
+	scope   models.APITokenScope
+	fn      reflect.Value
+	argType reflect.Type // nil if method has no params
+}
+
+var (
+	contextType = reflect.TypeOf(&Context{})
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+/*
+Server of JSON-RPC 2.0, requests are processed by methods registered.
+*/
+type Server struct {
+	methods map[string]*method
+}
+
+// NewServer create a server without any method
+func NewServer() *Server {
+	return &Server{
+		methods: make(map[string]*method),
+	}
+}
+
+/*
+Register add method name to s, only callers with scope can call it.
+fn must be func(*Context, *Params) (Result, error) or func(*Context) (Result, error),
+params of request are decoded to Params by name, or by position if it's an array of one element.
+*/
+func (s *Server) Register(name string, scope models.APITokenScope, fn interface{}) {
+	v := reflect.ValueOf(fn)
+	t := v.Type()
+	if t.Kind() != reflect.Func || t.NumIn() < 1 || t.NumIn() > 2 || t.In(0) != contextType ||
+		t.NumOut() != 2 || t.Out(1) != errorType {
+		panic(fmt.Sprintf("jsonrpc method %s has wrong signature %s", name, t))
+	}
+	m := &method{
+		scope: scope,
+		fn:    v,
+	}
+	if t.NumIn() == 2 {
+		if t.In(1).Kind() != reflect.Ptr {
+			panic(fmt.Sprintf("params of jsonrpc method %s must be a pointer", name))
+		}
+		m.argType = t.In(1).Elem()
+	}
+	s.methods[name] = m
+}
+
+// Methods names of all methods
+func (s *Server) Methods() (names []string) {
+	for name := range s.methods {
+		names = append(names, name)
+	}
+	return
+}
+
+func newErrorResponse(id json.RawMessage, code int, msg string) *response {
+	return newErrorResponseOf(id, &Error{Code: code, Message: msg})
+}
+
+func newErrorResponseOf(id json.RawMessage, e *Error) *response {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	return &response{
+		Version: jsonrpcVersion,
+		Error:   e,
+		ID:      id,
+	}
+}
+
+// errorOf convert error returned by methods to Error
+func errorOf(err error) *Error {
+	if e, ok := err.(*Error); ok {
+		return e
+	}
+	if err == models.ErrSpendingCapExceeded {
+		return &Error{Code: rerr.CodeSpendingCapExceeded, Message: err.Error()}
+	}
+	return &Error{Code: rerr.ErrorCode(err), Message: err.Error()}
+}
+
+func (m *method) decodeParams(params json.RawMessage) (arg reflect.Value, err error) {
+	arg = reflect.New(m.argType)
+	params = bytes.TrimSpace(params)
+	if len(params) == 0 || bytes.Equal(params, []byte("null")) {
+		return
+	}
+	if params[0] == '[' {
+		var ps []json.RawMessage
+		err = json.Unmarshal(params, &ps)
+		if err != nil {
+			return
+		}
+		if len(ps) > 1 {
+			err = fmt.Errorf("too many params, expect one object")
+			return
+		}
+		if len(ps) == 0 {
+			return
+		}
+		params = ps[0]
+	}
+	err = json.Unmarshal(params, arg.Interface())
+	return
+}
+
+// call process one request, nil if it's a notification
+func (s *Server) call(ctx *Context, req *request) (resp *response) {
+	isNotification := req.ID == nil
+	defer func() {
+		if isNotification {
+			resp = nil
+		}
+	}()
+	if req.Version != jsonrpcVersion || req.Method == "" {
+		return newErrorResponse(req.ID, CodeInvalidRequest, "invalid request")
+	}
+	m, ok := s.methods[req.Method]
+	if !ok {
+		return newErrorResponse(req.ID, CodeMethodNotFound, fmt.Sprintf("method %s not found", req.Method))
+	}
+	if !ctx.Scope.Has(m.scope) {
+		return newErrorResponse(req.ID, rerr.CodeInsufficientPermission, fmt.Sprintf("scope %s required", m.scope))
+	}
+	args := []reflect.Value{reflect.ValueOf(ctx)}
+	if m.argType != nil {
+		arg, err := m.decodeParams(req.Params)
+		if err != nil {
+			return newErrorResponse(req.ID, CodeInvalidParams, err.Error())
+		}
+		args = append(args, arg)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error(fmt.Sprintf("jsonrpc method %s panic %v", req.Method, r))
+			resp = newErrorResponse(req.ID, CodeInternalError, fmt.Sprintf("%v", r))
+		}
+	}()
+	outs := m.fn.Call(args)
+	if err, _ := outs[1].Interface().(error); err != nil {
+		log.Trace(fmt.Sprintf("jsonrpc call %s err %s", req.Method, err))
+		return newErrorResponseOf(req.ID, errorOf(err))
+	}
+	return &response{
+		Version: jsonrpcVersion,
+		Result:  outs[0].Interface(),
+		ID:      req.ID,
+	}
+}
+
+/*
+Handle process a request or a batch of requests in data,
+returns nil if there is nothing to response, for example all requests are notifications.
+*/
+func (s *Server) Handle(ctx *Context, data []byte) interface{} {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		var reqs []json.RawMessage
+		err := json.Unmarshal(data, &reqs)
+		if err != nil {
+			return newErrorResponse(nil, CodeParseError, err.Error())
+		}
+		if len(reqs) == 0 {
+			return newErrorResponse(nil, CodeInvalidRequest, "empty batch")
+		}
+		var resps []*response
+		for _, r := range reqs {
+			var req request
+			err = json.Unmarshal(r, &req)
+			if err != nil {
+				resps = append(resps, newErrorResponse(nil, CodeInvalidRequest, err.Error()))
+				continue
+			}
+			if resp := s.call(ctx, &req); resp != nil {
+				resps = append(resps, resp)
+			}
+		}
+		if len(resps) == 0 {
+			return nil
+		}
+		return resps
+	}
+	var req request
+	err := json.Unmarshal(data, &req)
+	if err != nil {
+		return newErrorResponse(nil, CodeParseError, err.Error())
+	}
+	if resp := s.call(ctx, &req); resp != nil {
+		return resp
+	}
+	return nil
+}
+
+/*
+ServeConn process requests from conn until it's closed,
+requests are JSON values one after another, every response is written in one line.
+*/
+func (s *Server) ServeConn(ctx *Context, conn io.ReadWriteCloser) {
+	defer conn.Close()
+	dec := json.NewDecoder(bufio.NewReader(conn))
+	enc := json.NewEncoder(conn)
+	for {
+		var data json.RawMessage
+		err := dec.Decode(&data)
+		if err != nil {
+			if err != io.EOF {
+				err = enc.Encode(newErrorResponse(nil, CodeParseError, err.Error()))
+				if err != nil {
+					log.Trace(fmt.Sprintf("jsonrpc write err %s", err))
+				}
+			}
+			return
+		}
+		resp := s.Handle(ctx, data)
+		if resp == nil {
+			continue
+		}
+		err = enc.Encode(resp)
+		if err != nil {
+			log.Trace(fmt.Sprintf("jsonrpc write err %s", err))
+			return
+		}
+	}
+}
+
+/*
+ServeUnix serve s on unix socket path, which is accessible only by current user.
+callers of unix socket have all scopes.
+*/
+func (s *Server) ServeUnix(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	err = os.Chmod(path, 0600)
+	if err != nil {
+		l.Close()
+		return err
+	}
+	log.Info(fmt.Sprintf("jsonrpc listen on unix socket %s", path))
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.ServeConn(&Context{Scope: models.APITokenScopeAll}, conn)
+	}
+}
@@ -0,0 +1,100 @@
+package jsonrpc
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/stretchr/testify/assert"
+)
+
+type addParams struct {
+	A int `json:"a"`
+	B int `json:"b"`
+}
+
+func newTestServer() *Server {
+	s := NewServer()
+	s.Register("test_add", models.APITokenScopeRead, func(ctx *Context, p *addParams) (int, error) {
+		return p.A + p.B, nil
+	})
+	s.Register("test_fail", models.APITokenScopeRead, func(ctx *Context) (interface{}, error) {
+		return nil, rerr.ErrNoPathError
+	})
+	s.Register("test_admin", models.APITokenScopeDebug, func(ctx *Context) (string, error) {
+		return "ok", nil
+	})
+	return s
+}
+
+func handle(t *testing.T, s *Server, scope models.APITokenScope, req string) string {
+	resp := s.Handle(&Context{Scope: scope}, []byte(req))
+	if resp == nil {
+		return ""
+	}
+	buf, err := json.Marshal(resp)
+	assert.Empty(t, err)
+	return string(buf)
+}
+
+func TestServer_Handle(t *testing.T) {
+	s := newTestServer()
+	read := models.APITokenScopeRead
+	assert.JSONEq(t, `{"jsonrpc":"2.0","result":3,"id":1}`,
+		handle(t, s, read, `{"jsonrpc":"2.0","method":"test_add","params":{"a":1,"b":2},"id":1}`))
+	assert.JSONEq(t, `{"jsonrpc":"2.0","result":7,"id":"x"}`,
+		handle(t, s, read, `{"jsonrpc":"2.0","method":"test_add","params":[{"a":3,"b":4}],"id":"x"}`))
+	// notification
+	assert.EqualValues(t, "", handle(t, s, read, `{"jsonrpc":"2.0","method":"test_add","params":{"a":1,"b":2}}`))
+	// errors
+	assert.JSONEq(t, `{"jsonrpc":"2.0","error":{"code":-32601,"message":"method test_none not found"},"id":2}`,
+		handle(t, s, read, `{"jsonrpc":"2.0","method":"test_none","id":2}`))
+	assert.JSONEq(t, `{"jsonrpc":"2.0","error":{"code":-32700,"message":"unexpected end of JSON input"},"id":null}`,
+		handle(t, s, read, `{"jsonrpc":"2.0","method"`))
+	assert.Contains(t, handle(t, s, read, `{"jsonrpc":"2.0","method":"test_add","params":{"a":"1"},"id":3}`), `"code":-32602`)
+	assert.Contains(t, handle(t, s, read, `{"jsonrpc":"1.0","method":"test_add","id":3}`), `"code":-32600`)
+	assert.Contains(t, handle(t, s, read, `{"jsonrpc":"2.0","method":"test_fail","id":4}`), `"code":1007`)
+	assert.Contains(t, handle(t, s, read, `{"jsonrpc":"2.0","method":"test_admin","id":5}`), `"code":1026`)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","result":"ok","id":5}`,
+		handle(t, s, models.APITokenScopeDebug, `{"jsonrpc":"2.0","method":"test_admin","id":5}`))
+	// scopes don't include each other
+	assert.Contains(t, handle(t, s, models.APITokenScopeDebug, `{"jsonrpc":"2.0","method":"test_add","params":{"a":1,"b":2},"id":6}`), `"code":1026`)
+
+	// batch
+	assert.JSONEq(t, `[{"jsonrpc":"2.0","result":2,"id":1},{"jsonrpc":"2.0","error":{"code":-32601,"message":"method test_none not found"},"id":2}]`,
+		handle(t, s, read, `[{"jsonrpc":"2.0","method":"test_add","params":{"a":1,"b":1},"id":1},
+		{"jsonrpc":"2.0","method":"test_add","params":{"a":1,"b":1}},
+		{"jsonrpc":"2.0","method":"test_none","id":2}]`))
+	assert.Contains(t, handle(t, s, read, `[]`), `"code":-32600`)
+	assert.EqualValues(t, "", handle(t, s, read, `[{"jsonrpc":"2.0","method":"test_add"}]`))
+}
+
+func TestServer_ServeConn(t *testing.T) {
+	s := newTestServer()
+	c1, c2 := net.Pipe()
+	go s.ServeConn(&Context{Scope: models.APITokenScopeAll}, c2)
+	defer c1.Close()
+	r := bufio.NewReader(c1)
+	go func() {
+		_, err := c1.Write([]byte(`{"jsonrpc":"2.0","method":"test_add","params":{"a":1,"b":2},"id":1}
+		{"jsonrpc":"2.0","method":"test_admin","id":2}`))
+		assert.Empty(t, err)
+	}()
+	line, err := r.ReadString('\n')
+	assert.Empty(t, err)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","result":3,"id":1}`, line)
+	line, err = r.ReadString('\n')
+	assert.Empty(t, err)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","result":"ok","id":2}`, line)
+}
+
+func TestErrorOf(t *testing.T) {
+	assert.EqualValues(t, rerr.CodeChannelNotFound, errorOf(rerr.ChannelNotFound("abc")).Code)
+	assert.EqualValues(t, rerr.CodeSpendingCapExceeded, errorOf(models.ErrSpendingCapExceeded).Code)
+	assert.EqualValues(t, rerr.CodeUnknown, errorOf(errors.New("other")).Code)
+	assert.EqualValues(t, CodeInvalidParams, errorOf(invalidParams("x")).Code)
+}
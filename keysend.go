@@ -0,0 +1,140 @@
+package photon
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/encoding"
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+/*
+keysend 交易不需要收款方事先创建收款请求:
+ 1. 发起方随机生成密码, 用收款方的公钥加密以后放在 MediatedTransfer.EncryptedSecret 中, 中间节点原样转发
+ 2. 收款方用自己的私钥解密, 验证和 LockSecretHash 一致以后直接把密码告诉上家换取 unlock, 不再发送 SecretRequest
+ 3. 如果收款方解密失败, 会像普通交易一样发送 SecretRequest, 发起方知道密码, 照常完成交易
+
+收款方的公钥可以由用户提供, 也可以从收款方以前发给我的 SecretRequest, RevealSecret 的签名中恢复.
+*/
+
+/*
+learnPublicKey 从对方签名的消息中恢复公钥并保存, 以后可以给他发送 keysend 交易
+*/
+func (rs *Service) learnPublicKey(sender common.Address, msg encoding.MessagePacker) {
+	pk, err := rs.dao.GetNodePublicKey(sender)
+	if err == nil && len(pk.PublicKey) > 0 {
+		return
+	}
+	pubkey, err := encoding.RecoverPubkey(msg.Pack())
+	if err != nil || utils.PubkeyToAddress(pubkey) != sender {
+		log.Warn(fmt.Sprintf("cannot recover public key of %s from %s", utils.APex2(sender), msg))
+		return
+	}
+	err = rs.dao.SaveNodePublicKey(&models.NodePublicKey{
+		Address:    sender,
+		PublicKey:  pubkey,
+		UpdateTime: time.Now().Unix(),
+	})
+	if err != nil {
+		log.Error(fmt.Sprintf("SaveNodePublicKey err %s", err))
+	}
+}
+
+/*
+keysendSecret 解密发起方放在交易中的密码, 只有和 LockSecretHash 一致才返回
+*/
+func (rs *Service) keysendSecret(msg *encoding.MediatedTransfer) common.Hash {
+	data, err := utils.EciesDecrypt(rs.PrivateKey, msg.EncryptedSecret)
+	if err != nil || len(data) != len(utils.EmptyHash) {
+		log.Warn(fmt.Sprintf("receive keysend transfer %s from %s, but cannot decrypt secret, err=%v", msg, utils.APex2(msg.Initiator), err))
+		return utils.EmptyHash
+	}
+	secret := common.BytesToHash(data)
+	if utils.ShaSecret(secret[:]) != msg.LockSecretHash {
+		log.Warn(fmt.Sprintf("receive keysend transfer %s from %s, but secret doesn't match lock secret hash", msg, utils.APex2(msg.Initiator)))
+		return utils.EmptyHash
+	}
+	return secret
+}
+
+func (rs *Service) keysendTransfer(req *keysendTransferReq) (result *utils.AsyncResult) {
+	lockSecretHash := utils.ShaSecret(req.Secret[:])
+	rs.dao.NewTransferStatus(req.TokenAddress, lockSecretHash)
+	result, _ = rs.startMediatedTransferInternal(req.TokenAddress, req.Target, req.Amount, utils.BigInt0, lockSecretHash, 0, req.Secret, req.Data, req.EncryptedSecret, nil)
+	result.LockSecretHash = lockSecretHash
+	return
+}
+
+/*
+KeysendTransfer sends amount of token to target without an invoice,
+the secret is encrypted with public key of target and travels in the MediatedTransfer.
+targetPublicKey is optional, if it's empty, the public key learned from messages of target is used.
+*/
+func (r *API) KeysendTransfer(token common.Address, amount *big.Int, target common.Address, targetPublicKey []byte, data string) (result *utils.AsyncResult, err error) {
+	if r.Photon.StopCreateNewTransfers {
+		return nil, rerr.ErrStopCreateNewTransfer
+	}
+	if amount == nil || amount.Cmp(utils.BigInt0) <= 0 {
+		return nil, rerr.ErrInvalidAmount
+	}
+	if target == r.Photon.NodeAddress {
+		return nil, rerr.ErrSamePeerAddress
+	}
+	if len(data) > params.MaxTransferDataLen {
+		return nil, fmt.Errorf("invalid data, length must < %d", params.MaxTransferDataLen)
+	}
+	provided := len(targetPublicKey) > 0
+	if !provided {
+		pk, err2 := r.Photon.dao.GetNodePublicKey(target)
+		if err2 != nil {
+			return nil, fmt.Errorf("public key of %s is unknown, target_public_key is needed", target.String())
+		}
+		targetPublicKey = pk.PublicKey
+	}
+	pub, err := utils.ParsePubkey(targetPublicKey)
+	if err != nil {
+		return
+	}
+	if crypto.PubkeyToAddress(*pub) != target {
+		return nil, errors.New("target public key doesn't match target address")
+	}
+	secret := utils.NewRandomHash()
+	encryptedSecret, err := utils.EciesEncrypt(pub, secret[:])
+	if err != nil {
+		return
+	}
+	if provided {
+		//保存用户提供的公钥,下次不用再提供
+		err = r.Photon.dao.SaveNodePublicKey(&models.NodePublicKey{
+			Address:    target,
+			PublicKey:  crypto.FromECDSAPub(pub),
+			UpdateTime: time.Now().Unix(),
+		})
+		if err != nil {
+			return
+		}
+	}
+	log.Debug(fmt.Sprintf("initiating keysend transfer initiator=%s target=%s token=%s amount=%s",
+		r.Photon.NodeAddress.String(), target.String(), token.String(), amount))
+	result = r.Photon.keysendTransferClient(token, amount, target, secret, encryptedSecret, data)
+	return
+}
+
+// GetPublicKey public key of node which can be used by KeysendTransfer
+func (r *API) GetPublicKey(addr common.Address) (*models.NodePublicKey, error) {
+	if addr == r.Photon.NodeAddress {
+		return &models.NodePublicKey{
+			Address:   addr,
+			PublicKey: crypto.FromECDSAPub(&r.Photon.PrivateKey.PublicKey),
+		}, nil
+	}
+	return r.Photon.dao.GetNodePublicKey(addr)
+}
@@ -0,0 +1,49 @@
+package photon
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/codefortest"
+	"github.com/SmartMeshFoundation/Photon/encoding"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeysendSecret(t *testing.T) {
+	key, addr := utils.MakePrivateKeyAddress()
+	rs := &Service{PrivateKey: key, NodeAddress: addr}
+	secret := utils.NewRandomHash()
+	encrypted, err := utils.EciesEncrypt(&key.PublicKey, secret[:])
+	assert.Empty(t, err)
+	msg := &encoding.MediatedTransfer{
+		EncryptedSecret: encrypted,
+	}
+	msg.LockSecretHash = utils.ShaSecret(secret[:])
+	assert.Equal(t, secret, rs.keysendSecret(msg))
+	//加密的不是这个锁的密码
+	msg.LockSecretHash = utils.NewRandomHash()
+	assert.Equal(t, utils.EmptyHash, rs.keysendSecret(msg))
+	//不是给我的
+	other, _ := utils.MakePrivateKeyAddress()
+	msg.EncryptedSecret, _ = utils.EciesEncrypt(&other.PublicKey, secret[:])
+	msg.LockSecretHash = utils.ShaSecret(secret[:])
+	assert.Equal(t, utils.EmptyHash, rs.keysendSecret(msg))
+}
+
+func TestLearnPublicKey(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	key, addr := utils.MakePrivateKeyAddress()
+	api := &API{Photon: &Service{dao: dao, NodeAddress: utils.NewRandomAddress()}}
+	_, err := api.GetPublicKey(addr)
+	assert.NotEmpty(t, err)
+	msg := encoding.NewSecretRequest(utils.NewRandomHash(), big.NewInt(10))
+	err = msg.Sign(key, msg)
+	assert.Empty(t, err)
+	api.Photon.learnPublicKey(msg.Sender, msg)
+	pk, err := api.GetPublicKey(addr)
+	assert.Empty(t, err)
+	assert.Equal(t, crypto.FromECDSAPub(&key.PublicKey), pk.PublicKey)
+}
@@ -0,0 +1,236 @@
+package photon
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/channel/channeltype"
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+liquidityManager 定期检查通道余额,按照流动性规则存款或者取款.
+ 1. 余额(不含锁定的金额)低于 MinBalance 时,存款到 TargetBalance
+ 2. 余额高于 MaxBalance 时,取款到 TargetBalance,
+    有交易正在进行时,先 PrepareForWithdraw 不再接受新交易,等交易完成后再取款
+ 3. 两次链上交易间隔至少 params.LiquidityTxInterval, 同一个通道两次调整间隔至少 params.LiquidityChannelCooldown
+*/
+type liquidityManager struct {
+	rs         *Service
+	api        *API
+	lastTx     time.Time
+	lastAdjust map[common.Hash]time.Time
+}
+
+func newLiquidityManager(rs *Service) *liquidityManager {
+	return &liquidityManager{
+		rs:         rs,
+		api:        NewPhotonAPI(rs),
+		lastAdjust: make(map[common.Hash]time.Time),
+	}
+}
+
+func (lm *liquidityManager) start() {
+	go lm.loop()
+}
+
+func (lm *liquidityManager) loop() {
+	ticker := time.NewTicker(params.LiquidityCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			lm.check()
+		case <-lm.rs.quitChan:
+			return
+		}
+	}
+}
+
+// ruleOf rule of channel, or rule of its token
+func ruleOf(rules map[string]*models.LiquidityRule, c *channeltype.Serialization) *models.LiquidityRule {
+	if r, ok := rules[models.LiquidityRuleKey(c.TokenAddress(), c.ChannelIdentifier.ChannelIdentifier)]; ok {
+		return r
+	}
+	return rules[models.LiquidityRuleKey(c.TokenAddress(), utils.EmptyHash)]
+}
+
+func (lm *liquidityManager) check() {
+	rules, err := lm.rs.dao.GetAllLiquidityRules()
+	if err != nil {
+		log.Error(fmt.Sprintf("GetAllLiquidityRules err %s", err))
+		return
+	}
+	if len(rules) == 0 {
+		return
+	}
+	m := make(map[string]*models.LiquidityRule)
+	for _, r := range rules {
+		m[r.Key] = r
+	}
+	chs, err := lm.rs.dao.GetChannelList(utils.EmptyAddress, utils.EmptyAddress)
+	if err != nil {
+		log.Error(fmt.Sprintf("GetChannelList err %s", err))
+		return
+	}
+	for _, c := range chs {
+		select {
+		case <-lm.rs.quitChan:
+			return
+		default:
+		}
+		r := ruleOf(m, c)
+		if r == nil {
+			continue
+		}
+		lm.adjust(r, c)
+	}
+}
+
+// canSendTx rate limit of on-chain transactions
+func (lm *liquidityManager) canSendTx(channelIdentifier common.Hash) bool {
+	return time.Since(lm.lastTx) >= params.LiquidityTxInterval &&
+		time.Since(lm.lastAdjust[channelIdentifier]) >= params.LiquidityChannelCooldown
+}
+
+func (lm *liquidityManager) sentTx(channelIdentifier common.Hash) {
+	lm.lastTx = time.Now()
+	lm.lastAdjust[channelIdentifier] = lm.lastTx
+}
+
+// adjust deposit or withdraw on channel c according to rule r
+func (lm *liquidityManager) adjust(r *models.LiquidityRule, c *channeltype.Serialization) {
+	if c.State != channeltype.StateOpened && c.State != channeltype.StatePrepareForWithdraw {
+		return
+	}
+	channelIdentifier := c.ChannelIdentifier.ChannelIdentifier
+	balance := new(big.Int).Sub(c.OurBalance(), c.OurAmountLocked())
+	deposit, withdraw := r.Adjustment(balance)
+	if deposit != nil && c.State == channeltype.StateOpened {
+		if !lm.canSendTx(channelIdentifier) {
+			return
+		}
+		lm.sentTx(channelIdentifier)
+		log.Info(fmt.Sprintf("liquidity rule %s deposit %s to channel %s, balance=%s", r.Key, deposit, channelIdentifier.String(), balance))
+		_, err := lm.api.DepositAndOpenChannel(c.TokenAddress(), c.PartnerAddress(), 0, 0, deposit, false)
+		if err != nil {
+			log.Error(fmt.Sprintf("liquidity rule %s deposit to channel %s err %s", r.Key, channelIdentifier.String(), err))
+		}
+		return
+	}
+	if withdraw == nil {
+		// 余额已经不需要取款了,恢复由我们暂停交易的通道
+		if c.State == channeltype.StatePrepareForWithdraw && r.IsPrepared(channelIdentifier) {
+			lm.setPrepared(r, channelIdentifier, false)
+			_, err := lm.api.CancelPrepareForWithdraw(c.TokenAddress(), c.PartnerAddress())
+			if err != nil {
+				log.Error(fmt.Sprintf("liquidity rule %s CancelPrepareForWithdraw channel %s err %s", r.Key, channelIdentifier.String(), err))
+			}
+		}
+		return
+	}
+	// 和 channel.HasAnyUnkonwnSecretTransferOnRoad 一样,有锁时不能取款,先停止接受新交易等待锁完成
+	if len(c.OurLock2PendingLocks()) > 0 || len(c.OurLeaves) > 0 || len(c.PartnerLeaves) > 0 {
+		if c.State == channeltype.StateOpened {
+			log.Info(fmt.Sprintf("liquidity rule %s prepare for withdraw channel %s", r.Key, channelIdentifier.String()))
+			_, err := lm.api.PrepareForWithdraw(c.TokenAddress(), c.PartnerAddress())
+			if err != nil {
+				log.Error(fmt.Sprintf("liquidity rule %s PrepareForWithdraw channel %s err %s", r.Key, channelIdentifier.String(), err))
+				return
+			}
+			lm.setPrepared(r, channelIdentifier, true)
+		}
+		return
+	}
+	if !lm.canSendTx(channelIdentifier) {
+		return
+	}
+	lm.sentTx(channelIdentifier)
+	lm.setPrepared(r, channelIdentifier, false)
+	log.Info(fmt.Sprintf("liquidity rule %s withdraw %s from channel %s, balance=%s", r.Key, withdraw, channelIdentifier.String(), balance))
+	_, err := lm.api.Withdraw(c.TokenAddress(), c.PartnerAddress(), withdraw)
+	if err != nil {
+		log.Error(fmt.Sprintf("liquidity rule %s withdraw from channel %s err %s", r.Key, channelIdentifier.String(), err))
+	}
+}
+
+// setPrepared 记录在规则中,重启后仍然能恢复由我们暂停交易的通道
+func (lm *liquidityManager) setPrepared(r *models.LiquidityRule, channelIdentifier common.Hash, prepared bool) {
+	r.SetPrepared(channelIdentifier, prepared)
+	// 重新读取规则,避免覆盖期间通过 API 修改的规则
+	cur, err := lm.rs.dao.GetLiquidityRule(r.Key)
+	if err != nil {
+		return
+	}
+	if !cur.SetPrepared(channelIdentifier, prepared) {
+		return
+	}
+	err = lm.rs.dao.SaveLiquidityRule(cur)
+	if err != nil {
+		log.Error(fmt.Sprintf("liquidity rule %s save prepared channel %s err %s", r.Key, channelIdentifier.String(), err))
+	}
+}
+
+/*
+SetLiquidityRule creates or replaces rule of a channel or a token,
+token of rule for channel is the token of that channel.
+*/
+func (r *API) SetLiquidityRule(rule *models.LiquidityRule) (err error) {
+	if rule.ChannelIdentifier != utils.EmptyHash {
+		c, err := r.Photon.dao.GetChannelByAddress(rule.ChannelIdentifier)
+		if err != nil {
+			return err
+		}
+		rule.TokenAddress = c.TokenAddress()
+	}
+	err = rule.Normalize()
+	if err != nil {
+		return
+	}
+	rule.UpdateTime = time.Now().Unix()
+	// channels prepared for withdraw by the replaced rule are still ours to cancel
+	rule.Prepared = nil
+	if old, err := r.Photon.dao.GetLiquidityRule(rule.Key); err == nil {
+		rule.Prepared = old.Prepared
+	}
+	return r.Photon.dao.SaveLiquidityRule(rule)
+}
+
+// GetLiquidityRules all rules of channels and tokens
+func (r *API) GetLiquidityRules() (rules []*models.LiquidityRule, err error) {
+	return r.Photon.dao.GetAllLiquidityRules()
+}
+
+// RemoveLiquidityRule remove rule identified by id, which is a channel identifier or a token address
+func (r *API) RemoveLiquidityRule(id string) error {
+	if common.IsHexAddress(id) {
+		id = models.LiquidityRuleKey(common.HexToAddress(id), utils.EmptyHash)
+	} else {
+		id = common.HexToHash(id).String()
+	}
+	rule, err := r.Photon.dao.GetLiquidityRule(id)
+	if err != nil {
+		return err
+	}
+	err = r.Photon.dao.RemoveLiquidityRule(id)
+	if err != nil {
+		return err
+	}
+	// nobody else will resume channels prepared for withdraw by this rule
+	for _, channelIdentifier := range rule.Prepared {
+		c, err := r.Photon.dao.GetChannelByAddress(channelIdentifier)
+		if err != nil || c.State != channeltype.StatePrepareForWithdraw {
+			continue
+		}
+		_, err = r.CancelPrepareForWithdraw(c.TokenAddress(), c.PartnerAddress())
+		if err != nil {
+			log.Error(fmt.Sprintf("liquidity rule %s CancelPrepareForWithdraw channel %s err %s", id, channelIdentifier.String(), err))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package photon
+
+import (
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/SmartMeshFoundation/Photon/channel"
+	"github.com/SmartMeshFoundation/Photon/channel/channeltype"
+	"github.com/SmartMeshFoundation/Photon/encoding"
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	mediationRejectMinTransferAmount     = "min_transfer_amount"
+	mediationRejectMaxExpirationDistance = "max_expiration_distance"
+	mediationRejectMaxPendingLocks       = "max_pending_locks"
+	mediationRejectMaxLockedAmount       = "max_locked_amount"
+)
+
+// MediationChannelStatus : in-flight locks of partner and rejected mediated transfers on a channel
+type MediationChannelStatus struct {
+	ChannelIdentifier common.Hash            `json:"channel_identifier"`
+	TokenAddress      common.Address         `json:"token_address"`
+	PartnerAddress    common.Address         `json:"partner_address"`
+	PendingLocks      int                    `json:"pending_locks"`
+	LockedAmount      *big.Int               `json:"locked_amount"`
+	Limit             *models.MediationLimit `json:"limit"`
+	Rejected          map[string]int         `json:"rejected,omitempty"` // reason to count, since photon started
+}
+
+/*
+mediationLimiter 限制对方通过一个通道推给我们的中转交易,
+避免一个节点占用我们所有的中转资金:
+ 1. 锁的个数,锁定的金额都包含新收到的这个锁,因为检查时 registerMediatedTranser 已经成功
+ 2. 违反限制的交易和 drain 一样,不寻找路由,由 mediator AnnounceDisposed
+ 3. 只限制中转,我们是接收方的交易不受影响
+
+admit 在 Photon 主线程中调用, policy 可以通过 API 修改, 所以需要加锁.
+*/
+type mediationLimiter struct {
+	rs       *Service
+	lock     sync.Mutex
+	policy   *models.MediationLimitPolicy
+	rejected map[common.Hash]map[string]int
+}
+
+func newMediationLimiter(rs *Service) *mediationLimiter {
+	return &mediationLimiter{
+		rs:       rs,
+		policy:   rs.dao.GetMediationLimitPolicy(),
+		rejected: make(map[common.Hash]map[string]int),
+	}
+}
+
+func (ml *mediationLimiter) getLimit(token common.Address, channelIdentifier common.Hash) *models.MediationLimit {
+	ml.lock.Lock()
+	defer ml.lock.Unlock()
+	return ml.policy.GetLimit(token, channelIdentifier)
+}
+
+// admit returns the reason if msg violates limit of channel ch, empty if it's accepted
+func (ml *mediationLimiter) admit(msg *encoding.MediatedTransfer, ch *channel.Channel, blockNumber int64) (reason string) {
+	channelIdentifier := ch.ChannelIdentifier.ChannelIdentifier
+	l := ml.getLimit(ch.TokenAddress, channelIdentifier)
+	pendingLocks := len(ch.PartnerState.Lock2PendingLocks) + len(ch.PartnerState.Lock2UnclaimedLocks)
+	switch {
+	case l.MinTransferAmount != nil && l.MinTransferAmount.Sign() > 0 && msg.PaymentAmount.Cmp(l.MinTransferAmount) < 0:
+		reason = mediationRejectMinTransferAmount
+	case l.MaxExpirationDistance > 0 && msg.Expiration-blockNumber > l.MaxExpirationDistance:
+		reason = mediationRejectMaxExpirationDistance
+	case l.MaxPendingLocks > 0 && pendingLocks > l.MaxPendingLocks:
+		reason = mediationRejectMaxPendingLocks
+	case l.MaxLockedAmount != nil && l.MaxLockedAmount.Sign() > 0 && ch.Outstanding().Cmp(l.MaxLockedAmount) > 0:
+		reason = mediationRejectMaxLockedAmount
+	default:
+		return
+	}
+	log.Info(fmt.Sprintf("reject mediated transfer %s from %s on channel %s, %s exceeded",
+		msg.LockSecretHash.String(), utils.APex2(msg.Sender), utils.HPex(channelIdentifier), reason))
+	ml.lock.Lock()
+	if ml.rejected[channelIdentifier] == nil {
+		ml.rejected[channelIdentifier] = make(map[string]int)
+	}
+	ml.rejected[channelIdentifier][reason]++
+	ml.lock.Unlock()
+	return
+}
+
+// GetMediationLimitPolicy limits of mediated transfers
+func (r *API) GetMediationLimitPolicy() *models.MediationLimitPolicy {
+	ml := r.Photon.MediationLimiter
+	ml.lock.Lock()
+	defer ml.lock.Unlock()
+	return ml.policy
+}
+
+// SetMediationLimitPolicy replaces limits of mediated transfers, it takes effect on the next mediated transfer
+func (r *API) SetMediationLimitPolicy(p *models.MediationLimitPolicy) error {
+	if p.AccountLimit == nil {
+		p.AccountLimit = &models.MediationLimit{}
+	}
+	if p.TokenLimitMap == nil {
+		p.TokenLimitMap = make(map[common.Address]*models.MediationLimit)
+	}
+	if p.ChannelLimitMap == nil {
+		p.ChannelLimitMap = make(map[common.Hash]*models.MediationLimit)
+	}
+	ml := r.Photon.MediationLimiter
+	ml.lock.Lock()
+	defer ml.lock.Unlock()
+	err := r.Photon.dao.SaveMediationLimitPolicy(p)
+	if err != nil {
+		return err
+	}
+	ml.policy = p
+	return nil
+}
+
+// GetMediationChannelStatus in-flight locks of partner, limit and rejected counts of each open channel
+func (r *API) GetMediationChannelStatus(tokenAddress common.Address) (ss []*MediationChannelStatus, err error) {
+	chs, err := r.Photon.dao.GetChannelList(tokenAddress, utils.EmptyAddress)
+	if err != nil {
+		return
+	}
+	ml := r.Photon.MediationLimiter
+	ml.lock.Lock()
+	defer ml.lock.Unlock()
+	for _, c := range chs {
+		if c.State != channeltype.StateOpened {
+			continue
+		}
+		s := &MediationChannelStatus{
+			ChannelIdentifier: c.ChannelIdentifier.ChannelIdentifier,
+			TokenAddress:      c.TokenAddress(),
+			PartnerAddress:    c.PartnerAddress(),
+			PendingLocks:      len(c.PartnerLock2PendingLocks()) + len(c.PartnerLock2UnclaimedLocks()),
+			LockedAmount:      c.PartnerAmountLocked(),
+			Limit:             ml.policy.GetLimit(c.TokenAddress(), c.ChannelIdentifier.ChannelIdentifier),
+			Rejected:          make(map[string]int),
+		}
+		for reason, n := range ml.rejected[s.ChannelIdentifier] {
+			s.Rejected[reason] = n
+		}
+		ss = append(ss, s)
+	}
+	return
+}
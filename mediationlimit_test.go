@@ -0,0 +1,69 @@
+package photon
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/channel"
+	"github.com/SmartMeshFoundation/Photon/channel/channeltype"
+	"github.com/SmartMeshFoundation/Photon/encoding"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/transfer/mtree"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMediationLimiter(t *testing.T) {
+	ml := &mediationLimiter{
+		policy:   models.NewDefaultMediationLimitPolicy(),
+		rejected: make(map[common.Hash]map[string]int),
+	}
+	ch := &channel.Channel{
+		TokenAddress: utils.NewRandomAddress(),
+		PartnerState: &channel.EndState{
+			Lock2PendingLocks:   make(map[common.Hash]channeltype.PendingLock),
+			Lock2UnclaimedLocks: make(map[common.Hash]channeltype.UnlockPartialProof),
+		},
+	}
+	ch.ChannelIdentifier.ChannelIdentifier = utils.NewRandomHash()
+	//registerMediatedTranser 以后,锁已经在 PartnerState 中了
+	addLock := func(amount int64, expiration int64) *encoding.MediatedTransfer {
+		lock := &mtree.Lock{
+			Expiration:     expiration,
+			Amount:         big.NewInt(amount),
+			LockSecretHash: utils.NewRandomHash(),
+		}
+		ch.PartnerState.Lock2PendingLocks[lock.LockSecretHash] = channeltype.PendingLock{Lock: lock}
+		return &encoding.MediatedTransfer{
+			PaymentAmount:  lock.Amount,
+			Expiration:     expiration,
+			LockSecretHash: lock.LockSecretHash,
+		}
+	}
+	//默认没有限制
+	assert.EqualValues(t, "", ml.admit(addLock(1, 1000), ch, 10))
+
+	ml.policy.AccountLimit = &models.MediationLimit{
+		MaxPendingLocks:       3,
+		MaxLockedAmount:       big.NewInt(50),
+		MaxExpirationDistance: 100,
+		MinTransferAmount:     big.NewInt(2),
+	}
+	assert.EqualValues(t, mediationRejectMinTransferAmount, ml.admit(addLock(1, 50), ch, 10))
+	assert.EqualValues(t, mediationRejectMaxExpirationDistance, ml.admit(addLock(2, 111), ch, 10))
+	ch.PartnerState.Lock2PendingLocks = make(map[common.Hash]channeltype.PendingLock)
+	assert.EqualValues(t, "", ml.admit(addLock(20, 110), ch, 10))
+	assert.EqualValues(t, "", ml.admit(addLock(20, 110), ch, 10))
+	assert.EqualValues(t, mediationRejectMaxLockedAmount, ml.admit(addLock(20, 110), ch, 10))
+	assert.EqualValues(t, mediationRejectMaxPendingLocks, ml.admit(addLock(2, 110), ch, 10))
+	//通道的限制优先
+	ml.policy.ChannelLimitMap[ch.ChannelIdentifier.ChannelIdentifier] = &models.MediationLimit{}
+	assert.EqualValues(t, "", ml.admit(addLock(1, 1000), ch, 10))
+
+	rejected := ml.rejected[ch.ChannelIdentifier.ChannelIdentifier]
+	assert.EqualValues(t, 1, rejected[mediationRejectMinTransferAmount])
+	assert.EqualValues(t, 1, rejected[mediationRejectMaxExpirationDistance])
+	assert.EqualValues(t, 1, rejected[mediationRejectMaxLockedAmount])
+	assert.EqualValues(t, 1, rejected[mediationRejectMaxPendingLocks])
+}
@@ -0,0 +1,59 @@
+package photon
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+交易附加信息(data)端到端加密:
+ 1. 使用 --encrypt-transfer-data 启动以后, 发给收款方的附加信息用收款方的公钥(ECIES)加密, 并加上 encryptedDataPrefix
+ 2. 中转交易的附加信息在 RevealSecret 中发给收款方, 这时候一定已经收到了收款方签名的 SecretRequest, 知道他的公钥
+ 3. 直接交易不知道对方公钥就直接失败, 由用户决定去掉附加信息再发送, 打开加密以后绝不发送明文
+ 4. RevealSecret 的时候如果还是不知道收款方的公钥(不应该发生), 就不带附加信息
+ 5. 收款方收到带前缀的附加信息就用自己的私钥解密, 没有前缀的当作明文, 所以老版本节点发来的附加信息不受影响
+
+老版本的节点无法解密, 所以默认不加密.
+*/
+const encryptedDataPrefix = "\x00ecies:"
+
+/*
+encryptTransferData 用 receiver 的公钥加密附加信息, 不知道公钥或者加密失败就返回错误, 不会返回明文
+*/
+func (rs *Service) encryptTransferData(receiver common.Address, data string) (string, error) {
+	if !rs.Config.EncryptTransferData || len(data) == 0 || strings.HasPrefix(data, encryptedDataPrefix) {
+		return data, nil
+	}
+	pk, err := rs.dao.GetNodePublicKey(receiver)
+	if err != nil {
+		return "", fmt.Errorf("public key of %s is unknown, cannot encrypt transfer data", receiver.String())
+	}
+	pub, err := utils.ParsePubkey(pk.PublicKey)
+	if err != nil {
+		return "", fmt.Errorf("invalid public key of %s, err %s", receiver.String(), err)
+	}
+	encrypted, err := utils.EciesEncrypt(pub, []byte(data))
+	if err != nil {
+		return "", fmt.Errorf("encrypt transfer data for %s err %s", receiver.String(), err)
+	}
+	return encryptedDataPrefix + string(encrypted), nil
+}
+
+/*
+decryptTransferData 解密发给我的附加信息, 明文原样返回, 解密失败的也原样返回, 以免丢失
+*/
+func (rs *Service) decryptTransferData(data string) string {
+	if !strings.HasPrefix(data, encryptedDataPrefix) {
+		return data
+	}
+	plain, err := utils.EciesDecrypt(rs.PrivateKey, []byte(data[len(encryptedDataPrefix):]))
+	if err != nil {
+		log.Warn(fmt.Sprintf("cannot decrypt transfer data, err %s", err))
+		return data
+	}
+	return string(plain)
+}
@@ -0,0 +1,72 @@
+package photon
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/codefortest"
+	"github.com/SmartMeshFoundation/Photon/encoding"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/network/rpc/contracts"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryptTransferData(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	key, addr := utils.MakePrivateKeyAddress()
+	sender := &Service{dao: dao, Config: &params.Config{EncryptTransferData: true}}
+	receiver := &Service{PrivateKey: key, NodeAddress: addr}
+	data := "order 12345"
+	//不知道公钥,不能发送明文
+	_, err := sender.encryptTransferData(addr, data)
+	assert.NotEmpty(t, err)
+	err = dao.SaveNodePublicKey(&models.NodePublicKey{
+		Address:   addr,
+		PublicKey: crypto.FromECDSAPub(&key.PublicKey),
+	})
+	assert.Empty(t, err)
+	encrypted, err := sender.encryptTransferData(addr, data)
+	assert.Empty(t, err)
+	assert.True(t, strings.HasPrefix(encrypted, encryptedDataPrefix))
+	assert.False(t, strings.Contains(encrypted, data))
+	assert.Equal(t, data, receiver.decryptTransferData(encrypted))
+	//老版本节点发来的明文
+	assert.Equal(t, data, receiver.decryptTransferData(data))
+	//不是发给我的
+	other, _ := utils.MakePrivateKeyAddress()
+	assert.Equal(t, encrypted, (&Service{PrivateKey: other}).decryptTransferData(encrypted))
+	//没有打开加密
+	sender.Config.EncryptTransferData = false
+	plain, err := sender.encryptTransferData(utils.NewRandomAddress(), data)
+	assert.Empty(t, err)
+	assert.Equal(t, data, plain)
+}
+
+// 加密以后的最长附加信息也要能放进一个 DirectTransfer
+func TestDirectTransferMaxEncryptedData(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	key, addr := utils.MakePrivateKeyAddress()
+	err := dao.SaveNodePublicKey(&models.NodePublicKey{
+		Address:   addr,
+		PublicKey: crypto.FromECDSAPub(&key.PublicKey),
+	})
+	assert.Empty(t, err)
+	rs := &Service{dao: dao, Config: &params.Config{EncryptTransferData: true}}
+	bp := encoding.NewBalanceProof(1, big.NewInt(10), utils.EmptyHash, &contracts.ChannelUniqueID{
+		ChannelIdentifier: utils.NewRandomHash(),
+		OpenBlockNumber:   3,
+	})
+	tr := encoding.NewDirectTransfer(bp)
+	data, err := rs.encryptTransferData(addr, strings.Repeat("a", params.MaxDirectTransferDataLen))
+	assert.Empty(t, err)
+	tr.Data = []byte(data)
+	err = tr.Sign(key, tr)
+	assert.Empty(t, err)
+	assert.True(t, len(tr.Pack()) <= params.UDPMaxMessageSize)
+}
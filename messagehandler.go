@@ -50,6 +50,7 @@ func (mh *photonMessageHandler) onMessage(msg encoding.SignedMessager, hash comm
 	})
 	switch m2 := msg.(type) {
 	case *encoding.SecretRequest:
+		mh.photon.learnPublicKey(m2.Sender, m2)
 		f := mh.photon.SecretRequestPredictorMap[m2.LockSecretHash]
 		if f != nil {
 			ignore := (f)(m2)
@@ -59,6 +60,7 @@ func (mh *photonMessageHandler) onMessage(msg encoding.SignedMessager, hash comm
 		}
 		err = mh.messageSecretRequest(m2)
 	case *encoding.RevealSecret:
+		mh.photon.learnPublicKey(m2.Sender, m2)
 		f := mh.photon.RevealSecretListenerMap[m2.LockSecretHash()]
 		if f != nil {
 			remove := (f)(m2)
@@ -477,7 +479,8 @@ todo 需要设计如何保存 token swap 相关数据,并在崩溃恢复以后
 func (mh *photonMessageHandler) messageMediatedTransfer(msg *encoding.MediatedTransfer) error {
 	// 用户调用了prepare-update,暂停接收新交易
 	// Clients inovke prepare-update, stop receiving new transfers.
-	if mh.photon.StopCreateNewTransfers {
+	// 正在 drain 的时候需要 AnnounceDisposed, 否则对方只能等锁过期
+	if mh.photon.StopCreateNewTransfers && !mh.photon.Drain.isDraining() {
 		return rerr.ErrStopCreateNewTransfer
 	}
 	token := mh.photon.getTokenForChannelIdentifier(msg.ChannelIdentifier)
@@ -748,6 +751,7 @@ func (mh *photonMessageHandler) messageWithdrawResponse(msg *encoding.WithdrawRe
 		err = <-result.Result
 		if err != nil {
 			log.Error(fmt.Sprintf("Withdraw %s failed, so we can only close/settle this channel", msg.ChannelIdentifier.String()))
+			mh.photon.NotifyHandler.NotifyWithdrawResult(channel.NewChannelSerialization(ch), err)
 		}
 	}()
 	return nil
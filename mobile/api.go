@@ -14,8 +14,10 @@ import (
 	photon "github.com/SmartMeshFoundation/Photon"
 	"github.com/SmartMeshFoundation/Photon/internal/rpanic"
 	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
 	"github.com/SmartMeshFoundation/Photon/network"
 	"github.com/SmartMeshFoundation/Photon/network/netshare"
+	"github.com/SmartMeshFoundation/Photon/notify"
 	"github.com/SmartMeshFoundation/Photon/params"
 	"github.com/SmartMeshFoundation/Photon/restful/v1"
 	"github.com/SmartMeshFoundation/Photon/utils"
@@ -100,6 +102,7 @@ func (a *API) GetChannelList() (channels string, err error) {
 			SettleTimeout:       c.SettleTimeout,
 			RevealTimeout:       c.RevealTimeout,
 		}
+		d.FormatAmounts(a.api)
 		datas = append(datas, d)
 	}
 	channels, err = marshal(datas)
@@ -194,6 +197,7 @@ func (a *API) GetOneChannel(channelIdentifier string) (channel string, err error
 		OurBalanceProof:          c.OurBalanceProof,
 		PartnerBalanceProof:      c.PartnerBalanceProof,
 	}
+	d.FormatAmounts(a.api)
 	channel, err = marshal(d)
 	return
 }
@@ -201,7 +205,8 @@ func (a *API) GetOneChannel(channelIdentifier string) (channel string, err error
 /*
 Deposit try to open a new channel on contract with
 `partnerAddress` . the `settleTimeout` is the settle time of
-the new channel.  `balanceStr` is the token to deposit to this channel and it  must be positive
+the new channel.  `balanceStr` is the token to deposit to this channel and it  must be positive,
+it's an integer or a decimal like 1.25 in decimals of token.
  if `NewChannel` is true,  a new channel must be created and if `settleTimeout` is zero then it will be set as default
 settle timeout.
 if `NewChannel` is false, `settleTimeout` must be zero.
@@ -255,7 +260,10 @@ func (a *API) deposit(partnerAddress, tokenAddress string, settleTimeout int, ba
 	if err != nil {
 		return
 	}
-	balance, _ := new(big.Int).SetString(balanceStr, 0)
+	balance, err := a.parseAmount(tokenAddr, balanceStr)
+	if err != nil {
+		return
+	}
 	c, err := a.api.DepositAndOpenChannel(tokenAddr, partnerAddr, settleTimeout, a.api.Photon.Config.RevealTimeout, balance, newcChannel)
 	if err != nil {
 		log.Error(err.Error())
@@ -275,6 +283,7 @@ func (a *API) deposit(partnerAddress, tokenAddress string, settleTimeout int, ba
 		LockedAmount:        c.OurAmountLocked(),
 		PartnerLockedAmount: c.PartnerAmountLocked(),
 	}
+	d.FormatAmounts(a.api)
 	channel, err = marshal(d)
 	return
 
@@ -350,6 +359,7 @@ func (a *API) closeChannel(channelIdentifier string, force bool) (channel string
 		LockedAmount:        c.OurAmountLocked(),
 		PartnerLockedAmount: c.PartnerAmountLocked(),
 	}
+	d.FormatAmounts(a.api)
 	channel, err = marshal(d)
 	return
 }
@@ -415,13 +425,14 @@ func (a *API) settleChannel(channelIdentifier string) (channel string, err error
 		LockedAmount:        c.OurAmountLocked(),
 		PartnerLockedAmount: c.PartnerAmountLocked(),
 	}
+	d.FormatAmounts(a.api)
 	channel, err = marshal(d)
 	return
 }
 
 // Deprecated
 func (a *API) networkEvent(fromBlock, toBlock int64) (eventsString string, err error) {
-	events, err := a.api.GetNetworkEvents(fromBlock, toBlock)
+	events, err := a.api.GetNetworkEvents(&models.ContractEventFilter{FromBlock: fromBlock, ToBlock: toBlock})
 	if err != nil {
 		log.Error(err.Error())
 		return
@@ -436,7 +447,7 @@ func (a *API) tokensEvent(fromBlock, toBlock int64, tokenAddress string) (events
 	if err != nil {
 		return
 	}
-	events, err := a.api.GetTokenNetworkEvents(token, fromBlock, toBlock)
+	events, err := a.api.GetTokenNetworkEvents(token, &models.ContractEventFilter{FromBlock: fromBlock, ToBlock: toBlock})
 	if err != nil {
 		log.Error(err.Error())
 		return
@@ -448,7 +459,7 @@ func (a *API) tokensEvent(fromBlock, toBlock int64, tokenAddress string) (events
 //Deprecated: ChannelsEvent GET /api/1/events/channels/0x2a65aca4d5fc5b5c859090a6c34d164135398226?from_block=1337
 func (a *API) channelsEvent(fromBlock, toBlock int64, channelIdentifier string) (eventsString string, err error) {
 	channel := common.HexToHash(channelIdentifier)
-	events, err := a.api.GetChannelEvents(channel, fromBlock, toBlock)
+	events, err := a.api.GetChannelEvents(channel, &models.ContractEventFilter{FromBlock: fromBlock, ToBlock: toBlock})
 	if err != nil {
 		log.Error(err.Error())
 		return
@@ -480,6 +491,102 @@ func (a *API) Tokens() (tokens string) {
 	return
 }
 
+/*
+TokenMetadata returns symbol, name and decimals of token
+for example:
+{
+    "token_address": "0x7B874444681F7AEF18D48f330a0Ba093d3d0fDD2",
+    "symbol": "SMT",
+    "name": "SmartMesh Token",
+    "decimals": 18,
+    "update_time": 1546588800
+}
+*/
+func (a *API) TokenMetadata(tokenAddress string) (r string, err error) {
+	tokenAddr, err := utils.HexToAddressWithoutValidation(tokenAddress)
+	if err != nil {
+		return
+	}
+	m, err := a.api.GetTokenMetadata(tokenAddr)
+	if err != nil {
+		log.Error(err.Error())
+		return
+	}
+	return marshal(m)
+}
+
+/*
+RegisterToken creates token network of `tokenAddress` by opening the first channel with `partnerAddress`,
+`balanceStr` is deposit of this channel, it must be positive.
+the result returned by GetCallResult is the same as Deposit.
+*/
+func (a *API) RegisterToken(tokenAddress, partnerAddress string, settleTimeout int, balanceStr string) (callID string, err error) {
+	callID = utils.NewRandomHash().String()
+	result := newResult()
+	a.callID2result[callID] = result
+	go func() {
+		r, e := a.registerToken(tokenAddress, partnerAddress, settleTimeout, balanceStr)
+		result.Result = r
+		result.Err = e
+		result.Done = true
+		a.callID2result[callID] = result
+	}()
+	return
+}
+
+func (a *API) registerToken(tokenAddress, partnerAddress string, settleTimeout int, balanceStr string) (channel string, err error) {
+	defer func() {
+		log.Trace(fmt.Sprintf("Api RegisterToken in tokenAddress=%s,partnerAddress=%s,settleTimeout=%d,balanceStr=%s\nout channel=\n%s,err=%v",
+			tokenAddress, partnerAddress, settleTimeout, balanceStr, channel, err,
+		))
+	}()
+	tokenAddr, err := utils.HexToAddressWithoutValidation(tokenAddress)
+	if err != nil {
+		return
+	}
+	partnerAddr, err := utils.HexToAddressWithoutValidation(partnerAddress)
+	if err != nil {
+		return
+	}
+	balance, ok := new(big.Int).SetString(balanceStr, 0)
+	if !ok {
+		return "", fmt.Errorf("invalid amount %s", balanceStr)
+	}
+	_, c, err := a.api.RegisterToken(tokenAddr, partnerAddr, settleTimeout, balance)
+	if err != nil {
+		log.Error(err.Error())
+		return
+	}
+	d := &v1.ChannelData{
+		ChannelIdentifier:   common.BytesToHash(c.Key).String(),
+		PartnerAddrses:      c.PartnerAddress().String(),
+		Balance:             c.OurBalance(),
+		PartnerBalance:      c.PartnerBalance(),
+		State:               c.State,
+		StateString:         c.State.String(),
+		SettleTimeout:       c.SettleTimeout,
+		TokenAddress:        c.TokenAddress().String(),
+		LockedAmount:        c.OurAmountLocked(),
+		PartnerLockedAmount: c.PartnerAmountLocked(),
+	}
+	d.FormatAmounts(a.api)
+	return marshal(d)
+}
+
+/*
+parseAmount amount is an integer, or a decimal like 1.25 in decimals of token
+*/
+func (a *API) parseAmount(token common.Address, s string) (*big.Int, error) {
+	if strings.Contains(s, ".") {
+		return a.api.ParseAmount(token, s)
+	}
+	amount, ok := new(big.Int).SetString(s, 0)
+	if !ok {
+		return nil, fmt.Errorf("invalid amount %s", s)
+	}
+	return amount, nil
+}
+
 type partnersData struct {
 	PartnerAddress string `json:"partner_address"`
 	Channel        string `json:"channel"`
@@ -527,7 +634,7 @@ Transfers POST /api/1/transfers/0x2a65aca4d5fc5b5c859090a6c34d164135398226/0x61c
 Initiating a Transfer
 tokenAddress is  the token to transfer
 targetAddress is address of the receipt of the transfer
-amountstr is integer amount string
+amountstr is integer amount string, or a decimal like 1.25 in decimals of token
 feestr is  always 0 now
 isDirect is this should be True when no internet connection,otherwise false.
 data: the info
@@ -562,11 +669,18 @@ func (a *API) Transfers(tokenAddress, targetAddress string, amountstr string, fe
 		err = errors.New("invalid secret")
 		return
 	}
-	if len(data) > params.MaxTransferDataLen {
-		err = errors.New("invalid data, data len must < 256")
+	maxDataLen := params.MaxTransferDataLen
+	if isDirect {
+		maxDataLen = params.MaxDirectTransferDataLen
+	}
+	if len(data) > maxDataLen {
+		err = fmt.Errorf("invalid data, data len must < %d", maxDataLen)
+		return
+	}
+	amount, err := a.parseAmount(tokenAddr, amountstr)
+	if err != nil {
 		return
 	}
-	amount, _ := new(big.Int).SetString(amountstr, 0)
 	fee, _ := new(big.Int).SetString(feestr, 0)
 	secret := common.HexToHash(secretStr)
 	if amount.Cmp(utils.BigInt0) <= 0 {
@@ -807,6 +921,9 @@ Subscribe  As to Status Notification, we put these codebase into an individual p
  To avoid write block, we can write data through select.
  We should make effort to avoid start go routine.
  If there's need to create a new Photon instance, sub.Unsubscribe must be invoked to do that or memory leakage will occur.
+ Sent transfers, received transfers and notices come from the notification outbox,
+ they are acknowledged as consumer "mobile" after handler returns, so those not delivered will be replayed after restart,
+ and events not read by other consumers such as restful clients are kept.
 */
 func (a *API) Subscribe(handler NotifyHandler) (sub *Subscription, err error) {
 	sub = &Subscription{
@@ -817,25 +934,19 @@ func (a *API) Subscribe(handler NotifyHandler) (sub *Subscription, err error) {
 		EthStatus:  netshare.Disconnected,
 	}
 
-	var xn <-chan netshare.Status
-	switch t := a.api.Photon.Transport.(type) {
-	case *network.MatrixMixTransport:
-		xn, err = t.GetNotify()
-		if err != nil {
-			log.Error(fmt.Sprintf("matrix transport get nofity err %s", err))
-			return
-		}
-	case *network.MixTransport:
-		xn, err = t.GetNotify()
-		if err != nil {
-			log.Error(fmt.Sprintf("mix transport get notify err %s", err))
-			return
-		}
-	default:
-		xn = make(chan netshare.Status)
-	}
+	xn := a.api.Photon.TransportConnectionStatus
+	nh := a.api.Photon.NotifyHandler
 	go func() {
 		rpanic.RegisterErrorNotifier("API SubscribeNeighbour")
+		cursor := nh.AckedEventID(notify.ConsumerMobile)
+		es, backlog, _ := nh.SubscribeEvents(cursor)
+		defer func() {
+			es.Unsubscribe()
+		}()
+		for _, e := range backlog {
+			cursor = a.dispatchEvent(handler, e)
+		}
+		events := es.C
 		for {
 			var err error
 			var d []byte
@@ -852,20 +963,21 @@ func (a *API) Subscribe(handler NotifyHandler) (sub *Subscription, err error) {
 				cs.LastBlockTime = a.api.Photon.GetDao().GetLastBlockNumberTime().Format(v1.BlockTimeFormat)
 				d, err = json.Marshal(cs)
 				handler.OnStatusChange(string(d))
-			case t, ok := <-a.api.Photon.NotifyHandler.GetSentTransferChan():
+			case e, ok := <-events:
 				if ok {
-					d, err = json.Marshal(t)
-					handler.OnSentTransfer(string(d))
+					cursor = a.dispatchEvent(handler, e)
+					break
 				}
-			case t, ok := <-a.api.Photon.NotifyHandler.GetReceivedTransferChan():
-				if ok {
-					d, err = json.Marshal(t)
-					handler.OnReceivedTransfer(string(d))
+				events = nil
+				if nh.IsStopped() {
+					break
 				}
-			case n, ok := <-a.api.Photon.NotifyHandler.GetNoticeChan():
-				if ok {
-					handler.OnNotify(int(n.Level), n.Info)
+				// too slow to keep up, resume from the last event delivered
+				es, backlog, _ = nh.SubscribeEvents(cursor)
+				for _, e = range backlog {
+					cursor = a.dispatchEvent(handler, e)
 				}
+				events = es.C
 			case <-sub.quitChan:
 				return
 			}
@@ -878,6 +990,29 @@ func (a *API) Subscribe(handler NotifyHandler) (sub *Subscription, err error) {
 	return
 }
 
+// dispatchEvent deliver e to handler and acknowledge it, returns ID of e
+func (a *API) dispatchEvent(handler NotifyHandler, e *notify.Event) uint64 {
+	switch e.Type {
+	case notify.EventTypeSentTransfer:
+		handler.OnSentTransfer(string(e.Data))
+	case notify.EventTypeReceivedTransfer:
+		handler.OnReceivedTransfer(string(e.Data))
+	case notify.EventTypeNotice:
+		var n notify.Notice
+		err := json.Unmarshal(e.Data, &n)
+		if err != nil {
+			log.Error(fmt.Sprintf("unmarshal notice %d err %s", e.ID, err))
+			break
+		}
+		handler.OnNotify(int(n.Level), n.Info)
+	}
+	err := a.api.Photon.NotifyHandler.AckEvents(notify.ConsumerMobile, e.ID)
+	if err != nil {
+		log.Error(fmt.Sprintf("ack event %d err %s", e.ID, err))
+	}
+	return e.ID
+}
+
 /*
 GetTransferStatus return transfer result
 status should be one the following
@@ -1023,6 +1158,7 @@ func (a *API) withdraw(channelIdentifierHashStr, amountStr, op string) (r string
 		PartnerLockedAmount: c.PartnerAmountLocked(),
 		RevealTimeout:       c.RevealTimeout,
 	}
+	d.FormatAmounts(a.api)
 	r, err = marshal(d)
 	return
 }
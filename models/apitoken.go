@@ -0,0 +1,192 @@
+package models
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+APITokenScope :
+scopes of api token, every scope is one bit and a token has a set of them,
+no scope includes another, e.g. a transfer-only token cannot query without read-only.
+*/
+type APITokenScope uint
+
+const (
+	// APITokenScopeRead query only
+	APITokenScopeRead APITokenScope = 1 << iota
+	// APITokenScopeTransfer send transfers
+	APITokenScopeTransfer
+	// APITokenScopeChannel open, deposit, withdraw, close and settle channels, change fee policy and webhooks
+	APITokenScopeChannel
+	// APITokenScopeDebug debug api, stop photon and manage api tokens
+	APITokenScopeDebug
+)
+
+// APITokenScopeAll all scopes, granted to username/password
+const APITokenScopeAll = APITokenScopeRead | APITokenScopeTransfer | APITokenScopeChannel | APITokenScopeDebug
+
+var apiTokenScopeNames = []struct {
+	scope APITokenScope
+	name  string
+}{
+	{APITokenScopeRead, "read-only"},
+	{APITokenScopeTransfer, "transfer-only"},
+	{APITokenScopeChannel, "channel-admin"},
+	{APITokenScopeDebug, "debug"},
+}
+
+// Names names of all scopes in s
+func (s APITokenScope) Names() (names []string) {
+	names = []string{}
+	for _, n := range apiTokenScopeNames {
+		if s.Has(n.scope) {
+			names = append(names, n.name)
+		}
+	}
+	return
+}
+
+func (s APITokenScope) String() string {
+	if !s.IsValid() {
+		return fmt.Sprintf("unknown scope %d", s)
+	}
+	return strings.Join(s.Names(), ",")
+}
+
+// IsValid is s a non-empty set of the scopes defined?
+func (s APITokenScope) IsValid() bool {
+	return s != 0 && s&^APITokenScopeAll == 0
+}
+
+// Has are all scopes of scope in s?
+func (s APITokenScope) Has(scope APITokenScope) bool {
+	return scope != 0 && s&scope == scope
+}
+
+// ParseAPITokenScope scope of name
+func ParseAPITokenScope(name string) (APITokenScope, error) {
+	for _, n := range apiTokenScopeNames {
+		if n.name == name {
+			return n.scope, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown scope %s", name)
+}
+
+// MarshalJSON scopes are represented by a list of names
+func (s APITokenScope) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.Names())
+}
+
+// UnmarshalJSON :
+func (s *APITokenScope) UnmarshalJSON(data []byte) (err error) {
+	var names []string
+	err = json.Unmarshal(data, &names)
+	if err != nil {
+		return
+	}
+	*s = 0
+	for _, name := range names {
+		var scope APITokenScope
+		scope, err = ParseAPITokenScope(name)
+		if err != nil {
+			return
+		}
+		*s |= scope
+	}
+	return
+}
+
+// ErrSpendingCapExceeded amount of transfer exceeds the spending cap of api token
+var ErrSpendingCapExceeded = errors.New("spending cap of api token exceeded")
+
+/*
+APIToken :
+token used to call http api, only hash of the secret is saved.
+SpendingCaps limits total amount of transfers sent by this token for each token listed, tokens not listed are not limited.
+*/
+type APIToken struct {
+	ID           string                      `json:"id" storm:"id"`
+	Name         string                      `json:"name"`
+	Scopes       APITokenScope               `json:"scopes"`
+	SecretHash   common.Hash                 `json:"-"`
+	SpendingCaps map[common.Address]*big.Int `json:"spending_caps,omitempty"`
+	Spent        map[common.Address]*big.Int `json:"spent,omitempty"`
+	CreateTime   int64                       `json:"create_time"`
+}
+
+// APITokenSecretHash hash of secret saved in db
+func APITokenSecretHash(secret string) common.Hash {
+	return sha256.Sum256([]byte(secret))
+}
+
+// APITokenID id of api token is derived from its secret, so it can be found without scanning all tokens
+func APITokenID(secret string) string {
+	h := APITokenSecretHash(secret)
+	return hex.EncodeToString(h[:8])
+}
+
+// Allow can this token call api which needs scope?
+func (t *APIToken) Allow(scope APITokenScope) bool {
+	return t.Scopes.Has(scope)
+}
+
+// MatchSecret is secret of this token?
+func (t *APIToken) MatchSecret(secret string) bool {
+	h := APITokenSecretHash(secret)
+	return subtle.ConstantTimeCompare(h[:], t.SecretHash[:]) == 1
+}
+
+/*
+Spend add amount to spent of token,
+returns ErrSpendingCapExceeded and nothing changed if the cap is exceeded.
+*/
+func (t *APIToken) Spend(token common.Address, amount *big.Int) error {
+	limit, ok := t.SpendingCaps[token]
+	if !ok || amount == nil {
+		return nil
+	}
+	spent := t.Spent[token]
+	if spent == nil {
+		spent = big.NewInt(0)
+	}
+	spent = new(big.Int).Add(spent, amount)
+	if spent.Cmp(limit) > 0 {
+		return ErrSpendingCapExceeded
+	}
+	if t.Spent == nil {
+		t.Spent = make(map[common.Address]*big.Int)
+	}
+	t.Spent[token] = spent
+	return nil
+}
+
+/*
+Refund give back amount spent of token when the transfer is not sent or failed,
+spent never goes below zero.
+*/
+func (t *APIToken) Refund(token common.Address, amount *big.Int) {
+	spent := t.Spent[token]
+	if spent == nil || amount == nil {
+		return
+	}
+	spent = new(big.Int).Sub(spent, amount)
+	if spent.Sign() < 0 {
+		spent = big.NewInt(0)
+	}
+	t.Spent[token] = spent
+}
+
+func init() {
+	gob.Register(&APIToken{})
+}
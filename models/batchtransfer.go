@@ -0,0 +1,117 @@
+package models
+
+import (
+	"encoding/gob"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// BatchTransferItemStatus :
+type BatchTransferItemStatus string
+
+const (
+	// BatchTransferItemPending not started
+	BatchTransferItemPending BatchTransferItemStatus = "pending"
+	// BatchTransferItemProcessing transfer started, waiting for result
+	BatchTransferItemProcessing BatchTransferItemStatus = "processing"
+	// BatchTransferItemSuccess :
+	BatchTransferItemSuccess BatchTransferItemStatus = "success"
+	// BatchTransferItemFailed :
+	BatchTransferItemFailed BatchTransferItemStatus = "failed"
+	// BatchTransferItemSkipped not started because the batch stopped
+	BatchTransferItemSkipped BatchTransferItemStatus = "skipped"
+	// BatchTransferItemUnknown photon stopped when processing, check it by LockSecretHash
+	BatchTransferItemUnknown BatchTransferItemStatus = "unknown"
+)
+
+// BatchTransferStatus :
+type BatchTransferStatus string
+
+const (
+	// BatchTransferRunning :
+	BatchTransferRunning BatchTransferStatus = "running"
+	// BatchTransferFinished all items finished
+	BatchTransferFinished BatchTransferStatus = "finished"
+	// BatchTransferStopped stopped on first failure
+	BatchTransferStopped BatchTransferStatus = "stopped"
+	// BatchTransferInterrupted photon stopped before batch finished
+	BatchTransferInterrupted BatchTransferStatus = "interrupted"
+)
+
+// BatchTransferItem one transfer of batch
+type BatchTransferItem struct {
+	TokenAddress   common.Address          `json:"token_address"`
+	TargetAddress  common.Address          `json:"target_address"`
+	Amount         *big.Int                `json:"amount"`
+	Fee            *big.Int                `json:"fee"`
+	Data           string                  `json:"data"`
+	Status         BatchTransferItemStatus `json:"status"`
+	LockSecretHash common.Hash             `json:"lock_secret_hash"`
+	Error          string                  `json:"error,omitempty"`
+}
+
+/*
+BatchTransferSummary :
+number of items in each status, and amount (fee not included) sent successfully of each token
+*/
+type BatchTransferSummary struct {
+	Total      int                         `json:"total"`
+	Pending    int                         `json:"pending"`
+	Processing int                         `json:"processing"`
+	Success    int                         `json:"success"`
+	Failed     int                         `json:"failed"`
+	Skipped    int                         `json:"skipped"`
+	Unknown    int                         `json:"unknown"`
+	Amounts    map[common.Address]*big.Int `json:"amounts"`
+}
+
+/*
+BatchTransfer :
+transfers started by one call, at most Concurrency transfers are processing at the same time.
+*/
+type BatchTransfer struct {
+	ID            string               `json:"id" storm:"id"`
+	Concurrency   int                  `json:"concurrency"`
+	StopOnFailure bool                 `json:"stop_on_failure"`
+	Status        BatchTransferStatus  `json:"status"`
+	Items         []*BatchTransferItem `json:"items,omitempty"`
+	CreateTime    int64                `json:"create_time"`
+	FinishTime    int64                `json:"finish_time"`
+	APITokenID    string               `json:"-"` // amounts of items failed or skipped are given back to this api token
+}
+
+// Summary :
+func (b *BatchTransfer) Summary() *BatchTransferSummary {
+	s := &BatchTransferSummary{
+		Total:   len(b.Items),
+		Amounts: make(map[common.Address]*big.Int),
+	}
+	for _, item := range b.Items {
+		switch item.Status {
+		case BatchTransferItemPending:
+			s.Pending++
+		case BatchTransferItemProcessing:
+			s.Processing++
+		case BatchTransferItemSuccess:
+			s.Success++
+			amount, ok := s.Amounts[item.TokenAddress]
+			if !ok {
+				amount = big.NewInt(0)
+				s.Amounts[item.TokenAddress] = amount
+			}
+			amount.Add(amount, item.Amount)
+		case BatchTransferItemFailed:
+			s.Failed++
+		case BatchTransferItemSkipped:
+			s.Skipped++
+		case BatchTransferItemUnknown:
+			s.Unknown++
+		}
+	}
+	return s
+}
+
+func init() {
+	gob.Register(&BatchTransfer{})
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"encoding/gob"
+	"math"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+TokenNetworkConnection :
+token network joined by connection manager.
+Funds is the total amount used for channels of this token,
+JoinableFundsTarget of Funds is reserved for nodes opening channels with us later,
+and the rest is split evenly to open ChannelTarget channels.
+A connection being left is kept until all channels of the token are settled.
+*/
+type TokenNetworkConnection struct {
+	Key                 string         `json:"-" storm:"id"`
+	TokenAddress        common.Address `json:"token_address"`
+	Funds               *big.Int       `json:"funds"`
+	ChannelTarget       int            `json:"channel_target"`
+	JoinableFundsTarget float64        `json:"joinable_funds_target"`
+	CreateTime          int64          `json:"create_time"`
+	Leaving             bool           `json:"leaving"` // 正在退出,关闭的通道由 autoSettler settle,所有通道都 settle 以后删除
+}
+
+// NewTokenNetworkConnection :
+func NewTokenNetworkConnection(token common.Address, funds *big.Int, channelTarget int, joinableFundsTarget float64) *TokenNetworkConnection {
+	return &TokenNetworkConnection{
+		Key:                 token.String(),
+		TokenAddress:        token,
+		Funds:               funds,
+		ChannelTarget:       channelTarget,
+		JoinableFundsTarget: joinableFundsTarget,
+	}
+}
+
+// FundsForChannels funds used to open channels by ourself
+func (c *TokenNetworkConnection) FundsForChannels() *big.Int {
+	// 精确到千分之一,避免浮点误差
+	permille := int64(math.Round((1 - c.JoinableFundsTarget) * 1000))
+	n := new(big.Int).Mul(c.Funds, big.NewInt(permille))
+	return n.Div(n, big.NewInt(1000))
+}
+
+// InitialFundingPerPartner deposit of every channel opened by ourself
+func (c *TokenNetworkConnection) InitialFundingPerPartner() *big.Int {
+	if c.ChannelTarget <= 0 {
+		return big.NewInt(0)
+	}
+	return new(big.Int).Div(c.FundsForChannels(), big.NewInt(int64(c.ChannelTarget)))
+}
+
+func init() {
+	gob.Register(&TokenNetworkConnection{})
+}
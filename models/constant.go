@@ -5,6 +5,9 @@ import "github.com/ethereum/go-ethereum/common"
 // DbVersion :
 const DbVersion = 1
 
+// TransferIndexVersion : 交易记录和手续费记录索引的版本,索引变化时需要重建
+const TransferIndexVersion = 2
+
 // ChannelParticipantMap : used by BucketChannel
 type ChannelParticipantMap map[common.Hash][]byte
 
@@ -49,6 +52,75 @@ const (
 	BucketSentTransfer             = "SentTransfer"
 	BucketReceivedTransfer         = "ReceivedTransfer"
 	BucketTransferStatus           = "TransferStatus"
+	/*
+		gkvdb中交易记录的索引
+	*/
+	BucketSentTransferIndex     = "SentTransferIndex"
+	BucketReceivedTransferIndex = "ReceivedTransferIndex"
+	BucketFeeChargeRecordIndex  = "FeeChargeRecordIndex"
+	/*
+		通知发件箱,保存未被确认的通知
+	*/
+	BucketNotification         = "Notification"
+	BucketNotificationSeq      = "NotificationSeq"
+	BucketNotificationConsumer = "NotificationConsumer"
+	/*
+		webhook 及待投递的事件
+	*/
+	BucketWebhook         = "Webhook"
+	BucketWebhookDelivery = "WebhookDelivery"
+	/*
+		合约事件本地缓存
+	*/
+	BucketContractEvent        = "ContractEvent"
+	BucketContractEventKey     = "ContractEventKey"
+	BucketContractEventChannel = "ContractEventChannel"
+	BucketContractEventIndex   = "ContractEventIndex"
+	BucketContractEventSeq     = "ContractEventSeq"
+	/*
+		http api 的访问令牌
+	*/
+	BucketAPIToken = "APIToken"
+	/*
+		带 Idempotency-Key 的请求及其结果
+	*/
+	BucketIdempotencyRecord = "IdempotencyRecord"
+	/*
+		批量交易
+	*/
+	BucketBatchTransfer = "BatchTransfer"
+	/*
+		连接管理器加入的 token 网络
+	*/
+	BucketTokenNetworkConnection = "TokenNetworkConnection"
+	/*
+		通道余额的流动性规则
+	*/
+	BucketLiquidityRule = "LiquidityRule"
+	/*
+		watchtower 保护的通道
+	*/
+	BucketDelegation = "Delegation"
+	/*
+		token 的 symbol,name 和 decimals
+	*/
+	BucketTokenMetadata = "TokenMetadata"
+	/*
+		中转交易的限制
+	*/
+	BucketMediationLimitPolicy = "MediationLimitPolicy"
+	/*
+		我创建的收款请求
+	*/
+	BucketInvoice = "Invoice"
+	/*
+		其他节点的公钥,用于 keysend 加密密码
+	*/
+	BucketNodePublicKey = "NodePublicKey"
+	/*
+		收到以后需要暂停处理的交易
+	*/
+	BucketHoldLockSecretHash = "HoldLockSecretHash"
 )
 
 /*
@@ -60,6 +132,7 @@ const (
 	KeyCloseFlag      = "close"
 	KeyRegistry       = "registry"
 	KeySecretRegistry = "secretregistry"
+	KeyTransferIndex  = "transferIndex"
 
 	// keys of BucketBlockNumber
 	KeyBlockNumber     = "blocknumber"
@@ -70,6 +143,14 @@ const (
 
 	// keys of BucketFeePolicy
 	KeyFeePolicy string = "feePolicy"
+	// keys of BucketMediationLimitPolicy
+	KeyMediationLimitPolicy = "mediationLimitPolicy"
 	// keys of BucketToken
 	KeyToken = "tokens"
+	// keys of BucketNotificationSeq
+	KeyNotificationLastSeq  = "lastSeq"
+	KeyNotificationAckedSeq = "ackedSeq"
+	// keys of BucketContractEventSeq
+	KeyContractEventLastID   = "lastID"
+	KeyContractEventBackfill = "backfill"
 )
@@ -0,0 +1,152 @@
+package models
+
+import (
+	"encoding/gob"
+	"fmt"
+	"math/big"
+
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+ContractEvent :
+one contract event of TokensNetwork or SecretRegistry cached locally,
+so that events can be queried without calling FilterLogs on every request.
+ID is increased one by one in the order events are received from chain.
+Participant1,Participant2 are participants of the channel,
+Participant is the one who triggers this event, such as depositor, closer, beneficiary of punish...
+other fields are meaningful only for events carrying these values.
+*/
+type ContractEvent struct {
+	ID                 uint64         `json:"id" storm:"id"`
+	Key                string         `json:"-" storm:"unique"` // txHash+logIndex
+	EventName          string         `json:"event_name"`
+	BlockNumber        int64          `json:"block_number"`
+	TxHash             common.Hash    `json:"tx_hash"`
+	LogIndex           uint           `json:"log_index"`
+	TokenAddress       common.Address `json:"token_address"`
+	ChannelIdentifier  common.Hash    `json:"channel_identifier" storm:"index"`
+	Participant1       common.Address `json:"participant1"`
+	Participant2       common.Address `json:"participant2"`
+	Participant        common.Address `json:"participant"`
+	Amount             *big.Int       `json:"amount,omitempty"`
+	Participant1Amount *big.Int       `json:"participant1_amount,omitempty"`
+	Participant2Amount *big.Int       `json:"participant2_amount,omitempty"`
+	SettleTimeout      int            `json:"settle_timeout,omitempty"`
+	Locksroot          common.Hash    `json:"locksroot"`        // ChannelClosed,BalanceProofUpdated
+	LockHash           common.Hash    `json:"lock_hash"`        // ChannelUnlocked
+	Secret             common.Hash    `json:"secret"`           // SecretRevealed
+	LockSecretHash     common.Hash    `json:"lock_secret_hash"` // SecretRevealed
+}
+
+// ContractEventKey key of an event log, it's unique on chain
+func ContractEventKey(txHash common.Hash, logIndex uint) string {
+	return fmt.Sprintf("%s-%d", txHash.String(), logIndex)
+}
+
+// HasParticipant is p related to this event?
+func (e *ContractEvent) HasParticipant(p common.Address) bool {
+	return e.Participant1 == p || e.Participant2 == p || e.Participant == p
+}
+
+/*
+ContractEventChannel :
+token and participants of a channel, learned from ChannelOpenedAndDeposit,
+used to fill events which only have channel identifier.
+*/
+type ContractEventChannel struct {
+	TokenAddress common.Address
+	Participant1 common.Address
+	Participant2 common.Address
+}
+
+// ChannelInfo returns token and participants of the channel if this event has all of them, nil otherwise
+func (e *ContractEvent) ChannelInfo() *ContractEventChannel {
+	if e.ChannelIdentifier == utils.EmptyHash || e.TokenAddress == utils.EmptyAddress ||
+		e.Participant1 == utils.EmptyAddress || e.Participant2 == utils.EmptyAddress {
+		return nil
+	}
+	return &ContractEventChannel{
+		TokenAddress: e.TokenAddress,
+		Participant1: e.Participant1,
+		Participant2: e.Participant2,
+	}
+}
+
+// FillChannelInfo fill token and participants missing in this event
+func (e *ContractEvent) FillChannelInfo(c *ContractEventChannel) {
+	if e.TokenAddress == utils.EmptyAddress {
+		e.TokenAddress = c.TokenAddress
+	}
+	if e.Participant1 == utils.EmptyAddress && e.Participant2 == utils.EmptyAddress {
+		e.Participant1 = c.Participant1
+		e.Participant2 = c.Participant2
+	}
+}
+
+/*
+ContractEventFilter :
+conditions of querying cached contract events,
+only events whose ID is greater than Cursor are returned, at most Limit events if Limit > 0.
+empty value means no filter on it, FromBlock/ToBlock less than 0 means no limit.
+*/
+type ContractEventFilter struct {
+	Cursor            uint64
+	Limit             int
+	EventName         string
+	TokenAddress      common.Address
+	ChannelIdentifier common.Hash
+	Participant       common.Address
+	FromBlock         int64
+	ToBlock           int64
+}
+
+// Match does e satisfy all conditions except Cursor and Limit?
+func (f *ContractEventFilter) Match(e *ContractEvent) bool {
+	if f.EventName != "" && f.EventName != e.EventName {
+		return false
+	}
+	if f.TokenAddress != utils.EmptyAddress && f.TokenAddress != e.TokenAddress {
+		return false
+	}
+	if f.ChannelIdentifier != utils.EmptyHash && f.ChannelIdentifier != e.ChannelIdentifier {
+		return false
+	}
+	if f.Participant != utils.EmptyAddress && !e.HasParticipant(f.Participant) {
+		return false
+	}
+	if f.FromBlock >= 0 && e.BlockNumber < f.FromBlock {
+		return false
+	}
+	if f.ToBlock >= 0 && e.BlockNumber > f.ToBlock {
+		return false
+	}
+	return true
+}
+
+/*
+ContractEventBackfill :
+events before the block Photon starts caching are fetched from chain in background,
+events of blocks in [From,To) are not cached yet.
+*/
+type ContractEventBackfill struct {
+	From int64
+	To   int64
+}
+
+// Done are all events before To cached?
+func (b *ContractEventBackfill) Done() bool {
+	return b.From >= b.To
+}
+
+// Covers are all events since fromBlock cached?
+func (b *ContractEventBackfill) Covers(fromBlock int64) bool {
+	return b.Done() || fromBlock >= b.To
+}
+
+func init() {
+	gob.Register(&ContractEvent{})
+	gob.Register(&ContractEventChannel{})
+	gob.Register(&ContractEventBackfill{})
+}
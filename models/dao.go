@@ -98,6 +98,7 @@ type FeeChargeRecordDao interface {
 	SaveFeeChargeRecord(r *FeeChargeRecord) (err error)
 	GetAllFeeChargeRecord() (records []*FeeChargeRecord, err error)
 	GetFeeChargeRecordByLockSecretHash(lockSecretHash common.Hash) (records []*FeeChargeRecord, err error)
+	IterateFeeChargeRecords(q *TransferQuery, fn func(r *FeeChargeRecord) error) error
 }
 
 // FeePolicyDao :
@@ -106,6 +107,12 @@ type FeePolicyDao interface {
 	GetFeePolicy() (fp *FeePolicy)
 }
 
+// MediationLimitPolicyDao :
+type MediationLimitPolicyDao interface {
+	SaveMediationLimitPolicy(p *MediationLimitPolicy) (err error)
+	GetMediationLimitPolicy() (p *MediationLimitPolicy)
+}
+
 // NonParticipantChannelDao :
 type NonParticipantChannelDao interface {
 	NewNonParticipantChannel(token common.Address, channelIdentifier common.Hash, participant1, participant2 common.Address) error
@@ -149,6 +156,8 @@ type SentTransferDao interface {
 	GetSentTransfer(key string) (*SentTransfer, error)
 	GetSentTransferInBlockRange(fromBlock, toBlock int64) (transfers []*SentTransfer, err error)
 	GetSentTransferInTimeRange(from, to time.Time) (transfers []*SentTransfer, err error)
+	QuerySentTransfers(q *TransferQuery) (transfers []*SentTransfer, err error)
+	IterateSentTransfers(q *TransferQuery, fn func(st *SentTransfer) error) error
 }
 
 // ReceivedTransferDao :
@@ -157,6 +166,8 @@ type ReceivedTransferDao interface {
 	GetReceivedTransfer(key string) (*ReceivedTransfer, error)
 	GetReceivedTransferInBlockRange(fromBlock, toBlock int64) (transfers []*ReceivedTransfer, err error)
 	GetReceivedTransferInTimeRange(from, to time.Time) (transfers []*ReceivedTransfer, err error)
+	QueryReceivedTransfers(q *TransferQuery) (transfers []*ReceivedTransfer, err error)
+	IterateReceivedTransfers(q *TransferQuery, fn func(rt *ReceivedTransfer) error) error
 }
 
 // TransferStatusDao :
@@ -164,9 +175,152 @@ type TransferStatusDao interface {
 	NewTransferStatus(tokenAddress common.Address, lockSecretHash common.Hash)
 	UpdateTransferStatus(tokenAddress common.Address, lockSecretHash common.Hash, status TransferStatusCode, statusMessage string)
 	UpdateTransferStatusMessage(tokenAddress common.Address, lockSecretHash common.Hash, statusMessage string)
+	UpdateTransferStatusParts(tokenAddress common.Address, lockSecretHash common.Hash, parts []*TransferPartStatus)
 	GetTransferStatus(tokenAddress common.Address, lockSecretHash common.Hash) (*TransferStatus, error)
 }
 
+/*
+NotificationDao :
+durable outbox of notifications for upper app,
+notifications are kept until acknowledged by all consumers.
+*/
+type NotificationDao interface {
+	NewNotification(n *Notification) error
+	GetNotificationsAfter(seq uint64, limit int) (ns []*Notification, err error)
+	AckNotifications(consumer string, seq uint64) error
+	GetNotificationConsumerCursor(consumer string) uint64
+	RemoveNotificationConsumer(consumer string) error
+	GetNotificationLastSeq() uint64
+	GetNotificationAckedSeq() uint64
+}
+
+// WebhookDao :
+type WebhookDao interface {
+	SaveWebhook(w *Webhook) error
+	RemoveWebhook(id string) error
+	GetAllWebhooks() (ws []*Webhook, err error)
+	SaveWebhookDelivery(d *WebhookDelivery) error
+	RemoveWebhookDelivery(key string) error
+	GetAllWebhookDeliveries() (ds []*WebhookDelivery, err error)
+}
+
+/*
+ContractEventDao :
+local cache of contract events,
+events are saved when received from chain and never removed.
+*/
+type ContractEventDao interface {
+	SaveContractEvents(es []*ContractEvent) error
+	GetContractEvents(f *ContractEventFilter) (es []*ContractEvent, err error)
+	GetContractEventLastID() uint64
+	GetContractEventBackfill() *ContractEventBackfill
+	SaveContractEventBackfill(b *ContractEventBackfill) error
+}
+
+/*
+APITokenDao :
+tokens of http api, identified by APITokenID of the secret.
+*/
+type APITokenDao interface {
+	NewAPIToken(t *APIToken) error
+	GetAPIToken(id string) (*APIToken, error)
+	GetAllAPITokens() (ts []*APIToken, err error)
+	RemoveAPIToken(id string) error
+	HasAPIToken() bool
+	SpendAPIToken(id string, token common.Address, amount *big.Int) error
+	RefundAPIToken(id string, token common.Address, amount *big.Int) error
+}
+
+/*
+IdempotencyDao :
+requests with Idempotency-Key, NewIdempotencyRecord returns ErrIdempotencyKeyExists if key exists.
+*/
+type IdempotencyDao interface {
+	NewIdempotencyRecord(r *IdempotencyRecord) error
+	GetIdempotencyRecord(key string) (*IdempotencyRecord, error)
+	UpdateIdempotencyRecord(r *IdempotencyRecord) error
+	RemoveIdempotencyRecordsBefore(createTime int64) error
+}
+
+// BatchTransferDao :
+type BatchTransferDao interface {
+	SaveBatchTransfer(b *BatchTransfer) error
+	GetBatchTransfer(id string) (*BatchTransfer, error)
+	GetAllBatchTransfers() (bs []*BatchTransfer, err error)
+}
+
+/*
+TokenNetworkConnectionDao :
+token networks joined by connection manager, one connection for each token.
+*/
+type TokenNetworkConnectionDao interface {
+	SaveTokenNetworkConnection(c *TokenNetworkConnection) error
+	GetTokenNetworkConnection(token common.Address) (*TokenNetworkConnection, error)
+	GetAllTokenNetworkConnections() (cs []*TokenNetworkConnection, err error)
+	RemoveTokenNetworkConnection(token common.Address) error
+}
+
+/*
+LiquidityRuleDao :
+liquidity rules of channels and tokens, identified by LiquidityRuleKey.
+*/
+type LiquidityRuleDao interface {
+	SaveLiquidityRule(r *LiquidityRule) error
+	GetLiquidityRule(key string) (*LiquidityRule, error)
+	GetAllLiquidityRules() (rs []*LiquidityRule, err error)
+	RemoveLiquidityRule(key string) error
+}
+
+/*
+DelegationDao :
+channels of other nodes watched by us, identified by channel identifier.
+*/
+type DelegationDao interface {
+	SaveDelegation(d *Delegation) error
+	GetDelegation(channelIdentifier common.Hash) (*Delegation, error)
+	GetAllDelegations() (ds []*Delegation, err error)
+	RemoveDelegation(channelIdentifier common.Hash) error
+}
+
+/*
+TokenMetadataDao :
+cached ERC20 metadata of tokens, identified by token address.
+*/
+type TokenMetadataDao interface {
+	SaveTokenMetadata(m *TokenMetadata) error
+	GetTokenMetadata(token common.Address) (*TokenMetadata, error)
+	GetAllTokenMetadata() (ms []*TokenMetadata, err error)
+}
+
+/*
+InvoiceDao :
+invoices created by us, identified by lock secret hash.
+*/
+type InvoiceDao interface {
+	SaveInvoice(i *Invoice) error
+	GetInvoice(lockSecretHash common.Hash) (*Invoice, error)
+	GetInvoiceList() (is []*Invoice, err error)
+}
+
+/*
+NodePublicKeyDao :
+public keys of other nodes learned from their signed messages.
+*/
+type NodePublicKeyDao interface {
+	SaveNodePublicKey(pk *NodePublicKey) error
+	GetNodePublicKey(addr common.Address) (*NodePublicKey, error)
+}
+
+/*
+HoldTransferDao :
+lock secret hashes of incoming transfers to hold, set before they are received.
+*/
+type HoldTransferDao interface {
+	AddHoldLockSecretHash(lockSecretHash common.Hash) error
+	RemoveHoldLockSecretHash(lockSecretHash common.Hash) error
+	GetHoldLockSecretHashList() (hs []common.Hash, err error)
+}
+
 // XMPPSubDao :
 type XMPPSubDao interface {
 	XMPPMarkAddrSubed(addr common.Address)
@@ -187,6 +341,7 @@ type Dao interface {
 	SentEnvelopMessagerDao
 	FeeChargeRecordDao
 	FeePolicyDao
+	MediationLimitPolicyDao
 	NonParticipantChannelDao
 	SentAnnounceDisposedDao
 	ReceivedAnnounceDisposedDao
@@ -195,6 +350,19 @@ type Dao interface {
 	SentTransferDao
 	ReceivedTransferDao
 	TransferStatusDao
+	NotificationDao
+	WebhookDao
+	ContractEventDao
+	APITokenDao
+	IdempotencyDao
+	BatchTransferDao
+	TokenNetworkConnectionDao
+	LiquidityRuleDao
+	DelegationDao
+	TokenMetadataDao
+	InvoiceDao
+	NodePublicKeyDao
+	HoldTransferDao
 	XMPPSubDao
 
 	StartTx() (tx TX)
@@ -205,4 +373,5 @@ type Dao interface {
 	RegisterChannelDepositCallback(f cb.ChannelCb)
 	RegisterChannelStateCallback(f cb.ChannelCb)
 	RegisterChannelSettleCallback(f cb.ChannelCb)
+	RegisterChannelUpdateCallback(f cb.ChannelCb)
 }
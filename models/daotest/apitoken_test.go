@@ -0,0 +1,97 @@
+package daotest
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/codefortest"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModelDB_APIToken(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	assert.False(t, dao.HasAPIToken())
+
+	token := utils.NewRandomAddress()
+	secret := "photon_test"
+	at := &models.APIToken{
+		ID:           models.APITokenID(secret),
+		Name:         "shop",
+		Scopes:       models.APITokenScopeRead | models.APITokenScopeTransfer,
+		SecretHash:   models.APITokenSecretHash(secret),
+		SpendingCaps: map[common.Address]*big.Int{token: big.NewInt(100)},
+		CreateTime:   time.Now().Unix(),
+	}
+	err := dao.NewAPIToken(at)
+	assert.Empty(t, err)
+	assert.True(t, dao.HasAPIToken())
+
+	at2, err := dao.GetAPIToken(at.ID)
+	assert.Empty(t, err)
+	assert.True(t, at2.MatchSecret(secret))
+	assert.False(t, at2.MatchSecret("photon_other"))
+	assert.True(t, at2.Allow(models.APITokenScopeRead))
+	assert.True(t, at2.Allow(models.APITokenScopeTransfer))
+	assert.False(t, at2.Allow(models.APITokenScopeChannel))
+	assert.False(t, at2.Allow(models.APITokenScopeDebug))
+
+	// spending cap
+	err = dao.SpendAPIToken(at.ID, token, big.NewInt(60))
+	assert.Empty(t, err)
+	err = dao.SpendAPIToken(at.ID, token, big.NewInt(50))
+	assert.EqualValues(t, models.ErrSpendingCapExceeded, err)
+	err = dao.SpendAPIToken(at.ID, token, big.NewInt(40))
+	assert.Empty(t, err)
+	err = dao.SpendAPIToken(at.ID, utils.NewRandomAddress(), big.NewInt(1000))
+	assert.Empty(t, err)
+	at2, err = dao.GetAPIToken(at.ID)
+	assert.Empty(t, err)
+	assert.EqualValues(t, 100, at2.Spent[token].Int64())
+
+	// amount of failed transfers is given back
+	err = dao.RefundAPIToken(at.ID, token, big.NewInt(30))
+	assert.Empty(t, err)
+	err = dao.SpendAPIToken(at.ID, token, big.NewInt(30))
+	assert.Empty(t, err)
+	err = dao.RefundAPIToken(at.ID, token, big.NewInt(1000))
+	assert.Empty(t, err)
+	at2, err = dao.GetAPIToken(at.ID)
+	assert.Empty(t, err)
+	assert.EqualValues(t, 0, at2.Spent[token].Int64())
+	err = dao.RefundAPIToken("unknown", token, big.NewInt(1))
+	assert.NotEmpty(t, err)
+
+	ts, err := dao.GetAllAPITokens()
+	assert.Empty(t, err)
+	assert.Len(t, ts, 1)
+
+	err = dao.RemoveAPIToken(at.ID)
+	assert.Empty(t, err)
+	_, err = dao.GetAPIToken(at.ID)
+	assert.NotEmpty(t, err)
+	assert.False(t, dao.HasAPIToken())
+}
+
+func TestAPITokenScope(t *testing.T) {
+	s := models.APITokenScopeRead | models.APITokenScopeChannel
+	assert.True(t, s.IsValid())
+	assert.False(t, models.APITokenScope(0).IsValid())
+	assert.False(t, (models.APITokenScopeAll + 1).IsValid())
+	assert.True(t, s.Has(models.APITokenScopeChannel))
+	assert.False(t, s.Has(models.APITokenScopeTransfer))
+	data, err := json.Marshal(s)
+	assert.Empty(t, err)
+	assert.EqualValues(t, `["read-only","channel-admin"]`, string(data))
+	var s2 models.APITokenScope
+	err = json.Unmarshal(data, &s2)
+	assert.Empty(t, err)
+	assert.EqualValues(t, s, s2)
+	err = json.Unmarshal([]byte(`["admin"]`), &s2)
+	assert.NotEmpty(t, err)
+}
@@ -0,0 +1,58 @@
+package daotest
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/codefortest"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModelDB_SaveBatchTransfer(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	token := utils.NewRandomAddress()
+	b := &models.BatchTransfer{
+		ID:          "batch1",
+		Concurrency: 2,
+		Status:      models.BatchTransferRunning,
+		CreateTime:  time.Now().Unix(),
+	}
+	for i := 1; i <= 3; i++ {
+		b.Items = append(b.Items, &models.BatchTransferItem{
+			TokenAddress:  token,
+			TargetAddress: utils.NewRandomAddress(),
+			Amount:        big.NewInt(int64(i * 10)),
+			Fee:           big.NewInt(0),
+			Status:        models.BatchTransferItemPending,
+		})
+	}
+	err := dao.SaveBatchTransfer(b)
+	assert.Empty(t, err)
+
+	b.Items[0].Status = models.BatchTransferItemSuccess
+	b.Items[1].Status = models.BatchTransferItemSuccess
+	b.Items[2].Status = models.BatchTransferItemFailed
+	b.Items[2].Error = "no route"
+	b.Status = models.BatchTransferFinished
+	err = dao.SaveBatchTransfer(b)
+	assert.Empty(t, err)
+
+	b2, err := dao.GetBatchTransfer("batch1")
+	assert.Empty(t, err)
+	assert.EqualValues(t, b, b2)
+	s := b2.Summary()
+	assert.EqualValues(t, 3, s.Total)
+	assert.EqualValues(t, 2, s.Success)
+	assert.EqualValues(t, 1, s.Failed)
+	assert.EqualValues(t, 30, s.Amounts[token].Int64())
+
+	bs, err := dao.GetAllBatchTransfers()
+	assert.Empty(t, err)
+	assert.Len(t, bs, 1)
+	_, err = dao.GetBatchTransfer("batch2")
+	assert.NotEmpty(t, err)
+}
@@ -0,0 +1,54 @@
+package daotest
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/codefortest"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModelDB_TokenNetworkConnection(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	token := utils.NewRandomAddress()
+	_, err := dao.GetTokenNetworkConnection(token)
+	assert.NotEmpty(t, err)
+
+	c := models.NewTokenNetworkConnection(token, big.NewInt(1000), 3, 0.4)
+	assert.EqualValues(t, 600, c.FundsForChannels().Int64())
+	assert.EqualValues(t, 200, c.InitialFundingPerPartner().Int64())
+	err = dao.SaveTokenNetworkConnection(c)
+	assert.Empty(t, err)
+	err = dao.SaveTokenNetworkConnection(models.NewTokenNetworkConnection(utils.NewRandomAddress(), big.NewInt(10), 1, 0))
+	assert.Empty(t, err)
+
+	c.Funds = big.NewInt(2000)
+	err = dao.SaveTokenNetworkConnection(c)
+	assert.Empty(t, err)
+	c2, err := dao.GetTokenNetworkConnection(token)
+	assert.Empty(t, err)
+	assert.EqualValues(t, c, c2)
+	cs, err := dao.GetAllTokenNetworkConnections()
+	assert.Empty(t, err)
+	assert.EqualValues(t, 2, len(cs))
+
+	c.Leaving = true
+	err = dao.SaveTokenNetworkConnection(c)
+	assert.Empty(t, err)
+	c2, err = dao.GetTokenNetworkConnection(token)
+	assert.Empty(t, err)
+	assert.True(t, c2.Leaving)
+
+	err = dao.RemoveTokenNetworkConnection(token)
+	assert.Empty(t, err)
+	err = dao.RemoveTokenNetworkConnection(token)
+	assert.NotEmpty(t, err)
+	_, err = dao.GetTokenNetworkConnection(token)
+	assert.NotEmpty(t, err)
+	cs, err = dao.GetAllTokenNetworkConnections()
+	assert.Empty(t, err)
+	assert.EqualValues(t, 1, len(cs))
+}
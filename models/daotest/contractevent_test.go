@@ -0,0 +1,152 @@
+package daotest
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/codefortest"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestContractEvent(name string, blockNumber int64) *models.ContractEvent {
+	txHash := utils.NewRandomHash()
+	return &models.ContractEvent{
+		Key:         models.ContractEventKey(txHash, 0),
+		EventName:   name,
+		BlockNumber: blockNumber,
+		TxHash:      txHash,
+	}
+}
+
+func TestModelDB_ContractEvent(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	assert.EqualValues(t, 0, dao.GetContractEventLastID())
+	token := utils.NewRandomAddress()
+	p1 := utils.NewRandomAddress()
+	p2 := utils.NewRandomAddress()
+	channel := utils.NewRandomHash()
+
+	tokenAdded := newTestContractEvent(params.NameTokenNetworkCreated, 1)
+	tokenAdded.TokenAddress = token
+	open := newTestContractEvent(params.NameChannelOpenedAndDeposit, 2)
+	open.TokenAddress = token
+	open.ChannelIdentifier = channel
+	open.Participant1 = p1
+	open.Participant2 = p2
+	open.Participant = p1
+	open.Amount = big.NewInt(10)
+	// token and participants are filled from open event in the same batch
+	deposit := newTestContractEvent(params.NameChannelNewDeposit, 3)
+	deposit.ChannelIdentifier = channel
+	deposit.Participant = p2
+	deposit.Amount = big.NewInt(20)
+	err := dao.SaveContractEvents([]*models.ContractEvent{tokenAdded, open, deposit})
+	assert.Empty(t, err)
+	assert.EqualValues(t, 3, dao.GetContractEventLastID())
+
+	// repeated events are ignored, events in later batch are filled too
+	closed := newTestContractEvent(params.NameChannelClosed, 4)
+	closed.ChannelIdentifier = channel
+	closed.Participant = p1
+	other := newTestContractEvent(params.NameChannelNewDeposit, 5)
+	other.ChannelIdentifier = utils.NewRandomHash()
+	other.Participant = utils.NewRandomAddress()
+	err = dao.SaveContractEvents([]*models.ContractEvent{deposit, closed, other})
+	assert.Empty(t, err)
+	assert.EqualValues(t, 5, dao.GetContractEventLastID())
+
+	es, err := dao.GetContractEvents(&models.ContractEventFilter{FromBlock: -1, ToBlock: -1})
+	assert.Empty(t, err)
+	if assert.Len(t, es, 5) {
+		for i, e := range es {
+			assert.EqualValues(t, i+1, e.ID)
+		}
+		assert.EqualValues(t, token, es[2].TokenAddress)
+		assert.EqualValues(t, p1, es[2].Participant1)
+		assert.EqualValues(t, p2, es[2].Participant2)
+		assert.EqualValues(t, 20, es[2].Amount.Int64())
+		assert.EqualValues(t, token, es[3].TokenAddress)
+	}
+
+	// cursor and limit
+	es, err = dao.GetContractEvents(&models.ContractEventFilter{Cursor: 1, Limit: 2, FromBlock: -1, ToBlock: -1})
+	assert.Empty(t, err)
+	if assert.Len(t, es, 2) {
+		assert.EqualValues(t, 2, es[0].ID)
+		assert.EqualValues(t, 3, es[1].ID)
+	}
+
+	// filters
+	es, err = dao.GetContractEvents(&models.ContractEventFilter{TokenAddress: token, FromBlock: -1, ToBlock: -1})
+	assert.Empty(t, err)
+	assert.Len(t, es, 4)
+	es, err = dao.GetContractEvents(&models.ContractEventFilter{ChannelIdentifier: channel, Cursor: 2, FromBlock: -1, ToBlock: -1})
+	assert.Empty(t, err)
+	if assert.Len(t, es, 2) {
+		assert.EqualValues(t, 3, es[0].ID)
+		assert.EqualValues(t, 4, es[1].ID)
+	}
+	es, err = dao.GetContractEvents(&models.ContractEventFilter{
+		EventName:   params.NameChannelNewDeposit,
+		Participant: p1,
+		FromBlock:   -1,
+		ToBlock:     -1,
+	})
+	assert.Empty(t, err)
+	if assert.Len(t, es, 1) {
+		assert.EqualValues(t, 3, es[0].ID)
+	}
+	es, err = dao.GetContractEvents(&models.ContractEventFilter{FromBlock: 2, ToBlock: 4})
+	assert.Empty(t, err)
+	assert.Len(t, es, 3)
+}
+
+func TestModelDB_ContractEventBackfill(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	assert.Nil(t, dao.GetContractEventBackfill())
+	err := dao.SaveContractEventBackfill(&models.ContractEventBackfill{To: 100})
+	assert.Empty(t, err)
+	b := dao.GetContractEventBackfill()
+	if assert.NotNil(t, b) {
+		assert.False(t, b.Done())
+		assert.False(t, b.Covers(-1))
+		assert.False(t, b.Covers(99))
+		assert.True(t, b.Covers(100))
+	}
+	err = dao.SaveContractEventBackfill(&models.ContractEventBackfill{From: 100, To: 100})
+	assert.Empty(t, err)
+	assert.True(t, dao.GetContractEventBackfill().Covers(-1))
+
+	// events saved before ChannelOpenedAndDeposit is fetched by backfill are filled when queried
+	token := utils.NewRandomAddress()
+	p1 := utils.NewRandomAddress()
+	p2 := utils.NewRandomAddress()
+	channel := utils.NewRandomHash()
+	closed := newTestContractEvent(params.NameChannelClosed, 200)
+	closed.ChannelIdentifier = channel
+	closed.Participant = p1
+	err = dao.SaveContractEvents([]*models.ContractEvent{closed})
+	assert.Empty(t, err)
+	open := newTestContractEvent(params.NameChannelOpenedAndDeposit, 50)
+	open.TokenAddress = token
+	open.ChannelIdentifier = channel
+	open.Participant1 = p1
+	open.Participant2 = p2
+	open.Participant = p1
+	err = dao.SaveContractEvents([]*models.ContractEvent{open})
+	assert.Empty(t, err)
+	es, err := dao.GetContractEvents(&models.ContractEventFilter{Participant: p2, FromBlock: -1, ToBlock: -1})
+	assert.Empty(t, err)
+	if assert.Len(t, es, 2) {
+		assert.EqualValues(t, params.NameChannelClosed, es[0].EventName)
+		assert.EqualValues(t, token, es[0].TokenAddress)
+	}
+	es, err = dao.GetContractEvents(&models.ContractEventFilter{ChannelIdentifier: channel, TokenAddress: token, FromBlock: -1, ToBlock: -1})
+	assert.Empty(t, err)
+	assert.Len(t, es, 2)
+}
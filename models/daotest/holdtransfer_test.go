@@ -0,0 +1,38 @@
+package daotest
+
+import (
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/codefortest"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModelDB_HoldLockSecretHash(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	hs, err := dao.GetHoldLockSecretHashList()
+	assert.Empty(t, err)
+	assert.EqualValues(t, 0, len(hs))
+
+	h1 := utils.NewRandomHash()
+	h2 := utils.NewRandomHash()
+	err = dao.AddHoldLockSecretHash(h1)
+	assert.Empty(t, err)
+	err = dao.AddHoldLockSecretHash(h2)
+	assert.Empty(t, err)
+	err = dao.AddHoldLockSecretHash(h1)
+	assert.Empty(t, err)
+	hs, err = dao.GetHoldLockSecretHashList()
+	assert.Empty(t, err)
+	assert.EqualValues(t, 2, len(hs))
+
+	err = dao.RemoveHoldLockSecretHash(h1)
+	assert.Empty(t, err)
+	err = dao.RemoveHoldLockSecretHash(h1)
+	assert.Empty(t, err)
+	hs, err = dao.GetHoldLockSecretHashList()
+	assert.Empty(t, err)
+	assert.EqualValues(t, 1, len(hs))
+	assert.EqualValues(t, h2, hs[0])
+}
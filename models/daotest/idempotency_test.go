@@ -0,0 +1,45 @@
+package daotest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/codefortest"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModelDB_IdempotencyRecord(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	now := time.Now().Unix()
+	r := &models.IdempotencyRecord{
+		Key:         "key1",
+		RequestHash: utils.NewRandomHash(),
+		CreateTime:  now,
+	}
+	err := dao.NewIdempotencyRecord(r)
+	assert.Empty(t, err)
+	err = dao.NewIdempotencyRecord(&models.IdempotencyRecord{Key: "key1", CreateTime: now})
+	assert.EqualValues(t, models.ErrIdempotencyKeyExists, err)
+
+	r.LockSecretHash = utils.NewRandomHash()
+	r.Status = models.IdempotencyStatusDone
+	r.StatusCode = 200
+	r.Response = []byte("{}")
+	err = dao.UpdateIdempotencyRecord(r)
+	assert.Empty(t, err)
+	r2, err := dao.GetIdempotencyRecord("key1")
+	assert.Empty(t, err)
+	assert.EqualValues(t, r, r2)
+
+	err = dao.NewIdempotencyRecord(&models.IdempotencyRecord{Key: "key2", CreateTime: now - 100})
+	assert.Empty(t, err)
+	err = dao.RemoveIdempotencyRecordsBefore(now - 10)
+	assert.Empty(t, err)
+	_, err = dao.GetIdempotencyRecord("key2")
+	assert.NotEmpty(t, err)
+	_, err = dao.GetIdempotencyRecord("key1")
+	assert.Empty(t, err)
+}
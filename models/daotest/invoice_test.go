@@ -0,0 +1,45 @@
+package daotest
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/codefortest"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModelDB_Invoice(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	secret := utils.NewRandomHash()
+	i := &models.Invoice{
+		LockSecretHash: utils.ShaSecret(secret[:]),
+		Secret:         secret,
+		TokenAddress:   utils.NewRandomAddress(),
+		Receiver:       utils.NewRandomAddress(),
+		Amount:         big.NewInt(100),
+		Expiry:         time.Now().Unix() + 3600,
+		Description:    "coffee",
+	}
+	_, err := dao.GetInvoice(i.LockSecretHash)
+	assert.NotEmpty(t, err)
+	err = dao.SaveInvoice(i)
+	assert.Empty(t, err)
+	i2, err := dao.GetInvoice(i.LockSecretHash)
+	assert.Empty(t, err)
+	assert.EqualValues(t, secret, i2.Secret)
+	assert.EqualValues(t, big.NewInt(100), i2.Amount)
+	assert.EqualValues(t, models.InvoiceStatusUnpaid, i2.Status)
+	assert.EqualValues(t, false, i2.IsExpired(time.Now().Unix()))
+
+	i2.Status = models.InvoiceStatusPaid
+	err = dao.SaveInvoice(i2)
+	assert.Empty(t, err)
+	is, err := dao.GetInvoiceList()
+	assert.Empty(t, err)
+	assert.EqualValues(t, 1, len(is))
+	assert.EqualValues(t, models.InvoiceStatusPaid, is[0].Status)
+}
@@ -0,0 +1,80 @@
+package daotest
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/codefortest"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModelDB_LiquidityRule(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	token := utils.NewRandomAddress()
+	r := &models.LiquidityRule{
+		TokenAddress: token,
+		MinBalance:   big.NewInt(100),
+		MaxBalance:   big.NewInt(300),
+	}
+	err := r.Normalize()
+	assert.Empty(t, err)
+	assert.EqualValues(t, 200, r.TargetBalance.Int64())
+	assert.EqualValues(t, token.String(), r.Key)
+	deposit, withdraw := r.Adjustment(big.NewInt(50))
+	assert.EqualValues(t, 150, deposit.Int64())
+	assert.Nil(t, withdraw)
+	deposit, withdraw = r.Adjustment(big.NewInt(250))
+	assert.Nil(t, deposit)
+	assert.Nil(t, withdraw)
+	deposit, withdraw = r.Adjustment(big.NewInt(500))
+	assert.Nil(t, deposit)
+	assert.EqualValues(t, 300, withdraw.Int64())
+	err = dao.SaveLiquidityRule(r)
+	assert.Empty(t, err)
+
+	r2 := &models.LiquidityRule{
+		TokenAddress:      token,
+		ChannelIdentifier: utils.NewRandomHash(),
+		MinBalance:        big.NewInt(10),
+		TargetBalance:     big.NewInt(5),
+	}
+	assert.NotEmpty(t, r2.Normalize())
+	r2.TargetBalance = nil
+	assert.Empty(t, r2.Normalize())
+	assert.EqualValues(t, r2.ChannelIdentifier.String(), r2.Key)
+	err = dao.SaveLiquidityRule(r2)
+	assert.Empty(t, err)
+
+	r3, err := dao.GetLiquidityRule(r.Key)
+	assert.Empty(t, err)
+	assert.EqualValues(t, r, r3)
+
+	ch := utils.NewRandomHash()
+	assert.False(t, r.IsPrepared(ch))
+	assert.True(t, r.SetPrepared(ch, true))
+	assert.False(t, r.SetPrepared(ch, true))
+	err = dao.SaveLiquidityRule(r)
+	assert.Empty(t, err)
+	r3, err = dao.GetLiquidityRule(r.Key)
+	assert.Empty(t, err)
+	assert.True(t, r3.IsPrepared(ch))
+	assert.True(t, r3.SetPrepared(ch, false))
+	assert.False(t, r3.SetPrepared(ch, false))
+	assert.False(t, r3.IsPrepared(ch))
+	rs, err := dao.GetAllLiquidityRules()
+	assert.Empty(t, err)
+	assert.EqualValues(t, 2, len(rs))
+
+	err = dao.RemoveLiquidityRule(r.Key)
+	assert.Empty(t, err)
+	err = dao.RemoveLiquidityRule(r.Key)
+	assert.NotEmpty(t, err)
+	_, err = dao.GetLiquidityRule(r.Key)
+	assert.NotEmpty(t, err)
+	rs, err = dao.GetAllLiquidityRules()
+	assert.Empty(t, err)
+	assert.EqualValues(t, 1, len(rs))
+}
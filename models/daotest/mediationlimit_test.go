@@ -0,0 +1,40 @@
+package daotest
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/codefortest"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModelDB_MediationLimitPolicy(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	token := utils.NewRandomAddress()
+	channelIdentifier := utils.NewRandomHash()
+
+	p := dao.GetMediationLimitPolicy()
+	assert.EqualValues(t, 0, p.GetLimit(token, channelIdentifier).MaxPendingLocks)
+
+	p.AccountLimit.MaxPendingLocks = 10
+	p.TokenLimitMap[token] = &models.MediationLimit{
+		MaxPendingLocks: 5,
+		MaxLockedAmount: big.NewInt(100),
+	}
+	p.ChannelLimitMap[channelIdentifier] = &models.MediationLimit{
+		MaxPendingLocks:   2,
+		MinTransferAmount: big.NewInt(3),
+	}
+	err := dao.SaveMediationLimitPolicy(p)
+	assert.Empty(t, err)
+
+	p2 := dao.GetMediationLimitPolicy()
+	assert.EqualValues(t, 2, p2.GetLimit(token, channelIdentifier).MaxPendingLocks)
+	assert.EqualValues(t, 3, p2.GetLimit(token, channelIdentifier).MinTransferAmount.Int64())
+	assert.EqualValues(t, 5, p2.GetLimit(token, utils.NewRandomHash()).MaxPendingLocks)
+	assert.EqualValues(t, 100, p2.GetLimit(token, utils.NewRandomHash()).MaxLockedAmount.Int64())
+	assert.EqualValues(t, 10, p2.GetLimit(utils.NewRandomAddress(), utils.NewRandomHash()).MaxPendingLocks)
+}
@@ -0,0 +1,114 @@
+package daotest
+
+import (
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/codefortest"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModelDB_Notification(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	assert.EqualValues(t, 0, dao.GetNotificationLastSeq())
+	assert.EqualValues(t, 0, dao.GetNotificationAckedSeq())
+	for i := uint64(1); i <= 5; i++ {
+		err := dao.NewNotification(&models.Notification{
+			Seq:  i,
+			Type: "notice",
+			Data: []byte(`"test"`),
+		})
+		assert.Empty(t, err)
+	}
+	assert.EqualValues(t, 5, dao.GetNotificationLastSeq())
+
+	ns, err := dao.GetNotificationsAfter(2, 100)
+	assert.Empty(t, err)
+	assert.Len(t, ns, 3)
+	assert.EqualValues(t, 3, ns[0].Seq)
+	assert.EqualValues(t, 5, ns[2].Seq)
+	assert.EqualValues(t, `"test"`, string(ns[0].Data))
+	// one page at a time
+	ns, err = dao.GetNotificationsAfter(1, 2)
+	assert.Empty(t, err)
+	assert.Len(t, ns, 2)
+	assert.EqualValues(t, 2, ns[0].Seq)
+	assert.EqualValues(t, 3, ns[1].Seq)
+
+	// no consumer has acknowledged anything
+	assert.EqualValues(t, 0, dao.GetNotificationConsumerCursor("mobile"))
+	err = dao.AckNotifications("mobile", 3)
+	assert.Empty(t, err)
+	assert.EqualValues(t, 3, dao.GetNotificationAckedSeq())
+	assert.EqualValues(t, 3, dao.GetNotificationConsumerCursor("mobile"))
+	ns, err = dao.GetNotificationsAfter(0, 100)
+	assert.Empty(t, err)
+	assert.Len(t, ns, 2)
+	assert.EqualValues(t, 4, ns[0].Seq)
+
+	// kept until all consumers have acknowledged them
+	err = dao.AckNotifications("webhook", 4)
+	assert.Empty(t, err)
+	err = dao.AckNotifications("mobile", 100)
+	assert.Empty(t, err)
+	assert.EqualValues(t, 4, dao.GetNotificationAckedSeq())
+	assert.EqualValues(t, 100, dao.GetNotificationConsumerCursor("mobile"))
+	// cursor never goes back
+	err = dao.AckNotifications("mobile", 1)
+	assert.Empty(t, err)
+	assert.EqualValues(t, 100, dao.GetNotificationConsumerCursor("mobile"))
+	ns, err = dao.GetNotificationsAfter(0, 100)
+	assert.Empty(t, err)
+	assert.Len(t, ns, 1)
+	assert.EqualValues(t, 5, ns[0].Seq)
+
+	// consumer removed, ack more than saved
+	err = dao.RemoveNotificationConsumer("webhook")
+	assert.Empty(t, err)
+	err = dao.RemoveNotificationConsumer("webhook")
+	assert.NotEmpty(t, err)
+	assert.EqualValues(t, 5, dao.GetNotificationAckedSeq())
+	assert.EqualValues(t, 5, dao.GetNotificationConsumerCursor("webhook"))
+	ns, err = dao.GetNotificationsAfter(0, 100)
+	assert.Empty(t, err)
+	assert.Len(t, ns, 0)
+	assert.EqualValues(t, 5, dao.GetNotificationLastSeq())
+}
+
+func TestModelDB_NotificationWithoutConsumer(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	size := params.NotificationHistorySize
+	params.NotificationHistorySize = 10
+	defer func() {
+		params.NotificationHistorySize = size
+	}()
+	total := params.NotificationHistorySize + 3
+	for i := uint64(1); i <= total; i++ {
+		err := dao.NewNotification(&models.Notification{
+			Seq:  i,
+			Type: "notice",
+			Data: []byte(`"test"`),
+		})
+		assert.Empty(t, err)
+	}
+	// only the latest ones are kept when nobody consumes them
+	assert.EqualValues(t, total, dao.GetNotificationLastSeq())
+	assert.EqualValues(t, 3, dao.GetNotificationAckedSeq())
+	ns, err := dao.GetNotificationsAfter(0, 100)
+	assert.Empty(t, err)
+	assert.Len(t, ns, 10)
+	assert.EqualValues(t, 4, ns[0].Seq)
+}
+
+func TestRemovableNotificationSeq(t *testing.T) {
+	assert.EqualValues(t, 0, models.RemovableNotificationSeq(nil, 10))
+	assert.EqualValues(t, 10, models.RemovableNotificationSeq(nil, params.NotificationHistorySize+10))
+	cs := []*models.NotificationConsumer{{Name: "a", Cursor: 3}, {Name: "b", Cursor: 100}}
+	assert.EqualValues(t, 3, models.RemovableNotificationSeq(cs, 10))
+	assert.EqualValues(t, 10, models.RemovableNotificationSeq(cs[1:], 10))
+	// a consumer never acknowledging doesn't keep the outbox growing forever
+	assert.EqualValues(t, 5, models.RemovableNotificationSeq(cs, params.MaxNotificationOutboxSize+5))
+}
@@ -0,0 +1,31 @@
+package daotest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/codefortest"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModelDB_NodePublicKey(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	key, addr := utils.MakePrivateKeyAddress()
+	_, err := dao.GetNodePublicKey(addr)
+	assert.NotEmpty(t, err)
+	pk := &models.NodePublicKey{
+		Address:    addr,
+		PublicKey:  crypto.FromECDSAPub(&key.PublicKey),
+		UpdateTime: time.Now().Unix(),
+	}
+	err = dao.SaveNodePublicKey(pk)
+	assert.Empty(t, err)
+	pk2, err := dao.GetNodePublicKey(addr)
+	assert.Empty(t, err)
+	assert.EqualValues(t, pk.PublicKey, pk2.PublicKey)
+	assert.EqualValues(t, addr, pk2.Address)
+}
@@ -0,0 +1,39 @@
+package daotest
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/codefortest"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModelDB_TokenMetadata(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	m := &models.TokenMetadata{
+		TokenAddress: utils.NewRandomAddress(),
+		Symbol:       "SMT",
+		Name:         "SmartMesh Token",
+		Decimals:     18,
+	}
+	_, err := dao.GetTokenMetadata(m.TokenAddress)
+	assert.NotEmpty(t, err)
+	err = dao.SaveTokenMetadata(m)
+	assert.Empty(t, err)
+	m2, err := dao.GetTokenMetadata(m.TokenAddress)
+	assert.Empty(t, err)
+	assert.EqualValues(t, "SMT", m2.Symbol)
+	assert.EqualValues(t, 18, m2.Decimals)
+	assert.EqualValues(t, "1.25", m2.FormatAmount(big.NewInt(125e16)))
+
+	m2.Decimals = 6
+	err = dao.SaveTokenMetadata(m2)
+	assert.Empty(t, err)
+	ms, err := dao.GetAllTokenMetadata()
+	assert.Empty(t, err)
+	assert.EqualValues(t, 1, len(ms))
+	assert.EqualValues(t, 6, ms[0].Decimals)
+}
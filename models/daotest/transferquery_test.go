@@ -0,0 +1,192 @@
+package daotest
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/codefortest"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModelDB_QueryTransfers(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	token1 := utils.NewRandomAddress()
+	token2 := utils.NewRandomAddress()
+	p1 := utils.NewRandomAddress()
+	p2 := utils.NewRandomAddress()
+	channel := utils.NewRandomHash()
+	for i := 1; i <= 10; i++ {
+		token, partner, data := token1, p1, "coffee"
+		if i%2 == 0 {
+			token, data = token2, "tea"
+		}
+		if i > 6 {
+			partner = p2
+		}
+		st := dao.NewSentTransfer(int64(i), channel, 1, token, partner, uint64(i), big.NewInt(int64(i*10)), utils.EmptyHash, data)
+		assert.NotNil(t, st)
+		rt := dao.NewReceivedTransfer(int64(i), channel, 1, token, partner, uint64(i), big.NewInt(int64(i*10)), utils.EmptyHash, data)
+		assert.NotNil(t, rt)
+	}
+
+	// no filter
+	q := models.NewTransferQuery()
+	sts, err := dao.QuerySentTransfers(q)
+	assert.Empty(t, err)
+	assert.Len(t, sts, 10)
+	q.Offset = 8
+	q.Limit = 5
+	sts, err = dao.QuerySentTransfers(q)
+	assert.Empty(t, err)
+	assert.Len(t, sts, 2)
+	q.Offset = 1
+	q.Limit = 3
+	q.Desc = true
+	sts, err = dao.QuerySentTransfers(q)
+	assert.Empty(t, err)
+	if assert.Len(t, sts, 3) {
+		assert.True(t, sts[0].TimeStamp >= sts[2].TimeStamp)
+	}
+
+	// filters
+	q = models.NewTransferQuery()
+	q.TokenAddress = token1
+	sts, err = dao.QuerySentTransfers(q)
+	assert.Empty(t, err)
+	assert.Len(t, sts, 5)
+	// paged in the order of time
+	q.Offset = 1
+	q.Limit = 3
+	sts, err = dao.QuerySentTransfers(q)
+	assert.Empty(t, err)
+	assert.Len(t, sts, 3)
+	q.Offset = 4
+	sts, err = dao.QuerySentTransfers(q)
+	assert.Empty(t, err)
+	assert.Len(t, sts, 1)
+	q.Offset = 0
+	q.Limit = 2
+	q.Desc = true
+	rts, err := dao.QueryReceivedTransfers(q)
+	assert.Empty(t, err)
+	if assert.Len(t, rts, 2) {
+		assert.True(t, rts[0].TimeStamp >= rts[1].TimeStamp)
+		assert.EqualValues(t, token1, rts[1].TokenAddress)
+	}
+	q = models.NewTransferQuery()
+	q.Partner = p2
+	q.Data = "ea"
+	rts, err = dao.QueryReceivedTransfers(q)
+	assert.Empty(t, err)
+	if assert.Len(t, rts, 2) {
+		for _, rt := range rts {
+			assert.EqualValues(t, p2, rt.FromAddress)
+			assert.EqualValues(t, "tea", rt.Data)
+		}
+	}
+	q = models.NewTransferQuery()
+	q.MinAmount = big.NewInt(30)
+	q.MaxAmount = big.NewInt(70)
+	q.FromBlock = 4
+	rts, err = dao.QueryReceivedTransfers(q)
+	assert.Empty(t, err)
+	assert.Len(t, rts, 4)
+
+	// time range
+	q = models.NewTransferQuery()
+	q.FromTime = time.Now().Add(-time.Minute)
+	q.ToTime = time.Now().Add(time.Minute)
+	sts, err = dao.QuerySentTransfers(q)
+	assert.Empty(t, err)
+	assert.Len(t, sts, 10)
+	q.FromTime = time.Now().Add(time.Minute)
+	q.ToTime = time.Time{}
+	sts, err = dao.QuerySentTransfers(q)
+	assert.Empty(t, err)
+	assert.Len(t, sts, 0)
+
+	// sort by amount
+	q = models.NewTransferQuery()
+	q.TokenAddress = token2
+	q.SortBy = models.TransferSortByAmount
+	q.Desc = true
+	q.Offset = 1
+	q.Limit = 2
+	sts, err = dao.QuerySentTransfers(q)
+	assert.Empty(t, err)
+	if assert.Len(t, sts, 2) {
+		assert.EqualValues(t, 80, sts[0].Amount.Int64())
+		assert.EqualValues(t, 60, sts[1].Amount.Int64())
+	}
+}
+
+func TestModelDB_IterateTransfers(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	token1 := utils.NewRandomAddress()
+	token2 := utils.NewRandomAddress()
+	channel := utils.NewRandomHash()
+	lockSecretHash := utils.NewRandomHash()
+	for i := 1; i <= 5; i++ {
+		token := token1
+		if i > 3 {
+			token = token2
+		}
+		dao.NewSentTransfer(int64(i), channel, 1, token, utils.NewRandomAddress(), uint64(i), big.NewInt(int64(i)), lockSecretHash, "")
+		dao.NewReceivedTransfer(int64(i), channel, 1, token, utils.NewRandomAddress(), uint64(i), big.NewInt(int64(i)), lockSecretHash, "")
+		err := dao.SaveFeeChargeRecord(&models.FeeChargeRecord{
+			TokenAddress:   token,
+			TransferAmount: big.NewInt(100),
+			Fee:            big.NewInt(1),
+			BlockNumber:    int64(i),
+		})
+		assert.Empty(t, err)
+	}
+
+	q := models.NewTransferQuery()
+	n := 0
+	err := dao.IterateSentTransfers(q, func(st *models.SentTransfer) error {
+		assert.EqualValues(t, lockSecretHash, st.LockSecretHash)
+		n++
+		return nil
+	})
+	assert.Empty(t, err)
+	assert.EqualValues(t, 5, n)
+
+	q.TokenAddress = token1
+	n = 0
+	err = dao.IterateReceivedTransfers(q, func(rt *models.ReceivedTransfer) error {
+		assert.EqualValues(t, token1, rt.TokenAddress)
+		n++
+		return nil
+	})
+	assert.Empty(t, err)
+	assert.EqualValues(t, 3, n)
+
+	q = models.NewTransferQuery()
+	q.FromBlock = 2
+	q.ToBlock = 4
+	q.FromTime = time.Now().Add(-time.Minute)
+	n = 0
+	err = dao.IterateFeeChargeRecords(q, func(r *models.FeeChargeRecord) error {
+		assert.EqualValues(t, 1, r.Fee.Int64())
+		n++
+		return nil
+	})
+	assert.Empty(t, err)
+	assert.EqualValues(t, 3, n)
+
+	// error of fn stops iterating
+	n = 0
+	err = dao.IterateFeeChargeRecords(models.NewTransferQuery(), func(r *models.FeeChargeRecord) error {
+		n++
+		return errors.New("stop")
+	})
+	assert.NotEmpty(t, err)
+	assert.EqualValues(t, 1, n)
+}
@@ -1,6 +1,7 @@
 package daotest
 
 import (
+	"math/big"
 	"testing"
 
 	"fmt"
@@ -74,3 +75,36 @@ func TestModelDb_BatchTransferStatus(t *testing.T) {
 	//wg.Wait()
 	//fmt.Println("update 100 times async use ", time.Since(start))
 }
+
+func TestModelDB_TransferStatusParts(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	lockSecretHash := utils.NewRandomHash()
+	tokenAddress := utils.NewRandomAddress()
+	parts := []*models.TransferPartStatus{
+		{
+			ChannelIdentifier: utils.NewRandomHash(),
+			Partner:           utils.NewRandomAddress(),
+			Amount:            big.NewInt(30),
+			Fee:               big.NewInt(1),
+			Status:            "pending",
+		},
+	}
+	//没有交易状态的时候忽略
+	dao.UpdateTransferStatusParts(tokenAddress, lockSecretHash, parts)
+	_, err := dao.GetTransferStatus(tokenAddress, lockSecretHash)
+	assert.NotNil(t, err)
+
+	dao.NewTransferStatus(tokenAddress, lockSecretHash)
+	dao.UpdateTransferStatusParts(tokenAddress, lockSecretHash, parts)
+	dao.UpdateTransferStatus(tokenAddress, lockSecretHash, models.TransferStatusCanCancel, "1111")
+	ts, err := dao.GetTransferStatus(tokenAddress, lockSecretHash)
+	assert.Empty(t, err)
+	assert.EqualValues(t, models.TransferStatusCanCancel, ts.Status)
+	if assert.Len(t, ts.Parts, 1) {
+		assert.EqualValues(t, parts[0].ChannelIdentifier, ts.Parts[0].ChannelIdentifier)
+		assert.EqualValues(t, parts[0].Partner, ts.Parts[0].Partner)
+		assert.EqualValues(t, 0, parts[0].Amount.Cmp(ts.Parts[0].Amount))
+		assert.EqualValues(t, "pending", ts.Parts[0].Status)
+	}
+}
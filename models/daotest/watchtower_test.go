@@ -0,0 +1,70 @@
+package daotest
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/codefortest"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/transfer/mtree"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModelDB_Delegation(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	d := &models.Delegation{
+		ChannelIdentifier: utils.NewRandomHash(),
+		OpenBlockNumber:   3,
+		TokenAddress:      utils.NewRandomAddress(),
+		Delegator:         utils.NewRandomAddress(),
+		PartnerAddress:    utils.NewRandomAddress(),
+		UpdateTransfer: models.DelegationUpdateTransfer{
+			Nonce:          7,
+			TransferAmount: big.NewInt(30),
+			Locksroot:      utils.NewRandomHash(),
+		},
+		Unlocks: []*models.DelegationUnlock{
+			{
+				Lock: &mtree.Lock{
+					Expiration:     100,
+					Amount:         big.NewInt(10),
+					LockSecretHash: utils.NewRandomHash(),
+				},
+				Secret: utils.NewRandomHash(),
+			},
+		},
+		SettleTimeout: 100,
+		Status:        models.DelegationWatching,
+	}
+	_, err := dao.GetDelegation(d.ChannelIdentifier)
+	assert.NotEmpty(t, err)
+	err = dao.SaveDelegation(d)
+	assert.Empty(t, err)
+	d2, err := dao.GetDelegation(d.ChannelIdentifier)
+	assert.Empty(t, err)
+	assert.EqualValues(t, d.Delegator, d2.Delegator)
+	assert.EqualValues(t, 7, d2.UpdateTransfer.Nonce)
+	assert.EqualValues(t, 1, len(d2.Unlocks))
+	assert.EqualValues(t, d.Unlocks[0].Lock.LockSecretHash, d2.Unlocks[0].Lock.LockSecretHash)
+
+	d2.Status = models.DelegationClosed
+	d2.ClosedBlock = 50
+	err = dao.SaveDelegation(d2)
+	assert.Empty(t, err)
+	assert.EqualValues(t, 150, d2.SettleBlock())
+	assert.EqualValues(t, 100, d2.UpdateStartBlock())
+	ds, err := dao.GetAllDelegations()
+	assert.Empty(t, err)
+	assert.EqualValues(t, 1, len(ds))
+	assert.EqualValues(t, models.DelegationClosed, ds[0].Status)
+
+	err = dao.RemoveDelegation(d.ChannelIdentifier)
+	assert.Empty(t, err)
+	err = dao.RemoveDelegation(d.ChannelIdentifier)
+	assert.NotEmpty(t, err)
+	ds, err = dao.GetAllDelegations()
+	assert.Empty(t, err)
+	assert.EqualValues(t, 0, len(ds))
+}
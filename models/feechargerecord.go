@@ -21,7 +21,8 @@ type FeeChargerRecordSerialization struct {
 	InChannel      []byte
 	OutChannel     []byte
 	Fee            *big.Int
-	Timestamp      int64
+	Timestamp      int64 `storm:"index"`
+	BlockNumber    int64
 }
 
 // ToFeeChargeRecord :
@@ -37,6 +38,7 @@ func (rs *FeeChargerRecordSerialization) ToFeeChargeRecord() *FeeChargeRecord {
 		OutChannel:     common.BytesToHash(rs.OutChannel),
 		Fee:            rs.Fee,
 		Timestamp:      rs.Timestamp,
+		BlockNumber:    rs.BlockNumber,
 	}
 }
 
@@ -52,7 +54,8 @@ type FeeChargeRecord struct {
 	InChannel      common.Hash    `json:"in_channel"`  // 我收款的channelID
 	OutChannel     common.Hash    `json:"out_channel"` // 我付款的channelID
 	Fee            *big.Int       `json:"fee"`
-	Timestamp      int64          `json:"timestamp"` // 时间戳,time.Unix()
+	Timestamp      int64          `json:"timestamp"`    // 时间戳,time.Unix()
+	BlockNumber    int64          `json:"block_number"` // 收取手续费时的块高度
 }
 
 // ToString :
@@ -77,6 +80,7 @@ func (r *FeeChargeRecord) ToSerialized() *FeeChargerRecordSerialization {
 		OutChannel:     r.OutChannel[:],
 		Fee:            r.Fee,
 		Timestamp:      r.Timestamp,
+		BlockNumber:    r.BlockNumber,
 	}
 }
 
@@ -0,0 +1,103 @@
+package gkvdb
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// NewAPIToken : save a new api token, error if id exists
+func (dao *GkvDB) NewAPIToken(t *models.APIToken) error {
+	dao.lock.Lock()
+	defer dao.lock.Unlock()
+	var old models.APIToken
+	err := dao.getKeyValueToBucket(models.BucketAPIToken, t.ID, &old)
+	if err == nil {
+		return fmt.Errorf("api token %s already exists", t.ID)
+	}
+	err = dao.saveKeyValueToBucket(models.BucketAPIToken, t.ID, t)
+	if err != nil {
+		err = fmt.Errorf("NewAPIToken err %s", err)
+	}
+	return err
+}
+
+// GetAPIToken :
+func (dao *GkvDB) GetAPIToken(id string) (*models.APIToken, error) {
+	var t models.APIToken
+	err := dao.getKeyValueToBucket(models.BucketAPIToken, id, &t)
+	if err == ErrorNotFound {
+		err = fmt.Errorf("api token %s not found", id)
+	}
+	return &t, err
+}
+
+// GetAllAPITokens :
+func (dao *GkvDB) GetAllAPITokens() (ts []*models.APIToken, err error) {
+	buf, err := dao.getAllValuesOfBucket(models.BucketAPIToken)
+	for _, v := range buf {
+		var t models.APIToken
+		gobDecode(v, &t)
+		ts = append(ts, &t)
+	}
+	return
+}
+
+// RemoveAPIToken :
+func (dao *GkvDB) RemoveAPIToken(id string) error {
+	var t models.APIToken
+	err := dao.getKeyValueToBucket(models.BucketAPIToken, id, &t)
+	if err == ErrorNotFound {
+		return fmt.Errorf("api token %s not found", id)
+	}
+	return dao.removeKeyValueFromBucket(models.BucketAPIToken, id)
+}
+
+// HasAPIToken : is there any api token?
+func (dao *GkvDB) HasAPIToken() bool {
+	// removed keys are still listed by table with empty value
+	buf, err := dao.getAllValuesOfBucket(models.BucketAPIToken)
+	if err != nil {
+		log.Error(fmt.Sprintf("HasAPIToken err %s", err))
+		return false
+	}
+	return len(buf) > 0
+}
+
+// SpendAPIToken : check spending cap of api token and record amount spent
+func (dao *GkvDB) SpendAPIToken(id string, token common.Address, amount *big.Int) error {
+	return dao.updateAPIToken(id, func(t *models.APIToken) error {
+		return t.Spend(token, amount)
+	})
+}
+
+// RefundAPIToken : give back amount spent by transfers not sent or failed
+func (dao *GkvDB) RefundAPIToken(id string, token common.Address, amount *big.Int) error {
+	return dao.updateAPIToken(id, func(t *models.APIToken) error {
+		t.Refund(token, amount)
+		return nil
+	})
+}
+
+// updateAPIToken change api token by fn, nothing changed if fn returns error
+func (dao *GkvDB) updateAPIToken(id string, fn func(t *models.APIToken) error) error {
+	dao.lock.Lock()
+	defer dao.lock.Unlock()
+	var t models.APIToken
+	err := dao.getKeyValueToBucket(models.BucketAPIToken, id, &t)
+	if err != nil {
+		return fmt.Errorf("api token %s not found", id)
+	}
+	err = fn(&t)
+	if err != nil {
+		return err
+	}
+	err = dao.saveKeyValueToBucket(models.BucketAPIToken, id, &t)
+	if err != nil {
+		err = fmt.Errorf("updateAPIToken err %s", err)
+	}
+	return err
+}
@@ -0,0 +1,37 @@
+package gkvdb
+
+import (
+	"fmt"
+
+	"github.com/SmartMeshFoundation/Photon/models"
+)
+
+// SaveBatchTransfer : create or update
+func (dao *GkvDB) SaveBatchTransfer(b *models.BatchTransfer) error {
+	err := dao.saveKeyValueToBucket(models.BucketBatchTransfer, b.ID, b)
+	if err != nil {
+		err = fmt.Errorf("SaveBatchTransfer err %s", err)
+	}
+	return err
+}
+
+// GetBatchTransfer :
+func (dao *GkvDB) GetBatchTransfer(id string) (*models.BatchTransfer, error) {
+	var b models.BatchTransfer
+	err := dao.getKeyValueToBucket(models.BucketBatchTransfer, id, &b)
+	if err == ErrorNotFound {
+		err = fmt.Errorf("batch transfer %s not found", id)
+	}
+	return &b, err
+}
+
+// GetAllBatchTransfers :
+func (dao *GkvDB) GetAllBatchTransfers() (bs []*models.BatchTransfer, err error) {
+	buf, err := dao.getAllValuesOfBucket(models.BucketBatchTransfer)
+	for _, v := range buf {
+		var b models.BatchTransfer
+		gobDecode(v, &b)
+		bs = append(bs, &b)
+	}
+	return
+}
@@ -37,6 +37,13 @@ func (dao *GkvDB) RegisterChannelSettleCallback(f cb.ChannelCb) {
 	dao.mlock.Unlock()
 }
 
+//RegisterChannelUpdateCallback notify when channel saved, balance proof or locks may be changed
+func (dao *GkvDB) RegisterChannelUpdateCallback(f cb.ChannelCb) {
+	dao.mlock.Lock()
+	dao.channelUpdateCallbacks[&f] = true
+	dao.mlock.Unlock()
+}
+
 /*
 do we need remove a callback?
 */
@@ -29,8 +29,10 @@ func (dao *GkvDB) UpdateChannelNoTx(c *channeltype.Serialization) error {
 	err := dao.saveKeyValueToBucket(models.BucketChannelSerialization, c.GetKey(), c)
 	if err != nil {
 		log.Error(fmt.Sprintf("UpdateChannelNoTx err:%s", err))
+		return err
 	}
-	return err
+	dao.handleChannelCallback(dao.channelUpdateCallbacks, c)
+	return nil
 }
 
 //UpdateChannelAndSaveAck update channel and save ack, must atomic
@@ -83,8 +85,10 @@ func (dao *GkvDB) UpdateChannel(c *channeltype.Serialization, tx models.TX) erro
 	err := tx.Set(models.BucketChannelSerialization, c.GetKey(), c)
 	if err != nil {
 		log.Error(fmt.Sprintf("UpdateChannel err=%s", err))
+		return err
 	}
-	return err
+	dao.handleChannelCallback(dao.channelUpdateCallbacks, c)
+	return nil
 }
 
 //UpdateChannelState update channel state ,close settle
@@ -0,0 +1,49 @@
+package gkvdb
+
+import (
+	"fmt"
+
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// SaveTokenNetworkConnection : create or update
+func (dao *GkvDB) SaveTokenNetworkConnection(c *models.TokenNetworkConnection) error {
+	c.Key = c.TokenAddress.String()
+	err := dao.saveKeyValueToBucket(models.BucketTokenNetworkConnection, c.Key, c)
+	if err != nil {
+		err = fmt.Errorf("SaveTokenNetworkConnection err %s", err)
+	}
+	return err
+}
+
+// GetTokenNetworkConnection :
+func (dao *GkvDB) GetTokenNetworkConnection(token common.Address) (*models.TokenNetworkConnection, error) {
+	var c models.TokenNetworkConnection
+	err := dao.getKeyValueToBucket(models.BucketTokenNetworkConnection, token.String(), &c)
+	if err == ErrorNotFound {
+		err = fmt.Errorf("token network %s not joined", token.String())
+	}
+	return &c, err
+}
+
+// GetAllTokenNetworkConnections :
+func (dao *GkvDB) GetAllTokenNetworkConnections() (cs []*models.TokenNetworkConnection, err error) {
+	buf, err := dao.getAllValuesOfBucket(models.BucketTokenNetworkConnection)
+	for _, v := range buf {
+		var c models.TokenNetworkConnection
+		gobDecode(v, &c)
+		cs = append(cs, &c)
+	}
+	return
+}
+
+// RemoveTokenNetworkConnection :
+func (dao *GkvDB) RemoveTokenNetworkConnection(token common.Address) error {
+	var c models.TokenNetworkConnection
+	err := dao.getKeyValueToBucket(models.BucketTokenNetworkConnection, token.String(), &c)
+	if err == ErrorNotFound {
+		return fmt.Errorf("token network %s not joined", token.String())
+	}
+	return dao.removeKeyValueFromBucket(models.BucketTokenNetworkConnection, token.String())
+}
@@ -0,0 +1,179 @@
+package gkvdb
+
+import (
+	"fmt"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+SaveContractEvents : save events received from chain,
+events already saved are ignored, ID of new events are assigned here.
+Transaction.GetFrom cannot see data in db once the table is changed in the transaction,
+so changes of this batch are kept in maps.
+*/
+func (dao *GkvDB) SaveContractEvents(es []*models.ContractEvent) error {
+	lastID := dao.GetContractEventLastID()
+	keys := make(map[string]bool)
+	channels := make(map[common.Hash]*models.ContractEventChannel)
+	indexes := make(map[common.Hash][]uint64)
+	tx := dao.db.Begin()
+	for _, e := range es {
+		var id uint64
+		if keys[e.Key] || dao.getKeyValueToBucket(models.BucketContractEventKey, e.Key, &id) == nil {
+			continue
+		}
+		keys[e.Key] = true
+		if e.ChannelIdentifier != utils.EmptyHash {
+			if c := e.ChannelInfo(); c != nil {
+				channels[e.ChannelIdentifier] = c
+			} else {
+				c = channels[e.ChannelIdentifier]
+				if c == nil {
+					c = &models.ContractEventChannel{}
+					if dao.getKeyValueToBucket(models.BucketContractEventChannel, e.ChannelIdentifier, c) != nil {
+						c = nil
+					}
+				}
+				if c != nil {
+					e.FillChannelInfo(c)
+				}
+			}
+			ids, ok := indexes[e.ChannelIdentifier]
+			if !ok {
+				ids = dao.getContractEventIndex(e.ChannelIdentifier)
+			}
+			indexes[e.ChannelIdentifier] = append(ids, lastID+1)
+		}
+		lastID++
+		e.ID = lastID
+		err := tx.SetTo(gobEncode(e.ID), gobEncode(e), models.BucketContractEvent)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("SaveContractEvents err %s", err)
+		}
+		err = tx.SetTo(gobEncode(e.Key), gobEncode(e.ID), models.BucketContractEventKey)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("SaveContractEvents err %s", err)
+		}
+	}
+	for ch, c := range channels {
+		err := tx.SetTo(gobEncode(ch), gobEncode(c), models.BucketContractEventChannel)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("SaveContractEvents err %s", err)
+		}
+	}
+	for ch, ids := range indexes {
+		err := tx.SetTo(gobEncode(ch), gobEncode(ids), models.BucketContractEventIndex)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("SaveContractEvents err %s", err)
+		}
+	}
+	err := tx.SetTo(gobEncode(models.KeyContractEventLastID), gobEncode(lastID), models.BucketContractEventSeq)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("SaveContractEvents err %s", err)
+	}
+	return tx.Commit(true)
+}
+
+// getContractEventIndex ID of all events about this channel
+func (dao *GkvDB) getContractEventIndex(channel common.Hash) (ids []uint64) {
+	err := dao.getKeyValueToBucket(models.BucketContractEventIndex, channel, &ids)
+	if err != nil && err != ErrorNotFound {
+		log.Error(fmt.Sprintf("getContractEventIndex err %s", err))
+	}
+	return
+}
+
+/*
+GetContractEvents : events match f, order by ID.
+query by index of channel if channel is specified, otherwise get events after cursor one by one,
+ID is continuous and events are never removed.
+*/
+func (dao *GkvDB) GetContractEvents(f *models.ContractEventFilter) (es []*models.ContractEvent, err error) {
+	var ids []uint64
+	if f.ChannelIdentifier != utils.EmptyHash {
+		for _, id := range dao.getContractEventIndex(f.ChannelIdentifier) {
+			if id > f.Cursor {
+				ids = append(ids, id)
+			}
+		}
+	} else {
+		last := dao.GetContractEventLastID()
+		for id := f.Cursor + 1; id <= last; id++ {
+			ids = append(ids, id)
+		}
+	}
+	for _, id := range ids {
+		e := &models.ContractEvent{}
+		err = dao.getKeyValueToBucket(models.BucketContractEvent, id, e)
+		if err == ErrorNotFound {
+			err = nil
+			continue
+		}
+		if err != nil {
+			return
+		}
+		dao.fillContractEventChannel(e)
+		if f.Match(e) {
+			es = append(es, e)
+			if f.Limit > 0 && len(es) >= f.Limit {
+				return
+			}
+		}
+	}
+	return
+}
+
+// GetContractEventLastID : ID of the latest contract event saved
+func (dao *GkvDB) GetContractEventLastID() uint64 {
+	var id uint64
+	err := dao.getKeyValueToBucket(models.BucketContractEventSeq, models.KeyContractEventLastID, &id)
+	if err != nil && err != ErrorNotFound {
+		log.Error(fmt.Sprintf("GetContractEventLastID err %s", err))
+	}
+	return id
+}
+
+/*
+fillContractEventChannel fill token and participants of the event saved before ChannelOpenedAndDeposit,
+it happens when ChannelOpenedAndDeposit is fetched by backfill later.
+*/
+func (dao *GkvDB) fillContractEventChannel(e *models.ContractEvent) {
+	if e.ChannelIdentifier == utils.EmptyHash || e.ChannelInfo() != nil {
+		return
+	}
+	c := &models.ContractEventChannel{}
+	if dao.getKeyValueToBucket(models.BucketContractEventChannel, e.ChannelIdentifier, c) == nil {
+		e.FillChannelInfo(c)
+	}
+}
+
+// GetContractEventBackfill : progress of fetching events before cache starts, nil if never started
+func (dao *GkvDB) GetContractEventBackfill() *models.ContractEventBackfill {
+	b := &models.ContractEventBackfill{}
+	err := dao.getKeyValueToBucket(models.BucketContractEventSeq, models.KeyContractEventBackfill, b)
+	if err != nil {
+		if err != ErrorNotFound {
+			log.Error(fmt.Sprintf("GetContractEventBackfill err %s", err))
+		}
+		return nil
+	}
+	return b
+}
+
+// SaveContractEventBackfill : save progress of fetching events before cache starts
+func (dao *GkvDB) SaveContractEventBackfill(b *models.ContractEventBackfill) error {
+	err := dao.saveKeyValueToBucket(models.BucketContractEventSeq, models.KeyContractEventBackfill, b)
+	if err != nil {
+		return fmt.Errorf("SaveContractEventBackfill err %s", err)
+	}
+	return nil
+}
@@ -29,6 +29,7 @@ type GkvDB struct {
 	channelDepositCallbacks map[*cb.ChannelCb]bool
 	channelStateCallbacks   map[*cb.ChannelCb]bool
 	channelSettledCallbacks map[*cb.ChannelCb]bool
+	channelUpdateCallbacks  map[*cb.ChannelCb]bool
 	mlock                   sync.Mutex
 	Name                    string
 }
@@ -40,6 +41,7 @@ func newGkvDB() (db *GkvDB) {
 		channelDepositCallbacks: make(map[*cb.ChannelCb]bool),
 		channelStateCallbacks:   make(map[*cb.ChannelCb]bool),
 		channelSettledCallbacks: make(map[*cb.ChannelCb]bool),
+		channelUpdateCallbacks:  make(map[*cb.ChannelCb]bool),
 	}
 }
 func gobEncode(d interface{}) []byte {
@@ -85,6 +87,24 @@ func (dao *GkvDB) getKeyValueToBucket(bucket string, key, to interface{}) error
 	return nil
 }
 
+/*
+getAllValuesOfBucket returns all values in bucket,
+Table.Values may return items removed but not yet synced to disk, so check every key again.
+*/
+func (dao *GkvDB) getAllValuesOfBucket(bucket string) (values [][]byte, err error) {
+	tb, err := dao.db.Table(bucket)
+	if err != nil {
+		return
+	}
+	for k := range tb.Items(-1) {
+		v := tb.Get([]byte(k))
+		if len(v) > 0 {
+			values = append(values, v)
+		}
+	}
+	return
+}
+
 func (dao *GkvDB) removeKeyValueFromBucket(bucket string, key interface{}) error {
 	tb, err := dao.db.Table(bucket)
 	if err != nil {
@@ -138,6 +158,11 @@ func OpenDb(dbPath string) (dao *GkvDB, err error) {
 		if closeFlag != true {
 			log.Error("database not closed  last..., try to restore?")
 		}
+		// 索引建立失败只影响交易记录的查询
+		if err = dao.buildTransferIndex(); err != nil {
+			log.Error(fmt.Sprintf("buildTransferIndex err %s", err))
+			err = nil
+		}
 	}
 	return
 }
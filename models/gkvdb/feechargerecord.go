@@ -20,7 +20,7 @@ func (dao *GkvDB) SaveFeeChargeRecord(r *models.FeeChargeRecord) (err error) {
 	if r.Timestamp <= 0 {
 		r.Timestamp = time.Now().Unix()
 	}
-	err = dao.saveKeyValueToBucket(models.BucketFeeChargeRecord, r.Key, r)
+	err = dao.saveFeeChargeRecord(r)
 	if err != nil {
 		err = fmt.Errorf("SaveFeeChargeRecord err %s", err)
 		return
@@ -29,6 +29,22 @@ func (dao *GkvDB) SaveFeeChargeRecord(r *models.FeeChargeRecord) (err error) {
 	return
 }
 
+// saveFeeChargeRecord save record and its index in one tx
+func (dao *GkvDB) saveFeeChargeRecord(r *models.FeeChargeRecord) error {
+	dao.lock.Lock()
+	defer dao.lock.Unlock()
+	tx := dao.db.Begin()
+	err := tx.SetTo(gobEncode(r.Key), gobEncode(r), models.BucketFeeChargeRecord)
+	if err == nil {
+		err = dao.feeChargeRecordIndex().add(tx, r.Key.String(), r.TokenAddress, r.TransferFrom)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit(true)
+}
+
 // GetAllFeeChargeRecord :
 func (dao *GkvDB) GetAllFeeChargeRecord() (records []*models.FeeChargeRecord, err error) {
 	var tb *gkvdb.Table
@@ -62,3 +78,37 @@ func (dao *GkvDB) GetFeeChargeRecordByLockSecretHash(lockSecretHash common.Hash)
 	}
 	return
 }
+
+func (dao *GkvDB) feeChargeRecordOfSeq(seq uint64) (*models.FeeChargeRecord, error) {
+	key, err := dao.feeChargeRecordIndex().transferKey(seq)
+	if err != nil {
+		return nil, err
+	}
+	var r models.FeeChargeRecord
+	err = dao.getKeyValueToBucket(models.BucketFeeChargeRecord, common.HexToHash(key), &r)
+	return &r, err
+}
+
+/*
+IterateFeeChargeRecords calls fn with records match q in the order of time,
+records are read one by one, SortBy, Offset and Limit of q are ignored.
+*/
+func (dao *GkvDB) IterateFeeChargeRecords(q *models.TransferQuery, fn func(r *models.FeeChargeRecord) error) error {
+	timeOf := func(seq uint64) (time.Time, error) {
+		r, err := dao.feeChargeRecordOfSeq(seq)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(r.Timestamp, 0), nil
+	}
+	return dao.feeChargeRecordIndex().each(q, timeOf, func(seq uint64) error {
+		r, err := dao.feeChargeRecordOfSeq(seq)
+		if err != nil {
+			return err
+		}
+		if !q.MatchFeeChargeRecord(r) {
+			return nil
+		}
+		return fn(r)
+	})
+}
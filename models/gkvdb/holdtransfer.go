@@ -0,0 +1,42 @@
+package gkvdb
+
+import (
+	"fmt"
+
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// AddHoldLockSecretHash :
+func (dao *GkvDB) AddHoldLockSecretHash(lockSecretHash common.Hash) error {
+	h := &models.HoldLockSecretHash{
+		Key:            lockSecretHash.String(),
+		LockSecretHash: lockSecretHash,
+	}
+	err := dao.saveKeyValueToBucket(models.BucketHoldLockSecretHash, h.Key, h)
+	if err != nil {
+		err = fmt.Errorf("AddHoldLockSecretHash err %s", err)
+	}
+	return err
+}
+
+// RemoveHoldLockSecretHash : nothing to do if it's not held
+func (dao *GkvDB) RemoveHoldLockSecretHash(lockSecretHash common.Hash) error {
+	var h models.HoldLockSecretHash
+	err := dao.getKeyValueToBucket(models.BucketHoldLockSecretHash, lockSecretHash.String(), &h)
+	if err == ErrorNotFound {
+		return nil
+	}
+	return dao.removeKeyValueFromBucket(models.BucketHoldLockSecretHash, lockSecretHash.String())
+}
+
+// GetHoldLockSecretHashList :
+func (dao *GkvDB) GetHoldLockSecretHashList() (hs []common.Hash, err error) {
+	buf, err := dao.getAllValuesOfBucket(models.BucketHoldLockSecretHash)
+	for _, v := range buf {
+		var h models.HoldLockSecretHash
+		gobDecode(v, &h)
+		hs = append(hs, h.LockSecretHash)
+	}
+	return
+}
@@ -0,0 +1,66 @@
+package gkvdb
+
+import (
+	"fmt"
+
+	"github.com/SmartMeshFoundation/Photon/models"
+)
+
+// NewIdempotencyRecord : save r if its key not exists
+func (dao *GkvDB) NewIdempotencyRecord(r *models.IdempotencyRecord) error {
+	dao.lock.Lock()
+	defer dao.lock.Unlock()
+	var old models.IdempotencyRecord
+	err := dao.getKeyValueToBucket(models.BucketIdempotencyRecord, r.Key, &old)
+	if err == nil {
+		return models.ErrIdempotencyKeyExists
+	}
+	err = dao.saveKeyValueToBucket(models.BucketIdempotencyRecord, r.Key, r)
+	if err != nil {
+		err = fmt.Errorf("NewIdempotencyRecord err %s", err)
+	}
+	return err
+}
+
+// GetIdempotencyRecord :
+func (dao *GkvDB) GetIdempotencyRecord(key string) (*models.IdempotencyRecord, error) {
+	var r models.IdempotencyRecord
+	err := dao.getKeyValueToBucket(models.BucketIdempotencyRecord, key, &r)
+	if err == ErrorNotFound {
+		err = fmt.Errorf("idempotency key %s not found", key)
+	}
+	return &r, err
+}
+
+// UpdateIdempotencyRecord :
+func (dao *GkvDB) UpdateIdempotencyRecord(r *models.IdempotencyRecord) error {
+	dao.lock.Lock()
+	defer dao.lock.Unlock()
+	err := dao.saveKeyValueToBucket(models.BucketIdempotencyRecord, r.Key, r)
+	if err != nil {
+		err = fmt.Errorf("UpdateIdempotencyRecord err %s", err)
+	}
+	return err
+}
+
+// RemoveIdempotencyRecordsBefore : remove records created before createTime
+func (dao *GkvDB) RemoveIdempotencyRecordsBefore(createTime int64) error {
+	dao.lock.Lock()
+	defer dao.lock.Unlock()
+	buf, err := dao.getAllValuesOfBucket(models.BucketIdempotencyRecord)
+	if err != nil {
+		return err
+	}
+	for _, v := range buf {
+		var r models.IdempotencyRecord
+		gobDecode(v, &r)
+		if r.CreateTime >= createTime {
+			continue
+		}
+		err = dao.removeKeyValueFromBucket(models.BucketIdempotencyRecord, r.Key)
+		if err != nil {
+			return fmt.Errorf("RemoveIdempotencyRecordsBefore err %s", err)
+		}
+	}
+	return nil
+}
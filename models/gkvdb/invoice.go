@@ -0,0 +1,39 @@
+package gkvdb
+
+import (
+	"fmt"
+
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// SaveInvoice : create or update
+func (dao *GkvDB) SaveInvoice(i *models.Invoice) error {
+	i.Key = i.LockSecretHash.String()
+	err := dao.saveKeyValueToBucket(models.BucketInvoice, i.Key, i)
+	if err != nil {
+		err = fmt.Errorf("SaveInvoice err %s", err)
+	}
+	return err
+}
+
+// GetInvoice :
+func (dao *GkvDB) GetInvoice(lockSecretHash common.Hash) (*models.Invoice, error) {
+	var i models.Invoice
+	err := dao.getKeyValueToBucket(models.BucketInvoice, lockSecretHash.String(), &i)
+	if err == ErrorNotFound {
+		err = fmt.Errorf("invoice %s not found", lockSecretHash.String())
+	}
+	return &i, err
+}
+
+// GetInvoiceList :
+func (dao *GkvDB) GetInvoiceList() (is []*models.Invoice, err error) {
+	buf, err := dao.getAllValuesOfBucket(models.BucketInvoice)
+	for _, v := range buf {
+		var i models.Invoice
+		gobDecode(v, &i)
+		is = append(is, &i)
+	}
+	return
+}
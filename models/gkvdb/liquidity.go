@@ -0,0 +1,47 @@
+package gkvdb
+
+import (
+	"fmt"
+
+	"github.com/SmartMeshFoundation/Photon/models"
+)
+
+// SaveLiquidityRule : create or update
+func (dao *GkvDB) SaveLiquidityRule(r *models.LiquidityRule) error {
+	err := dao.saveKeyValueToBucket(models.BucketLiquidityRule, r.Key, r)
+	if err != nil {
+		err = fmt.Errorf("SaveLiquidityRule err %s", err)
+	}
+	return err
+}
+
+// GetLiquidityRule :
+func (dao *GkvDB) GetLiquidityRule(key string) (*models.LiquidityRule, error) {
+	var r models.LiquidityRule
+	err := dao.getKeyValueToBucket(models.BucketLiquidityRule, key, &r)
+	if err == ErrorNotFound {
+		err = fmt.Errorf("liquidity rule %s not found", key)
+	}
+	return &r, err
+}
+
+// GetAllLiquidityRules :
+func (dao *GkvDB) GetAllLiquidityRules() (rs []*models.LiquidityRule, err error) {
+	buf, err := dao.getAllValuesOfBucket(models.BucketLiquidityRule)
+	for _, v := range buf {
+		var r models.LiquidityRule
+		gobDecode(v, &r)
+		rs = append(rs, &r)
+	}
+	return
+}
+
+// RemoveLiquidityRule :
+func (dao *GkvDB) RemoveLiquidityRule(key string) error {
+	var r models.LiquidityRule
+	err := dao.getKeyValueToBucket(models.BucketLiquidityRule, key, &r)
+	if err == ErrorNotFound {
+		return fmt.Errorf("liquidity rule %s not found", key)
+	}
+	return dao.removeKeyValueFromBucket(models.BucketLiquidityRule, key)
+}
@@ -0,0 +1,28 @@
+package gkvdb
+
+import (
+	"fmt"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+)
+
+// SaveMediationLimitPolicy :
+func (dao *GkvDB) SaveMediationLimitPolicy(p *models.MediationLimitPolicy) (err error) {
+	p.Key = models.KeyMediationLimitPolicy
+	return dao.saveKeyValueToBucket(models.BucketMediationLimitPolicy, p.Key, p)
+}
+
+// GetMediationLimitPolicy :
+func (dao *GkvDB) GetMediationLimitPolicy() (p *models.MediationLimitPolicy) {
+	p = &models.MediationLimitPolicy{}
+	err := dao.getKeyValueToBucket(models.BucketMediationLimitPolicy, models.KeyMediationLimitPolicy, p)
+	if err == ErrorNotFound {
+		return models.NewDefaultMediationLimitPolicy()
+	}
+	if err != nil {
+		log.Error(fmt.Sprintf("GetMediationLimitPolicy err %s, use default policy", err))
+		return models.NewDefaultMediationLimitPolicy()
+	}
+	return
+}
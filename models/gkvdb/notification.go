@@ -0,0 +1,156 @@
+package gkvdb
+
+import (
+	"fmt"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+)
+
+// NewNotification : save a notification to outbox, n.Seq must be greater than any saved before
+func (dao *GkvDB) NewNotification(n *models.Notification) error {
+	tx := dao.db.Begin()
+	err := tx.SetTo(gobEncode(n.Seq), gobEncode(n), models.BucketNotification)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("NewNotification err %s", err)
+	}
+	err = tx.SetTo(gobEncode(models.KeyNotificationLastSeq), gobEncode(n.Seq), models.BucketNotificationSeq)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("NewNotification err %s", err)
+	}
+	err = tx.Commit(true)
+	if err != nil {
+		return err
+	}
+	// 没有消费者确认时, 只能在这里删除过旧的通知
+	return dao.removeAckedNotifications()
+}
+
+/*
+GetNotificationsAfter : at most limit notifications not acknowledged whose Seq is greater than seq, order by Seq
+Seq is continuous and notifications are only removed from the beginning,
+so we can get them one by one instead of scanning the whole table.
+*/
+func (dao *GkvDB) GetNotificationsAfter(seq uint64, limit int) (ns []*models.Notification, err error) {
+	last := dao.GetNotificationLastSeq()
+	if acked := dao.GetNotificationAckedSeq(); seq < acked {
+		seq = acked
+	}
+	for i := seq + 1; i <= last && len(ns) < limit; i++ {
+		var n models.Notification
+		err = dao.getKeyValueToBucket(models.BucketNotification, i, &n)
+		if err == ErrorNotFound {
+			err = nil
+			continue
+		}
+		if err != nil {
+			return
+		}
+		ns = append(ns, &n)
+	}
+	return
+}
+
+/*
+AckNotifications : all notifications whose Seq is not greater than seq have been processed by consumer,
+notifications acknowledged by all consumers are removed.
+*/
+func (dao *GkvDB) AckNotifications(consumer string, seq uint64) error {
+	var c models.NotificationConsumer
+	err := dao.getKeyValueToBucket(models.BucketNotificationConsumer, consumer, &c)
+	if err != nil && err != ErrorNotFound {
+		return err
+	}
+	if err == nil && c.Cursor >= seq {
+		return nil
+	}
+	c.Name = consumer
+	c.Cursor = seq
+	err = dao.saveKeyValueToBucket(models.BucketNotificationConsumer, consumer, &c)
+	if err != nil {
+		return fmt.Errorf("AckNotifications err %s", err)
+	}
+	return dao.removeAckedNotifications()
+}
+
+// GetNotificationConsumerCursor : notifications not greater than it have been acknowledged by consumer
+func (dao *GkvDB) GetNotificationConsumerCursor(consumer string) uint64 {
+	var c models.NotificationConsumer
+	err := dao.getKeyValueToBucket(models.BucketNotificationConsumer, consumer, &c)
+	if err != nil {
+		if err != ErrorNotFound {
+			log.Error(fmt.Sprintf("GetNotificationConsumerCursor err %s", err))
+		}
+		return dao.GetNotificationAckedSeq()
+	}
+	return c.Cursor
+}
+
+// RemoveNotificationConsumer : notifications are not kept for this consumer any more
+func (dao *GkvDB) RemoveNotificationConsumer(consumer string) error {
+	var c models.NotificationConsumer
+	err := dao.getKeyValueToBucket(models.BucketNotificationConsumer, consumer, &c)
+	if err != nil {
+		return fmt.Errorf("notification consumer %s not found", consumer)
+	}
+	err = dao.removeKeyValueFromBucket(models.BucketNotificationConsumer, consumer)
+	if err != nil {
+		return fmt.Errorf("RemoveNotificationConsumer err %s", err)
+	}
+	return dao.removeAckedNotifications()
+}
+
+// removeAckedNotifications remove notifications acknowledged by all consumers, see models.RemovableNotificationSeq
+func (dao *GkvDB) removeAckedNotifications() error {
+	buf, err := dao.getAllValuesOfBucket(models.BucketNotificationConsumer)
+	if err != nil {
+		return err
+	}
+	var cs []*models.NotificationConsumer
+	for _, v := range buf {
+		var c models.NotificationConsumer
+		gobDecode(v, &c)
+		cs = append(cs, &c)
+	}
+	seq := models.RemovableNotificationSeq(cs, dao.GetNotificationLastSeq())
+	acked := dao.GetNotificationAckedSeq()
+	if seq <= acked {
+		return nil
+	}
+	tx := dao.db.Begin()
+	for i := acked + 1; i <= seq; i++ {
+		err = tx.RemoveFrom(gobEncode(i), models.BucketNotification)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("AckNotifications err %s", err)
+		}
+	}
+	err = tx.SetTo(gobEncode(models.KeyNotificationAckedSeq), gobEncode(seq), models.BucketNotificationSeq)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("AckNotifications err %s", err)
+	}
+	return tx.Commit(true)
+}
+
+// GetNotificationLastSeq : Seq of the latest notification ever saved
+func (dao *GkvDB) GetNotificationLastSeq() uint64 {
+	var seq uint64
+	err := dao.getKeyValueToBucket(models.BucketNotificationSeq, models.KeyNotificationLastSeq, &seq)
+	if err != nil && err != ErrorNotFound {
+		log.Error(fmt.Sprintf("GetNotificationLastSeq err %s", err))
+	}
+	return seq
+}
+
+// GetNotificationAckedSeq : all notifications before this Seq (included) have been acknowledged
+func (dao *GkvDB) GetNotificationAckedSeq() uint64 {
+	var seq uint64
+	err := dao.getKeyValueToBucket(models.BucketNotificationSeq, models.KeyNotificationAckedSeq, &seq)
+	if err != nil && err != ErrorNotFound {
+		log.Error(fmt.Sprintf("GetNotificationAckedSeq err %s", err))
+	}
+	return seq
+}
@@ -0,0 +1,28 @@
+package gkvdb
+
+import (
+	"fmt"
+
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// SaveNodePublicKey : create or update
+func (dao *GkvDB) SaveNodePublicKey(pk *models.NodePublicKey) error {
+	pk.Key = pk.Address.String()
+	err := dao.saveKeyValueToBucket(models.BucketNodePublicKey, pk.Key, pk)
+	if err != nil {
+		err = fmt.Errorf("SaveNodePublicKey err %s", err)
+	}
+	return err
+}
+
+// GetNodePublicKey :
+func (dao *GkvDB) GetNodePublicKey(addr common.Address) (*models.NodePublicKey, error) {
+	var pk models.NodePublicKey
+	err := dao.getKeyValueToBucket(models.BucketNodePublicKey, addr.String(), &pk)
+	if err == ErrorNotFound {
+		err = fmt.Errorf("public key of %s not found", addr.String())
+	}
+	return &pk, err
+}
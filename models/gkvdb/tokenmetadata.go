@@ -0,0 +1,39 @@
+package gkvdb
+
+import (
+	"fmt"
+
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// SaveTokenMetadata : create or update
+func (dao *GkvDB) SaveTokenMetadata(m *models.TokenMetadata) error {
+	m.Key = m.TokenAddress.String()
+	err := dao.saveKeyValueToBucket(models.BucketTokenMetadata, m.Key, m)
+	if err != nil {
+		err = fmt.Errorf("SaveTokenMetadata err %s", err)
+	}
+	return err
+}
+
+// GetTokenMetadata :
+func (dao *GkvDB) GetTokenMetadata(token common.Address) (*models.TokenMetadata, error) {
+	var m models.TokenMetadata
+	err := dao.getKeyValueToBucket(models.BucketTokenMetadata, token.String(), &m)
+	if err == ErrorNotFound {
+		err = fmt.Errorf("metadata of token %s not found", token.String())
+	}
+	return &m, err
+}
+
+// GetAllTokenMetadata :
+func (dao *GkvDB) GetAllTokenMetadata() (ms []*models.TokenMetadata, err error) {
+	buf, err := dao.getAllValuesOfBucket(models.BucketTokenMetadata)
+	for _, v := range buf {
+		var m models.TokenMetadata
+		gobDecode(v, &m)
+		ms = append(ms, &m)
+	}
+	return
+}
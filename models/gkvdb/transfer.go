@@ -17,10 +17,6 @@ import (
 NewSentTransfer save a new sent transfer to db,this transfer must be success
 */
 func (dao *GkvDB) NewSentTransfer(blockNumber int64, channelIdentifier common.Hash, openBlockNumber int64, tokenAddr, toAddr common.Address, nonce uint64, amount *big.Int, lockSecretHash common.Hash, data string) *models.SentTransfer {
-	if lockSecretHash == utils.EmptyHash {
-		// direct transfer, use fakeLockSecretHash
-		lockSecretHash = utils.NewRandomHash()
-	}
 	key := fmt.Sprintf("%s-%d-%d", channelIdentifier.String(), openBlockNumber, nonce)
 	st := &models.SentTransfer{
 		Key:               key,
@@ -33,6 +29,7 @@ func (dao *GkvDB) NewSentTransfer(blockNumber int64, channelIdentifier common.Ha
 		Data:              data,
 		OpenBlockNumber:   openBlockNumber,
 		TimeStamp:         time.Now().Format(time.RFC3339),
+		LockSecretHash:    lockSecretHash,
 	}
 	var ost models.SentTransfer
 	err := dao.getKeyValueToBucket(models.BucketSentTransfer, key, &ost)
@@ -41,7 +38,7 @@ func (dao *GkvDB) NewSentTransfer(blockNumber int64, channelIdentifier common.Ha
 			utils.StringInterface(ost, 2), utils.StringInterface(st, 2)))
 		return nil
 	}
-	err = dao.saveKeyValueToBucket(models.BucketSentTransfer, key, st)
+	err = dao.saveSentTransfer(st, toAddr)
 	if err != nil {
 		log.Error(fmt.Sprintf("save SentTransfer err %s", err))
 	}
@@ -50,10 +47,6 @@ func (dao *GkvDB) NewSentTransfer(blockNumber int64, channelIdentifier common.Ha
 
 //NewReceivedTransfer save a new received transfer to db
 func (dao *GkvDB) NewReceivedTransfer(blockNumber int64, channelIdentifier common.Hash, openBlockNumber int64, tokenAddr, fromAddr common.Address, nonce uint64, amount *big.Int, lockSecretHash common.Hash, data string) *models.ReceivedTransfer {
-	if lockSecretHash == utils.EmptyHash {
-		// direct transfer, use fakeLockSecretHash
-		lockSecretHash = utils.NewRandomHash()
-	}
 	key := fmt.Sprintf("%s-%d-%d", channelIdentifier.String(), openBlockNumber, nonce)
 	st := &models.ReceivedTransfer{
 		Key:               key,
@@ -66,6 +59,7 @@ func (dao *GkvDB) NewReceivedTransfer(blockNumber int64, channelIdentifier commo
 		Data:              data,
 		OpenBlockNumber:   openBlockNumber,
 		TimeStamp:         time.Now().Format(time.RFC3339),
+		LockSecretHash:    lockSecretHash,
 	}
 	var ost models.ReceivedTransfer
 	err := dao.getKeyValueToBucket(models.BucketReceivedTransfer, key, &ost)
@@ -74,13 +68,45 @@ func (dao *GkvDB) NewReceivedTransfer(blockNumber int64, channelIdentifier commo
 			utils.StringInterface(ost, 2), utils.StringInterface(st, 2)))
 		return nil
 	}
-	err = dao.saveKeyValueToBucket(models.BucketReceivedTransfer, key, st)
+	err = dao.saveReceivedTransfer(st, fromAddr)
 	if err != nil {
 		log.Error(fmt.Sprintf("save ReceivedTransfer err %s", err))
 	}
 	return st
 }
 
+// saveSentTransfer save transfer and its index in one tx
+func (dao *GkvDB) saveSentTransfer(st *models.SentTransfer, partner common.Address) error {
+	dao.lock.Lock()
+	defer dao.lock.Unlock()
+	tx := dao.db.Begin()
+	err := tx.SetTo(gobEncode(st.Key), gobEncode(st), models.BucketSentTransfer)
+	if err == nil {
+		err = dao.sentTransferIndex().add(tx, st.Key, st.TokenAddress, partner)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit(true)
+}
+
+// saveReceivedTransfer save transfer and its index in one tx
+func (dao *GkvDB) saveReceivedTransfer(rt *models.ReceivedTransfer, partner common.Address) error {
+	dao.lock.Lock()
+	defer dao.lock.Unlock()
+	tx := dao.db.Begin()
+	err := tx.SetTo(gobEncode(rt.Key), gobEncode(rt), models.BucketReceivedTransfer)
+	if err == nil {
+		err = dao.receivedTransferIndex().add(tx, rt.Key, rt.TokenAddress, partner)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit(true)
+}
+
 //GetSentTransfer return the sent transfer by key
 func (dao *GkvDB) GetSentTransfer(key string) (*models.SentTransfer, error) {
 	var s models.SentTransfer
@@ -199,3 +225,129 @@ func (dao *GkvDB) GetReceivedTransferInTimeRange(from, to time.Time) (transfers
 	}
 	return
 }
+
+func (dao *GkvDB) sentTransferOfSeq(seq uint64) (*models.SentTransfer, error) {
+	key, err := dao.sentTransferIndex().transferKey(seq)
+	if err != nil {
+		return nil, err
+	}
+	return dao.GetSentTransfer(key)
+}
+
+func (dao *GkvDB) sentTransferTime(seq uint64) (time.Time, error) {
+	st, err := dao.sentTransferOfSeq(seq)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339, st.TimeStamp)
+}
+
+func (dao *GkvDB) receivedTransferOfSeq(seq uint64) (*models.ReceivedTransfer, error) {
+	key, err := dao.receivedTransferIndex().transferKey(seq)
+	if err != nil {
+		return nil, err
+	}
+	return dao.GetReceivedTransfer(key)
+}
+
+func (dao *GkvDB) receivedTransferTime(seq uint64) (time.Time, error) {
+	rt, err := dao.receivedTransferOfSeq(seq)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339, rt.TimeStamp)
+}
+
+/*
+QuerySentTransfers returns sent transfers match q.
+seqs of transfers are found by index of partner, token or time,
+and transfers are read one by one until enough transfers matched.
+*/
+func (dao *GkvDB) QuerySentTransfers(q *models.TransferQuery) (transfers []*models.SentTransfer, err error) {
+	err = dao.sentTransferIndex().querySeqs(q, dao.sentTransferTime, func(seq uint64) (bool, error) {
+		st, err := dao.sentTransferOfSeq(seq)
+		if err != nil {
+			return false, err
+		}
+		if !q.MatchSentTransfer(st) {
+			return false, nil
+		}
+		transfers = append(transfers, st)
+		return true, nil
+	})
+	if err != nil {
+		return
+	}
+	if !q.SortByTime() {
+		transfers = q.SortAndPageSentTransfers(transfers)
+	} else if q.HasFilter() {
+		// already in the order of time
+		start, end := q.Page(len(transfers))
+		transfers = transfers[start:end]
+	}
+	return
+}
+
+/*
+QueryReceivedTransfers returns received transfers match q.
+seqs of transfers are found by index of partner, token or time,
+and transfers are read one by one until enough transfers matched.
+*/
+func (dao *GkvDB) QueryReceivedTransfers(q *models.TransferQuery) (transfers []*models.ReceivedTransfer, err error) {
+	err = dao.receivedTransferIndex().querySeqs(q, dao.receivedTransferTime, func(seq uint64) (bool, error) {
+		rt, err := dao.receivedTransferOfSeq(seq)
+		if err != nil {
+			return false, err
+		}
+		if !q.MatchReceivedTransfer(rt) {
+			return false, nil
+		}
+		transfers = append(transfers, rt)
+		return true, nil
+	})
+	if err != nil {
+		return
+	}
+	if !q.SortByTime() {
+		transfers = q.SortAndPageReceivedTransfers(transfers)
+	} else if q.HasFilter() {
+		// already in the order of time
+		start, end := q.Page(len(transfers))
+		transfers = transfers[start:end]
+	}
+	return
+}
+
+/*
+IterateSentTransfers calls fn with sent transfers match q in the order of time,
+transfers are read one by one, SortBy, Offset and Limit of q are ignored.
+*/
+func (dao *GkvDB) IterateSentTransfers(q *models.TransferQuery, fn func(st *models.SentTransfer) error) error {
+	return dao.sentTransferIndex().each(q, dao.sentTransferTime, func(seq uint64) error {
+		st, err := dao.sentTransferOfSeq(seq)
+		if err != nil {
+			return err
+		}
+		if !q.MatchSentTransfer(st) {
+			return nil
+		}
+		return fn(st)
+	})
+}
+
+/*
+IterateReceivedTransfers calls fn with received transfers match q in the order of time,
+transfers are read one by one, SortBy, Offset and Limit of q are ignored.
+*/
+func (dao *GkvDB) IterateReceivedTransfers(q *models.TransferQuery, fn func(rt *models.ReceivedTransfer) error) error {
+	return dao.receivedTransferIndex().each(q, dao.receivedTransferTime, func(seq uint64) error {
+		rt, err := dao.receivedTransferOfSeq(seq)
+		if err != nil {
+			return err
+		}
+		if !q.MatchReceivedTransfer(rt) {
+			return nil
+		}
+		return fn(rt)
+	})
+}
@@ -0,0 +1,421 @@
+package gkvdb
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"gitee.com/johng/gkvdb/gkvdb"
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// 每个索引块保存的seq数量
+const transferIndexChunkSize = 256
+
+const keyTransferIndexCount = "count"
+
+/*
+transferIndex :
+gkvdb is a hash table and cannot iterate keys in order,
+so every transfer is assigned a seq in the order of saving, and seqs of every token and partner are kept in lists.
+keys in the index bucket:
+
+	count                   -> number of transfers
+	seq-<seq>               -> key of transfer
+	token-<address>         -> number of transfers of this token
+	token-<address>-<n>     -> the nth chunk of seqs of this token
+	partner-<address>       -> number of transfers of this partner
+	partner-<address>-<n>   -> the nth chunk of seqs of this partner
+*/
+type transferIndex struct {
+	dao    *GkvDB
+	bucket string
+}
+
+func (dao *GkvDB) sentTransferIndex() *transferIndex {
+	return &transferIndex{dao: dao, bucket: models.BucketSentTransferIndex}
+}
+
+func (dao *GkvDB) receivedTransferIndex() *transferIndex {
+	return &transferIndex{dao: dao, bucket: models.BucketReceivedTransferIndex}
+}
+
+// feeChargeRecordIndex index of fee charge records, partner is TransferFrom
+func (dao *GkvDB) feeChargeRecordIndex() *transferIndex {
+	return &transferIndex{dao: dao, bucket: models.BucketFeeChargeRecordIndex}
+}
+
+func seqKey(seq uint64) string {
+	return fmt.Sprintf("seq-%d", seq)
+}
+
+func tokenListName(token common.Address) string {
+	return "token-" + token.String()
+}
+
+func partnerListName(partner common.Address) string {
+	return "partner-" + partner.String()
+}
+
+func chunkKey(name string, n uint64) string {
+	return fmt.Sprintf("%s-%d", name, n)
+}
+
+func (ti *transferIndex) getUint64(key string) uint64 {
+	var n uint64
+	err := ti.dao.getKeyValueToBucket(ti.bucket, key, &n)
+	if err != nil && err != ErrorNotFound {
+		log.Error(fmt.Sprintf("transferIndex get %s err %s", key, err))
+	}
+	return n
+}
+
+// count number of transfers indexed
+func (ti *transferIndex) count() uint64 {
+	return ti.getUint64(keyTransferIndexCount)
+}
+
+// exist is index built?
+func (ti *transferIndex) exist() bool {
+	var n uint64
+	return ti.dao.getKeyValueToBucket(ti.bucket, keyTransferIndexCount, &n) == nil
+}
+
+// transferKey key of the transfer whose seq is seq
+func (ti *transferIndex) transferKey(seq uint64) (key string, err error) {
+	err = ti.dao.getKeyValueToBucket(ti.bucket, seqKey(seq), &key)
+	return
+}
+
+/*
+add a new transfer to index in tx,
+caller must hold dao.lock, and cannot add more than one transfer in the same tx.
+*/
+func (ti *transferIndex) add(tx *gkvdb.Transaction, key string, token, partner common.Address) error {
+	seq := ti.count() + 1
+	err := tx.SetTo(gobEncode(seqKey(seq)), gobEncode(key), ti.bucket)
+	if err != nil {
+		return err
+	}
+	err = ti.appendList(tx, tokenListName(token), seq)
+	if err != nil {
+		return err
+	}
+	err = ti.appendList(tx, partnerListName(partner), seq)
+	if err != nil {
+		return err
+	}
+	return tx.SetTo(gobEncode(keyTransferIndexCount), gobEncode(seq), ti.bucket)
+}
+
+func (ti *transferIndex) appendList(tx *gkvdb.Transaction, name string, seq uint64) error {
+	n := ti.getUint64(name)
+	var chunk []uint64
+	if n%transferIndexChunkSize != 0 {
+		err := ti.dao.getKeyValueToBucket(ti.bucket, chunkKey(name, n/transferIndexChunkSize), &chunk)
+		if err != nil {
+			return err
+		}
+	}
+	chunk = append(chunk, seq)
+	err := tx.SetTo(gobEncode(chunkKey(name, n/transferIndexChunkSize)), gobEncode(chunk), ti.bucket)
+	if err != nil {
+		return err
+	}
+	return tx.SetTo(gobEncode(name), gobEncode(n+1), ti.bucket)
+}
+
+// list all seqs in the list
+func (ti *transferIndex) list(name string) (seqs []uint64, err error) {
+	n := ti.getUint64(name)
+	for i := uint64(0); i*transferIndexChunkSize < n; i++ {
+		var chunk []uint64
+		err = ti.dao.getKeyValueToBucket(ti.bucket, chunkKey(name, i), &chunk)
+		if err != nil {
+			return
+		}
+		seqs = append(seqs, chunk...)
+	}
+	return
+}
+
+/*
+seqRange returns [lo,hi] of seqs in the time range of q, hi < lo means no transfer.
+transfers are saved in the order of time, so it's a binary search.
+*/
+func (ti *transferIndex) seqRange(q *models.TransferQuery, timeOf func(seq uint64) (time.Time, error)) (lo, hi uint64, err error) {
+	n := ti.count()
+	lo, hi = 1, n
+	var searchErr error
+	if !q.FromTime.IsZero() {
+		from := q.FromTime.Truncate(time.Second)
+		i := sort.Search(int(n), func(i int) bool {
+			t, err2 := timeOf(uint64(i) + 1)
+			if err2 != nil {
+				searchErr = err2
+				return true
+			}
+			return !t.Before(from)
+		})
+		lo = uint64(i) + 1
+	}
+	if !q.ToTime.IsZero() {
+		i := sort.Search(int(n), func(i int) bool {
+			t, err2 := timeOf(uint64(i) + 1)
+			if err2 != nil {
+				searchErr = err2
+				return true
+			}
+			return t.After(q.ToTime)
+		})
+		hi = uint64(i)
+	}
+	err = searchErr
+	return
+}
+
+/*
+candidates returns seqs of transfers which may match q in the order of time,
+they are from the list of partner or token if specified, otherwise all seqs in [lo,hi].
+*/
+func (ti *transferIndex) candidates(q *models.TransferQuery, lo, hi uint64) (seqs []uint64, err error) {
+	var list []uint64
+	if q.Partner != utils.EmptyAddress {
+		list, err = ti.list(partnerListName(q.Partner))
+	} else if q.TokenAddress != utils.EmptyAddress {
+		list, err = ti.list(tokenListName(q.TokenAddress))
+	} else {
+		for seq := lo; seq <= hi; seq++ {
+			seqs = append(seqs, seq)
+		}
+		return
+	}
+	for _, seq := range list {
+		if seq >= lo && seq <= hi {
+			seqs = append(seqs, seq)
+		}
+	}
+	return
+}
+
+/*
+pageSeqs seqs of the page specified by Offset and Limit in [lo,hi],
+used when there is no filter other than time.
+*/
+func pageSeqs(q *models.TransferQuery, lo, hi uint64) (seqs []uint64) {
+	if hi < lo {
+		return
+	}
+	n := hi - lo + 1
+	offset := uint64(0)
+	if q.Offset > 0 {
+		offset = uint64(q.Offset)
+	}
+	for i := offset; i < n; i++ {
+		if q.Limit > 0 && i-offset >= uint64(q.Limit) {
+			break
+		}
+		if q.Desc {
+			seqs = append(seqs, hi-i)
+		} else {
+			seqs = append(seqs, lo+i)
+		}
+	}
+	return
+}
+
+/*
+querySeqs seqs of transfers match q, order by time when there is no filter.
+fetch returns whether the transfer of seq matches q, it's called in the order of time,
+and stopped as soon as enough transfers matched if results are sorted by time.
+*/
+func (ti *transferIndex) querySeqs(q *models.TransferQuery, timeOf func(seq uint64) (time.Time, error), fetch func(seq uint64) (bool, error)) error {
+	lo, hi, err := ti.seqRange(q, timeOf)
+	if err != nil {
+		return err
+	}
+	if !q.HasFilter() && q.SortByTime() {
+		for _, seq := range pageSeqs(q, lo, hi) {
+			_, err = fetch(seq)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	seqs, err := ti.candidates(q, lo, hi)
+	if err != nil {
+		return err
+	}
+	if q.Desc {
+		for i, j := 0, len(seqs)-1; i < j; i, j = i+1, j-1 {
+			seqs[i], seqs[j] = seqs[j], seqs[i]
+		}
+	}
+	matched := 0
+	for _, seq := range seqs {
+		if q.SortByTime() && q.Limit > 0 && matched >= q.Offset+q.Limit {
+			break
+		}
+		ok, err := fetch(seq)
+		if err != nil {
+			return err
+		}
+		if ok {
+			matched++
+		}
+	}
+	return nil
+}
+
+/*
+each calls fn with seqs in the time range of q in the order of time,
+only seqs in the list of token are visited if token is specified.
+*/
+func (ti *transferIndex) each(q *models.TransferQuery, timeOf func(seq uint64) (time.Time, error), fn func(seq uint64) error) error {
+	lo, hi, err := ti.seqRange(q, timeOf)
+	if err != nil {
+		return err
+	}
+	if q.TokenAddress == utils.EmptyAddress {
+		for seq := lo; seq <= hi; seq++ {
+			if err = fn(seq); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	name := tokenListName(q.TokenAddress)
+	n := ti.getUint64(name)
+	for i := uint64(0); i*transferIndexChunkSize < n; i++ {
+		var chunk []uint64
+		err = ti.dao.getKeyValueToBucket(ti.bucket, chunkKey(name, i), &chunk)
+		if err != nil {
+			return err
+		}
+		for _, seq := range chunk {
+			if seq > hi {
+				return nil
+			}
+			if seq < lo {
+				continue
+			}
+			if err = fn(seq); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type transferIndexItem struct {
+	key       string
+	token     common.Address
+	partner   common.Address
+	timeStamp string
+}
+
+/*
+build index of transfers saved by older version,
+transfers are sorted by TimeStamp, and all index data are written in one tx.
+*/
+func (ti *transferIndex) build(items []*transferIndexItem) error {
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].timeStamp < items[j].timeStamp
+	})
+	lists := make(map[string][]uint64)
+	tx := ti.dao.db.Begin()
+	for i, item := range items {
+		seq := uint64(i) + 1
+		err := tx.SetTo(gobEncode(seqKey(seq)), gobEncode(item.key), ti.bucket)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		lists[tokenListName(item.token)] = append(lists[tokenListName(item.token)], seq)
+		lists[partnerListName(item.partner)] = append(lists[partnerListName(item.partner)], seq)
+	}
+	for name, seqs := range lists {
+		for i := 0; i*transferIndexChunkSize < len(seqs); i++ {
+			end := (i + 1) * transferIndexChunkSize
+			if end > len(seqs) {
+				end = len(seqs)
+			}
+			err := tx.SetTo(gobEncode(chunkKey(name, uint64(i))), gobEncode(seqs[i*transferIndexChunkSize:end]), ti.bucket)
+			if err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+		err := tx.SetTo(gobEncode(name), gobEncode(uint64(len(seqs))), ti.bucket)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	err := tx.SetTo(gobEncode(keyTransferIndexCount), gobEncode(uint64(len(items))), ti.bucket)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit(true)
+}
+
+// buildTransferIndex build index of transfers and fee charge records if not built yet
+func (dao *GkvDB) buildTransferIndex() error {
+	if ti := dao.sentTransferIndex(); !ti.exist() {
+		buf, err := dao.getAllValuesOfBucket(models.BucketSentTransfer)
+		if err != nil {
+			return err
+		}
+		var items []*transferIndexItem
+		for _, v := range buf {
+			var st models.SentTransfer
+			gobDecode(v, &st)
+			items = append(items, &transferIndexItem{st.Key, st.TokenAddress, st.ToAddress, st.TimeStamp})
+		}
+		log.Info(fmt.Sprintf("build index of %d sent transfers", len(items)))
+		err = ti.build(items)
+		if err != nil {
+			return err
+		}
+	}
+	if ti := dao.receivedTransferIndex(); !ti.exist() {
+		buf, err := dao.getAllValuesOfBucket(models.BucketReceivedTransfer)
+		if err != nil {
+			return err
+		}
+		var items []*transferIndexItem
+		for _, v := range buf {
+			var rt models.ReceivedTransfer
+			gobDecode(v, &rt)
+			items = append(items, &transferIndexItem{rt.Key, rt.TokenAddress, rt.FromAddress, rt.TimeStamp})
+		}
+		log.Info(fmt.Sprintf("build index of %d received transfers", len(items)))
+		err = ti.build(items)
+		if err != nil {
+			return err
+		}
+	}
+	if ti := dao.feeChargeRecordIndex(); !ti.exist() {
+		buf, err := dao.getAllValuesOfBucket(models.BucketFeeChargeRecord)
+		if err != nil {
+			return err
+		}
+		var items []*transferIndexItem
+		for _, v := range buf {
+			var r models.FeeChargeRecord
+			gobDecode(v, &r)
+			items = append(items, &transferIndexItem{r.Key.String(), r.TokenAddress, r.TransferFrom, time.Unix(r.Timestamp, 0).Format(time.RFC3339)})
+		}
+		log.Info(fmt.Sprintf("build index of %d fee charge records", len(items)))
+		err = ti.build(items)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
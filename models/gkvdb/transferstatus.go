@@ -69,6 +69,27 @@ func (dao *GkvDB) UpdateTransferStatusMessage(tokenAddress common.Address, lockS
 	log.Trace(fmt.Sprintf("UpdateTransferStatusMessage key=%s lockSecretHash=%s %s", key, lockSecretHash.String(), statusMessage))
 }
 
+// UpdateTransferStatusParts : progress of each part of a multi-path transfer
+func (dao *GkvDB) UpdateTransferStatusParts(tokenAddress common.Address, lockSecretHash common.Hash, parts []*models.TransferPartStatus) {
+	var ts models.TransferStatus
+	key := utils.Sha3(tokenAddress[:], lockSecretHash[:]).String()
+	err := dao.getKeyValueToBucket(models.BucketTransferStatus, key, &ts)
+	if err == ErrorNotFound {
+		return
+	}
+	if err != nil {
+		log.Error(fmt.Sprintf("UpdateTransferStatusParts err %s", err))
+		return
+	}
+	ts.Parts = parts
+	err = dao.saveKeyValueToBucket(models.BucketTransferStatus, ts.Key, ts)
+	if err != nil {
+		log.Error(fmt.Sprintf("UpdateTransferStatusParts err %s", err))
+		return
+	}
+	log.Trace(fmt.Sprintf("UpdateTransferStatusParts key=%s lockSecretHash=%s parts=%d", key, lockSecretHash.String(), len(parts)))
+}
+
 // GetTransferStatus :
 func (dao *GkvDB) GetTransferStatus(tokenAddress common.Address, lockSecretHash common.Hash) (*models.TransferStatus, error) {
 	var ts models.TransferStatus
@@ -0,0 +1,49 @@
+package gkvdb
+
+import (
+	"fmt"
+
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// SaveDelegation : create or update
+func (dao *GkvDB) SaveDelegation(d *models.Delegation) error {
+	d.Key = d.ChannelIdentifier.String()
+	err := dao.saveKeyValueToBucket(models.BucketDelegation, d.Key, d)
+	if err != nil {
+		err = fmt.Errorf("SaveDelegation err %s", err)
+	}
+	return err
+}
+
+// GetDelegation :
+func (dao *GkvDB) GetDelegation(channelIdentifier common.Hash) (*models.Delegation, error) {
+	var d models.Delegation
+	err := dao.getKeyValueToBucket(models.BucketDelegation, channelIdentifier.String(), &d)
+	if err == ErrorNotFound {
+		err = fmt.Errorf("delegation of channel %s not found", channelIdentifier.String())
+	}
+	return &d, err
+}
+
+// GetAllDelegations :
+func (dao *GkvDB) GetAllDelegations() (ds []*models.Delegation, err error) {
+	buf, err := dao.getAllValuesOfBucket(models.BucketDelegation)
+	for _, v := range buf {
+		var d models.Delegation
+		gobDecode(v, &d)
+		ds = append(ds, &d)
+	}
+	return
+}
+
+// RemoveDelegation :
+func (dao *GkvDB) RemoveDelegation(channelIdentifier common.Hash) error {
+	var d models.Delegation
+	err := dao.getKeyValueToBucket(models.BucketDelegation, channelIdentifier.String(), &d)
+	if err == ErrorNotFound {
+		return fmt.Errorf("delegation of channel %s not found", channelIdentifier.String())
+	}
+	return dao.removeKeyValueFromBucket(models.BucketDelegation, channelIdentifier.String())
+}
@@ -0,0 +1,62 @@
+package gkvdb
+
+import (
+	"fmt"
+
+	"github.com/SmartMeshFoundation/Photon/models"
+)
+
+// SaveWebhook : add or update a webhook
+func (dao *GkvDB) SaveWebhook(w *models.Webhook) error {
+	err := dao.saveKeyValueToBucket(models.BucketWebhook, w.ID, w)
+	if err != nil {
+		err = fmt.Errorf("SaveWebhook err %s", err)
+	}
+	return err
+}
+
+// RemoveWebhook :
+func (dao *GkvDB) RemoveWebhook(id string) error {
+	var w models.Webhook
+	err := dao.getKeyValueToBucket(models.BucketWebhook, id, &w)
+	if err == ErrorNotFound {
+		return fmt.Errorf("webhook %s not found", id)
+	}
+	return dao.removeKeyValueFromBucket(models.BucketWebhook, id)
+}
+
+// GetAllWebhooks :
+func (dao *GkvDB) GetAllWebhooks() (ws []*models.Webhook, err error) {
+	buf, err := dao.getAllValuesOfBucket(models.BucketWebhook)
+	for _, v := range buf {
+		var w models.Webhook
+		gobDecode(v, &w)
+		ws = append(ws, &w)
+	}
+	return
+}
+
+// SaveWebhookDelivery : add or update a delivery
+func (dao *GkvDB) SaveWebhookDelivery(d *models.WebhookDelivery) error {
+	err := dao.saveKeyValueToBucket(models.BucketWebhookDelivery, d.Key, d)
+	if err != nil {
+		err = fmt.Errorf("SaveWebhookDelivery err %s", err)
+	}
+	return err
+}
+
+// RemoveWebhookDelivery :
+func (dao *GkvDB) RemoveWebhookDelivery(key string) error {
+	return dao.removeKeyValueFromBucket(models.BucketWebhookDelivery, key)
+}
+
+// GetAllWebhookDeliveries : deliveries pending or failed
+func (dao *GkvDB) GetAllWebhookDeliveries() (ds []*models.WebhookDelivery, err error) {
+	buf, err := dao.getAllValuesOfBucket(models.BucketWebhookDelivery)
+	for _, v := range buf {
+		var d models.WebhookDelivery
+		gobDecode(v, &d)
+		ds = append(ds, &d)
+	}
+	return
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"encoding/gob"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+HoldLockSecretHash :
+incoming transfer with this lock secret hash is held until user accepts or cancels it,
+set by user before the transfer is received.
+*/
+type HoldLockSecretHash struct {
+	Key            string      `json:"-" storm:"id"`
+	LockSecretHash common.Hash `json:"lock_secret_hash"`
+}
+
+func init() {
+	gob.Register(&HoldLockSecretHash{})
+}
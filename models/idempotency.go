@@ -0,0 +1,44 @@
+package models
+
+import (
+	"encoding/gob"
+	"errors"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// IdempotencyStatus :
+type IdempotencyStatus int
+
+const (
+	// IdempotencyStatusPending request is processing, or photon stopped before it finished
+	IdempotencyStatusPending IdempotencyStatus = iota
+	// IdempotencyStatusDone response of request is saved
+	IdempotencyStatusDone
+)
+
+// ErrIdempotencyKeyExists another request with the same Idempotency-Key has been received
+var ErrIdempotencyKeyExists = errors.New("idempotency key exists")
+
+/*
+IdempotencyRecord :
+request with header Idempotency-Key and its result,
+retried requests with the same key get the saved response instead of starting a new operation.
+LockSecretHash, TokenAddress and PartnerAddress are saved as soon as the operation is started,
+so the operation can be found even if photon stopped before it finished.
+*/
+type IdempotencyRecord struct {
+	Key            string            `json:"idempotency_key" storm:"id"`
+	RequestHash    common.Hash       `json:"-"` // hash of method, path and body of request
+	Status         IdempotencyStatus `json:"-"`
+	LockSecretHash common.Hash       `json:"lock_secret_hash"`
+	TokenAddress   common.Address    `json:"token_address"`
+	PartnerAddress common.Address    `json:"partner_address"`
+	StatusCode     int               `json:"-"`
+	Response       []byte            `json:"-"`
+	CreateTime     int64             `json:"create_time" storm:"index"`
+}
+
+func init() {
+	gob.Register(&IdempotencyRecord{})
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"encoding/gob"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// InvoiceStatus :
+type InvoiceStatus int
+
+const (
+	// InvoiceStatusUnpaid waiting for payment, it may be expired, see Invoice.IsExpired
+	InvoiceStatusUnpaid InvoiceStatus = iota
+	// InvoiceStatusPaid a transfer matches this invoice has been unlocked
+	InvoiceStatusPaid
+)
+
+/*
+Invoice :
+payment request created by receiver, identified by lock secret hash.
+Secret never leaves receiver, it's revealed only when a transfer matches token, amount and expiry of this invoice.
+Encoded is the signed string given to payer.
+*/
+type Invoice struct {
+	Key            string           `json:"-" storm:"id"`
+	LockSecretHash common.Hash      `json:"lock_secret_hash"`
+	Secret         common.Hash      `json:"-"`
+	TokenAddress   common.Address   `json:"token_address"`
+	Receiver       common.Address   `json:"receiver"`
+	Amount         *big.Int         `json:"amount"`
+	Expiry         int64            `json:"expiry"` // unix time
+	Description    string           `json:"description,omitempty"`
+	RouteHints     []common.Address `json:"route_hints,omitempty"` // nodes which have channels with receiver
+	Encoded        string           `json:"encoded,omitempty"`
+	Status         InvoiceStatus    `json:"status"`
+	CreateTime     int64            `json:"create_time,omitempty"`
+	PaidTime       int64            `json:"paid_time,omitempty"`
+	Payer          common.Address   `json:"payer,omitempty"`
+}
+
+// IsExpired returns true if invoice cannot be paid at unix time now
+func (i *Invoice) IsExpired(now int64) bool {
+	return now >= i.Expiry
+}
+
+func init() {
+	gob.Register(&Invoice{})
+}
@@ -0,0 +1,124 @@
+package models
+
+import (
+	"encoding/gob"
+	"errors"
+	"math/big"
+
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+LiquidityRule :
+keep our balance of channels between MinBalance and MaxBalance.
+Balance less than MinBalance is topped up to TargetBalance by deposit,
+balance more than MaxBalance is withdrawn to TargetBalance.
+A rule of channel overrides the rule of its token.
+*/
+type LiquidityRule struct {
+	// Key is ChannelIdentifier for rule of channel, TokenAddress for rule of token
+	Key               string         `json:"id" storm:"id"`
+	TokenAddress      common.Address `json:"token_address"`
+	ChannelIdentifier common.Hash    `json:"channel_identifier"`
+	MinBalance        *big.Int       `json:"min_balance,omitempty"`    // nil means never deposit
+	TargetBalance     *big.Int       `json:"target_balance,omitempty"` // (MinBalance+MaxBalance)/2 by default
+	MaxBalance        *big.Int       `json:"max_balance,omitempty"`    // nil means never withdraw
+	UpdateTime        int64          `json:"update_time"`
+	// Prepared channels this rule has PrepareForWithdraw, to be canceled when withdraw is no longer needed
+	Prepared []common.Hash `json:"prepared,omitempty"`
+}
+
+// LiquidityRuleKey key of rule for channel, or for token if channelIdentifier is empty
+func LiquidityRuleKey(token common.Address, channelIdentifier common.Hash) string {
+	if channelIdentifier == utils.EmptyHash {
+		return token.String()
+	}
+	return channelIdentifier.String()
+}
+
+/*
+Normalize checks balances of rule and sets Key and default TargetBalance
+*/
+func (r *LiquidityRule) Normalize() error {
+	if r.TokenAddress == utils.EmptyAddress {
+		return errors.New("token address is empty")
+	}
+	if r.MinBalance == nil && r.MaxBalance == nil {
+		return errors.New("one of min_balance and max_balance is required")
+	}
+	if r.MinBalance != nil && r.MinBalance.Sign() < 0 {
+		return errors.New("min_balance must not be negative")
+	}
+	if r.MinBalance != nil && r.MaxBalance != nil && r.MaxBalance.Cmp(r.MinBalance) <= 0 {
+		return errors.New("max_balance must be greater than min_balance")
+	}
+	if r.TargetBalance == nil {
+		switch {
+		case r.MinBalance == nil:
+			r.TargetBalance = new(big.Int).Set(r.MaxBalance)
+		case r.MaxBalance == nil:
+			r.TargetBalance = new(big.Int).Set(r.MinBalance)
+		default:
+			r.TargetBalance = new(big.Int).Add(r.MinBalance, r.MaxBalance)
+			r.TargetBalance.Div(r.TargetBalance, big.NewInt(2))
+		}
+	}
+	if (r.MinBalance != nil && r.TargetBalance.Cmp(r.MinBalance) < 0) ||
+		(r.MaxBalance != nil && r.TargetBalance.Cmp(r.MaxBalance) > 0) {
+		return errors.New("target_balance must between min_balance and max_balance")
+	}
+	r.Key = LiquidityRuleKey(r.TokenAddress, r.ChannelIdentifier)
+	return nil
+}
+
+/*
+Adjustment returns amount to deposit or to withdraw when our balance is balance,
+both are nil if balance is within the rule.
+*/
+func (r *LiquidityRule) Adjustment(balance *big.Int) (deposit, withdraw *big.Int) {
+	if r.MinBalance != nil && balance.Cmp(r.MinBalance) < 0 {
+		deposit = new(big.Int).Sub(r.TargetBalance, balance)
+		if deposit.Sign() <= 0 {
+			deposit = nil
+		}
+		return
+	}
+	if r.MaxBalance != nil && balance.Cmp(r.MaxBalance) > 0 {
+		withdraw = new(big.Int).Sub(balance, r.TargetBalance)
+		if withdraw.Sign() <= 0 {
+			withdraw = nil
+		}
+	}
+	return
+}
+
+// IsPrepared whether channelIdentifier was PrepareForWithdraw by this rule
+func (r *LiquidityRule) IsPrepared(channelIdentifier common.Hash) bool {
+	for _, h := range r.Prepared {
+		if h == channelIdentifier {
+			return true
+		}
+	}
+	return false
+}
+
+// SetPrepared marks or unmarks channelIdentifier as PrepareForWithdraw by this rule, returns whether anything changed
+func (r *LiquidityRule) SetPrepared(channelIdentifier common.Hash, prepared bool) bool {
+	for i, h := range r.Prepared {
+		if h == channelIdentifier {
+			if !prepared {
+				r.Prepared = append(r.Prepared[:i], r.Prepared[i+1:]...)
+			}
+			return !prepared
+		}
+	}
+	if prepared {
+		r.Prepared = append(r.Prepared, channelIdentifier)
+	}
+	return prepared
+}
+
+func init() {
+	gob.Register(&LiquidityRule{})
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"encoding/gob"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+MediationLimit :
+limits of mediated transfers a partner can push into one channel, zero or nil means no limit.
+*/
+type MediationLimit struct {
+	MaxPendingLocks       int      `json:"max_pending_locks"`       // locks of partner on this channel, including the new one
+	MaxLockedAmount       *big.Int `json:"max_locked_amount"`       // amount locked by partner on this channel, including the new one
+	MaxExpirationDistance int64    `json:"max_expiration_distance"` // expiration of lock minus current block number
+	MinTransferAmount     *big.Int `json:"min_transfer_amount"`
+}
+
+/*
+MediationLimitPolicy :
+limit of a channel is the one in ChannelLimitMap, or the one of its token in TokenLimitMap, or AccountLimit.
+*/
+type MediationLimitPolicy struct {
+	Key             string                             `storm:"id"`
+	AccountLimit    *MediationLimit                    `json:"account_limit"`
+	TokenLimitMap   map[common.Address]*MediationLimit `json:"token_limit_map"`
+	ChannelLimitMap map[common.Hash]*MediationLimit    `json:"channel_limit_map"`
+}
+
+// NewDefaultMediationLimitPolicy : 默认没有任何限制
+func NewDefaultMediationLimitPolicy() *MediationLimitPolicy {
+	return &MediationLimitPolicy{
+		AccountLimit:    &MediationLimit{},
+		TokenLimitMap:   make(map[common.Address]*MediationLimit),
+		ChannelLimitMap: make(map[common.Hash]*MediationLimit),
+	}
+}
+
+// GetLimit limit of channel
+func (p *MediationLimitPolicy) GetLimit(token common.Address, channelIdentifier common.Hash) *MediationLimit {
+	if l, ok := p.ChannelLimitMap[channelIdentifier]; ok && l != nil {
+		return l
+	}
+	if l, ok := p.TokenLimitMap[token]; ok && l != nil {
+		return l
+	}
+	if p.AccountLimit != nil {
+		return p.AccountLimit
+	}
+	return &MediationLimit{}
+}
+
+func init() {
+	gob.Register(&MediationLimitPolicy{})
+}
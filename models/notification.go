@@ -0,0 +1,58 @@
+package models
+
+import (
+	"encoding/gob"
+
+	"github.com/SmartMeshFoundation/Photon/params"
+)
+
+/*
+Notification :
+one record of the notification outbox.
+Seq is increased one by one and never reused, even after notifications are acknowledged and removed.
+*/
+type Notification struct {
+	Seq       uint64 `storm:"id"`
+	Type      string
+	Data      []byte //json encoded
+	Timestamp int64
+}
+
+/*
+NotificationConsumer :
+a consumer of the notification outbox, such as mobile app, webhooks or a restful client.
+notifications are removed only after all consumers have acknowledged them.
+*/
+type NotificationConsumer struct {
+	Name   string `storm:"id"`
+	Cursor uint64 // all notifications not greater than it have been acknowledged by this consumer
+}
+
+/*
+RemovableNotificationSeq : notifications not greater than the returned Seq can be removed from outbox.
+Without any consumer only the latest params.NotificationHistorySize notifications are kept,
+and never more than params.MaxNotificationOutboxSize whatever consumers have acknowledged.
+*/
+func RemovableNotificationSeq(cs []*NotificationConsumer, last uint64) uint64 {
+	seq := last
+	if len(cs) == 0 {
+		seq = 0
+		if last > params.NotificationHistorySize {
+			seq = last - params.NotificationHistorySize
+		}
+	}
+	for _, c := range cs {
+		if c.Cursor < seq {
+			seq = c.Cursor
+		}
+	}
+	if last > params.MaxNotificationOutboxSize && seq < last-params.MaxNotificationOutboxSize {
+		seq = last - params.MaxNotificationOutboxSize
+	}
+	return seq
+}
+
+func init() {
+	gob.Register(&Notification{})
+	gob.Register(&NotificationConsumer{})
+}
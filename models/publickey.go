@@ -0,0 +1,23 @@
+package models
+
+import (
+	"encoding/gob"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+NodePublicKey :
+uncompressed public key of a node, recovered from signature of a message it sent,
+or provided by user. It's used to encrypt secret of a keysend transfer.
+*/
+type NodePublicKey struct {
+	Key        string         `json:"-" storm:"id"`
+	Address    common.Address `json:"address"`
+	PublicKey  []byte         `json:"public_key"`
+	UpdateTime int64          `json:"update_time"`
+}
+
+func init() {
+	gob.Register(&NodePublicKey{})
+}
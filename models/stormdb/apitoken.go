@@ -0,0 +1,100 @@
+package stormdb
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/asdine/storm"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// NewAPIToken : save a new api token, error if id exists
+func (model *StormDB) NewAPIToken(t *models.APIToken) error {
+	var old models.APIToken
+	err := model.db.One("ID", t.ID, &old)
+	if err == nil {
+		return fmt.Errorf("api token %s already exists", t.ID)
+	}
+	err = model.db.Save(t)
+	if err != nil {
+		err = fmt.Errorf("NewAPIToken err %s", err)
+	}
+	return err
+}
+
+// GetAPIToken :
+func (model *StormDB) GetAPIToken(id string) (*models.APIToken, error) {
+	var t models.APIToken
+	err := model.db.One("ID", id, &t)
+	if err == storm.ErrNotFound {
+		err = fmt.Errorf("api token %s not found", id)
+	}
+	return &t, err
+}
+
+// GetAllAPITokens :
+func (model *StormDB) GetAllAPITokens() (ts []*models.APIToken, err error) {
+	err = model.db.All(&ts)
+	if err == storm.ErrNotFound {
+		err = nil
+	}
+	return
+}
+
+// RemoveAPIToken :
+func (model *StormDB) RemoveAPIToken(id string) error {
+	err := model.db.DeleteStruct(&models.APIToken{ID: id})
+	if err == storm.ErrNotFound {
+		err = fmt.Errorf("api token %s not found", id)
+	}
+	return err
+}
+
+// HasAPIToken : is there any api token?
+func (model *StormDB) HasAPIToken() bool {
+	n, err := model.db.Count(&models.APIToken{})
+	if err != nil && err != storm.ErrNotFound {
+		log.Error(fmt.Sprintf("HasAPIToken err %s", err))
+	}
+	return n > 0
+}
+
+// SpendAPIToken : check spending cap of api token and record amount spent in one tx
+func (model *StormDB) SpendAPIToken(id string, token common.Address, amount *big.Int) error {
+	return model.updateAPIToken(id, func(t *models.APIToken) error {
+		return t.Spend(token, amount)
+	})
+}
+
+// RefundAPIToken : give back amount spent by transfers not sent or failed
+func (model *StormDB) RefundAPIToken(id string, token common.Address, amount *big.Int) error {
+	return model.updateAPIToken(id, func(t *models.APIToken) error {
+		t.Refund(token, amount)
+		return nil
+	})
+}
+
+// updateAPIToken change api token by fn in one tx, nothing changed if fn returns error
+func (model *StormDB) updateAPIToken(id string, fn func(t *models.APIToken) error) error {
+	tx, err := model.db.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var t models.APIToken
+	err = tx.One("ID", id, &t)
+	if err != nil {
+		return fmt.Errorf("api token %s not found", id)
+	}
+	err = fn(&t)
+	if err != nil {
+		return err
+	}
+	err = tx.Save(&t)
+	if err != nil {
+		return fmt.Errorf("updateAPIToken err %s", err)
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,36 @@
+package stormdb
+
+import (
+	"fmt"
+
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/asdine/storm"
+)
+
+// SaveBatchTransfer : create or update
+func (model *StormDB) SaveBatchTransfer(b *models.BatchTransfer) error {
+	err := model.db.Save(b)
+	if err != nil {
+		err = fmt.Errorf("SaveBatchTransfer err %s", err)
+	}
+	return err
+}
+
+// GetBatchTransfer :
+func (model *StormDB) GetBatchTransfer(id string) (*models.BatchTransfer, error) {
+	var b models.BatchTransfer
+	err := model.db.One("ID", id, &b)
+	if err == storm.ErrNotFound {
+		err = fmt.Errorf("batch transfer %s not found", id)
+	}
+	return &b, err
+}
+
+// GetAllBatchTransfers :
+func (model *StormDB) GetAllBatchTransfers() (bs []*models.BatchTransfer, err error) {
+	err = model.db.All(&bs)
+	if err == storm.ErrNotFound {
+		err = nil
+	}
+	return
+}
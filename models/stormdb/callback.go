@@ -37,6 +37,13 @@ func (model *StormDB) RegisterChannelSettleCallback(f cb.ChannelCb) {
 	model.mlock.Unlock()
 }
 
+//RegisterChannelUpdateCallback notify when channel saved, balance proof or locks may be changed
+func (model *StormDB) RegisterChannelUpdateCallback(f cb.ChannelCb) {
+	model.mlock.Lock()
+	model.channelUpdateCallbacks[&f] = true
+	model.mlock.Unlock()
+}
+
 /*
 do we need remove a callback?
 */
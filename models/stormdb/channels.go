@@ -32,8 +32,10 @@ func (model *StormDB) UpdateChannelNoTx(c *channeltype.Serialization) error {
 	err := model.db.Save(c)
 	if err != nil {
 		log.Error(fmt.Sprintf("UpdateChannelNoTx err:%s", err))
+		return err
 	}
-	return err
+	model.handleChannelCallback(model.channelUpdateCallbacks, c)
+	return nil
 }
 
 //UpdateChannelAndSaveAck update channel and save ack, must atomic
@@ -85,8 +87,10 @@ func (model *StormDB) UpdateChannel(c *channeltype.Serialization, tx models.TX)
 	err := tx.Save(c)
 	if err != nil {
 		log.Error(fmt.Sprintf("UpdateChannel err=%s", err))
+		return err
 	}
-	return err
+	model.handleChannelCallback(model.channelUpdateCallbacks, c)
+	return nil
 }
 
 //UpdateChannelState update channel state ,close settle
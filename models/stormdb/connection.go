@@ -0,0 +1,47 @@
+package stormdb
+
+import (
+	"fmt"
+
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/asdine/storm"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// SaveTokenNetworkConnection : create or update
+func (model *StormDB) SaveTokenNetworkConnection(c *models.TokenNetworkConnection) error {
+	c.Key = c.TokenAddress.String()
+	err := model.db.Save(c)
+	if err != nil {
+		err = fmt.Errorf("SaveTokenNetworkConnection err %s", err)
+	}
+	return err
+}
+
+// GetTokenNetworkConnection :
+func (model *StormDB) GetTokenNetworkConnection(token common.Address) (*models.TokenNetworkConnection, error) {
+	var c models.TokenNetworkConnection
+	err := model.db.One("Key", token.String(), &c)
+	if err == storm.ErrNotFound {
+		err = fmt.Errorf("token network %s not joined", token.String())
+	}
+	return &c, err
+}
+
+// GetAllTokenNetworkConnections :
+func (model *StormDB) GetAllTokenNetworkConnections() (cs []*models.TokenNetworkConnection, err error) {
+	err = model.db.All(&cs)
+	if err == storm.ErrNotFound {
+		err = nil
+	}
+	return
+}
+
+// RemoveTokenNetworkConnection :
+func (model *StormDB) RemoveTokenNetworkConnection(token common.Address) error {
+	err := model.db.DeleteStruct(&models.TokenNetworkConnection{Key: token.String()})
+	if err == storm.ErrNotFound {
+		err = fmt.Errorf("token network %s not joined", token.String())
+	}
+	return err
+}
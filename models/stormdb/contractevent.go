@@ -0,0 +1,165 @@
+package stormdb
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/asdine/storm"
+)
+
+// 顺序扫描时每次从数据库读取的事件数
+const contractEventBatchSize = 100
+
+/*
+SaveContractEvents : save events received from chain,
+events already saved are ignored, ID of new events are assigned here.
+*/
+func (model *StormDB) SaveContractEvents(es []*models.ContractEvent) error {
+	tx, err := model.db.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var lastID uint64
+	err = tx.Get(models.BucketContractEventSeq, models.KeyContractEventLastID, &lastID)
+	if err != nil && err != storm.ErrNotFound {
+		return fmt.Errorf("SaveContractEvents err %s", err)
+	}
+	for _, e := range es {
+		var old models.ContractEvent
+		err = tx.One("Key", e.Key, &old)
+		if err == nil {
+			continue
+		}
+		if err != storm.ErrNotFound {
+			return fmt.Errorf("SaveContractEvents err %s", err)
+		}
+		err = nil
+		if c := e.ChannelInfo(); c != nil {
+			err = tx.Set(models.BucketContractEventChannel, e.ChannelIdentifier[:], c)
+		} else if e.ChannelIdentifier != utils.EmptyHash {
+			c = &models.ContractEventChannel{}
+			err = tx.Get(models.BucketContractEventChannel, e.ChannelIdentifier[:], c)
+			if err == nil {
+				e.FillChannelInfo(c)
+			} else if err == storm.ErrNotFound {
+				err = nil
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("SaveContractEvents err %s", err)
+		}
+		lastID++
+		e.ID = lastID
+		err = tx.Save(e)
+		if err != nil {
+			return fmt.Errorf("SaveContractEvents err %s", err)
+		}
+	}
+	err = tx.Set(models.BucketContractEventSeq, models.KeyContractEventLastID, lastID)
+	if err != nil {
+		return fmt.Errorf("SaveContractEvents err %s", err)
+	}
+	return tx.Commit()
+}
+
+/*
+GetContractEvents : events match f, order by ID.
+query by index of channel if channel is specified, otherwise scan events after cursor one batch by one batch.
+*/
+func (model *StormDB) GetContractEvents(f *models.ContractEventFilter) (es []*models.ContractEvent, err error) {
+	if f.ChannelIdentifier != utils.EmptyHash {
+		var all []*models.ContractEvent
+		err = model.db.Find("ChannelIdentifier", f.ChannelIdentifier, &all)
+		if err == storm.ErrNotFound {
+			err = nil
+		}
+		if err != nil {
+			return
+		}
+		sort.Slice(all, func(i, j int) bool {
+			return all[i].ID < all[j].ID
+		})
+		for _, e := range all {
+			if f.Limit > 0 && len(es) >= f.Limit {
+				break
+			}
+			model.fillContractEventChannel(e)
+			if e.ID > f.Cursor && f.Match(e) {
+				es = append(es, e)
+			}
+		}
+		return
+	}
+	last := model.GetContractEventLastID()
+	for from := f.Cursor + 1; from <= last; from += contractEventBatchSize {
+		var batch []*models.ContractEvent
+		err = model.db.Range("ID", from, from+contractEventBatchSize-1, &batch)
+		if err == storm.ErrNotFound {
+			err = nil
+			continue
+		}
+		if err != nil {
+			return
+		}
+		for _, e := range batch {
+			model.fillContractEventChannel(e)
+			if f.Match(e) {
+				es = append(es, e)
+				if f.Limit > 0 && len(es) >= f.Limit {
+					return
+				}
+			}
+		}
+	}
+	return
+}
+
+// GetContractEventLastID : ID of the latest contract event saved
+func (model *StormDB) GetContractEventLastID() uint64 {
+	var id uint64
+	err := model.db.Get(models.BucketContractEventSeq, models.KeyContractEventLastID, &id)
+	if err != nil && err != storm.ErrNotFound {
+		log.Error(fmt.Sprintf("GetContractEventLastID err %s", err))
+	}
+	return id
+}
+
+/*
+fillContractEventChannel fill token and participants of the event saved before ChannelOpenedAndDeposit,
+it happens when ChannelOpenedAndDeposit is fetched by backfill later.
+*/
+func (model *StormDB) fillContractEventChannel(e *models.ContractEvent) {
+	if e.ChannelIdentifier == utils.EmptyHash || e.ChannelInfo() != nil {
+		return
+	}
+	c := &models.ContractEventChannel{}
+	if model.db.Get(models.BucketContractEventChannel, e.ChannelIdentifier[:], c) == nil {
+		e.FillChannelInfo(c)
+	}
+}
+
+// GetContractEventBackfill : progress of fetching events before cache starts, nil if never started
+func (model *StormDB) GetContractEventBackfill() *models.ContractEventBackfill {
+	b := &models.ContractEventBackfill{}
+	err := model.db.Get(models.BucketContractEventSeq, models.KeyContractEventBackfill, b)
+	if err != nil {
+		if err != storm.ErrNotFound {
+			log.Error(fmt.Sprintf("GetContractEventBackfill err %s", err))
+		}
+		return nil
+	}
+	return b
+}
+
+// SaveContractEventBackfill : save progress of fetching events before cache starts
+func (model *StormDB) SaveContractEventBackfill(b *models.ContractEventBackfill) error {
+	err := model.db.Set(models.BucketContractEventSeq, models.KeyContractEventBackfill, b)
+	if err != nil {
+		return fmt.Errorf("SaveContractEventBackfill err %s", err)
+	}
+	return nil
+}
@@ -29,6 +29,7 @@ type StormDB struct {
 	channelDepositCallbacks map[*cb.ChannelCb]bool
 	channelStateCallbacks   map[*cb.ChannelCb]bool
 	channelSettledCallbacks map[*cb.ChannelCb]bool
+	channelUpdateCallbacks  map[*cb.ChannelCb]bool
 	mlock                   sync.Mutex
 	Name                    string
 }
@@ -40,6 +41,7 @@ func newStormDB() (db *StormDB) {
 		channelDepositCallbacks: make(map[*cb.ChannelCb]bool),
 		channelStateCallbacks:   make(map[*cb.ChannelCb]bool),
 		channelSettledCallbacks: make(map[*cb.ChannelCb]bool),
+		channelUpdateCallbacks:  make(map[*cb.ChannelCb]bool),
 	}
 
 }
@@ -87,6 +89,11 @@ func OpenDb(dbPath string) (model *StormDB, err error) {
 		if closeFlag != true {
 			log.Error("database not closed  last..., try to restore?")
 		}
+		// 索引重建失败只影响交易记录的查询
+		if err = model.reIndexTransfers(); err != nil {
+			log.Error(fmt.Sprintf("reIndexTransfers err %s", err))
+			err = nil
+		}
 	}
 
 	return
@@ -168,6 +175,7 @@ func init() {
 func (model *StormDB) initDb() {
 	err := model.db.Init(&models.SentTransfer{})
 	err = model.db.Init(&models.ReceivedTransfer{})
+	err = model.db.Set(models.BucketMeta, models.KeyTransferIndex, models.TransferIndexVersion)
 	err = model.db.Set(models.BucketBlockNumber, models.KeyBlockNumber, 0)
 	if err != nil {
 		log.Error(fmt.Sprintf("db err %s", err))
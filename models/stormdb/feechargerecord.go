@@ -2,12 +2,14 @@ package stormdb
 
 import (
 	"fmt"
+	"math"
 
 	"time"
 
 	"github.com/SmartMeshFoundation/Photon/log"
 	"github.com/SmartMeshFoundation/Photon/models"
 	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/asdine/storm"
 	"github.com/ethereum/go-ethereum/common"
 )
 
@@ -57,3 +59,39 @@ func (model *StormDB) GetFeeChargeRecordByLockSecretHash(lockSecretHash common.H
 	}
 	return
 }
+
+/*
+IterateFeeChargeRecords calls fn with records match q in the order of time,
+records are read by index of Timestamp one batch by one batch, SortBy, Offset and Limit of q are ignored.
+*/
+func (model *StormDB) IterateFeeChargeRecords(q *models.TransferQuery, fn func(r *models.FeeChargeRecord) error) error {
+	var from, to int64 = 0, math.MaxInt64
+	if !q.FromTime.IsZero() {
+		from = q.FromTime.Unix()
+	}
+	if !q.ToTime.IsZero() {
+		to = q.ToTime.Unix()
+	}
+	for skip := 0; ; skip += iterateBatchSize {
+		var batch []*models.FeeChargerRecordSerialization
+		err := model.db.Range("Timestamp", from, to, &batch, storm.Skip(skip), storm.Limit(iterateBatchSize))
+		if err == storm.ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, rs := range batch {
+			r := rs.ToFeeChargeRecord()
+			if !q.MatchFeeChargeRecord(r) {
+				continue
+			}
+			if err = fn(r); err != nil {
+				return err
+			}
+		}
+		if len(batch) < iterateBatchSize {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package stormdb
+
+import (
+	"fmt"
+
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/asdine/storm"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// AddHoldLockSecretHash :
+func (model *StormDB) AddHoldLockSecretHash(lockSecretHash common.Hash) error {
+	h := &models.HoldLockSecretHash{
+		Key:            lockSecretHash.String(),
+		LockSecretHash: lockSecretHash,
+	}
+	err := model.db.Save(h)
+	if err != nil {
+		err = fmt.Errorf("AddHoldLockSecretHash err %s", err)
+	}
+	return err
+}
+
+// RemoveHoldLockSecretHash : nothing to do if it's not held
+func (model *StormDB) RemoveHoldLockSecretHash(lockSecretHash common.Hash) error {
+	err := model.db.DeleteStruct(&models.HoldLockSecretHash{Key: lockSecretHash.String()})
+	if err == storm.ErrNotFound {
+		err = nil
+	}
+	return err
+}
+
+// GetHoldLockSecretHashList :
+func (model *StormDB) GetHoldLockSecretHashList() (hs []common.Hash, err error) {
+	var l []*models.HoldLockSecretHash
+	err = model.db.All(&l)
+	if err == storm.ErrNotFound {
+		err = nil
+	}
+	for _, h := range l {
+		hs = append(hs, h.LockSecretHash)
+	}
+	return
+}
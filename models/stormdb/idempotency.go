@@ -0,0 +1,73 @@
+package stormdb
+
+import (
+	"fmt"
+
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/asdine/storm"
+)
+
+// NewIdempotencyRecord : save r if its key not exists, in one tx
+func (model *StormDB) NewIdempotencyRecord(r *models.IdempotencyRecord) error {
+	tx, err := model.db.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var old models.IdempotencyRecord
+	err = tx.One("Key", r.Key, &old)
+	if err == nil {
+		return models.ErrIdempotencyKeyExists
+	}
+	if err != storm.ErrNotFound {
+		return err
+	}
+	err = tx.Save(r)
+	if err != nil {
+		return fmt.Errorf("NewIdempotencyRecord err %s", err)
+	}
+	return tx.Commit()
+}
+
+// GetIdempotencyRecord :
+func (model *StormDB) GetIdempotencyRecord(key string) (*models.IdempotencyRecord, error) {
+	var r models.IdempotencyRecord
+	err := model.db.One("Key", key, &r)
+	if err == storm.ErrNotFound {
+		err = fmt.Errorf("idempotency key %s not found", key)
+	}
+	return &r, err
+}
+
+// UpdateIdempotencyRecord :
+func (model *StormDB) UpdateIdempotencyRecord(r *models.IdempotencyRecord) error {
+	err := model.db.Save(r)
+	if err != nil {
+		err = fmt.Errorf("UpdateIdempotencyRecord err %s", err)
+	}
+	return err
+}
+
+// RemoveIdempotencyRecordsBefore : remove records created before createTime
+func (model *StormDB) RemoveIdempotencyRecordsBefore(createTime int64) error {
+	var rs []*models.IdempotencyRecord
+	err := model.db.Range("CreateTime", int64(0), createTime-1, &rs)
+	if err == storm.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	tx, err := model.db.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, r := range rs {
+		err = tx.DeleteStruct(r)
+		if err != nil {
+			return fmt.Errorf("RemoveIdempotencyRecordsBefore err %s", err)
+		}
+	}
+	return tx.Commit()
+}
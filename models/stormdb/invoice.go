@@ -0,0 +1,38 @@
+package stormdb
+
+import (
+	"fmt"
+
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/asdine/storm"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// SaveInvoice : create or update
+func (model *StormDB) SaveInvoice(i *models.Invoice) error {
+	i.Key = i.LockSecretHash.String()
+	err := model.db.Save(i)
+	if err != nil {
+		err = fmt.Errorf("SaveInvoice err %s", err)
+	}
+	return err
+}
+
+// GetInvoice :
+func (model *StormDB) GetInvoice(lockSecretHash common.Hash) (*models.Invoice, error) {
+	var i models.Invoice
+	err := model.db.One("Key", lockSecretHash.String(), &i)
+	if err == storm.ErrNotFound {
+		err = fmt.Errorf("invoice %s not found", lockSecretHash.String())
+	}
+	return &i, err
+}
+
+// GetInvoiceList :
+func (model *StormDB) GetInvoiceList() (is []*models.Invoice, err error) {
+	err = model.db.All(&is)
+	if err == storm.ErrNotFound {
+		err = nil
+	}
+	return
+}
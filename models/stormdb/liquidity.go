@@ -0,0 +1,45 @@
+package stormdb
+
+import (
+	"fmt"
+
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/asdine/storm"
+)
+
+// SaveLiquidityRule : create or update
+func (model *StormDB) SaveLiquidityRule(r *models.LiquidityRule) error {
+	err := model.db.Save(r)
+	if err != nil {
+		err = fmt.Errorf("SaveLiquidityRule err %s", err)
+	}
+	return err
+}
+
+// GetLiquidityRule :
+func (model *StormDB) GetLiquidityRule(key string) (*models.LiquidityRule, error) {
+	var r models.LiquidityRule
+	err := model.db.One("Key", key, &r)
+	if err == storm.ErrNotFound {
+		err = fmt.Errorf("liquidity rule %s not found", key)
+	}
+	return &r, err
+}
+
+// GetAllLiquidityRules :
+func (model *StormDB) GetAllLiquidityRules() (rs []*models.LiquidityRule, err error) {
+	err = model.db.All(&rs)
+	if err == storm.ErrNotFound {
+		err = nil
+	}
+	return
+}
+
+// RemoveLiquidityRule :
+func (model *StormDB) RemoveLiquidityRule(key string) error {
+	err := model.db.DeleteStruct(&models.LiquidityRule{Key: key})
+	if err == storm.ErrNotFound {
+		err = fmt.Errorf("liquidity rule %s not found", key)
+	}
+	return err
+}
@@ -0,0 +1,30 @@
+package stormdb
+
+import (
+	"fmt"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/asdine/storm"
+)
+
+// SaveMediationLimitPolicy :
+func (model *StormDB) SaveMediationLimitPolicy(p *models.MediationLimitPolicy) (err error) {
+	p.Key = models.KeyMediationLimitPolicy
+	err = model.db.Save(p)
+	return
+}
+
+// GetMediationLimitPolicy :
+func (model *StormDB) GetMediationLimitPolicy() (p *models.MediationLimitPolicy) {
+	p = &models.MediationLimitPolicy{}
+	err := model.db.One("Key", models.KeyMediationLimitPolicy, p)
+	if err == storm.ErrNotFound {
+		return models.NewDefaultMediationLimitPolicy()
+	}
+	if err != nil {
+		log.Error(fmt.Sprintf("GetMediationLimitPolicy err %s, use default policy", err))
+		return models.NewDefaultMediationLimitPolicy()
+	}
+	return
+}
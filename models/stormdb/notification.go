@@ -0,0 +1,161 @@
+package stormdb
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/asdine/storm"
+)
+
+// NewNotification : save a notification to outbox, n.Seq must be greater than any saved before
+func (model *StormDB) NewNotification(n *models.Notification) error {
+	tx, err := model.db.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = tx.Save(n)
+	if err != nil {
+		return fmt.Errorf("NewNotification err %s", err)
+	}
+	err = tx.Set(models.BucketNotificationSeq, models.KeyNotificationLastSeq, n.Seq)
+	if err != nil {
+		return fmt.Errorf("NewNotification err %s", err)
+	}
+	// 没有消费者确认时, 只能在这里删除过旧的通知
+	err = model.removeAckedNotifications(tx, n.Seq)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetNotificationsAfter : at most limit notifications not acknowledged whose Seq is greater than seq, order by Seq
+func (model *StormDB) GetNotificationsAfter(seq uint64, limit int) (ns []*models.Notification, err error) {
+	if seq == math.MaxUint64 {
+		return
+	}
+	err = model.db.Range("Seq", seq+1, uint64(math.MaxUint64), &ns, storm.Limit(limit))
+	if err == storm.ErrNotFound {
+		err = nil
+	}
+	return
+}
+
+/*
+AckNotifications : all notifications whose Seq is not greater than seq have been processed by consumer,
+notifications acknowledged by all consumers are removed.
+*/
+func (model *StormDB) AckNotifications(consumer string, seq uint64) error {
+	var c models.NotificationConsumer
+	err := model.db.One("Name", consumer, &c)
+	if err != nil && err != storm.ErrNotFound {
+		return err
+	}
+	if err == nil && c.Cursor >= seq {
+		return nil
+	}
+	tx, err := model.db.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	c.Name = consumer
+	c.Cursor = seq
+	err = tx.Save(&c)
+	if err != nil {
+		return fmt.Errorf("AckNotifications err %s", err)
+	}
+	err = model.removeAckedNotifications(tx, model.GetNotificationLastSeq())
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetNotificationConsumerCursor : notifications not greater than it have been acknowledged by consumer
+func (model *StormDB) GetNotificationConsumerCursor(consumer string) uint64 {
+	var c models.NotificationConsumer
+	err := model.db.One("Name", consumer, &c)
+	if err != nil {
+		if err != storm.ErrNotFound {
+			log.Error(fmt.Sprintf("GetNotificationConsumerCursor err %s", err))
+		}
+		return model.GetNotificationAckedSeq()
+	}
+	return c.Cursor
+}
+
+// RemoveNotificationConsumer : notifications are not kept for this consumer any more
+func (model *StormDB) RemoveNotificationConsumer(consumer string) error {
+	var c models.NotificationConsumer
+	err := model.db.One("Name", consumer, &c)
+	if err != nil {
+		return fmt.Errorf("notification consumer %s not found", consumer)
+	}
+	tx, err := model.db.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = tx.DeleteStruct(&c)
+	if err != nil {
+		return fmt.Errorf("RemoveNotificationConsumer err %s", err)
+	}
+	err = model.removeAckedNotifications(tx, model.GetNotificationLastSeq())
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// removeAckedNotifications remove notifications acknowledged by all consumers, see models.RemovableNotificationSeq
+func (model *StormDB) removeAckedNotifications(tx storm.Node, last uint64) error {
+	var cs []*models.NotificationConsumer
+	err := tx.All(&cs)
+	if err != nil && err != storm.ErrNotFound {
+		return err
+	}
+	seq := models.RemovableNotificationSeq(cs, last)
+	if seq <= model.GetNotificationAckedSeq() {
+		return nil
+	}
+	var ns []*models.Notification
+	err = tx.Range("Seq", uint64(0), seq, &ns)
+	if err != nil && err != storm.ErrNotFound {
+		return err
+	}
+	for _, n := range ns {
+		err = tx.DeleteStruct(n)
+		if err != nil {
+			return fmt.Errorf("AckNotifications err %s", err)
+		}
+	}
+	err = tx.Set(models.BucketNotificationSeq, models.KeyNotificationAckedSeq, seq)
+	if err != nil {
+		return fmt.Errorf("AckNotifications err %s", err)
+	}
+	return nil
+}
+
+// GetNotificationLastSeq : Seq of the latest notification ever saved
+func (model *StormDB) GetNotificationLastSeq() uint64 {
+	var seq uint64
+	err := model.db.Get(models.BucketNotificationSeq, models.KeyNotificationLastSeq, &seq)
+	if err != nil && err != storm.ErrNotFound {
+		log.Error(fmt.Sprintf("GetNotificationLastSeq err %s", err))
+	}
+	return seq
+}
+
+// GetNotificationAckedSeq : all notifications before this Seq (included) have been acknowledged
+func (model *StormDB) GetNotificationAckedSeq() uint64 {
+	var seq uint64
+	err := model.db.Get(models.BucketNotificationSeq, models.KeyNotificationAckedSeq, &seq)
+	if err != nil && err != storm.ErrNotFound {
+		log.Error(fmt.Sprintf("GetNotificationAckedSeq err %s", err))
+	}
+	return seq
+}
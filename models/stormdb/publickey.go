@@ -0,0 +1,29 @@
+package stormdb
+
+import (
+	"fmt"
+
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/asdine/storm"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// SaveNodePublicKey : create or update
+func (model *StormDB) SaveNodePublicKey(pk *models.NodePublicKey) error {
+	pk.Key = pk.Address.String()
+	err := model.db.Save(pk)
+	if err != nil {
+		err = fmt.Errorf("SaveNodePublicKey err %s", err)
+	}
+	return err
+}
+
+// GetNodePublicKey :
+func (model *StormDB) GetNodePublicKey(addr common.Address) (*models.NodePublicKey, error) {
+	var pk models.NodePublicKey
+	err := model.db.One("Key", addr.String(), &pk)
+	if err == storm.ErrNotFound {
+		err = fmt.Errorf("public key of %s not found", addr.String())
+	}
+	return &pk, err
+}
@@ -0,0 +1,38 @@
+package stormdb
+
+import (
+	"fmt"
+
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/asdine/storm"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// SaveTokenMetadata : create or update
+func (model *StormDB) SaveTokenMetadata(m *models.TokenMetadata) error {
+	m.Key = m.TokenAddress.String()
+	err := model.db.Save(m)
+	if err != nil {
+		err = fmt.Errorf("SaveTokenMetadata err %s", err)
+	}
+	return err
+}
+
+// GetTokenMetadata :
+func (model *StormDB) GetTokenMetadata(token common.Address) (*models.TokenMetadata, error) {
+	var m models.TokenMetadata
+	err := model.db.One("Key", token.String(), &m)
+	if err == storm.ErrNotFound {
+		err = fmt.Errorf("metadata of token %s not found", token.String())
+	}
+	return &m, err
+}
+
+// GetAllTokenMetadata :
+func (model *StormDB) GetAllTokenMetadata() (ms []*models.TokenMetadata, err error) {
+	err = model.db.All(&ms)
+	if err == storm.ErrNotFound {
+		err = nil
+	}
+	return
+}
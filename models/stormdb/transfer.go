@@ -11,6 +11,7 @@ import (
 	"github.com/SmartMeshFoundation/Photon/models"
 	"github.com/SmartMeshFoundation/Photon/utils"
 	"github.com/asdine/storm"
+	"github.com/asdine/storm/index"
 	"github.com/ethereum/go-ethereum/common"
 )
 
@@ -18,10 +19,6 @@ import (
 NewSentTransfer save a new sent transfer to db,this transfer must be success
 */
 func (model *StormDB) NewSentTransfer(blockNumber int64, channelIdentifier common.Hash, openBlockNumber int64, tokenAddr, toAddr common.Address, nonce uint64, amount *big.Int, lockSecretHash common.Hash, data string) *models.SentTransfer {
-	if lockSecretHash == utils.EmptyHash {
-		// direct transfer, use fakeLockSecretHash
-		lockSecretHash = utils.NewRandomHash()
-	}
 	key := fmt.Sprintf("%s-%d-%d", channelIdentifier.String(), openBlockNumber, nonce)
 	st := &models.SentTransfer{
 		Key:               key,
@@ -34,6 +31,7 @@ func (model *StormDB) NewSentTransfer(blockNumber int64, channelIdentifier commo
 		Data:              data,
 		OpenBlockNumber:   openBlockNumber,
 		TimeStamp:         time.Now().Format(time.RFC3339),
+		LockSecretHash:    lockSecretHash,
 	}
 	if ost, err := model.GetSentTransfer(key); err == nil {
 		log.Error(fmt.Sprintf("NewSentTransfer, but already exist, old=\n%s,new=\n%s",
@@ -49,10 +47,6 @@ func (model *StormDB) NewSentTransfer(blockNumber int64, channelIdentifier commo
 
 //NewReceivedTransfer save a new received transfer to db
 func (model *StormDB) NewReceivedTransfer(blockNumber int64, channelIdentifier common.Hash, openBlockNumber int64, tokenAddr, fromAddr common.Address, nonce uint64, amount *big.Int, lockSecretHash common.Hash, data string) *models.ReceivedTransfer {
-	if lockSecretHash == utils.EmptyHash {
-		// direct transfer, use fakeLockSecretHash
-		lockSecretHash = utils.NewRandomHash()
-	}
 	key := fmt.Sprintf("%s-%d-%d", channelIdentifier.String(), openBlockNumber, nonce)
 	st := &models.ReceivedTransfer{
 		Key:               key,
@@ -65,6 +59,7 @@ func (model *StormDB) NewReceivedTransfer(blockNumber int64, channelIdentifier c
 		Data:              data,
 		OpenBlockNumber:   openBlockNumber,
 		TimeStamp:         time.Now().Format(time.RFC3339),
+		LockSecretHash:    lockSecretHash,
 	}
 	if ost, err := model.GetReceivedTransfer(key); err == nil {
 		log.Error(fmt.Sprintf("NewReceivedTransfer, but already exist, old=\n%s,new=\n%s",
@@ -143,3 +138,280 @@ func (model *StormDB) GetReceivedTransferInTimeRange(from, to time.Time) (transf
 	}
 	return
 }
+
+/*
+transferTimeRange range of TimeStamp index,
+"9" is greater than any TimeStamp in the format of RFC3339, and less than the key "storm__ids" of index.
+storm.Reverse seeks to the first key not less than to and goes back from there,
+so there must be a key after it, otherwise nothing is found.
+the key found may be greater than to, so transfers got in reverse order must be matched with q again.
+*/
+func transferTimeRange(q *models.TransferQuery) (from, to string) {
+	from, to = q.TimeRange()
+	if to == "" {
+		to = "9"
+	}
+	return
+}
+
+// transferIndexOptions page on index of TimeStamp directly in the order of time
+func transferIndexOptions(q *models.TransferQuery) (options []func(*index.Options)) {
+	if q.Offset > 0 {
+		options = append(options, storm.Skip(q.Offset))
+	}
+	if q.Limit > 0 {
+		options = append(options, storm.Limit(q.Limit))
+	}
+	return
+}
+
+/*
+QuerySentTransfers returns sent transfers match q.
+if there is no filter other than time and in the order of time, page on index of TimeStamp directly.
+otherwise transfers are read one batch by one batch and only matched ones are kept,
+in the order of time reading stops as soon as Offset+Limit transfers matched,
+sorted by amount all matched ones are needed, and they are read by the most selective index of ToAddress, TokenAddress or TimeStamp.
+*/
+func (model *StormDB) QuerySentTransfers(q *models.TransferQuery) (transfers []*models.SentTransfer, err error) {
+	from, to := transferTimeRange(q)
+	if !q.HasFilter() && q.SortByTime() && !q.Desc {
+		err = model.db.Range("TimeStamp", from, to, &transfers, transferIndexOptions(q)...)
+		if err == storm.ErrNotFound {
+			err = nil
+		}
+		return
+	}
+	if !q.SortByTime() {
+		err = model.eachSentTransfer(q, func(options ...func(*index.Options)) (batch []*models.SentTransfer, err error) {
+			if q.Partner != utils.EmptyAddress {
+				err = model.db.Find("ToAddress", q.Partner, &batch, options...)
+			} else if q.TokenAddress != utils.EmptyAddress {
+				err = model.db.Find("TokenAddress", q.TokenAddress, &batch, options...)
+			} else {
+				err = model.db.Range("TimeStamp", from, to, &batch, options...)
+			}
+			return
+		}, func(st *models.SentTransfer) bool {
+			transfers = append(transfers, st)
+			return true
+		})
+		if err != nil {
+			return
+		}
+		transfers = q.SortAndPageSentTransfers(transfers)
+		return
+	}
+	offset, matched := pageOffset(q), 0
+	err = model.eachSentTransfer(q, func(options ...func(*index.Options)) (batch []*models.SentTransfer, err error) {
+		if q.Desc {
+			options = append(options, storm.Reverse())
+		}
+		err = model.db.Range("TimeStamp", from, to, &batch, options...)
+		return
+	}, func(st *models.SentTransfer) bool {
+		matched++
+		if matched > offset {
+			transfers = append(transfers, st)
+		}
+		return q.Limit <= 0 || matched < offset+q.Limit
+	})
+	return
+}
+
+/*
+QueryReceivedTransfers returns received transfers match q.
+if there is no filter other than time and in the order of time, page on index of TimeStamp directly.
+otherwise transfers are read one batch by one batch and only matched ones are kept,
+in the order of time reading stops as soon as Offset+Limit transfers matched,
+sorted by amount all matched ones are needed, and they are read by the most selective index of FromAddress, TokenAddress or TimeStamp.
+*/
+func (model *StormDB) QueryReceivedTransfers(q *models.TransferQuery) (transfers []*models.ReceivedTransfer, err error) {
+	from, to := transferTimeRange(q)
+	if !q.HasFilter() && q.SortByTime() && !q.Desc {
+		err = model.db.Range("TimeStamp", from, to, &transfers, transferIndexOptions(q)...)
+		if err == storm.ErrNotFound {
+			err = nil
+		}
+		return
+	}
+	if !q.SortByTime() {
+		err = model.eachReceivedTransfer(q, func(options ...func(*index.Options)) (batch []*models.ReceivedTransfer, err error) {
+			if q.Partner != utils.EmptyAddress {
+				err = model.db.Find("FromAddress", q.Partner, &batch, options...)
+			} else if q.TokenAddress != utils.EmptyAddress {
+				err = model.db.Find("TokenAddress", q.TokenAddress, &batch, options...)
+			} else {
+				err = model.db.Range("TimeStamp", from, to, &batch, options...)
+			}
+			return
+		}, func(rt *models.ReceivedTransfer) bool {
+			transfers = append(transfers, rt)
+			return true
+		})
+		if err != nil {
+			return
+		}
+		transfers = q.SortAndPageReceivedTransfers(transfers)
+		return
+	}
+	offset, matched := pageOffset(q), 0
+	err = model.eachReceivedTransfer(q, func(options ...func(*index.Options)) (batch []*models.ReceivedTransfer, err error) {
+		if q.Desc {
+			options = append(options, storm.Reverse())
+		}
+		err = model.db.Range("TimeStamp", from, to, &batch, options...)
+		return
+	}, func(rt *models.ReceivedTransfer) bool {
+		matched++
+		if matched > offset {
+			transfers = append(transfers, rt)
+		}
+		return q.Limit <= 0 || matched < offset+q.Limit
+	})
+	return
+}
+
+func pageOffset(q *models.TransferQuery) int {
+	if q.Offset < 0 {
+		return 0
+	}
+	return q.Offset
+}
+
+/*
+eachSentTransfer calls fn with sent transfers match q until it returns false,
+read gets one batch with options of skip and limit.
+*/
+func (model *StormDB) eachSentTransfer(q *models.TransferQuery, read func(options ...func(*index.Options)) ([]*models.SentTransfer, error), fn func(st *models.SentTransfer) bool) error {
+	for skip := 0; ; skip += iterateBatchSize {
+		batch, err := read(storm.Skip(skip), storm.Limit(iterateBatchSize))
+		if err == storm.ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, st := range batch {
+			if q.MatchSentTransfer(st) && !fn(st) {
+				return nil
+			}
+		}
+		if len(batch) < iterateBatchSize {
+			return nil
+		}
+	}
+}
+
+/*
+eachReceivedTransfer calls fn with received transfers match q until it returns false,
+read gets one batch with options of skip and limit.
+*/
+func (model *StormDB) eachReceivedTransfer(q *models.TransferQuery, read func(options ...func(*index.Options)) ([]*models.ReceivedTransfer, error), fn func(rt *models.ReceivedTransfer) bool) error {
+	for skip := 0; ; skip += iterateBatchSize {
+		batch, err := read(storm.Skip(skip), storm.Limit(iterateBatchSize))
+		if err == storm.ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, rt := range batch {
+			if q.MatchReceivedTransfer(rt) && !fn(rt) {
+				return nil
+			}
+		}
+		if len(batch) < iterateBatchSize {
+			return nil
+		}
+	}
+}
+
+/*
+reIndexTransfers build indexes of transfers and fee charge records saved by older version,
+storm only updates indexes when a record is saved.
+*/
+func (model *StormDB) reIndexTransfers() error {
+	var ver int
+	err := model.db.Get(models.BucketMeta, models.KeyTransferIndex, &ver)
+	if err != nil && err != storm.ErrNotFound {
+		return err
+	}
+	if ver == models.TransferIndexVersion {
+		return nil
+	}
+	log.Info(fmt.Sprintf("rebuild index of transfers from version %d to %d", ver, models.TransferIndexVersion))
+	err = model.db.ReIndex(&models.SentTransfer{})
+	if err != nil {
+		return err
+	}
+	err = model.db.ReIndex(&models.ReceivedTransfer{})
+	if err != nil {
+		return err
+	}
+	err = model.db.ReIndex(&models.FeeChargerRecordSerialization{})
+	if err != nil {
+		return err
+	}
+	return model.db.Set(models.BucketMeta, models.KeyTransferIndex, models.TransferIndexVersion)
+}
+
+// 遍历时每次从数据库读取的记录数
+const iterateBatchSize = 1000
+
+/*
+IterateSentTransfers calls fn with sent transfers match q in the order of time,
+transfers are read by index of TimeStamp one batch by one batch, SortBy, Offset and Limit of q are ignored.
+*/
+func (model *StormDB) IterateSentTransfers(q *models.TransferQuery, fn func(st *models.SentTransfer) error) error {
+	from, to := transferTimeRange(q)
+	for skip := 0; ; skip += iterateBatchSize {
+		var batch []*models.SentTransfer
+		err := model.db.Range("TimeStamp", from, to, &batch, storm.Skip(skip), storm.Limit(iterateBatchSize))
+		if err == storm.ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, st := range batch {
+			if !q.MatchSentTransfer(st) {
+				continue
+			}
+			if err = fn(st); err != nil {
+				return err
+			}
+		}
+		if len(batch) < iterateBatchSize {
+			return nil
+		}
+	}
+}
+
+/*
+IterateReceivedTransfers calls fn with received transfers match q in the order of time,
+transfers are read by index of TimeStamp one batch by one batch, SortBy, Offset and Limit of q are ignored.
+*/
+func (model *StormDB) IterateReceivedTransfers(q *models.TransferQuery, fn func(rt *models.ReceivedTransfer) error) error {
+	from, to := transferTimeRange(q)
+	for skip := 0; ; skip += iterateBatchSize {
+		var batch []*models.ReceivedTransfer
+		err := model.db.Range("TimeStamp", from, to, &batch, storm.Skip(skip), storm.Limit(iterateBatchSize))
+		if err == storm.ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, rt := range batch {
+			if !q.MatchReceivedTransfer(rt) {
+				continue
+			}
+			if err = fn(rt); err != nil {
+				return err
+			}
+		}
+		if len(batch) < iterateBatchSize {
+			return nil
+		}
+	}
+}
@@ -70,6 +70,27 @@ func (model *StormDB) UpdateTransferStatusMessage(tokenAddress common.Address, l
 	log.Trace(fmt.Sprintf("UpdateTransferStatusMessage key=%s lockSecretHash=%s %s", key, lockSecretHash.String(), statusMessage))
 }
 
+// UpdateTransferStatusParts : progress of each part of a multi-path transfer
+func (model *StormDB) UpdateTransferStatusParts(tokenAddress common.Address, lockSecretHash common.Hash, parts []*models.TransferPartStatus) {
+	var ts models.TransferStatus
+	key := utils.Sha3(tokenAddress[:], lockSecretHash[:]).String()
+	err := model.db.One("Key", key, &ts)
+	if err == storm.ErrNotFound {
+		return
+	}
+	if err != nil {
+		log.Error(fmt.Sprintf("UpdateTransferStatusParts err %s", err))
+		return
+	}
+	ts.Parts = parts
+	err = model.db.Save(&ts)
+	if err != nil {
+		log.Error(fmt.Sprintf("UpdateTransferStatusParts err %s", err))
+		return
+	}
+	log.Trace(fmt.Sprintf("UpdateTransferStatusParts key=%s lockSecretHash=%s parts=%d", key, lockSecretHash.String(), len(parts)))
+}
+
 // GetTransferStatus :
 func (model *StormDB) GetTransferStatus(tokenAddress common.Address, lockSecretHash common.Hash) (*models.TransferStatus, error) {
 	var ts models.TransferStatus
@@ -0,0 +1,47 @@
+package stormdb
+
+import (
+	"fmt"
+
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/asdine/storm"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// SaveDelegation : create or update
+func (model *StormDB) SaveDelegation(d *models.Delegation) error {
+	d.Key = d.ChannelIdentifier.String()
+	err := model.db.Save(d)
+	if err != nil {
+		err = fmt.Errorf("SaveDelegation err %s", err)
+	}
+	return err
+}
+
+// GetDelegation :
+func (model *StormDB) GetDelegation(channelIdentifier common.Hash) (*models.Delegation, error) {
+	var d models.Delegation
+	err := model.db.One("Key", channelIdentifier.String(), &d)
+	if err == storm.ErrNotFound {
+		err = fmt.Errorf("delegation of channel %s not found", channelIdentifier.String())
+	}
+	return &d, err
+}
+
+// GetAllDelegations :
+func (model *StormDB) GetAllDelegations() (ds []*models.Delegation, err error) {
+	err = model.db.All(&ds)
+	if err == storm.ErrNotFound {
+		err = nil
+	}
+	return
+}
+
+// RemoveDelegation :
+func (model *StormDB) RemoveDelegation(channelIdentifier common.Hash) error {
+	err := model.db.DeleteStruct(&models.Delegation{Key: channelIdentifier.String()})
+	if err == storm.ErrNotFound {
+		err = fmt.Errorf("delegation of channel %s not found", channelIdentifier.String())
+	}
+	return err
+}
@@ -0,0 +1,58 @@
+package stormdb
+
+import (
+	"fmt"
+
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/asdine/storm"
+)
+
+// SaveWebhook : add or update a webhook
+func (model *StormDB) SaveWebhook(w *models.Webhook) error {
+	err := model.db.Save(w)
+	if err != nil {
+		err = fmt.Errorf("SaveWebhook err %s", err)
+	}
+	return err
+}
+
+// RemoveWebhook :
+func (model *StormDB) RemoveWebhook(id string) error {
+	err := model.db.DeleteStruct(&models.Webhook{ID: id})
+	if err == storm.ErrNotFound {
+		err = fmt.Errorf("webhook %s not found", id)
+	}
+	return err
+}
+
+// GetAllWebhooks :
+func (model *StormDB) GetAllWebhooks() (ws []*models.Webhook, err error) {
+	err = model.db.All(&ws)
+	if err == storm.ErrNotFound {
+		err = nil
+	}
+	return
+}
+
+// SaveWebhookDelivery : add or update a delivery
+func (model *StormDB) SaveWebhookDelivery(d *models.WebhookDelivery) error {
+	err := model.db.Save(d)
+	if err != nil {
+		err = fmt.Errorf("SaveWebhookDelivery err %s", err)
+	}
+	return err
+}
+
+// RemoveWebhookDelivery :
+func (model *StormDB) RemoveWebhookDelivery(key string) error {
+	return model.db.DeleteStruct(&models.WebhookDelivery{Key: key})
+}
+
+// GetAllWebhookDeliveries : deliveries pending or failed
+func (model *StormDB) GetAllWebhookDeliveries() (ds []*models.WebhookDelivery, err error) {
+	err = model.db.All(&ds)
+	if err == storm.ErrNotFound {
+		err = nil
+	}
+	return
+}
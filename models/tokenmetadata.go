@@ -0,0 +1,37 @@
+package models
+
+import (
+	"encoding/gob"
+	"math/big"
+
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+TokenMetadata :
+symbol, name and decimals of an ERC20 token, read from token contract and cached.
+name and symbol are optional in ERC20, they are empty if token doesn't implement them.
+*/
+type TokenMetadata struct {
+	Key          string         `json:"-" storm:"id"`
+	TokenAddress common.Address `json:"token_address"`
+	Symbol       string         `json:"symbol"`
+	Name         string         `json:"name"`
+	Decimals     uint8          `json:"decimals"`
+	UpdateTime   int64          `json:"update_time"`
+}
+
+// FormatAmount amount in decimals of this token, like 1.25
+func (m *TokenMetadata) FormatAmount(amount *big.Int) string {
+	return utils.FormatAmount(amount, m.Decimals)
+}
+
+// ParseAmount parse amount like 1.25 to raw integer amount
+func (m *TokenMetadata) ParseAmount(s string) (*big.Int, error) {
+	return utils.ParseAmount(s, m.Decimals)
+}
+
+func init() {
+	gob.Register(&TokenMetadata{})
+}
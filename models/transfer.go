@@ -13,12 +13,13 @@ type SentTransfer struct {
 	BlockNumber       int64          `json:"block_number" storm:"index"`
 	OpenBlockNumber   int64          `json:"open_block_number"`
 	ChannelIdentifier common.Hash    `json:"channel_identifier"`
-	ToAddress         common.Address `json:"to_address"`
-	TokenAddress      common.Address `json:"token_address"`
+	ToAddress         common.Address `json:"to_address" storm:"index"`
+	TokenAddress      common.Address `json:"token_address" storm:"index"`
 	Nonce             uint64         `json:"nonce"`
 	Amount            *big.Int       `json:"amount"`
 	Data              string         `json:"data"`
-	TimeStamp         string         `json:"time_stamp"`
+	TimeStamp         string         `json:"time_stamp" storm:"index"`
+	LockSecretHash    common.Hash    `json:"lock_secret_hash"` // 直接交易为空
 }
 
 //ReceivedTransfer tokens I have received and where it comes from
@@ -27,12 +28,13 @@ type ReceivedTransfer struct {
 	BlockNumber       int64  `json:"block_number" storm:"index"`
 	OpenBlockNumber   int64
 	ChannelIdentifier common.Hash    `json:"channel_identifier"`
-	TokenAddress      common.Address `json:"token_address"`
-	FromAddress       common.Address `json:"from_address"`
+	TokenAddress      common.Address `json:"token_address" storm:"index"`
+	FromAddress       common.Address `json:"from_address" storm:"index"`
 	Nonce             uint64         `json:"nonce"`
 	Amount            *big.Int       `json:"amount"`
 	Data              string         `json:"data"`
-	TimeStamp         string         `json:"time_stamp"`
+	TimeStamp         string         `json:"time_stamp" storm:"index"`
+	LockSecretHash    common.Hash    `json:"lock_secret_hash"` // 直接交易为空
 }
 
 func init() {
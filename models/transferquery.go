@@ -0,0 +1,206 @@
+package models
+
+import (
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// TransferSortBy :
+type TransferSortBy string
+
+const (
+	// TransferSortByTime order by the time transfer saved, it's the default order
+	TransferSortByTime TransferSortBy = "time"
+	// TransferSortByAmount order by amount
+	TransferSortByAmount TransferSortBy = "amount"
+)
+
+/*
+TransferQuery :
+conditions of querying sent or received transfers,
+empty value means no filter on it.
+Partner is ToAddress of sent transfers and FromAddress of received transfers.
+Data matches transfers whose Data contains it.
+Limit <= 0 means no limit.
+*/
+type TransferQuery struct {
+	TokenAddress common.Address
+	Partner      common.Address
+	MinAmount    *big.Int
+	MaxAmount    *big.Int
+	FromTime     time.Time
+	ToTime       time.Time
+	FromBlock    int64 // < 0 means no limit
+	ToBlock      int64 // < 0 means no limit
+	Data         string
+	SortBy       TransferSortBy
+	Desc         bool
+	Offset       int
+	Limit        int
+}
+
+// NewTransferQuery a query without any filter
+func NewTransferQuery() *TransferQuery {
+	return &TransferQuery{
+		FromBlock: -1,
+		ToBlock:   -1,
+		SortBy:    TransferSortByTime,
+	}
+}
+
+/*
+HasFilter is there any condition which cannot be answered by index of time?
+if not, offset and limit can be applied to index directly.
+*/
+func (q *TransferQuery) HasFilter() bool {
+	return q.TokenAddress != utils.EmptyAddress || q.Partner != utils.EmptyAddress ||
+		q.MinAmount != nil || q.MaxAmount != nil || q.FromBlock >= 0 || q.ToBlock >= 0 || q.Data != ""
+}
+
+// SortByTime results are in the order of time?
+func (q *TransferQuery) SortByTime() bool {
+	return q.SortBy == "" || q.SortBy == TransferSortByTime
+}
+
+// TimeRange time range in the format of TimeStamp of transfers, empty means no limit
+func (q *TransferQuery) TimeRange() (from, to string) {
+	if !q.FromTime.IsZero() {
+		from = q.FromTime.Local().Format(time.RFC3339)
+	}
+	if !q.ToTime.IsZero() {
+		to = q.ToTime.Local().Format(time.RFC3339)
+	}
+	return
+}
+
+func (q *TransferQuery) match(token, partner common.Address, amount *big.Int, blockNumber int64, timeStamp, data string) bool {
+	if q.TokenAddress != utils.EmptyAddress && q.TokenAddress != token {
+		return false
+	}
+	if q.Partner != utils.EmptyAddress && q.Partner != partner {
+		return false
+	}
+	if amount == nil {
+		amount = big.NewInt(0)
+	}
+	if q.MinAmount != nil && amount.Cmp(q.MinAmount) < 0 {
+		return false
+	}
+	if q.MaxAmount != nil && amount.Cmp(q.MaxAmount) > 0 {
+		return false
+	}
+	if q.FromBlock >= 0 && blockNumber < q.FromBlock {
+		return false
+	}
+	if q.ToBlock >= 0 && blockNumber > q.ToBlock {
+		return false
+	}
+	if !q.FromTime.IsZero() || !q.ToTime.IsZero() {
+		t, err := time.Parse(time.RFC3339, timeStamp)
+		if err != nil {
+			return false
+		}
+		if !q.FromTime.IsZero() && t.Before(q.FromTime.Truncate(time.Second)) {
+			return false
+		}
+		if !q.ToTime.IsZero() && t.After(q.ToTime) {
+			return false
+		}
+	}
+	if q.Data != "" && !strings.Contains(data, q.Data) {
+		return false
+	}
+	return true
+}
+
+// MatchSentTransfer does st satisfy all conditions?
+func (q *TransferQuery) MatchSentTransfer(st *SentTransfer) bool {
+	return q.match(st.TokenAddress, st.ToAddress, st.Amount, st.BlockNumber, st.TimeStamp, st.Data)
+}
+
+// MatchReceivedTransfer does rt satisfy all conditions?
+func (q *TransferQuery) MatchReceivedTransfer(rt *ReceivedTransfer) bool {
+	return q.match(rt.TokenAddress, rt.FromAddress, rt.Amount, rt.BlockNumber, rt.TimeStamp, rt.Data)
+}
+
+/*
+MatchFeeChargeRecord does r satisfy all conditions?
+Partner matches both sides of the mediated transfer, Amount is TransferAmount.
+*/
+func (q *TransferQuery) MatchFeeChargeRecord(r *FeeChargeRecord) bool {
+	partner := r.TransferFrom
+	if q.Partner == r.TransferTo {
+		partner = r.TransferTo
+	}
+	return q.match(r.TokenAddress, partner, r.TransferAmount, r.BlockNumber, time.Unix(r.Timestamp, 0).Format(time.RFC3339), "")
+}
+
+// Page returns [start,end) of the page specified by Offset and Limit in n results
+func (q *TransferQuery) Page(n int) (start, end int) {
+	start = q.Offset
+	if start < 0 {
+		start = 0
+	}
+	if start > n {
+		start = n
+	}
+	end = n
+	if q.Limit > 0 && start+q.Limit < n {
+		end = start + q.Limit
+	}
+	return
+}
+
+func (q *TransferQuery) less(amount1, amount2 *big.Int, timeStamp1, timeStamp2 string) bool {
+	if !q.SortByTime() {
+		if amount1 == nil {
+			amount1 = big.NewInt(0)
+		}
+		if amount2 == nil {
+			amount2 = big.NewInt(0)
+		}
+		if c := amount1.Cmp(amount2); c != 0 {
+			return c < 0
+		}
+	}
+	return timeStamp1 < timeStamp2
+}
+
+/*
+SortAndPageSentTransfers sort transfers matched by q and returns the page specified by Offset and Limit.
+transfers of the same time keep their order.
+*/
+func (q *TransferQuery) SortAndPageSentTransfers(transfers []*SentTransfer) []*SentTransfer {
+	sort.SliceStable(transfers, func(i, j int) bool {
+		return q.less(transfers[i].Amount, transfers[j].Amount, transfers[i].TimeStamp, transfers[j].TimeStamp)
+	})
+	if q.Desc {
+		for i, j := 0, len(transfers)-1; i < j; i, j = i+1, j-1 {
+			transfers[i], transfers[j] = transfers[j], transfers[i]
+		}
+	}
+	start, end := q.Page(len(transfers))
+	return transfers[start:end]
+}
+
+/*
+SortAndPageReceivedTransfers sort transfers matched by q and returns the page specified by Offset and Limit.
+transfers of the same time keep their order.
+*/
+func (q *TransferQuery) SortAndPageReceivedTransfers(transfers []*ReceivedTransfer) []*ReceivedTransfer {
+	sort.SliceStable(transfers, func(i, j int) bool {
+		return q.less(transfers[i].Amount, transfers[j].Amount, transfers[i].TimeStamp, transfers[j].TimeStamp)
+	})
+	if q.Desc {
+		for i, j := 0, len(transfers)-1; i < j; i, j = i+1, j-1 {
+			transfers[i], transfers[j] = transfers[j], transfers[i]
+		}
+	}
+	start, end := q.Page(len(transfers))
+	return transfers[start:end]
+}
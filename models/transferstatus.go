@@ -2,6 +2,7 @@ package models
 
 import (
 	"encoding/gob"
+	"math/big"
 
 	"github.com/ethereum/go-ethereum/common"
 )
@@ -42,8 +43,22 @@ type TransferStatus struct {
 	TokenAddress   common.Address
 	Status         TransferStatusCode
 	StatusMessage  string
+	Parts          []*TransferPartStatus `json:",omitempty"` // only for multi-path transfer
+}
+
+/*
+TransferPartStatus :
+	progress of one part of a multi-path transfer
+*/
+type TransferPartStatus struct {
+	ChannelIdentifier common.Hash
+	Partner           common.Address
+	Amount            *big.Int
+	Fee               *big.Int
+	Status            string // pending,secret_revealed,unlocked or failed
 }
 
 func init() {
 	gob.Register(&TransferStatus{})
+	gob.Register(&TransferPartStatus{})
 }
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"encoding/gob"
+	"math/big"
+
+	"github.com/SmartMeshFoundation/Photon/transfer/mtree"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	// DelegationWatching channel is open, waiting for close
+	DelegationWatching = "watching"
+	// DelegationClosed partner closed the channel, waiting for the second half of settle window to update balance proof
+	DelegationClosed = "closed"
+	// DelegationFinished all on-chain transactions have been sent, or nothing need to do
+	DelegationFinished = "finished"
+	// DelegationSettled channel has been settled
+	DelegationSettled = "settled"
+)
+
+// DelegationUpdateTransfer balance proof of partner, signed by partner and delegator
+type DelegationUpdateTransfer struct {
+	Nonce               uint64      `json:"nonce"`
+	TransferAmount      *big.Int    `json:"transfer_amount"`
+	Locksroot           common.Hash `json:"locksroot"`
+	ExtraHash           common.Hash `json:"extra_hash"`
+	ClosingSignature    []byte      `json:"closing_signature"`
+	NonClosingSignature []byte      `json:"non_closing_signature"`
+}
+
+// DelegationUnlock lock of partner whose secret is known by delegator
+type DelegationUnlock struct {
+	Lock        *mtree.Lock `json:"lock"`
+	MerkleProof []byte      `json:"merkle_proof"`
+	Secret      common.Hash `json:"secret"`
+	Signature   []byte      `json:"signature"`
+}
+
+/*
+Delegation :
+a channel of Delegator and PartnerAddress watched by us.
+When PartnerAddress closes the channel with a stale balance proof,
+we call updateBalanceProofDelegate and unlockDelegate for Delegator before settle.
+It's the same as information given by `/api/1/thirdparty/`, with delegator.
+*/
+type Delegation struct {
+	Key               string                   `json:"-" storm:"id"`
+	ChannelIdentifier common.Hash              `json:"channel_identifier"`
+	OpenBlockNumber   int64                    `json:"open_block_number"`
+	TokenAddress      common.Address           `json:"token_address"`
+	Delegator         common.Address           `json:"delegator"`
+	PartnerAddress    common.Address           `json:"partner_address"`
+	UpdateTransfer    DelegationUpdateTransfer `json:"update_transfer"`
+	Unlocks           []*DelegationUnlock      `json:"unlocks"`
+	SettleTimeout     int64                    `json:"settle_timeout"`
+	Status            string                   `json:"status"`
+	ClosingAddress    common.Address           `json:"closing_address,omitempty"`
+	ClosedBlock       int64                    `json:"closed_block,omitempty"`
+	BalanceProofSent  bool                     `json:"balance_proof_sent"`
+	UnlockedLocks     []common.Hash            `json:"unlocked_locks,omitempty"` // lock secret hash of unlocked locks
+	Error             string                   `json:"error,omitempty"`
+	UpdateTime        int64                    `json:"update_time"`
+}
+
+// SettleBlock settle can be called after this block, delegated update must be called before it
+func (d *Delegation) SettleBlock() int64 {
+	return d.ClosedBlock + d.SettleTimeout
+}
+
+// UpdateStartBlock delegated update can only be called in the second half of settle window
+func (d *Delegation) UpdateStartBlock() int64 {
+	return d.SettleBlock() - d.SettleTimeout/2
+}
+
+func init() {
+	gob.Register(&Delegation{})
+}
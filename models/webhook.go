@@ -0,0 +1,54 @@
+package models
+
+import (
+	"encoding/gob"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+Webhook :
+an http url which events are posted to.
+empty EventTypes, Tokens or Partners means no filter on it.
+*/
+type Webhook struct {
+	ID         string           `json:"id" storm:"id"`
+	URL        string           `json:"url"`
+	Secret     string           `json:"secret,omitempty"` // key of hmac signature
+	EventTypes []string         `json:"event_types"`
+	Tokens     []common.Address `json:"tokens"`
+	Partners   []common.Address `json:"partners"`
+	CreateTime int64            `json:"create_time"`
+}
+
+// WebhookDeliveryStatus :
+type WebhookDeliveryStatus int
+
+const (
+	// WebhookDeliveryPending waiting for sending or retry
+	WebhookDeliveryPending WebhookDeliveryStatus = iota
+	// WebhookDeliveryFailed give up after too many attempts
+	WebhookDeliveryFailed
+)
+
+/*
+WebhookDelivery :
+one event waiting to post to a webhook,
+it's removed after delivered.
+*/
+type WebhookDelivery struct {
+	Key         string                `json:"key" storm:"id"`
+	WebhookID   string                `json:"webhook_id"`
+	EventID     uint64                `json:"event_id"`
+	EventType   string                `json:"event_type"`
+	Payload     []byte                `json:"-"`
+	Attempts    int                   `json:"attempts"`
+	NextAttempt int64                 `json:"next_attempt"`
+	LastError   string                `json:"last_error"`
+	Status      WebhookDeliveryStatus `json:"status"`
+}
+
+func init() {
+	gob.Register(&Webhook{})
+	gob.Register(&WebhookDelivery{})
+}
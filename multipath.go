@@ -0,0 +1,269 @@
+package photon
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/SmartMeshFoundation/Photon/channel"
+	"github.com/SmartMeshFoundation/Photon/encoding"
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/network/graph"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/transfer"
+	"github.com/SmartMeshFoundation/Photon/transfer/mediatedtransfer"
+	"github.com/SmartMeshFoundation/Photon/transfer/mediatedtransfer/initiator"
+	"github.com/SmartMeshFoundation/Photon/transfer/route"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+multiPathTransfer 多路径支付, 一个通道的余额不够时把交易分成几个部分从不同的通道发出:
+ 1. 按照可用余额从大到小依次使用我的通道, 每个通道最多一个部分, 第一跳各不相同
+ 2. 各部分的路径除了接收方以外没有相同的节点, 没有 PFS 时中间节点仍然可能选择其他路径而相遇,
+    这时候中间节点从不同的通道转出每个部分, 接收方也从不同的通道收到各部分
+ 3. 所有部分使用同一个密码, 接收方收齐以后才会请求密码, 要么都成功要么都失败
+*/
+func (rs *Service) multiPathTransfer(req *multiPathTransferReq) (result *utils.AsyncResult) {
+	result = utils.NewAsyncResult()
+	if rs.Config.IsMeshNetwork {
+		result.Result <- errors.New("no mediated transfer on mesh only network")
+		return
+	}
+	routes, amounts, err := rs.splitMultiPath(req.TokenAddress, req.Target, req.Amount, req.MaxParts)
+	if err != nil {
+		result.Result <- err
+		return
+	}
+	secret := utils.NewRandomHash()
+	lockSecretHash := utils.ShaSecret(secret[:])
+	result.LockSecretHash = lockSecretHash
+	rs.dao.NewTransferStatus(req.TokenAddress, lockSecretHash)
+	blockNumber := rs.GetBlockNumber()
+	transferState := &mediatedtransfer.LockedTransferState{
+		TargetAmount:   new(big.Int).Set(req.Amount),
+		Amount:         new(big.Int).Set(req.Amount),
+		Token:          req.TokenAddress,
+		Initiator:      rs.NodeAddress,
+		Target:         req.Target,
+		LockSecretHash: lockSecretHash,
+		Secret:         secret,
+		Fee:            utils.BigInt0,
+		Data:           req.Data,
+		TotalAmount:    new(big.Int).Set(req.Amount),
+	}
+	initMultiPath := &mediatedtransfer.ActionInitMultiPathInitiatorStateChange{
+		OurAddress:     rs.NodeAddress,
+		Transfer:       transferState,
+		BlockNumber:    blockNumber,
+		LockSecretHash: lockSecretHash,
+		Secret:         secret,
+	}
+	for i, r := range routes {
+		partState := *transferState
+		partState.TargetAmount = amounts[i]
+		partState.Amount = amounts[i]
+		initMultiPath.Parts = append(initMultiPath.Parts, &mediatedtransfer.ActionInitInitiatorStateChange{
+			OurAddress:     rs.NodeAddress,
+			Tranfer:        &partState,
+			Routes:         route.NewRoutesState([]*route.State{r}),
+			BlockNumber:    blockNumber,
+			Db:             rs.dao,
+			LockSecretHash: lockSecretHash,
+			Secret:         secret,
+		})
+	}
+	log.Info(fmt.Sprintf("multi-path transfer %s to %s amount=%s in %d parts", utils.HPex(lockSecretHash), utils.APex2(req.Target), req.Amount, len(routes)))
+	stateManager := transfer.NewStateManager(initiator.StateTransition, nil, initiator.NameInitiatorTransition, lockSecretHash, req.TokenAddress)
+	smkey := utils.Sha3(lockSecretHash[:], req.TokenAddress[:])
+	rs.Transfer2StateManager[smkey] = stateManager
+	rs.Transfer2Result[smkey] = result
+	rs.StateMachineEventHandler.dispatch(stateManager, initMultiPath)
+	return
+}
+
+/*
+splitMultiPath 把 amount 分配到最多 maxParts 个通道上,
+每个部分的手续费也从这个部分的通道支付, 余额不够手续费的时候减少这个部分的金额.
+*/
+func (rs *Service) splitMultiPath(token, target common.Address, amount *big.Int, maxParts int) (routes []*route.State, amounts []*big.Int, err error) {
+	g := rs.getToken2ChannelGraph(token)
+	if g == nil {
+		return nil, nil, errors.New("token not exist")
+	}
+	var chs []*channel.Channel
+	for partner, c := range g.PartenerAddress2Channel {
+		if !c.CanTransfer() || c.Distributable().Cmp(utils.BigInt0) <= 0 {
+			continue
+		}
+		if _, isOnline := rs.Protocol.GetNetworkStatus(partner); !isOnline {
+			continue
+		}
+		chs = append(chs, c)
+	}
+	sort.Slice(chs, func(i, j int) bool {
+		return chs[i].Distributable().Cmp(chs[j].Distributable()) > 0
+	})
+	used := make(map[common.Address]bool) //其他部分路径上的节点
+	left := new(big.Int).Set(amount)
+	for _, c := range chs {
+		if len(routes) >= maxParts || left.Cmp(utils.BigInt0) == 0 {
+			break
+		}
+		part := new(big.Int).Set(left)
+		if part.Cmp(c.Distributable()) > 0 {
+			part.Set(c.Distributable())
+		}
+		r, nodes := rs.multiPathRoute(g, target, c.PartnerState.Address, part, used)
+		if r != nil && r.AvailableBalance().Cmp(new(big.Int).Add(part, r.TotalFee)) < 0 {
+			part.Sub(r.AvailableBalance(), r.TotalFee)
+			r = nil
+			if part.Cmp(utils.BigInt0) > 0 {
+				r, nodes = rs.multiPathRoute(g, target, c.PartnerState.Address, part, used)
+			}
+		}
+		if r == nil || r.AvailableBalance().Cmp(new(big.Int).Add(part, r.TotalFee)) < 0 {
+			continue
+		}
+		for _, n := range nodes {
+			used[n] = true
+		}
+		routes = append(routes, r)
+		amounts = append(amounts, part)
+		left.Sub(left, part)
+	}
+	if left.Cmp(utils.BigInt0) > 0 {
+		log.Info(fmt.Sprintf("multi-path transfer to %s amount=%s, %s left after %d parts", utils.APex2(target), amount, left, len(routes)))
+		return nil, nil, rerr.ErrInsufficientBalance
+	}
+	return
+}
+
+/*
+multiPathRoute 从 partner 出发到 target 的路由,
+返回的 nodes 是这条路径上的中间节点, 不能和其他部分的路径有相同的节点.
+有 PFS 时路径来自 PFS, 没有的时候来自本地的 ChannelGraph.
+*/
+func (rs *Service) multiPathRoute(g *graph.ChannelGraph, target, partner common.Address, amount *big.Int, used map[common.Address]bool) (r *route.State, nodes []common.Address) {
+	if used[partner] {
+		return
+	}
+	if rs.PfsProxy == nil {
+		//只允许从 partner 出去
+		exclude := make(map[common.Address]bool)
+		for p := range g.PartenerAddress2Channel {
+			if p != partner {
+				exclude[p] = true
+			}
+		}
+		routes := g.GetBestRoutes(rs.Protocol, rs.NodeAddress, target, amount, amount, exclude, rs)
+		if len(routes) == 0 {
+			return
+		}
+		/*
+			中间节点自己选择下一跳,这里只能按照我知道的拓扑选择最短路径不相交的部分,
+			即使几个部分在某个中间节点相遇,它也会从不同的通道转出各个部分
+		*/
+		path, err := g.ShortestPathNodes(partner, target, amount, rs)
+		if err != nil {
+			return
+		}
+		for _, n := range path {
+			if n == target || n == rs.NodeAddress {
+				continue
+			}
+			if used[n] {
+				return nil, nil
+			}
+			nodes = append(nodes, n)
+		}
+		return routes[0], nodes
+	}
+	paths, err := rs.PfsProxy.FindPath(rs.NodeAddress, target, g.TokenAddress, amount, true)
+	if err != nil {
+		log.Error(fmt.Sprintf("get route from pathfinder failed, err = %s", err.Error()))
+		return
+	}
+	for _, path := range paths {
+		if path.Result == nil || path.Fee == nil || common.HexToAddress(path.Result[0]) != partner {
+			continue
+		}
+		nodes = nil
+		disjoint := true
+		for _, a := range path.Result {
+			n := common.HexToAddress(a)
+			if n == target {
+				continue
+			}
+			if used[n] {
+				disjoint = false
+				break
+			}
+			nodes = append(nodes, n)
+		}
+		if !disjoint {
+			continue
+		}
+		r = route.NewState(g.GetPartenerAddress2Channel(partner))
+		r.Fee = rs.FeePolicy.GetNodeChargeFee(partner, g.TokenAddress, amount)
+		r.TotalFee = path.Fee
+		return
+	}
+	return nil, nil
+}
+
+/*
+multiPathPartReceived 收到了多路径支付的另一个部分, 交给已有的接收方 StateManager 处理,
+这个部分不一定会引起 SecretRequest, 所以直接保存通道并确认消息.
+*/
+func (rs *Service) multiPathPartReceived(msg *encoding.MediatedTransfer, ch *channel.Channel, stateManager *transfer.StateManager, refuse bool) {
+	rs.updateChannelAndSaveAck(ch, msg.Tag())
+	fromRoute := graph.Channel2RouteState(ch, msg.Sender, msg.PaymentAmount, rs)
+	fromTransfer := mediatedtransfer.LockedTransferFromMessage(msg, ch.TokenAddress)
+	initTarget := &mediatedtransfer.ActionInitTargetStateChange{
+		OurAddress:  rs.NodeAddress,
+		FromRoute:   fromRoute,
+		FromTranfer: fromTransfer,
+		BlockNumber: rs.GetBlockNumber(),
+		Message:     msg,
+		Db:          rs.dao,
+		Refuse:      refuse,
+	}
+	rs.StateMachineEventHandler.dispatch(stateManager, initTarget)
+	if refuse {
+		return
+	}
+	rs.NotifyHandler.NotifyReceiveMediatedTransfer(msg, ch)
+}
+
+/*
+MultiPathTransfer sends amount to target in at most maxParts parts over different channels,
+target receives all of them or none of them. Fee of each part is computed by routes.
+*/
+func (r *API) MultiPathTransfer(token common.Address, amount *big.Int, target common.Address, maxParts int, data string) (result *utils.AsyncResult, err error) {
+	if r.Photon.StopCreateNewTransfers {
+		return nil, rerr.ErrStopCreateNewTransfer
+	}
+	if amount == nil || amount.Cmp(utils.BigInt0) <= 0 {
+		return nil, rerr.ErrInvalidAmount
+	}
+	if target == r.Photon.NodeAddress {
+		return nil, rerr.ErrSamePeerAddress
+	}
+	if maxParts == 0 {
+		maxParts = params.DefaultMultiPathMaxParts
+	}
+	if maxParts < 0 || maxParts > params.MaxMultiPathParts {
+		return nil, fmt.Errorf("max parts must be between 1 and %d", params.MaxMultiPathParts)
+	}
+	if len(data) > params.MaxTransferDataLen {
+		return nil, fmt.Errorf("invalid data, length must < %d", params.MaxTransferDataLen)
+	}
+	log.Debug(fmt.Sprintf("initiating multi-path transfer initiator=%s target=%s token=%s amount=%s maxParts=%d",
+		r.Photon.NodeAddress.String(), target.String(), token.String(), amount, maxParts))
+	result = r.Photon.multiPathTransferClient(token, amount, target, maxParts, data)
+	return
+}
@@ -185,6 +185,29 @@ var errAddressNotFoundInGraph = errors.New("address not found in channelgraph")
 ShortestPath returns the shortestpath weight from source to target.  make sure only be called in one thread.
 */
 func (cg *ChannelGraph) ShortestPath(source, target common.Address, amount *big.Int, feeCharger fee.Charger) (totalWeight int64, err error) {
+	path, err := cg.shortest(source, target, amount, feeCharger)
+	return path.Distance, err
+}
+
+/*
+ShortestPathNodes returns the nodes on the shortest path from source to target, including source and target.
+make sure only be called in one thread.
+*/
+func (cg *ChannelGraph) ShortestPathNodes(source, target common.Address, amount *big.Int, feeCharger fee.Charger) (nodes []common.Address, err error) {
+	path, err := cg.shortest(source, target, amount, feeCharger)
+	if err != nil {
+		return
+	}
+	if len(path.Path) == 0 {
+		return []common.Address{source}, nil
+	}
+	for _, index := range path.Path {
+		nodes = append(nodes, cg.index2address[index])
+	}
+	return
+}
+
+func (cg *ChannelGraph) shortest(source, target common.Address, amount *big.Int, feeCharger fee.Charger) (path dijkstra.BestPath, err error) {
 	sourceIndex, ok := cg.address2index[source]
 	if !ok {
 		err = errAddressNotFoundInGraph
@@ -196,7 +219,7 @@ func (cg *ChannelGraph) ShortestPath(source, target common.Address, amount *big.
 		return
 	}
 	if sourceIndex == targetIndex {
-		return 0, nil
+		return
 	}
 	var g2 *dijkstra.Graph
 	if false { //make sure only be called in one thread.
@@ -210,11 +233,7 @@ func (cg *ChannelGraph) ShortestPath(source, target common.Address, amount *big.
 			v.SetWeight(w) // from v's fee is w.
 		}
 	}
-	path, err := g2.Shortest(sourceIndex, targetIndex)
-	if err != nil {
-		return
-	}
-	return path.Distance, nil
+	return g2.Shortest(sourceIndex, targetIndex)
 }
 
 //RemoveChannel remove a channel from graph,and i'm a participant of this channel
@@ -371,6 +390,60 @@ func (cg *ChannelGraph) GetBestRoutes(nodesStatus NodesStatusGetter, ourAddress
 	}
 	return
 }
+
+/*
+CircularRoute returns the route of a transfer from us to us, which leaves through the channel with firstHop
+and returns through the channel with lastHop.
+TotalFee of the route is the fee of the shortest path from firstHop back to us via lastHop.
+*/
+func (cg *ChannelGraph) CircularRoute(firstHop, lastHop common.Address, amount *big.Int, feeCharger fee.Charger) (routeState *route.State, err error) {
+	c := cg.PartenerAddress2Channel[firstHop]
+	if c == nil || cg.PartenerAddress2Channel[lastHop] == nil {
+		err = errors.New("first hop and last hop must be our partners")
+		return
+	}
+	ourIndex := cg.address2index[cg.OurAddress]
+	/*
+		临时删除除了 lastHop 以外所有到我的边,保证只能从 lastHop 回来,也不能直接从 firstHop 回来
+	*/
+	// temporarily remove arcs to us except the one from lastHop
+	var removed []int
+	for partner := range cg.PartenerAddress2Channel {
+		if partner == lastHop {
+			continue
+		}
+		index, ok := cg.address2index[partner]
+		if !ok {
+			continue
+		}
+		v, err2 := cg.g.GetVertex(index)
+		if err2 != nil {
+			continue
+		}
+		if _, ok = v.GetArc(ourIndex); ok {
+			v.DeleteArc(ourIndex)
+			removed = append(removed, index)
+		}
+	}
+	weight, err := cg.ShortestPath(firstHop, cg.OurAddress, amount, feeCharger)
+	for _, index := range removed {
+		err2 := cg.g.AddArc(index, ourIndex, 1)
+		if err2 != nil {
+			log.Error(fmt.Sprintf("add path err%s", err2))
+		}
+	}
+	if err != nil {
+		return
+	}
+	routeState = Channel2RouteState(c, firstHop, amount, feeCharger)
+	if routeState.Fee.Cmp(utils.BigInt0) > 0 {
+		routeState.TotalFee = big.NewInt(weight)
+	} else { //no fee policy,
+		routeState.TotalFee = utils.BigInt0
+	}
+	return
+}
+
 func (cg *ChannelGraph) haveNodes() bool {
 	return len(cg.g.Verticies) > 0
 }
@@ -142,6 +142,29 @@ func (bcs *BlockChainService) Token(tokenAddress common.Address) (t *TokenProxy,
 	return bcs.addressTokens[tokenAddress], nil
 }
 
+/*
+ValidToken 检查 token 是否满足合约注册的条件(validAndUpdateToken): 是合约并且 totalSupply 大于 0.
+合约没有单独的注册函数, token 在第一次创建通道时自动注册,
+提前检查可以避免创建通道的交易失败.
+*/
+func (bcs *BlockChainService) ValidToken(token common.Address) error {
+	if token == utils.EmptyAddress || !bcs.contractExist(token) {
+		return fmt.Errorf("token %s is not a contract", token.String())
+	}
+	t, err := bcs.Token(token)
+	if err != nil {
+		return err
+	}
+	totalSupply, err := t.TotalSupply()
+	if err != nil {
+		return fmt.Errorf("token %s is not an ERC20 token, totalSupply err %s", token.String(), err)
+	}
+	if totalSupply.Sign() <= 0 {
+		return fmt.Errorf("totalSupply of token %s is zero", token.String())
+	}
+	return nil
+}
+
 //TokenNetwork return a proxy to interact with a NettingChannelContract.
 func (bcs *BlockChainService) TokenNetwork(tokenAddress common.Address) (t *TokenNetworkProxy, err error) {
 	bcs.mlock.Lock()
@@ -114,6 +114,25 @@ func (t *TokenNetworkProxy) NewChannelAndDeposit(participantAddress, partnerAddr
 	return t.newChannelAndDepositByApprove(token, participantAddress, partnerAddress, settleTimeout, amount)
 }
 
+/*
+RegisterToken creates the token network of this token by opening the first channel with partner,
+contract emits TokenNetworkCreated and ChannelOpenedAndDeposit in the same transaction.
+*/
+func (t *TokenNetworkProxy) RegisterToken(participantAddress, partnerAddress common.Address, settleTimeout int, amount *big.Int) (err error) {
+	registered, err := t.TokenNetworkByToken(t.token)
+	if err != nil {
+		return
+	}
+	if registered {
+		return fmt.Errorf("token %s is already registered", t.token.String())
+	}
+	err = t.bcs.ValidToken(t.token)
+	if err != nil {
+		return
+	}
+	return t.NewChannelAndDeposit(participantAddress, partnerAddress, settleTimeout, amount)
+}
+
 //NewChannelAndDepositAsync create channel async
 func (t *TokenNetworkProxy) NewChannelAndDepositAsync(participantAddress, partnerAddress common.Address, settleTimeout int, amount *big.Int) (result *utils.AsyncResult) {
 	result = utils.NewAsyncResult()
@@ -235,6 +254,64 @@ func (t *TokenNetworkProxy) UnlockAsync(partnerAddr common.Address, transferAmou
 	return
 }
 
+//UpdateBalanceProofDelegate update balance proof of partner for participant, participantSignature is signed by participant
+func (t *TokenNetworkProxy) UpdateBalanceProofDelegate(partnerAddr, participantAddr common.Address, transferAmount *big.Int, locksRoot common.Hash, nonce uint64, extraHash common.Hash, partnerSignature, participantSignature []byte) (err error) {
+	tx, err := t.GetContract().UpdateBalanceProofDelegate(t.bcs.Auth, t.token, partnerAddr, participantAddr, transferAmount, locksRoot, nonce, extraHash, partnerSignature, participantSignature)
+	if err != nil {
+		return
+	}
+	log.Info(fmt.Sprintf("UpdateBalanceProofDelegate  txhash=%s", tx.Hash().String()))
+	receipt, err := bind.WaitMined(GetCallContext(), t.bcs.Client, tx)
+	if err != nil {
+		return err
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		log.Info(fmt.Sprintf("UpdateBalanceProofDelegate failed %s", receipt))
+		return errors.New("UpdateBalanceProofDelegate tx execution failed")
+	}
+	log.Info(fmt.Sprintf("UpdateBalanceProofDelegate success %s ,partner=%s,participant=%s", utils.APex(t.Address), utils.APex(partnerAddr), utils.APex(participantAddr)))
+	return nil
+}
+
+//UpdateBalanceProofDelegateAsync update balance proof for participant async
+func (t *TokenNetworkProxy) UpdateBalanceProofDelegateAsync(partnerAddr, participantAddr common.Address, transferAmount *big.Int, locksRoot common.Hash, nonce uint64, extraHash common.Hash, partnerSignature, participantSignature []byte) (result *utils.AsyncResult) {
+	result = utils.NewAsyncResult()
+	go func() {
+		err := t.UpdateBalanceProofDelegate(partnerAddr, participantAddr, transferAmount, locksRoot, nonce, extraHash, partnerSignature, participantSignature)
+		result.Result <- err
+	}()
+	return
+}
+
+//UnlockDelegate unlock a partner's lock for participant, participantSignature is signed by participant
+func (t *TokenNetworkProxy) UnlockDelegate(partnerAddr, participantAddr common.Address, transferAmount *big.Int, lock *mtree.Lock, proof []byte, participantSignature []byte) (err error) {
+	tx, err := t.GetContract().UnlockDelegate(t.bcs.Auth, t.token, partnerAddr, participantAddr, transferAmount, big.NewInt(lock.Expiration), lock.Amount, lock.LockSecretHash, proof, participantSignature)
+	if err != nil {
+		return
+	}
+	log.Info(fmt.Sprintf("UnlockDelegate  txhash=%s", tx.Hash().String()))
+	receipt, err := bind.WaitMined(GetCallContext(), t.bcs.Client, tx)
+	if err != nil {
+		return err
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		log.Info(fmt.Sprintf("UnlockDelegate failed %s", receipt))
+		return errors.New("UnlockDelegate tx execution failed")
+	}
+	log.Info(fmt.Sprintf("UnlockDelegate success %s ,partner=%s,participant=%s", utils.APex(t.Address), utils.APex(partnerAddr), utils.APex(participantAddr)))
+	return nil
+}
+
+//UnlockDelegateAsync unlock a partner's lock for participant async
+func (t *TokenNetworkProxy) UnlockDelegateAsync(partnerAddr, participantAddr common.Address, transferAmount *big.Int, lock *mtree.Lock, proof []byte, participantSignature []byte) (result *utils.AsyncResult) {
+	result = utils.NewAsyncResult()
+	go func() {
+		err := t.UnlockDelegate(partnerAddr, participantAddr, transferAmount, lock, proof, participantSignature)
+		result.Result <- err
+	}()
+	return
+}
+
 //SettleChannel settle a channel
 func (t *TokenNetworkProxy) SettleChannel(p1Addr, p2Addr common.Address, p1Amount, p2Amount *big.Int, p1Locksroot, p2Locksroot common.Hash) (err error) {
 	tx, err := t.GetContract().Settle(t.bcs.Auth, t.token, p1Addr, p1Amount, p1Locksroot, p2Addr, p2Amount, p2Locksroot)
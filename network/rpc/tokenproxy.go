@@ -47,6 +47,21 @@ func (t *TokenProxy) Allowance(owner, spender common.Address) (int64, error) {
 	return amount.Int64(), err //todo if amount larger than max int64?
 }
 
+// Name of token, optional in ERC20
+func (t *TokenProxy) Name() (string, error) {
+	return t.Token.Name(t.bcs.getQueryOpts())
+}
+
+// Symbol of token, optional in ERC20
+func (t *TokenProxy) Symbol() (string, error) {
+	return t.Token.Symbol(t.bcs.getQueryOpts())
+}
+
+// Decimals of token, optional in ERC20, 0 if not implemented
+func (t *TokenProxy) Decimals() (uint8, error) {
+	return t.Token.Decimals(t.bcs.getQueryOpts())
+}
+
 // Approve Whether the approval was successful or not
 // @notice `msg.sender` approves `_spender` to spend `_value` tokens
 // @param _spender The address of the account able to transfer the tokens
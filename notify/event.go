@@ -0,0 +1,203 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/channel/channeltype"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/network/netshare"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+EventType :
+type of the event pushed to api subscribers
+*/
+type EventType string
+
+const (
+	// EventTypeReceivedTransfer a transfer received success
+	EventTypeReceivedTransfer EventType = "received_transfer"
+	// EventTypeSentTransfer a transfer sent success
+	EventTypeSentTransfer EventType = "sent_transfer"
+	// EventTypeTransferFailed a transfer I sent failed
+	EventTypeTransferFailed EventType = "transfer_failed"
+	// EventTypeNotice some important message for upper app
+	EventTypeNotice EventType = "notice"
+	// EventTypeChannelNew a new channel opened
+	EventTypeChannelNew EventType = "channel_new"
+	// EventTypeChannelDeposit someone deposit to channel
+	EventTypeChannelDeposit EventType = "channel_deposit"
+	// EventTypeChannelState channel closed, settled...
+	EventTypeChannelState EventType = "channel_state"
+	// EventTypeChannelSettled channel settled and removed
+	EventTypeChannelSettled EventType = "channel_settled"
+	// EventTypeWithdrawSuccess withdraw on chain success
+	EventTypeWithdrawSuccess EventType = "withdraw_success"
+	// EventTypeWithdrawFailed withdraw on chain failed
+	EventTypeWithdrawFailed EventType = "withdraw_failed"
+	// EventTypeEthStatus connection status between photon and ethereum changed
+	EventTypeEthStatus EventType = "eth_status"
+	// EventTypeTransportStatus connection status of xmpp/matrix changed
+	EventTypeTransportStatus EventType = "transport_status"
+	// EventTypeTransferHeld a transfer received is held, waiting for accept or cancel
+	EventTypeTransferHeld EventType = "transfer_held"
+	// EventTypeHeldTransferCanceled a held transfer is canceled by user or hold deadline
+	EventTypeHeldTransferCanceled EventType = "held_transfer_canceled"
+)
+
+/*
+Event :
+one item of the event stream, ID is increased one by one,
+so a client can resume from the last ID it has seen.
+*/
+type Event struct {
+	ID        uint64          `json:"id"`
+	Type      EventType       `json:"type"`
+	Data      json.RawMessage `json:"data"`
+	Timestamp int64           `json:"timestamp"`
+}
+
+func newEvent(eventType EventType, data interface{}) *Event {
+	e := &Event{
+		Type:      eventType,
+		Timestamp: time.Now().Unix(),
+	}
+	buf, err := json.Marshal(data)
+	if err != nil {
+		buf, _ = json.Marshal("unknown info")
+	}
+	e.Data = buf
+	return e
+}
+
+func newEventFromNotification(n *models.Notification) *Event {
+	return &Event{
+		ID:        n.Seq,
+		Type:      EventType(n.Type),
+		Data:      n.Data,
+		Timestamp: n.Timestamp,
+	}
+}
+
+func (e *Event) toNotification() *models.Notification {
+	return &models.Notification{
+		Seq:       e.ID,
+		Type:      string(e.Type),
+		Data:      e.Data,
+		Timestamp: e.Timestamp,
+	}
+}
+
+var errNoOutbox = errors.New("notification outbox not enabled")
+var errEmptyConsumer = errors.New("consumer of notifications is empty")
+
+/*
+consumers of the notification outbox, every consumer has its own ack cursor,
+events are removed only after all consumers have acknowledged them.
+restful clients can use their own consumer names.
+*/
+const (
+	ConsumerDefault = "default"
+	ConsumerMobile  = "mobile"
+	ConsumerWebhook = "webhook"
+)
+
+/*
+ChannelStatus :
+channel info carried by channel events
+*/
+type ChannelStatus struct {
+	ChannelIdentifier string            `json:"channel_identifier"`
+	OpenBlockNumber   int64             `json:"open_block_number"`
+	TokenAddress      string            `json:"token_address"`
+	PartnerAddress    string            `json:"partner_address"`
+	Balance           *big.Int          `json:"balance"`
+	PartnerBalance    *big.Int          `json:"partner_balance"`
+	State             channeltype.State `json:"state"`
+	StateString       string            `json:"state_string"`
+	SettleTimeout     int               `json:"settle_timeout"`
+	ClosedBlock       int64             `json:"closed_block"`
+	SettledBlock      int64             `json:"settled_block"`
+}
+
+func newChannelStatus(c *channeltype.Serialization) *ChannelStatus {
+	return &ChannelStatus{
+		ChannelIdentifier: c.ChannelIdentifier.ChannelIdentifier.String(),
+		OpenBlockNumber:   c.ChannelIdentifier.OpenBlockNumber,
+		TokenAddress:      c.TokenAddress().String(),
+		PartnerAddress:    c.PartnerAddress().String(),
+		Balance:           c.OurBalance(),
+		PartnerBalance:    c.PartnerBalance(),
+		State:             c.State,
+		StateString:       c.State.String(),
+		SettleTimeout:     c.SettleTimeout,
+		ClosedBlock:       c.ClosedBlock,
+		SettledBlock:      c.SettledBlock,
+	}
+}
+
+/*
+TransferFailed :
+info carried by transfer_failed event
+*/
+type TransferFailed struct {
+	TokenAddress   common.Address `json:"token_address"`
+	TargetAddress  common.Address `json:"target_address"`
+	LockSecretHash common.Hash    `json:"lock_secret_hash"`
+	Reason         string         `json:"reason"`
+}
+
+/*
+HeldTransfer :
+info carried by transfer_held and held_transfer_canceled events
+*/
+type HeldTransfer struct {
+	TokenAddress      common.Address `json:"token_address"`
+	LockSecretHash    common.Hash    `json:"lock_secret_hash"`
+	Initiator         common.Address `json:"initiator_address"`
+	Amount            *big.Int       `json:"amount"`
+	ChannelIdentifier common.Hash    `json:"channel_identifier"`
+	Expiration        int64          `json:"expiration,omitempty"`
+	HoldDeadline      int64          `json:"hold_deadline,omitempty"` // canceled automatically at this block
+	SecretKnown       bool           `json:"secret_known,omitempty"`
+	Reason            string         `json:"reason,omitempty"`
+}
+
+/*
+WithdrawResult :
+info carried by withdraw_success and withdraw_failed events
+*/
+type WithdrawResult struct {
+	*ChannelStatus
+	Reason string `json:"reason,omitempty"`
+}
+
+/*
+ConnectionStatus :
+status carried by eth_status and transport_status events
+*/
+type ConnectionStatus struct {
+	Status       netshare.Status `json:"status"`
+	StatusString string          `json:"status_string"`
+}
+
+func newConnectionStatus(s netshare.Status) *ConnectionStatus {
+	cs := &ConnectionStatus{
+		Status: s,
+	}
+	switch s {
+	case netshare.Disconnected:
+		cs.StatusString = "disconnected"
+	case netshare.Connected:
+		cs.StatusString = "connected"
+	case netshare.Closed:
+		cs.StatusString = "closed"
+	case netshare.Reconnecting:
+		cs.StatusString = "reconnecting"
+	}
+	return cs
+}
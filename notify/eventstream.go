@@ -0,0 +1,366 @@
+package notify
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+)
+
+// DefaultEventHistorySize how many events kept in memory for subscribers to resume
+const DefaultEventHistorySize = 1024
+
+// subscriberBufferSize events waiting for a slow subscriber
+const subscriberBufferSize = 100
+
+// backlogPageSize at most so many events are read from outbox at once
+var backlogPageSize = 1000
+
+/*
+EventSubscription :
+a subscriber of the event stream.
+C is closed when the subscriber is too slow to keep up or unsubscribed,
+the client should subscribe again with the last ID it has seen.
+*/
+type EventSubscription struct {
+	C      <-chan *Event
+	c      chan *Event
+	stream *eventStream
+	closed bool
+}
+
+// Unsubscribe stop receiving events, it's safe to call more than once
+func (s *EventSubscription) Unsubscribe() {
+	s.stream.lock.Lock()
+	defer s.stream.lock.Unlock()
+	s.stream.removeSubscriber(s)
+}
+
+/*
+eventStream :
+keep latest events in a ring and fan out them to all subscribers.
+never block the caller of publish.
+if dao is set, every event is saved to the notification outbox too by writeLoop,
+and subscribers resume from the outbox instead of the ring.
+*/
+type eventStream struct {
+	lock        sync.Mutex
+	lastID      uint64
+	history     []*Event //ring buffer
+	next        int
+	full        bool
+	subscribers map[*EventSubscription]bool
+	stopped     bool
+	dao         models.NotificationDao
+	pending     []*Event   //published but not saved to outbox yet, order by ID
+	writeLock   sync.Mutex //only one goroutine saves pending events
+	wakeup      chan struct{}
+	writerDone  chan struct{}
+}
+
+func newEventStream(historySize int) *eventStream {
+	if historySize <= 0 {
+		historySize = DefaultEventHistorySize
+	}
+	return &eventStream{
+		history:     make([]*Event, historySize),
+		subscribers: make(map[*EventSubscription]bool),
+	}
+}
+
+// setDao events published later will be saved to dao, ID continues from the last saved one.
+func (s *eventStream) setDao(dao models.NotificationDao) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.dao != nil {
+		return
+	}
+	s.dao = dao
+	if last := dao.GetNotificationLastSeq(); last > s.lastID {
+		s.lastID = last
+	}
+	s.wakeup = make(chan struct{}, 1)
+	s.writerDone = make(chan struct{})
+	go s.writeLoop()
+}
+
+/*
+writeLoop save pending events to outbox,
+publish is called by the main loop of photon, so it must not wait for disk.
+*/
+func (s *eventStream) writeLoop() {
+	defer close(s.writerDone)
+	for range s.wakeup {
+		s.writePending()
+	}
+	// stopped, save the rest
+	s.writePending()
+}
+
+func (s *eventStream) writePending() {
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+	s.lock.Lock()
+	batch := s.pending
+	s.lock.Unlock()
+	for _, e := range batch {
+		err := s.dao.NewNotification(e.toNotification())
+		if err != nil {
+			log.Error(fmt.Sprintf("save notification %d err %s", e.ID, err))
+		}
+	}
+	s.lock.Lock()
+	s.pending = s.pending[len(batch):]
+	if len(s.pending) == 0 {
+		s.pending = nil
+	}
+	s.lock.Unlock()
+}
+
+// publish assign an ID to e, and send it to all subscribers.
+func (s *eventStream) publish(e *Event) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.stopped {
+		return
+	}
+	s.lastID++
+	e.ID = s.lastID
+	if s.dao != nil {
+		s.pending = append(s.pending, e)
+		select {
+		case s.wakeup <- struct{}{}:
+		default:
+		}
+	}
+	s.history[s.next] = e
+	s.next++
+	if s.next == len(s.history) {
+		s.next = 0
+		s.full = true
+	}
+	for sub := range s.subscribers {
+		select {
+		case sub.c <- e:
+		default:
+			// too slow, client should resume from the last event it has seen
+			s.removeSubscriber(sub)
+		}
+	}
+}
+
+// must hold lock
+func (s *eventStream) removeSubscriber(sub *EventSubscription) {
+	if sub.closed {
+		return
+	}
+	sub.closed = true
+	delete(s.subscribers, sub)
+	close(sub.c)
+}
+
+// must hold lock, return events whose ID is greater than cursor in order
+func (s *eventStream) eventsAfter(cursor uint64) (events []*Event) {
+	start := 0
+	size := s.next
+	if s.full {
+		start = s.next
+		size = len(s.history)
+	}
+	for i := 0; i < size; i++ {
+		e := s.history[(start+i)%len(s.history)]
+		if e.ID > cursor {
+			events = append(events, e)
+		}
+	}
+	return
+}
+
+/*
+storedEventsAfter return at most backlogPageSize events in outbox whose ID is greater than cursor and not greater than last,
+including those in pending, which are published but not saved yet.
+more is true when there are events left after this page.
+dao is read without lock, so last and pending must be taken together under lock before.
+*/
+func storedEventsAfter(dao models.NotificationDao, cursor, last uint64, pending []*Event) (events []*Event, more, complete bool, err error) {
+	ns, err := dao.GetNotificationsAfter(cursor, backlogPageSize)
+	if err != nil {
+		return
+	}
+	// events before acked seq have been removed, maybe while we are reading
+	complete = cursor >= dao.GetNotificationAckedSeq()
+	saved := cursor
+	for _, n := range ns {
+		if n.Seq > last {
+			// published after subscribe, subscriber will receive it from channel
+			return
+		}
+		events = append(events, newEventFromNotification(n))
+		saved = n.Seq
+	}
+	if len(ns) == backlogPageSize && saved < last {
+		more = true
+		return
+	}
+	for _, e := range pending {
+		if e.ID > saved {
+			events = append(events, e)
+		}
+	}
+	return
+}
+
+/*
+subscribe returns events after cursor that still in outbox or memory and
+a subscription for new events.
+complete is false when some events after cursor has been acknowledged or dropped from memory.
+the backlog read from outbox is one page at most, if there are more, sub is closed already,
+the client should subscribe again with the last ID in backlog like when it's too slow.
+*/
+func (s *eventStream) subscribe(cursor uint64) (sub *EventSubscription, backlog []*Event, complete bool) {
+	c := make(chan *Event, subscriberBufferSize)
+	sub = &EventSubscription{
+		C:      c,
+		c:      c,
+		stream: s,
+	}
+	s.lock.Lock()
+	if s.stopped {
+		sub.closed = true
+		close(c)
+	} else {
+		s.subscribers[sub] = true
+	}
+	dao, last, pending := s.snapshot()
+	if dao == nil {
+		backlog, complete = s.eventsInMemory(cursor, last)
+		s.lock.Unlock()
+		return
+	}
+	s.lock.Unlock()
+	var more bool
+	backlog, more, complete = s.backlogAfter(dao, cursor, last, pending)
+	if more {
+		sub.Unsubscribe()
+	}
+	return
+}
+
+// close all subscribers, no more subscriber can be added after stop, wait until all events are saved
+func (s *eventStream) stop() {
+	s.lock.Lock()
+	if s.stopped {
+		s.lock.Unlock()
+		return
+	}
+	s.stopped = true
+	for sub := range s.subscribers {
+		s.removeSubscriber(sub)
+	}
+	writerDone := s.writerDone
+	if s.wakeup != nil {
+		close(s.wakeup)
+	}
+	s.lock.Unlock()
+	if writerDone != nil {
+		<-writerDone
+	}
+}
+
+// must hold lock, dao, lastID and events not saved yet
+func (s *eventStream) snapshot() (dao models.NotificationDao, last uint64, pending []*Event) {
+	return s.dao, s.lastID, append([]*Event(nil), s.pending...)
+}
+
+// backlogAfter read the outbox without lock, use events in memory if failed
+func (s *eventStream) backlogAfter(dao models.NotificationDao, cursor, last uint64, pending []*Event) (backlog []*Event, more, complete bool) {
+	backlog, more, complete, err := storedEventsAfter(dao, cursor, last, pending)
+	if err == nil {
+		return
+	}
+	log.Error(fmt.Sprintf("get notifications after %d err %s, use events in memory", cursor, err))
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	backlog, complete = s.eventsInMemory(cursor, last)
+	return backlog, false, complete
+}
+
+// must hold lock, events in memory after cursor and not greater than last
+func (s *eventStream) eventsInMemory(cursor, last uint64) (backlog []*Event, complete bool) {
+	for _, e := range s.eventsAfter(cursor) {
+		if e.ID <= last {
+			backlog = append(backlog, e)
+		}
+	}
+	complete = true
+	if cursor < last {
+		if len(backlog) == 0 || backlog[0].ID != cursor+1 {
+			complete = false
+		}
+	}
+	return
+}
+
+/*
+events returns events after cursor without subscribing,
+at most one page is read from outbox, the client should ask again with the last ID in events.
+*/
+func (s *eventStream) events(cursor uint64) (backlog []*Event, complete bool) {
+	s.lock.Lock()
+	dao, last, pending := s.snapshot()
+	if dao == nil {
+		defer s.lock.Unlock()
+		return s.eventsInMemory(cursor, last)
+	}
+	s.lock.Unlock()
+	backlog, _, complete = s.backlogAfter(dao, cursor, last, pending)
+	return
+}
+
+func (s *eventStream) getDao() models.NotificationDao {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.dao
+}
+
+/*
+ack events not greater than id have been processed by consumer,
+they are removed from outbox after all consumers have acknowledged them.
+*/
+func (s *eventStream) ack(consumer string, id uint64) error {
+	dao := s.getDao()
+	if dao == nil {
+		return errNoOutbox
+	}
+	if consumer == "" {
+		return errEmptyConsumer
+	}
+	// events to be acknowledged must be saved first, otherwise they can not be removed
+	s.writePending()
+	return dao.AckNotifications(consumer, id)
+}
+
+// ackedID all events not greater than it have been acknowledged by consumer
+func (s *eventStream) ackedID(consumer string) uint64 {
+	dao := s.getDao()
+	if dao == nil {
+		return 0
+	}
+	return dao.GetNotificationConsumerCursor(consumer)
+}
+
+// removeConsumer events are not kept for consumer any more
+func (s *eventStream) removeConsumer(consumer string) error {
+	dao := s.getDao()
+	if dao == nil {
+		return errNoOutbox
+	}
+	return dao.RemoveNotificationConsumer(consumer)
+}
+
+func (s *eventStream) getLastID() uint64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.lastID
+}
@@ -0,0 +1,166 @@
+package notify
+
+import (
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/codefortest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventStreamSubscribe(t *testing.T) {
+	s := newEventStream(4)
+	for i := 0; i < 3; i++ {
+		s.publish(newEvent(EventTypeNotice, i))
+	}
+	sub, backlog, complete := s.subscribe(1)
+	assert.True(t, complete)
+	assert.Len(t, backlog, 2)
+	assert.EqualValues(t, 2, backlog[0].ID)
+	assert.EqualValues(t, 3, backlog[1].ID)
+
+	s.publish(newEvent(EventTypeNotice, 3))
+	e := <-sub.C
+	assert.EqualValues(t, 4, e.ID)
+	sub.Unsubscribe()
+	sub.Unsubscribe()
+	_, ok := <-sub.C
+	assert.False(t, ok)
+}
+
+func TestEventStreamEventsLost(t *testing.T) {
+	s := newEventStream(2)
+	for i := 0; i < 5; i++ {
+		s.publish(newEvent(EventTypeNotice, i))
+	}
+	_, backlog, complete := s.subscribe(1)
+	assert.False(t, complete)
+	assert.Len(t, backlog, 2)
+	assert.EqualValues(t, 4, backlog[0].ID)
+
+	_, backlog, complete = s.subscribe(5)
+	assert.True(t, complete)
+	assert.Len(t, backlog, 0)
+}
+
+func TestEventStreamSlowSubscriber(t *testing.T) {
+	s := newEventStream(0)
+	sub, _, _ := s.subscribe(0)
+	for i := 0; i <= subscriberBufferSize; i++ {
+		s.publish(newEvent(EventTypeNotice, i))
+	}
+	n := 0
+	for range sub.C {
+		n++
+	}
+	assert.Equal(t, subscriberBufferSize, n)
+	s.stop()
+	sub, _, _ = s.subscribe(0)
+	_, ok := <-sub.C
+	assert.False(t, ok)
+}
+
+func TestEventStreamOutbox(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	s := newEventStream(0)
+	s.setDao(dao)
+	for i := 0; i < 3; i++ {
+		s.publish(newEvent(EventTypeNotice, i))
+	}
+	err := s.ack(ConsumerDefault, 1)
+	assert.Empty(t, err)
+	assert.EqualValues(t, 1, s.ackedID(ConsumerDefault))
+	s.stop()
+
+	// restart, unacknowledged events are replayed
+	s = newEventStream(0)
+	s.setDao(dao)
+	assert.EqualValues(t, 3, s.getLastID())
+	_, backlog, complete := s.subscribe(s.ackedID(ConsumerDefault))
+	assert.True(t, complete)
+	assert.Len(t, backlog, 2)
+	assert.EqualValues(t, 2, backlog[0].ID)
+	assert.EqualValues(t, EventTypeNotice, backlog[0].Type)
+
+	s.publish(newEvent(EventTypeNotice, 3))
+	_, complete = s.events(0)
+	assert.False(t, complete)
+	backlog, complete = s.events(3)
+	assert.True(t, complete)
+	assert.Len(t, backlog, 1)
+	assert.EqualValues(t, 4, backlog[0].ID)
+}
+
+func TestEventStreamConsumers(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	s := newEventStream(0)
+	s.setDao(dao)
+	for i := 0; i < 3; i++ {
+		s.publish(newEvent(EventTypeNotice, i))
+	}
+	// events not saved yet are in backlog too
+	backlog, complete := s.events(0)
+	assert.True(t, complete)
+	assert.Len(t, backlog, 3)
+	assert.NotEmpty(t, s.ack("", 3))
+	assert.Empty(t, s.ack(ConsumerDefault, 1))
+	assert.Empty(t, s.ack(ConsumerMobile, 3))
+	s.stop()
+
+	// mobile has acknowledged all, but default has not
+	s = newEventStream(0)
+	s.setDao(dao)
+	defer s.stop()
+	assert.EqualValues(t, 3, s.ackedID(ConsumerMobile))
+	assert.EqualValues(t, 1, s.ackedID(ConsumerDefault))
+	backlog, complete = s.events(s.ackedID(ConsumerDefault))
+	assert.True(t, complete)
+	assert.Len(t, backlog, 2)
+	assert.EqualValues(t, 2, backlog[0].ID)
+
+	assert.Empty(t, s.removeConsumer(ConsumerDefault))
+	backlog, complete = s.events(1)
+	assert.False(t, complete)
+	assert.Len(t, backlog, 0)
+}
+
+func TestEventStreamBacklogPage(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	pageSize := backlogPageSize
+	backlogPageSize = 2
+	defer func() {
+		backlogPageSize = pageSize
+	}()
+	s := newEventStream(0)
+	s.setDao(dao)
+	for i := 0; i < 5; i++ {
+		s.publish(newEvent(EventTypeNotice, i))
+	}
+	s.stop()
+
+	s = newEventStream(0)
+	s.setDao(dao)
+	defer s.stop()
+	backlog, complete := s.events(0)
+	assert.True(t, complete)
+	assert.Len(t, backlog, 2)
+	// more events in outbox, subscribe again from the last one
+	sub, backlog, complete := s.subscribe(0)
+	assert.True(t, complete)
+	assert.Len(t, backlog, 2)
+	_, ok := <-sub.C
+	assert.False(t, ok)
+	sub, backlog, _ = s.subscribe(backlog[1].ID)
+	assert.Len(t, backlog, 2)
+	assert.EqualValues(t, 3, backlog[0].ID)
+	_, ok = <-sub.C
+	assert.False(t, ok)
+	sub, backlog, _ = s.subscribe(backlog[1].ID)
+	assert.Len(t, backlog, 1)
+	assert.EqualValues(t, 5, backlog[0].ID)
+	s.publish(newEvent(EventTypeNotice, 5))
+	e := <-sub.C
+	assert.EqualValues(t, 6, e.ID)
+}
@@ -4,9 +4,12 @@ import (
 	"fmt"
 
 	"github.com/SmartMeshFoundation/Photon/channel"
+	"github.com/SmartMeshFoundation/Photon/channel/channeltype"
 	"github.com/SmartMeshFoundation/Photon/encoding"
 	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/network/netshare"
 	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
 )
 
 /*
@@ -21,6 +24,8 @@ type Handler struct {
 	receivedTransferChan chan *models.ReceivedTransfer
 	//noticeChan should never close
 	noticeChan chan *Notice
+	//events for api subscribers, such as the event stream of restful api
+	events *eventStream
 
 	// work status
 	stopped bool
@@ -32,6 +37,7 @@ func NewNotifyHandler() *Handler {
 		sentTransferChan:     make(chan *models.SentTransfer, 10),
 		receivedTransferChan: make(chan *models.ReceivedTransfer, 10),
 		noticeChan:           make(chan *Notice, 10),
+		events:               newEventStream(DefaultEventHistorySize),
 		stopped:              false,
 	}
 }
@@ -42,6 +48,60 @@ func (h *Handler) Stop() {
 	close(h.sentTransferChan)
 	close(h.receivedTransferChan)
 	close(h.noticeChan)
+	h.events.stop()
+}
+
+/*
+SubscribeEvents :
+subscribe all events whose ID is greater than cursor,
+use cursor=0 to get all events still in memory.
+complete is false when some events after cursor are too old to get.
+*/
+func (h *Handler) SubscribeEvents(cursor uint64) (sub *EventSubscription, backlog []*Event, complete bool) {
+	return h.events.subscribe(cursor)
+}
+
+// LastEventID : ID of the latest event
+func (h *Handler) LastEventID() uint64 {
+	return h.events.getLastID()
+}
+
+/*
+SetNotificationDao :
+save all events to the notification outbox of dao,
+events are kept until acknowledged by all consumers with AckEvents, and will be replayed after restart.
+*/
+func (h *Handler) SetNotificationDao(dao models.NotificationDao) {
+	h.events.setDao(dao)
+}
+
+/*
+GetEvents :
+events whose ID is greater than cursor without subscribing,
+complete is false when some events after cursor are acknowledged or too old to get.
+*/
+func (h *Handler) GetEvents(cursor uint64) (events []*Event, complete bool) {
+	return h.events.events(cursor)
+}
+
+// AckEvents : all events whose ID is not greater than id have been processed by consumer
+func (h *Handler) AckEvents(consumer string, id uint64) error {
+	return h.events.ack(consumer, id)
+}
+
+// AckedEventID : events before this ID (included) have been acknowledged by consumer
+func (h *Handler) AckedEventID(consumer string) uint64 {
+	return h.events.ackedID(consumer)
+}
+
+// RemoveEventConsumer : events are not kept for consumer any more
+func (h *Handler) RemoveEventConsumer(consumer string) error {
+	return h.events.removeConsumer(consumer)
+}
+
+// IsStopped :
+func (h *Handler) IsStopped() bool {
+	return h.stopped
 }
 
 // GetNoticeChan :
@@ -67,8 +127,10 @@ func (h *Handler) Notify(level Level, info interface{}) {
 	if h.stopped || info == nil || info == "" {
 		return
 	}
+	n := newNotice(level, info)
+	h.events.publish(newEvent(EventTypeNotice, n))
 	select {
-	case h.noticeChan <- newNotice(level, info):
+	case h.noticeChan <- n:
 	default:
 		// never block
 	}
@@ -89,6 +151,7 @@ func (h *Handler) NotifySentTransfer(st *models.SentTransfer) {
 	if h.stopped || st == nil {
 		return
 	}
+	h.events.publish(newEvent(EventTypeSentTransfer, st))
 	select {
 	case h.sentTransferChan <- st:
 	default:
@@ -102,9 +165,79 @@ func (h *Handler) NotifyReceiveTransfer(rt *models.ReceivedTransfer) {
 	if h.stopped || rt == nil {
 		return
 	}
+	h.events.publish(newEvent(EventTypeReceivedTransfer, rt))
 	select {
 	case h.receivedTransferChan <- rt:
 	default:
 		// never block
 	}
 }
+
+// NotifyTransferFailed : a transfer I sent failed
+func (h *Handler) NotifyTransferFailed(token, target common.Address, lockSecretHash common.Hash, reason string) {
+	if h.stopped {
+		return
+	}
+	h.events.publish(newEvent(EventTypeTransferFailed, &TransferFailed{
+		TokenAddress:   token,
+		TargetAddress:  target,
+		LockSecretHash: lockSecretHash,
+		Reason:         reason,
+	}))
+}
+
+// NotifyTransferHeld : a transfer received is held
+func (h *Handler) NotifyTransferHeld(t *HeldTransfer) {
+	if h.stopped || t == nil {
+		return
+	}
+	h.events.publish(newEvent(EventTypeTransferHeld, t))
+}
+
+// NotifyHeldTransferCanceled : a held transfer is canceled
+func (h *Handler) NotifyHeldTransferCanceled(t *HeldTransfer) {
+	if h.stopped || t == nil {
+		return
+	}
+	h.events.publish(newEvent(EventTypeHeldTransferCanceled, t))
+}
+
+// NotifyWithdrawResult : withdraw on chain finished, err is nil if success
+func (h *Handler) NotifyWithdrawResult(c *channeltype.Serialization, err error) {
+	if h.stopped || c == nil {
+		return
+	}
+	r := &WithdrawResult{
+		ChannelStatus: newChannelStatus(c),
+	}
+	eventType := EventTypeWithdrawSuccess
+	if err != nil {
+		eventType = EventTypeWithdrawFailed
+		r.Reason = err.Error()
+	}
+	h.events.publish(newEvent(eventType, r))
+}
+
+// NotifyChannelStatus : new channel, deposit, close, settle...
+func (h *Handler) NotifyChannelStatus(eventType EventType, c *channeltype.Serialization) {
+	if h.stopped || c == nil {
+		return
+	}
+	h.events.publish(newEvent(eventType, newChannelStatus(c)))
+}
+
+// NotifyEthStatus : connection status between photon and ethereum changed
+func (h *Handler) NotifyEthStatus(s netshare.Status) {
+	if h.stopped {
+		return
+	}
+	h.events.publish(newEvent(EventTypeEthStatus, newConnectionStatus(s)))
+}
+
+// NotifyTransportStatus : connection status of xmpp or matrix changed
+func (h *Handler) NotifyTransportStatus(s netshare.Status) {
+	if h.stopped {
+		return
+	}
+	h.events.publish(newEvent(EventTypeTransportStatus, newConnectionStatus(s)))
+}
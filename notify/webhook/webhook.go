@@ -0,0 +1,497 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/internal/rpanic"
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/notify"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+http headers of every delivery,
+receiver should verify SignatureHeader with hmac-sha256 of the request body and secret of the webhook.
+*/
+const (
+	SignatureHeader = "X-Photon-Signature"
+	EventHeader     = "X-Photon-Event"
+	DeliveryHeader  = "X-Photon-Delivery"
+)
+
+// default retry policy
+const (
+	DefaultMinBackoff  = 5 * time.Second
+	DefaultMaxBackoff  = 30 * time.Minute
+	DefaultMaxAttempts = 15
+	DefaultTimeout     = 10 * time.Second
+)
+
+// checkInterval how often pending deliveries are checked if no new event comes
+const checkInterval = time.Second
+
+/*
+Manager :
+watch events of notify.Handler and post them to registered webhooks.
+webhooks and deliveries not finished are saved by dao,
+events are acknowledged as consumer notify.ConsumerWebhook after deliveries are created,
+so nothing is lost after restart.
+*/
+type Manager struct {
+	MinBackoff  time.Duration
+	MaxBackoff  time.Duration
+	MaxAttempts int
+
+	dao     models.WebhookDao
+	handler *notify.Handler
+	client  *http.Client
+
+	lock       sync.Mutex
+	hooks      map[string]*models.Webhook
+	deliveries map[string]*models.WebhookDelivery
+	wakeup     chan struct{}
+	quit       chan struct{}
+	wg         sync.WaitGroup
+}
+
+// NewManager :
+func NewManager(dao models.WebhookDao, handler *notify.Handler) *Manager {
+	return &Manager{
+		MinBackoff:  DefaultMinBackoff,
+		MaxBackoff:  DefaultMaxBackoff,
+		MaxAttempts: DefaultMaxAttempts,
+		dao:         dao,
+		handler:     handler,
+		client:      &http.Client{Timeout: DefaultTimeout},
+		hooks:       make(map[string]*models.Webhook),
+		deliveries:  make(map[string]*models.WebhookDelivery),
+		wakeup:      make(chan struct{}, 1),
+		quit:        make(chan struct{}),
+	}
+}
+
+// Start load webhooks and deliveries from dao, then begin to work
+func (m *Manager) Start() error {
+	ws, err := m.dao.GetAllWebhooks()
+	if err != nil {
+		return err
+	}
+	ds, err := m.dao.GetAllWebhookDeliveries()
+	if err != nil {
+		return err
+	}
+	m.lock.Lock()
+	for _, w := range ws {
+		m.hooks[w.ID] = w
+	}
+	for _, d := range ds {
+		m.deliveries[d.Key] = d
+	}
+	m.lock.Unlock()
+	m.wg.Add(2)
+	go m.dispatchLoop()
+	go m.deliverLoop()
+	return nil
+}
+
+// Stop wait until all goroutines quit
+func (m *Manager) Stop() {
+	close(m.quit)
+	m.wg.Wait()
+}
+
+/*
+AddWebhook :
+register a new webhook, a random secret is generated if w.Secret is empty.
+*/
+func (m *Manager) AddWebhook(w *models.Webhook) (*models.Webhook, error) {
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid webhook url %s", w.URL)
+	}
+	nw := *w
+	nw.ID = utils.NewRandomHash().String()[2:18]
+	if nw.Secret == "" {
+		nw.Secret = utils.NewRandomHash().String()[2:]
+	}
+	nw.CreateTime = time.Now().Unix()
+	err = m.dao.SaveWebhook(&nw)
+	if err != nil {
+		return nil, err
+	}
+	m.lock.Lock()
+	m.hooks[nw.ID] = &nw
+	m.lock.Unlock()
+	return &nw, nil
+}
+
+// RemoveWebhook remove a webhook and all its deliveries
+func (m *Manager) RemoveWebhook(id string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if _, ok := m.hooks[id]; !ok {
+		return fmt.Errorf("webhook %s not found", id)
+	}
+	err := m.dao.RemoveWebhook(id)
+	if err != nil {
+		return err
+	}
+	delete(m.hooks, id)
+	for k, d := range m.deliveries {
+		if d.WebhookID == id {
+			m.removeDelivery(k)
+		}
+	}
+	return nil
+}
+
+// Webhooks returns all webhooks without secret
+func (m *Manager) Webhooks() (ws []*models.Webhook) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, w := range m.hooks {
+		w2 := *w
+		w2.Secret = ""
+		ws = append(ws, &w2)
+	}
+	sort.Slice(ws, func(i, j int) bool {
+		return ws[i].CreateTime < ws[j].CreateTime
+	})
+	return
+}
+
+// Deliveries returns deliveries still pending or failed, order by event
+func (m *Manager) Deliveries() (ds []*models.WebhookDelivery) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, d := range m.deliveries {
+		d2 := *d
+		ds = append(ds, &d2)
+	}
+	sort.Slice(ds, func(i, j int) bool {
+		return ds[i].EventID < ds[j].EventID
+	})
+	return
+}
+
+// RetryDelivery let a failed delivery to be sent again
+func (m *Manager) RetryDelivery(key string) error {
+	m.lock.Lock()
+	d, ok := m.deliveries[key]
+	if !ok {
+		m.lock.Unlock()
+		return fmt.Errorf("delivery %s not found", key)
+	}
+	d.Status = models.WebhookDeliveryPending
+	d.Attempts = 0
+	d.NextAttempt = 0
+	err := m.dao.SaveWebhookDelivery(d)
+	m.lock.Unlock()
+	m.notifyWakeup()
+	return err
+}
+
+func (m *Manager) notifyWakeup() {
+	select {
+	case m.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// must hold lock
+func (m *Manager) removeDelivery(key string) {
+	err := m.dao.RemoveWebhookDelivery(key)
+	if err != nil {
+		log.Error(fmt.Sprintf("RemoveWebhookDelivery %s err %s", key, err))
+	}
+	delete(m.deliveries, key)
+}
+
+/*
+dispatchLoop :
+create a delivery for every webhook that wants this event.
+resume from the last event acknowledged by webhooks, events are kept in the notification outbox
+until all consumers acknowledged them, so events during restart are not lost.
+*/
+func (m *Manager) dispatchLoop() {
+	defer rpanic.PanicRecover("webhook dispatchLoop")
+	defer m.wg.Done()
+	cursor := m.handler.AckedEventID(notify.ConsumerWebhook)
+	for {
+		sub, backlog, complete := m.handler.SubscribeEvents(cursor)
+		if !complete {
+			log.Warn(fmt.Sprintf("webhook lost some events after %d", cursor))
+		}
+		for _, e := range backlog {
+			cursor = m.dispatch(e)
+		}
+	loop:
+		for {
+			select {
+			case e, ok := <-sub.C:
+				if !ok {
+					break loop
+				}
+				cursor = m.dispatch(e)
+			case <-m.quit:
+				sub.Unsubscribe()
+				return
+			}
+		}
+		if m.handler.IsStopped() {
+			<-m.quit
+			return
+		}
+		// too slow to keep up, subscribe again
+	}
+}
+
+func (m *Manager) dispatch(e *notify.Event) uint64 {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		log.Error(fmt.Sprintf("marshal event %d err %s", e.ID, err))
+		return e.ID
+	}
+	var n int
+	m.lock.Lock()
+	for _, w := range m.hooks {
+		if !match(w, e) {
+			continue
+		}
+		d := &models.WebhookDelivery{
+			Key:       fmt.Sprintf("%s-%d", w.ID, e.ID),
+			WebhookID: w.ID,
+			EventID:   e.ID,
+			EventType: string(e.Type),
+			Payload:   payload,
+			Status:    models.WebhookDeliveryPending,
+		}
+		err = m.dao.SaveWebhookDelivery(d)
+		if err != nil {
+			log.Error(fmt.Sprintf("SaveWebhookDelivery %s err %s", d.Key, err))
+		}
+		m.deliveries[d.Key] = d
+		n++
+	}
+	m.lock.Unlock()
+	// deliveries are saved, the event is not needed any more
+	err = m.handler.AckEvents(notify.ConsumerWebhook, e.ID)
+	if err != nil {
+		log.Error(fmt.Sprintf("ack event %d err %s", e.ID, err))
+	}
+	if n > 0 {
+		m.notifyWakeup()
+	}
+	return e.ID
+}
+
+// eventFilterInfo fields used by filter of token and partner in event data
+type eventFilterInfo struct {
+	TokenAddress   *common.Address `json:"token_address"`
+	PartnerAddress *common.Address `json:"partner_address"`
+	ToAddress      *common.Address `json:"to_address"`
+	FromAddress    *common.Address `json:"from_address"`
+	TargetAddress  *common.Address `json:"target_address"`
+}
+
+func match(w *models.Webhook, e *notify.Event) bool {
+	if len(w.EventTypes) > 0 {
+		found := false
+		for _, t := range w.EventTypes {
+			if t == string(e.Type) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(w.Tokens) == 0 && len(w.Partners) == 0 {
+		return true
+	}
+	var info eventFilterInfo
+	err := json.Unmarshal(e.Data, &info)
+	if err != nil {
+		return false
+	}
+	if len(w.Tokens) > 0 && !containsAddress(w.Tokens, info.TokenAddress) {
+		return false
+	}
+	if len(w.Partners) > 0 &&
+		!containsAddress(w.Partners, info.PartnerAddress) &&
+		!containsAddress(w.Partners, info.ToAddress) &&
+		!containsAddress(w.Partners, info.FromAddress) &&
+		!containsAddress(w.Partners, info.TargetAddress) {
+		return false
+	}
+	return true
+}
+
+func containsAddress(addrs []common.Address, addr *common.Address) bool {
+	if addr == nil {
+		return false
+	}
+	for _, a := range addrs {
+		if a == *addr {
+			return true
+		}
+	}
+	return false
+}
+
+// deliverLoop post deliveries which are due
+func (m *Manager) deliverLoop() {
+	defer rpanic.PanicRecover("webhook deliverLoop")
+	defer m.wg.Done()
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	for {
+		m.deliverDue()
+		select {
+		case <-m.wakeup:
+		case <-ticker.C:
+		case <-m.quit:
+			return
+		}
+	}
+}
+
+/*
+deliverDue post due deliveries of every webhook concurrently,
+deliveries of one webhook are posted in order of event, and the rest are skipped in this round after a failure,
+so a slow or dead webhook doesn't delay others.
+*/
+func (m *Manager) deliverDue() {
+	now := time.Now().Unix()
+	type job struct {
+		d *models.WebhookDelivery
+		w models.Webhook
+	}
+	jobs := make(map[string][]job)
+	m.lock.Lock()
+	for _, d := range m.deliveries {
+		if d.Status != models.WebhookDeliveryPending || d.NextAttempt > now {
+			continue
+		}
+		w, ok := m.hooks[d.WebhookID]
+		if !ok {
+			m.removeDelivery(d.Key)
+			continue
+		}
+		jobs[w.ID] = append(jobs[w.ID], job{d, *w})
+	}
+	m.lock.Unlock()
+	var wg sync.WaitGroup
+	for _, js := range jobs {
+		sort.Slice(js, func(i, j int) bool {
+			return js[i].d.EventID < js[j].d.EventID
+		})
+		wg.Add(1)
+		go func(js []job) {
+			defer rpanic.PanicRecover("webhook deliverDue")
+			defer wg.Done()
+			for _, j := range js {
+				select {
+				case <-m.quit:
+					return
+				default:
+				}
+				err := m.post(&j.w, j.d)
+				m.finish(j.d, err)
+				if err != nil {
+					// try again later, the webhook is probably down
+					return
+				}
+			}
+		}(js)
+	}
+	wg.Wait()
+}
+
+// finish update delivery state after a post
+func (m *Manager) finish(d *models.WebhookDelivery, err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if _, ok := m.deliveries[d.Key]; !ok {
+		// webhook removed
+		return
+	}
+	if err == nil {
+		m.removeDelivery(d.Key)
+		return
+	}
+	d.Attempts++
+	d.LastError = err.Error()
+	if d.Attempts >= m.MaxAttempts {
+		d.Status = models.WebhookDeliveryFailed
+		log.Warn(fmt.Sprintf("webhook delivery %s failed after %d attempts, last err %s", d.Key, d.Attempts, err))
+	} else {
+		d.NextAttempt = time.Now().Add(m.backoff(d.Attempts)).Unix()
+	}
+	err = m.dao.SaveWebhookDelivery(d)
+	if err != nil {
+		log.Error(fmt.Sprintf("SaveWebhookDelivery %s err %s", d.Key, err))
+	}
+}
+
+// backoff doubles after every failure
+func (m *Manager) backoff(attempts int) time.Duration {
+	b := m.MinBackoff
+	for i := 1; i < attempts; i++ {
+		b *= 2
+		if b >= m.MaxBackoff {
+			return m.MaxBackoff
+		}
+	}
+	return b
+}
+
+// Sign returns the signature of body with secret, value of SignatureHeader
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, err := mac.Write(body)
+	if err != nil {
+		panic(err)
+	}
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (m *Manager) post(w *models.Webhook, d *models.WebhookDelivery) error {
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, Sign(w.Secret, d.Payload))
+	req.Header.Set(EventHeader, d.EventType)
+	req.Header.Set(DeliveryHeader, d.Key)
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		log.Trace(fmt.Sprintf("read webhook response err %s", err))
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.New(resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,280 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/codefortest"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/notify"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+type receiver struct {
+	lock     sync.Mutex
+	fails    int // fail the first n requests
+	requests int
+	headers  []http.Header
+	bodies   [][]byte
+	received chan struct{}
+}
+
+func newReceiver(fails int) *receiver {
+	return &receiver{
+		fails:    fails,
+		received: make(chan struct{}, 100),
+	}
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+	rc.requests++
+	if rc.fails > 0 {
+		rc.fails--
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	rc.headers = append(rc.headers, r.Header)
+	rc.bodies = append(rc.bodies, body)
+	rc.received <- struct{}{}
+}
+
+func (rc *receiver) wait(t *testing.T) {
+	select {
+	case <-rc.received:
+	case <-time.After(10 * time.Second):
+		t.Fatal("webhook not received")
+	}
+}
+
+func newTestManager(dao models.WebhookDao, h *notify.Handler) *Manager {
+	m := NewManager(dao, h)
+	m.MinBackoff = time.Millisecond
+	m.MaxBackoff = 10 * time.Millisecond
+	m.MaxAttempts = 3
+	return m
+}
+
+func newReceivedTransfer(token, from common.Address) *models.ReceivedTransfer {
+	return &models.ReceivedTransfer{
+		Key:          utils.NewRandomHash().String(),
+		TokenAddress: token,
+		FromAddress:  from,
+		Amount:       big.NewInt(10),
+	}
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	h := notify.NewNotifyHandler()
+	h.SetNotificationDao(dao)
+	rc := newReceiver(2)
+	server := httptest.NewServer(rc)
+	defer server.Close()
+
+	m := newTestManager(dao, h)
+	err := m.Start()
+	assert.Empty(t, err)
+	defer m.Stop()
+	token := utils.NewRandomAddress()
+	partner := utils.NewRandomAddress()
+	wh, err := m.AddWebhook(&models.Webhook{
+		URL:        server.URL,
+		EventTypes: []string{string(notify.EventTypeReceivedTransfer)},
+		Tokens:     []common.Address{token},
+		Partners:   []common.Address{partner},
+	})
+	assert.Empty(t, err)
+	assert.NotEmpty(t, wh.Secret)
+
+	// filtered out
+	h.Notify(notify.LevelInfo, "hello")
+	h.NotifyReceiveTransfer(newReceivedTransfer(utils.NewRandomAddress(), partner))
+	h.NotifyReceiveTransfer(newReceivedTransfer(token, utils.NewRandomAddress()))
+	// delivered after two failures
+	rt := newReceivedTransfer(token, partner)
+	h.NotifyReceiveTransfer(rt)
+	rc.wait(t)
+
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+	assert.Len(t, rc.bodies, 1)
+	body := rc.bodies[0]
+	header := rc.headers[0]
+	assert.EqualValues(t, Sign(wh.Secret, body), header.Get(SignatureHeader))
+	assert.EqualValues(t, notify.EventTypeReceivedTransfer, header.Get(EventHeader))
+	var e notify.Event
+	err = json.Unmarshal(body, &e)
+	assert.Empty(t, err)
+	assert.EqualValues(t, 4, e.ID)
+	var rt2 models.ReceivedTransfer
+	err = json.Unmarshal(e.Data, &rt2)
+	assert.Empty(t, err)
+	assert.EqualValues(t, rt.Key, rt2.Key)
+}
+
+func TestWebhookRestart(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	h := notify.NewNotifyHandler()
+	h.SetNotificationDao(dao)
+	rc := newReceiver(0)
+	server := httptest.NewServer(rc)
+	defer server.Close()
+
+	m := newTestManager(dao, h)
+	m.MaxAttempts = 1
+	err := m.Start()
+	assert.Empty(t, err)
+	wh, err := m.AddWebhook(&models.Webhook{
+		URL: "http://127.0.0.1:1/unreachable",
+	})
+	assert.Empty(t, err)
+	h.Notify(notify.LevelInfo, "hello")
+	for i := 0; i < 100; i++ {
+		ds := m.Deliveries()
+		if len(ds) == 1 && ds[0].Status == models.WebhookDeliveryFailed {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	m.Stop()
+
+	// webhook and failed delivery are loaded from dao
+	m = newTestManager(dao, h)
+	err = m.Start()
+	assert.Empty(t, err)
+	defer m.Stop()
+	ws := m.Webhooks()
+	assert.Len(t, ws, 1)
+	assert.EqualValues(t, wh.ID, ws[0].ID)
+	assert.Empty(t, ws[0].Secret)
+	ds := m.Deliveries()
+	if assert.Len(t, ds, 1) {
+		assert.EqualValues(t, models.WebhookDeliveryFailed, ds[0].Status)
+		assert.EqualValues(t, 1, ds[0].EventID)
+	}
+	// events after restart are not dispatched again
+	h.Notify(notify.LevelInfo, "world")
+	time.Sleep(100 * time.Millisecond)
+	assert.Len(t, m.Deliveries(), 2)
+
+	err = m.RemoveWebhook(wh.ID)
+	assert.Empty(t, err)
+	assert.Len(t, m.Deliveries(), 0)
+	ds, err = dao.GetAllWebhookDeliveries()
+	assert.Empty(t, err)
+	assert.Len(t, ds, 0)
+}
+
+/*
+events are kept for webhooks after restart, even if other consumers have acknowledged them,
+and removed from outbox after webhooks catch up.
+*/
+func TestWebhookLaggingRestart(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	h := notify.NewNotifyHandler()
+	h.SetNotificationDao(dao)
+	rc := newReceiver(0)
+	server := httptest.NewServer(rc)
+	defer server.Close()
+
+	m := newTestManager(dao, h)
+	err := m.Start()
+	assert.Empty(t, err)
+	_, err = m.AddWebhook(&models.Webhook{
+		URL: server.URL,
+	})
+	assert.Empty(t, err)
+	h.Notify(notify.LevelInfo, "hello")
+	rc.wait(t)
+	m.Stop()
+	assert.EqualValues(t, 1, h.AckedEventID(notify.ConsumerWebhook))
+
+	// webhooks are not working, another consumer acknowledges all events
+	h.Notify(notify.LevelInfo, "world")
+	h.Notify(notify.LevelInfo, "again")
+	err = h.AckEvents(notify.ConsumerDefault, h.LastEventID())
+	assert.Empty(t, err)
+	ns, err := dao.GetNotificationsAfter(0, 100)
+	assert.Empty(t, err)
+	assert.Len(t, ns, 2)
+
+	m = newTestManager(dao, h)
+	err = m.Start()
+	assert.Empty(t, err)
+	defer m.Stop()
+	rc.wait(t)
+	rc.wait(t)
+	rc.lock.Lock()
+	var ids []uint64
+	for _, body := range rc.bodies {
+		var e notify.Event
+		err = json.Unmarshal(body, &e)
+		assert.Empty(t, err)
+		ids = append(ids, e.ID)
+	}
+	rc.lock.Unlock()
+	assert.EqualValues(t, []uint64{1, 2, 3}, ids)
+	for i := 0; i < 100; i++ {
+		ns, err = dao.GetNotificationsAfter(0, 100)
+		if len(ns) == 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Empty(t, err)
+	assert.Len(t, ns, 0)
+	assert.EqualValues(t, 3, h.AckedEventID(notify.ConsumerWebhook))
+}
+
+func TestWebhookDeliverDue(t *testing.T) {
+	dao := codefortest.NewTestDB("")
+	defer dao.CloseDB()
+	dead := newReceiver(100)
+	deadServer := httptest.NewServer(dead)
+	defer deadServer.Close()
+	alive := newReceiver(0)
+	aliveServer := httptest.NewServer(alive)
+	defer aliveServer.Close()
+
+	m := newTestManager(dao, notify.NewNotifyHandler())
+	m.hooks["dead"] = &models.Webhook{ID: "dead", URL: deadServer.URL}
+	m.hooks["alive"] = &models.Webhook{ID: "alive", URL: aliveServer.URL}
+	for _, id := range []string{"dead", "alive"} {
+		for i := uint64(1); i <= 3; i++ {
+			d := &models.WebhookDelivery{
+				Key:       fmt.Sprintf("%s-%d", id, i),
+				WebhookID: id,
+				EventID:   i,
+				Payload:   []byte(`{}`),
+				Status:    models.WebhookDeliveryPending,
+			}
+			m.deliveries[d.Key] = d
+		}
+	}
+	m.deliverDue()
+	// the dead one is not retried in this round, and doesn't block the alive one
+	dead.lock.Lock()
+	assert.EqualValues(t, 1, dead.requests)
+	dead.lock.Unlock()
+	alive.lock.Lock()
+	assert.Len(t, alive.bodies, 3)
+	alive.lock.Unlock()
+	assert.Len(t, m.deliveries, 3)
+	assert.EqualValues(t, 1, m.deliveries["dead-1"].Attempts)
+	assert.EqualValues(t, 0, m.deliveries["dead-2"].Attempts)
+}
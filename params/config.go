@@ -71,6 +71,15 @@ type Config struct {
 	PfsHost                   string // pathfinder server host
 	HTTPUsername              string
 	HTTPPassword              string
+	APITLSCert                string // certificate file of https api
+	APITLSKey                 string // private key file of https api
+	RPCSocket                 string // unix socket of JSON-RPC, disabled if empty
+	AutoSettle                bool   // settle closed channels automatically when settle timeout passed
+	WatchTower                bool   // accept delegations and protect channels of other nodes
+	BackupDir                 string // copy encrypted channel backup to this directory, for example a mounted remote disk
+	BackupURL                 string // PUT encrypted channel backup to this url
+	HoldIncomingTransfers     bool   // hold all transfers received as target until user accepts or cancels them
+	EncryptTransferData       bool   // encrypt data of transfers with public key of target
 }
 
 //DefaultConfig default config
@@ -193,3 +193,57 @@ var ForkConfirmNumber int64 = 17
 
 // MaxTransferDataLen : 交易附件信息最大长度
 var MaxTransferDataLen = 256
+
+// MaxDirectTransferDataLen : 直接交易附件信息最大长度, 直接交易的附件信息只需要在 DirectTransfer 中发送一次, 加密以后也不会超过 UDPMaxMessageSize
+var MaxDirectTransferDataLen = 768
+
+// DefaultContractEventsLimit : 查询合约事件时每页默认返回的事件数
+const DefaultContractEventsLimit = 100
+
+// MaxContractEventsLimit : 查询合约事件时每页最多返回的事件数
+const MaxContractEventsLimit = 1000
+
+// ContractEventsBackfillStep : 补齐历史合约事件时每次查询的块数
+const ContractEventsBackfillStep = 10000
+
+// ContractEventsBackfillRetryInterval : 补齐历史合约事件失败以后重试的间隔
+const ContractEventsBackfillRetryInterval = 10 * time.Second
+
+// NotificationHistorySize : 没有任何消费者时 outbox 中保留的最近通知数, 与 notify.DefaultEventHistorySize 一致
+var NotificationHistorySize uint64 = 1024
+
+// MaxNotificationOutboxSize : outbox 中最多保留的通知数, 消费者长期不确认时更早的通知会被删除
+const MaxNotificationOutboxSize uint64 = 100000
+
+// LiquidityCheckInterval : 检查通道余额是否符合流动性规则的间隔
+const LiquidityCheckInterval = time.Minute
+
+// LiquidityTxInterval : 流动性规则触发的两次链上交易(存款/取款)的最小间隔
+const LiquidityTxInterval = time.Minute
+
+// LiquidityChannelCooldown : 流动性规则调整同一个通道的最小间隔
+const LiquidityChannelCooldown = 10 * time.Minute
+
+// AutoSettleRetryBlocks : 自动 unlock/settle 失败以后,间隔多少块再次尝试
+const AutoSettleRetryBlocks = 10
+
+// PunishBlockNumber : 与合约 punish_block_number 一致, settle_block_number 以后还要再等这么多块才能 settle
+const PunishBlockNumber = 257
+
+// WatchTowerRetryBlocks : watchtower 链上交易失败以后,间隔多少块再次尝试
+const WatchTowerRetryBlocks = 5
+
+// BackupPushTimeout : 上传通道备份到 http 服务器的超时时间
+const BackupPushTimeout = 30 * time.Second
+
+// DefaultMultiPathMaxParts : 多路径支付默认最多分成几个部分
+const DefaultMultiPathMaxParts = 3
+
+// MaxMultiPathParts : 多路径支付最多分成几个部分
+const MaxMultiPathParts = 8
+
+// DefaultInvoiceExpiry : 收款请求默认的有效期
+const DefaultInvoiceExpiry = time.Hour
+
+// MaxInvoiceRouteHints : 收款请求中最多包含几个路由提示
+const MaxInvoiceRouteHints = 8
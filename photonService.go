@@ -32,6 +32,7 @@ import (
 	"github.com/SmartMeshFoundation/Photon/network/rpc/contracts"
 	"github.com/SmartMeshFoundation/Photon/network/rpc/fee"
 	"github.com/SmartMeshFoundation/Photon/notify"
+	"github.com/SmartMeshFoundation/Photon/notify/webhook"
 	"github.com/SmartMeshFoundation/Photon/params"
 	"github.com/SmartMeshFoundation/Photon/pfsproxy"
 	"github.com/SmartMeshFoundation/Photon/rerr"
@@ -86,6 +87,14 @@ type Service struct {
 	dao                      models.Dao
 	FeePolicy                fee.Charger //Mediation fee
 	NotifyHandler            *notify.Handler
+	Webhooks                 *webhook.Manager
+	ConnectionManager        *connectionManager
+	LiquidityManager         *liquidityManager
+	AutoSettler              *autoSettler
+	WatchTower               *watchTower
+	ChannelBackup            *channelBackupManager
+	Drain                    *drainManager
+	MediationLimiter         *mediationLimiter
 	PfsProxy                 pfsproxy.PfsProxy
 
 	/*
@@ -125,10 +134,12 @@ type Service struct {
 	ReceivedMediatedTrasnferListenerMap   map[*ReceivedMediatedTrasnferListener]bool //for tokenswap
 	SentMediatedTransferListenerMap       map[*SentMediatedTransferListener]bool     //for tokenswap
 	HealthCheckMap                        map[common.Address]bool
+	HoldLockSecretHashMap                 map[common.Hash]bool // incoming transfers with these lock secret hashes are held until user accepts or cancels
 	quitChan                              chan struct{} //for quit notification
 	isStarting                            bool
 	StopCreateNewTransfers                bool // 是否停止接收新交易,默认false,目前仅在用户调用prepare-update接口的时候,会被置为true,直到重启		// boolean to check whether stop receiving new transfers, default to false. Currently it sets to true when clients invoke prepare-update, till it reconnects.
 	EthConnectionStatus                   chan netshare.Status
+	TransportConnectionStatus             chan netshare.Status
 	ChanHistoryContractEventsDealComplete chan struct{}
 }
 
@@ -157,10 +168,12 @@ func NewPhotonService(chain *rpc.BlockChainService, privateKey *ecdsa.PrivateKey
 		ReceivedMediatedTrasnferListenerMap:   make(map[*ReceivedMediatedTrasnferListener]bool),
 		SentMediatedTransferListenerMap:       make(map[*SentMediatedTransferListener]bool),
 		HealthCheckMap:                        make(map[common.Address]bool),
+		HoldLockSecretHashMap:                 make(map[common.Hash]bool),
 		quitChan:                              make(chan struct{}),
 		isStarting:                            true,
 		StopCreateNewTransfers:                false,
 		EthConnectionStatus:                   make(chan netshare.Status, 10),
+		TransportConnectionStatus:             make(chan netshare.Status, 10),
 		ChanHistoryContractEventsDealComplete: make(chan struct{}),
 	}
 	rs.BlockNumber.Store(int64(0))
@@ -176,6 +189,15 @@ func NewPhotonService(chain *rpc.BlockChainService, privateKey *ecdsa.PrivateKey
 		}
 	}
 	rs.Protocol.SetReceivedMessageSaver(NewAckHelper(rs.dao))
+	rs.NotifyHandler.SetNotificationDao(rs.dao)
+	rs.Webhooks = webhook.NewManager(rs.dao, rs.NotifyHandler)
+	rs.ConnectionManager = newConnectionManager(rs)
+	rs.LiquidityManager = newLiquidityManager(rs)
+	rs.AutoSettler = newAutoSettler(rs)
+	rs.WatchTower = newWatchTower(rs)
+	rs.ChannelBackup = newChannelBackupManager(rs)
+	rs.Drain = newDrainManager(rs)
+	rs.MediationLimiter = newMediationLimiter(rs)
 	/*
 		only one instance for one data directory
 	*/
@@ -192,6 +214,7 @@ func NewPhotonService(chain *rpc.BlockChainService, privateKey *ecdsa.PrivateKey
 		return
 	}
 	rs.BlockChainEvents = blockchain.NewBlockChainEvents(chain.Client, chain)
+	rs.BlockChainEvents.SetContractEventDao(rs.dao)
 	// fee module
 	if config.EnableMediationFee {
 		// pathfinder
@@ -222,6 +245,19 @@ func (rs *Service) Start() (err error) {
 	if err != nil {
 		return
 	}
+	rs.registerChannelStatusNotify()
+	err = rs.interruptBatchTransfers()
+	if err != nil {
+		return
+	}
+	err = rs.loadHoldLockSecretHashes()
+	if err != nil {
+		return
+	}
+	err = rs.Webhooks.Start()
+	if err != nil {
+		return
+	}
 	//在主循环开启之前,protocol层要准备好,可以发送消息,但是不能接收消息
 	rs.Protocol.Start(false)
 	//restore 一定要在历史事件处理之前进行,比如链上注册密码事件,需要相应的statemanager发送unlock消息
@@ -281,6 +317,7 @@ func (rs *Service) Start() (err error) {
 	//
 	rs.isStarting = false
 	rs.startNeighboursHealthCheck()
+	rs.startNotifyTransportStatus()
 	// 只有在混合模式下启动时,才订阅其他节点的在线状态
 	// Only when starting under MixUDPXMPP, we can subscribe online status of other nodes.
 	if rs.Config.NetworkMode == params.MixUDPXMPP || rs.Config.NetworkMode == params.MixUDPMatrix {
@@ -290,6 +327,18 @@ func (rs *Service) Start() (err error) {
 			return
 		}
 	}
+	// 历史事件处理完毕,通道状态是最新的,才能调整加入的 token 网络的通道
+	err = rs.ConnectionManager.start()
+	if err != nil {
+		err = fmt.Errorf("start connection manager err %s", err)
+		return
+	}
+	rs.LiquidityManager.start()
+	err = rs.ChannelBackup.start()
+	if err != nil {
+		err = fmt.Errorf("start channel backup err %s", err)
+		return
+	}
 	return nil
 }
 
@@ -300,6 +349,7 @@ func (rs *Service) Stop() {
 	rs.Protocol.StopAndWait()
 	rs.BlockChainEvents.Stop()
 	rs.Chain.Client.Close()
+	rs.Webhooks.Stop()
 	rs.NotifyHandler.Stop()
 	time.Sleep(100 * time.Millisecond) // let other goroutines quit
 	rs.dao.CloseDB()
@@ -392,6 +442,7 @@ func (rs *Service) loop() {
 			default:
 				//never block
 			}
+			rs.NotifyHandler.NotifyEthStatus(s)
 			if s == netshare.Connected {
 				rs.handleEthRPCConnectionOK()
 			} else {
@@ -751,12 +802,18 @@ func (rs *Service) directTransferAsync(tokenAddress, target common.Address, amou
 		result.Result <- errors.New("no available direct channel")
 		return
 	}
+	//加密失败就不发送了,不能把附加信息以明文发出去
+	encryptedData, err := rs.encryptTransferData(target, data)
+	if err != nil {
+		result.Result <- err
+		return
+	}
 	tr, err := directChannel.CreateDirectTransfer(amount)
 	if err != nil {
 		result.Result <- err
 		return
 	}
-	tr.Data = []byte(data)
+	tr.Data = []byte(encryptedData)
 	err = tr.Sign(rs.PrivateKey, tr)
 	err = directChannel.RegisterTransfer(rs.GetBlockNumber(), tr)
 	if err != nil {
@@ -827,25 +884,28 @@ Calls:
  *			2.1 taker should contain lockSecretHash, but no secret.
  *			2.2 maker should contain lockSecretHash and secret.
  */
-func (rs *Service) startMediatedTransferInternal(tokenAddress, target common.Address, amount *big.Int, fee *big.Int, lockSecretHash common.Hash, expiration int64, secret common.Hash, data string) (result *utils.AsyncResult, stateManager *transfer.StateManager) {
+func (rs *Service) startMediatedTransferInternal(tokenAddress, target common.Address, amount *big.Int, fee *big.Int, lockSecretHash common.Hash, expiration int64, secret common.Hash, data string, encryptedSecret []byte, routeHints []common.Address) (result *utils.AsyncResult, stateManager *transfer.StateManager) {
 	var availableRoutes []*route.State
 	var err error
 	targetAmount := new(big.Int).Sub(amount, fee)
 	result = utils.NewAsyncResult()
+	g := rs.getToken2ChannelGraph(tokenAddress)
+	if g == nil {
+		result.Result <- errors.New("token not exist")
+		return
+	}
 	if rs.PfsProxy != nil {
 		availableRoutes, err = rs.getBestRoutesFromPfs(rs.NodeAddress, target, tokenAddress, targetAmount, true)
-		if err != nil {
+		if err != nil && len(routeHints) == 0 {
 			result.Result <- errors.New("get route from pathfinder failed")
 			return
 		}
 	} else {
-		g := rs.getToken2ChannelGraph(tokenAddress)
-		if g == nil {
-			result.Result <- errors.New("token not exist")
-			return
-		}
 		availableRoutes = g.GetBestRoutes(rs.Protocol, rs.NodeAddress, target, amount, targetAmount, graph.EmptyExlude, rs)
 	}
+	if len(availableRoutes) == 0 {
+		availableRoutes = rs.routesFromHints(g, amount, targetAmount, routeHints)
+	}
 	//log.Trace(fmt.Sprintf("availableRoutes=%s", utils.StringInterface(availableRoutes, 3)))
 	if len(availableRoutes) <= 0 {
 		result.Result <- errors.New("no available route")
@@ -865,16 +925,17 @@ func (rs *Service) startMediatedTransferInternal(tokenAddress, target common.Add
 	}
 	routesState := route.NewRoutesState(availableRoutes)
 	transferState := &mediatedtransfer.LockedTransferState{
-		TargetAmount:   new(big.Int).Set(amount),
-		Amount:         new(big.Int).Set(amount),
-		Token:          tokenAddress,
-		Initiator:      rs.NodeAddress,
-		Target:         target,
-		Expiration:     expiration,
-		LockSecretHash: lockSecretHash,
-		Secret:         secret,
-		Fee:            utils.BigInt0,
-		Data:           data,
+		TargetAmount:    new(big.Int).Set(amount),
+		Amount:          new(big.Int).Set(amount),
+		Token:           tokenAddress,
+		Initiator:       rs.NodeAddress,
+		Target:          target,
+		Expiration:      expiration,
+		LockSecretHash:  lockSecretHash,
+		Secret:          secret,
+		Fee:             utils.BigInt0,
+		Data:            data,
+		EncryptedSecret: encryptedSecret,
 	}
 	/*
 		发起方每次切换路径不再切换密码,不切换依然可以保证安全
@@ -937,7 +998,7 @@ func (rs *Service) startMediatedTransfer(tokenAddress, target common.Address, am
 		发起方在这里记录发起的交易状态,后续UpdateTransferStatus会更新DB中的值
 	*/
 	rs.dao.NewTransferStatus(tokenAddress, lockSecretHash)
-	result, _ = rs.startMediatedTransferInternal(tokenAddress, target, amount, fee, lockSecretHash, 0, secret, data)
+	result, _ = rs.startMediatedTransferInternal(tokenAddress, target, amount, fee, lockSecretHash, 0, secret, data, nil, nil)
 	result.LockSecretHash = lockSecretHash
 	return
 }
@@ -984,17 +1045,27 @@ func (rs *Service) mediateMediatedTransfer(msg *encoding.MediatedTransfer, ch *c
 	} else {
 		ourAddress := rs.NodeAddress
 		exclude := graph.MakeExclude(msg.Sender, msg.Initiator)
+		if msg.Initiator == msg.Target {
+			//环形交易,发起方就是接收方,不能排除
+			exclude = graph.MakeExclude(msg.Sender)
+		}
 		var avaiableRoutes []*route.State
-		if rs.PfsProxy != nil {
-			var err error
-			avaiableRoutes, err = rs.getBestRoutesFromPfs(rs.NodeAddress, targetAddr, tokenAddress, targetAmount, false)
-			if err != nil {
-				log.Error(fmt.Sprintf("get route from pathfinder failed, err = %s", err.Error()))
+		if rs.Drain.isDraining() {
+			//正在退出,没有路由的中间节点会 AnnounceDisposed
+			log.Info(fmt.Sprintf("draining, reject mediated transfer %s", msg.LockSecretHash.String()))
+		} else if rs.MediationLimiter.admit(msg, ch, rs.GetBlockNumber()) == "" {
+			//超过了通道的限制时不查找路由,同样由 mediator AnnounceDisposed
+			if rs.PfsProxy != nil {
+				var err error
+				avaiableRoutes, err = rs.getBestRoutesFromPfs(rs.NodeAddress, targetAddr, tokenAddress, targetAmount, false)
+				if err != nil {
+					log.Error(fmt.Sprintf("get route from pathfinder failed, err = %s", err.Error()))
+				}
+			} else {
+				g := rs.getToken2ChannelGraph(ch.TokenAddress) //must exist
+				//log.Trace(fmt.Sprintf("g=%s", utils.StringInterface(g, 7)))
+				avaiableRoutes = g.GetBestRoutes(rs.Protocol, rs.NodeAddress, targetAddr, amount, targetAmount, exclude, rs)
 			}
-		} else {
-			g := rs.getToken2ChannelGraph(ch.TokenAddress) //must exist
-			//log.Trace(fmt.Sprintf("g=%s", utils.StringInterface(g, 7)))
-			avaiableRoutes = g.GetBestRoutes(rs.Protocol, rs.NodeAddress, targetAddr, amount, targetAmount, exclude, rs)
 		}
 		routesState := route.NewRoutesState(avaiableRoutes)
 		blockNumber := rs.GetBlockNumber()
@@ -1033,11 +1104,22 @@ func (rs *Service) targetMediatedTransfer(msg *encoding.MediatedTransfer, ch *ch
 		log.Error(fmt.Sprintf("receive a lock secret hash,and it's my annouce disposed. %s", msg.LockSecretHash.String()))
 		return
 	}
+	if stateManager != nil && stateManager.Name == initiator.NameInitiatorTransition && msg.Initiator == rs.NodeAddress {
+		rs.circularTransferReturned(msg, ch, stateManager)
+		return
+	}
+	//正在退出,不再接收新的锁,由接收方直接 AnnounceDisposed, 多路径支付的后续部分也一样
+	refuse := rs.Drain.isDraining()
 	if stateManager != nil {
 		if stateManager.Name != target.NameTargetTransition {
 			log.Error(fmt.Sprintf("receive mediator transfer,but i'm not a target,msg=%s,stateManager=%s", msg, utils.StringInterface(stateManager, 3)))
 			return
 		}
+		if _, ok := stateManager.CurrentState.(*mediatedtransfer.MultiPathTargetState); ok && msg.TotalAmount != nil {
+			//多路径支付的另一个部分
+			rs.multiPathPartReceived(msg, ch, stateManager, refuse)
+			return
+		}
 		log.Error(fmt.Sprintf("receive mediator transfer msg=%s,duplicate? attack?,i'm a target,and has received mediator message. statemanager=%s",
 			msg, utils.StringInterface(stateManager, 3)))
 		return
@@ -1058,10 +1140,27 @@ func (rs *Service) targetMediatedTransfer(msg *encoding.MediatedTransfer, ch *ch
 		BlockNumber: rs.GetBlockNumber(),
 		Message:     msg,
 		Db:          rs.dao,
+		Refuse:      refuse,
 	}
 	stateManager = transfer.NewStateManager(target.StateTransiton, nil, target.NameTargetTransition, fromTransfer.LockSecretHash, fromTransfer.Token)
 	//rs.dao.AddStateManager(stateManager)
 	rs.Transfer2StateManager[smkey] = stateManager
+	if refuse {
+		log.Info(fmt.Sprintf("draining, refuse transfer %s from %s", utils.HPex(msg.LockSecretHash), utils.APex2(msg.Sender)))
+		rs.StateMachineEventHandler.dispatch(stateManager, initTarget)
+		return
+	}
+	if msg.TotalAmount == nil {
+		initTarget.Secret = rs.invoiceSecret(msg, ch.TokenAddress)
+		if initTarget.Secret == utils.EmptyHash && len(msg.EncryptedSecret) > 0 {
+			initTarget.Secret = rs.keysendSecret(msg)
+		}
+		initTarget.Hold = rs.Config.HoldIncomingTransfers || rs.HoldLockSecretHashMap[msg.LockSecretHash]
+	}
+	if msg.TotalAmount != nil || initTarget.Secret != utils.EmptyHash {
+		//多路径支付的部分,我的收款请求以及 keysend 都不一定会发送 SecretRequest,收到就确认
+		rs.updateChannelAndSaveAck(ch, msg.Tag())
+	}
 	rs.StateMachineEventHandler.dispatch(stateManager, initTarget)
 	// notify upper
 	rs.NotifyHandler.NotifyReceiveMediatedTransfer(msg, ch)
@@ -1112,6 +1211,69 @@ func (rs *Service) startSubscribeNeighborStatus() error {
 	}
 	return err
 }
+
+/*
+channel status changes saved by dao are pushed to the subscribers of NotifyHandler,
+these callbacks are never removed.
+*/
+func (rs *Service) registerChannelStatusNotify() {
+	rs.dao.RegisterNewChannelCallback(func(c *channeltype.Serialization) (remove bool) {
+		rs.NotifyHandler.NotifyChannelStatus(notify.EventTypeChannelNew, c)
+		return false
+	})
+	rs.dao.RegisterChannelDepositCallback(func(c *channeltype.Serialization) (remove bool) {
+		rs.NotifyHandler.NotifyChannelStatus(notify.EventTypeChannelDeposit, c)
+		return false
+	})
+	rs.dao.RegisterChannelStateCallback(func(c *channeltype.Serialization) (remove bool) {
+		rs.NotifyHandler.NotifyChannelStatus(notify.EventTypeChannelState, c)
+		return false
+	})
+	rs.dao.RegisterChannelSettleCallback(func(c *channeltype.Serialization) (remove bool) {
+		rs.NotifyHandler.NotifyChannelStatus(notify.EventTypeChannelSettled, c)
+		return false
+	})
+}
+
+/*
+status chan of transport can only have one reader,
+so forward it to NotifyHandler and TransportConnectionStatus
+*/
+func (rs *Service) startNotifyTransportStatus() {
+	var xn <-chan netshare.Status
+	var err error
+	switch t := rs.Transport.(type) {
+	case *network.MatrixMixTransport:
+		xn, err = t.GetNotify()
+	case *network.MixTransport:
+		xn, err = t.GetNotify()
+	default:
+		return
+	}
+	if err != nil {
+		log.Error(fmt.Sprintf("transport get notify err %s", err))
+		return
+	}
+	go func() {
+		defer rpanic.PanicRecover("startNotifyTransportStatus")
+		for {
+			select {
+			case s, ok := <-xn:
+				if !ok {
+					return
+				}
+				select {
+				case rs.TransportConnectionStatus <- s:
+				default:
+					//never block
+				}
+				rs.NotifyHandler.NotifyTransportStatus(s)
+			case <-rs.quitChan:
+				return
+			}
+		}
+	}()
+}
 func (rs *Service) getToken2ChannelGraph(tokenAddress common.Address) (cg *graph.ChannelGraph) {
 	cg = rs.Token2ChannelGraph[tokenAddress]
 	if cg == nil {
@@ -1354,7 +1516,7 @@ func (rs *Service) tokenSwapMaker(tokenswap *TokenSwap) (result *utils.AsyncResu
 	}
 	rs.SentMediatedTransferListenerMap[&sentMtrHook] = true
 	rs.ReceivedMediatedTrasnferListenerMap[&receiveMtrHook] = true
-	result, _ = rs.startMediatedTransferInternal(tokenswap.FromToken, tokenswap.ToNodeAddress, tokenswap.FromAmount, utils.BigInt0, tokenswap.LockSecretHash, 0, tokenswap.Secret, "")
+	result, _ = rs.startMediatedTransferInternal(tokenswap.FromToken, tokenswap.ToNodeAddress, tokenswap.FromAmount, utils.BigInt0, tokenswap.LockSecretHash, 0, tokenswap.Secret, "", nil, nil)
 	return
 }
 
@@ -1408,7 +1570,7 @@ func (rs *Service) messageTokenSwapTaker(msg *encoding.MediatedTransfer, tokensw
 		taker and maker may have direct channels on these two tokens.
 	*/
 	takerExpiration := msg.Expiration - int64(rs.Config.RevealTimeout)
-	result, stateManager := rs.startMediatedTransferInternal(tokenswap.ToToken, tokenswap.FromNodeAddress, tokenswap.ToAmount, utils.BigInt0, tokenswap.LockSecretHash, takerExpiration, utils.EmptyHash, "")
+	result, stateManager := rs.startMediatedTransferInternal(tokenswap.ToToken, tokenswap.FromNodeAddress, tokenswap.ToAmount, utils.BigInt0, tokenswap.LockSecretHash, takerExpiration, utils.EmptyHash, "", nil, nil)
 	if stateManager == nil {
 		log.Error(fmt.Sprintf("taker tokenwap error %s", <-result.Result))
 		return false
@@ -1636,6 +1798,26 @@ func (rs *Service) handleReq(req *apiReq) {
 	case forceUnlockReqName:
 		r := req.Req.(*forceUnlockReq)
 		result = rs.forceUnlock(r)
+	case rebalanceReqName:
+		r := req.Req.(*rebalanceReq)
+		result = rs.rebalance(r)
+	case multiPathTransferReqName:
+		r := req.Req.(*multiPathTransferReq)
+		result = rs.multiPathTransfer(r)
+	case payInvoiceReqName:
+		r := req.Req.(*payInvoiceReq)
+		result = rs.payInvoice(r)
+	case keysendTransferReqName:
+		r := req.Req.(*keysendTransferReq)
+		result = rs.keysendTransfer(r)
+	case holdTransferReqName:
+		r := req.Req.(*holdTransferReq)
+		result = rs.holdTransfer(r)
+	case getHeldTransfersReqName:
+		result = rs.getHeldTransfers()
+	case acceptHeldTransferReqName, cancelHeldTransferReqName:
+		r := req.Req.(*heldTransferReq)
+		result = rs.acceptOrCancelHeldTransfer(r, req.Name)
 	default:
 		panic("unkown req")
 	}
@@ -282,17 +282,23 @@ func (r *API) Transfer(token common.Address, amount *big.Int, fee *big.Int, targ
 	if err != nil {
 		return
 	}
+	err = r.WaitTransfer(result, timeout)
+	return result, err
+}
+
+// WaitTransfer wait result of transfer started by TransferInternal, wait forever if timeout is 0
+func (r *API) WaitTransfer(result *utils.AsyncResult, timeout time.Duration) (err error) {
 	if timeout > 0 {
 		timeoutCh := time.After(timeout)
 		select {
 		case <-timeoutCh:
-			return result, errors.New("timeout")
+			return rerr.ErrTransferTimeout
 		case err = <-result.Result:
 		}
 	} else {
 		err = <-result.Result
 	}
-	return result, err
+	return
 }
 
 // TransferAsync :
@@ -301,13 +307,19 @@ func (r *API) TransferAsync(tokenAddress common.Address, amount *big.Int, fee *b
 	if err != nil {
 		return
 	}
+	err = r.WaitTransferStarted(result)
+	return result, err
+}
+
+// WaitTransferStarted wait a short time for errors when transfer starting, nil if transfer is still running
+func (r *API) WaitTransferStarted(result *utils.AsyncResult) (err error) {
 	timeoutCh := time.After(300 * time.Millisecond)
 	select {
 	case <-timeoutCh:
-		return result, nil
+		return nil
 	case err = <-result.Result:
 	}
-	return result, err
+	return
 }
 
 //TransferInternal :
@@ -569,153 +581,73 @@ func (r *API) CancelPrepareForWithdraw(tokenAddress, partnerAddress common.Addre
 	return r.Photon.dao.GetChannelByAddress(c.ChannelIdentifier.ChannelIdentifier)
 }
 
-//GetTokenNetworkEvents return events about this token
-func (r *API) GetTokenNetworkEvents(tokenAddress common.Address, fromBlock, toBlock int64) (data []interface{}, err error) {
-	//type eventData struct {
-	//	/*
-	//				 {
-	//		        "event_type": "ChannelNew",
-	//		        "settle_timeout": 10,
-	//		        "netting_channel": "0xc0ea08a2d404d3172d2add29a45be56da40e2949",
-	//		        "participant1": "0x4894a542053248e0c504e3def2048c08f73e1ca6",
-	//		        "participant2": "0x356857Cd22CBEFccDa4e96AF13b408623473237A"
-	//		    }
-	//	*/
-	//	EventType      string `json:"event_type"`
-	//	SettleTimeout  int    `json:"settle_timeout"`
-	//	NettingChannel string `json:"netting_channel"`
-	//	Participant1   string `json:"participant1"`
-	//	Participant2   string `json:"participant2"`
-	//	TokenAddress   string `json:"token_address"`
-	//}
-	//tokens, err := r.Photon.dao.GetAllTokens()
-	//if err != nil {
-	//	return
-	//}
-	//for t, manager := range tokens {
-	//	if tokenAddress == utils.EmptyAddress || t == tokenAddress {
-	//		events, err := r.Photon.BlockChainEvents.GetAllChannelManagerEvents(manager, fromBlock, toBlock)
-	//		if err != nil {
-	//			return nil, err
-	//		}
-	//		for _, e := range events {
-	//			e2 := e.(*blockchain.EventChannelOpen)
-	//			ed := &eventData{
-	//				EventType:      e2.EventName,
-	//				SettleTimeout:  e2.SettleTimeout,
-	//				NettingChannel: e2.NettingChannelAddress.String(),
-	//				Participant1:   e2.Participant1.String(),
-	//				Participant2:   e2.Participant2.String(),
-	//				TokenAddress:   t.String(),
-	//			}
-	//			data = append(data, ed)
-	//		}
-	//	}
-	//}
+/*
+ContractEvents : one page of contract events,
+use NextCursor as cursor to get the next page, NextCursor equals to cursor when there are no more events.
+*/
+type ContractEvents struct {
+	Events     []*models.ContractEvent `json:"events"`
+	NextCursor uint64                  `json:"next_cursor"`
+}
+
+/*
+getContractEvents query contract events from local cache instead of filtering logs on chain,
+events are cached when Photon receives them from chain.
+*/
+func (r *API) getContractEvents(f *models.ContractEventFilter) (result *ContractEvents, err error) {
+	err = r.checkContractEventsCached(f.FromBlock)
+	if err != nil {
+		return
+	}
+	if f.Limit <= 0 {
+		f.Limit = params.DefaultContractEventsLimit
+	}
+	if f.Limit > params.MaxContractEventsLimit {
+		f.Limit = params.MaxContractEventsLimit
+	}
+	events, err := r.Photon.dao.GetContractEvents(f)
+	if err != nil {
+		return
+	}
+	result = &ContractEvents{
+		Events:     events,
+		NextCursor: f.Cursor,
+	}
+	if len(events) > 0 {
+		result.NextCursor = events[len(events)-1].ID
+	} else {
+		result.Events = []*models.ContractEvent{}
+	}
 	return
 }
 
+/*
+checkContractEventsCached events before the block Photon starts caching are fetched in background,
+query from a block not cached yet is refused instead of returning part of events.
+*/
+func (r *API) checkContractEventsCached(fromBlock int64) error {
+	b := r.Photon.dao.GetContractEventBackfill()
+	if b != nil && !b.Covers(fromBlock) {
+		return rerr.InvalidState(fmt.Sprintf("contract events between block %d - %d are still being fetched from chain", b.From, b.To-1))
+	}
+	return nil
+}
+
+//GetTokenNetworkEvents return events about this token
+func (r *API) GetTokenNetworkEvents(tokenAddress common.Address, f *models.ContractEventFilter) (result *ContractEvents, err error) {
+	f.TokenAddress = tokenAddress
+	return r.getContractEvents(f)
+}
+
 //GetNetworkEvents all photon events
-func (r *API) GetNetworkEvents(fromBlock, toBlock int64) ([]interface{}, error) {
-	//type eventData struct {
-	//	/*
-	//				 "event_type": "TokenAdded",
-	//		        "token_address": "0xea674fdde714fd979de3edf0f56aa9716b898ec8",
-	//		        "channel_manager_address": "0xc0ea08a2d404d3172d2add29a45be56da40e2949"
-	//	*/
-	//	EventType             string `json:"event_type"`
-	//	TokenAddress          string `json:"token_address"`
-	//	ChannelManagerAddress string `json:"channel_manager_address"`
-	//}
-	//events, err := r.Photon.BlockChainEvents.GetAllRegistryEvents(r.Photon.RegistryAddress, fromBlock, toBlock)
-	//if err != nil {
-	//	return nil, err
-	//}
-	//var data []interface{}
-	//for _, e := range events {
-	//	e2 := e.(*blockchain.EventTokenNetworkCreated)
-	//	ed := &eventData{
-	//		EventType:             e2.EventName,
-	//		TokenAddress:          e2.TokenAddress.String(),
-	//		ChannelManagerAddress: e2.TokenNetworkAddress.String(),
-	//	}
-	//	data = append(data, ed)
-	//}
-	return nil, nil
+func (r *API) GetNetworkEvents(f *models.ContractEventFilter) (result *ContractEvents, err error) {
+	return r.getContractEvents(f)
 }
 
 //GetChannelEvents events of this channel
-func (r *API) GetChannelEvents(channelIdentifier common.Hash, fromBlock, toBlock int64) (data []transfer.Event, err error) {
-
-	//var events []transfer.Event
-	//events, err = r.Photon.BlockChainEvents.GetAllNettingChannelEvents(channelIdentifier, fromBlock, toBlock)
-	//if err != nil {
-	//	return
-	//}
-	//for _, e := range events {
-	//	m := make(map[string]interface{})
-	//	switch e2 := e.(type) {
-	//	case *blockchain.EventChannelNewBalance:
-	//		m["event_type"] = e2.EventName
-	//		m["participant"] = e2.ParticipantAddress.String()
-	//		m["balance"] = e2.Balance
-	//		m["block_number"] = e2.BlockNumber
-	//		data = append(data, m)
-	//	case *blockchain.EventChannelClosed:
-	//		m["event_type"] = e2.EventName
-	//		m["netting_channel_address"] = e2.ContractAddress.String()
-	//		m["closing_address"] = e2.ClosingAddress.String()
-	//		data = append(data, m)
-	//	case *blockchain.EventChannelSettled:
-	//		m["event_type"] = e2.EventName
-	//		m["netting_channel_address"] = e2.ContractAddress.String()
-	//		m["block_number"] = e2.BlockNumber
-	//		data = append(data, m)
-	//	case *blockchain.EventSecretRevealed:
-	//		m["event_type"] = e2.EventName
-	//		m["netting_channel_address"] = e2.ContractAddress.String()
-	//		m["secret"] = e2.Secret.String()
-	//		data = append(data, m)
-	//		//case *blockchain.EventNonClosingBalanceProofUpdated:
-	//		//	m["event_type"] = e2.EventName
-	//		//	m["token_address"] = t.String()
-	//		//	m["channel_manager_address"] = graph.TokenAddress.String()
-	//	}
-	//
-	//}
-	//
-	//var photonEvents []*models.InternalEvent
-	//photonEvents, err = r.Photon.dao.GetEventsInBlockRange(fromBlock, toBlock)
-	//if err != nil {
-	//	return
-	//}
-	////Here choose which photon internal events we want to expose to the end user
-	//for _, ev := range photonEvents {
-	//	m := make(map[string]interface{})
-	//	switch e2 := ev.EventObject.(type) {
-	//	case *transfer.EventTransferSentSuccess:
-	//		m["event_type"] = "EventTransferSentSuccess"
-	//		m["identifier"] = e2.LockSecretHash
-	//		m["block_number"] = ev.BlockNumber
-	//		m["amount"] = e2.Amount
-	//		m["target"] = e2.Target
-	//		data = append(data, m)
-	//	case *transfer.EventTransferSentFailed:
-	//		m["event_type"] = "EventTransferSentFailed"
-	//		m["identifier"] = e2.LockSecretHash
-	//		m["block_number"] = ev.BlockNumber
-	//		m["reason"] = e2.Reason
-	//		data = append(data, m)
-	//	case *transfer.EventTransferReceivedSuccess:
-	//		m["event_type"] = "EventTransferReceivedSuccess"
-	//		m["identifier"] = e2.LockSecretHash
-	//		m["block_number"] = ev.BlockNumber
-	//		m["amount"] = e2.Amount
-	//		m["initiator"] = e2.Initiator.String()
-	//		data = append(data, m)
-	//	}
-	//}
-	return
+func (r *API) GetChannelEvents(channelIdentifier common.Hash, f *models.ContractEventFilter) (result *ContractEvents, err error) {
+	f.ChannelIdentifier = channelIdentifier
+	return r.getContractEvents(f)
 }
 
 /*
@@ -732,6 +664,20 @@ func (r *API) GetReceivedTransfers(from, to int64) ([]*models.ReceivedTransfer,
 	return r.Photon.dao.GetReceivedTransferInBlockRange(from, to)
 }
 
+/*
+QuerySentTransfers query sent transfers match q from dao
+*/
+func (r *API) QuerySentTransfers(q *models.TransferQuery) ([]*models.SentTransfer, error) {
+	return r.Photon.dao.QuerySentTransfers(q)
+}
+
+/*
+QueryReceivedTransfers query received transfers match q from dao
+*/
+func (r *API) QueryReceivedTransfers(q *models.TransferQuery) ([]*models.ReceivedTransfer, error) {
+	return r.Photon.dao.QueryReceivedTransfers(q)
+}
+
 //Stop stop for mobile app
 func (r *API) Stop() {
 	log.Info("calling api stop..")
@@ -845,20 +791,27 @@ func signBalanceProofFor3rd(c *channeltype.Serialization, privkey *ecdsa.Private
 		log.Error(fmt.Sprintf("PartnerBalanceProof is nil,must ber a error"))
 		return nil, errors.New("empty PartnerBalanceProof")
 	}
+	dataToSign := balanceProofDelegateData(c.PartnerBalanceProof.TransferAmount, c.PartnerBalanceProof.LocksRoot,
+		c.PartnerBalanceProof.Nonce, c.ChannelIdentifier.ChannelIdentifier, c.ChannelIdentifier.OpenBlockNumber)
+	return utils.SignData(privkey, dataToSign)
+}
+
+//balanceProofDelegateData 委托第三方 updateBalanceProofDelegate 时, 非关闭方签名的数据
+func balanceProofDelegateData(transferAmount *big.Int, locksRoot common.Hash, nonce uint64, channelIdentifier common.Hash, openBlockNumber int64) []byte {
+	var err error
 	buf := new(bytes.Buffer)
 	_, err = buf.Write(params.ContractSignaturePrefix)
 	_, err = buf.Write([]byte(params.ContractBalanceProofDelegateMessageLength))
-	_, err = buf.Write(utils.BigIntTo32Bytes(c.PartnerBalanceProof.TransferAmount))
-	_, err = buf.Write(c.PartnerBalanceProof.LocksRoot[:])
-	err = binary.Write(buf, binary.BigEndian, c.PartnerBalanceProof.Nonce)
-	_, err = buf.Write(c.ChannelIdentifier.ChannelIdentifier[:])
-	err = binary.Write(buf, binary.BigEndian, c.ChannelIdentifier.OpenBlockNumber)
+	_, err = buf.Write(utils.BigIntTo32Bytes(transferAmount))
+	_, err = buf.Write(locksRoot[:])
+	err = binary.Write(buf, binary.BigEndian, nonce)
+	_, err = buf.Write(channelIdentifier[:])
+	err = binary.Write(buf, binary.BigEndian, openBlockNumber)
 	_, err = buf.Write(utils.BigIntTo32Bytes(params.ChainID))
 	if err != nil {
 		log.Error(fmt.Sprintf("buf write error %s", err))
 	}
-	dataToSign := buf.Bytes()
-	return utils.SignData(privkey, dataToSign)
+	return buf.Bytes()
 }
 
 func signUnlockFor3rd(c *channeltype.Serialization, u *unlock, thirdAddress common.Address, privkey *ecdsa.PrivateKey) (sig []byte, err error) {
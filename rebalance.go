@@ -0,0 +1,182 @@
+package photon
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/SmartMeshFoundation/Photon/channel"
+	"github.com/SmartMeshFoundation/Photon/encoding"
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/network/graph"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/transfer"
+	"github.com/SmartMeshFoundation/Photon/transfer/mediatedtransfer"
+	"github.com/SmartMeshFoundation/Photon/transfer/mediatedtransfer/initiator"
+	"github.com/SmartMeshFoundation/Photon/transfer/route"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+rebalance 通过环形交易在链下调整通道余额:
+从 FromChannel 转出,经过其他节点以后从 ToChannel 回到我这里,
+FromChannel 中我的余额减少 Amount+手续费, ToChannel 中我的余额增加 Amount, 手续费不超过 MaxFee.
+*/
+func (rs *Service) rebalance(req *rebalanceReq) (result *utils.AsyncResult) {
+	result = utils.NewAsyncResult()
+	if rs.Config.IsMeshNetwork {
+		result.Result <- errors.New("no mediated transfer on mesh only network")
+		return
+	}
+	from := rs.getChannelWithAddr(req.FromChannel)
+	if from == nil {
+		result.Result <- rerr.ChannelNotFound(req.FromChannel.String())
+		return
+	}
+	to := rs.getChannelWithAddr(req.ToChannel)
+	if to == nil {
+		result.Result <- rerr.ChannelNotFound(req.ToChannel.String())
+		return
+	}
+	if from.TokenAddress != to.TokenAddress || from.PartnerState.Address == to.PartnerState.Address {
+		result.Result <- errors.New("rebalance needs two channels of the same token with different partners")
+		return
+	}
+	if !from.CanTransfer() || !to.CanTransfer() {
+		result.Result <- errors.New("channel cannot transfer now")
+		return
+	}
+	token := from.TokenAddress
+	firstHop := from.PartnerState.Address
+	lastHop := to.PartnerState.Address
+	if _, isOnline := rs.Protocol.GetNetworkStatus(firstHop); !isOnline {
+		result.Result <- fmt.Errorf("partner %s of channel %s is offline", utils.APex2(firstHop), utils.HPex(req.FromChannel))
+		return
+	}
+	r, err := rs.circularRoute(token, firstHop, lastHop, req.Amount)
+	if err != nil {
+		log.Info(fmt.Sprintf("no circular route from %s to %s err %s", utils.APex2(firstHop), utils.APex2(lastHop), err))
+		result.Result <- rerr.ErrNoPathError
+		return
+	}
+	if r.TotalFee.Cmp(req.MaxFee) > 0 {
+		result.Result <- fmt.Errorf("fee %s of rebalance exceeds max fee %s", r.TotalFee, req.MaxFee)
+		return
+	}
+	if r.AvailableBalance().Cmp(new(big.Int).Add(req.Amount, r.TotalFee)) < 0 {
+		result.Result <- rerr.ErrInsufficientBalance
+		return
+	}
+	secret := utils.NewRandomHash()
+	lockSecretHash := utils.ShaSecret(secret[:])
+	result.LockSecretHash = lockSecretHash
+	rs.dao.NewTransferStatus(token, lockSecretHash)
+	transferState := &mediatedtransfer.LockedTransferState{
+		TargetAmount:   new(big.Int).Set(req.Amount),
+		Amount:         new(big.Int).Set(req.Amount),
+		Token:          token,
+		Initiator:      rs.NodeAddress,
+		Target:         rs.NodeAddress,
+		LockSecretHash: lockSecretHash,
+		Secret:         secret,
+		Fee:            utils.BigInt0,
+	}
+	initInitiator := &mediatedtransfer.ActionInitInitiatorStateChange{
+		OurAddress:     rs.NodeAddress,
+		Tranfer:        transferState,
+		Routes:         route.NewRoutesState([]*route.State{r}),
+		BlockNumber:    rs.GetBlockNumber(),
+		Secret:         secret,
+		LockSecretHash: lockSecretHash,
+		Db:             rs.dao,
+		LastHop:        lastHop,
+	}
+	stateManager := transfer.NewStateManager(initiator.StateTransition, nil, initiator.NameInitiatorTransition, lockSecretHash, token)
+	smkey := utils.Sha3(lockSecretHash[:], token[:])
+	rs.Transfer2StateManager[smkey] = stateManager
+	rs.Transfer2Result[smkey] = result
+	rs.StateMachineEventHandler.dispatch(stateManager, initInitiator)
+	return
+}
+
+/*
+circularRoute 只经过 firstHop 出去,经过 lastHop 回到我这里的路由,
+有 PFS 时从 PFS 查询 firstHop 到 lastHop 的路径,再加上 lastHop 的手续费.
+*/
+func (rs *Service) circularRoute(token, firstHop, lastHop common.Address, amount *big.Int) (r *route.State, err error) {
+	if rs.PfsProxy == nil {
+		g := rs.getToken2ChannelGraph(token)
+		if g == nil {
+			return nil, errors.New("token not exist")
+		}
+		return g.CircularRoute(firstHop, lastHop, amount, rs)
+	}
+	paths, err := rs.PfsProxy.FindPath(firstHop, lastHop, token, amount, false)
+	if err != nil {
+		return
+	}
+	for _, path := range paths {
+		if path.Fee == nil || pathContains(path.Result, rs.NodeAddress) {
+			continue
+		}
+		r = route.NewState(rs.getChannel(token, firstHop))
+		r.Fee = rs.FeePolicy.GetNodeChargeFee(firstHop, token, amount)
+		r.TotalFee = new(big.Int).Add(path.Fee, rs.FeePolicy.GetNodeChargeFee(lastHop, token, amount))
+		return
+	}
+	return nil, rerr.ErrNoPathError
+}
+
+func pathContains(path []string, addr common.Address) bool {
+	for _, a := range path {
+		if common.HexToAddress(a) == addr {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+circularTransferReturned 环形交易回到了我这里,我是发起方同时也是接收方,
+交给发起方的 StateManager 处理,它会验证是否从指定的 LastHop 回来.
+*/
+func (rs *Service) circularTransferReturned(msg *encoding.MediatedTransfer, ch *channel.Channel, stateManager *transfer.StateManager) {
+	//通道中已经有了这个锁,保存通道并确认消息
+	rs.updateChannelAndSaveAck(ch, msg.Tag())
+	fromRoute := graph.Channel2RouteState(ch, msg.Sender, msg.PaymentAmount, rs)
+	fromTransfer := mediatedtransfer.LockedTransferFromMessage(msg, ch.TokenAddress)
+	initTarget := &mediatedtransfer.ActionInitTargetStateChange{
+		OurAddress:  rs.NodeAddress,
+		FromRoute:   fromRoute,
+		FromTranfer: fromTransfer,
+		BlockNumber: rs.GetBlockNumber(),
+		Message:     msg,
+		Db:          rs.dao,
+	}
+	rs.StateMachineEventHandler.dispatch(stateManager, initTarget)
+}
+
+/*
+Rebalance moves amount from channel fromChannel to channel toChannel of the same token off-chain,
+by a mediated transfer from us to us, which leaves through fromChannel and returns through toChannel.
+Fee paid to mediators is at most maxFee.
+*/
+func (r *API) Rebalance(fromChannel, toChannel common.Hash, amount, maxFee *big.Int) (result *utils.AsyncResult, err error) {
+	if r.Photon.StopCreateNewTransfers {
+		return nil, rerr.ErrStopCreateNewTransfer
+	}
+	if amount == nil || amount.Cmp(utils.BigInt0) <= 0 {
+		return nil, rerr.ErrInvalidAmount
+	}
+	if maxFee == nil {
+		maxFee = utils.BigInt0
+	}
+	if maxFee.Cmp(utils.BigInt0) < 0 {
+		return nil, errors.New("invalid max fee")
+	}
+	log.Debug(fmt.Sprintf("rebalance from channel %s to channel %s amount=%s maxFee=%s",
+		fromChannel.String(), toChannel.String(), amount, maxFee))
+	result = r.Photon.rebalanceClient(fromChannel, toChannel, amount, maxFee)
+	return
+}
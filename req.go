@@ -3,6 +3,7 @@ package photon
 import (
 	"math/big"
 
+	"github.com/SmartMeshFoundation/Photon/models"
 	"github.com/SmartMeshFoundation/Photon/utils"
 	"github.com/ethereum/go-ethereum/common"
 )
@@ -46,6 +47,14 @@ const allowRevealSecretReqName = "AllowRevealSecret"
 const registerSecretReqName = "RegisterSecret"
 const getUnfinishedReceviedTransferReqName = "GetUnfinishedReceivedTransfer"
 const forceUnlockReqName = "ForceUnlock"
+const rebalanceReqName = "Rebalance"
+const multiPathTransferReqName = "MultiPathTransfer"
+const payInvoiceReqName = "PayInvoice"
+const keysendTransferReqName = "KeysendTransfer"
+const holdTransferReqName = "HoldTransfer"
+const getHeldTransfersReqName = "GetHeldTransfers"
+const acceptHeldTransferReqName = "AcceptHeldTransfer"
+const cancelHeldTransferReqName = "CancelHeldTransfer"
 
 /*
 transfer api
@@ -350,3 +359,130 @@ func (rs *Service) forceUnlockClient(lockSecretHash, secret, channelIdentifier c
 	}
 	return rs.sendReqClient(req)
 }
+
+type rebalanceReq struct {
+	FromChannel common.Hash
+	ToChannel   common.Hash
+	Amount      *big.Int
+	MaxFee      *big.Int
+}
+
+func (rs *Service) rebalanceClient(fromChannel, toChannel common.Hash, amount, maxFee *big.Int) *utils.AsyncResult {
+	req := &apiReq{
+		ReqID: utils.RandomString(10),
+		Name:  rebalanceReqName,
+		Req: &rebalanceReq{
+			FromChannel: fromChannel,
+			ToChannel:   toChannel,
+			Amount:      amount,
+			MaxFee:      maxFee,
+		},
+	}
+	return rs.sendReqClient(req)
+}
+
+type multiPathTransferReq struct {
+	TokenAddress common.Address
+	Amount       *big.Int
+	Target       common.Address
+	MaxParts     int
+	Data         string
+}
+
+func (rs *Service) multiPathTransferClient(token common.Address, amount *big.Int, target common.Address, maxParts int, data string) *utils.AsyncResult {
+	req := &apiReq{
+		ReqID: utils.RandomString(10),
+		Name:  multiPathTransferReqName,
+		Req: &multiPathTransferReq{
+			TokenAddress: token,
+			Amount:       amount,
+			Target:       target,
+			MaxParts:     maxParts,
+			Data:         data,
+		},
+	}
+	return rs.sendReqClient(req)
+}
+
+type payInvoiceReq struct {
+	Invoice *models.Invoice
+}
+
+func (rs *Service) payInvoiceClient(inv *models.Invoice) *utils.AsyncResult {
+	req := &apiReq{
+		ReqID: utils.RandomString(10),
+		Name:  payInvoiceReqName,
+		Req: &payInvoiceReq{
+			Invoice: inv,
+		},
+	}
+	return rs.sendReqClient(req)
+}
+
+type keysendTransferReq struct {
+	TokenAddress    common.Address
+	Amount          *big.Int
+	Target          common.Address
+	Secret          common.Hash
+	EncryptedSecret []byte
+	Data            string
+}
+
+func (rs *Service) keysendTransferClient(token common.Address, amount *big.Int, target common.Address, secret common.Hash, encryptedSecret []byte, data string) *utils.AsyncResult {
+	req := &apiReq{
+		ReqID: utils.RandomString(10),
+		Name:  keysendTransferReqName,
+		Req: &keysendTransferReq{
+			TokenAddress:    token,
+			Amount:          amount,
+			Target:          target,
+			Secret:          secret,
+			EncryptedSecret: encryptedSecret,
+			Data:            data,
+		},
+	}
+	return rs.sendReqClient(req)
+}
+
+type holdTransferReq struct {
+	LockSecretHash common.Hash
+	Hold           bool
+}
+
+func (rs *Service) holdTransferClient(lockSecretHash common.Hash, hold bool) *utils.AsyncResult {
+	req := &apiReq{
+		ReqID: utils.RandomString(10),
+		Name:  holdTransferReqName,
+		Req: &holdTransferReq{
+			LockSecretHash: lockSecretHash,
+			Hold:           hold,
+		},
+	}
+	return rs.sendReqClient(req)
+}
+
+func (rs *Service) getHeldTransfersClient() *utils.AsyncResult {
+	req := &apiReq{
+		ReqID: utils.RandomString(10),
+		Name:  getHeldTransfersReqName,
+	}
+	return rs.sendReqClient(req)
+}
+
+type heldTransferReq struct {
+	TokenAddress   common.Address
+	LockSecretHash common.Hash
+}
+
+//acceptOrCancelHeldTransferClient name is acceptHeldTransferReqName or cancelHeldTransferReqName
+func (rs *Service) acceptOrCancelHeldTransferClient(name string, token common.Address, lockSecretHash common.Hash) *utils.AsyncResult {
+	req := &apiReq{
+		ReqID: utils.RandomString(10),
+		Name:  name,
+		Req: &heldTransferReq{
+			TokenAddress:   token,
+			LockSecretHash: lockSecretHash,
+		},
+	}
+	return rs.sendReqClient(req)
+}
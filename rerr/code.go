@@ -0,0 +1,92 @@
+package rerr
+
+import "strings"
+
+/*
+codes of errors returned by rpc interface.
+-32768 to -32000 are reserved by JSON-RPC 2.0, errors of photon use positive codes.
+*/
+const (
+	// CodeUnknown errors not defined in rerr, same as JSON-RPC 2.0 server error
+	CodeUnknown               = -32000
+	CodeHashLengthNot32       = 1001
+	CodeChannelNotFound       = 1002
+	CodeInsufficientFunds     = 1003
+	CodeInvalidAddress        = 1004
+	CodeInvalidAmount         = 1005
+	CodeInvalidSettleTimeout  = 1006
+	CodeNoPath                = 1007
+	CodeSamePeerAddress       = 1008
+	CodeInvalidState          = 1009
+	CodeTransferWhenClosed    = 1010
+	CodeUnknownAddress        = 1011
+	CodeInsufficientBalance   = 1012
+	CodeInvalidLocksRoot      = 1013
+	CodeInvalidNonce          = 1014
+	CodeTransferUnwanted      = 1015
+	CodeUnknownTokenAddress   = 1016
+	CodeSTUNUnavailable       = 1017
+	CodeEthNodeCommunication  = 1018
+	CodeAddressWithoutCode    = 1019
+	CodeNoTokenManager        = 1020
+	CodeDuplicatedChannel     = 1021
+	CodeTransactionThrew      = 1022
+	CodeTransferTimeout       = 1023
+	CodeStopCreateNewTransfer = 1024
+	// CodeSpendingCapExceeded spending cap of api token exceeded
+	CodeSpendingCapExceeded = 1025
+	// CodeInsufficientPermission scope of api token is not enough
+	CodeInsufficientPermission = 1026
+)
+
+var errorCodes = map[error]int{
+	ErrHashLengthNot32:           CodeHashLengthNot32,
+	ErrInsufficientFunds:         CodeInsufficientFunds,
+	ErrInvalidAmount:             CodeInvalidAmount,
+	ErrInvalidSettleTimeout:      CodeInvalidSettleTimeout,
+	ErrNoPathError:               CodeNoPath,
+	ErrSamePeerAddress:           CodeSamePeerAddress,
+	ErrInsufficientBalance:       CodeInsufficientBalance,
+	ErrTransferUnwanted:          CodeTransferUnwanted,
+	ErrSTUNUnavailableException:  CodeSTUNUnavailable,
+	ErrEthNodeCommunicationError: CodeEthNodeCommunication,
+	ErrAddressWithoutCode:        CodeAddressWithoutCode,
+	ErrNoTokenManager:            CodeNoTokenManager,
+	ErrDuplicatedChannelError:    CodeDuplicatedChannel,
+	ErrTransferTimeout:           CodeTransferTimeout,
+	ErrStopCreateNewTransfer:     CodeStopCreateNewTransfer,
+}
+
+// errors created by functions of rerr are recognized by their messages
+var errorPrefixCodes = []struct {
+	prefix string
+	code   int
+}{
+	{"ChannelNotFound", CodeChannelNotFound},
+	{"InvalidAddress", CodeInvalidAddress},
+	{"InvalidState", CodeInvalidState},
+	{"TransferWhenClosed", CodeTransferWhenClosed},
+	{"UnknownAddress", CodeUnknownAddress},
+	{"Locksroot mismatch", CodeInvalidLocksRoot},
+	{"InvalidNonce", CodeInvalidNonce},
+	{"UnknownTokenAddress", CodeUnknownTokenAddress},
+}
+
+/*
+ErrorCode returns code of err, CodeUnknown if err is not defined in rerr.
+*/
+func ErrorCode(err error) int {
+	if code, ok := errorCodes[err]; ok {
+		return code
+	}
+	msg := err.Error()
+	for _, p := range errorPrefixCodes {
+		if strings.HasPrefix(msg, p.prefix) {
+			return p.code
+		}
+	}
+	if strings.Contains(msg, " transaction threw. ") {
+		return CodeTransactionThrew
+	}
+	return CodeUnknown
+}
@@ -1,7 +1,11 @@
 package restful
 
 import (
+	"fmt"
+
 	photon "github.com/SmartMeshFoundation/Photon"
+	"github.com/SmartMeshFoundation/Photon/jsonrpc"
+	"github.com/SmartMeshFoundation/Photon/log"
 	"github.com/SmartMeshFoundation/Photon/params"
 	"github.com/SmartMeshFoundation/Photon/restful/v1"
 )
@@ -20,5 +24,15 @@ func Start(API *photon.API, config *params.Config) {
 	v1.Config = config
 	v1.HTTPUsername = config.HTTPUsername
 	v1.HTTPPassword = config.HTTPPassword
+	if config.UseRPC {
+		rpc := jsonrpc.NewPhotonServer(API)
+		v1.RPC = rpc
+		if config.RPCSocket != "" {
+			go func() {
+				err := rpc.ServeUnix(config.RPCSocket)
+				log.Error(fmt.Sprintf("jsonrpc unix socket %s stopped err %s", config.RPCSocket, err))
+			}()
+		}
+	}
 	v1.Start()
 }
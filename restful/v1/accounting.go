@@ -0,0 +1,45 @@
+package v1
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon"
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+/*
+ExportAccounting stream sent transfers, received transfers and mediation fees as csv or jsonl,
+query parameters are the same as GetSentTransfers and `format`
+*/
+func ExportAccounting(w rest.ResponseWriter, r *rest.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = photon.AccountingFormatCSV
+	}
+	var contentType string
+	switch format {
+	case photon.AccountingFormatCSV:
+		contentType = "text/csv"
+	case photon.AccountingFormatJSONL:
+		contentType = "application/x-ndjson"
+	default:
+		rest.Error(w, fmt.Sprintf("unknown format %s", format), http.StatusBadRequest)
+		return
+	}
+	q, err := getTransferQuery(r)
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	hw := w.(http.ResponseWriter)
+	hw.Header().Set("Content-Type", contentType)
+	hw.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=photon-%s.%s", time.Now().Format("20060102150405"), format))
+	// 已经开始输出,无法再返回错误码
+	err = API.ExportAccounting(hw, format, q)
+	if err != nil {
+		log.Error(fmt.Sprintf("ExportAccounting err %s", err))
+	}
+}
@@ -0,0 +1,78 @@
+package v1
+
+import (
+	"fmt"
+	"math/big"
+	"net/http"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// APITokenData post for api tokens
+type APITokenData struct {
+	Name         string                      `json:"name"`
+	Scopes       models.APITokenScope        `json:"scopes"`
+	SpendingCaps map[common.Address]*big.Int `json:"spending_caps,omitempty"`
+}
+
+// newAPITokenResponse token and its secret
+type newAPITokenResponse struct {
+	*models.APIToken
+	Secret string `json:"secret"`
+}
+
+/*
+AddAPIToken create an api token,
+secret is returned only once, keep it to call http api.
+*/
+func AddAPIToken(w rest.ResponseWriter, r *rest.Request) {
+	var err error
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> AddAPIToken ,err=%v", err))
+	}()
+	req := &APITokenData{}
+	err = r.DecodeJsonPayload(req)
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	t, secret, err := API.NewAPIToken(req.Name, req.Scopes, req.SpendingCaps)
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	err = w.WriteJson(&newAPITokenResponse{t, secret})
+	if err != nil {
+		log.Warn(fmt.Sprintf("writejson err %s", err))
+	}
+}
+
+// GetAPITokens list all api tokens without secret
+func GetAPITokens(w rest.ResponseWriter, r *rest.Request) {
+	ts, err := API.GetAPITokens()
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if ts == nil {
+		ts = []*models.APIToken{}
+	}
+	err = w.WriteJson(ts)
+	if err != nil {
+		log.Warn(fmt.Sprintf("writejson err %s", err))
+	}
+}
+
+// RemoveAPIToken revoke an api token
+func RemoveAPIToken(w rest.ResponseWriter, r *rest.Request) {
+	err := API.RemoveAPIToken(r.PathParam("id"))
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,210 @@
+package v1
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// keys of rest.Request.Env
+const (
+	envAPIScope = "API_SCOPE"
+	envAPIToken = "API_TOKEN"
+)
+
+// scopes needed by routes
+const (
+	scopeRead     = models.APITokenScopeRead
+	scopeTransfer = models.APITokenScopeTransfer
+	scopeChannel  = models.APITokenScopeChannel
+	scopeDebug    = models.APITokenScopeDebug
+)
+
+var errAuthRequired = errors.New("authorization required")
+
+/*
+accessTokenPath the only route accepts parameter `access_token`, for EventSource which cannot set headers.
+parameter is removed from url once read, so it's never written to access log.
+*/
+const accessTokenPath = "/api/1/notifications/stream"
+
+/*
+authenticate returns the scopes granted to the request.
+username/password has all scopes, api token is in header `Authorization: Bearer <token>`
+or parameter `access_token` of accessTokenPath.
+api is open to everyone if neither username/password nor any api token is set.
+*/
+func authenticate(r *rest.Request) (scope models.APITokenScope, t *models.APIToken, err error) {
+	basicAuth := HTTPUsername != "" && HTTPPassword != ""
+	if basicAuth {
+		username, password, ok := r.BasicAuth()
+		if ok {
+			if subtle.ConstantTimeCompare([]byte(username), []byte(HTTPUsername)) == 1 &&
+				subtle.ConstantTimeCompare([]byte(password), []byte(HTTPPassword)) == 1 {
+				return models.APITokenScopeAll, nil, nil
+			}
+			return 0, nil, errors.New("invalid username or password")
+		}
+	}
+	secret, err := takeAccessToken(r)
+	if err != nil {
+		return
+	}
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		secret = strings.TrimPrefix(auth, "Bearer ")
+	}
+	if secret != "" {
+		t, err = API.AuthAPIToken(secret)
+		if err != nil {
+			return
+		}
+		return t.Scopes, t, nil
+	}
+	if !basicAuth && !API.HasAPIToken() {
+		return models.APITokenScopeAll, nil, nil
+	}
+	return 0, nil, errAuthRequired
+}
+
+// takeAccessToken returns parameter `access_token` and removes it from url
+func takeAccessToken(r *rest.Request) (secret string, err error) {
+	q := r.URL.Query()
+	if _, ok := q["access_token"]; !ok {
+		return
+	}
+	secret = q.Get("access_token")
+	q.Del("access_token")
+	r.URL.RawQuery = q.Encode()
+	if r.URL.Path != accessTokenPath {
+		return "", fmt.Errorf("access_token is only accepted by %s, use header Authorization instead", accessTokenPath)
+	}
+	return
+}
+
+// authMiddleware authenticate every request, scope is checked by each route
+type authMiddleware struct{}
+
+// MiddlewareFunc makes authMiddleware implement the Middleware interface.
+func (m *authMiddleware) MiddlewareFunc(h rest.HandlerFunc) rest.HandlerFunc {
+	return func(w rest.ResponseWriter, r *rest.Request) {
+		scope, t, err := authenticate(r)
+		if err != nil {
+			if HTTPUsername != "" && HTTPPassword != "" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="please input username and password"`)
+			} else {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="photon"`)
+			}
+			rest.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		r.Env[envAPIScope] = scope
+		if t != nil {
+			r.Env[envAPIToken] = t
+		}
+		h(w, r)
+	}
+}
+
+// scoped declares the scope needed to call h
+func scoped(scope models.APITokenScope, h rest.HandlerFunc) rest.HandlerFunc {
+	if h == nil {
+		return nil
+	}
+	return func(w rest.ResponseWriter, r *rest.Request) {
+		granted, _ := r.Env[envAPIScope].(models.APITokenScope)
+		if !granted.Has(scope) {
+			rest.Error(w, fmt.Sprintf("scope %s required", scope), http.StatusForbidden)
+			return
+		}
+		h(w, r)
+	}
+}
+
+/*
+apiTokenReservation :
+amounts counted against the spending caps of the api token of a request before transfers are sent.
+after sending, commit keeps them as spent, otherwise release gives them back,
+so `defer res.release()` right after reserving and commit once transfers are sent.
+requests authorized by username/password or without auth are not limited.
+*/
+type apiTokenReservation struct {
+	t       *models.APIToken
+	amounts map[common.Address]*big.Int
+}
+
+func newAPITokenReservation(r *rest.Request) *apiTokenReservation {
+	t, _ := r.Env[envAPIToken].(*models.APIToken)
+	return &apiTokenReservation{
+		t:       t,
+		amounts: make(map[common.Address]*big.Int),
+	}
+}
+
+// reserveAPIToken reserve amount of one transfer
+func reserveAPIToken(r *rest.Request, token common.Address, amount *big.Int) (res *apiTokenReservation, err error) {
+	res = newAPITokenReservation(r)
+	err = res.reserve(token, amount)
+	return
+}
+
+// reserve check spending cap and count amount as spent
+func (res *apiTokenReservation) reserve(token common.Address, amount *big.Int) error {
+	if res.t == nil || amount == nil {
+		return nil
+	}
+	err := API.SpendAPIToken(res.t, token, amount)
+	if err != nil {
+		return err
+	}
+	if old, ok := res.amounts[token]; ok {
+		amount = new(big.Int).Add(old, amount)
+	}
+	res.amounts[token] = amount
+	return nil
+}
+
+// commit transfers are sent, amounts reserved are spent
+func (res *apiTokenReservation) commit() {
+	res.amounts = make(map[common.Address]*big.Int)
+}
+
+// release give back amounts not committed
+func (res *apiTokenReservation) release() {
+	for token, amount := range res.amounts {
+		res.refund(token, amount)
+	}
+}
+
+// refund give back amount of token reserved
+func (res *apiTokenReservation) refund(token common.Address, amount *big.Int) {
+	reserved, ok := res.amounts[token]
+	if !ok || amount == nil {
+		return
+	}
+	err := API.RefundAPIToken(res.t, token, amount)
+	if err != nil {
+		log.Error(fmt.Sprintf("RefundAPIToken %s err %s", res.t.ID, err))
+	}
+	reserved = new(big.Int).Sub(reserved, amount)
+	if reserved.Sign() <= 0 {
+		delete(res.amounts, token)
+	} else {
+		res.amounts[token] = reserved
+	}
+}
+
+// apiTokenID id of the api token of r, empty if not authorized by api token
+func apiTokenID(r *rest.Request) string {
+	if t, ok := r.Env[envAPIToken].(*models.APIToken); ok {
+		return t.ID
+	}
+	return ""
+}
@@ -0,0 +1,25 @@
+package v1
+
+import (
+	"fmt"
+
+	"github.com/SmartMeshFoundation/Photon"
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// GetAutoSettleSchedule list upcoming automatic unlock and settle of closed channels
+func GetAutoSettleSchedule(w rest.ResponseWriter, r *rest.Request) {
+	schedule := API.GetAutoSettleSchedule()
+	if schedule.Actions == nil {
+		schedule = &photon.AutoSettleSchedule{
+			Enabled:     schedule.Enabled,
+			BlockNumber: schedule.BlockNumber,
+			Actions:     []*photon.AutoSettleAction{},
+		}
+	}
+	err := w.WriteJson(schedule)
+	if err != nil {
+		log.Warn(fmt.Sprintf("writejson err %s", err))
+	}
+}
@@ -0,0 +1,110 @@
+package v1
+
+import (
+	"fmt"
+	"math/big"
+	"net/http"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// BatchTransferData post for batch transfers
+type BatchTransferData struct {
+	Transfers     []*models.BatchTransferItem `json:"transfers"`
+	Concurrency   int                         `json:"concurrency"`
+	StopOnFailure bool                        `json:"stop_on_failure"`
+}
+
+type batchTransferResponse struct {
+	*models.BatchTransfer
+	Summary *models.BatchTransferSummary `json:"summary"`
+}
+
+func writeBatchTransfer(w rest.ResponseWriter, id string) {
+	b, err := API.GetBatchTransfer(id)
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	err = w.WriteJson(&batchTransferResponse{b, b.Summary()})
+	if err != nil {
+		log.Warn(fmt.Sprintf("writejson err %s", err))
+	}
+}
+
+/*
+BatchTransfers start transfers to many targets in background,
+returns the batch, query it by id for status of each transfer.
+*/
+func BatchTransfers(w rest.ResponseWriter, r *rest.Request) {
+	var err error
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> BatchTransfers ,err=%v", err))
+	}()
+	req := &BatchTransferData{}
+	err = r.DecodeJsonPayload(req)
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	amounts := make(map[common.Address]*big.Int)
+	for i, item := range req.Transfers {
+		if item == nil || item.Amount == nil {
+			rest.Error(w, fmt.Sprintf("invalid amount of transfer %d", i), http.StatusBadRequest)
+			return
+		}
+		amount, ok := amounts[item.TokenAddress]
+		if !ok {
+			amount = big.NewInt(0)
+			amounts[item.TokenAddress] = amount
+		}
+		amount.Add(amount, item.Amount)
+		if item.Fee != nil {
+			amount.Add(amount, item.Fee)
+		}
+	}
+	res := newAPITokenReservation(r)
+	defer res.release()
+	for token, amount := range amounts {
+		err = res.reserve(token, amount)
+		if err != nil {
+			rest.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+	// 之后失败或者跳过的交易由 batch 自己退还额度
+	id, err := API.BatchTransfer(req.Transfers, req.Concurrency, req.StopOnFailure, apiTokenID(r))
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	res.commit()
+	writeBatchTransfer(w, id)
+}
+
+// GetBatchTransfer status of batch and each transfer of it
+func GetBatchTransfer(w rest.ResponseWriter, r *rest.Request) {
+	writeBatchTransfer(w, r.PathParam("id"))
+}
+
+// GetBatchTransfers all batches with summary, transfers are not included
+func GetBatchTransfers(w rest.ResponseWriter, r *rest.Request) {
+	bs, err := API.GetBatchTransfers()
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rs := []*batchTransferResponse{}
+	for _, b := range bs {
+		s := b.Summary()
+		b.Items = nil
+		rs = append(rs, &batchTransferResponse{b, s})
+	}
+	err = w.WriteJson(rs)
+	if err != nil {
+		log.Warn(fmt.Sprintf("writejson err %s", err))
+	}
+}
@@ -7,6 +7,7 @@ import (
 
 	"fmt"
 
+	"github.com/SmartMeshFoundation/Photon"
 	"github.com/SmartMeshFoundation/Photon/channel/channeltype"
 	"github.com/SmartMeshFoundation/Photon/log"
 	"github.com/SmartMeshFoundation/Photon/transfer"
@@ -32,6 +33,28 @@ type ChannelData struct {
 	StateString         string            `json:"state_string"`
 	SettleTimeout       int               `json:"settle_timeout"`
 	RevealTimeout       int               `json:"reveal_timeout"`
+
+	/*
+		amounts in decimals of token, like 1.25, empty if metadata of token is unknown
+	*/
+	TokenSymbol              string `json:"token_symbol,omitempty"`
+	BalanceHuman             string `json:"balance_human,omitempty"`
+	PartnerBalanceHuman      string `json:"partner_balance_human,omitempty"`
+	LockedAmountHuman        string `json:"locked_amount_human,omitempty"`
+	PartnerLockedAmountHuman string `json:"partner_locked_amount_human,omitempty"`
+}
+
+// FormatAmounts fills amounts in decimals of token
+func (d *ChannelData) FormatAmounts(api *photon.API) {
+	m, err := api.GetTokenMetadata(common.HexToAddress(d.TokenAddress))
+	if err != nil {
+		return
+	}
+	d.TokenSymbol = m.Symbol
+	d.BalanceHuman = m.FormatAmount(d.Balance)
+	d.PartnerBalanceHuman = m.FormatAmount(d.PartnerBalance)
+	d.LockedAmountHuman = m.FormatAmount(d.LockedAmount)
+	d.PartnerLockedAmountHuman = m.FormatAmount(d.PartnerLockedAmount)
 }
 
 //ChannelDataDetail more info
@@ -49,6 +72,12 @@ type ChannelDataDetail struct {
 	SettleTimeout       int `json:"settle_timeout"`
 	RevealTimeout       int `json:"reveal_timeout"`
 
+	TokenSymbol              string `json:"token_symbol,omitempty"`
+	BalanceHuman             string `json:"balance_human,omitempty"`
+	PartnerBalanceHuman      string `json:"partner_balance_human,omitempty"`
+	LockedAmountHuman        string `json:"locked_amount_human,omitempty"`
+	PartnerLockedAmountHuman string `json:"partner_locked_amount_human,omitempty"`
+
 	/*
 		extended
 	*/
@@ -65,6 +94,19 @@ type ChannelDataDetail struct {
 	Signature                []byte //my signature of PartnerBalanceProof
 }
 
+// FormatAmounts fills amounts in decimals of token
+func (d *ChannelDataDetail) FormatAmounts(api *photon.API) {
+	m, err := api.GetTokenMetadata(common.HexToAddress(d.TokenAddress))
+	if err != nil {
+		return
+	}
+	d.TokenSymbol = m.Symbol
+	d.BalanceHuman = m.FormatAmount(d.Balance)
+	d.PartnerBalanceHuman = m.FormatAmount(d.PartnerBalance)
+	d.LockedAmountHuman = m.FormatAmount(d.LockedAmount)
+	d.PartnerLockedAmountHuman = m.FormatAmount(d.PartnerLockedAmount)
+}
+
 /*
 GetChannelList list all my channels
 */
@@ -89,6 +131,7 @@ func GetChannelList(w rest.ResponseWriter, r *rest.Request) {
 			LockedAmount:        c.OurAmountLocked(),
 			PartnerLockedAmount: c.PartnerAmountLocked(),
 		}
+		d.FormatAmounts(API)
 		datas = append(datas, d)
 	}
 	err = w.WriteJson(datas)
@@ -163,6 +206,7 @@ func SpecifiedChannel(w rest.ResponseWriter, r *rest.Request) {
 		OurBalanceProof:          c.OurBalanceProof,
 		PartnerBalanceProof:      c.PartnerBalanceProof,
 	}
+	d.FormatAmounts(API)
 	err = w.WriteJson(d)
 	if err != nil {
 		log.Warn(fmt.Sprintf("writejson err %s", err))
@@ -176,6 +220,7 @@ type depositReq struct {
 	PartnerAddrses string   `json:"partner_address"` //通道对方地址
 	TokenAddress   string   `json:"token_address"`   //哪种token
 	Balance        *big.Int `json:"balance"`         //存入金额,一定大于0
+	BalanceHuman   string   `json:"balance_human"`   //按照 token decimals 表示的存入金额,如 1.25, balance 为空时使用
 	//如果NewChannel为true
 	//  SettleTimeout表示新建通道的结算窗口,如果SettleTimeout为0,则用系统默认计算窗口
 	//如果NewChannel为 false
@@ -214,7 +259,18 @@ func Deposit(w rest.ResponseWriter, r *rest.Request) {
 		rest.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
+	if req.Balance == nil && req.BalanceHuman != "" {
+		req.Balance, err = API.ParseAmount(tokenAddr, req.BalanceHuman)
+		if err != nil {
+			rest.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Balance == nil {
+		rest.Error(w, "balance is required", http.StatusBadRequest)
+		return
+	}
+	idempotencyStarted(r, utils.EmptyHash, tokenAddr, partnerAddr)
 	c, err := API.DepositAndOpenChannel(tokenAddr, partnerAddr, req.SettleTimeout, API.Photon.Config.RevealTimeout, req.Balance, req.NewChannel)
 	if err != nil {
 		log.Error(err.Error())
@@ -235,6 +291,7 @@ func Deposit(w rest.ResponseWriter, r *rest.Request) {
 		PartnerLockedAmount: c.PartnerAmountLocked(),
 		RevealTimeout:       c.RevealTimeout,
 	}
+	d.FormatAmounts(API)
 	err = w.WriteJson(d)
 	if err != nil {
 		log.Warn(fmt.Sprintf("writejson err %s", err))
@@ -330,6 +387,7 @@ func CloseSettleChannel(w rest.ResponseWriter, r *rest.Request) {
 		PartnerLockedAmount: c.PartnerAmountLocked(),
 		RevealTimeout:       c.RevealTimeout,
 	}
+	d.FormatAmounts(API)
 	err = w.WriteJson(d)
 	if err != nil {
 		log.Warn(fmt.Sprintf("writejson err %s", err))
@@ -395,6 +453,7 @@ func withdraw(w rest.ResponseWriter, r *rest.Request) {
 		PartnerLockedAmount: c.PartnerAmountLocked(),
 		RevealTimeout:       c.RevealTimeout,
 	}
+	d.FormatAmounts(API)
 	err = w.WriteJson(d)
 	if err != nil {
 		log.Warn(fmt.Sprintf("writejson err %s", err))
@@ -0,0 +1,116 @@
+package v1
+
+import (
+	"fmt"
+	"math/big"
+	"net/http"
+
+	"github.com/SmartMeshFoundation/Photon"
+	"github.com/SmartMeshFoundation/Photon/channel/channeltype"
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+type connectionReq struct {
+	Funds *big.Int `json:"funds"`
+}
+
+func channelDatas(chs []*channeltype.Serialization) (datas []*ChannelData) {
+	datas = []*ChannelData{}
+	for _, c := range chs {
+		d := &ChannelData{
+			ChannelIdentifier:   c.ChannelIdentifier.ChannelIdentifier.String(),
+			OpenBlockNumber:     c.ChannelIdentifier.OpenBlockNumber,
+			PartnerAddrses:      c.PartnerAddress().String(),
+			Balance:             c.OurBalance(),
+			PartnerBalance:      c.PartnerBalance(),
+			State:               c.State,
+			StateString:         c.State.String(),
+			TokenAddress:        c.TokenAddress().String(),
+			SettleTimeout:       c.SettleTimeout,
+			RevealTimeout:       c.RevealTimeout,
+			LockedAmount:        c.OurAmountLocked(),
+			PartnerLockedAmount: c.PartnerAmountLocked(),
+		}
+		d.FormatAmounts(API)
+		datas = append(datas, d)
+	}
+	return
+}
+
+// GetConnections status of all token networks joined by connection manager
+func GetConnections(w rest.ResponseWriter, r *rest.Request) {
+	ss, err := API.GetTokenNetworkConnections()
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if ss == nil {
+		ss = []*photon.TokenNetworkConnectionStatus{}
+	}
+	err = w.WriteJson(ss)
+	if err != nil {
+		log.Warn(fmt.Sprintf("writejson err %s", err))
+	}
+}
+
+/*
+JoinTokenNetwork is the api of PUT /api/1/connections/:token,
+opens channels with funds, returns channels opened.
+*/
+func JoinTokenNetwork(w rest.ResponseWriter, r *rest.Request) {
+	var err error
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> JoinTokenNetwork ,err=%v", err))
+	}()
+	tokenAddr, err := utils.HexToAddress(r.PathParam("token"))
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req := &connectionReq{}
+	err = r.DecodeJsonPayload(req)
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Funds == nil || req.Funds.Cmp(utils.BigInt0) <= 0 {
+		rest.Error(w, "Invalid funds", http.StatusBadRequest)
+		return
+	}
+	chs, err := API.JoinTokenNetwork(tokenAddr, req.Funds)
+	if err != nil && len(chs) == 0 {
+		rest.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	err = w.WriteJson(channelDatas(chs))
+	if err != nil {
+		log.Warn(fmt.Sprintf("writejson err %s", err))
+	}
+}
+
+/*
+LeaveTokenNetwork is the api of DELETE /api/1/connections/:token,
+settles all channels of token network, returns channels settled or closed.
+*/
+func LeaveTokenNetwork(w rest.ResponseWriter, r *rest.Request) {
+	var err error
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> LeaveTokenNetwork ,err=%v", err))
+	}()
+	tokenAddr, err := utils.HexToAddress(r.PathParam("token"))
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	chs, err := API.LeaveTokenNetwork(tokenAddr)
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	err = w.WriteJson(channelDatas(chs))
+	if err != nil {
+		log.Warn(fmt.Sprintf("writejson err %s", err))
+	}
+}
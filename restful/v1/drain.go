@@ -0,0 +1,60 @@
+package v1
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// DrainData post for drain
+type DrainData struct {
+	Action string `json:"action"` // none,shutdown,close or cooperative-settle
+}
+
+/*
+StartDrain stops initiating and mediating transfers, action is taken when nothing is pending
+*/
+func StartDrain(w rest.ResponseWriter, r *rest.Request) {
+	var err error
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> StartDrain ,err=%v", err))
+	}()
+	req := &DrainData{}
+	err = r.DecodeJsonPayload(req)
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s, err := API.StartDrain(req.Action)
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	err = w.WriteJson(s)
+	if err != nil {
+		log.Warn(fmt.Sprintf("writejson err %s", err))
+	}
+}
+
+// GetDrainStatus progress of drain
+func GetDrainStatus(w rest.ResponseWriter, r *rest.Request) {
+	err := w.WriteJson(API.GetDrainStatus())
+	if err != nil {
+		log.Warn(fmt.Sprintf("writejson err %s", err))
+	}
+}
+
+// CancelDrain accepts new transfers again
+func CancelDrain(w rest.ResponseWriter, r *rest.Request) {
+	err := API.CancelDrain()
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	err = w.WriteJson(API.GetDrainStatus())
+	if err != nil {
+		log.Warn(fmt.Sprintf("writejson err %s", err))
+	}
+}
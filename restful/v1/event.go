@@ -8,6 +8,8 @@ import (
 	"strconv"
 
 	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/params"
 	"github.com/SmartMeshFoundation/Photon/utils"
 	"github.com/ant0ine/go-json-rest/rest"
 	"github.com/ethereum/go-ethereum/common"
@@ -17,8 +19,12 @@ import (
 EventNetwork returns all events related to Photon network
 */
 func EventNetwork(w rest.ResponseWriter, r *rest.Request) {
-	fromBlock, toBlock := getFromTo(r)
-	events, err := API.GetNetworkEvents(fromBlock, toBlock)
+	f, err := getContractEventFilter(r)
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	events, err := API.GetNetworkEvents(f)
 	if err != nil {
 		log.Error(err.Error())
 		rest.Error(w, err.Error(), http.StatusInternalServerError)
@@ -34,21 +40,24 @@ func EventNetwork(w rest.ResponseWriter, r *rest.Request) {
 EventTokens returns all events about the token specified
 */
 func EventTokens(w rest.ResponseWriter, r *rest.Request) {
-	fromBlock, toBlock := getFromTo(r)
+	f, err := getContractEventFilter(r)
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	var token common.Address
 	tokenstr := r.PathParam("token")
-	fmt.Println("tokenstr ", tokenstr)
 	if len(tokenstr) != len(token.String()) {
 		rest.Error(w, "address error", http.StatusBadRequest)
 		return
 	}
-	token, err := utils.HexToAddress(tokenstr)
+	token, err = utils.HexToAddress(tokenstr)
 	if err != nil {
 		log.Error(err.Error())
 		rest.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	events, err := API.GetTokenNetworkEvents(token, fromBlock, toBlock)
+	events, err := API.GetTokenNetworkEvents(token, f)
 	if err != nil {
 		log.Error(err.Error())
 		rest.Error(w, err.Error(), http.StatusInternalServerError)
@@ -64,8 +73,11 @@ func EventTokens(w rest.ResponseWriter, r *rest.Request) {
 EventChannels returns all events about the channel specified
 */
 func EventChannels(w rest.ResponseWriter, r *rest.Request) {
-	fromBlock, toBlock := getFromTo(r)
-	log.Trace(fmt.Sprintf("from=%d,toblock=%d", fromBlock, toBlock))
+	f, err := getContractEventFilter(r)
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	var channel common.Hash
 	channelstr := r.PathParam("channel")
 	log.Trace(fmt.Sprintf("channels %s", channelstr))
@@ -74,7 +86,7 @@ func EventChannels(w rest.ResponseWriter, r *rest.Request) {
 		return
 	}
 	channel = common.HexToHash(channelstr)
-	events, err := API.GetChannelEvents(channel, fromBlock, toBlock)
+	events, err := API.GetChannelEvents(channel, f)
 	if err != nil {
 		log.Error(err.Error())
 		rest.Error(w, err.Error(), http.StatusInternalServerError)
@@ -86,6 +98,55 @@ func EventChannels(w rest.ResponseWriter, r *rest.Request) {
 	}
 }
 
+var contractEventNames = map[string]bool{
+	params.NameTokenNetworkCreated:       true,
+	params.NameChannelOpenedAndDeposit:   true,
+	params.NameChannelNewDeposit:         true,
+	params.NameChannelWithdraw:           true,
+	params.NameChannelClosed:             true,
+	params.NameChannelPunished:           true,
+	params.NameChannelUnlocked:           true,
+	params.NameBalanceProofUpdated:       true,
+	params.NameChannelSettled:            true,
+	params.NameChannelCooperativeSettled: true,
+	params.NameSecretRevealed:            true,
+}
+
+/*
+getContractEventFilter parse query parameters of events api:
+from_block,to_block,cursor,limit,event_name,participant
+*/
+func getContractEventFilter(r *rest.Request) (f *models.ContractEventFilter, err error) {
+	f = &models.ContractEventFilter{}
+	f.FromBlock, f.ToBlock = getFromTo(r)
+	m := r.URL.Query()
+	if c := m.Get("cursor"); c != "" {
+		f.Cursor, err = strconv.ParseUint(c, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor %s", c)
+		}
+	}
+	if l := m.Get("limit"); l != "" {
+		f.Limit, err = strconv.Atoi(l)
+		if err != nil || f.Limit <= 0 {
+			return nil, fmt.Errorf("invalid limit %s", l)
+		}
+	}
+	if name := m.Get("event_name"); name != "" {
+		if !contractEventNames[name] {
+			return nil, fmt.Errorf("unknown event_name %s", name)
+		}
+		f.EventName = name
+	}
+	if p := m.Get("participant"); p != "" {
+		if !common.IsHexAddress(p) {
+			return nil, fmt.Errorf("invalid participant %s", p)
+		}
+		f.Participant = common.HexToAddress(p)
+	}
+	return
+}
+
 func getFromTo(r *rest.Request) (fromBlock, toBlock int64) {
 	fromBlock = -1
 	toBlock = -1
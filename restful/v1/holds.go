@@ -0,0 +1,61 @@
+package v1
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// GetHeldTransfers received transfers waiting for accept or cancel
+func GetHeldTransfers(w rest.ResponseWriter, r *rest.Request) {
+	ts, err := API.GetHeldTransfers()
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err = w.WriteJson(ts)
+	if err != nil {
+		log.Warn(fmt.Sprintf("writejson err %s", err))
+	}
+}
+
+/*
+HoldTransfer holds the transfer with locksecrethash when it's received,
+DELETE stops holding it.
+*/
+func HoldTransfer(w rest.ResponseWriter, r *rest.Request) {
+	lockSecretHash := common.HexToHash(r.PathParam("locksecrethash"))
+	err := API.HoldTransfer(lockSecretHash, r.Method != http.MethodDelete)
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// AcceptHeldTransfer :
+func AcceptHeldTransfer(w rest.ResponseWriter, r *rest.Request) {
+	acceptOrCancelHeldTransfer(w, r, API.AcceptHeldTransfer)
+}
+
+// CancelHeldTransfer :
+func CancelHeldTransfer(w rest.ResponseWriter, r *rest.Request) {
+	acceptOrCancelHeldTransfer(w, r, API.CancelHeldTransfer)
+}
+
+func acceptOrCancelHeldTransfer(w rest.ResponseWriter, r *rest.Request, f func(token common.Address, lockSecretHash common.Hash) error) {
+	tokenAddr, err := utils.HexToAddress(r.PathParam("token"))
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	lockSecretHash := common.HexToHash(r.PathParam("locksecrethash"))
+	err = f(tokenAddr, lockSecretHash)
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+}
@@ -0,0 +1,229 @@
+package v1
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// header of idempotency key
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// key of rest.Request.Env
+const envIdempotencyRecord = "IDEMPOTENCY_RECORD"
+
+// records are kept for retry within this time
+const idempotencyRecordTTL = 24 * time.Hour
+
+const (
+	idempotencyInProgress = "in_progress"
+	// photon stopped before the request finished, check the operation by lock_secret_hash or the channel
+	idempotencyInterrupted = "interrupted"
+)
+
+var idempotencyLock sync.Mutex
+
+// keys of requests processing by this process
+var idempotencyRunning = make(map[string]bool)
+var idempotencyLastPrune time.Time
+
+// idempotencyStatus response of a request not finished
+type idempotencyStatus struct {
+	*models.IdempotencyRecord
+	Status string `json:"status"`
+}
+
+// recordWriter keeps status code and body written by handler
+type recordWriter struct {
+	rest.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (w *recordWriter) WriteHeader(code int) {
+	w.statusCode = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *recordWriter) Write(b []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	w.body.Write(b)
+	return w.ResponseWriter.(http.ResponseWriter).Write(b)
+}
+
+func (w *recordWriter) WriteJson(v interface{}) error {
+	b, err := w.EncodeJson(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+func requestHash(r *rest.Request, body []byte) common.Hash {
+	h := sha256.New()
+	h.Write([]byte(r.Method))
+	h.Write([]byte(r.URL.Path))
+	h.Write(body)
+	return common.BytesToHash(h.Sum(nil))
+}
+
+/*
+idempotencyRecordKey key of the record saved in db,
+keys of different api tokens never collide, so one token cannot replay the response of another.
+*/
+func idempotencyRecordKey(r *rest.Request, key string) string {
+	if id := apiTokenID(r); id != "" {
+		return id + ":" + key
+	}
+	return key
+}
+
+func pruneIdempotencyRecords() {
+	idempotencyLock.Lock()
+	if time.Since(idempotencyLastPrune) < time.Hour {
+		idempotencyLock.Unlock()
+		return
+	}
+	idempotencyLastPrune = time.Now()
+	idempotencyLock.Unlock()
+	go func() {
+		err := API.Photon.GetDao().RemoveIdempotencyRecordsBefore(time.Now().Add(-idempotencyRecordTTL).Unix())
+		if err != nil {
+			log.Error(fmt.Sprintf("RemoveIdempotencyRecordsBefore err %s", err))
+		}
+	}()
+}
+
+/*
+idempotent makes h accept header Idempotency-Key.
+the first request with a key is processed by h and its response is saved,
+retried requests with the same key get the saved response, or 409 with status of the operation if it is not finished.
+*/
+func idempotent(h rest.HandlerFunc) rest.HandlerFunc {
+	if h == nil {
+		return nil
+	}
+	return func(w rest.ResponseWriter, r *rest.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key == "" {
+			h(w, r)
+			return
+		}
+		if len(key) > 255 {
+			rest.Error(w, "Idempotency-Key too long", http.StatusBadRequest)
+			return
+		}
+		pruneIdempotencyRecords()
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			rest.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		dao := API.Photon.GetDao()
+		rec := &models.IdempotencyRecord{
+			Key:         idempotencyRecordKey(r, key),
+			RequestHash: requestHash(r, body),
+			Status:      models.IdempotencyStatusPending,
+			CreateTime:  time.Now().Unix(),
+		}
+		idempotencyLock.Lock()
+		err = dao.NewIdempotencyRecord(rec)
+		if err == nil {
+			idempotencyRunning[rec.Key] = true
+		}
+		idempotencyLock.Unlock()
+		if err == models.ErrIdempotencyKeyExists {
+			replayIdempotentRequest(w, r, rec)
+			return
+		}
+		if err != nil {
+			rest.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer func() {
+			idempotencyLock.Lock()
+			delete(idempotencyRunning, rec.Key)
+			idempotencyLock.Unlock()
+		}()
+		rw := &recordWriter{ResponseWriter: w}
+		r.Env[envIdempotencyRecord] = rec
+		h(rw, r)
+		rec.Status = models.IdempotencyStatusDone
+		rec.StatusCode = rw.statusCode
+		rec.Response = rw.body.Bytes()
+		err = dao.UpdateIdempotencyRecord(rec)
+		if err != nil {
+			log.Error(fmt.Sprintf("UpdateIdempotencyRecord %s err %s", rec.Key, err))
+		}
+	}
+}
+
+func replayIdempotentRequest(w rest.ResponseWriter, r *rest.Request, req *models.IdempotencyRecord) {
+	rec, err := API.Photon.GetDao().GetIdempotencyRecord(req.Key)
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if rec.RequestHash != req.RequestHash {
+		rest.Error(w, "Idempotency-Key is used by another request", http.StatusUnprocessableEntity)
+		return
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	if rec.Status == models.IdempotencyStatusDone {
+		w.WriteHeader(rec.StatusCode)
+		_, err = w.(http.ResponseWriter).Write(rec.Response)
+		if err != nil {
+			log.Warn(fmt.Sprintf("writejson err %s", err))
+		}
+		return
+	}
+	idempotencyLock.Lock()
+	running := idempotencyRunning[rec.Key]
+	idempotencyLock.Unlock()
+	// key of the client, without id of api token
+	shown := *rec
+	shown.Key = r.Header.Get(idempotencyKeyHeader)
+	status := &idempotencyStatus{
+		IdempotencyRecord: &shown,
+		Status:            idempotencyInterrupted,
+	}
+	if running {
+		status.Status = idempotencyInProgress
+	}
+	w.WriteHeader(http.StatusConflict)
+	err = w.WriteJson(status)
+	if err != nil {
+		log.Warn(fmt.Sprintf("writejson err %s", err))
+	}
+}
+
+/*
+idempotencyStarted saves the operation started by r before waiting its result,
+so retried requests can find it even if photon stopped before it finished.
+*/
+func idempotencyStarted(r *rest.Request, lockSecretHash common.Hash, token, partner common.Address) {
+	rec, ok := r.Env[envIdempotencyRecord].(*models.IdempotencyRecord)
+	if !ok {
+		return
+	}
+	rec.LockSecretHash = lockSecretHash
+	rec.TokenAddress = token
+	rec.PartnerAddress = partner
+	err := API.Photon.GetDao().UpdateIdempotencyRecord(rec)
+	if err != nil {
+		log.Error(fmt.Sprintf("UpdateIdempotencyRecord %s err %s", rec.Key, err))
+	}
+}
@@ -0,0 +1,155 @@
+package v1
+
+import (
+	"fmt"
+	"math/big"
+	"net/http"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+CreateInvoiceReq :
+AmountHuman is amount in decimals of token like 1.25, it's used when Amount is absent.
+Expiry is in seconds, default is one hour.
+*/
+type CreateInvoiceReq struct {
+	TokenAddress common.Address   `json:"token_address"`
+	Amount       *big.Int         `json:"amount"`
+	AmountHuman  string           `json:"amount_human,omitempty"`
+	Expiry       int64            `json:"expiry"`
+	Description  string           `json:"description"`
+	RouteHints   []common.Address `json:"route_hints"`
+}
+
+// InvoiceReq encoded invoice to decode or pay
+type InvoiceReq struct {
+	Invoice string `json:"invoice"`
+	Sync    bool   `json:"sync"`
+}
+
+// CreateInvoice :
+func CreateInvoice(w rest.ResponseWriter, r *rest.Request) {
+	var err error
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> CreateInvoice ,err=%v", err))
+	}()
+	req := &CreateInvoiceReq{}
+	err = r.DecodeJsonPayload(req)
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Amount == nil && req.AmountHuman != "" {
+		req.Amount, err = API.ParseAmount(req.TokenAddress, req.AmountHuman)
+		if err != nil {
+			rest.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	inv, err := API.CreateInvoice(req.TokenAddress, req.Amount, req.Expiry, req.Description, req.RouteHints)
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = w.WriteJson(inv)
+	if err != nil {
+		log.Warn(fmt.Sprintf("writejson err %s", err))
+	}
+}
+
+// GetInvoices : invoices created by us
+func GetInvoices(w rest.ResponseWriter, r *rest.Request) {
+	is, err := API.GetInvoiceList()
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err = w.WriteJson(is)
+	if err != nil {
+		log.Warn(fmt.Sprintf("writejson err %s", err))
+	}
+}
+
+// GetInvoice : invoice created by us
+func GetInvoice(w rest.ResponseWriter, r *rest.Request) {
+	lockSecretHash := common.HexToHash(r.PathParam("locksecrethash"))
+	inv, err := API.GetInvoice(lockSecretHash)
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	err = w.WriteJson(inv)
+	if err != nil {
+		log.Warn(fmt.Sprintf("writejson err %s", err))
+	}
+}
+
+// DecodeInvoice : decode and verify an invoice without paying it
+func DecodeInvoice(w rest.ResponseWriter, r *rest.Request) {
+	req := &InvoiceReq{}
+	err := r.DecodeJsonPayload(req)
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	inv, err := API.DecodeInvoice(req.Invoice)
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = w.WriteJson(inv)
+	if err != nil {
+		log.Warn(fmt.Sprintf("writejson err %s", err))
+	}
+}
+
+// PayInvoice : pay an invoice created by others
+func PayInvoice(w rest.ResponseWriter, r *rest.Request) {
+	var err error
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> PayInvoice ,err=%v", err))
+	}()
+	req := &InvoiceReq{}
+	err = r.DecodeJsonPayload(req)
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	inv, err := API.DecodeInvoice(req.Invoice)
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	res, err := reserveAPIToken(r, inv.TokenAddress, inv.Amount)
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	defer res.release()
+	result, err := API.PayInvoice(req.Invoice)
+	if err == nil {
+		idempotencyStarted(r, result.LockSecretHash, inv.TokenAddress, inv.Receiver)
+		if req.Sync {
+			err = API.WaitTransfer(result, params.MaxRequestTimeout)
+		} else {
+			err = API.WaitTransferStarted(result)
+		}
+	}
+	if err == nil || err == rerr.ErrTransferTimeout {
+		res.commit()
+	}
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	inv.Encoded = ""
+	err = w.WriteJson(inv)
+	if err != nil {
+		log.Warn(fmt.Sprintf("writejson err %s", err))
+	}
+}
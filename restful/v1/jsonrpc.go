@@ -0,0 +1,60 @@
+package v1
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+
+	"github.com/SmartMeshFoundation/Photon/jsonrpc"
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+RPC is the JSON-RPC 2.0 server served at /api/1/rpc,
+nil if rpc is disabled
+*/
+var RPC *jsonrpc.Server
+
+/*
+JSONRPC serve JSON-RPC 2.0 requests, the scope of caller is checked by each method.
+*/
+func JSONRPC(w rest.ResponseWriter, r *rest.Request) {
+	if RPC == nil {
+		rest.NotFound(w, r)
+		return
+	}
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	scope, _ := r.Env[envAPIScope].(models.APITokenScope)
+	res := newAPITokenReservation(r)
+	ctx := &jsonrpc.Context{
+		Scope: scope,
+		Spend: res.reserve,
+		Refund: func(token common.Address, amount *big.Int) {
+			res.refund(token, amount)
+		},
+	}
+	resp := RPC.Handle(ctx, data)
+	if resp == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	buf, err := json.Marshal(resp)
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, err = w.(http.ResponseWriter).Write(buf)
+	if err != nil {
+		log.Warn(fmt.Sprintf("writejson err %s", err))
+	}
+}
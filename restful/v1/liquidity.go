@@ -0,0 +1,61 @@
+package v1
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// GetLiquidityRules list rules of channels and tokens
+func GetLiquidityRules(w rest.ResponseWriter, r *rest.Request) {
+	rules, err := API.GetLiquidityRules()
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if rules == nil {
+		rules = []*models.LiquidityRule{}
+	}
+	err = w.WriteJson(rules)
+	if err != nil {
+		log.Warn(fmt.Sprintf("writejson err %s", err))
+	}
+}
+
+/*
+SetLiquidityRule create or replace rule of a channel, or of a token if channel_identifier is empty
+*/
+func SetLiquidityRule(w rest.ResponseWriter, r *rest.Request) {
+	var err error
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> SetLiquidityRule ,err=%v", err))
+	}()
+	rule := &models.LiquidityRule{}
+	err = r.DecodeJsonPayload(rule)
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = API.SetLiquidityRule(rule)
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = w.WriteJson(rule)
+	if err != nil {
+		log.Warn(fmt.Sprintf("writejson err %s", err))
+	}
+}
+
+// RemoveLiquidityRule remove rule by id, which is a channel identifier or a token address
+func RemoveLiquidityRule(w rest.ResponseWriter, r *rest.Request) {
+	err := API.RemoveLiquidityRule(r.PathParam("id"))
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
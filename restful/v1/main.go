@@ -42,77 +42,134 @@ func Start() {
 		api.Use(rest.DefaultProdStack...)
 	}
 	api.Use(rest.DefaultDevStack...)
-	if HTTPUsername != "" && HTTPPassword != "" {
-		api.Use(&rest.AuthBasicMiddleware{
-			Realm: "please input username and password",
-			Authenticator: func(userId string, password string) bool {
-				return userId == HTTPUsername && password == HTTPPassword
-			},
-		})
-	}
+	api.Use(&authMiddleware{})
 	router, err := rest.MakeRouter(
 
 		/*
 			prepare update
 		*/
-		rest.Post("/api/1/prepare-update", PrepareUpdate),
+		rest.Post("/api/1/prepare-update", scoped(scopeChannel, PrepareUpdate)),
+		rest.Post("/api/1/drain", scoped(scopeChannel, StartDrain)),
+		rest.Get("/api/1/drain", scoped(scopeRead, GetDrainStatus)),
+		rest.Delete("/api/1/drain", scoped(scopeChannel, CancelDrain)),
 		/*
 			transfers
 		*/
-		rest.Get("/api/1/querysenttransfer", GetSentTransfers),
-		rest.Get("/api/1/queryreceivedtransfer", GetReceivedTransfers),
-		rest.Post("/api/1/transfers/:token/:target", Transfers),
-		rest.Get("/api/1/transferstatus/:token/:locksecrethash", GetTransferStatus),
-		rest.Post("/api/1/transfercancel/:token/:locksecrethash", CancelTransfer),
+		rest.Get("/api/1/querysenttransfer", scoped(scopeRead, GetSentTransfers)),
+		rest.Get("/api/1/queryreceivedtransfer", scoped(scopeRead, GetReceivedTransfers)),
+		rest.Get("/api/1/export/accounting", scoped(scopeRead, ExportAccounting)),
+		rest.Post("/api/1/transfers/batch", scoped(scopeTransfer, idempotent(BatchTransfers))),
+		rest.Get("/api/1/transfers/batch", scoped(scopeRead, GetBatchTransfers)),
+		rest.Get("/api/1/transfers/batch/:id", scoped(scopeRead, GetBatchTransfer)),
+		rest.Post("/api/1/transfers/:token/:target", scoped(scopeTransfer, idempotent(Transfers))),
+		rest.Get("/api/1/transferstatus/:token/:locksecrethash", scoped(scopeRead, GetTransferStatus)),
+		rest.Post("/api/1/transfercancel/:token/:locksecrethash", scoped(scopeTransfer, idempotent(CancelTransfer))),
+		/*
+			invoices
+		*/
+		rest.Get("/api/1/invoices", scoped(scopeRead, GetInvoices)),
+		rest.Post("/api/1/invoices", scoped(scopeTransfer, CreateInvoice)),
+		rest.Get("/api/1/invoices/:locksecrethash", scoped(scopeRead, GetInvoice)),
+		rest.Post("/api/1/invoices/decode", scoped(scopeRead, DecodeInvoice)),
+		rest.Post("/api/1/invoices/pay", scoped(scopeTransfer, idempotent(PayInvoice))),
+		rest.Get("/api/1/publickey/:address", scoped(scopeRead, GetPublicKey)),
+		/*
+			held transfers
+		*/
+		rest.Get("/api/1/holds", scoped(scopeRead, GetHeldTransfers)),
+		rest.Put("/api/1/holds/:locksecrethash", scoped(scopeTransfer, HoldTransfer)),
+		rest.Delete("/api/1/holds/:locksecrethash", scoped(scopeTransfer, HoldTransfer)),
+		rest.Post("/api/1/holds/:token/:locksecrethash/accept", scoped(scopeTransfer, idempotent(AcceptHeldTransfer))),
+		rest.Post("/api/1/holds/:token/:locksecrethash/cancel", scoped(scopeTransfer, idempotent(CancelHeldTransfer))),
 		/*
 			transfer with specified secret
 		*/
-		rest.Post("/api/1/transfers/allowrevealsecret", AllowRevealSecret),
-		rest.Get("/api/1/getunfinishedreceivedtransfer/:tokenaddress/:locksecrethash", GetUnfinishedReceivedTransfer),
-		rest.Post("/api/1/registersecret", RegisterSecret),
+		rest.Post("/api/1/transfers/allowrevealsecret", scoped(scopeTransfer, AllowRevealSecret)),
+		rest.Get("/api/1/getunfinishedreceivedtransfer/:tokenaddress/:locksecrethash", scoped(scopeRead, GetUnfinishedReceivedTransfer)),
+		rest.Post("/api/1/registersecret", scoped(scopeTransfer, idempotent(RegisterSecret))),
 		/*
 			token swap
 		*/
-		rest.Put("/api/1/token_swaps/:target/:locksecrethash", TokenSwap),
+		rest.Put("/api/1/token_swaps/:target/:locksecrethash", scoped(scopeTransfer, idempotent(TokenSwap))),
+		/*
+			notifications
+		*/
+		rest.Get("/api/1/notifications/stream", scoped(scopeRead, NotificationStream)),
+		rest.Get("/api/1/notifications", scoped(scopeRead, GetNotifications)),
+		rest.Post("/api/1/notifications/ack", scoped(scopeTransfer, AckNotifications)),
+		rest.Delete("/api/1/notifications/consumers/:consumer", scoped(scopeTransfer, RemoveNotificationConsumer)),
+		/*
+			webhooks
+		*/
+		rest.Get("/api/1/webhooks", scoped(scopeRead, GetWebhooks)),
+		rest.Post("/api/1/webhooks", scoped(scopeChannel, AddWebhook)),
+		rest.Delete("/api/1/webhooks/:id", scoped(scopeChannel, RemoveWebhook)),
+		rest.Get("/api/1/webhook-deliveries", scoped(scopeRead, GetWebhookDeliveries)),
+		rest.Post("/api/1/webhook-deliveries/:key/retry", scoped(scopeChannel, RetryWebhookDelivery)),
 		/*
 			accounts
 		*/
-		rest.Get("/api/1/address", Address),
-		rest.Get("/api/1/balance", GetBalanceByTokenAddress),
-		rest.Get("/api/1/balance/", GetBalanceByTokenAddress),
-		rest.Get("/api/1/balance/:tokenaddress", GetBalanceByTokenAddress),
+		rest.Get("/api/1/address", scoped(scopeRead, Address)),
+		rest.Get("/api/1/balance", scoped(scopeRead, GetBalanceByTokenAddress)),
+		rest.Get("/api/1/balance/", scoped(scopeRead, GetBalanceByTokenAddress)),
+		rest.Get("/api/1/balance/:tokenaddress", scoped(scopeRead, GetBalanceByTokenAddress)),
 		/*
 			channels
 		*/
-		rest.Get("/api/1/channels/:channel", SpecifiedChannel),
-		rest.Get("/api/1/channels", GetChannelList),
-		rest.Patch("/api/1/channels/:channel", CloseSettleChannel),
-		rest.Get("/api/1/thirdparty/:channel/:3rd", ChannelFor3rdParty),
+		rest.Get("/api/1/channels/:channel", scoped(scopeRead, SpecifiedChannel)),
+		rest.Get("/api/1/channels", scoped(scopeRead, GetChannelList)),
+		rest.Patch("/api/1/channels/:channel", scoped(scopeChannel, idempotent(CloseSettleChannel))),
+		rest.Get("/api/1/thirdparty/:channel/:3rd", scoped(scopeChannel, ChannelFor3rdParty)),
 
 		/*
 			Deposit
 		*/
-		rest.Put("/api/1/deposit", Deposit),
+		rest.Put("/api/1/deposit", scoped(scopeChannel, idempotent(Deposit))),
 		/*
 			tokens
 		*/
-		rest.Get("/api/1/tokens", Tokens),
-		rest.Get("/api/1/tokens/:token/partners", TokenPartners),
+		rest.Get("/api/1/tokens", scoped(scopeRead, Tokens)),
+		rest.Get("/api/1/tokens/:token/partners", scoped(scopeRead, TokenPartners)),
+		rest.Get("/api/1/tokens/:token/metadata", scoped(scopeRead, GetTokenMetadata)),
+		rest.Put("/api/1/tokens/:token", scoped(scopeChannel, idempotent(RegisterToken))),
+		/*
+			connection manager
+		*/
+		rest.Get("/api/1/connections", scoped(scopeRead, GetConnections)),
+		rest.Put("/api/1/connections/:token", scoped(scopeChannel, idempotent(JoinTokenNetwork))),
+		rest.Delete("/api/1/connections/:token", scoped(scopeChannel, idempotent(LeaveTokenNetwork))),
+		/*
+			liquidity rules
+		*/
+		rest.Get("/api/1/liquidity-rules", scoped(scopeRead, GetLiquidityRules)),
+		rest.Put("/api/1/liquidity-rules", scoped(scopeChannel, SetLiquidityRule)),
+		rest.Delete("/api/1/liquidity-rules/:id", scoped(scopeChannel, RemoveLiquidityRule)),
+		rest.Post("/api/1/rebalance", scoped(scopeTransfer, idempotent(Rebalance))),
+		rest.Get("/api/1/auto-settle", scoped(scopeRead, GetAutoSettleSchedule)),
+		/*
+			watchtower
+		*/
+		rest.Get("/api/1/watchtower/delegations", scoped(scopeRead, GetDelegations)),
+		rest.Post("/api/1/watchtower/delegations", scoped(scopeChannel, AddDelegation)),
+		rest.Delete("/api/1/watchtower/delegations/:channel", scoped(scopeChannel, RemoveDelegation)),
 		/*
 			utils
 		*/
-		rest.Get("/api/1/path/:target_address/:token/:amount", FindPath),
-		rest.Get("/api/1/secret", GetRandomSecret), // api to provide random secret and lockSecretHash pair
-		rest.Get("/api/1/fee_policy", GetFeePolicy),
-		rest.Post("/api/1/fee_policy", SetFeePolicy),
-		rest.Get("/api/1/fee", GetAllFeeChargeRecord),
+		rest.Get("/api/1/path/:target_address/:token/:amount", scoped(scopeRead, FindPath)),
+		rest.Get("/api/1/secret", scoped(scopeRead, GetRandomSecret)), // api to provide random secret and lockSecretHash pair
+		rest.Get("/api/1/fee_policy", scoped(scopeRead, GetFeePolicy)),
+		rest.Post("/api/1/fee_policy", scoped(scopeChannel, SetFeePolicy)),
+		rest.Get("/api/1/mediation-limits", scoped(scopeRead, GetMediationLimitPolicy)),
+		rest.Post("/api/1/mediation-limits", scoped(scopeChannel, SetMediationLimitPolicy)),
+		rest.Get("/api/1/mediation-limits/channels", scoped(scopeRead, GetMediationChannelStatus)),
+		rest.Get("/api/1/fee", scoped(scopeRead, GetAllFeeChargeRecord)),
 
 		/*
 			test
 		*/
-		rest.Get("/api/1/stop", Stop),
-		rest.Get("/api/1/switch/:mesh", SwitchNetwork),
-		rest.Post("/api/1/updatenodes", UpdateMeshNetworkNodes),
+		rest.Get("/api/1/stop", scoped(scopeDebug, Stop)),
+		rest.Get("/api/1/switch/:mesh", scoped(scopeDebug, SwitchNetwork)),
+		rest.Post("/api/1/updatenodes", scoped(scopeDebug, UpdateMeshNetworkNodes)),
 
 		/*
 			1. withdraw
@@ -122,41 +179,56 @@ func Start() {
 			3. cancel prepare:
 			{"op": "cancelprepare"}
 		*/
-		rest.Put("/api/1/withdraw/:channel", withdraw),
+		rest.Put("/api/1/withdraw/:channel", scoped(scopeChannel, idempotent(withdraw))),
 		/*
 			1. prepare for withdraw:
 			{"op":"preparesettle",}
 			3. cancel prepare:
 			{"op": "cancelprepare"}
 		*/
-		rest.Put("/api/1/settle/:channel", nil),
+		rest.Put("/api/1/settle/:channel", scoped(scopeChannel, nil)),
 		/*
 			events
 		*/
-		//rest.Get("/api/1/events/network", EventNetwork),
-		//rest.Get("/api/1/events/tokens/:token", EventTokens),
-		//rest.Get("/api/1/events/channels/:channel", EventChannels),
+		rest.Get("/api/1/events/network", scoped(scopeRead, EventNetwork)),
+		rest.Get("/api/1/events/tokens/:token", scoped(scopeRead, EventTokens)),
+		rest.Get("/api/1/events/channels/:channel", scoped(scopeRead, EventChannels)),
+		rest.Get("/api/1/channel-histories", scoped(scopeRead, GetChannelHistories)),
+		rest.Get("/api/1/channel-histories/:channel/:openblocknumber/statement", scoped(scopeRead, GetChannelStatement)),
+		/*
+			JSON-RPC 2.0, scope of every method is checked by RPC
+		*/
+		rest.Post("/api/1/rpc", JSONRPC),
+		/*
+			api tokens
+		*/
+		rest.Get("/api/1/api-tokens", scoped(scopeDebug, GetAPITokens)),
+		rest.Post("/api/1/api-tokens", scoped(scopeDebug, AddAPIToken)),
+		rest.Delete("/api/1/api-tokens/:id", scoped(scopeDebug, RemoveAPIToken)),
 		/*
 			for debug only
 		*/
-		rest.Get("/api/1/debug/system-status", GetSystemStatus),
-		rest.Get("/api/1/debug/balance/:token/:addr", Balance),
-		rest.Get("/api/1/debug/transfer/:token/:addr/:value", TransferToken),
-		rest.Get("/api/1/debug/ethbalance/:addr", EthBalance),
-		rest.Get("/api/1/debug/ethstatus", EthereumStatus),
-		rest.Get("/api/1/debug/force-unlock/:channel/:locksecrethash/:secrethash", ForceUnlock),
-		rest.Get("/api/1/debug/pfs/:channel", BalanceUpdateForPFS),
-		rest.Post("/api/1/debug/notify_network_down", NotifyNetworkDown), // notify photon network down
-		rest.Get("/api/1/debug/shutdown", func(writer rest.ResponseWriter, request *rest.Request) {
+		rest.Get("/api/1/debug/system-status", scoped(scopeDebug, GetSystemStatus)),
+		rest.Get("/api/1/debug/balance/:token/:addr", scoped(scopeDebug, Balance)),
+		rest.Get("/api/1/debug/transfer/:token/:addr/:value", scoped(scopeDebug, TransferToken)),
+		rest.Get("/api/1/debug/ethbalance/:addr", scoped(scopeDebug, EthBalance)),
+		rest.Get("/api/1/debug/ethstatus", scoped(scopeDebug, EthereumStatus)),
+		rest.Get("/api/1/debug/force-unlock/:channel/:locksecrethash/:secrethash", scoped(scopeDebug, ForceUnlock)),
+		rest.Get("/api/1/debug/pfs/:channel", scoped(scopeDebug, BalanceUpdateForPFS)),
+		rest.Post("/api/1/debug/notify_network_down", scoped(scopeDebug, NotifyNetworkDown)), // notify photon network down
+		rest.Get("/api/1/debug/shutdown", scoped(scopeDebug, func(writer rest.ResponseWriter, request *rest.Request) {
 			API.Photon.Stop()
 			utils.SystemExit(0)
-		}),
+		})),
 	)
 	if err != nil {
 		log.Crit(fmt.Sprintf("maker router :%s", err))
 	}
 	api.SetApp(router)
 	listen := fmt.Sprintf("%s:%d", Config.APIHost, Config.APIPort)
+	if Config.APITLSCert != "" && Config.APITLSKey != "" {
+		log.Crit(fmt.Sprintf("https listen and serve :%s", http.ListenAndServeTLS(listen, Config.APITLSCert, Config.APITLSKey, api.MakeHandler())))
+	}
 	log.Crit(fmt.Sprintf("http listen and serve :%s", http.ListenAndServe(listen, api.MakeHandler())))
 }
 
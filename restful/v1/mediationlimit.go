@@ -0,0 +1,64 @@
+package v1
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// GetMediationLimitPolicy :
+func GetMediationLimitPolicy(w rest.ResponseWriter, r *rest.Request) {
+	err := w.WriteJson(API.GetMediationLimitPolicy())
+	if err != nil {
+		log.Warn(fmt.Sprintf("writejson err %s", err))
+	}
+}
+
+// SetMediationLimitPolicy :
+func SetMediationLimitPolicy(w rest.ResponseWriter, r *rest.Request) {
+	req := &models.MediationLimitPolicy{}
+	err := r.DecodeJsonPayload(req)
+	if err != nil {
+		log.Error(err.Error())
+		rest.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = API.SetMediationLimitPolicy(req)
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err = w.WriteJson(req)
+	if err != nil {
+		log.Warn(fmt.Sprintf("writejson err %s", err))
+	}
+}
+
+/*
+GetMediationChannelStatus in-flight locks of partner, limit and rejected mediated transfers of each open channel,
+optionally filtered by ?token=
+*/
+func GetMediationChannelStatus(w rest.ResponseWriter, r *rest.Request) {
+	token := utils.EmptyAddress
+	if s := r.URL.Query().Get("token"); s != "" {
+		if !common.IsHexAddress(s) {
+			rest.Error(w, fmt.Sprintf("invalid token %s", s), http.StatusBadRequest)
+			return
+		}
+		token = common.HexToAddress(s)
+	}
+	ss, err := API.GetMediationChannelStatus(token)
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err = w.WriteJson(ss)
+	if err != nil {
+		log.Warn(fmt.Sprintf("writejson err %s", err))
+	}
+}
@@ -0,0 +1,182 @@
+package v1
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/notify"
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+// keepAliveInterval comment line sent to keep idle connection alive
+const keepAliveInterval = 15 * time.Second
+
+// getConsumer name of the consumer given by `consumer` in query string, every consumer has its own ack cursor
+func getConsumer(r *rest.Request) string {
+	if c := r.URL.Query().Get("consumer"); c != "" {
+		return c
+	}
+	return notify.ConsumerDefault
+}
+
+/*
+getCursor returns the last event ID client has seen,
+`Last-Event-ID` header is set by browser EventSource when reconnecting,
+and `cursor` in query string has higher priority.
+if neither is given, start from the events not acknowledged by this consumer yet.
+*/
+func getCursor(r *rest.Request) (cursor uint64, err error) {
+	s := r.Header.Get("Last-Event-ID")
+	if c := r.URL.Query().Get("cursor"); c != "" {
+		s = c
+	}
+	if s == "" {
+		return API.Photon.NotifyHandler.AckedEventID(getConsumer(r)), nil
+	}
+	return strconv.ParseUint(s, 10, 64)
+}
+
+func writeSSEEvent(w http.ResponseWriter, e *notify.Event) (err error) {
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, e.Data)
+	return
+}
+
+/*
+NotificationStream push received transfers, sent transfers, notices, channel status
+and connection status to client with Server-Sent Events.
+client can resume with `?cursor=<last event id>` or header `Last-Event-ID`.
+when some events after cursor are too old to resume, an `events_lost` event is sent first.
+*/
+func NotificationStream(w rest.ResponseWriter, r *rest.Request) {
+	cursor, err := getCursor(r)
+	if err != nil {
+		rest.Error(w, "invalid cursor", http.StatusBadRequest)
+		return
+	}
+	hw := w.(http.ResponseWriter)
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		rest.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	closeNotifier, ok := w.(http.CloseNotifier)
+	if !ok {
+		rest.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	sub, backlog, complete := API.Photon.NotifyHandler.SubscribeEvents(cursor)
+	defer sub.Unsubscribe()
+	hw.Header().Set("Content-Type", "text/event-stream")
+	hw.Header().Set("Cache-Control", "no-cache")
+	hw.Header().Set("Connection", "keep-alive")
+	hw.WriteHeader(http.StatusOK)
+	if !complete {
+		_, err = fmt.Fprintf(hw, "event: events_lost\ndata: {\"cursor\":%d}\n\n", cursor)
+		if err != nil {
+			return
+		}
+	}
+	for _, e := range backlog {
+		err = writeSSEEvent(hw, e)
+		if err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case e, ok := <-sub.C:
+			if !ok {
+				// too slow or photon stopped, client should reconnect with the last event id
+				return
+			}
+			err = writeSSEEvent(hw, e)
+		case <-ticker.C:
+			_, err = fmt.Fprint(hw, ": keep-alive\n\n")
+		case <-closeNotifier.CloseNotify():
+			return
+		}
+		if err != nil {
+			log.Warn(fmt.Sprintf("NotificationStream write err %s", err))
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// NotificationsResponse :
+type NotificationsResponse struct {
+	Events   []*notify.Event `json:"events"`
+	Complete bool            `json:"complete"` // false when some events after cursor are acknowledged or too old to get
+	AckedID  uint64          `json:"acked_id"` // acknowledged by this consumer
+	LastID   uint64          `json:"last_id"`
+}
+
+/*
+GetNotifications returns events not acknowledged after cursor,
+for clients can not keep a long connection.
+*/
+func GetNotifications(w rest.ResponseWriter, r *rest.Request) {
+	cursor, err := getCursor(r)
+	if err != nil {
+		rest.Error(w, "invalid cursor", http.StatusBadRequest)
+		return
+	}
+	resp := &NotificationsResponse{
+		Events: []*notify.Event{},
+	}
+	events, complete := API.Photon.NotifyHandler.GetEvents(cursor)
+	if events != nil {
+		resp.Events = events
+	}
+	resp.Complete = complete
+	resp.AckedID = API.Photon.NotifyHandler.AckedEventID(getConsumer(r))
+	resp.LastID = API.Photon.NotifyHandler.LastEventID()
+	err = w.WriteJson(resp)
+	if err != nil {
+		log.Warn(fmt.Sprintf("writejson err %s", err))
+	}
+}
+
+/*
+AckNotifications tells photon all events not greater than id have been processed by consumer,
+they will be removed from the outbox and never be replayed after all consumers have acknowledged them.
+*/
+func AckNotifications(w rest.ResponseWriter, r *rest.Request) {
+	var req struct {
+		ID       uint64 `json:"id"`
+		Consumer string `json:"consumer"`
+	}
+	err := r.DecodeJsonPayload(&req)
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Consumer == "" {
+		req.Consumer = notify.ConsumerDefault
+	}
+	err = API.Photon.NotifyHandler.AckEvents(req.Consumer, req.ID)
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+/*
+RemoveNotificationConsumer events are not kept for this consumer any more,
+a consumer which will never come back should be removed, otherwise the outbox keeps growing.
+*/
+func RemoveNotificationConsumer(w rest.ResponseWriter, r *rest.Request) {
+	err := API.Photon.NotifyHandler.RemoveEventConsumer(r.PathParam("consumer"))
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,84 @@
+package v1
+
+import (
+	"fmt"
+	"math/big"
+	"net/http"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// RebalanceData post for rebalance
+type RebalanceData struct {
+	FromChannel    common.Hash `json:"from_channel"`
+	ToChannel      common.Hash `json:"to_channel"`
+	Amount         *big.Int    `json:"amount"`
+	MaxFee         *big.Int    `json:"max_fee"`
+	Sync           bool        `json:"sync,omitempty"`
+	LockSecretHash common.Hash `json:"lock_secret_hash"`
+}
+
+/*
+Rebalance moves amount from one channel to another channel of the same token by a transfer to ourself
+*/
+func Rebalance(w rest.ResponseWriter, r *rest.Request) {
+	var err error
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> Rebalance ,err=%v", err))
+	}()
+	req := &RebalanceData{}
+	err = r.DecodeJsonPayload(req)
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Amount == nil || req.Amount.Cmp(utils.BigInt0) <= 0 {
+		rest.Error(w, "Invalid amount", http.StatusBadRequest)
+		return
+	}
+	if req.MaxFee == nil {
+		req.MaxFee = big.NewInt(0)
+	}
+	if req.MaxFee.Cmp(utils.BigInt0) < 0 {
+		rest.Error(w, "Invalid max_fee", http.StatusBadRequest)
+		return
+	}
+	c, err := API.GetChannel(req.FromChannel)
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	// 转给自己的金额会回来,只有手续费是花掉的
+	res, err := reserveAPIToken(r, c.TokenAddress(), req.MaxFee)
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	defer res.release()
+	result, err := API.Rebalance(req.FromChannel, req.ToChannel, req.Amount, req.MaxFee)
+	if err == nil {
+		idempotencyStarted(r, result.LockSecretHash, c.TokenAddress(), API.Photon.NodeAddress)
+		if req.Sync {
+			err = API.WaitTransfer(result, params.MaxRequestTimeout)
+		} else {
+			err = API.WaitTransferStarted(result)
+		}
+	}
+	if err == nil || err == rerr.ErrTransferTimeout {
+		res.commit()
+	}
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	req.LockSecretHash = result.LockSecretHash
+	err = w.WriteJson(req)
+	if err != nil {
+		log.Warn(fmt.Sprintf("writejson err %s", err))
+	}
+}
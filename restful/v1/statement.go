@@ -0,0 +1,72 @@
+package v1
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/SmartMeshFoundation/Photon"
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+GetChannelHistories list settled and current channels, query parameters token and partner are optional
+*/
+func GetChannelHistories(w rest.ResponseWriter, r *rest.Request) {
+	var token, partner common.Address
+	m := r.URL.Query()
+	if t := m.Get("token"); t != "" {
+		if !common.IsHexAddress(t) {
+			rest.Error(w, fmt.Sprintf("invalid token %s", t), http.StatusBadRequest)
+			return
+		}
+		token = common.HexToAddress(t)
+	}
+	if p := m.Get("partner"); p != "" {
+		if !common.IsHexAddress(p) {
+			rest.Error(w, fmt.Sprintf("invalid partner %s", p), http.StatusBadRequest)
+			return
+		}
+		partner = common.HexToAddress(p)
+	}
+	hs, err := API.GetChannelHistories(token, partner)
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if hs == nil {
+		hs = []*photon.ChannelHistory{}
+	}
+	err = w.WriteJson(hs)
+	if err != nil {
+		log.Warn(fmt.Sprintf("writejson err %s", err))
+	}
+}
+
+/*
+GetChannelStatement statement of one lifetime of a channel
+*/
+func GetChannelStatement(w rest.ResponseWriter, r *rest.Request) {
+	chstr := r.PathParam("channel")
+	if len(chstr) != len(utils.EmptyHash.String()) {
+		rest.Error(w, "argument error", http.StatusBadRequest)
+		return
+	}
+	openBlockNumber, err := strconv.ParseInt(r.PathParam("openblocknumber"), 10, 64)
+	if err != nil {
+		rest.Error(w, "invalid open block number", http.StatusBadRequest)
+		return
+	}
+	s, err := API.GetChannelStatement(common.HexToHash(chstr), openBlockNumber)
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	err = w.WriteJson(s)
+	if err != nil {
+		log.Warn(fmt.Sprintf("writejson err %s", err))
+	}
+}
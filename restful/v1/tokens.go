@@ -2,9 +2,11 @@ package v1
 
 import (
 	"fmt"
+	"math/big"
 	"net/http"
 
 	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
 	"github.com/SmartMeshFoundation/Photon/utils"
 	"github.com/ant0ine/go-json-rest/rest"
 )
@@ -64,3 +66,95 @@ func TokenPartners(w rest.ResponseWriter, r *rest.Request) {
 		log.Warn(fmt.Sprintf("writejson err %s", err))
 	}
 }
+
+/*
+GetTokenMetadata is api of /api/1/tokens/:token/metadata
+symbol, name and decimals of token, read from token contract and cached
+*/
+func GetTokenMetadata(w rest.ResponseWriter, r *rest.Request) {
+	tokenAddr, err := utils.HexToAddress(r.PathParam("token"))
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	m, err := API.GetTokenMetadata(tokenAddr)
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	err = w.WriteJson(m)
+	if err != nil {
+		log.Warn(fmt.Sprintf("writejson err %s", err))
+	}
+}
+
+/*
+RegisterToken is api of PUT /api/1/tokens/:token
+token network is created by opening the first channel of this token,
+so partner_address and balance(or balance_human) of this channel are required.
+*/
+func RegisterToken(w rest.ResponseWriter, r *rest.Request) {
+	type registerTokenReq struct {
+		PartnerAddress string   `json:"partner_address"`
+		Balance        *big.Int `json:"balance"`
+		BalanceHuman   string   `json:"balance_human"`
+		SettleTimeout  int      `json:"settle_timeout"`
+	}
+	type registerTokenResponse struct {
+		Token   *models.TokenMetadata `json:"token"`
+		Channel *ChannelData          `json:"channel"`
+	}
+	var err error
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> RegisterToken ,err=%v", err))
+	}()
+	tokenAddr, err := utils.HexToAddress(r.PathParam("token"))
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req := &registerTokenReq{}
+	err = r.DecodeJsonPayload(req)
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	partnerAddr, err := utils.HexToAddress(req.PartnerAddress)
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Balance == nil && req.BalanceHuman != "" {
+		req.Balance, err = API.ParseAmount(tokenAddr, req.BalanceHuman)
+		if err != nil {
+			rest.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	idempotencyStarted(r, utils.EmptyHash, tokenAddr, partnerAddr)
+	m, c, err := API.RegisterToken(tokenAddr, partnerAddr, req.SettleTimeout, req.Balance)
+	if err != nil {
+		log.Error(err.Error())
+		rest.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	d := &ChannelData{
+		ChannelIdentifier:   c.ChannelIdentifier.ChannelIdentifier.String(),
+		OpenBlockNumber:     c.ChannelIdentifier.OpenBlockNumber,
+		PartnerAddrses:      c.PartnerAddress().String(),
+		Balance:             c.OurBalance(),
+		PartnerBalance:      c.PartnerBalance(),
+		State:               c.State,
+		StateString:         c.State.String(),
+		SettleTimeout:       c.SettleTimeout,
+		TokenAddress:        c.TokenAddress().String(),
+		LockedAmount:        c.OurAmountLocked(),
+		PartnerLockedAmount: c.PartnerAmountLocked(),
+		RevealTimeout:       c.RevealTimeout,
+	}
+	d.FormatAmounts(API)
+	err = w.WriteJson(&registerTokenResponse{Token: m, Channel: d})
+	if err != nil {
+		log.Warn(fmt.Sprintf("writejson err %s", err))
+	}
+}
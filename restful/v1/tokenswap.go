@@ -79,6 +79,8 @@ func TokenSwap(w rest.ResponseWriter, r *rest.Request) {
 		rest.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	res := newAPITokenReservation(r)
+	defer res.release()
 	if req.Role == "maker" {
 		// 校验secret和lockSecretHash是否匹配
 		// check whether secret and lockSecretHash match.
@@ -86,11 +88,27 @@ func TokenSwap(w rest.ResponseWriter, r *rest.Request) {
 			rest.Error(w, "must provide a matching pair of secret and lockSecretHash", http.StatusBadRequest)
 			return
 		}
+		err = res.reserve(makerToken, req.SendingAmount)
+		if err != nil {
+			rest.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
 		err = API.TokenSwapAndWait(lockSecretHash, makerToken, takerToken,
 			API.Photon.NodeAddress, target, req.SendingAmount, req.ReceivingAmount, req.Secret)
+		if err == nil {
+			res.commit()
+		}
 	} else if req.Role == "taker" {
+		err = res.reserve(takerToken, req.ReceivingAmount)
+		if err != nil {
+			rest.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
 		err = API.ExpectTokenSwap(lockSecretHash, takerToken, makerToken,
 			target, API.Photon.NodeAddress, req.ReceivingAmount, req.SendingAmount)
+		if err == nil {
+			res.commit()
+		}
 	} else {
 		err = fmt.Errorf("Provided invalid token swap role %s", req.Role)
 	}
@@ -4,36 +4,57 @@ import (
 	"fmt"
 	"math/big"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
 	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/rerr"
 	"github.com/SmartMeshFoundation/Photon/utils"
 	"github.com/ant0ine/go-json-rest/rest"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 )
 
-//TransferData post for transfers
+/*
+TransferData post for transfers,
+AmountHuman is amount in decimals of token like 1.25, it's used when Amount is absent.
+MultiPath splits the transfer over at most MaxParts channels, it cannot be used with IsDirect, Secret or Fee.
+Keysend encrypts a random secret with TargetPublicKey(hex), target settles without an invoice,
+TargetPublicKey can be omitted if we have learned it, it cannot be used with IsDirect, Secret, Fee or MultiPath.
+*/
 type TransferData struct {
-	Initiator      string   `json:"initiator_address"`
-	Target         string   `json:"target_address"`
-	Token          string   `json:"token_address"`
-	Amount         *big.Int `json:"amount"`
-	Secret         string   `json:"secret,omitempty"` // 当用户想使用自己指定的密码,而非随机密码时使用	// client can assign specific secret
-	LockSecretHash string   `json:"lockSecretHash"`
-	Fee            *big.Int `json:"fee,omitempty"`
-	IsDirect       bool     `json:"is_direct,omitempty"`
-	Sync           bool     `json:"sync,omitempty"` //是否同步
-	Data           string   `json:"data"`           // 交易附加信息,长度不超过256
+	Initiator       string   `json:"initiator_address"`
+	Target          string   `json:"target_address"`
+	Token           string   `json:"token_address"`
+	Amount          *big.Int `json:"amount"`
+	Secret          string   `json:"secret,omitempty"` // 当用户想使用自己指定的密码,而非随机密码时使用	// client can assign specific secret
+	LockSecretHash  string   `json:"lockSecretHash"`
+	Fee             *big.Int `json:"fee,omitempty"`
+	IsDirect        bool     `json:"is_direct,omitempty"`
+	Sync            bool     `json:"sync,omitempty"` //是否同步
+	Data            string   `json:"data"`           // 交易附加信息,长度不超过256,直接交易不超过768
+	AmountHuman     string   `json:"amount_human,omitempty"`
+	MultiPath       bool     `json:"multi_path,omitempty"` // 分成几个部分从不同的通道发出
+	MaxParts        int      `json:"max_parts,omitempty"`
+	Keysend         bool     `json:"keysend,omitempty"` // 不需要收款请求,密码加密以后放在交易中
+	TargetPublicKey string   `json:"target_public_key,omitempty"`
 }
 
 /*
-GetSentTransfers returns list of sent transfer between `from_block` and `to_block`
+GetSentTransfers returns list of sent transfer match query parameters,
+see getTransferQuery for the parameters
 */
 func GetSentTransfers(w rest.ResponseWriter, r *rest.Request) {
-	from, to := getFromTo(r)
-	log.Trace(fmt.Sprintf("from=%d,to=%d\n", from, to))
-	trs, err := API.GetSentTransfers(from, to)
+	q, err := getTransferQuery(r)
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Trace(fmt.Sprintf("query=%s", utils.StringInterface(q, 2)))
+	trs, err := API.QuerySentTransfers(q)
 	if err != nil {
 		rest.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -45,12 +66,17 @@ func GetSentTransfers(w rest.ResponseWriter, r *rest.Request) {
 }
 
 /*
-GetReceivedTransfers retuns list of received transfer between `from_block` and `to_block`
+GetReceivedTransfers retuns list of received transfer match query parameters,
+see getTransferQuery for the parameters
 it contains token swap
 */
 func GetReceivedTransfers(w rest.ResponseWriter, r *rest.Request) {
-	from, to := getFromTo(r)
-	trs, err := API.GetReceivedTransfers(from, to)
+	q, err := getTransferQuery(r)
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	trs, err := API.QueryReceivedTransfers(q)
 	if err != nil {
 		rest.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -61,6 +87,90 @@ func GetReceivedTransfers(w rest.ResponseWriter, r *rest.Request) {
 	}
 }
 
+// parseQueryTime time in RFC3339 or unix seconds
+func parseQueryTime(s string) (t time.Time, err error) {
+	if n, err2 := strconv.ParseInt(s, 10, 64); err2 == nil {
+		return time.Unix(n, 0), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+/*
+getTransferQuery parse query parameters of transfers api:
+from_block,to_block,token,partner,min_amount,max_amount,from_time,to_time,data,sort,order,offset,limit
+*/
+func getTransferQuery(r *rest.Request) (q *models.TransferQuery, err error) {
+	q = models.NewTransferQuery()
+	q.FromBlock, q.ToBlock = getFromTo(r)
+	m := r.URL.Query()
+	if token := m.Get("token"); token != "" {
+		if !common.IsHexAddress(token) {
+			return nil, fmt.Errorf("invalid token %s", token)
+		}
+		q.TokenAddress = common.HexToAddress(token)
+	}
+	if partner := m.Get("partner"); partner != "" {
+		if !common.IsHexAddress(partner) {
+			return nil, fmt.Errorf("invalid partner %s", partner)
+		}
+		q.Partner = common.HexToAddress(partner)
+	}
+	if a := m.Get("min_amount"); a != "" {
+		var ok bool
+		q.MinAmount, ok = new(big.Int).SetString(a, 0)
+		if !ok {
+			return nil, fmt.Errorf("invalid min_amount %s", a)
+		}
+	}
+	if a := m.Get("max_amount"); a != "" {
+		var ok bool
+		q.MaxAmount, ok = new(big.Int).SetString(a, 0)
+		if !ok {
+			return nil, fmt.Errorf("invalid max_amount %s", a)
+		}
+	}
+	if t := m.Get("from_time"); t != "" {
+		q.FromTime, err = parseQueryTime(t)
+		if err != nil {
+			return nil, fmt.Errorf("invalid from_time %s", t)
+		}
+	}
+	if t := m.Get("to_time"); t != "" {
+		q.ToTime, err = parseQueryTime(t)
+		if err != nil {
+			return nil, fmt.Errorf("invalid to_time %s", t)
+		}
+	}
+	q.Data = m.Get("data")
+	switch sortBy := models.TransferSortBy(m.Get("sort")); sortBy {
+	case "":
+	case models.TransferSortByTime, models.TransferSortByAmount:
+		q.SortBy = sortBy
+	default:
+		return nil, fmt.Errorf("invalid sort %s", sortBy)
+	}
+	switch order := m.Get("order"); order {
+	case "", "asc":
+	case "desc":
+		q.Desc = true
+	default:
+		return nil, fmt.Errorf("invalid order %s", order)
+	}
+	if o := m.Get("offset"); o != "" {
+		q.Offset, err = strconv.Atoi(o)
+		if err != nil || q.Offset < 0 {
+			return nil, fmt.Errorf("invalid offset %s", o)
+		}
+	}
+	if l := m.Get("limit"); l != "" {
+		q.Limit, err = strconv.Atoi(l)
+		if err != nil || q.Limit <= 0 {
+			return nil, fmt.Errorf("invalid limit %s", l)
+		}
+	}
+	return q, nil
+}
+
 /*
 Transfers is the api of /transfer/:token/:partner
 */
@@ -96,7 +206,14 @@ func Transfers(w rest.ResponseWriter, r *rest.Request) {
 		rest.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	if req.Amount.Cmp(utils.BigInt0) <= 0 {
+	if req.Amount == nil && req.AmountHuman != "" {
+		req.Amount, err = API.ParseAmount(tokenAddr, req.AmountHuman)
+		if err != nil {
+			rest.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Amount == nil || req.Amount.Cmp(utils.BigInt0) <= 0 {
 		rest.Error(w, "Invalid amount", http.StatusBadRequest)
 		return
 	}
@@ -111,15 +228,55 @@ func Transfers(w rest.ResponseWriter, r *rest.Request) {
 		rest.Error(w, "Invalid secret", http.StatusBadRequest)
 		return
 	}
-	if len(req.Data) > params.MaxTransferDataLen {
-		rest.Error(w, "Invalid data, length must < 256", http.StatusBadRequest)
+	maxDataLen := params.MaxTransferDataLen
+	if req.IsDirect {
+		maxDataLen = params.MaxDirectTransferDataLen
+	}
+	if len(req.Data) > maxDataLen {
+		rest.Error(w, fmt.Sprintf("Invalid data, length must < %d", maxDataLen), http.StatusBadRequest)
+		return
+	}
+	if req.MultiPath && (req.IsDirect || len(req.Secret) != 0 || req.Fee.Cmp(utils.BigInt0) > 0) {
+		rest.Error(w, "multi_path cannot be used with is_direct, secret or fee", http.StatusBadRequest)
 		return
 	}
+	if req.Keysend && (req.IsDirect || req.MultiPath || len(req.Secret) != 0 || req.Fee.Cmp(utils.BigInt0) > 0) {
+		rest.Error(w, "keysend cannot be used with is_direct, multi_path, secret or fee", http.StatusBadRequest)
+		return
+	}
+	var targetPublicKey []byte
+	if req.TargetPublicKey != "" {
+		targetPublicKey, err = hexutil.Decode(req.TargetPublicKey)
+		if err != nil {
+			rest.Error(w, "Invalid target_public_key", http.StatusBadRequest)
+			return
+		}
+	}
+	res, err := reserveAPIToken(r, tokenAddr, new(big.Int).Add(req.Amount, req.Fee))
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	defer res.release()
 	var result *utils.AsyncResult
-	if req.Sync {
-		result, err = API.Transfer(tokenAddr, req.Amount, req.Fee, targetAddr, common.HexToHash(req.Secret), params.MaxRequestTimeout, req.IsDirect, req.Data)
+	if req.MultiPath {
+		result, err = API.MultiPathTransfer(tokenAddr, req.Amount, targetAddr, req.MaxParts, req.Data)
+	} else if req.Keysend {
+		result, err = API.KeysendTransfer(tokenAddr, req.Amount, targetAddr, targetPublicKey, req.Data)
 	} else {
-		result, err = API.TransferAsync(tokenAddr, req.Amount, req.Fee, targetAddr, common.HexToHash(req.Secret), req.IsDirect, req.Data)
+		result, err = API.TransferInternal(tokenAddr, req.Amount, req.Fee, targetAddr, common.HexToHash(req.Secret), req.IsDirect, req.Data)
+	}
+	if err == nil {
+		idempotencyStarted(r, result.LockSecretHash, tokenAddr, targetAddr)
+		if req.Sync {
+			err = API.WaitTransfer(result, params.MaxRequestTimeout)
+		} else {
+			err = API.WaitTransferStarted(result)
+		}
+	}
+	if err == nil || err == rerr.ErrTransferTimeout {
+		// 超时的交易仍然可能成功
+		res.commit()
 	}
 	if err != nil {
 		rest.Error(w, err.Error(), http.StatusConflict)
@@ -132,6 +289,7 @@ func Transfers(w rest.ResponseWriter, r *rest.Request) {
 	req.Target = target
 	req.Token = token
 	req.LockSecretHash = result.LockSecretHash.String()
+	req.AmountHuman = API.FormatAmount(tokenAddr, req.Amount)
 	err = w.WriteJson(req)
 	if err != nil {
 		log.Warn(fmt.Sprintf("writejson err %s", err))
@@ -182,3 +340,27 @@ func CancelTransfer(w rest.ResponseWriter, r *rest.Request) {
 		return
 	}
 }
+
+/*
+GetPublicKey public key of a node which can be used as target_public_key of keysend transfer,
+it's known only if the node has sent SecretRequest or RevealSecret to us, or it's ourself.
+*/
+func GetPublicKey(w rest.ResponseWriter, r *rest.Request) {
+	addr, err := utils.HexToAddress(r.PathParam("address"))
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	pk, err := API.GetPublicKey(addr)
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	err = w.WriteJson(map[string]string{
+		"address":    pk.Address.String(),
+		"public_key": hexutil.Encode(pk.PublicKey),
+	})
+	if err != nil {
+		log.Warn(fmt.Sprintf("writejson err %s", err))
+	}
+}
@@ -0,0 +1,62 @@
+package v1
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// GetDelegations list channels watched by us
+func GetDelegations(w rest.ResponseWriter, r *rest.Request) {
+	ds, err := API.GetDelegations()
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if ds == nil {
+		ds = []*models.Delegation{}
+	}
+	err = w.WriteJson(ds)
+	if err != nil {
+		log.Warn(fmt.Sprintf("writejson err %s", err))
+	}
+}
+
+/*
+AddDelegation accept a delegation of channel, which is generated by `/api/1/thirdparty/` of delegator
+*/
+func AddDelegation(w rest.ResponseWriter, r *rest.Request) {
+	var err error
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> AddDelegation ,err=%v", err))
+	}()
+	d := &models.Delegation{}
+	err = r.DecodeJsonPayload(d)
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = API.AddDelegation(d)
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = w.WriteJson(d)
+	if err != nil {
+		log.Warn(fmt.Sprintf("writejson err %s", err))
+	}
+}
+
+// RemoveDelegation stop watching a channel
+func RemoveDelegation(w rest.ResponseWriter, r *rest.Request) {
+	err := API.RemoveDelegation(common.HexToHash(r.PathParam("channel")))
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
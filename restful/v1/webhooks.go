@@ -0,0 +1,81 @@
+package v1
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+/*
+AddWebhook register a webhook,
+secret is returned only once, keep it to verify signature of deliveries.
+*/
+func AddWebhook(w rest.ResponseWriter, r *rest.Request) {
+	var err error
+	defer func() {
+		log.Trace(fmt.Sprintf("Restful Api Call ----> AddWebhook ,err=%v", err))
+	}()
+	req := &models.Webhook{}
+	err = r.DecodeJsonPayload(req)
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	wh, err := API.Photon.Webhooks.AddWebhook(req)
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	err = w.WriteJson(wh)
+	if err != nil {
+		log.Warn(fmt.Sprintf("writejson err %s", err))
+	}
+}
+
+// GetWebhooks list all webhooks without secret
+func GetWebhooks(w rest.ResponseWriter, r *rest.Request) {
+	ws := API.Photon.Webhooks.Webhooks()
+	if ws == nil {
+		ws = []*models.Webhook{}
+	}
+	err := w.WriteJson(ws)
+	if err != nil {
+		log.Warn(fmt.Sprintf("writejson err %s", err))
+	}
+}
+
+// RemoveWebhook remove a webhook and deliveries not finished
+func RemoveWebhook(w rest.ResponseWriter, r *rest.Request) {
+	err := API.Photon.Webhooks.RemoveWebhook(r.PathParam("id"))
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// GetWebhookDeliveries list deliveries pending or failed
+func GetWebhookDeliveries(w rest.ResponseWriter, r *rest.Request) {
+	ds := API.Photon.Webhooks.Deliveries()
+	if ds == nil {
+		ds = []*models.WebhookDelivery{}
+	}
+	err := w.WriteJson(ds)
+	if err != nil {
+		log.Warn(fmt.Sprintf("writejson err %s", err))
+	}
+}
+
+// RetryWebhookDelivery send a failed delivery again
+func RetryWebhookDelivery(w rest.ResponseWriter, r *rest.Request) {
+	err := API.Photon.Webhooks.RetryDelivery(r.PathParam("key"))
+	if err != nil {
+		rest.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
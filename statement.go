@@ -0,0 +1,325 @@
+package photon
+
+import (
+	"bytes"
+	"math/big"
+	"sort"
+
+	"github.com/SmartMeshFoundation/Photon/channel/channeltype"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+ChannelHistory : one lifetime of a channel.
+A channel between the same participants always has the same ChannelIdentifier,
+so a reopened channel is told apart by OpenBlockNumber.
+*/
+type ChannelHistory struct {
+	ChannelIdentifier common.Hash       `json:"channel_identifier"`
+	OpenBlockNumber   int64             `json:"open_block_number"`
+	TokenAddress      common.Address    `json:"token_address"`
+	PartnerAddress    common.Address    `json:"partner_address"`
+	State             channeltype.State `json:"state"`
+	StateString       string            `json:"state_string"`
+	SettleTimeout     int               `json:"settle_timeout"`
+	ClosedBlock       int64             `json:"closed_block"`
+	SettledBlock      int64             `json:"settled_block"`
+}
+
+func newChannelHistory(c *channeltype.Serialization) *ChannelHistory {
+	return &ChannelHistory{
+		ChannelIdentifier: c.ChannelIdentifier.ChannelIdentifier,
+		OpenBlockNumber:   c.ChannelIdentifier.OpenBlockNumber,
+		TokenAddress:      c.TokenAddress(),
+		PartnerAddress:    c.PartnerAddress(),
+		State:             c.State,
+		StateString:       c.State.String(),
+		SettleTimeout:     c.SettleTimeout,
+		ClosedBlock:       c.ClosedBlock,
+		SettledBlock:      c.SettledBlock,
+	}
+}
+
+// ChannelStatementDeposit : a deposit on chain, Amount is the increase, TotalDeposit is the deposit of participant after it
+type ChannelStatementDeposit struct {
+	Participant  common.Address `json:"participant"`
+	Amount       *big.Int       `json:"amount"`
+	TotalDeposit *big.Int       `json:"total_deposit"`
+	BlockNumber  int64          `json:"block_number"`
+	TxHash       common.Hash    `json:"tx_hash"`
+}
+
+// ChannelStatementWithdraw : a cooperative withdraw on chain, balances are deposits of participants after it
+type ChannelStatementWithdraw struct {
+	OurBalance     *big.Int    `json:"our_balance"`
+	PartnerBalance *big.Int    `json:"partner_balance"`
+	BlockNumber    int64       `json:"block_number"`
+	TxHash         common.Hash `json:"tx_hash"`
+}
+
+// ChannelStatementUnlock : a lock unlocked on chain, TransferredAmount is the transferred amount of payer after it
+type ChannelStatementUnlock struct {
+	Payer             common.Address `json:"payer"`
+	LockHash          common.Hash    `json:"lock_hash"`
+	TransferredAmount *big.Int       `json:"transferred_amount"`
+	BlockNumber       int64          `json:"block_number"`
+	TxHash            common.Hash    `json:"tx_hash"`
+}
+
+// ChannelStatementSettle : tokens returned to participants by settle or cooperative settle
+type ChannelStatementSettle struct {
+	Cooperative   bool        `json:"cooperative"`
+	OurAmount     *big.Int    `json:"our_amount"`
+	PartnerAmount *big.Int    `json:"partner_amount"`
+	BlockNumber   int64       `json:"block_number"`
+	TxHash        common.Hash `json:"tx_hash"`
+}
+
+// ChannelStatementTx : an on-chain transaction involved in the channel and events emitted by it
+type ChannelStatementTx struct {
+	TxHash      common.Hash `json:"tx_hash"`
+	BlockNumber int64       `json:"block_number"`
+	Events      []string    `json:"events"`
+}
+
+/*
+ChannelStatement :
+everything happened in one lifetime of a channel.
+On-chain records come from the local cache of contract events, so they are complete only if photon has been running since the channel opened.
+MediationFees contains fee records of transfers whose payer or payee channel is this one,
+FeeEarned only counts those received on this channel, so fees are not counted twice in statements of two channels.
+*/
+type ChannelStatement struct {
+	*ChannelHistory
+	Deposits          []*ChannelStatementDeposit  `json:"deposits"`
+	Withdraws         []*ChannelStatementWithdraw `json:"withdraws"`
+	SentTransfers     []*models.SentTransfer      `json:"sent_transfers"`
+	ReceivedTransfers []*models.ReceivedTransfer  `json:"received_transfers"`
+	MediationFees     []*models.FeeChargeRecord   `json:"mediation_fees"`
+	Unlocks           []*ChannelStatementUnlock   `json:"unlocks"`
+	Settle            *ChannelStatementSettle     `json:"settle,omitempty"`
+	Transactions      []*ChannelStatementTx       `json:"transactions"`
+	OurDeposit        *big.Int                    `json:"our_deposit"`
+	PartnerDeposit    *big.Int                    `json:"partner_deposit"`
+	SentAmount        *big.Int                    `json:"sent_amount"`
+	ReceivedAmount    *big.Int                    `json:"received_amount"`
+	FeeEarned         *big.Int                    `json:"fee_earned"`
+}
+
+/*
+GetChannelHistories settled channels and current channels, reopened channels are listed once for every lifetime.
+empty token or partner means no filter on it.
+*/
+func (r *API) GetChannelHistories(tokenAddress, partnerAddress common.Address) (hs []*ChannelHistory, err error) {
+	settled, err := r.Photon.dao.GetAllSettledChannel()
+	if err != nil {
+		return
+	}
+	chs, err := r.Photon.dao.GetChannelList(tokenAddress, partnerAddress)
+	if err != nil {
+		return
+	}
+	for _, c := range append(settled, chs...) {
+		if tokenAddress != utils.EmptyAddress && c.TokenAddress() != tokenAddress {
+			continue
+		}
+		if partnerAddress != utils.EmptyAddress && c.PartnerAddress() != partnerAddress {
+			continue
+		}
+		hs = append(hs, newChannelHistory(c))
+	}
+	sort.Slice(hs, func(i, j int) bool {
+		if hs[i].ChannelIdentifier != hs[j].ChannelIdentifier {
+			return bytes.Compare(hs[i].ChannelIdentifier[:], hs[j].ChannelIdentifier[:]) < 0
+		}
+		return hs[i].OpenBlockNumber < hs[j].OpenBlockNumber
+	})
+	return
+}
+
+// getChannelOfLifetime settled channel or current channel opened at openBlockNumber
+func (r *API) getChannelOfLifetime(channelIdentifier common.Hash, openBlockNumber int64) (c *channeltype.Serialization, err error) {
+	c, err = r.Photon.dao.GetSettledChannel(channelIdentifier, openBlockNumber)
+	if err == nil {
+		return
+	}
+	c, err = r.Photon.dao.GetChannelByAddress(channelIdentifier)
+	if err == nil && c.ChannelIdentifier.OpenBlockNumber == openBlockNumber {
+		return
+	}
+	return nil, rerr.ChannelNotFound(channelIdentifier.String())
+}
+
+// GetChannelStatement statement of the channel opened at openBlockNumber
+func (r *API) GetChannelStatement(channelIdentifier common.Hash, openBlockNumber int64) (s *ChannelStatement, err error) {
+	c, err := r.getChannelOfLifetime(channelIdentifier, openBlockNumber)
+	if err != nil {
+		return
+	}
+	s = &ChannelStatement{
+		ChannelHistory:    newChannelHistory(c),
+		Deposits:          []*ChannelStatementDeposit{},
+		Withdraws:         []*ChannelStatementWithdraw{},
+		SentTransfers:     []*models.SentTransfer{},
+		ReceivedTransfers: []*models.ReceivedTransfer{},
+		MediationFees:     []*models.FeeChargeRecord{},
+		Unlocks:           []*ChannelStatementUnlock{},
+		Transactions:      []*ChannelStatementTx{},
+		OurDeposit:        big.NewInt(0),
+		PartnerDeposit:    big.NewInt(0),
+		SentAmount:        big.NewInt(0),
+		ReceivedAmount:    big.NewInt(0),
+		FeeEarned:         big.NewInt(0),
+	}
+	toBlock := int64(-1)
+	if c.State == channeltype.StateSettled && c.SettledBlock > 0 {
+		toBlock = c.SettledBlock
+	}
+	err = r.fillStatementEvents(s, toBlock)
+	if err != nil {
+		return
+	}
+	q := models.NewTransferQuery()
+	q.TokenAddress = s.TokenAddress
+	q.FromBlock = openBlockNumber
+	q.ToBlock = toBlock
+	err = r.Photon.dao.IterateSentTransfers(q, func(st *models.SentTransfer) error {
+		if st.ChannelIdentifier == channelIdentifier && st.OpenBlockNumber == openBlockNumber {
+			s.SentTransfers = append(s.SentTransfers, st)
+			s.SentAmount.Add(s.SentAmount, bigOrZero(st.Amount))
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	err = r.Photon.dao.IterateReceivedTransfers(q, func(rt *models.ReceivedTransfer) error {
+		if rt.ChannelIdentifier == channelIdentifier && rt.OpenBlockNumber == openBlockNumber {
+			s.ReceivedTransfers = append(s.ReceivedTransfers, rt)
+			s.ReceivedAmount.Add(s.ReceivedAmount, bigOrZero(rt.Amount))
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	//手续费记录中没有 OpenBlockNumber, 只能根据块号区分
+	err = r.Photon.dao.IterateFeeChargeRecords(q, func(fr *models.FeeChargeRecord) error {
+		if fr.InChannel == channelIdentifier || fr.OutChannel == channelIdentifier {
+			s.MediationFees = append(s.MediationFees, fr)
+		}
+		if fr.InChannel == channelIdentifier {
+			s.FeeEarned.Add(s.FeeEarned, bigOrZero(fr.Fee))
+		}
+		return nil
+	})
+	return
+}
+
+/*
+fillStatementEvents fills on-chain records of s from cached contract events.
+events of the previous lifetime may be in the same block as ChannelOpenedAndDeposit,
+so events before ChannelOpenedAndDeposit and after settle are dropped.
+*/
+func (r *API) fillStatementEvents(s *ChannelStatement, toBlock int64) error {
+	err := r.checkContractEventsCached(s.OpenBlockNumber)
+	if err != nil {
+		return err
+	}
+	es, err := r.Photon.dao.GetContractEvents(&models.ContractEventFilter{
+		ChannelIdentifier: s.ChannelIdentifier,
+		FromBlock:         s.OpenBlockNumber,
+		ToBlock:           toBlock,
+	})
+	if err != nil {
+		return err
+	}
+	for i, e := range es {
+		if e.EventName == params.NameChannelOpenedAndDeposit && e.BlockNumber == s.OpenBlockNumber {
+			es = es[i:]
+			break
+		}
+	}
+	our := r.Photon.NodeAddress
+	deposits := map[common.Address]*big.Int{
+		our:              big.NewInt(0),
+		s.PartnerAddress: big.NewInt(0),
+	}
+	// ourFirst returns amounts of participant1 and participant2 in the order of us and partner
+	ourFirst := func(e *models.ContractEvent) (ourAmount, partnerAmount *big.Int) {
+		if e.Participant1 == our {
+			return bigOrZero(e.Participant1Amount), bigOrZero(e.Participant2Amount)
+		}
+		return bigOrZero(e.Participant2Amount), bigOrZero(e.Participant1Amount)
+	}
+	txs := make(map[common.Hash]*ChannelStatementTx)
+	for _, e := range es {
+		tx := txs[e.TxHash]
+		if tx == nil {
+			tx = &ChannelStatementTx{
+				TxHash:      e.TxHash,
+				BlockNumber: e.BlockNumber,
+			}
+			txs[e.TxHash] = tx
+			s.Transactions = append(s.Transactions, tx)
+		}
+		tx.Events = append(tx.Events, e.EventName)
+		switch e.EventName {
+		case params.NameChannelOpenedAndDeposit, params.NameChannelNewDeposit:
+			total := bigOrZero(e.Amount)
+			last, ok := deposits[e.Participant]
+			if !ok {
+				continue
+			}
+			d := &ChannelStatementDeposit{
+				Participant:  e.Participant,
+				Amount:       new(big.Int).Sub(total, last),
+				TotalDeposit: total,
+				BlockNumber:  e.BlockNumber,
+				TxHash:       e.TxHash,
+			}
+			//ChannelOpenedAndDeposit 中是存款额,不是总额,但是此时总额就是存款额
+			deposits[e.Participant] = total
+			s.Deposits = append(s.Deposits, d)
+			if e.Participant == our {
+				s.OurDeposit.Add(s.OurDeposit, d.Amount)
+			} else {
+				s.PartnerDeposit.Add(s.PartnerDeposit, d.Amount)
+			}
+		case params.NameChannelWithdraw:
+			w := &ChannelStatementWithdraw{
+				BlockNumber: e.BlockNumber,
+				TxHash:      e.TxHash,
+			}
+			w.OurBalance, w.PartnerBalance = ourFirst(e)
+			//withdraw 以后,双方的存款就是 withdraw 以后的余额
+			deposits[our] = new(big.Int).Set(w.OurBalance)
+			deposits[s.PartnerAddress] = new(big.Int).Set(w.PartnerBalance)
+			s.Withdraws = append(s.Withdraws, w)
+		case params.NameChannelUnlocked:
+			s.Unlocks = append(s.Unlocks, &ChannelStatementUnlock{
+				Payer:             e.Participant,
+				LockHash:          e.LockHash,
+				TransferredAmount: bigOrZero(e.Amount),
+				BlockNumber:       e.BlockNumber,
+				TxHash:            e.TxHash,
+			})
+		case params.NameChannelSettled, params.NameChannelCooperativeSettled:
+			st := &ChannelStatementSettle{
+				Cooperative: e.EventName == params.NameChannelCooperativeSettled,
+				BlockNumber: e.BlockNumber,
+				TxHash:      e.TxHash,
+			}
+			st.OurAmount, st.PartnerAmount = ourFirst(e)
+			s.Settle = st
+		}
+		if s.Settle != nil {
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package photon
+
+import (
+	"math/big"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/codefortest"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChannelStatementEvents(t *testing.T) {
+	dbPath := path.Join(os.TempDir(), "statement_test.db")
+	err := os.RemoveAll(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dao := codefortest.NewTestDB(dbPath)
+	defer dao.CloseDB()
+	our, partner, token := utils.NewRandomAddress(), utils.NewRandomAddress(), utils.NewRandomAddress()
+	channelID := utils.NewRandomHash()
+	n := uint(0)
+	newEvent := func(name string, blockNumber int64) *models.ContractEvent {
+		n++
+		return &models.ContractEvent{
+			Key:               models.ContractEventKey(utils.NewRandomHash(), n),
+			EventName:         name,
+			BlockNumber:       blockNumber,
+			TxHash:            common.BigToHash(big.NewInt(int64(n))),
+			ChannelIdentifier: channelID,
+		}
+	}
+	//第一次打开,在第 20 块 settle, 然后在同一块重新打开
+	open1 := newEvent(params.NameChannelOpenedAndDeposit, 10)
+	open1.TokenAddress, open1.Participant1, open1.Participant2, open1.Participant, open1.Amount = token, our, partner, our, big.NewInt(100)
+	settle1 := newEvent(params.NameChannelSettled, 20)
+	settle1.Participant1Amount, settle1.Participant2Amount = big.NewInt(60), big.NewInt(40)
+	open2 := newEvent(params.NameChannelOpenedAndDeposit, 20)
+	open2.TokenAddress, open2.Participant1, open2.Participant2, open2.Participant, open2.Amount = token, partner, our, partner, big.NewInt(50)
+	deposit := newEvent(params.NameChannelNewDeposit, 25)
+	deposit.Participant, deposit.Amount = our, big.NewInt(30)
+	deposit2 := newEvent(params.NameChannelNewDeposit, 26)
+	deposit2.TxHash = deposit.TxHash
+	deposit2.Participant, deposit2.Amount = our, big.NewInt(45)
+	withdraw := newEvent(params.NameChannelWithdraw, 30)
+	withdraw.Participant1, withdraw.Participant2 = partner, our
+	withdraw.Participant1Amount, withdraw.Participant2Amount = big.NewInt(40), big.NewInt(35)
+	deposit3 := newEvent(params.NameChannelNewDeposit, 31)
+	deposit3.Participant, deposit3.Amount = our, big.NewInt(55)
+	unlock := newEvent(params.NameChannelUnlocked, 40)
+	unlock.Participant, unlock.LockHash, unlock.Amount = partner, utils.NewRandomHash(), big.NewInt(5)
+	settle2 := newEvent(params.NameChannelCooperativeSettled, 50)
+	settle2.Participant1Amount, settle2.Participant2Amount = big.NewInt(35), big.NewInt(60)
+	err = dao.SaveContractEvents([]*models.ContractEvent{open1, settle1, open2, deposit, deposit2, withdraw, deposit3, unlock, settle2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := &API{Photon: &Service{dao: dao, NodeAddress: our}}
+	newStatement := func(openBlockNumber int64) *ChannelStatement {
+		return &ChannelStatement{
+			ChannelHistory: &ChannelHistory{
+				ChannelIdentifier: channelID,
+				OpenBlockNumber:   openBlockNumber,
+				TokenAddress:      token,
+				PartnerAddress:    partner,
+			},
+			OurDeposit:     big.NewInt(0),
+			PartnerDeposit: big.NewInt(0),
+		}
+	}
+	s := newStatement(10)
+	err = api.fillStatementEvents(s, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.EqualValues(t, 1, len(s.Deposits))
+	assert.EqualValues(t, big.NewInt(100), s.OurDeposit)
+	assert.EqualValues(t, big.NewInt(60), s.Settle.OurAmount)
+	assert.EqualValues(t, big.NewInt(40), s.Settle.PartnerAmount)
+	assert.EqualValues(t, false, s.Settle.Cooperative)
+	assert.EqualValues(t, 2, len(s.Transactions))
+
+	s = newStatement(20)
+	err = api.fillStatementEvents(s, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.EqualValues(t, 4, len(s.Deposits))
+	assert.EqualValues(t, big.NewInt(50), s.PartnerDeposit)
+	//30+15+20, withdraw 以后从 35 存到 55
+	assert.EqualValues(t, big.NewInt(65), s.OurDeposit)
+	assert.EqualValues(t, 1, len(s.Withdraws))
+	assert.EqualValues(t, big.NewInt(35), s.Withdraws[0].OurBalance)
+	assert.EqualValues(t, 1, len(s.Unlocks))
+	assert.EqualValues(t, partner, s.Unlocks[0].Payer)
+	assert.EqualValues(t, true, s.Settle.Cooperative)
+	assert.EqualValues(t, big.NewInt(60), s.Settle.OurAmount)
+	//deposit 和 deposit2 在同一个交易中
+	assert.EqualValues(t, 6, len(s.Transactions))
+	assert.EqualValues(t, []string{params.NameChannelNewDeposit, params.NameChannelNewDeposit}, s.Transactions[1].Events)
+
+	//第 15 块之前的事件还没有从链上补齐, 第一次打开的记录不完整
+	err = dao.SaveContractEventBackfill(&models.ContractEventBackfill{From: 5, To: 15})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = api.fillStatementEvents(newStatement(10), 20)
+	assert.NotEmpty(t, err)
+	err = api.fillStatementEvents(newStatement(20), 50)
+	assert.Empty(t, err)
+}
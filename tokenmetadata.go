@@ -0,0 +1,145 @@
+package photon
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/channel/channeltype"
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/network/netshare"
+	"github.com/SmartMeshFoundation/Photon/network/rpc"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+FetchTokenMetadata 从 token 合约读取 symbol,name 和 decimals.
+这三个函数在 ERC20 中都是可选的, 没有实现的 token 对应的值为空,decimals 为 0,
+但是 totalSupply 必须能调用成功, 否则不是一个 ERC20 token.
+*/
+func FetchTokenMetadata(bcs *rpc.BlockChainService, token common.Address) (m *models.TokenMetadata, err error) {
+	t, err := bcs.Token(token)
+	if err != nil {
+		return
+	}
+	_, err = t.TotalSupply()
+	if err != nil {
+		return nil, fmt.Errorf("token %s is not an ERC20 token, totalSupply err %s", token.String(), err)
+	}
+	m = &models.TokenMetadata{
+		TokenAddress: token,
+		UpdateTime:   time.Now().Unix(),
+	}
+	m.Symbol, err = t.Symbol()
+	if err != nil {
+		log.Warn(fmt.Sprintf("token %s has no symbol, err %s", token.String(), err))
+	}
+	m.Name, err = t.Name()
+	if err != nil {
+		log.Warn(fmt.Sprintf("token %s has no name, err %s", token.String(), err))
+	}
+	m.Decimals, err = t.Decimals()
+	if err != nil {
+		log.Warn(fmt.Sprintf("token %s has no decimals, err %s", token.String(), err))
+	}
+	return m, nil
+}
+
+/*
+GetTokenMetadata returns cached metadata of token, it's read from token contract at the first time.
+*/
+func (r *API) GetTokenMetadata(token common.Address) (m *models.TokenMetadata, err error) {
+	m, err = r.Photon.dao.GetTokenMetadata(token)
+	if err == nil {
+		return
+	}
+	if r.Photon.Chain.Client.Status != netshare.Connected {
+		return nil, fmt.Errorf("metadata of token %s is unknown and photon is not connected to chain", token.String())
+	}
+	m, err = FetchTokenMetadata(r.Photon.Chain, token)
+	if err != nil {
+		return
+	}
+	err = r.Photon.dao.SaveTokenMetadata(m)
+	return
+}
+
+// GetAllTokenMetadata metadata of all registered tokens
+func (r *API) GetAllTokenMetadata() (ms []*models.TokenMetadata, err error) {
+	for _, t := range r.Tokens() {
+		m, err2 := r.GetTokenMetadata(t)
+		if err2 != nil {
+			log.Warn(fmt.Sprintf("GetTokenMetadata %s err %s", t.String(), err2))
+			continue
+		}
+		ms = append(ms, m)
+	}
+	return
+}
+
+/*
+FormatAmount amount of token in its decimals, like 1.25,
+empty if metadata of token is unknown.
+*/
+func (r *API) FormatAmount(token common.Address, amount *big.Int) string {
+	if amount == nil {
+		return ""
+	}
+	m, err := r.GetTokenMetadata(token)
+	if err != nil {
+		return ""
+	}
+	return m.FormatAmount(amount)
+}
+
+// ParseAmount parse amount like 1.25 in decimals of token to raw integer amount
+func (r *API) ParseAmount(token common.Address, s string) (*big.Int, error) {
+	m, err := r.GetTokenMetadata(token)
+	if err != nil {
+		return nil, err
+	}
+	return m.ParseAmount(s)
+}
+
+/*
+RegisterToken creates token network of a new token.
+TokensNetwork has no separate register function, a token is registered when the first channel of it is opened,
+so a partner and deposit are required, it's the same as DepositAndOpenChannel after token is checked.
+*/
+func (r *API) RegisterToken(token, partner common.Address, settleTimeout int, deposit *big.Int) (m *models.TokenMetadata, ch *channeltype.Serialization, err error) {
+	tokens, err := r.Photon.dao.GetAllTokens()
+	if err != nil {
+		return
+	}
+	if _, ok := tokens[token]; ok {
+		return nil, nil, fmt.Errorf("token %s is already registered", token.String())
+	}
+	if deposit == nil || deposit.Cmp(utils.BigInt0) <= 0 {
+		return nil, nil, errors.New("deposit of the first channel must be positive")
+	}
+	if err = r.checkSmcStatus(); err != nil {
+		return
+	}
+	registered, err := r.Photon.Chain.RegistryProxy.TokenNetworkByToken(token)
+	if err != nil {
+		return
+	}
+	if registered {
+		//已经注册,只是我们还没有收到事件
+		return nil, nil, fmt.Errorf("token %s is already registered", token.String())
+	}
+	err = r.Photon.Chain.ValidToken(token)
+	if err != nil {
+		return
+	}
+	m, err = r.GetTokenMetadata(token)
+	if err != nil {
+		return
+	}
+	log.Info(fmt.Sprintf("register token %s(%s) with partner %s", token.String(), m.Symbol, utils.APex2(partner)))
+	ch, err = r.DepositAndOpenChannel(token, partner, settleTimeout, r.Photon.Config.RevealTimeout, deposit, true)
+	return
+}
@@ -36,6 +36,7 @@ type EventTransferSentSuccess struct {
 	ChannelIdentifier common.Hash
 	Token             common.Address
 	Data              string
+	Unfinished        bool // other parts of a multi-path transfer are not finished yet
 }
 
 /*
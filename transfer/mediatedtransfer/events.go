@@ -27,19 +27,24 @@ type EventSendMediatedTransfer struct {
 	// because which channel receives MediatedTransfer and leads me to send a new Transfer
 	// If I am the transfer initiator, then FromChannel should be null.
 	FromChannel common.Hash
+	TotalAmount *big.Int // amount target should receive in all parts of a multi-path transfer
+	// secret encrypted with public key of target for a keysend transfer
+	EncryptedSecret []byte
 }
 
 //NewEventSendMediatedTransfer create EventSendMediatedTransfer
 func NewEventSendMediatedTransfer(transfer *LockedTransferState, receiver common.Address) *EventSendMediatedTransfer {
 	return &EventSendMediatedTransfer{
-		Token:          transfer.Token,
-		Amount:         new(big.Int).Set(transfer.Amount),
-		LockSecretHash: transfer.LockSecretHash,
-		Initiator:      transfer.Initiator,
-		Target:         transfer.Target,
-		Expiration:     transfer.Expiration,
-		Receiver:       receiver,
-		Fee:            transfer.Fee,
+		Token:           transfer.Token,
+		Amount:          new(big.Int).Set(transfer.Amount),
+		LockSecretHash:  transfer.LockSecretHash,
+		Initiator:       transfer.Initiator,
+		Target:          transfer.Target,
+		Expiration:      transfer.Expiration,
+		Receiver:        receiver,
+		Fee:             transfer.Fee,
+		TotalAmount:     transfer.TotalAmount,
+		EncryptedSecret: transfer.EncryptedSecret,
 	}
 }
 
@@ -129,6 +134,7 @@ type EventSendAnnounceDisposed struct {
 	Expiration     int64
 	Token          common.Address
 	Receiver       common.Address
+	Refused        bool // the target refuses this transfer, receiver should not try other routes
 }
 
 /*
@@ -215,6 +221,25 @@ type EventWithdrawFailed struct {
 	Reason            string
 }
 
+//MultiPathPartProgress state of one part of a multi-path transfer
+type MultiPathPartProgress struct {
+	ChannelIdentifier common.Hash
+	Partner           common.Address
+	Amount            *big.Int
+	Fee               *big.Int
+	Status            string
+}
+
+/*
+EventMultiPathProgress 多路径支付的发起方,某个部分的状态发生了变化,
+用于更新交易状态中每个部分的进度.
+*/
+type EventMultiPathProgress struct {
+	LockSecretHash common.Hash
+	Token          common.Address
+	Parts          []*MultiPathPartProgress
+}
+
 // EventSaveFeeChargeRecord :
 // 记录本次中转收取手续费的流水
 type EventSaveFeeChargeRecord struct {
@@ -229,6 +254,32 @@ type EventSaveFeeChargeRecord struct {
 	Timestamp      int64          `json:"timestamp"` // 时间戳,time.Unix()
 }
 
+/*
+EventTransferHeld 接收方暂停处理收到的交易, 等待用户接受或者取消
+*/
+type EventTransferHeld struct {
+	LockSecretHash    common.Hash
+	Token             common.Address
+	Amount            *big.Int
+	Initiator         common.Address
+	ChannelIdentifier common.Hash
+	Expiration        int64
+	HoldDeadline      int64 // canceled automatically at this block
+	SecretKnown       bool  // like an invoice created by us or a keysend transfer
+}
+
+/*
+EventHeldTransferCanceled 暂停处理的交易被用户取消, 或者到了 HoldDeadline 自动取消
+*/
+type EventHeldTransferCanceled struct {
+	LockSecretHash    common.Hash
+	Token             common.Address
+	Amount            *big.Int
+	Initiator         common.Address
+	ChannelIdentifier common.Hash
+	Reason            string
+}
+
 func init() {
 	gob.Register(&EventSendMediatedTransfer{})
 	gob.Register(&EventSendRevealSecret{})
@@ -241,4 +292,7 @@ func init() {
 	gob.Register(&EventUnlockFailed{})
 	gob.Register(&EventWithdrawSuccess{})
 	gob.Register(&EventWithdrawFailed{})
+	gob.Register(&EventMultiPathProgress{})
+	gob.Register(&EventTransferHeld{})
+	gob.Register(&EventHeldTransferCanceled{})
 }
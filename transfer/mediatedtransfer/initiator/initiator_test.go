@@ -9,6 +9,7 @@ import (
 
 	"os"
 
+	"github.com/SmartMeshFoundation/Photon/encoding"
 	"github.com/SmartMeshFoundation/Photon/log"
 	"github.com/SmartMeshFoundation/Photon/transfer"
 	"github.com/SmartMeshFoundation/Photon/transfer/mediatedtransfer"
@@ -317,6 +318,41 @@ func TestRefundTransferNoMoreRoutes(t *testing.T) {
 	assert(t, ok, true)
 	assert(t, sm.CurrentState == nil, true)
 }
+func TestRefundTransferRefusedByTarget(t *testing.T) {
+	amount := utest.UnitTransferAmount
+	blockNumber := utest.UnitBlockNumber
+	mediatorAddress := utest.HOP1
+	targetAddress := utest.HOP2
+	ourAddress := utest.ADDR
+	token := utest.UnitTokenAddress
+
+	routes := []*route.State{
+		utest.MakeRoute(mediatorAddress, amount, utest.UnitSettleTimeout, utest.UnitRevealTimeout, 0, utils.NewRandomHash()),
+		utest.MakeRoute(utest.HOP2, amount, utest.UnitSettleTimeout, utest.UnitRevealTimeout, 0, utils.NewRandomHash()),
+	}
+	currentState := makeInitiatorState(routes, targetAddress, utest.UnitTransferAmount, blockNumber, ourAddress, token)
+	//中间节点转发了接收方的拒绝,即使还有其他路径也不再尝试
+	stateChange := &mediatedtransfer.ReceiveAnnounceDisposedStateChange{
+		Sender:  mediatorAddress,
+		Token:   token,
+		Message: &encoding.AnnounceDisposed{Refused: true},
+		Lock: &mtree.Lock{
+			Expiration:     currentState.Transfer.Expiration,
+			LockSecretHash: currentState.LockSecretHash,
+			Amount:         amount,
+		},
+	}
+	sm := transfer.NewStateManager(StateTransition, currentState, NameInitiatorTransition, utils.ShaSecret([]byte("3")), utils.NewRandomAddress())
+
+	events := sm.Dispatch(stateChange)
+	for _, e := range events {
+		_, ok := e.(*mediatedtransfer.EventSendMediatedTransfer)
+		assert(t, ok, false, "should not try a new route")
+	}
+	ev, ok := events[0].(*transfer.EventTransferSentFailed)
+	assert(t, ok, true)
+	assert(t, ev.Reason, "target refused transfer")
+}
 func TestRefundTransferInvalidSender(t *testing.T) {
 	amount := utest.UnitTransferAmount
 	blockNumber := utest.UnitBlockNumber
@@ -376,6 +412,64 @@ func TestCancelTransfer(t *testing.T) {
 	assert(t, true, ok)
 }
 
+func TestCircularTransfer(t *testing.T) {
+	amount := utest.UnitTransferAmount
+	blockNumber := utest.UnitBlockNumber
+	firstHop := utest.HOP1
+	lastHop := utest.HOP3
+	ourAddress := utest.ADDR
+	token := utest.UnitTokenAddress
+
+	routes := []*route.State{
+		utest.MakeRoute(firstHop, amount, utest.UnitSettleTimeout, utest.UnitRevealTimeout, 0, utils.NewRandomHash()),
+	}
+	initStateChange := makeInitStateChange(routes, ourAddress, amount, blockNumber, ourAddress, token)
+	initStateChange.LastHop = lastHop
+	sm := transfer.NewStateManager(StateTransition, nil, NameInitiatorTransition, initStateChange.LockSecretHash, token)
+	events := sm.Dispatch(initStateChange)
+	assert(t, len(events), 1)
+	state := sm.CurrentState.(*mediatedtransfer.InitiatorState)
+	secret := state.Secret
+
+	returnTransfer := func(from common.Address) *mediatedtransfer.ActionInitTargetStateChange {
+		tr := utest.MakeTransfer(amount, ourAddress, ourAddress, state.Transfer.Expiration-int64(utest.UnitRevealTimeout), utils.EmptyHash, state.LockSecretHash, token)
+		return &mediatedtransfer.ActionInitTargetStateChange{
+			OurAddress:  ourAddress,
+			FromTranfer: tr,
+			FromRoute:   utest.MakeRoute(from, amount, utest.UnitSettleTimeout, utest.UnitRevealTimeout, 0, utils.NewRandomHash()),
+			BlockNumber: blockNumber,
+		}
+	}
+	//only accept transfer returned from the last hop
+	events = sm.Dispatch(returnTransfer(utest.HOP2))
+	assert(t, len(events), 0)
+	events = sm.Dispatch(returnTransfer(lastHop))
+	assert(t, len(events), 1)
+	reveal, ok := events[0].(*mediatedtransfer.EventSendRevealSecret)
+	assert(t, ok, true)
+	assert(t, reveal.Receiver, lastHop)
+	assert(t, reveal.Secret, secret)
+
+	//first hop learned the secret, unlock it but wait for the unlock from last hop
+	events = sm.Dispatch(&mediatedtransfer.ReceiveSecretRevealStateChange{
+		Secret: secret,
+		Sender: firstHop,
+	})
+	assert(t, len(events), 3)
+	assert(t, sm.CurrentState != nil, true)
+
+	events = sm.Dispatch(&mediatedtransfer.ReceiveUnlockStateChange{
+		LockSecretHash: state.LockSecretHash,
+		NodeAddress:    lastHop,
+	})
+	assert(t, len(events), 2)
+	_, ok = events[0].(*transfer.EventTransferReceivedSuccess)
+	assert(t, ok, true)
+	_, ok = events[1].(*mediatedtransfer.EventRemoveStateManager)
+	assert(t, ok, true)
+	assert(t, sm.CurrentState, nil, "state must be cleaned")
+}
+
 func assertStateEqual(t *testing.T, currentState, beforeState *mediatedtransfer.InitiatorState) {
 	//assert(t, reflect.DeepEqual(currentState, beforeState), true)
 	assert(t, currentState.Transfer, beforeState.Transfer)
@@ -391,3 +485,110 @@ func assertStateEqual(t *testing.T, currentState, beforeState *mediatedtransfer.
 	assert(t, currentState.BlockNumber, beforeState.BlockNumber)
 	//assert(t, currentState, beforeState)
 }
+
+func makeMultiPathInitStateChange(target common.Address, amounts []*big.Int, blockNumber int64) *mediatedtransfer.ActionInitMultiPathInitiatorStateChange {
+	total := new(big.Int)
+	for _, a := range amounts {
+		total.Add(total, a)
+	}
+	secret := utils.NewRandomHash()
+	tr := &mediatedtransfer.LockedTransferState{
+		Amount:         total,
+		Initiator:      utest.ADDR,
+		Target:         target,
+		Token:          utest.UnitTokenAddress,
+		TargetAmount:   total,
+		Fee:            utils.BigInt0,
+		Secret:         secret,
+		LockSecretHash: utils.ShaSecret(secret[:]),
+		TotalAmount:    total,
+	}
+	st := &mediatedtransfer.ActionInitMultiPathInitiatorStateChange{
+		OurAddress:     utest.ADDR,
+		Transfer:       tr,
+		BlockNumber:    blockNumber,
+		LockSecretHash: tr.LockSecretHash,
+		Secret:         secret,
+	}
+	hops := []common.Address{utest.HOP1, utest.HOP3, utest.HOP4}
+	for i, a := range amounts {
+		partTransfer := *tr
+		partTransfer.Amount = a
+		partTransfer.TargetAmount = a
+		st.Parts = append(st.Parts, &mediatedtransfer.ActionInitInitiatorStateChange{
+			OurAddress:     utest.ADDR,
+			Tranfer:        &partTransfer,
+			Routes:         route.NewRoutesState([]*route.State{utest.MakeRoute(hops[i], a, utest.UnitSettleTimeout, utest.UnitRevealTimeout, 0, utils.NewRandomHash())}),
+			BlockNumber:    blockNumber,
+			LockSecretHash: tr.LockSecretHash,
+			Secret:         secret,
+		})
+	}
+	return st
+}
+
+func TestMultiPathInit(t *testing.T) {
+	amounts := []*big.Int{big.NewInt(7), big.NewInt(3)}
+	st := makeMultiPathInitStateChange(utest.HOP2, amounts, utest.UnitBlockNumber)
+	sm := transfer.NewStateManager(StateTransition, nil, NameInitiatorTransition, st.LockSecretHash, utest.UnitTokenAddress)
+	events := sm.Dispatch(st)
+	state, ok := sm.CurrentState.(*mediatedtransfer.MultiPathInitiatorState)
+	assert(t, ok, true)
+	assert(t, len(state.Parts), 2)
+	var mtrs []*mediatedtransfer.EventSendMediatedTransfer
+	var progress *mediatedtransfer.EventMultiPathProgress
+	for _, e := range events {
+		switch e2 := e.(type) {
+		case *mediatedtransfer.EventSendMediatedTransfer:
+			mtrs = append(mtrs, e2)
+		case *mediatedtransfer.EventMultiPathProgress:
+			progress = e2
+		}
+	}
+	assert(t, len(mtrs), 2)
+	for i, mtr := range mtrs {
+		assert(t, mtr.Amount, amounts[i])
+		assert(t, mtr.TotalAmount, big.NewInt(10))
+		assert(t, mtr.LockSecretHash, st.LockSecretHash)
+	}
+	assert(t, progress != nil, true)
+	assert(t, len(progress.Parts), 2)
+	assert(t, progress.Parts[0].Status, mediatedtransfer.StatePartPending)
+}
+
+func TestMultiPathSecretRequest(t *testing.T) {
+	amounts := []*big.Int{big.NewInt(7), big.NewInt(3)}
+	st := makeMultiPathInitStateChange(utest.HOP2, amounts, utest.UnitBlockNumber)
+	sm := transfer.NewStateManager(StateTransition, nil, NameInitiatorTransition, st.LockSecretHash, utest.UnitTokenAddress)
+	sm.Dispatch(st)
+	//只收到一个部分的接收方不能拿到密码
+	events := sm.Dispatch(&mediatedtransfer.ReceiveSecretRequestStateChange{
+		Amount:         amounts[0],
+		LockSecretHash: st.LockSecretHash,
+		Sender:         utest.HOP2,
+	})
+	assert(t, len(events), 0)
+	state := sm.CurrentState.(*mediatedtransfer.MultiPathInitiatorState)
+	assert(t, state.CancelByExceptionSecretRequest, true)
+
+	st = makeMultiPathInitStateChange(utest.HOP2, amounts, utest.UnitBlockNumber)
+	sm = transfer.NewStateManager(StateTransition, nil, NameInitiatorTransition, st.LockSecretHash, utest.UnitTokenAddress)
+	sm.Dispatch(st)
+	events = sm.Dispatch(&mediatedtransfer.ReceiveSecretRequestStateChange{
+		Amount:         big.NewInt(10),
+		LockSecretHash: st.LockSecretHash,
+		Sender:         utest.HOP2,
+	})
+	var reveals []*mediatedtransfer.EventSendRevealSecret
+	for _, e := range events {
+		if e2, ok := e.(*mediatedtransfer.EventSendRevealSecret); ok {
+			reveals = append(reveals, e2)
+		}
+	}
+	assert(t, len(reveals), 1)
+	assert(t, reveals[0].Secret, st.Secret)
+	state = sm.CurrentState.(*mediatedtransfer.MultiPathInitiatorState)
+	for _, s := range state.PartStatus {
+		assert(t, s, mediatedtransfer.StatePartSecretRevealed)
+	}
+}
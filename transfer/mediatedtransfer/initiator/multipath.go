@@ -0,0 +1,284 @@
+package initiator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/transfer"
+	mt "github.com/SmartMeshFoundation/Photon/transfer/mediatedtransfer"
+	"github.com/SmartMeshFoundation/Photon/utils"
+)
+
+/*
+多路径支付的发起方.
+每个部分都是一个普通的 InitiatorState, multiPathStateTransition 把状态变化交给相关的部分处理,
+然后过滤这些部分产生的事件:
+ 1. 部分的 EventRemoveStateManager 只说明这个部分结束了, 所有部分都结束以后才移除 StateManager
+ 2. 任何一个部分失败整笔交易都会失败, 只通知一次 EventTransferSentFailed
+ 3. SecretRequest 由整笔交易处理, 金额必须是所有部分之和, 并且所有部分都还在途中
+*/
+
+func isMultiPath(originalState transfer.State, st transfer.StateChange) bool {
+	if originalState == nil {
+		_, ok := st.(*mt.ActionInitMultiPathInitiatorStateChange)
+		return ok
+	}
+	_, ok := originalState.(*mt.MultiPathInitiatorState)
+	return ok
+}
+
+func handleInitMultiPath(st *mt.ActionInitMultiPathInitiatorStateChange) *transfer.TransitionResult {
+	state := &mt.MultiPathInitiatorState{
+		OurAddress:     st.OurAddress,
+		Transfer:       st.Transfer,
+		BlockNumber:    st.BlockNumber,
+		LockSecretHash: st.LockSecretHash,
+		Secret:         st.Secret,
+	}
+	for _, p := range st.Parts {
+		part := &mt.InitiatorState{
+			OurAddress:     p.OurAddress,
+			Transfer:       p.Tranfer,
+			Routes:         p.Routes,
+			BlockNumber:    p.BlockNumber,
+			LockSecretHash: p.LockSecretHash,
+			Secret:         p.Secret,
+			Db:             p.Db,
+		}
+		state.Parts = append(state.Parts, part)
+		state.PartStatus = append(state.PartStatus, mt.StatePartPending)
+		state.PartFinished = append(state.PartFinished, false)
+	}
+	var events []transfer.Event
+	for i, part := range state.Parts {
+		events = append(events, filterPartEvents(state, i, tryNewRoute(part))...)
+	}
+	return &transfer.TransitionResult{
+		NewState: state,
+		Events:   events,
+	}
+}
+
+/*
+filterPartEvents 记录第 i 个部分的状态, 并过滤掉不应该由单个部分决定的事件
+*/
+func filterPartEvents(state *mt.MultiPathInitiatorState, i int, it *transfer.TransitionResult) (events []transfer.Event) {
+	if it.NewState == nil {
+		state.PartFinished[i] = true
+	}
+	for _, e := range it.Events {
+		switch e2 := e.(type) {
+		case *mt.EventRemoveStateManager:
+			state.PartFinished[i] = true
+			continue
+		case *transfer.EventTransferSentFailed:
+			state.PartStatus[i] = mt.StatePartFailed
+			if state.Failed {
+				continue
+			}
+			state.Failed = true
+		case *transfer.EventTransferSentSuccess:
+			state.PartStatus[i] = mt.StatePartUnlocked
+			e2.Unfinished = state.Failed || !allPartsUnlocked(state)
+		}
+		events = append(events, e)
+	}
+	return
+}
+
+func allPartsUnlocked(state *mt.MultiPathInitiatorState) bool {
+	for _, s := range state.PartStatus {
+		if s != mt.StatePartUnlocked {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+handleMultiPathSecretRequest 接收方收齐了所有部分, 只有 SecretRequest 的金额等于总金额,
+并且所有部分都没有过期,也没有被取消, 才能告诉接收方密码.
+*/
+func handleMultiPathSecretRequest(state *mt.MultiPathInitiatorState, st *mt.ReceiveSecretRequestStateChange) *transfer.TransitionResult {
+	isValid := st.Sender == state.Transfer.Target &&
+		st.LockSecretHash == state.LockSecretHash &&
+		st.Amount.Cmp(state.Transfer.TargetAmount) == 0
+	for i, part := range state.Parts {
+		if state.PartFinished[i] || part.Message == nil || state.BlockNumber >= part.Transfer.Expiration {
+			isValid = false
+			break
+		}
+	}
+	if isValid && !state.Failed && !state.CancelByExceptionSecretRequest {
+		tr := state.Transfer
+		revealSecret := &mt.EventSendRevealSecret{
+			LockSecretHash: state.LockSecretHash,
+			Secret:         state.Secret,
+			Token:          tr.Token,
+			Receiver:       tr.Target,
+			Sender:         state.OurAddress,
+			Data:           tr.Data,
+		}
+		state.RevealSecret = revealSecret
+		for i, part := range state.Parts {
+			part.RevealSecret = revealSecret
+			state.PartStatus[i] = mt.StatePartSecretRevealed
+		}
+		return &transfer.TransitionResult{
+			NewState: state,
+			Events:   []transfer.Event{revealSecret},
+		}
+	}
+	//和普通交易一样,拒绝后续所有的 secret request, 等待所有部分过期
+	log.Warn(fmt.Sprintf("invalid secret request for multi-path transfer %s, amount=%s,total=%s",
+		utils.HPex(state.LockSecretHash), st.Amount, state.Transfer.TargetAmount))
+	state.CancelByExceptionSecretRequest = true
+	return &transfer.TransitionResult{
+		NewState: state,
+		Events:   nil,
+	}
+}
+
+// partsKey 用于判断各部分的进度是否发生了变化
+func partsKey(state *mt.MultiPathInitiatorState) string {
+	var ss []string
+	for i, part := range state.Parts {
+		s := state.PartStatus[i]
+		if part.Route != nil {
+			s += part.Route.ChannelIdentifier.String()
+		}
+		ss = append(ss, s)
+	}
+	return strings.Join(ss, ",")
+}
+
+func progressEvent(state *mt.MultiPathInitiatorState) *mt.EventMultiPathProgress {
+	ev := &mt.EventMultiPathProgress{
+		LockSecretHash: state.LockSecretHash,
+		Token:          state.Transfer.Token,
+	}
+	for i, part := range state.Parts {
+		p := &mt.MultiPathPartProgress{
+			Amount: part.Transfer.Amount,
+			Fee:    part.Transfer.Fee,
+			Status: state.PartStatus[i],
+		}
+		if part.Route != nil {
+			p.ChannelIdentifier = part.Route.ChannelIdentifier
+			p.Partner = part.Route.HopNode()
+		}
+		ev.Parts = append(ev.Parts, p)
+	}
+	return ev
+}
+
+/*
+multiPathStateTransition is State machine for a node starting a multi-path transfer.
+*/
+func multiPathStateTransition(originalState transfer.State, st transfer.StateChange) *transfer.TransitionResult {
+	if originalState == nil {
+		it := handleInitMultiPath(st.(*mt.ActionInitMultiPathInitiatorStateChange))
+		state := it.NewState.(*mt.MultiPathInitiatorState)
+		return finishMultiPath(state, append(it.Events, progressEvent(state)))
+	}
+	state := originalState.(*mt.MultiPathInitiatorState)
+	before := partsKey(state)
+	var events []transfer.Event
+	//对每一个没有结束的部分执行 f
+	forEachPart := func(f func(part *mt.InitiatorState) *transfer.TransitionResult) {
+		for i, part := range state.Parts {
+			if !state.PartFinished[i] {
+				events = append(events, filterPartEvents(state, i, f(part))...)
+			}
+		}
+	}
+	switch st2 := st.(type) {
+	case *transfer.BlockStateChange:
+		if state.BlockNumber < st2.BlockNumber {
+			state.BlockNumber = st2.BlockNumber
+		}
+		forEachPart(func(part *mt.InitiatorState) *transfer.TransitionResult {
+			return handleBlock(part, st2)
+		})
+	case *mt.ReceiveSecretRevealStateChange:
+		forEachPart(func(part *mt.InitiatorState) *transfer.TransitionResult {
+			return handleSecretReveal(part, st2)
+		})
+	case *mt.ContractSecretRevealOnChainStateChange:
+		forEachPart(func(part *mt.InitiatorState) *transfer.TransitionResult {
+			return handleSecretRevealOnChain(part, st2)
+		})
+	case *mt.ReceiveSecretRequestStateChange:
+		if state.RevealSecret == nil {
+			events = handleMultiPathSecretRequest(state, st2).Events
+		} else {
+			log.Warn(fmt.Sprintf("recevie secret request but initiator have already sent reveal secret"))
+		}
+	case *mt.ReceiveAnnounceDisposedStateChange:
+		if state.RevealSecret != nil {
+			log.Warn(fmt.Sprintf("secret already revealed ,but initiator recevied announce disposed %s", utils.StringInterface(st, 3)))
+			break
+		}
+		//只有使用这个通道的那个部分需要尝试新的路由
+		forEachPart(func(part *mt.InitiatorState) *transfer.TransitionResult {
+			if part.Route.HopNode() != st2.Sender {
+				return &transfer.TransitionResult{NewState: part}
+			}
+			return handleRefund(part, st2)
+		})
+	case *transfer.ActionCancelTransferStateChange:
+		if state.RevealSecret != nil {
+			panic(fmt.Sprintf("secret already revealed,transfer cannot canceled"))
+		}
+		forEachPart(func(part *mt.InitiatorState) *transfer.TransitionResult {
+			if part.Message == nil {
+				return &transfer.TransitionResult{NewState: part}
+			}
+			return userCancelTransfer(part)
+		})
+	case *mt.ContractCooperativeSettledStateChange:
+		if state.RevealSecret == nil {
+			forEachPart(func(part *mt.InitiatorState) *transfer.TransitionResult {
+				if part.Route.ChannelIdentifier != st2.ChannelIdentifier {
+					return &transfer.TransitionResult{NewState: part}
+				}
+				return cancelCurrentRoute(part)
+			})
+		}
+	case *mt.ContractChannelWithdrawStateChange:
+		if state.RevealSecret == nil {
+			forEachPart(func(part *mt.InitiatorState) *transfer.TransitionResult {
+				if part.Route.ChannelIdentifier != st2.ChannelIdentifier.ChannelIdentifier {
+					return &transfer.TransitionResult{NewState: part}
+				}
+				return cancelCurrentRoute(part)
+			})
+		}
+	default:
+		log.Error(fmt.Sprintf("multi-path initiator received unkown state change %s", utils.StringInterface(st, 3)))
+	}
+	if partsKey(state) != before {
+		events = append(events, progressEvent(state))
+	}
+	return finishMultiPath(state, events)
+}
+
+// finishMultiPath 所有部分都结束了, 整笔交易才结束
+func finishMultiPath(state *mt.MultiPathInitiatorState, events []transfer.Event) *transfer.TransitionResult {
+	for _, finished := range state.PartFinished {
+		if !finished {
+			return &transfer.TransitionResult{
+				NewState: state,
+				Events:   events,
+			}
+		}
+	}
+	events = append(events, &mt.EventRemoveStateManager{
+		Key: utils.Sha3(state.LockSecretHash[:], state.Transfer.Token[:]),
+	})
+	return &transfer.TransitionResult{
+		NewState: nil,
+		Events:   events,
+	}
+}
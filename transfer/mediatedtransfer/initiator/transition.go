@@ -5,6 +5,7 @@ import (
 
 	"math/big"
 
+	"github.com/SmartMeshFoundation/Photon/channel/channeltype"
 	"github.com/SmartMeshFoundation/Photon/log"
 	"github.com/SmartMeshFoundation/Photon/params"
 	"github.com/SmartMeshFoundation/Photon/transfer"
@@ -38,6 +39,10 @@ func cancelCurrentRoute(state *mt.InitiatorState) *transfer.TransitionResult {
 
 //Cancel the current in-transit message
 func userCancelTransfer(state *mt.InitiatorState) *transfer.TransitionResult {
+	return failTransfer(state, "user canceled transfer")
+}
+
+func failTransfer(state *mt.InitiatorState, reason string) *transfer.TransitionResult {
 	if state.RevealSecret != nil {
 		panic("cannot cancel a transfer with a RevealSecret in flight")
 	}
@@ -49,7 +54,7 @@ func userCancelTransfer(state *mt.InitiatorState) *transfer.TransitionResult {
 	state.RevealSecret = nil
 	cancel := &transfer.EventTransferSentFailed{
 		LockSecretHash: state.Transfer.LockSecretHash,
-		Reason:         "user canceled transfer",
+		Reason:         reason,
 		Target:         state.Transfer.Target,
 		Token:          state.Transfer.Token,
 	}
@@ -118,16 +123,18 @@ func tryNewRoute(state *mt.InitiatorState) *transfer.TransitionResult {
 		lockExpiration = state.Transfer.Expiration
 	}
 	tr := &mt.LockedTransferState{
-		TargetAmount:   state.Transfer.TargetAmount,
-		Amount:         new(big.Int).Add(state.Transfer.TargetAmount, tryRoute.TotalFee),
-		Token:          state.Transfer.Token,
-		Initiator:      state.Transfer.Initiator,
-		Target:         state.Transfer.Target,
-		Expiration:     lockExpiration,
-		LockSecretHash: state.LockSecretHash,
-		Secret:         state.Secret,
-		Fee:            tryRoute.TotalFee,
-		Data:           state.Transfer.Data,
+		TargetAmount:    state.Transfer.TargetAmount,
+		Amount:          new(big.Int).Add(state.Transfer.TargetAmount, tryRoute.TotalFee),
+		Token:           state.Transfer.Token,
+		Initiator:       state.Transfer.Initiator,
+		Target:          state.Transfer.Target,
+		Expiration:      lockExpiration,
+		LockSecretHash:  state.LockSecretHash,
+		Secret:          state.Secret,
+		Fee:             tryRoute.TotalFee,
+		Data:            state.Transfer.Data,
+		TotalAmount:     state.Transfer.TotalAmount,
+		EncryptedSecret: state.Transfer.EncryptedSecret,
 	}
 	msg := mt.NewEventSendMediatedTransfer(tr, tryRoute.HopNode())
 	if len(state.Routes.CanceledRoutes) > 0 {
@@ -147,9 +154,20 @@ func tryNewRoute(state *mt.InitiatorState) *transfer.TransitionResult {
 		Events:   events,
 	}
 }
+
+//isCircular 环形交易,我既是发起方也是接收方
+func isCircular(state *mt.InitiatorState) bool {
+	return state.Transfer.Target == state.OurAddress
+}
+
+//returnFinished 不是环形交易,或者回来的那一段已经完成了
+func returnFinished(state *mt.InitiatorState) bool {
+	return !isCircular(state) || state.ReturnState == mt.StateBalanceProof || state.ReturnState == mt.StateSecretRegistered
+}
+
 func expiredHashLockEvents(state *mt.InitiatorState) (events []transfer.Event) {
 	if state.BlockNumber-params.ForkConfirmNumber > state.Transfer.Expiration {
-		if state.Route != nil && !state.Db.IsThisLockRemoved(state.Route.ChannelIdentifier, state.OurAddress, state.Transfer.LockSecretHash) {
+		if state.Route != nil && !state.BalanceProofSent && !state.Db.IsThisLockRemoved(state.Route.ChannelIdentifier, state.OurAddress, state.Transfer.LockSecretHash) {
 			unlockFailed := &mt.EventUnlockFailed{
 				LockSecretHash:    state.Transfer.LockSecretHash,
 				ChannelIdentifier: state.Route.ChannelIdentifier,
@@ -187,6 +205,103 @@ func handleBlock(state *mt.InitiatorState, stateChange *transfer.BlockStateChang
 		events = append(events, &mt.EventRemoveStateManager{
 			Key: utils.Sha3(state.LockSecretHash[:], state.Transfer.Token[:]),
 		})
+	} else if state.ReturnState == mt.StateRevealSecret {
+		events = eventsForReturnRegisterSecret(state)
+	}
+	return &transfer.TransitionResult{
+		NewState: state,
+		Events:   events,
+	}
+}
+
+/*
+环形交易,LastHop 迟迟不给我 unlock, 和接收方一样,来不及等待或者通道关闭了,就在链上注册密码
+*/
+func eventsForReturnRegisterSecret(state *mt.InitiatorState) (events []transfer.Event) {
+	safeToWait := mediator.IsSafeToWait(state.ReturnTransfer, state.ReturnRoute.RevealTimeout(), state.BlockNumber)
+	if !safeToWait || state.ReturnRoute.State() == channeltype.StateClosed {
+		state.ReturnState = mt.StateWaitingRegisterSecret
+		events = append(events, &mt.EventContractSendRegisterSecret{
+			Secret: state.Secret,
+		})
+	}
+	return
+}
+
+/*
+环形交易回到了我这里,我同时是接收方.
+只接受从 LastHop 回来的转账,我知道密码,直接告诉 LastHop,
+密码会一路向前传递到第一跳,第一跳告诉我密码以后,我再给它发送 unlock.
+*/
+func handleReturnTransfer(state *mt.InitiatorState, st *mt.ActionInitTargetStateChange) *transfer.TransitionResult {
+	tr := st.FromTranfer
+	isValid := isCircular(state) &&
+		state.ReturnTransfer == nil &&
+		st.FromRoute.HopNode() == state.LastHop &&
+		tr.LockSecretHash == state.LockSecretHash &&
+		tr.Token == state.Transfer.Token &&
+		tr.Amount.Cmp(state.Transfer.TargetAmount) >= 0
+	if !isValid || state.CancelByExceptionSecretRequest || state.BlockNumber >= state.Transfer.Expiration {
+		log.Warn(fmt.Sprintf("circular transfer returned from %s ignored, lastHop=%s", utils.APex2(st.FromRoute.HopNode()), utils.APex2(state.LastHop)))
+		return &transfer.TransitionResult{
+			NewState: state,
+			Events:   nil,
+		}
+	}
+	if !mediator.IsSafeToWait(tr, st.FromRoute.RevealTimeout(), state.BlockNumber) {
+		//来不及在链上注册密码了,等待这个锁过期
+		log.Warn(fmt.Sprintf("circular transfer returned too late, lockSecretHash=%s", utils.HPex(tr.LockSecretHash)))
+		return &transfer.TransitionResult{
+			NewState: state,
+			Events:   nil,
+		}
+	}
+	state.ReturnRoute = st.FromRoute
+	state.ReturnTransfer = tr
+	state.ReturnState = mt.StateRevealSecret
+	revealSecret := &mt.EventSendRevealSecret{
+		LockSecretHash: tr.LockSecretHash,
+		Secret:         state.Secret,
+		Token:          tr.Token,
+		Receiver:       state.LastHop,
+		Sender:         state.OurAddress,
+		Data:           state.Transfer.Data,
+	}
+	state.RevealSecret = revealSecret
+	return &transfer.TransitionResult{
+		NewState: state,
+		Events:   []transfer.Event{revealSecret},
+	}
+}
+
+//handleReturnBalanceProof 环形交易收到了 LastHop 的 unlock,回来的这一段完成了
+func handleReturnBalanceProof(state *mt.InitiatorState, st *mt.ReceiveUnlockStateChange) *transfer.TransitionResult {
+	if state.ReturnTransfer == nil || st.NodeAddress != state.LastHop || st.LockSecretHash != state.LockSecretHash ||
+		state.ReturnState == mt.StateBalanceProof {
+		return &transfer.TransitionResult{
+			NewState: state,
+			Events:   nil,
+		}
+	}
+	state.ReturnState = mt.StateBalanceProof
+	tr := state.ReturnTransfer
+	events := []transfer.Event{
+		&transfer.EventTransferReceivedSuccess{
+			LockSecretHash:    tr.LockSecretHash,
+			Amount:            tr.Amount,
+			Initiator:         tr.Initiator,
+			ChannelIdentifier: state.ReturnRoute.ChannelIdentifier,
+			Data:              tr.Data,
+		},
+	}
+	if state.BalanceProofSent {
+		events = append(events, &mt.EventRemoveStateManager{
+			Key: utils.Sha3(state.LockSecretHash[:], state.Transfer.Token[:]),
+		})
+		return &transfer.TransitionResult{
+			NewState: nil,
+			Events:   events,
+		}
 	}
 	return &transfer.TransitionResult{
 		NewState: state,
@@ -195,6 +310,16 @@ func handleBlock(state *mt.InitiatorState, stateChange *transfer.BlockStateChang
 }
 
 func handleRefund(state *mt.InitiatorState, stateChange *mt.ReceiveAnnounceDisposedStateChange) *transfer.TransitionResult {
+	if state.Route != nil && mediator.IsTargetRefusal(state.Transfer, state.Route, stateChange) {
+		//接收方拒绝了,换路径也没用
+		it := failTransfer(state, "target refused transfer")
+		it.Events = append(it.Events, &mt.EventSendAnnounceDisposedResponse{
+			LockSecretHash: stateChange.Lock.LockSecretHash,
+			Token:          state.Transfer.Token,
+			Receiver:       stateChange.Sender,
+		})
+		return it
+	}
 	if mediator.IsValidRefund(state.Transfer, state.Route, stateChange) {
 		it := cancelCurrentRoute(state)
 		ev := &mt.EventSendAnnounceDisposedResponse{
@@ -299,11 +424,31 @@ func handleSecretRevealOnChain(state *mt.InitiatorState, st *mt.ContractSecretRe
 			Events:   events,
 		}
 	}
+	var events []transfer.Event
+	if state.ReturnTransfer != nil && state.ReturnState != mt.StateBalanceProof {
+		//密码已经在链上了,回来的锁不会丢失,如果通道已经关闭,还需要在链上 unlock
+		state.ReturnState = mt.StateSecretRegistered
+		if st.BlockNumber < state.ReturnTransfer.Expiration && state.ReturnRoute.State() == channeltype.StateClosed {
+			events = append(events, &mt.EventContractSendUnlock{
+				LockSecretHash:    st.LockSecretHash,
+				ChannelIdentifier: state.ReturnRoute.ChannelIdentifier,
+			})
+		}
+	}
+	if state.BalanceProofSent {
+		events = append(events, &mt.EventRemoveStateManager{
+			Key: utils.Sha3(state.LockSecretHash[:], state.Transfer.Token[:]),
+		})
+		return &transfer.TransitionResult{
+			NewState: state,
+			Events:   events,
+		}
+	}
 	//认为交易成功了
 	// assume transfer succeed.
 	return &transfer.TransitionResult{
 		NewState: state,
-		Events:   transferSuccessEvents(state),
+		Events:   append(events, transferSuccessEvents(state)...),
 	}
 }
 
@@ -326,10 +471,16 @@ func transferSuccessEvents(state *mt.InitiatorState) (events []transfer.Event) {
 	unlockSuccess := &mt.EventUnlockSuccess{
 		LockSecretHash: tr.LockSecretHash,
 	}
+	events = []transfer.Event{unlockLock, transferSuccess, unlockSuccess}
+	state.BalanceProofSent = true
+	if !returnFinished(state) {
+		//环形交易还要等待 LastHop 的 unlock
+		return events
+	}
 	removeManager := &mt.EventRemoveStateManager{
 		Key: utils.Sha3(tr.LockSecretHash[:], tr.Token[:]),
 	}
-	events = []transfer.Event{unlockLock, transferSuccess, unlockSuccess, removeManager}
+	events = append(events, removeManager)
 	return events
 }
 
@@ -348,14 +499,21 @@ func handleSecretReveal(state *mt.InitiatorState, st *mt.ReceiveSecretRevealStat
 			Events:   nil,
 		}
 	}
-	if st.Sender == state.Route.HopNode() && st.Secret == state.Transfer.Secret {
+	if st.Sender == state.Route.HopNode() && st.Secret == state.Transfer.Secret && !state.BalanceProofSent {
 		/*
 					   next hop learned the secret, unlock the token locally and send the
 			         unlock message to next hop
 		*/
+		events := transferSuccessEvents(state)
+		if !returnFinished(state) {
+			return &transfer.TransitionResult{
+				NewState: state,
+				Events:   events,
+			}
+		}
 		return &transfer.TransitionResult{
 			NewState: nil,
-			Events:   transferSuccessEvents(state),
+			Events:   events,
 		}
 	}
 	return &transfer.TransitionResult{
@@ -377,6 +535,9 @@ func StateTransition(originalState transfer.State, st transfer.StateChange) *tra
 	   usage for each end, since the full merkle tree must be saved to compute
 	   it's root.
 	*/
+	if isMultiPath(originalState, st) {
+		return multiPathStateTransition(originalState, st)
+	}
 	it := &transfer.TransitionResult{
 		NewState: originalState,
 		Events:   nil,
@@ -400,6 +561,7 @@ func StateTransition(originalState transfer.State, st transfer.StateChange) *tra
 				Secret:                         staii.Secret,
 				Db:                             staii.Db,
 				CancelByExceptionSecretRequest: false,
+				LastHop:                        staii.LastHop,
 			}
 			return tryNewRoute(state)
 		}
@@ -465,6 +627,11 @@ func StateTransition(originalState transfer.State, st transfer.StateChange) *tra
 			it = cancelCurrentRoute(state)
 		case *mt.ContractChannelWithdrawStateChange:
 			it = cancelCurrentRoute(state)
+		case *mt.ActionInitTargetStateChange:
+			//环形交易回到了我这里
+			it = handleReturnTransfer(state, st2)
+		case *mt.ReceiveUnlockStateChange:
+			it = handleReturnBalanceProof(state, st2)
 		default:
 			log.Error(fmt.Sprintf("initiator received unkown state change %s", utils.StringInterface(st, 3)))
 		}
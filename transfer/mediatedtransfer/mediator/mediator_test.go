@@ -10,6 +10,7 @@ import (
 	"os"
 
 	"github.com/SmartMeshFoundation/Photon/channel/channeltype"
+	"github.com/SmartMeshFoundation/Photon/encoding"
 	"github.com/SmartMeshFoundation/Photon/log"
 	"github.com/SmartMeshFoundation/Photon/transfer"
 	"github.com/SmartMeshFoundation/Photon/transfer/mediatedtransfer"
@@ -783,3 +784,142 @@ func TestNoValidRoutes(t *testing.T) {
 	_, ok := events[0].(*mediatedtransfer.EventSendAnnounceDisposed)
 	assert(t, ok, true)
 }
+
+/*
+mediateAndRefund 中间节点把交易转给 payee, 然后 payee 退回了锁,
+refused 表示退回的 AnnounceDisposed 是否带着接收方的拒绝
+*/
+func mediateAndRefund(t *testing.T, payer, payee, target common.Address, refused bool) []transfer.Event {
+	fromRoute, fromTransfer := utest.MakeFrom(utest.UnitTransferAmount, target, int64(utest.Hop1Timeout), payer, utils.EmptyHash)
+	routes := []*route.State{
+		utest.MakeRoute(payee, utest.UnitTransferAmount, utest.UnitSettleTimeout, utest.UnitRevealTimeout, 0, utils.NewRandomHash()),
+		utest.MakeRoute(utest.HOP5, utest.UnitTransferAmount, utest.UnitSettleTimeout, utest.UnitRevealTimeout, 0, utils.NewRandomHash()),
+	}
+	sm := transfer.NewStateManager(StateTransition, nil, "mediator", utils.ShaSecret([]byte("3")), utils.NewRandomAddress())
+	var mtr *mediatedtransfer.EventSendMediatedTransfer
+	for _, e := range sm.Dispatch(makeInitStateChange(fromTransfer, fromRoute, routes, utest.ADDR)) {
+		if e2, ok := e.(*mediatedtransfer.EventSendMediatedTransfer); ok {
+			mtr = e2
+		}
+	}
+	if mtr == nil || mtr.Receiver != payee {
+		t.Fatalf("transfer should be sent to %s", utils.APex2(payee))
+	}
+	return sm.Dispatch(&mediatedtransfer.ReceiveAnnounceDisposedStateChange{
+		Sender: payee,
+		Token:  mtr.Token,
+		Lock: &mtree.Lock{
+			Expiration:     mtr.Expiration,
+			Amount:         mtr.Amount,
+			LockSecretHash: mtr.LockSecretHash,
+		},
+		Message: &encoding.AnnounceDisposed{
+			AnnounceDisposedProof: encoding.AnnounceDisposedProof{
+				ChannelIDInMessage: encoding.ChannelIDInMessage{ChannelIdentifier: routes[0].ChannelIdentifier},
+			},
+			Refused: refused,
+		},
+	})
+}
+
+func TestTargetRefusalMultiHop(t *testing.T) {
+	//A-B-C-D, D 拒绝了交易
+	a, b, c, d := utest.HOP4, utest.HOP3, utest.HOP2, utest.HOP1
+	check := func(events []transfer.Event, payer common.Address) *mediatedtransfer.EventSendAnnounceDisposed {
+		var ad *mediatedtransfer.EventSendAnnounceDisposed
+		for _, e := range events {
+			switch e2 := e.(type) {
+			case *mediatedtransfer.EventSendMediatedTransfer:
+				t.Errorf("should not try other routes,but send to %s", utils.APex2(e2.Receiver))
+			case *mediatedtransfer.EventSendAnnounceDisposed:
+				ad = e2
+			}
+		}
+		if ad == nil {
+			t.Fatal("lock should be given back to payer")
+		}
+		assert(t, ad.Receiver, payer)
+		assert(t, ad.Refused, true)
+		return ad
+	}
+	//C 收到 D 的拒绝
+	ad := check(mediateAndRefund(t, b, d, d, false), b)
+	//B 收到 C 转发的拒绝
+	check(mediateAndRefund(t, a, c, d, ad.Refused), a)
+	//普通的 AnnounceDisposed 还是要尝试其他路径
+	var rerouted bool
+	for _, e := range mediateAndRefund(t, a, c, d, false) {
+		if e2, ok := e.(*mediatedtransfer.EventSendMediatedTransfer); ok {
+			rerouted = e2.Receiver == utest.HOP5
+		}
+	}
+	assert(t, rerouted, true)
+}
+
+/*
+多路径支付的两个部分经过同一个中间节点, 各自从不同的通道转出,
+下家退回较早的那个部分时, 只为这个部分尝试其他路径.
+*/
+func TestMultiPathPartsShareMediator(t *testing.T) {
+	target := utest.HOP1
+	routes := []*route.State{
+		utest.MakeRoute(utest.HOP2, utest.UnitTransferAmount, utest.UnitSettleTimeout, utest.UnitRevealTimeout, 0, utils.NewRandomHash()),
+		utest.MakeRoute(utest.HOP3, utest.UnitTransferAmount, utest.UnitSettleTimeout, utest.UnitRevealTimeout, 0, utils.NewRandomHash()),
+		utest.MakeRoute(utest.HOP5, utest.UnitTransferAmount, utest.UnitSettleTimeout, utest.UnitRevealTimeout, 0, utils.NewRandomHash()),
+	}
+	makePart := func(payer common.Address, amount, expiration int64) (*route.State, *mediatedtransfer.LockedTransferState) {
+		fromRoute, fromTransfer := utest.MakeFrom(big.NewInt(amount), target, expiration, payer, utils.EmptyHash)
+		fromRoute.ChannelIdentifier = utils.NewRandomHash()
+		fromTransfer.Initiator = utest.HOP6
+		fromTransfer.TotalAmount = big.NewInt(10)
+		return fromRoute, fromTransfer
+	}
+	sent := func(events []transfer.Event) (mtr *mediatedtransfer.EventSendMediatedTransfer) {
+		for _, e := range events {
+			if e2, ok := e.(*mediatedtransfer.EventSendMediatedTransfer); ok {
+				mtr = e2
+			}
+		}
+		return
+	}
+	sm := transfer.NewStateManager(StateTransition, nil, "mediator", utest.UnitHashLock, utest.UnitTokenAddress)
+	route1, part1 := makePart(utest.HOP4, 3, int64(utest.Hop1Timeout))
+	mtr1 := sent(sm.Dispatch(makeInitStateChange(part1, route1, routes, utest.ADDR)))
+	assert(t, mtr1.Receiver, utest.HOP2)
+	//the other part has a later expiration and a different amount
+	route2, part2 := makePart(utest.HOP6, 7, int64(utest.Hop1Timeout)+5)
+	mtr2 := sent(sm.Dispatch(&mediatedtransfer.MediatorReReceiveStateChange{
+		FromTransfer: part2,
+		FromRoute:    route2,
+		BlockNumber:  1,
+	}))
+	assert(t, mtr2.Receiver, utest.HOP3)
+	assert(t, mtr2.Amount, big.NewInt(7))
+	state := sm.CurrentState.(*mediatedtransfer.MediatorState)
+	assert(t, len(state.TransfersPair), 2)
+
+	//HOP2 gives back the first part, it's rerouted to HOP5 and the second part is kept
+	events := sm.Dispatch(&mediatedtransfer.ReceiveAnnounceDisposedStateChange{
+		Sender: utest.HOP2,
+		Token:  mtr1.Token,
+		Lock: &mtree.Lock{
+			Expiration:     mtr1.Expiration,
+			Amount:         mtr1.Amount,
+			LockSecretHash: mtr1.LockSecretHash,
+		},
+		Message: &encoding.AnnounceDisposed{
+			AnnounceDisposedProof: encoding.AnnounceDisposedProof{
+				ChannelIDInMessage: encoding.ChannelIDInMessage{ChannelIdentifier: routes[0].ChannelIdentifier},
+			},
+		},
+	})
+	mtr3 := sent(events)
+	if mtr3 == nil {
+		t.Fatal("the first part should be rerouted")
+	}
+	assert(t, mtr3.Receiver, utest.HOP5)
+	assert(t, mtr3.Amount, big.NewInt(3))
+	assert(t, len(state.TransfersPair), 2)
+	assert(t, state.TransfersPair[0].PayeeRoute.HopNode(), utest.HOP3)
+	assert(t, state.TransfersPair[1].PayerRoute.HopNode(), utest.HOP4)
+}
@@ -85,6 +85,25 @@ func IsValidRefund(originTr *mediatedtransfer.LockedTransferState, originRoute *
 		originTr.Expiration == st.Lock.Expiration
 }
 
+/*
+IsTargetRefusal returns True if the target gives back the lock of transfer, like a held transfer canceled by target,
+or a mediator passes on the refusal of the target.
+No other route should be tried, because the target refuses this transfer.
+*/
+func IsTargetRefusal(originTr *mediatedtransfer.LockedTransferState, originRoute *route.State, st *mediatedtransfer.ReceiveAnnounceDisposedStateChange) bool {
+	if st.Sender != originRoute.HopNode() {
+		return false
+	}
+	refused := st.Message != nil && st.Message.Refused
+	if st.Sender != originTr.Target && !refused {
+		return false
+	}
+	return originTr.Amount.Cmp(st.Lock.Amount) == 0 &&
+		originTr.LockSecretHash == st.Lock.LockSecretHash &&
+		originTr.Token == st.Token &&
+		originTr.Expiration == st.Lock.Expiration
+}
+
 /*
 True if this node needs to register secret on chain
 
@@ -206,6 +225,10 @@ func sanityCheck(state *mediatedtransfer.MediatorState) {
 	for i := range pairs2 {
 		original := state.TransfersPair[i]
 		refund := state.TransfersPair[i+1]
+		if refund.PayerTransfer.TotalAmount != nil && refund.PayerTransfer.TotalAmount.Cmp(utils.BigInt0) > 0 {
+			//多路径支付的另一个部分,金额和有效期都可以不同
+			continue
+		}
 		if !original.PayeeTransfer.AlmostEqual(refund.PayerTransfer) {
 			panic("sanity check failed:original.PayeeTransfer.AlmostEqual(refund.PayerTransfer)")
 		}
@@ -321,15 +344,17 @@ func nextTransferPair(payerRoute *route.State, payerTransfer *mediatedtransfer.L
 		lockTimeout := timeoutBlocks //- payeeRoute.RevealTimeout()
 		lockExpiration := int64(lockTimeout) + blockNumber
 		payeeTransfer := &mediatedtransfer.LockedTransferState{
-			TargetAmount:   payerTransfer.TargetAmount,
-			Amount:         big.NewInt(0).Sub(payerTransfer.Amount, payeeRoute.Fee),
-			Token:          payerTransfer.Token,
-			Initiator:      payerTransfer.Initiator,
-			Target:         payerTransfer.Target,
-			Expiration:     lockExpiration,
-			LockSecretHash: payerTransfer.LockSecretHash,
-			Secret:         payerTransfer.Secret,
-			Fee:            big.NewInt(0).Sub(payerTransfer.Fee, payeeRoute.Fee),
+			TargetAmount:    payerTransfer.TargetAmount,
+			Amount:          big.NewInt(0).Sub(payerTransfer.Amount, payeeRoute.Fee),
+			Token:           payerTransfer.Token,
+			Initiator:       payerTransfer.Initiator,
+			Target:          payerTransfer.Target,
+			Expiration:      lockExpiration,
+			LockSecretHash:  payerTransfer.LockSecretHash,
+			Secret:          payerTransfer.Secret,
+			Fee:             big.NewInt(0).Sub(payerTransfer.Fee, payeeRoute.Fee),
+			TotalAmount:     payerTransfer.TotalAmount,
+			EncryptedSecret: payerTransfer.EncryptedSecret,
 		}
 		if payeeRoute.HopNode() == payeeTransfer.Target {
 			//i'm the last hop,so take the rest of the fee
@@ -489,6 +514,17 @@ func eventsForRefund(refundRoute *route.State, refundTransfer *mediatedtransfer.
 	return
 }
 
+//eventsForRefusal gives back the lock to payer and tells it that the target refuses this transfer
+func eventsForRefusal(refundRoute *route.State, refundTransfer *mediatedtransfer.LockedTransferState) (events []transfer.Event) {
+	events = eventsForRefund(refundRoute, refundTransfer)
+	for _, e := range events {
+		if e2, ok := e.(*mediatedtransfer.EventSendAnnounceDisposed); ok {
+			e2.Refused = true
+		}
+	}
+	return
+}
+
 /*
 Reveal the secret backwards.
 
@@ -764,8 +800,11 @@ func cancelCurrentRoute(state *mediatedtransfer.MediatorState, refundChannelIden
 		log.Error(fmt.Sprintf("recevie refund ,but has no transfer pair ,must be a attack!!"))
 		return it
 	}
-	transferPair := state.TransfersPair[l-1]
-	state.TransfersPair = state.TransfersPair[:l-1] //移除最后一个
+	i := pairIndex(state, func(pair *mediatedtransfer.MediationPairState) bool {
+		return pair.PayeeRoute.ChannelIdentifier == refundChannelIdentify
+	})
+	transferPair := state.TransfersPair[i]
+	state.TransfersPair = append(state.TransfersPair[:i], state.TransfersPair[i+1:]...)
 	/*
 		if refund msg came from payer, panic, something must wrong!
 	*/
@@ -793,6 +832,20 @@ func cancelCurrentRoute(state *mediatedtransfer.MediatorState, refundChannelIden
 	return it
 }
 
+/*
+pairIndex 找到最后一个满足 match 的 TransfersPair, 没有的话就是最后一个.
+多路径支付的几个部分可能经过同一个中间节点, 每个部分从不同的通道转出,
+这时候退回的不一定是最后一个.
+*/
+func pairIndex(state *mediatedtransfer.MediatorState, match func(pair *mediatedtransfer.MediationPairState) bool) int {
+	for i := len(state.TransfersPair) - 1; i >= 0; i-- {
+		if match(state.TransfersPair[i]) {
+			return i
+		}
+	}
+	return len(state.TransfersPair) - 1
+}
+
 /*
 又收到了一个 mediatedtransfer
 */
@@ -864,14 +917,17 @@ func handleAnnouceDisposed(state *mediatedtransfer.MediatorState, st *mediatedtr
 	/*
 			  The last sent transfer is the only one thay may be refunded, all the
 		     previous ones are refunded already.
-
+		  多路径支付的几个部分经过我的时候例外,每个部分都有一个等待中的 TransfersPair.
 	*/
 	l := len(state.TransfersPair)
 	if l <= 0 {
 		log.Error(fmt.Sprintf("recevie refund ,but has no transfer pair ,must be a attack!!"))
 		return it
 	}
-	transferPair := state.TransfersPair[l-1]
+	i := pairIndex(state, func(pair *mediatedtransfer.MediationPairState) bool {
+		return pair.PayeeRoute.HopNode() == st.Sender
+	})
+	transferPair := state.TransfersPair[i]
 	payeeTransfer := transferPair.PayeeTransfer
 	payeeRoute := transferPair.PayeeRoute
 
@@ -886,6 +942,20 @@ func handleAnnouceDisposed(state *mediatedtransfer.MediatorState, st *mediatedtr
 	*/
 	// A-B-C-F-B-G-D
 	// If B first receives refund of C, how to deal with that?
+	if IsTargetRefusal(payeeTransfer, payeeRoute, st) {
+		/*
+			接收方拒绝了这笔交易,不再尝试其他路径,应答下家并且把锁退给上家,
+			同时告诉上家是接收方拒绝的,上家也不会再尝试其他路径
+		*/
+		state.TransfersPair = append(state.TransfersPair[:i], state.TransfersPair[i+1:]...)
+		it.Events = append(it.Events, &mediatedtransfer.EventSendAnnounceDisposedResponse{
+			Token:          state.Token,
+			LockSecretHash: st.Lock.LockSecretHash,
+			Receiver:       st.Sender,
+		})
+		it.Events = append(it.Events, eventsForRefusal(transferPair.PayerRoute, transferPair.PayerTransfer)...)
+		return it
+	}
 	if IsValidRefund(payeeTransfer, payeeRoute, st) {
 		if payeeTransfer.Expiration > state.BlockNumber {
 			/*
@@ -27,6 +27,9 @@ type LockedTransferState struct {
 	Secret         common.Hash    //The secret that unlocks the lock, may be None.
 	Fee            *big.Int       // how much fee left for other hop node.
 	Data           string
+	TotalAmount    *big.Int // amount target should receive in all parts of a multi-path transfer, nil for a normal transfer
+	// secret encrypted with public key of target for a keysend transfer, empty for a normal transfer
+	EncryptedSecret []byte
 }
 
 //AlmostEqual if two state equals?
@@ -42,14 +45,16 @@ func (l *LockedTransferState) AlmostEqual(other *LockedTransferState) bool {
 //LockedTransferFromMessage Create LockedTransferState from a MediatedTransfer message.
 func LockedTransferFromMessage(msg *encoding.MediatedTransfer, tokenAddress common.Address) *LockedTransferState {
 	return &LockedTransferState{
-		TargetAmount:   new(big.Int).Sub(msg.PaymentAmount, msg.Fee),
-		Amount:         new(big.Int).Set(msg.PaymentAmount),
-		Initiator:      msg.Initiator,
-		Target:         msg.Target,
-		Expiration:     msg.Expiration,
-		LockSecretHash: msg.LockSecretHash,
-		Fee:            msg.Fee,
-		Token:          tokenAddress,
+		TargetAmount:    new(big.Int).Sub(msg.PaymentAmount, msg.Fee),
+		Amount:          new(big.Int).Set(msg.PaymentAmount),
+		Initiator:       msg.Initiator,
+		Target:          msg.Target,
+		Expiration:      msg.Expiration,
+		LockSecretHash:  msg.LockSecretHash,
+		Fee:             msg.Fee,
+		Token:           tokenAddress,
+		TotalAmount:     msg.TotalAmount,
+		EncryptedSecret: msg.EncryptedSecret,
 	}
 }
 
@@ -89,8 +94,49 @@ type InitiatorState struct {
 	CanceledTransfers              []*EventSendMediatedTransfer
 	Db                             channeltype.Db
 	CancelByExceptionSecretRequest bool // set true when receive exception SecretRequest
+	/*
+		环形交易(Initiator == Target)用于通道再平衡,从 Route 出去,只能从 LastHop 回到我这里,
+		ReturnRoute,ReturnTransfer 是回到我这里的那一段,ReturnState 和 TargetState.State 意义相同
+	*/
+	LastHop          common.Address
+	ReturnRoute      *route.State
+	ReturnTransfer   *LockedTransferState
+	ReturnState      string
+	BalanceProofSent bool // 已经给 Route 发送了 unlock,环形交易还需要等待 LastHop 的 unlock
+}
+
+/*
+MultiPathInitiatorState 多路径支付的发起方, 一笔交易分成几个部分(Parts)从不同的通道发出,
+所有部分使用同一个密码, 每个部分都是一个普通的 InitiatorState.
+接收方收齐所有部分以后才会发送 SecretRequest, 金额为所有部分之和,
+发起方只在所有部分都还在途中时才告诉接收方密码, 所以要么所有部分都成功, 要么都失败.
+*/
+type MultiPathInitiatorState struct {
+	OurAddress                     common.Address
+	Transfer                       *LockedTransferState // TargetAmount is the total amount target should receive
+	Parts                          []*InitiatorState
+	PartStatus                     []string // status of each part, see StatePartPending...
+	PartFinished                   []bool   // state of the part has been removed
+	BlockNumber                    int64
+	LockSecretHash                 common.Hash
+	Secret                         common.Hash
+	RevealSecret                   *EventSendRevealSecret
+	CancelByExceptionSecretRequest bool
+	Failed                         bool // EventTransferSentFailed has been emitted, the secret will never be revealed
 }
 
+//StatePartPending part of a multi-path transfer is in flight
+const StatePartPending = "pending"
+
+//StatePartSecretRevealed secret of the multi-path transfer has been revealed to target
+const StatePartSecretRevealed = "secret_revealed"
+
+//StatePartUnlocked unlock of the part has been sent to the first hop
+const StatePartUnlocked = "unlocked"
+
+//StatePartFailed no route for the part, it's canceled or its lock expired
+const StatePartFailed = "failed"
+
 /*
 MediatorState is State of a node mediating a transfer.
 */
@@ -136,6 +182,12 @@ const StateBalanceProof = "balance_proof"
 //StateWaitingRegisterSecret wait register secret on chain
 const StateWaitingRegisterSecret = "waiting_register_secret"
 
+/*
+StateHeld 接收方收到了交易但是暂不处理, 等待用户接受(发送 SecretRequest 或者直接披露密码)
+或者取消(给上家发送 AnnounceDisposed), 到了 HoldDeadline 还没有处理就自动取消
+*/
+const StateHeld = "held"
+
 /*
 StateSecretRegistered 密码已经在链上披露了
 整个交易的所有参与方都可以认为这笔交易从彻底完成了,
@@ -157,6 +209,25 @@ type TargetState struct {
 	Secret       common.Hash
 	State        string // default secret_request
 	Db           channeltype.Db
+	HeldSecret   common.Hash // secret known by us in advance for a held transfer, revealed only when accepted
+	HoldDeadline int64       // a held transfer is canceled automatically at this block
+}
+
+/*
+MultiPathTargetState 多路径支付的接收方, 每收到一个部分就增加一个 TargetState,
+收到的金额达到 TotalAmount 以后才发送唯一的一个 SecretRequest.
+*/
+type MultiPathTargetState struct {
+	OurAddress      common.Address
+	Initiator       common.Address
+	Token           common.Address
+	LockSecretHash  common.Hash
+	TotalAmount     *big.Int
+	Parts           []*TargetState
+	PartFinished    []bool
+	BlockNumber     int64
+	SecretRequested bool
+	Db              channeltype.Db
 }
 
 /*
@@ -253,4 +324,6 @@ func init() {
 	gob.Register(&MediatorState{})
 	gob.Register(&TargetState{})
 	gob.Register(&MediationPairState{})
+	gob.Register(&MultiPathInitiatorState{})
+	gob.Register(&MultiPathTargetState{})
 }
@@ -38,6 +38,20 @@ type ActionInitInitiatorStateChange struct {
 	Db             channeltype.Db       //get the latest channel state
 	LockSecretHash common.Hash
 	Secret         common.Hash
+	LastHop        common.Address //the last hop of a circular transfer, whose target is ourself
+}
+
+/*
+ActionInitMultiPathInitiatorStateChange start a multi-path transfer,
+every part is started like a normal mediated transfer, they share the same secret.
+*/
+type ActionInitMultiPathInitiatorStateChange struct {
+	OurAddress     common.Address
+	Transfer       *LockedTransferState //TargetAmount is the total amount of all parts
+	Parts          []*ActionInitInitiatorStateChange
+	BlockNumber    int64
+	LockSecretHash common.Hash
+	Secret         common.Hash
 }
 
 //ActionInitMediatorStateChange  Initial state for a new mediator.
@@ -67,6 +81,19 @@ type ActionInitTargetStateChange struct {
 	BlockNumber int64
 	Message     *encoding.MediatedTransfer //the message trigger this statechange
 	Db          channeltype.Db             //get the latest channel state
+	Secret      common.Hash                //secret known by target in advance, like invoice created by target, no SecretRequest is needed
+	Hold        bool                       //park the transfer until user accepts or cancels it
+	Refuse      bool                       //node is draining, give back the lock by AnnounceDisposed at once
+}
+
+//ActionAcceptHeldTransferStateChange user accepts a held transfer, target continues as a normal transfer
+type ActionAcceptHeldTransferStateChange struct {
+	LockSecretHash common.Hash
+}
+
+//ActionCancelHeldTransferStateChange user cancels a held transfer, target gives back the lock by AnnounceDisposed
+type ActionCancelHeldTransferStateChange struct {
+	LockSecretHash common.Hash
 }
 
 /*
@@ -288,9 +315,12 @@ func (e *ContractHistoryEventCompleteStateChange) GetBlockNumber() int64 {
 
 func init() {
 	gob.Register(&ActionInitInitiatorStateChange{})
+	gob.Register(&ActionInitMultiPathInitiatorStateChange{})
 	gob.Register(&ActionInitMediatorStateChange{})
 	gob.Register(&ActionInitTargetStateChange{})
 	gob.Register(&ActionCancelRouteStateChange{})
+	gob.Register(&ActionAcceptHeldTransferStateChange{})
+	gob.Register(&ActionCancelHeldTransferStateChange{})
 	gob.Register(&ReceiveSecretRequestStateChange{})
 	gob.Register(&ReceiveSecretRevealStateChange{})
 	gob.Register(&ReceiveAnnounceDisposedStateChange{})
@@ -0,0 +1,167 @@
+package target
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/transfer"
+	"github.com/SmartMeshFoundation/Photon/transfer/mediatedtransfer"
+	"github.com/SmartMeshFoundation/Photon/transfer/mediatedtransfer/mediator"
+	"github.com/SmartMeshFoundation/Photon/utils"
+)
+
+/*
+多路径支付的接收方.
+每收到一个部分就增加一个 TargetState, 但是不为单个部分发送 SecretRequest,
+只有所有还来得及在链上注册密码的部分金额之和达到 TotalAmount, 才发送唯一的一个 SecretRequest.
+发起方收到金额不对的 SecretRequest 不会告诉我密码, 所以要么收到所有部分, 要么什么都收不到.
+*/
+
+func isMultiPath(originalState transfer.State, st transfer.StateChange) bool {
+	if originalState == nil {
+		ait, ok := st.(*mediatedtransfer.ActionInitTargetStateChange)
+		return ok && ait.FromTranfer.TotalAmount != nil && ait.FromTranfer.TotalAmount.Cmp(utils.BigInt0) > 0
+	}
+	_, ok := originalState.(*mediatedtransfer.MultiPathTargetState)
+	return ok
+}
+
+// handleNewPart 收到了多路径支付的一个部分
+func handleNewPart(state *mediatedtransfer.MultiPathTargetState, st *mediatedtransfer.ActionInitTargetStateChange) *transfer.TransitionResult {
+	tr := st.FromTranfer
+	isValid := !state.SecretRequested &&
+		tr.Initiator == state.Initiator &&
+		tr.Token == state.Token &&
+		tr.LockSecretHash == state.LockSecretHash &&
+		tr.TotalAmount != nil && tr.TotalAmount.Cmp(state.TotalAmount) == 0
+	for _, part := range state.Parts {
+		if part.FromRoute.ChannelIdentifier == st.FromRoute.ChannelIdentifier {
+			isValid = false
+		}
+	}
+	if !isValid {
+		//这个锁只能等待过期
+		log.Warn(fmt.Sprintf("ignore part of multi-path transfer %s from %s, total=%s",
+			utils.HPex(tr.LockSecretHash), utils.APex2(st.FromRoute.HopNode()), tr.TotalAmount))
+		return &transfer.TransitionResult{
+			NewState: state,
+			Events:   nil,
+		}
+	}
+	newPart := &mediatedtransfer.TargetState{
+		OurAddress:   st.OurAddress,
+		FromRoute:    st.FromRoute,
+		FromTransfer: tr,
+		BlockNumber:  st.BlockNumber,
+		Db:           st.Db,
+	}
+	if st.Refuse {
+		//正在退出,整笔交易不可能完成了,已经收到的部分也一起还给上家
+		events := []transfer.Event{announceDisposed(newPart)}
+		for i, part := range state.Parts {
+			if !state.PartFinished[i] {
+				events = append(events, announceDisposed(part))
+				state.PartFinished[i] = true
+			}
+		}
+		return &transfer.TransitionResult{
+			NewState: state,
+			Events:   events,
+		}
+	}
+	state.Parts = append(state.Parts, newPart)
+	state.PartFinished = append(state.PartFinished, false)
+	received := new(big.Int)
+	for i, part := range state.Parts {
+		if !state.PartFinished[i] && mediator.IsSafeToWait(part.FromTransfer, part.FromRoute.RevealTimeout(), state.BlockNumber) {
+			received.Add(received, part.FromTransfer.Amount)
+		}
+	}
+	if received.Cmp(state.TotalAmount) < 0 {
+		return &transfer.TransitionResult{
+			NewState: state,
+			Events:   nil,
+		}
+	}
+	state.SecretRequested = true
+	secretRequest := &mediatedtransfer.EventSendSecretRequest{
+		ChannelIdentifier: st.FromRoute.ChannelIdentifier,
+		LockSecretHash:    state.LockSecretHash,
+		Amount:            new(big.Int).Set(state.TotalAmount),
+		Receiver:          state.Initiator,
+	}
+	return &transfer.TransitionResult{
+		NewState: state,
+		Events:   []transfer.Event{secretRequest},
+	}
+}
+
+// multiPathStateTransiton is State machine for the target node of a multi-path transfer.
+func multiPathStateTransiton(originalState transfer.State, stateChange transfer.StateChange) *transfer.TransitionResult {
+	state, _ := originalState.(*mediatedtransfer.MultiPathTargetState)
+	if state == nil {
+		ait := stateChange.(*mediatedtransfer.ActionInitTargetStateChange)
+		state = &mediatedtransfer.MultiPathTargetState{
+			OurAddress:     ait.OurAddress,
+			Initiator:      ait.FromTranfer.Initiator,
+			Token:          ait.FromTranfer.Token,
+			LockSecretHash: ait.FromTranfer.LockSecretHash,
+			TotalAmount:    ait.FromTranfer.TotalAmount,
+			BlockNumber:    ait.BlockNumber,
+			Db:             ait.Db,
+		}
+	}
+	var events []transfer.Event
+	switch st2 := stateChange.(type) {
+	case *mediatedtransfer.ActionInitTargetStateChange:
+		events = handleNewPart(state, st2).Events
+	case *transfer.BlockStateChange:
+		if state.BlockNumber < st2.BlockNumber {
+			state.BlockNumber = st2.BlockNumber
+		}
+		events = dispatchToParts(state, stateChange)
+	case *mediatedtransfer.ReceiveSecretRevealStateChange,
+		*mediatedtransfer.ContractSecretRevealOnChainStateChange,
+		*mediatedtransfer.ReceiveUnlockStateChange:
+		events = dispatchToParts(state, stateChange)
+	default:
+		log.Error(fmt.Sprintf("multi-path target state manager receive unkown state change %s", utils.StringInterface(stateChange, 3)))
+	}
+	for _, finished := range state.PartFinished {
+		if !finished {
+			return &transfer.TransitionResult{
+				NewState: state,
+				Events:   events,
+			}
+		}
+	}
+	events = append(events, &mediatedtransfer.EventRemoveStateManager{
+		Key: utils.Sha3(state.LockSecretHash[:], state.Token[:]),
+	})
+	return &transfer.TransitionResult{
+		NewState: nil,
+		Events:   events,
+	}
+}
+
+// dispatchToParts 每个部分和普通交易的接收方一样处理,只是由整笔交易来决定什么时候移除 StateManager
+func dispatchToParts(state *mediatedtransfer.MultiPathTargetState, stateChange transfer.StateChange) (events []transfer.Event) {
+	for i, part := range state.Parts {
+		if state.PartFinished[i] {
+			continue
+		}
+		it := StateTransiton(part, stateChange)
+		if it.NewState == nil {
+			state.PartFinished[i] = true
+		}
+		for _, e := range it.Events {
+			if _, ok := e.(*mediatedtransfer.EventRemoveStateManager); ok {
+				state.PartFinished[i] = true
+				continue
+			}
+			events = append(events, e)
+		}
+	}
+	return
+}
@@ -125,6 +125,28 @@ func TestHandleInitTarget(t *testing.T) {
 	assert(t, ev.Receiver, initiator)
 }
 
+/*
+Init transfer must reveal the secret to payer hop directly if the secret is known, like an invoice created by us.
+*/
+func TestHandleInitTargetSecretKnown(t *testing.T) {
+	var blockNumber int64 = 1
+	var amount int64 = 1
+	var expire = int64(utest.UnitRevealTimeout) + blockNumber + 1
+	initiator := utest.HOP1
+
+	st := makeInitStateChange(utest.ADDR, amount, blockNumber, initiator, expire)
+	st.Secret = utest.UnitSecret
+	it := handleInitTraget(st)
+	assert(t, len(it.Events), 1)
+	ev, ok := it.Events[0].(*mediatedtransfer.EventSendRevealSecret)
+	assert(t, ok, true)
+	assert(t, ev.Secret, utest.UnitSecret)
+	assert(t, ev.Receiver, st.FromRoute.HopNode())
+	state := it.NewState.(*mediatedtransfer.TargetState)
+	assert(t, state.State, mediatedtransfer.StateRevealSecret)
+	assert(t, state.FromTransfer.Secret, utest.UnitSecret)
+}
+
 // Init transfer must do nothing if the expiration is bad.
 func TestHandleInitTargetBadExpiration(t *testing.T) {
 	var blockNumber int64 = 1
@@ -138,6 +160,140 @@ func TestHandleInitTargetBadExpiration(t *testing.T) {
 	assert(t, len(it.Events), 0)
 }
 
+/*
+Init transfer must be held without secret request if hold is required.
+*/
+func TestHandleInitTargetHold(t *testing.T) {
+	var blockNumber int64 = 1
+	var amount int64 = 1
+	var expire = int64(utest.UnitRevealTimeout) + blockNumber + 10
+	initiator := utest.HOP1
+
+	st := makeInitStateChange(utest.ADDR, amount, blockNumber, initiator, expire)
+	st.Hold = true
+	it := handleInitTraget(st)
+	assert(t, len(it.Events), 1)
+	ev, ok := it.Events[0].(*mediatedtransfer.EventTransferHeld)
+	assert(t, ok, true)
+	assert(t, ev.LockSecretHash, st.FromTranfer.LockSecretHash)
+	assert(t, ev.HoldDeadline, expire-int64(utest.UnitRevealTimeout))
+	assert(t, ev.SecretKnown, false)
+	state := it.NewState.(*mediatedtransfer.TargetState)
+	assert(t, state.State, mediatedtransfer.StateHeld)
+
+	//secret reveal from initiator must be ignored before accept
+	it = StateTransiton(state, &mediatedtransfer.ReceiveSecretRevealStateChange{
+		Secret:  utest.UnitSecret,
+		Sender:  initiator,
+		Message: &encoding.RevealSecret{},
+	})
+	assert(t, len(it.Events), 0)
+	assert(t, state.State, mediatedtransfer.StateHeld)
+
+	it = StateTransiton(state, &mediatedtransfer.ActionAcceptHeldTransferStateChange{
+		LockSecretHash: st.FromTranfer.LockSecretHash,
+	})
+	assert(t, len(it.Events), 1)
+	_, ok = it.Events[0].(*mediatedtransfer.EventSendSecretRequest)
+	assert(t, ok, true)
+	assert(t, state.State, mediatedtransfer.StateSecretRequest)
+}
+
+// Accepting a held transfer must reveal the secret directly if it is ours.
+func TestAcceptHeldSecretKnown(t *testing.T) {
+	var blockNumber int64 = 1
+	var amount int64 = 1
+	var expire = int64(utest.UnitRevealTimeout) + blockNumber + 10
+	initiator := utest.HOP1
+
+	st := makeInitStateChange(utest.ADDR, amount, blockNumber, initiator, expire)
+	st.Hold = true
+	st.Secret = utest.UnitSecret
+	it := handleInitTraget(st)
+	state := it.NewState.(*mediatedtransfer.TargetState)
+	assert(t, state.State, mediatedtransfer.StateHeld)
+	assert(t, state.FromTransfer.Secret, utils.EmptyHash)
+
+	it = StateTransiton(state, &mediatedtransfer.ActionAcceptHeldTransferStateChange{
+		LockSecretHash: st.FromTranfer.LockSecretHash,
+	})
+	assert(t, len(it.Events), 1)
+	ev, ok := it.Events[0].(*mediatedtransfer.EventSendRevealSecret)
+	assert(t, ok, true)
+	assert(t, ev.Secret, utest.UnitSecret)
+	assert(t, ev.Receiver, st.FromRoute.HopNode())
+	assert(t, state.State, mediatedtransfer.StateRevealSecret)
+}
+
+// Canceling a held transfer must give back the lock by AnnounceDisposed.
+func TestCancelHeld(t *testing.T) {
+	var blockNumber int64 = 1
+	var amount int64 = 1
+	var expire = int64(utest.UnitRevealTimeout) + blockNumber + 10
+	initiator := utest.HOP1
+
+	st := makeInitStateChange(utest.ADDR, amount, blockNumber, initiator, expire)
+	st.Hold = true
+	it := handleInitTraget(st)
+	state := it.NewState.(*mediatedtransfer.TargetState)
+
+	it = StateTransiton(state, &mediatedtransfer.ActionCancelHeldTransferStateChange{
+		LockSecretHash: st.FromTranfer.LockSecretHash,
+	})
+	assert(t, it.NewState, nil)
+	ev, ok := it.Events[0].(*mediatedtransfer.EventSendAnnounceDisposed)
+	assert(t, ok, true)
+	assert(t, ev.LockSecretHash, st.FromTranfer.LockSecretHash)
+	assert(t, ev.Receiver, st.FromRoute.HopNode())
+	assert(t, ev.Refused, true)
+	ev2, ok := it.Events[1].(*mediatedtransfer.EventHeldTransferCanceled)
+	assert(t, ok, true)
+	assert(t, ev2.Reason, "canceled by target")
+}
+
+// A draining target gives back the lock at once.
+func TestHandleInitTargetRefuse(t *testing.T) {
+	var blockNumber int64 = 1
+	var amount int64 = 1
+	var expire = int64(utest.UnitRevealTimeout) + blockNumber + 10
+	initiator := utest.HOP1
+
+	st := makeInitStateChange(utest.ADDR, amount, blockNumber, initiator, expire)
+	st.Refuse = true
+	it := handleInitTraget(st)
+	assert(t, it.NewState, nil)
+	assert(t, len(it.Events), 2)
+	ev, ok := it.Events[0].(*mediatedtransfer.EventSendAnnounceDisposed)
+	assert(t, ok, true)
+	assert(t, ev.LockSecretHash, st.FromTranfer.LockSecretHash)
+	assert(t, ev.Receiver, st.FromRoute.HopNode())
+	assert(t, ev.Refused, true)
+	_, ok = it.Events[1].(*mediatedtransfer.EventRemoveStateManager)
+	assert(t, ok, true)
+}
+
+// A held transfer must be canceled automatically when hold deadline is reached.
+func TestHandleBlockHoldDeadline(t *testing.T) {
+	var blockNumber int64 = 1
+	var amount int64 = 1
+	var expire = int64(utest.UnitRevealTimeout) + blockNumber + 10
+	initiator := utest.HOP1
+
+	st := makeInitStateChange(utest.ADDR, amount, blockNumber, initiator, expire)
+	st.Hold = true
+	it := handleInitTraget(st)
+	state := it.NewState.(*mediatedtransfer.TargetState)
+
+	it = StateTransiton(state, &transfer.BlockStateChange{BlockNumber: state.HoldDeadline - 1})
+	assert(t, it.NewState, state)
+	assert(t, len(it.Events), 0)
+	it = StateTransiton(state, &transfer.BlockStateChange{BlockNumber: state.HoldDeadline})
+	assert(t, it.NewState, nil)
+	_, ok := it.Events[0].(*mediatedtransfer.EventSendAnnounceDisposed)
+	assert(t, ok, true)
+	assert(t, it.Events[1].(*mediatedtransfer.EventHeldTransferCanceled).Reason, "hold deadline passed")
+}
+
 /*
 The target node needs to inform the secret to the previous node to
     receive an updated balance proof.
@@ -287,3 +443,59 @@ func TestStateTransition(t *testing.T) {
 	assert(t, newstate.BlockNumber, blockNumber+1)
 
 }
+
+func makeMultiPathPart(amount, total int64, blockNumber int64) *mediatedtransfer.ActionInitTargetStateChange {
+	st := makeInitStateChange(utest.ADDR, amount, blockNumber, utest.HOP1, blockNumber+int64(utest.UnitRevealTimeout)+10)
+	st.FromRoute.ChannelIdentifier = utils.NewRandomHash()
+	st.FromTranfer.TotalAmount = big.NewInt(total)
+	return st
+}
+
+/*
+the target of a multi-path transfer must not request the secret until all parts arrived.
+*/
+func TestMultiPathSecretRequest(t *testing.T) {
+	var blockNumber int64 = 1
+	sm := transfer.NewStateManager(StateTransiton, nil, NameTargetTransition, utils.EmptyHash, utest.UnitTokenAddress)
+	events := sm.Dispatch(makeMultiPathPart(7, 10, blockNumber))
+	assert(t, len(events), 0)
+	state, ok := sm.CurrentState.(*mediatedtransfer.MultiPathTargetState)
+	assert(t, ok, true)
+	//a part with different total is ignored
+	events = sm.Dispatch(makeMultiPathPart(3, 11, blockNumber))
+	assert(t, len(events), 0)
+	assert(t, len(state.Parts), 1)
+
+	events = sm.Dispatch(makeMultiPathPart(3, 10, blockNumber))
+	assert(t, len(events), 1)
+	ev, ok := events[0].(*mediatedtransfer.EventSendSecretRequest)
+	assert(t, ok, true)
+	assert(t, ev.Amount, big.NewInt(10))
+	assert(t, ev.Receiver, utest.HOP1)
+	assert(t, state.SecretRequested, true)
+	assert(t, len(state.Parts), 2)
+}
+
+/*
+a part received while draining is refused together with the parts already received.
+*/
+func TestMultiPathRefuse(t *testing.T) {
+	var blockNumber int64 = 1
+	sm := transfer.NewStateManager(StateTransiton, nil, NameTargetTransition, utils.EmptyHash, utest.UnitTokenAddress)
+	events := sm.Dispatch(makeMultiPathPart(7, 10, blockNumber))
+	assert(t, len(events), 0)
+
+	st := makeMultiPathPart(3, 10, blockNumber)
+	st.Refuse = true
+	events = sm.Dispatch(st)
+	assert(t, len(events), 3)
+	for _, ev := range events[:2] {
+		ev2, ok := ev.(*mediatedtransfer.EventSendAnnounceDisposed)
+		assert(t, ok, true)
+		assert(t, ev2.Refused, true)
+	}
+	assert(t, events[0].(*mediatedtransfer.EventSendAnnounceDisposed).Amount, big.NewInt(3))
+	_, ok := events[2].(*mediatedtransfer.EventRemoveStateManager)
+	assert(t, ok, true)
+	assert(t, sm.CurrentState, nil)
+}
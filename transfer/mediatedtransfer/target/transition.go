@@ -2,6 +2,7 @@ package target
 
 import (
 	"fmt"
+	"math/big"
 
 	"github.com/SmartMeshFoundation/Photon/channel/channeltype"
 
@@ -53,11 +54,64 @@ func handleInitTraget(st *mediatedtransfer.ActionInitTargetStateChange) *transfe
 		BlockNumber:  blockNumber,
 		Db:           st.Db,
 	}
+	if st.Refuse {
+		//正在退出,不再接收新的锁,直接还给上家
+		return &transfer.TransitionResult{
+			NewState: nil,
+			Events: []transfer.Event{
+				announceDisposed(state),
+				&mediatedtransfer.EventRemoveStateManager{
+					Key: utils.Sha3(tr.LockSecretHash[:], tr.Token[:]),
+				},
+			},
+		}
+	}
 	safeToWait := mediator.IsSafeToWait(tr, route.RevealTimeout(), blockNumber)
 	/*
 			  if there is not enough time to safely withdraw the token on-chain
 		     silently let the transfer expire.
 	*/
+	if safeToWait && st.Hold {
+		/*
+			用户要求先暂停处理,既不请求密码也不披露密码,等用户决定
+		*/
+		state.State = mediatedtransfer.StateHeld
+		state.HeldSecret = st.Secret
+		state.HoldDeadline = tr.Expiration - int64(route.RevealTimeout())
+		held := &mediatedtransfer.EventTransferHeld{
+			LockSecretHash:    tr.LockSecretHash,
+			Token:             tr.Token,
+			Amount:            tr.Amount,
+			Initiator:         tr.Initiator,
+			ChannelIdentifier: route.ChannelIdentifier,
+			Expiration:        tr.Expiration,
+			HoldDeadline:      state.HoldDeadline,
+			SecretKnown:       st.Secret != utils.EmptyHash,
+		}
+		return &transfer.TransitionResult{
+			NewState: state,
+			Events:   []transfer.Event{held},
+		}
+	}
+	if safeToWait && st.Secret != utils.EmptyHash {
+		/*
+			密码是我自己的(比如我创建的收款请求),不需要向发起方请求,直接告诉上家换取 unlock
+		*/
+		tr.Secret = st.Secret
+		state.Secret = st.Secret
+		state.State = mediatedtransfer.StateRevealSecret
+		reveal := &mediatedtransfer.EventSendRevealSecret{
+			LockSecretHash: tr.LockSecretHash,
+			Secret:         tr.Secret,
+			Token:          tr.Token,
+			Receiver:       route.HopNode(),
+			Sender:         state.OurAddress,
+		}
+		return &transfer.TransitionResult{
+			NewState: state,
+			Events:   []transfer.Event{reveal},
+		}
+	}
 	if safeToWait {
 		secretRequest := &mediatedtransfer.EventSendSecretRequest{
 			ChannelIdentifier: route.ChannelIdentifier,
@@ -78,6 +132,94 @@ func handleInitTraget(st *mediatedtransfer.ActionInitTargetStateChange) *transfe
 	}
 }
 
+/*
+handleAcceptHeld 用户接受了暂停处理的交易,
+知道密码就直接告诉上家换取 unlock, 否则和普通交易一样向发起方请求密码
+*/
+func handleAcceptHeld(state *mediatedtransfer.TargetState, st *mediatedtransfer.ActionAcceptHeldTransferStateChange) *transfer.TransitionResult {
+	tr := state.FromTransfer
+	route := state.FromRoute
+	if state.State != mediatedtransfer.StateHeld || st.LockSecretHash != tr.LockSecretHash {
+		return &transfer.TransitionResult{
+			NewState: state,
+			Events:   nil,
+		}
+	}
+	if !mediator.IsSafeToWait(tr, route.RevealTimeout(), state.BlockNumber) {
+		return cancelHeld(state, "hold deadline passed")
+	}
+	var ev transfer.Event
+	if state.HeldSecret != utils.EmptyHash {
+		tr.Secret = state.HeldSecret
+		state.Secret = state.HeldSecret
+		state.State = mediatedtransfer.StateRevealSecret
+		ev = &mediatedtransfer.EventSendRevealSecret{
+			LockSecretHash: tr.LockSecretHash,
+			Secret:         tr.Secret,
+			Token:          tr.Token,
+			Receiver:       route.HopNode(),
+			Sender:         state.OurAddress,
+		}
+	} else {
+		state.State = mediatedtransfer.StateSecretRequest
+		ev = &mediatedtransfer.EventSendSecretRequest{
+			ChannelIdentifier: route.ChannelIdentifier,
+			LockSecretHash:    tr.LockSecretHash,
+			Amount:            tr.Amount,
+			Receiver:          tr.Initiator,
+		}
+	}
+	return &transfer.TransitionResult{
+		NewState: state,
+		Events:   []transfer.Event{ev},
+	}
+}
+
+/*
+cancelHeld 把锁原封不动地退给上家,不用等到过期,
+上家知道是接收方拒绝的,不会再尝试其他路径
+*/
+func cancelHeld(state *mediatedtransfer.TargetState, reason string) *transfer.TransitionResult {
+	tr := state.FromTransfer
+	route := state.FromRoute
+	events := []transfer.Event{
+		announceDisposed(state),
+		&mediatedtransfer.EventHeldTransferCanceled{
+			LockSecretHash:    tr.LockSecretHash,
+			Token:             tr.Token,
+			Amount:            tr.Amount,
+			Initiator:         tr.Initiator,
+			ChannelIdentifier: route.ChannelIdentifier,
+			Reason:            reason,
+		},
+		&mediatedtransfer.EventWithdrawFailed{
+			LockSecretHash:    tr.LockSecretHash,
+			ChannelIdentifier: route.ChannelIdentifier,
+			Reason:            reason,
+		},
+		&mediatedtransfer.EventRemoveStateManager{
+			Key: utils.Sha3(tr.LockSecretHash[:], tr.Token[:]),
+		},
+	}
+	return &transfer.TransitionResult{
+		NewState: nil,
+		Events:   events,
+	}
+}
+
+//announceDisposed 接收方拒绝这笔交易,把锁还给上家
+func announceDisposed(state *mediatedtransfer.TargetState) *mediatedtransfer.EventSendAnnounceDisposed {
+	tr := state.FromTransfer
+	return &mediatedtransfer.EventSendAnnounceDisposed{
+		Token:          tr.Token,
+		Amount:         new(big.Int).Set(tr.Amount),
+		LockSecretHash: tr.LockSecretHash,
+		Expiration:     tr.Expiration,
+		Receiver:       state.FromRoute.HopNode(),
+		Refused:        true,
+	}
+}
+
 //handleSecretRegisteredOnChain this state manager has finished
 func handleSecretRegisteredOnChain(state *mediatedtransfer.TargetState, st *mediatedtransfer.ContractSecretRevealOnChainStateChange) (it *transfer.TransitionResult) {
 	var events []transfer.Event
@@ -182,6 +324,9 @@ func handleBlock(state *mediatedtransfer.TargetState, st *transfer.BlockStateCha
 	if state.BlockNumber < st.BlockNumber {
 		state.BlockNumber = st.BlockNumber
 	}
+	if state.State == mediatedtransfer.StateHeld && state.BlockNumber >= state.HoldDeadline {
+		return cancelHeld(state, "hold deadline passed")
+	}
 	/*
 	   only emit the close event once
 
@@ -247,6 +392,9 @@ func clearIfFinalized(previt *transfer.TransitionResult) (it *transfer.Transitio
 
 // StateTransiton is State machine for the target node of a target transfer.
 func StateTransiton(originalState transfer.State, stateChange transfer.StateChange) (it *transfer.TransitionResult) {
+	if isMultiPath(originalState, stateChange) {
+		return multiPathStateTransiton(originalState, stateChange)
+	}
 	it = &transfer.TransitionResult{
 		NewState: originalState,
 		Events:   nil,
@@ -267,7 +415,8 @@ func StateTransiton(originalState transfer.State, stateChange transfer.StateChan
 		case *mediatedtransfer.ContractSecretRevealOnChainStateChange:
 			it = handleSecretRegisteredOnChain(state, st2)
 		case *mediatedtransfer.ReceiveSecretRevealStateChange:
-			if state.FromTransfer.Secret == utils.EmptyHash {
+			//暂停处理的交易只有用户接受以后才能披露密码
+			if state.FromTransfer.Secret == utils.EmptyHash && state.State != mediatedtransfer.StateHeld {
 				//可能会反复收到 reveal secret, 比如 token swap的时候,再比如存在环路的时候
 				// Maybe we can receive reveal secret over and over again,
 				// such as when using token swap, or circuit exist.
@@ -277,6 +426,12 @@ func StateTransiton(originalState transfer.State, stateChange transfer.StateChan
 			//有可能在不知道密码的情况下直接收到 unlock 消息,比如
 			// Maybe we can receive unlock message without receiving secret.
 			it = handleBalanceProof(state, st2)
+		case *mediatedtransfer.ActionAcceptHeldTransferStateChange:
+			it = handleAcceptHeld(state, st2)
+		case *mediatedtransfer.ActionCancelHeldTransferStateChange:
+			if state.State == mediatedtransfer.StateHeld && st2.LockSecretHash == state.FromTransfer.LockSecretHash {
+				it = cancelHeld(state, "canceled by target")
+			}
 		default:
 			log.Error(fmt.Sprintf("target state manager receive unkown state change,if this transfer is a token swap ,it's ok.  %s", utils.StringInterface(stateChange, 3)))
 		}
@@ -1,9 +1,12 @@
 package utils
 
 import (
+	"bytes"
 	"encoding/hex"
 	"fmt"
 	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
 )
 
 func TestEncrypt(t *testing.T) {
@@ -42,3 +45,28 @@ func TestPasswordDecrypt(t *testing.T) {
 	}
 	t.Logf("plain=%s", pass)
 }
+
+func TestEciesEncrypt(t *testing.T) {
+	key, _ := MakePrivateKeyAddress()
+	secret := NewRandomHash()
+	ct, err := EciesEncrypt(&key.PublicKey, secret[:])
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	pub, err := ParsePubkey(crypto.CompressPubkey(&key.PublicKey))
+	if err != nil || pub.X.Cmp(key.PublicKey.X) != 0 {
+		t.Errorf("ParsePubkey err %v", err)
+		return
+	}
+	data, err := EciesDecrypt(key, ct)
+	if err != nil || !bytes.Equal(data, secret[:]) {
+		t.Errorf("EciesDecrypt err %v", err)
+		return
+	}
+	key2, _ := MakePrivateKeyAddress()
+	_, err = EciesDecrypt(key2, ct)
+	if err == nil {
+		t.Error("decrypt with wrong key should fail")
+	}
+}
@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+/*
+FormatAmount 把链上的整数金额按照 token 的 decimals 转换为便于阅读的小数,
+例如 decimals=18 时 1250000000000000000 为 "1.25", 末尾的 0 会被去掉.
+*/
+func FormatAmount(amount *big.Int, decimals uint8) string {
+	if amount == nil {
+		return ""
+	}
+	if decimals == 0 {
+		return amount.String()
+	}
+	s := new(big.Int).Abs(amount).String()
+	if len(s) <= int(decimals) {
+		s = strings.Repeat("0", int(decimals)-len(s)+1) + s
+	}
+	intPart, fracPart := s[:len(s)-int(decimals)], strings.TrimRight(s[len(s)-int(decimals):], "0")
+	if amount.Sign() < 0 {
+		intPart = "-" + intPart
+	}
+	if len(fracPart) == 0 {
+		return intPart
+	}
+	return intPart + "." + fracPart
+}
+
+/*
+ParseAmount 是 FormatAmount 的反向操作, "1.25" 在 decimals=18 时为 1250000000000000000,
+小数位数超过 decimals 的金额无法在链上表示,返回错误.
+*/
+func ParseAmount(s string, decimals uint8) (*big.Int, error) {
+	str := strings.TrimSpace(s)
+	neg := strings.HasPrefix(str, "-")
+	if neg {
+		str = str[1:]
+	}
+	parts := strings.Split(str, ".")
+	if len(parts) > 2 {
+		return nil, fmt.Errorf("invalid amount %s", s)
+	}
+	intPart, fracPart := parts[0], ""
+	if len(parts) == 2 {
+		fracPart = parts[1]
+	}
+	if intPart == "" && fracPart == "" {
+		return nil, fmt.Errorf("invalid amount %s", s)
+	}
+	if len(fracPart) > int(decimals) {
+		return nil, fmt.Errorf("amount %s has more than %d decimals", s, decimals)
+	}
+	digits := intPart + fracPart + strings.Repeat("0", int(decimals)-len(fracPart))
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return nil, fmt.Errorf("invalid amount %s", s)
+		}
+	}
+	amount, ok := new(big.Int).SetString(digits, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid amount %s", s)
+	}
+	if neg {
+		amount.Neg(amount)
+	}
+	return amount, nil
+}
@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestFormatAndParseAmount(t *testing.T) {
+	cases := []struct {
+		amount   string
+		decimals uint8
+		human    string
+	}{
+		{"1250000000000000000", 18, "1.25"},
+		{"1000000000000000000", 18, "1"},
+		{"1", 18, "0.000000000000000001"},
+		{"0", 18, "0"},
+		{"-1500", 3, "-1.5"},
+		{"123", 0, "123"},
+	}
+	for _, c := range cases {
+		amount, _ := new(big.Int).SetString(c.amount, 10)
+		if s := FormatAmount(amount, c.decimals); s != c.human {
+			t.Errorf("FormatAmount(%s,%d)=%s, expect %s", c.amount, c.decimals, s, c.human)
+		}
+		a, err := ParseAmount(c.human, c.decimals)
+		if err != nil || a.Cmp(amount) != 0 {
+			t.Errorf("ParseAmount(%s,%d)=%s,%v, expect %s", c.human, c.decimals, a, err, c.amount)
+		}
+	}
+	a, err := ParseAmount(".5", 2)
+	if err != nil || a.Int64() != 50 {
+		t.Errorf(".5 should be 50, got %s,%v", a, err)
+	}
+	for _, s := range []string{"", ".", "1.2.3", "1.234", "1e3", "abc"} {
+		if _, err = ParseAmount(s, 2); err == nil {
+			t.Errorf("%q should be invalid", s)
+		}
+	}
+}
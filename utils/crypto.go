@@ -2,6 +2,8 @@ package utils
 
 import (
 	"crypto/ecdsa"
+	"crypto/rand"
+	"errors"
 	"io"
 
 	"math/big"
@@ -14,6 +16,7 @@ import (
 	"github.com/SmartMeshFoundation/Photon/log"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/crypto/ecies"
 )
 
 //EmptyHash all zero,invalid
@@ -115,3 +118,28 @@ func ReadBigInt(reader io.Reader) *big.Int {
 	bi.SetBytes(tmpbuf)
 	return bi
 }
+
+//ParsePubkey parse public key in uncompressed(65 bytes) or compressed(33 bytes) format
+func ParsePubkey(pubkey []byte) (*ecdsa.PublicKey, error) {
+	switch len(pubkey) {
+	case 65:
+		pub := crypto.ToECDSAPub(pubkey)
+		if pub == nil || pub.X == nil {
+			return nil, errors.New("invalid public key")
+		}
+		return pub, nil
+	case 33:
+		return crypto.DecompressPubkey(pubkey)
+	}
+	return nil, fmt.Errorf("invalid public key length %d", len(pubkey))
+}
+
+//EciesEncrypt encrypts data with public key, only the owner of private key can decrypt it
+func EciesEncrypt(pub *ecdsa.PublicKey, data []byte) ([]byte, error) {
+	return ecies.Encrypt(rand.Reader, ecies.ImportECDSAPublic(pub), data, nil, nil)
+}
+
+//EciesDecrypt decrypts data encrypted by EciesEncrypt
+func EciesDecrypt(privKey *ecdsa.PrivateKey, data []byte) ([]byte, error) {
+	return ecies.ImportECDSA(privKey).Decrypt(rand.Reader, data, nil, nil)
+}
@@ -0,0 +1,302 @@
+package photon
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/SmartMeshFoundation/Photon/channel/channeltype"
+	"github.com/SmartMeshFoundation/Photon/log"
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/params"
+	"github.com/SmartMeshFoundation/Photon/rerr"
+	"github.com/SmartMeshFoundation/Photon/transfer/mediatedtransfer"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+/*
+watchTower 替其他节点监控通道:
+ 1. 委托人(Delegator)把 `/api/1/thirdparty/` 生成的信息提交给我们,第三方地址必须是我们的地址
+ 2. 对方关闭通道以后,在 settle 期的后一半(合约只允许这时候委托更新),
+    如果链上 nonce 比委托的小,调用 updateBalanceProofDelegate
+ 3. 然后对已经在链上注册了密码的锁调用 unlockDelegate
+
+onChannelClosed/onBlock 在 Photon 主线程中调用,链上交易在其他 goroutine 中进行,
+修改 Delegation 都需要加锁.
+*/
+type watchTower struct {
+	rs         *Service
+	lock       sync.Mutex
+	running    map[common.Hash]bool
+	retryBlock map[common.Hash]int64
+}
+
+func newWatchTower(rs *Service) *watchTower {
+	return &watchTower{
+		rs:         rs,
+		running:    make(map[common.Hash]bool),
+		retryBlock: make(map[common.Hash]int64),
+	}
+}
+
+// verifyDelegation 验证委托人对 BalanceProof 的签名,合约也会验证,这里只是避免接受无效的委托
+func verifyDelegation(d *models.Delegation) error {
+	if d.ChannelIdentifier == utils.EmptyHash || d.TokenAddress == utils.EmptyAddress ||
+		d.Delegator == utils.EmptyAddress || d.PartnerAddress == utils.EmptyAddress {
+		return errors.New("channel_identifier,token_address,delegator and partner_address are required")
+	}
+	ut := &d.UpdateTransfer
+	if ut.Nonce == 0 {
+		if len(d.Unlocks) > 0 {
+			return errors.New("unlocks without balance proof")
+		}
+		return nil
+	}
+	if ut.TransferAmount == nil {
+		ut.TransferAmount = big.NewInt(0)
+	}
+	data := balanceProofDelegateData(ut.TransferAmount, ut.Locksroot, ut.Nonce, d.ChannelIdentifier, d.OpenBlockNumber)
+	signer, err := utils.Ecrecover(utils.Sha3(data), ut.NonClosingSignature)
+	if err != nil {
+		return err
+	}
+	if signer != d.Delegator {
+		return fmt.Errorf("balance proof is signed by %s, not delegator %s", signer.String(), d.Delegator.String())
+	}
+	for _, u := range d.Unlocks {
+		if u.Lock == nil || u.Lock.Amount == nil {
+			return errors.New("invalid lock of unlocks")
+		}
+		if utils.ShaSecret(u.Secret[:]) != u.Lock.LockSecretHash {
+			return fmt.Errorf("secret of lock %s mismatch", u.Lock.LockSecretHash.String())
+		}
+	}
+	return nil
+}
+
+func (wt *watchTower) onChannelClosed(st *mediatedtransfer.ContractClosedStateChange) {
+	wt.lock.Lock()
+	defer wt.lock.Unlock()
+	d, err := wt.rs.dao.GetDelegation(st.ChannelIdentifier)
+	if err != nil || d.Status != models.DelegationWatching {
+		return
+	}
+	d.ClosingAddress = st.ClosingAddress
+	d.ClosedBlock = st.ClosedBlock
+	if st.ClosingAddress == d.PartnerAddress && d.UpdateTransfer.Nonce > 0 {
+		d.Status = models.DelegationClosed
+	} else {
+		//委托人自己关闭的通道,或者对方从来没有给委托人转过账,不需要我们做什么
+		d.Status = models.DelegationFinished
+	}
+	log.Info(fmt.Sprintf("watchtower: channel %s closed by %s at %d, status=%s",
+		st.ChannelIdentifier.String(), utils.APex2(st.ClosingAddress), st.ClosedBlock, d.Status))
+	wt.save(d)
+}
+
+func (wt *watchTower) onChannelSettled(channelIdentifier common.Hash) {
+	wt.lock.Lock()
+	defer wt.lock.Unlock()
+	d, err := wt.rs.dao.GetDelegation(channelIdentifier)
+	if err != nil || d.Status == models.DelegationSettled {
+		return
+	}
+	d.Status = models.DelegationSettled
+	wt.save(d)
+}
+
+func (wt *watchTower) save(d *models.Delegation) {
+	d.UpdateTime = time.Now().Unix()
+	err := wt.rs.dao.SaveDelegation(d)
+	if err != nil {
+		log.Error(fmt.Sprintf("watchtower: save delegation of channel %s err %s", d.ChannelIdentifier.String(), err))
+	}
+}
+
+func (wt *watchTower) onBlock(blockNumber int64) {
+	if !wt.rs.Config.WatchTower {
+		return
+	}
+	wt.lock.Lock()
+	defer wt.lock.Unlock()
+	ds, err := wt.rs.dao.GetAllDelegations()
+	if err != nil {
+		log.Error(fmt.Sprintf("watchtower: GetAllDelegations err %s", err))
+		return
+	}
+	for _, d := range ds {
+		if d.Status != models.DelegationClosed || wt.running[d.ChannelIdentifier] {
+			continue
+		}
+		if blockNumber > d.SettleBlock() {
+			if d.Error == "" {
+				d.Error = "settle window passed"
+			}
+			d.Status = models.DelegationFinished
+			wt.save(d)
+			continue
+		}
+		if blockNumber < d.UpdateStartBlock() || blockNumber < wt.retryBlock[d.ChannelIdentifier] {
+			continue
+		}
+		wt.running[d.ChannelIdentifier] = true
+		go wt.protect(d, blockNumber)
+	}
+}
+
+/*
+protect 在链上更新委托人的对方的 BalanceProof, 然后 unlock
+*/
+func (wt *watchTower) protect(d *models.Delegation, blockNumber int64) {
+	err := wt.sendTxs(d)
+	wt.lock.Lock()
+	defer wt.lock.Unlock()
+	delete(wt.running, d.ChannelIdentifier)
+	//发送交易期间通道可能已经 settle 了
+	cur, err2 := wt.rs.dao.GetDelegation(d.ChannelIdentifier)
+	if err2 != nil || cur.Status != models.DelegationClosed {
+		return
+	}
+	if err != nil {
+		log.Error(fmt.Sprintf("watchtower: protect channel %s err %s", d.ChannelIdentifier.String(), err))
+		d.Error = err.Error()
+		wt.retryBlock[d.ChannelIdentifier] = blockNumber + params.WatchTowerRetryBlocks
+	} else {
+		d.Error = ""
+		d.Status = models.DelegationFinished
+		delete(wt.retryBlock, d.ChannelIdentifier)
+	}
+	wt.save(d)
+}
+
+func (wt *watchTower) sendTxs(d *models.Delegation) error {
+	tn, err := wt.rs.Chain.TokenNetwork(d.TokenAddress)
+	if err != nil {
+		return err
+	}
+	ut := &d.UpdateTransfer
+	if !d.BalanceProofSent {
+		_, _, nonce, err := tn.GetChannelParticipantInfo(d.PartnerAddress, d.Delegator)
+		if err != nil {
+			return err
+		}
+		if nonce > ut.Nonce {
+			//链上的比委托的还新,委托的锁也无法 unlock 了
+			return fmt.Errorf("nonce %d on chain is newer than delegation %d", nonce, ut.Nonce)
+		}
+		if nonce < ut.Nonce {
+			log.Info(fmt.Sprintf("watchtower: update balance proof of channel %s, nonce on chain=%d, delegation=%d",
+				d.ChannelIdentifier.String(), nonce, ut.Nonce))
+			err = tn.UpdateBalanceProofDelegate(d.PartnerAddress, d.Delegator, ut.TransferAmount, ut.Locksroot, ut.Nonce,
+				ut.ExtraHash, ut.ClosingSignature, ut.NonClosingSignature)
+			if err != nil {
+				return err
+			}
+		}
+		d.BalanceProofSent = true
+	}
+	//每次 unlock 成功以后, transferAmount 都会增加
+	unlocked := make(map[common.Hash]bool)
+	transferAmount := new(big.Int).Set(ut.TransferAmount)
+	for _, u := range d.Unlocks {
+		for _, h := range d.UnlockedLocks {
+			if h == u.Lock.LockSecretHash {
+				unlocked[h] = true
+				transferAmount.Add(transferAmount, u.Lock.Amount)
+			}
+		}
+	}
+	var lastErr error
+	for _, u := range d.Unlocks {
+		if unlocked[u.Lock.LockSecretHash] {
+			continue
+		}
+		registered, err := wt.rs.Chain.SecretRegistryProxy.IsSecretRegistered(u.Secret)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if !registered {
+			log.Info(fmt.Sprintf("watchtower: secret of lock %s is not registered on chain, ignore it", u.Lock.LockSecretHash.String()))
+			continue
+		}
+		err = tn.UnlockDelegate(d.PartnerAddress, d.Delegator, transferAmount, u.Lock, u.MerkleProof, u.Signature)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		d.UnlockedLocks = append(d.UnlockedLocks, u.Lock.LockSecretHash)
+		transferAmount.Add(transferAmount, u.Lock.Amount)
+	}
+	return lastErr
+}
+
+/*
+AddDelegation accepts a delegation of channel from delegator, replacing older one of the same channel.
+Signature of unlocks must be signed for our address.
+*/
+func (r *API) AddDelegation(d *models.Delegation) (err error) {
+	if !r.Photon.Config.WatchTower {
+		return errors.New("watchtower is disabled")
+	}
+	if err = verifyDelegation(d); err != nil {
+		return
+	}
+	if err = r.checkSmcStatus(); err != nil {
+		return
+	}
+	tn, err := r.Photon.Chain.TokenNetwork(d.TokenAddress)
+	if err != nil {
+		return
+	}
+	channelID, _, openBlockNumber, state, settleTimeout, err := tn.GetChannelInfo(d.Delegator, d.PartnerAddress)
+	if err != nil {
+		return
+	}
+	if channelID != d.ChannelIdentifier || int64(openBlockNumber) != d.OpenBlockNumber {
+		return rerr.ChannelNotFound(d.ChannelIdentifier.String())
+	}
+	if state != uint8(channeltype.StateOpened) {
+		return rerr.InvalidState("channel is not open")
+	}
+	wt := r.Photon.WatchTower
+	wt.lock.Lock()
+	defer wt.lock.Unlock()
+	old, err := r.Photon.dao.GetDelegation(d.ChannelIdentifier)
+	if err == nil && old.OpenBlockNumber == d.OpenBlockNumber {
+		if old.Status != models.DelegationWatching {
+			return rerr.InvalidState(fmt.Sprintf("delegation is %s", old.Status))
+		}
+		if old.UpdateTransfer.Nonce > d.UpdateTransfer.Nonce {
+			return fmt.Errorf("nonce %d is older than delegation %d", d.UpdateTransfer.Nonce, old.UpdateTransfer.Nonce)
+		}
+	}
+	d.SettleTimeout = int64(settleTimeout)
+	d.Status = models.DelegationWatching
+	d.ClosingAddress = utils.EmptyAddress
+	d.ClosedBlock = 0
+	d.BalanceProofSent = false
+	d.UnlockedLocks = nil
+	d.Error = ""
+	d.UpdateTime = time.Now().Unix()
+	return r.Photon.dao.SaveDelegation(d)
+}
+
+// GetDelegations all channels watched by us
+func (r *API) GetDelegations() ([]*models.Delegation, error) {
+	return r.Photon.dao.GetAllDelegations()
+}
+
+// RemoveDelegation stop watching channel
+func (r *API) RemoveDelegation(channelIdentifier common.Hash) error {
+	wt := r.Photon.WatchTower
+	wt.lock.Lock()
+	defer wt.lock.Unlock()
+	if wt.running[channelIdentifier] {
+		return rerr.InvalidState("sending transactions for this channel")
+	}
+	return r.Photon.dao.RemoveDelegation(channelIdentifier)
+}
@@ -0,0 +1,55 @@
+package photon
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/SmartMeshFoundation/Photon/models"
+	"github.com/SmartMeshFoundation/Photon/transfer/mtree"
+	"github.com/SmartMeshFoundation/Photon/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyDelegation(t *testing.T) {
+	key, addr := utils.MakePrivateKeyAddress()
+	d := &models.Delegation{
+		ChannelIdentifier: utils.NewRandomHash(),
+		OpenBlockNumber:   10,
+		TokenAddress:      utils.NewRandomAddress(),
+		Delegator:         addr,
+		PartnerAddress:    utils.NewRandomAddress(),
+	}
+	//对方没有转过账,什么都不需要签名
+	assert.Empty(t, verifyDelegation(d))
+	ut := &d.UpdateTransfer
+	ut.Nonce = 3
+	ut.TransferAmount = big.NewInt(20)
+	ut.Locksroot = utils.NewRandomHash()
+	sig, err := utils.SignData(key, balanceProofDelegateData(ut.TransferAmount, ut.Locksroot, ut.Nonce, d.ChannelIdentifier, d.OpenBlockNumber))
+	assert.Empty(t, err)
+	ut.NonClosingSignature = sig
+	assert.Empty(t, verifyDelegation(d))
+
+	secret := utils.NewRandomHash()
+	d.Unlocks = []*models.DelegationUnlock{
+		{
+			Lock: &mtree.Lock{
+				Expiration:     100,
+				Amount:         big.NewInt(5),
+				LockSecretHash: utils.ShaSecret(secret[:]),
+			},
+			Secret: secret,
+		},
+	}
+	assert.Empty(t, verifyDelegation(d))
+	d.Unlocks[0].Secret = utils.NewRandomHash()
+	assert.NotEmpty(t, verifyDelegation(d))
+	d.Unlocks = nil
+
+	//签名的不是委托人
+	d.Delegator = utils.NewRandomAddress()
+	assert.NotEmpty(t, verifyDelegation(d))
+	d.Delegator = addr
+	ut.Nonce = 4
+	assert.NotEmpty(t, verifyDelegation(d))
+}